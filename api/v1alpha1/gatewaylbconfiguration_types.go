@@ -30,6 +30,38 @@ type GatewayLBConfigurationSpec struct {
 	// BYO Resource ID of public IP prefix to be used as outbound.
 	// +optional
 	PublicIpPrefixId string `json:"publicIpPrefixId,omitempty"`
+
+	// Number of managed public IP prefixes to provision for outbound.
+	// +optional
+	PublicIpPrefixCount int32 `json:"publicIpPrefixCount,omitempty"`
+
+	// Whether managed public IP prefixes are named after the gateway and kept on deletion for reuse.
+	// +optional
+	ReusePublicIpPrefix bool `json:"reusePublicIpPrefix,omitempty"`
+
+	// Whether to provision an IPv6 public IP prefix for outbound.
+	// +optional
+	EnableIPv6 bool `json:"enableIPv6,omitempty"`
+
+	// BYO Resource ID of the NAT gateway the public IP prefix is associated with.
+	// +optional
+	NatGatewayId string `json:"natGatewayId,omitempty"`
+
+	// BYO Resource ID of the public IP address associated with the NAT gateway instead of a public IP prefix.
+	// +optional
+	PublicIpAddressId string `json:"publicIpAddressId,omitempty"`
+
+	// TCP idle timeout in minutes of the gateway public IPs.
+	// +optional
+	OutboundIdleTimeoutMinutes int32 `json:"outboundIdleTimeoutMinutes,omitempty"`
+
+	// Wireguard listening port of the gateway, picked automatically when not specified.
+	// +optional
+	WireguardPort int32 `json:"wireguardPort,omitempty"`
+
+	// Azure tags applied to the managed public IP prefixes.
+	// +optional
+	Tags map[string]string `json:"tags,omitempty"`
 }
 
 // GatewayLBConfigurationStatus defines the observed state of GatewayLBConfiguration
@@ -45,6 +77,29 @@ type GatewayLBConfigurationStatus struct {
 
 	// Egress IP Prefix CIDR used for this gateway configuration.
 	EgressIpPrefix string `json:"egressIpPrefix,omitempty"`
+
+	// Egress IPv6 Prefix CIDR used for this gateway configuration.
+	EgressIpv6Prefix string `json:"egressIpv6Prefix,omitempty"`
+
+	// Outbound mechanism currently used for egress traffic.
+	OutboundType OutboundType `json:"outboundType,omitempty"`
+
+	// Whether the managed public IP prefix was reclaimed from a deleted gateway with the same name.
+	PublicIpPrefixReused bool `json:"publicIpPrefixReused,omitempty"`
+
+	// TCP idle timeout in minutes applied to the gateway public IPs.
+	OutboundIdleTimeoutMinutes int32 `json:"outboundIdleTimeoutMinutes,omitempty"`
+
+	// Number of gateway VMSS instances, across all gateway VMSSes.
+	GatewayInstances int32 `json:"gatewayInstances,omitempty"`
+
+	// Kubernetes nodes of the gateway VMSS instances, across all gateway VMSSes.
+	// +optional
+	GatewayNodes []string `json:"gatewayNodes,omitempty"`
+
+	// Address space of the cluster virtual network.
+	// +optional
+	VnetAddressSpace []string `json:"vnetAddressSpace,omitempty"`
 }
 
 //+kubebuilder:object:root=true
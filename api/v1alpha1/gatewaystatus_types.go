@@ -15,6 +15,8 @@ type GatewayConfiguration struct {
 	StaticGatewayConfiguration string `json:"staticGatewayConfiguration,omitempty"`
 	// Network interface name
 	InterfaceName string `json:"interfaceName,omitempty"`
+	// Public IPs of the gateway egress prefixes associated with the gateway node
+	PublicIps []string `json:"publicIps,omitempty"`
 }
 
 type PeerConfiguration struct {
@@ -35,6 +37,10 @@ type GatewayStatusSpec struct {
 	ReadyGatewayConfigurations []GatewayConfiguration `json:"readyGatewayConfigurations,omitempty"`
 	// List of ready peer configurations
 	ReadyPeerConfigurations []PeerConfiguration `json:"readyPeerConfigurations,omitempty"`
+	// Whether the gateway node is draining before shutdown and no longer accepts traffic
+	Draining bool `json:"draining,omitempty"`
+	// Whether the gateway node is quarantined by node annotation and no longer accepts traffic
+	Quarantined bool `json:"quarantined,omitempty"`
 }
 
 // GatewayStatusStatus defines the observed state of GatewayStatus
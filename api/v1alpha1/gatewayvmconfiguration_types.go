@@ -30,6 +30,34 @@ type GatewayVMConfigurationSpec struct {
 	// BYO Resource ID of public IP prefix to be used as outbound.
 	// +optional
 	PublicIpPrefixId string `json:"publicIpPrefixId,omitempty"`
+
+	// Number of managed public IP prefixes to provision for outbound.
+	// +optional
+	PublicIpPrefixCount int32 `json:"publicIpPrefixCount,omitempty"`
+
+	// Whether managed public IP prefixes are named after the gateway and kept on deletion for reuse.
+	// +optional
+	ReusePublicIpPrefix bool `json:"reusePublicIpPrefix,omitempty"`
+
+	// Whether to provision an IPv6 public IP prefix for outbound.
+	// +optional
+	EnableIPv6 bool `json:"enableIPv6,omitempty"`
+
+	// BYO Resource ID of the NAT gateway the public IP prefix is associated with.
+	// +optional
+	NatGatewayId string `json:"natGatewayId,omitempty"`
+
+	// BYO Resource ID of the public IP address associated with the NAT gateway instead of a public IP prefix.
+	// +optional
+	PublicIpAddressId string `json:"publicIpAddressId,omitempty"`
+
+	// TCP idle timeout in minutes of the gateway public IPs.
+	// +optional
+	OutboundIdleTimeoutMinutes int32 `json:"outboundIdleTimeoutMinutes,omitempty"`
+
+	// Azure tags applied to the managed public IP prefixes.
+	// +optional
+	Tags map[string]string `json:"tags,omitempty"`
 }
 
 // GatewayVMConfigurationStatus defines the observed state of GatewayVMConfiguration
@@ -40,6 +68,56 @@ type GatewayVMConfigurationStatus struct {
 	// The egress source IP for traffic using this configuration.
 	EgressIpPrefix string `json:"egressIpPrefix,omitempty"`
 
+	// Public IP prefixes provisioned for this configuration, in the order of their ipConfigs.
+	// +optional
+	EgressIpPrefixes []string `json:"egressIpPrefixes,omitempty"`
+
+	// Resource ID of the public IP prefix of the egress IPs, managed or provided.
+	// +optional
+	PublicIpPrefixId string `json:"publicIpPrefixId,omitempty"`
+
+	// The egress source IPv6 prefix for traffic using this configuration.
+	EgressIpv6Prefix string `json:"egressIpv6Prefix,omitempty"`
+
+	// Outbound mechanism currently used for egress traffic.
+	OutboundType OutboundType `json:"outboundType,omitempty"`
+
+	// Whether the managed public IP prefix was reclaimed from a deleted gateway with the same name.
+	PublicIpPrefixReused bool `json:"publicIpPrefixReused,omitempty"`
+
+	// TCP idle timeout in minutes applied to the gateway public IPs.
+	OutboundIdleTimeoutMinutes int32 `json:"outboundIdleTimeoutMinutes,omitempty"`
+
+	// Resource ID of the NAT gateway that PublicIpPrefix is associated with.
+	// +optional
+	NatGatewayId string `json:"natGatewayId,omitempty"`
+
+	// Resource ID of the public IP prefix associated with the NAT gateway, recorded so that
+	// the association can be removed once the NAT gateway or the prefix is no longer used.
+	// +optional
+	NatGatewayPublicIpPrefixId string `json:"natGatewayPublicIpPrefixId,omitempty"`
+
+	// Resource ID of the public IP address associated with the NAT gateway, recorded so that the association can
+	// be removed once the NAT gateway or the address is no longer used.
+	// +optional
+	NatGatewayPublicIpAddressId string `json:"natGatewayPublicIpAddressId,omitempty"`
+
+	// Generation of the spec that has been fully applied to Azure resources.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Gateway VMSSes the gateway configuration has been applied to, recorded so that it can be removed
+	// from VMSSes no longer referenced by the spec.
+	// +optional
+	Vmsses []VmssReference `json:"vmsses,omitempty"`
+
+	// Number of gateway VMSS instances, across all gateway VMSSes.
+	GatewayInstances int32 `json:"gatewayInstances,omitempty"`
+
+	// Kubernetes nodes of the gateway VMSS instances, across all gateway VMSSes.
+	// +optional
+	GatewayNodes []string `json:"gatewayNodes,omitempty"`
+
 	// Gateway VM profile
 	GatewayVMProfiles []GatewayVMProfile `json:"gatewayVMProfiles,omitempty"`
 }
@@ -49,6 +127,11 @@ type GatewayVMProfile struct {
 	NodeName    string `json:"nodeName,omitempty"`
 	PrimaryIP   string `json:"primaryIP,omitempty"`
 	SecondaryIP string `json:"secondaryIP,omitempty"`
+	// +optional
+	SecondaryIPv6 string `json:"secondaryIPv6,omitempty"`
+	// Private IPs of the ipConfigs associated with the additional public IP prefixes.
+	// +optional
+	AdditionalSecondaryIPs []string `json:"additionalSecondaryIPs,omitempty"`
 }
 
 //+kubebuilder:object:root=true
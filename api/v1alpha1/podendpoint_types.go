@@ -4,7 +4,10 @@
 package v1alpha1
 
 import (
+	"strings"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -15,20 +18,114 @@ type PodEndpointSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// Name of StaticGatewayConfiguration the pod uses.
+	// Name of StaticGatewayConfiguration the pod uses, or <namespace>/<name> when the StaticGatewayConfiguration
+	// is in a different namespace from the pod.
 	StaticGatewayConfiguration string `json:"staticGatewayConfiguration,omitempty"`
 
 	// IPv4 address assigned to the pod.
 	PodIpAddress string `json:"podIpAddress,omitempty"`
 
+	// IPv6 address assigned to the pod, only set for dual-stack pods.
+	// +optional
+	PodIpv6Address string `json:"podIpv6Address,omitempty"`
+
 	// public key on pod side.
 	PodPublicKey string `json:"podPublicKey,omitempty"`
+
+	// Public key of the gateway peer in the pod network namespace, the CNI manager moves the peer to the new key when
+	// the gateway key is rotated.
+	// +optional
+	GatewayPublicKey string `json:"gatewayPublicKey,omitempty"`
+
+	// Egress bandwidth limit of the pod in Mbps, no limit if not set.
+	// +optional
+	//+kubebuilder:validation:Minimum=0
+	//+kubebuilder:validation:Maximum=32000
+	EgressRateLimitMbps int32 `json:"egressRateLimitMbps,omitempty"`
+
+	// Egress burst size of the pod in KB, defaults to the amount of data sent in 100ms at egressRateLimitMbps.
+	// +optional
+	//+kubebuilder:validation:Minimum=0
+	EgressBurstKB int32 `json:"egressBurstKB,omitempty"`
+
+	// DSCP value set on egress packets of the pod by the gateway node, packets are not marked if not set.
+	// +optional
+	//+kubebuilder:validation:Minimum=0
+	//+kubebuilder:validation:Maximum=63
+	EgressDscp int32 `json:"egressDscp,omitempty"`
+
+	// Public IP in the gateway egress prefix which egress traffic of the pod is pinned to.
+	// +optional
+	EgressSourceIp string `json:"egressSourceIp,omitempty"`
+
+	// Prioritized StaticGatewayConfigurations the pod may fail over to, in the same format as
+	// staticGatewayConfiguration. Only set when the pod annotation lists more than one gateway.
+	// +optional
+	GatewayCandidates []string `json:"gatewayCandidates,omitempty"`
+
+	// Whether the pod moves back to a higher priority gateway in gatewayCandidates once it recovers.
+	// +optional
+	Failback bool `json:"failback,omitempty"`
+
+	// Path of the pod network namespace on the node, used to re-home the pod tunnel on failover.
+	// +optional
+	PodNetnsPath string `json:"podNetnsPath,omitempty"`
+
+	// IP of the gateway node the pod tunnel connects to, empty when it connects to the gateway internal load
+	// balancer frontend. The CNI manager moves the tunnel when the node no longer serves the gateway.
+	// +optional
+	GatewayEndpointIp string `json:"gatewayEndpointIp,omitempty"`
+
+	// Destination CIDRs of the gateway routed to the pod primary interface instead of the gateway in the pod
+	// network namespace, used to apply excludeCidrs changes to running pods.
+	// +optional
+	ExceptionCidrs []string `json:"exceptionCidrs,omitempty"`
+
+	// Destination CIDRs of the gateway routed to the gateway in the pod network namespace when the pod default
+	// route is not the gateway, used to apply includeCidrs and excludeCidrs changes to running pods.
+	// +optional
+	IncludeCidrs []string `json:"includeCidrs,omitempty"`
+
+	// Default route of the pod network namespace, used to move the pod default route between the gateway and the
+	// pod primary interface when defaultRoute of the gateway changes.
+	// +optional
+	DefaultRoute RouteType `json:"defaultRoute,omitempty"`
+}
+
+// PeerFailure reports consecutive failures of a gateway node to configure the pod wireguard peer
+type PeerFailure struct {
+	// Number of consecutive times the gateway node failed to configure the pod wireguard peer.
+	Retries int32 `json:"retries"`
+
+	// Last error of configuring the pod wireguard peer on the gateway node.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
 }
 
 // PodEndpointStatus defines the observed state of PodEndpoint
 type PodEndpointStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// Gateway node which last completed a wireguard handshake with the pod.
+	// +optional
+	GatewayNode string `json:"gatewayNode,omitempty"`
+
+	// Failures of gateway nodes to configure the pod wireguard peer by node name, the entry of a node is removed once
+	// it configures the peer.
+	// +optional
+	PeerFailures map[string]PeerFailure `json:"peerFailures,omitempty"`
+
+	// Source port range, e.g. 1024-1087, the gateway sNATs TCP and UDP connections of the pod to, only set when
+	// the gateway has snatPortRangeSize.
+	// +optional
+	SnatPortRange string `json:"snatPortRange,omitempty"`
+
+	// Conditions of the pod wireguard tunnel, e.g. TunnelHealthy.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -52,6 +149,14 @@ type PodEndpointList struct {
 	Items           []PodEndpoint `json:"items"`
 }
 
+// GetStaticGatewayConfigurationKey returns namespaced name of the StaticGatewayConfiguration the pod uses
+func (podEndpoint *PodEndpoint) GetStaticGatewayConfigurationKey() types.NamespacedName {
+	if namespace, name, found := strings.Cut(podEndpoint.Spec.StaticGatewayConfiguration, "/"); found {
+		return types.NamespacedName{Namespace: namespace, Name: name}
+	}
+	return types.NamespacedName{Namespace: podEndpoint.Namespace, Name: podEndpoint.Spec.StaticGatewayConfiguration}
+}
+
 func init() {
 	SchemeBuilder.Register(&PodEndpoint{}, &PodEndpointList{})
 }
@@ -4,6 +4,8 @@
 package v1alpha1
 
 import (
+	"slices"
+
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -11,20 +13,56 @@ import (
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
-// GatewayVmssProfile finds an existing gateway VMSS (virtual machine scale set).
+// VmssReference references an existing VMSS.
+type VmssReference struct {
+	// Resource group of the VMSS. Must be in the cluster subscription unless subscriptionId is specified.
+	VmssResourceGroup string `json:"vmssResourceGroup"`
+
+	// Name of the VMSS
+	VmssName string `json:"vmssName"`
+}
+
+// GatewayVmssProfile finds existing gateway VMSSes (virtual machine scale sets).
 type GatewayVmssProfile struct {
-	// Resource group of the VMSS. Must be in the same subscription.
+	// Subscription of the gateway VMSSes, and of the public IP prefix or NAT gateway they egress with, when they
+	// are in a different subscription than the cluster, e.g. a shared subscription hosting egress gateways. The
+	// gateway LoadBalancer is then created in the resource group and virtual network of the VMSSes, which must be
+	// peered with the cluster virtual network. The controller credential must have access to the subscription.
+	// Defaults to the cluster subscription, and cannot be changed after the gateway is created.
+	// +optional
+	SubscriptionId string `json:"subscriptionId,omitempty"`
+
+	// Resource group of the VMSS. Must be in the cluster subscription unless subscriptionId is specified.
 	VmssResourceGroup string `json:"vmssResourceGroup,omitempty"`
 
 	// Name of the VMSS
 	VmssName string `json:"vmssName,omitempty"`
 
-	// Public IP prefix size to be applied to this VMSS.
-	//+kubebuilder:validation:Minimum=0
+	// VMSSes to spread the gateway across, instead of vmssResourceGroup and vmssName. Peers are served by
+	// instances of all listed VMSSes. The first VMSS provides the gateway LoadBalancer frontend IP, so it
+	// should be kept when others are added or removed, changing it changes the gateway IP.
+	// +optional
+	//+kubebuilder:validation:MaxItems=8
+	Vmsses []VmssReference `json:"vmsses,omitempty"`
+
+	// Public IP prefix size to be applied to this VMSS, Azure supports 28 to 31.
+	// Optional when publicIpPrefixId is specified, the size of the provided prefix is used then.
+	//+kubebuilder:validation:Minimum=28
 	//+kubebuilder:validation:Maximum=31
 	PublicIpPrefixSize int32 `json:"publicIpPrefixSize,omitempty"`
 }
 
+// VmssReferences returns the gateway VMSSes referenced by the profile
+func (p GatewayVmssProfile) VmssReferences() []VmssReference {
+	if len(p.Vmsses) > 0 {
+		return p.Vmsses
+	}
+	if p.VmssName == "" {
+		return nil
+	}
+	return []VmssReference{{VmssResourceGroup: p.VmssResourceGroup, VmssName: p.VmssName}}
+}
+
 // RouteType defines the type of defaultRoute.
 // +kubebuilder:validation:Enum=azureNetworking;staticEgressGateway
 type RouteType string
@@ -37,7 +75,32 @@ const (
 	RouteAzureNetworking RouteType = "azureNetworking"
 )
 
+// IPVersion is an IP address family of pod traffic.
+// +kubebuilder:validation:Enum=IPv4;IPv6
+type IPVersion string
+
+const (
+	IPv4 IPVersion = "IPv4"
+	IPv6 IPVersion = "IPv6"
+)
+
+// OutboundType defines how egress traffic leaves the gateway nodes.
+type OutboundType string
+
+const (
+	// OutboundPublicIPPrefix assigns each gateway node instance level public IPs from the public IP prefix.
+	OutboundPublicIPPrefix OutboundType = "publicIPPrefix"
+
+	// OutboundNatGateway associates the public IP prefix with a NAT gateway attached to the gateway subnet.
+	OutboundNatGateway OutboundType = "natGateway"
+
+	// OutboundPrivateIP egresses with the private IPs of the gateway nodes, no public IP is provisioned.
+	OutboundPrivateIP OutboundType = "privateIP"
+)
+
 // StaticGatewayConfigurationSpec defines the desired state of StaticGatewayConfiguration
+// +kubebuilder:validation:XValidation:rule="(has(self.reusePublicIpPrefix) && self.reusePublicIpPrefix) == (has(oldSelf.reusePublicIpPrefix) && oldSelf.reusePublicIpPrefix)",message="reusePublicIpPrefix cannot be changed after the gateway is created"
+// +kubebuilder:validation:XValidation:rule="(has(self.gatewayVmssProfile) && has(self.gatewayVmssProfile.subscriptionId)) == (has(oldSelf.gatewayVmssProfile) && has(oldSelf.gatewayVmssProfile.subscriptionId)) && (!has(self.gatewayVmssProfile) || !has(self.gatewayVmssProfile.subscriptionId) || self.gatewayVmssProfile.subscriptionId == oldSelf.gatewayVmssProfile.subscriptionId)",message="gatewayVmssProfile.subscriptionId cannot be changed after the gateway is created"
 type StaticGatewayConfigurationSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
@@ -59,11 +122,217 @@ type StaticGatewayConfigurationSpec struct {
 	ProvisionPublicIps bool `json:"provisionPublicIps"`
 
 	// BYO Resource ID of public IP prefix to be used as outbound. This can only be specified when provisionPublicIps is true.
+	// The prefix must already exist, it is only read and never created or modified by the controller.
 	// +optional
 	PublicIpPrefixId string `json:"publicIpPrefixId,omitempty"`
 
-	// CIDRs to be excluded from the default route.
+	// Number of managed public IP prefixes to provision for outbound. Each gateway node gets one
+	// public IP from every prefix and egress connections are spread across them. Can only be larger
+	// than 1 when provisionPublicIps is true and publicIpPrefixId is not specified.
+	//+kubebuilder:validation:Minimum=1
+	//+kubebuilder:validation:Maximum=8
+	// +optional
+	PublicIpPrefixCount int32 `json:"publicIpPrefixCount,omitempty"`
+
+	// Whether to name managed public IP prefixes after the gateway namespace and name instead of its UID,
+	// and keep them when the gateway is deleted. A gateway recreated with the same namespace and name then
+	// reclaims the same egress IPs if the prefixes still exist and are not used by another gateway. Retained
+	// prefixes have to be deleted manually once no longer needed. Can only be set when provisionPublicIps is
+	// true and publicIpPrefixId is not specified, and cannot be changed after the gateway is created.
+	// +optional
+	ReusePublicIpPrefix bool `json:"reusePublicIpPrefix,omitempty"`
+
+	// CIDRs to be excluded from the default route. Single IP addresses should be given as /32 or /128 CIDRs.
 	ExcludeCidrs []string `json:"excludeCidrs,omitempty"`
+
+	// CIDRs to be routed to the gateway when defaultRoute is azureNetworking, all other traffic
+	// goes through pod's eth0. Can only be set when defaultRoute is azureNetworking. When empty,
+	// excludeCidrs are routed to the gateway instead, as gateways did before this field was added.
+	// +optional
+	IncludeCidrs []string `json:"includeCidrs,omitempty"`
+
+	// ConfigMap in the gateway namespace holding more CIDRs to be excluded from the default route, e.g. a list
+	// shared by many gateways. The ConfigMap must be labeled egressgateway.kubernetes.azure.com/exclude-cidrs=true.
+	// The CIDRs are read by the controller manager, reported in status.configMapExcludeCidrs and excluded along
+	// with excludeCidrs.
+	// +optional
+	ExcludeCidrsConfigMap *ExcludeCidrsConfigMapReference `json:"excludeCidrsConfigMap,omitempty"`
+
+	// FQDNs to be excluded from the default route. They are resolved periodically by the
+	// gateway daemon and the resolved addresses are excluded along with excludeCidrs.
+	// +optional
+	ExcludeFQDNs []string `json:"excludeFqdns,omitempty"`
+
+	// Whether to provision an IPv6 public IP prefix for outbound in addition to the IPv4 one.
+	// The IPv6 prefix is always managed and has the same number of addresses as the IPv4 prefix.
+	// +optional
+	EnableIPv6 bool `json:"enableIPv6,omitempty"`
+
+	// IP versions of pod traffic routed through the gateway in dual-stack clusters, traffic of other IP
+	// versions keeps the node path of the pod, e.g. [IPv4] to egress IPv6 traffic from the nodes. IPv6 can
+	// only be tunneled when enableIPv6 is set. When not specified, IPv4 and, with enableIPv6, IPv6 traffic
+	// is tunneled. Changes apply to pods created afterwards.
+	// +optional
+	// +listType=set
+	//+kubebuilder:validation:MinItems=1
+	//+kubebuilder:validation:MaxItems=2
+	TunnelIPVersions []IPVersion `json:"tunnelIPVersions,omitempty"`
+
+	// Namespaces other than the gateway's own whose pods are allowed to use the gateway, by referencing
+	// it as <namespace>/<name> in pod annotation. Pods in namespaces not listed are rejected.
+	// +optional
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+
+	// MTU of the wireguard interfaces on both gateway and pod side, 1420 by default. Lower it when
+	// the node network has extra encapsulation overhead, e.g. another overlay, to avoid fragmentation.
+	// +optional
+	//+kubebuilder:validation:Minimum=1280
+	//+kubebuilder:validation:Maximum=1420
+	Mtu int32 `json:"mtu,omitempty"`
+
+	// Whether to clamp the MSS of TCP connections tunneled through the gateway to fit the wireguard MTU. Enable it
+	// when large TCP egress flows stall because path MTU discovery does not work across the tunnel.
+	// +optional
+	EnableTcpMssClamping bool `json:"enableTcpMssClamping,omitempty"`
+
+	// Destination ports or port ranges, e.g. "443" or "8000-8080", pods may reach through the gateway over TCP
+	// and UDP, all other TCP and UDP traffic is dropped on gateway nodes. Cannot be combined with
+	// deniedDestinationPorts. All ports are allowed when neither is set.
+	// +optional
+	AllowedDestinationPorts []string `json:"allowedDestinationPorts,omitempty"`
+
+	// Destination ports or port ranges, e.g. "25" or "6660-6669", whose TCP and UDP traffic from pods is dropped
+	// on gateway nodes. Cannot be combined with allowedDestinationPorts.
+	// +optional
+	DeniedDestinationPorts []string `json:"deniedDestinationPorts,omitempty"`
+
+	// Whether to log packets dropped by allowedDestinationPorts or deniedDestinationPorts to the kernel log of
+	// gateway nodes, rate limited.
+	// +optional
+	LogDroppedPackets bool `json:"logDroppedPackets,omitempty"`
+
+	// Interval in seconds of wireguard persistent keepalive between pods and the gateway, 0 disables it.
+	// When unset, pods on nodes with pod CIDRs, whose tunnel traffic is sNATed to the node IP, send keepalives
+	// every 25 seconds, and other pods don't. Set it when idle tunnels are dropped by NAT or connection tracking
+	// timeouts elsewhere on the way.
+	// +optional
+	//+kubebuilder:validation:Minimum=0
+	//+kubebuilder:validation:Maximum=65535
+	PersistentKeepaliveSeconds *int32 `json:"persistentKeepaliveSeconds,omitempty"`
+
+	// BYO Resource ID of a NAT gateway attached to the gateway subnet. When specified, the public IP
+	// prefix is associated with the NAT gateway instead of being assigned to the gateway nodes.
+	// Requires provisionPublicIps, and cannot be combined with multiple public IP prefixes or IPv6.
+	// +optional
+	NatGatewayId string `json:"natGatewayId,omitempty"`
+
+	// BYO Resource ID of a Standard public IP address associated with the NAT gateway of natGatewayId instead of
+	// a public IP prefix, so that the gateway egresses with a single IP, e.g. for destinations allowlisting one IP.
+	// It is reported as a /32 egressIpPrefix. Requires natGatewayId, and cannot be combined with publicIpPrefixId
+	// or reusePublicIpPrefix.
+	// +optional
+	PublicIpAddressId string `json:"publicIpAddressId,omitempty"`
+
+	// TCP idle timeout in minutes of the gateway public IPs, after which idle egress connections are dropped.
+	// Azure applies 4 minutes when not specified, raise it for long-lived idle connections, e.g. database links.
+	// Requires provisionPublicIps and cannot be combined with natGatewayId, whose idle timeout is configured on
+	// the NAT gateway itself.
+	// +optional
+	//+kubebuilder:validation:Minimum=4
+	//+kubebuilder:validation:Maximum=30
+	OutboundIdleTimeoutMinutes int32 `json:"outboundIdleTimeoutMinutes,omitempty"`
+
+	// Wireguard listening port of the gateway, also used as LoadBalancer rule port. A free port
+	// between 6000 and 6999 is picked when not specified. Must not be used by another gateway on the
+	// same nodepool. Changing it recreates the gateway tunnel, existing pods need to be recreated.
+	// +optional
+	//+kubebuilder:validation:Minimum=6000
+	//+kubebuilder:validation:Maximum=6999
+	WireguardPort int32 `json:"wireguardPort,omitempty"`
+
+	// Azure tags applied to the managed public IP prefixes of the gateway, in addition to the default tags
+	// configured on the controller manager. Tags added to the prefixes out-of-band are kept.
+	// +optional
+	//+kubebuilder:validation:MaxProperties=50
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// Priority of the policy routing rules on gateway nodes that send egress traffic of the gateway
+	// through the default route of eth0, lower values take precedence. Set it when the main route table
+	// of gateway nodes steers traffic elsewhere, e.g. to a firewall, so that only tunneled pod traffic
+	// bypasses those routes. Rules are not added when not specified.
+	// +optional
+	//+kubebuilder:validation:Minimum=1
+	//+kubebuilder:validation:Maximum=32765
+	RoutePriority int32 `json:"routePriority,omitempty"`
+
+	// Firewall mark set by gateway nodes on encrypted wireguard packets of the gateway, for integration with
+	// policy routing of gateway nodes, e.g. to send tunnel traffic through a dedicated route table. Changes
+	// apply to the running gateway. No mark is set when not specified.
+	// +optional
+	WireguardFwMark *WireguardFwMark `json:"wireguardFwMark,omitempty"`
+
+	// Log one of every flowLogSampleRate new egress flows of the gateway on gateway nodes, e.g. for security
+	// audit. Each record has the source pod, destination IP and port and the public IP and port the flow is
+	// sNATed to. Flow logging is disabled when not specified, 1 logs every flow.
+	// +optional
+	//+kubebuilder:validation:Minimum=1
+	FlowLogSampleRate int32 `json:"flowLogSampleRate,omitempty"`
+
+	// IPv4 address of a DNS resolver reachable through the gateway. When specified, pods using the gateway route
+	// it through the wireguard tunnel, even when it is in ExcludeCidrs. Pods send DNS queries to it by listing it
+	// in the nameservers of their dnsConfig, other DNS traffic keeps its route.
+	// +optional
+	GatewayDNS string `json:"gatewayDns,omitempty"`
+
+	// IPv4 address pods use as the wireguard endpoint of the gateway instead of the internal load balancer
+	// frontend or gateway node IPs, e.g. the frontend of a load balancer forwarding to the gateway when pods in a
+	// spoke virtual network use a gateway in a peered hub virtual network. Pods route it outside the tunnel. It
+	// must be a unicast address that is not routed to the gateway, i.e. not in PrivateCidrs, nor in ExcludeCidrs
+	// when defaultRoute is azureNetworking without IncludeCidrs.
+	// +optional
+	PeerEndpointIp string `json:"peerEndpointIp,omitempty"`
+
+	// Destination CIDRs of trusted networks, e.g. on-premise networks behind a firewall, which receive pod
+	// traffic from the gateway with the original pod IP as source instead of the gateway egress IPs. They must
+	// be routed to the gateway, i.e. not overlap ExcludeCidrs and, when IncludeCidrs is set, be within it.
+	// +optional
+	PreserveSourceIpCidrs []string `json:"preserveSourceIpCidrs,omitempty"`
+
+	// Destination CIDRs only reachable within the virtual network, e.g. Private Link private endpoints. They are
+	// routed to the gateway even when defaultRoute is azureNetworking and includeCidrs does not cover them, and the
+	// gateway sNATs traffic to them to its private IP instead of spreading it across egress IPs, so that private
+	// endpoints see a single, stable source address within the virtual network. Must not overlap excludeCidrs or
+	// preserveSourceIpCidrs.
+	// +optional
+	PrivateCidrs []string `json:"privateCidrs,omitempty"`
+
+	// Whether the gateway sNATs traffic to the address space of the cluster virtual network across egress IPs
+	// like other traffic. By default, the gateway handles the address space reported in status.vnetAddressSpace
+	// like privateCidrs and sNATs traffic to it to its private IP.
+	// +optional
+	SnatVnetTraffic bool `json:"snatVnetTraffic,omitempty"`
+
+	// Number of source ports in the range each pod is pinned to, e.g. for downstream firewalls matching on
+	// source port. When set, the gateway sNATs TCP and UDP connections of each pod to its own port range of the
+	// gateway private IP, derived from the pod IP and reported in the PodEndpoint status. Pods pinned to an
+	// egress source IP, and pods beyond the number of available ranges, are sNATed from the shared pool.
+	// Only IPv4 traffic is pinned.
+	// +optional
+	//+kubebuilder:validation:Minimum=8
+	//+kubebuilder:validation:Maximum=64512
+	SnatPortRangeSize int32 `json:"snatPortRangeSize,omitempty"`
+
+	// Maximum number of pods using the gateway at the same time. New pods are rejected with an error while the
+	// gateway is full, and admitted again once pods using it are deleted. Unlimited when not specified.
+	// +optional
+	//+kubebuilder:validation:Minimum=1
+	MaxPods int32 `json:"maxPods,omitempty"`
+
+	// Mirror a copy of egress packets of the gateway to a collector, e.g. an intrusion detection system. Packets
+	// are copied on gateway nodes after being sNATed, so the mirrored copies carry gateway egress IPs instead of
+	// pod IPs. Mirroring costs CPU and bandwidth on gateway nodes, use sampleRate to bound the volume.
+	// +optional
+	TrafficMirror *TrafficMirror `json:"trafficMirror,omitempty"`
 }
 
 // GatewayProfile provides details about gateway side configuration.
@@ -74,23 +343,150 @@ type GatewayServerProfile struct {
 	// Listening port of the gateway server.
 	Port int32 `json:"port,omitempty"`
 
+	// Wireguard endpoint of the gateway server in <ip>:<port> form, i.e. the endpoint of the gateway peer on pods.
+	Endpoint string `json:"endpoint,omitempty"`
+
 	// Gateway server public key.
 	PublicKey string `json:"publicKey,omitempty"`
 
+	// Public key of the key pair staged by an ongoing key rotation, which gateway nodes switch to once it has been
+	// published for a while.
+	// +optional
+	NextPublicKey string `json:"nextPublicKey,omitempty"`
+
+	// Public key replaced by the last key rotation, kept until no PodEndpoint of the gateway uses it.
+	// +optional
+	PreviousPublicKey string `json:"previousPublicKey,omitempty"`
+
 	// Reference of the secret that holds gateway side private key.
 	PrivateKeySecretRef *corev1.ObjectReference `json:"privateKeySecretRef,omitempty"`
 }
 
+// ExcludeCidrsConfigMapReference references a ConfigMap key holding CIDRs separated by commas, spaces or new lines,
+// lines starting with # are ignored.
+type ExcludeCidrsConfigMapReference struct {
+	// Name of the ConfigMap in the gateway namespace.
+	Name string `json:"name"`
+
+	// Key of the ConfigMap data holding the CIDRs.
+	Key string `json:"key"`
+}
+
+// WireguardFwMark is the firewall mark of the gateway wireguard device on gateway nodes
+type WireguardFwMark struct {
+	// Mark set on encrypted wireguard packets sent by the gateway. It must not be a mark used by the gateway
+	// daemon, i.e. a wireguard port between 6000 and 6999, nor the CNI plugin mark 8738, nor have the kube-proxy
+	// mark bits 0x4000 and 0x8000 set.
+	//+kubebuilder:validation:Minimum=1
+	Mark int32 `json:"mark"`
+
+	// Route table looked up by packets with the mark. When specified, gateway nodes add a policy routing rule
+	// for the mark in the host network namespace, where wireguard packets of gateways are sent from. No rule
+	// is added when not specified, e.g. when rules are managed by another agent.
+	// +optional
+	//+kubebuilder:validation:Minimum=1
+	RouteTable int32 `json:"routeTable,omitempty"`
+}
+
+// TrafficMirror configures where egress packets of the gateway are mirrored to, exactly one of targetInterface
+// and vxlan must be specified.
+type TrafficMirror struct {
+	// Name of an existing interface in the host network namespace of gateway nodes mirrored packets are sent out of.
+	// +optional
+	TargetInterface string `json:"targetInterface,omitempty"`
+
+	// VXLAN tunnel to a remote collector mirrored packets are encapsulated in.
+	// +optional
+	Vxlan *TrafficMirrorVxlan `json:"vxlan,omitempty"`
+
+	// Mirror about one of every sampleRate egress TCP, UDP and ICMP packets, selected by their checksum. Must be a
+	// power of 2, all packets are mirrored when not specified.
+	// +optional
+	//+kubebuilder:validation:Minimum=1
+	//+kubebuilder:validation:Maximum=1024
+	SampleRate int32 `json:"sampleRate,omitempty"`
+}
+
+// TrafficMirrorVxlan is a VXLAN tunnel created on gateway nodes to send mirrored packets to a remote collector.
+type TrafficMirrorVxlan struct {
+	// IPv4 address of the collector terminating the tunnel.
+	CollectorIp string `json:"collectorIp"`
+
+	// VXLAN network identifier of the tunnel, must be unique among mirroring gateways on the same nodepool.
+	//+kubebuilder:validation:Minimum=1
+	//+kubebuilder:validation:Maximum=16777215
+	Vni int32 `json:"vni"`
+
+	// Destination UDP port of the tunnel, 4789 by default.
+	// +optional
+	//+kubebuilder:validation:Minimum=1
+	//+kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port,omitempty"`
+}
+
 // StaticGatewayConfigurationStatus defines the observed state of StaticGatewayConfiguration
 type StaticGatewayConfigurationStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// Egress IP Prefix CIDR used for this gateway configuration.
+	// Egress IP Prefix CIDR used for this gateway configuration, comma separated when there are multiple.
 	EgressIpPrefix string `json:"egressIpPrefix,omitempty"`
 
+	// Egress IPv6 Prefix CIDR used for this gateway configuration, only set when IPv6 is enabled.
+	EgressIpv6Prefix string `json:"egressIpv6Prefix,omitempty"`
+
+	// Outbound mechanism currently used for egress traffic.
+	OutboundType OutboundType `json:"outboundType,omitempty"`
+
+	// Whether the managed public IP prefix was reclaimed from a deleted gateway with the same namespace and
+	// name, false when it was newly created. Only the first prefix is reported when there are several.
+	PublicIpPrefixReused bool `json:"publicIpPrefixReused,omitempty"`
+
+	// TCP idle timeout in minutes applied to the gateway public IPs, only set when egress traffic leaves from
+	// public IPs assigned to the gateway nodes.
+	OutboundIdleTimeoutMinutes int32 `json:"outboundIdleTimeoutMinutes,omitempty"`
+
 	// Gateway server profile.
 	GatewayServerProfile `json:"gatewayServerProfile,omitempty"`
+
+	// CIDRs currently resolved from excludeFqdns and excluded from the default route.
+	ResolvedExcludeCidrs []string `json:"resolvedExcludeCidrs,omitempty"`
+
+	// CIDRs last read from excludeCidrsConfigMap and excluded from the default route.
+	ConfigMapExcludeCidrs []string `json:"configMapExcludeCidrs,omitempty"`
+
+	// Number of gateway VMSS instances, across all gateway VMSSes.
+	GatewayInstances int32 `json:"gatewayInstances,omitempty"`
+
+	// Kubernetes nodes of the gateway VMSS instances, across all gateway VMSSes. The CNI manager connects pods
+	// running on one of them to the gateway daemon on the same node when it prefers local gateway nodes.
+	GatewayNodes []string `json:"gatewayNodes,omitempty"`
+
+	// Address space of the cluster virtual network, sNATed to the gateway private IP unless snatVnetTraffic is set.
+	VnetAddressSpace []string `json:"vnetAddressSpace,omitempty"`
+
+	// Wireguard endpoints in <ip>:<port> form of the gateway nodes serving this gateway, one per node that has the
+	// gateway configured and is neither draining nor quarantined. Pods connect to one of them directly instead of
+	// the internal load balancer frontend when the CNI manager prefers same zone gateway nodes.
+	GatewayEndpoints []string `json:"gatewayEndpoints,omitempty"`
+
+	// Number of pods using this gateway, i.e. PodEndpoints referencing it.
+	ConnectedPods int32 `json:"connectedPods,omitempty"`
+
+	// Last time connectedPods changed.
+	LastPeerChangeTime *metav1.Time `json:"lastPeerChangeTime,omitempty"`
+
+	// Last time the manager successfully reconciled the gateway VMSS instances and public IP prefixes in Azure.
+	LastAzureSyncTime *metav1.Time `json:"lastAzureSyncTime,omitempty"`
+
+	// Error of the last failed reconcile of the gateway Azure resources, cleared once a reconcile succeeds.
+	LastAzureSyncError string `json:"lastAzureSyncError,omitempty"`
+
+	// Conditions of the gateway configuration, e.g. DryRun.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -114,6 +510,25 @@ type StaticGatewayConfigurationList struct {
 	Items           []StaticGatewayConfiguration `json:"items"`
 }
 
+// AllowsNamespace returns whether pods in the namespace are allowed to use the gateway
+func (gwConfig *StaticGatewayConfiguration) AllowsNamespace(namespace string) bool {
+	return namespace == gwConfig.Namespace || slices.Contains(gwConfig.Spec.AllowedNamespaces, namespace)
+}
+
+// TunnelsIPVersion returns whether pod traffic of the IP version is routed through the gateway
+func (gwConfig *StaticGatewayConfiguration) TunnelsIPVersion(version IPVersion) bool {
+	if version == IPv6 && !gwConfig.Spec.EnableIPv6 {
+		return false
+	}
+	return len(gwConfig.Spec.TunnelIPVersions) == 0 || slices.Contains(gwConfig.Spec.TunnelIPVersions, version)
+}
+
+// BypassesIPVersion returns whether pod traffic of the IP version is left out of tunnelIPVersions, so that it
+// keeps the node path of the pod
+func (gwConfig *StaticGatewayConfiguration) BypassesIPVersion(version IPVersion) bool {
+	return len(gwConfig.Spec.TunnelIPVersions) > 0 && !slices.Contains(gwConfig.Spec.TunnelIPVersions, version)
+}
+
 func init() {
 	SchemeBuilder.Register(&StaticGatewayConfiguration{}, &StaticGatewayConfigurationList{})
 }
@@ -10,13 +10,34 @@ Licensed under the MIT license.
 package v1alpha1
 
 import (
-	v1 "k8s.io/api/core/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExcludeCidrsConfigMapReference) DeepCopyInto(out *ExcludeCidrsConfigMapReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExcludeCidrsConfigMapReference.
+func (in *ExcludeCidrsConfigMapReference) DeepCopy() *ExcludeCidrsConfigMapReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ExcludeCidrsConfigMapReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GatewayConfiguration) DeepCopyInto(out *GatewayConfiguration) {
 	*out = *in
+	if in.PublicIps != nil {
+		in, out := &in.PublicIps, &out.PublicIps
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GatewayConfiguration.
@@ -34,11 +55,11 @@ func (in *GatewayLBConfiguration) DeepCopyInto(out *GatewayLBConfiguration) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	if in.Status != nil {
 		in, out := &in.Status, &out.Status
 		*out = new(GatewayLBConfigurationStatus)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 }
 
@@ -95,7 +116,14 @@ func (in *GatewayLBConfigurationList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GatewayLBConfigurationSpec) DeepCopyInto(out *GatewayLBConfigurationSpec) {
 	*out = *in
-	out.GatewayVmssProfile = in.GatewayVmssProfile
+	in.GatewayVmssProfile.DeepCopyInto(&out.GatewayVmssProfile)
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GatewayLBConfigurationSpec.
@@ -111,6 +139,16 @@ func (in *GatewayLBConfigurationSpec) DeepCopy() *GatewayLBConfigurationSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GatewayLBConfigurationStatus) DeepCopyInto(out *GatewayLBConfigurationStatus) {
 	*out = *in
+	if in.GatewayNodes != nil {
+		in, out := &in.GatewayNodes, &out.GatewayNodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.VnetAddressSpace != nil {
+		in, out := &in.VnetAddressSpace, &out.VnetAddressSpace
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GatewayLBConfigurationStatus.
@@ -128,7 +166,7 @@ func (in *GatewayServerProfile) DeepCopyInto(out *GatewayServerProfile) {
 	*out = *in
 	if in.PrivateKeySecretRef != nil {
 		in, out := &in.PrivateKeySecretRef, &out.PrivateKeySecretRef
-		*out = new(v1.ObjectReference)
+		*out = new(corev1.ObjectReference)
 		**out = **in
 	}
 }
@@ -208,7 +246,9 @@ func (in *GatewayStatusSpec) DeepCopyInto(out *GatewayStatusSpec) {
 	if in.ReadyGatewayConfigurations != nil {
 		in, out := &in.ReadyGatewayConfigurations, &out.ReadyGatewayConfigurations
 		*out = make([]GatewayConfiguration, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	if in.ReadyPeerConfigurations != nil {
 		in, out := &in.ReadyPeerConfigurations, &out.ReadyPeerConfigurations
@@ -247,7 +287,7 @@ func (in *GatewayVMConfiguration) DeepCopyInto(out *GatewayVMConfiguration) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	if in.Status != nil {
 		in, out := &in.Status, &out.Status
 		*out = new(GatewayVMConfigurationStatus)
@@ -308,7 +348,14 @@ func (in *GatewayVMConfigurationList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GatewayVMConfigurationSpec) DeepCopyInto(out *GatewayVMConfigurationSpec) {
 	*out = *in
-	out.GatewayVmssProfile = in.GatewayVmssProfile
+	in.GatewayVmssProfile.DeepCopyInto(&out.GatewayVmssProfile)
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GatewayVMConfigurationSpec.
@@ -324,10 +371,27 @@ func (in *GatewayVMConfigurationSpec) DeepCopy() *GatewayVMConfigurationSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GatewayVMConfigurationStatus) DeepCopyInto(out *GatewayVMConfigurationStatus) {
 	*out = *in
+	if in.EgressIpPrefixes != nil {
+		in, out := &in.EgressIpPrefixes, &out.EgressIpPrefixes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Vmsses != nil {
+		in, out := &in.Vmsses, &out.Vmsses
+		*out = make([]VmssReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.GatewayNodes != nil {
+		in, out := &in.GatewayNodes, &out.GatewayNodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.GatewayVMProfiles != nil {
 		in, out := &in.GatewayVMProfiles, &out.GatewayVMProfiles
 		*out = make([]GatewayVMProfile, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 }
 
@@ -344,6 +408,11 @@ func (in *GatewayVMConfigurationStatus) DeepCopy() *GatewayVMConfigurationStatus
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GatewayVMProfile) DeepCopyInto(out *GatewayVMProfile) {
 	*out = *in
+	if in.AdditionalSecondaryIPs != nil {
+		in, out := &in.AdditionalSecondaryIPs, &out.AdditionalSecondaryIPs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GatewayVMProfile.
@@ -359,6 +428,11 @@ func (in *GatewayVMProfile) DeepCopy() *GatewayVMProfile {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GatewayVmssProfile) DeepCopyInto(out *GatewayVmssProfile) {
 	*out = *in
+	if in.Vmsses != nil {
+		in, out := &in.Vmsses, &out.Vmsses
+		*out = make([]VmssReference, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GatewayVmssProfile.
@@ -386,13 +460,28 @@ func (in *PeerConfiguration) DeepCopy() *PeerConfiguration {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PeerFailure) DeepCopyInto(out *PeerFailure) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PeerFailure.
+func (in *PeerFailure) DeepCopy() *PeerFailure {
+	if in == nil {
+		return nil
+	}
+	out := new(PeerFailure)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodEndpoint) DeepCopyInto(out *PodEndpoint) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodEndpoint.
@@ -448,6 +537,21 @@ func (in *PodEndpointList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodEndpointSpec) DeepCopyInto(out *PodEndpointSpec) {
 	*out = *in
+	if in.GatewayCandidates != nil {
+		in, out := &in.GatewayCandidates, &out.GatewayCandidates
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExceptionCidrs != nil {
+		in, out := &in.ExceptionCidrs, &out.ExceptionCidrs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.IncludeCidrs != nil {
+		in, out := &in.IncludeCidrs, &out.IncludeCidrs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodEndpointSpec.
@@ -463,6 +567,20 @@ func (in *PodEndpointSpec) DeepCopy() *PodEndpointSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodEndpointStatus) DeepCopyInto(out *PodEndpointStatus) {
 	*out = *in
+	if in.PeerFailures != nil {
+		in, out := &in.PeerFailures, &out.PeerFailures
+		*out = make(map[string]PeerFailure, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodEndpointStatus.
@@ -537,12 +655,79 @@ func (in *StaticGatewayConfigurationList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StaticGatewayConfigurationSpec) DeepCopyInto(out *StaticGatewayConfigurationSpec) {
 	*out = *in
-	out.GatewayVmssProfile = in.GatewayVmssProfile
+	in.GatewayVmssProfile.DeepCopyInto(&out.GatewayVmssProfile)
 	if in.ExcludeCidrs != nil {
 		in, out := &in.ExcludeCidrs, &out.ExcludeCidrs
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.IncludeCidrs != nil {
+		in, out := &in.IncludeCidrs, &out.IncludeCidrs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExcludeCidrsConfigMap != nil {
+		in, out := &in.ExcludeCidrsConfigMap, &out.ExcludeCidrsConfigMap
+		*out = new(ExcludeCidrsConfigMapReference)
+		**out = **in
+	}
+	if in.ExcludeFQDNs != nil {
+		in, out := &in.ExcludeFQDNs, &out.ExcludeFQDNs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.TunnelIPVersions != nil {
+		in, out := &in.TunnelIPVersions, &out.TunnelIPVersions
+		*out = make([]IPVersion, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedDestinationPorts != nil {
+		in, out := &in.AllowedDestinationPorts, &out.AllowedDestinationPorts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DeniedDestinationPorts != nil {
+		in, out := &in.DeniedDestinationPorts, &out.DeniedDestinationPorts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PersistentKeepaliveSeconds != nil {
+		in, out := &in.PersistentKeepaliveSeconds, &out.PersistentKeepaliveSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.WireguardFwMark != nil {
+		in, out := &in.WireguardFwMark, &out.WireguardFwMark
+		*out = new(WireguardFwMark)
+		**out = **in
+	}
+	if in.PreserveSourceIpCidrs != nil {
+		in, out := &in.PreserveSourceIpCidrs, &out.PreserveSourceIpCidrs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PrivateCidrs != nil {
+		in, out := &in.PrivateCidrs, &out.PrivateCidrs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.TrafficMirror != nil {
+		in, out := &in.TrafficMirror, &out.TrafficMirror
+		*out = new(TrafficMirror)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StaticGatewayConfigurationSpec.
@@ -559,6 +744,46 @@ func (in *StaticGatewayConfigurationSpec) DeepCopy() *StaticGatewayConfiguration
 func (in *StaticGatewayConfigurationStatus) DeepCopyInto(out *StaticGatewayConfigurationStatus) {
 	*out = *in
 	in.GatewayServerProfile.DeepCopyInto(&out.GatewayServerProfile)
+	if in.ResolvedExcludeCidrs != nil {
+		in, out := &in.ResolvedExcludeCidrs, &out.ResolvedExcludeCidrs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ConfigMapExcludeCidrs != nil {
+		in, out := &in.ConfigMapExcludeCidrs, &out.ConfigMapExcludeCidrs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.GatewayNodes != nil {
+		in, out := &in.GatewayNodes, &out.GatewayNodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.VnetAddressSpace != nil {
+		in, out := &in.VnetAddressSpace, &out.VnetAddressSpace
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.GatewayEndpoints != nil {
+		in, out := &in.GatewayEndpoints, &out.GatewayEndpoints
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastPeerChangeTime != nil {
+		in, out := &in.LastPeerChangeTime, &out.LastPeerChangeTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastAzureSyncTime != nil {
+		in, out := &in.LastAzureSyncTime, &out.LastAzureSyncTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StaticGatewayConfigurationStatus.
@@ -570,3 +795,68 @@ func (in *StaticGatewayConfigurationStatus) DeepCopy() *StaticGatewayConfigurati
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrafficMirror) DeepCopyInto(out *TrafficMirror) {
+	*out = *in
+	if in.Vxlan != nil {
+		in, out := &in.Vxlan, &out.Vxlan
+		*out = new(TrafficMirrorVxlan)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrafficMirror.
+func (in *TrafficMirror) DeepCopy() *TrafficMirror {
+	if in == nil {
+		return nil
+	}
+	out := new(TrafficMirror)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrafficMirrorVxlan) DeepCopyInto(out *TrafficMirrorVxlan) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrafficMirrorVxlan.
+func (in *TrafficMirrorVxlan) DeepCopy() *TrafficMirrorVxlan {
+	if in == nil {
+		return nil
+	}
+	out := new(TrafficMirrorVxlan)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmssReference) DeepCopyInto(out *VmssReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmssReference.
+func (in *VmssReference) DeepCopy() *VmssReference {
+	if in == nil {
+		return nil
+	}
+	out := new(VmssReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WireguardFwMark) DeepCopyInto(out *WireguardFwMark) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WireguardFwMark.
+func (in *WireguardFwMark) DeepCopy() *WireguardFwMark {
+	if in == nil {
+		return nil
+	}
+	out := new(WireguardFwMark)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -51,8 +51,8 @@ func cmdAdd(args *skel.CmdArgs) error {
 	}
 	defer podNetNS.Close()
 
-	var v4Address, v6Address net.IPNet
-	var ipv4AddrFound, ipv6AddrFound bool
+	var v4Address, v6Address, v6GlobalAddress net.IPNet
+	var ipv4AddrFound, ipv6AddrFound, ipv6GlobalAddrFound bool
 	var extraRoutes []*types.Route
 	err = podNetNS.Do(func(netNS ns.NetNS) error {
 		eth0Link, err := netlink.LinkByName("eth0")
@@ -68,6 +68,10 @@ func cmdAdd(args *skel.CmdArgs) error {
 			if item.Scope == unix.RT_SCOPE_LINK {
 				v6Address = *item.IPNet
 				ipv6AddrFound = true
+			} else if item.Scope == unix.RT_SCOPE_UNIVERSE {
+				// dual-stack pod, global ipv6 address is used for ipv6 egress
+				v6GlobalAddress = *item.IPNet
+				ipv6GlobalAddrFound = true
 			}
 		}
 
@@ -98,8 +102,8 @@ func cmdAdd(args *skel.CmdArgs) error {
 		CNIVersion: type100.ImplementedSpecVersion,
 		IPs: []*type100.IPConfig{
 			{
+				// the gateway side of the tunnel is not addressed by ipam, the cni plugin routes pod traffic to it
 				Address: v6Address,
-				Gateway: net.ParseIP(consts.GatewayIP),
 			},
 			{
 				Address: v4Address,
@@ -107,6 +111,9 @@ func cmdAdd(args *skel.CmdArgs) error {
 		},
 		Routes: extraRoutes,
 	}
+	if ipv6GlobalAddrFound {
+		result.IPs = append(result.IPs, &type100.IPConfig{Address: v6GlobalAddress})
+	}
 	// outputCmdArgs(args)
 	return types.PrintResult(result, config.CNIVersion)
 }
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"time"
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
@@ -74,7 +75,8 @@ func cmdAdd(args *skel.CmdArgs) error {
 	defer conn.Close()
 	client := v1.NewNicServiceClient(conn)
 
-	// check if pod does not have gateway annotation, then skip the whole process
+	// check if pod does not have gateway annotation, then skip the whole process.
+	// cnimanager fills in the default gateway of pod namespace and drops empty gateway annotation of opted out pods
 	resp, err := client.PodRetrieve(context.Background(), &v1.PodRetrieveRequest{
 		PodConfig: &v1.PodInfo{
 			PodName:      string(k8sInfo.K8S_POD_NAME),
@@ -85,8 +87,10 @@ func cmdAdd(args *skel.CmdArgs) error {
 		return fmt.Errorf("failed to get pod (%s/%s) annotations: %w", string(k8sInfo.K8S_POD_NAME), string(k8sInfo.K8S_POD_NAMESPACE), err)
 	}
 	annotations := resp.GetAnnotations()
-	gwName, ok := annotations[consts.CNIGatewayAnnotationKey]
-	if !ok {
+	// gwName is left empty when pod selects gateway by labels, cnimanager resolves it from pod annotations
+	gwName, hasName := annotations[consts.CNIGatewayAnnotationKey]
+	_, hasSelector := annotations[consts.CNIGatewaySelectorAnnotationKey]
+	if !hasName && !hasSelector {
 		// pod does not use egress gateway, nothing else to do
 		return types.PrintResult(result, config.CNIVersion)
 	}
@@ -96,7 +100,7 @@ func cmdAdd(args *skel.CmdArgs) error {
 		return errors.New("ipam should not be empty")
 	}
 
-	err = wireguard.WithWireGuardNic(args.ContainerID, args.Netns, consts.WireguardLinkName, ipam.New(config.IPAM.Type, args.StdinData), config.ExcludedCIDRs, result, func(podNs ns.NetNS, allowedIPNet string) error {
+	err = wireguard.WithWireGuardNic(args.ContainerID, args.Netns, consts.WireguardLinkName, ipam.New(config.IPAM.Type, args.StdinData), config.ExcludedCIDRs, result, func(podNs ns.NetNS, allowedIPNet, allowedIPv6Net string) error {
 		//generate private key
 		privateKey, err := wgtypes.GeneratePrivateKey()
 		if err != nil {
@@ -127,7 +131,9 @@ func cmdAdd(args *skel.CmdArgs) error {
 			PublicKey:   privateKey.PublicKey().String(),
 			ListenPort:  int32(wgDevice.ListenPort),
 			AllowedIp:   allowedIPNet,
+			AllowedIpv6: allowedIPv6Net,
 			GatewayName: gwName,
+			NetnsPath:   args.Netns,
 		})
 		if err != nil {
 			return fmt.Errorf("failed to send nicAdd request: %w", err)
@@ -137,6 +143,16 @@ func cmdAdd(args *skel.CmdArgs) error {
 		if err != nil {
 			return fmt.Errorf("failed to parse gateway public key: %w", err)
 		}
+		gatewayIP, err := routes.ParseGatewayIP(resp.GetGatewayIp(), result)
+		if err != nil {
+			return err
+		}
+
+		var keepalive *time.Duration
+		if seconds := resp.GetPersistentKeepaliveSeconds(); seconds > 0 {
+			interval := time.Duration(seconds) * time.Second
+			keepalive = &interval
+		}
 
 		return podNs.Do(func(nn ns.NetNS) error {
 			wgclient, err := wgctrl.New()
@@ -148,7 +164,8 @@ func cmdAdd(args *skel.CmdArgs) error {
 				PrivateKey: &privateKey,
 				Peers: []wgtypes.PeerConfig{
 					{
-						PublicKey: gwPublicKey,
+						PublicKey:                   gwPublicKey,
+						PersistentKeepaliveInterval: keepalive,
 						Endpoint: &net.UDPAddr{
 							IP:   net.ParseIP(resp.EndpointIp),
 							Port: int(resp.ListenPort),
@@ -171,12 +188,27 @@ func cmdAdd(args *skel.CmdArgs) error {
 
 			}
 
+			if mtu := resp.GetMtu(); mtu > 0 {
+				wgLink, err := netlink.LinkByName(consts.WireguardLinkName)
+				if err != nil {
+					return fmt.Errorf("failed to get wg link: %w", err)
+				}
+				if err := netlink.LinkSetMTU(wgLink, int(mtu)); err != nil {
+					return fmt.Errorf("failed to set wg link mtu to %d: %w", mtu, err)
+				}
+			}
+
 			exceptionsCidrs := append(resp.GetExceptionCidrs(), config.ExcludedCIDRs...)
 			defaultToGateway := resp.GetDefaultRoute() == v1.DefaultRoute_DEFAULT_ROUTE_STATIC_EGRESS_GATEWAY
 			if os.Getenv("IS_UNIT_TEST_ENV") != "true" {
-				if err := routes.SetPodRoutes(consts.WireguardLinkName, exceptionsCidrs, defaultToGateway, "/proc/sys", result); err != nil {
+				if err := routes.SetPodRoutes(consts.WireguardLinkName, gatewayIP, exceptionsCidrs, resp.GetIncludeCidrs(), defaultToGateway, resp.GetEnableIpv6() && allowedIPv6Net != "", resp.GetIpv4ViaNode(), resp.GetIpv6ViaNode(), "/proc/sys", result); err != nil {
 					return fmt.Errorf("failed to setup pod routes: %w", err)
 				}
+				if dnsServer := resp.GetGatewayDns(); dnsServer != "" {
+					if err := routes.SetPodDNSRoute(consts.WireguardLinkName, gatewayIP, dnsServer, result); err != nil {
+						return fmt.Errorf("failed to setup pod dns route: %w", err)
+					}
+				}
 			}
 			return nil
 		})
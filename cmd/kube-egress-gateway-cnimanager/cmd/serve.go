@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/go-logr/zapr"
@@ -27,7 +29,9 @@ import (
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
@@ -40,6 +44,7 @@ import (
 	cniprotocol "github.com/Azure/kube-egress-gateway/pkg/cniprotocol/v1"
 	"github.com/Azure/kube-egress-gateway/pkg/consts"
 	"github.com/Azure/kube-egress-gateway/pkg/logger"
+	"github.com/Azure/kube-egress-gateway/pkg/tunnel"
 )
 
 // serveCmd represents the serve command
@@ -55,6 +60,17 @@ var (
 	exceptionCidrs            string
 	cniUninstallConfigMapName string
 	grpcPort                  int
+	preferSameZoneGateway     bool
+	preferLocalGateway        bool
+	peerPlacementStrategy     string
+	enableGatewayFailover     bool
+	gatewayFailoverInterval   time.Duration
+	syncPodRoutes             bool
+	syncPodFQDNRoutes         bool
+	podRouteSyncInterval      time.Duration
+	syncPodGatewayKeys        bool
+	podGatewayKeySyncInterval time.Duration
+	tunnelCidr                string
 )
 
 func init() {
@@ -73,6 +89,17 @@ func init() {
 	serveCmd.Flags().StringVar(&exceptionCidrs, "exception-cidrs", "", "Cidrs that should bypass egress gateway separated with ',', e.g. intra-cluster traffic")
 	serveCmd.Flags().StringVar(&confFileName, "cni-conf-file", "01-egressgateway.conflist", "Name of the new cni configuration file")
 	serveCmd.Flags().StringVar(&cniUninstallConfigMapName, "cni-uninstall-configmap-name", "cni-uninstall", "Name of the configmap that indicates whether to uninstall cni plugin or not, the configMap should be in the same namespace as the cniManager pod")
+	serveCmd.Flags().BoolVar(&preferSameZoneGateway, "prefer-same-zone-gateway", false, "Connect pods to a ready gateway node in the same availability zone instead of the gateway internal load balancer when possible")
+	serveCmd.Flags().BoolVar(&preferLocalGateway, "prefer-local-gateway", false, "Connect pods running on a gateway node to the gateway daemon on the same node instead of the gateway internal load balancer when the node serves their gateway")
+	serveCmd.Flags().StringVar(&peerPlacementStrategy, "peer-placement-strategy", "", "Connect pods to a ready gateway node picked by this strategy instead of the gateway internal load balancer, one of hash, round-robin or least-loaded")
+	serveCmd.Flags().BoolVar(&enableGatewayFailover, "enable-gateway-failover", false, "Re-home pods that list multiple gateways to the next healthy gateway when their gateway becomes unhealthy, requires access to pod network namespaces")
+	serveCmd.Flags().DurationVar(&gatewayFailoverInterval, "gateway-failover-check-interval", 15*time.Second, "How often gateway health is checked for failover")
+	serveCmd.Flags().BoolVar(&syncPodRoutes, "sync-pod-routes", false, "Apply excludeCidrs and includeCidrs changes of gateways to routes of running pods without resetting their tunnels, requires access to pod network namespaces")
+	serveCmd.Flags().BoolVar(&syncPodFQDNRoutes, "sync-pod-fqdn-routes", false, "Apply re-resolved excludeFqdns of gateways to routes of running pods without resetting their tunnels, implied by --sync-pod-routes, requires access to pod network namespaces")
+	serveCmd.Flags().DurationVar(&podRouteSyncInterval, "pod-route-sync-interval", 30*time.Second, "How often routes of running pods are synced with their gateways")
+	serveCmd.Flags().StringVar(&tunnelCidr, "tunnel-cidr", consts.DefaultTunnelCidr, "The IPv6 link local subnet addressing the gateway side of pod tunnels, pods route traffic to its first address. Must match the tunnel-cidr of gateway daemons.")
+	serveCmd.Flags().BoolVar(&syncPodGatewayKeys, "sync-pod-gateway-keys", false, "Move the gateway peer of running pods to the new key after the gateway wireguard key is rotated, requires access to pod network namespaces")
+	serveCmd.Flags().DurationVar(&podGatewayKeySyncInterval, "pod-gateway-key-sync-interval", 5*time.Second, "How often the gateway peer of running pods is synced with the gateway key")
 }
 
 func ServiceLauncher(cmd *cobra.Command, args []string) {
@@ -85,7 +112,13 @@ func ServiceLauncher(cmd *cobra.Command, args []string) {
 	logger.SetDefaultLogger(zapr.NewLogger(zapLog))
 	logger := logger.GetLogger()
 
-	k8sClient := startKubeClient(ctx, logger)
+	restConfig := config.GetConfigOrDie()
+	k8sClient, apiReader := startKubeClient(ctx, restConfig, logger)
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		logger.Error(err, "failed to create k8s clientset")
+		os.Exit(1)
+	}
 
 	cniConfMgr, err := cniconf.NewCNIConfManager(consts.CNIConfDir, confFileName, exceptionCidrs, cniUninstallConfigMapName, k8sClient, grpcPort)
 	if err != nil {
@@ -101,7 +134,20 @@ func ServiceLauncher(cmd *cobra.Command, args []string) {
 		return nil
 	})
 
-	nicSvc := cnimanager.NewNicService(k8sClient)
+	tunnelIPNet, err := tunnel.ParseCIDR(tunnelCidr)
+	if err != nil {
+		logger.Error(err, "invalid tunnel cidr")
+		os.Exit(1)
+	}
+	nicSvc := cnimanager.NewNicService(k8sClient).WithPreferSameZoneGateway(preferSameZoneGateway).WithPreferLocalGateway(preferLocalGateway).WithAPIReader(apiReader).WithTunnelCidr(tunnelIPNet)
+	if peerPlacementStrategy != "" {
+		strategy, err := cnimanager.NewPeerPlacementStrategy(peerPlacementStrategy)
+		if err != nil {
+			logger.Error(err, "invalid peer placement strategy")
+			os.Exit(1)
+		}
+		nicSvc.WithPeerPlacementStrategy(strategy)
+	}
 	server := grpc.NewServer(
 		grpc.StatsHandler(otelgrpc.NewServerHandler()),
 		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
@@ -118,9 +164,46 @@ func ServiceLauncher(cmd *cobra.Command, args []string) {
 		)),
 	)
 
+	// the overall status is used for liveness, readiness is reported by the health checker
 	healthServer := health.NewServer()
 	healthServer.SetServingStatus("", healthgrpc.HealthCheckResponse_SERVING)
 	healthgrpc.RegisterHealthServer(server, healthServer)
+	healthChecker := cnimanager.NewHealthChecker(healthServer, map[string]cnimanager.HealthCheck{
+		"apiserver": cnimanager.APIServerHealthCheck(clientset.Discovery().RESTClient()),
+		"wireguard": cnimanager.WireguardHealthCheck(),
+	})
+	g.Go(func() error {
+		return healthChecker.Start(ctx)
+	})
+
+	// jobs on running pods of this node share one ticker
+	podSyncLoop := cnimanager.NewPodSyncLoop()
+	// pods connected to a gateway node directly don't have the load balancer health probe to move them off a failed
+	// node, so they are checked even without gateway failover
+	if enableGatewayFailover || preferSameZoneGateway || preferLocalGateway || peerPlacementStrategy != "" {
+		failover := cnimanager.NewGatewayFailover(nicSvc, os.Getenv(consts.NodeNameEnvKey))
+		if !enableGatewayFailover {
+			failover = failover.WithEndpointsOnly()
+		}
+		podSyncLoop.Add(gatewayFailoverInterval, failover.Check)
+	}
+
+	if syncPodRoutes || syncPodFQDNRoutes {
+		routeSync := cnimanager.NewPodRouteSync(nicSvc, os.Getenv(consts.NodeNameEnvKey), strings.Split(exceptionCidrs, ","))
+		if !syncPodRoutes {
+			routeSync = routeSync.WithFQDNOnly()
+		}
+		podSyncLoop.Add(podRouteSyncInterval, routeSync.Sync)
+	}
+
+	if syncPodGatewayKeys {
+		podSyncLoop.Add(podGatewayKeySyncInterval, cnimanager.NewPodKeySync(nicSvc, os.Getenv(consts.NodeNameEnvKey)).Sync)
+	}
+	if !podSyncLoop.Empty() {
+		g.Go(func() error {
+			return podSyncLoop.Start(ctx)
+		})
+	}
 
 	cniprotocol.RegisterNicServiceServer(server, nicSvc)
 	var listener net.Listener
@@ -133,6 +216,8 @@ func ServiceLauncher(cmd *cobra.Command, args []string) {
 	g.Go(func() error {
 		<-ctx.Done()
 		logger.Error(ctx.Err(), "os signal received, shutting down")
+		// report not serving for all services so that probes fail while in-flight requests drain
+		healthServer.Shutdown()
 		server.GracefulStop()
 		return nil
 	})
@@ -148,11 +233,11 @@ func ServiceLauncher(cmd *cobra.Command, args []string) {
 	logger.Info("server shutdown")
 }
 
-func startKubeClient(ctx context.Context, logger logr.Logger) client.Client {
+func startKubeClient(ctx context.Context, restConfig *rest.Config, logger logr.Logger) (client.Client, client.Reader) {
 	apischeme := runtime.NewScheme()
 	utilruntime.Must(clientgoscheme.AddToScheme(apischeme))
 	utilruntime.Must(current.AddToScheme(apischeme))
-	k8sCluster, err := cluster.New(config.GetConfigOrDie(), func(options *cluster.Options) {
+	k8sCluster, err := cluster.New(restConfig, func(options *cluster.Options) {
 		options.Scheme = apischeme
 		options.Logger = logger
 		options.Cache = cache.Options{
@@ -171,6 +256,10 @@ func startKubeClient(ctx context.Context, logger logr.Logger) client.Client {
 		logger.Error(err, "failed to create k8s cluster object")
 		os.Exit(1)
 	}
+	if err := k8sCluster.GetFieldIndexer().IndexField(ctx, &current.PodEndpoint{}, cnimanager.PodEndpointGatewayIndex, cnimanager.PodEndpointGatewayIndexFunc); err != nil {
+		logger.Error(err, "failed to index PodEndpoints by gateway")
+		os.Exit(1)
+	}
 	go func() {
 		if err := k8sCluster.Start(ctx); err != nil {
 			logger.Error(err, "failed to start k8s client cache")
@@ -186,5 +275,5 @@ func startKubeClient(ctx context.Context, logger logr.Logger) client.Client {
 		// only get the configMap to trigger informer start, ignore the error
 		logger.Error(err, "failed to get cni uninstall configMap, error ignored", "configMap name", cniUninstallConfigMapName)
 	}
-	return k8sClient
+	return k8sClient, k8sCluster.GetAPIReader()
 }
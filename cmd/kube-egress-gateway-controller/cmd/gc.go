@@ -0,0 +1,97 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Azure/kube-egress-gateway/pkg/gc"
+)
+
+var (
+	gcDelete             bool
+	gcYes                bool
+	gcVMSSResourceGroups []string
+)
+
+// gcCmd reports, and optionally deletes, Azure resources left by gateways deleted without the controllers
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Find Azure resources of gateways that no longer exist",
+	Long: `List managed public ip prefixes in the resource group of the cloud config, gateway ipConfigs of VMSSes and
+their instances in the resource group of the cloud config, of existing gateways and of --vmss-resource-group, and
+load balancing rules and probes of the gateway load balancer, and report those whose GatewayVMConfiguration or
+GatewayLBConfiguration no longer exists, e.g. when gateway configurations were force-deleted by removing their
+finalizers while the controller manager was down. The same resources are listed in the gateway subscriptions of
+existing gateways, where managed prefixes and the gateway load balancer are in the resource group of the gateway
+VMSSes. With --delete, the orphans are deleted after confirmation, ipConfigs
+first so that the prefixes they use can be deleted. VMSSes and the load balancer are updated only if unchanged since
+read, a write conflicting with the running controller manager fails and can be retried. Prefixes still in use by
+other resources, or kept for reuse by a gateway recreated with the same name, are reported but never deleted.`,
+	Args: cobra.NoArgs,
+	Run:  runGC,
+}
+
+func init() {
+	gcCmd.Flags().BoolVar(&gcDelete, "delete", false, "Delete the orphaned resources found.")
+	gcCmd.Flags().BoolVar(&gcYes, "yes", false, "Do not ask for confirmation before deleting.")
+	gcCmd.Flags().StringSliceVar(&gcVMSSResourceGroups, "vmss-resource-group", nil, "More resource groups to scan for gateway VMSSes, e.g. of VMSSes only used by deleted gateways.")
+	rootCmd.AddCommand(gcCmd)
+}
+
+func runGC(cmd *cobra.Command, args []string) {
+	az, err := newAzureManager()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	restConfig, err := ctrl.GetConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	cl, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	collector := &gc.Collector{AzureManager: az, Client: cl, VMSSResourceGroups: gcVMSSResourceGroups}
+	report, err := collector.Find(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	report.Print(cmd.OutOrStdout())
+
+	deletable := report.Deletable()
+	if !gcDelete || len(deletable) == 0 {
+		return
+	}
+	if !gcYes && !confirm(cmd.InOrStdin(), cmd.OutOrStdout(), fmt.Sprintf("Delete %d orphaned resources?", len(deletable))) {
+		fmt.Fprintln(cmd.OutOrStdout(), "aborted, nothing deleted")
+		return
+	}
+	if err := collector.Delete(ctx, deletable); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "deleted %d orphaned resources\n", len(deletable))
+}
+
+// confirm asks the question on out and returns true only if "yes" is answered on in
+func confirm(in io.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%s Type 'yes' to confirm: ", question)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	return strings.TrimSpace(answer) == "yes"
+}
@@ -0,0 +1,79 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/preflight"
+)
+
+var (
+	preflightSubscriptionID    string
+	preflightVmssResourceGroup string
+	preflightVmssName          string
+	preflightVmsses            []string
+)
+
+// preflightCmd checks the prerequisites of a gateway vmss profile without running the controllers
+var preflightCmd = &cobra.Command{
+	Use:   "preflight",
+	Short: "Check that a gateway VMSS profile and the controller identity are ready for egress gateway",
+	Long: `Check that the gateway VMSSes exist, have a primary network interface with a primary ip configuration,
+that the subnet has free addresses, and that the controller identity can create public ip prefixes and modify
+the gateway load balancer and VMSSes. With --subscription-id, the VMSSes, public ip prefixes and the gateway load
+balancer are checked in that subscription. Prints a pass/fail report and exits non-zero if any check fails.`,
+	Args: cobra.NoArgs,
+	Run:  runPreflight,
+}
+
+func init() {
+	preflightCmd.Flags().StringVar(&preflightSubscriptionID, "subscription-id", "", "Subscription of the gateway VMSS, defaults to the subscription in cloud config.")
+	preflightCmd.Flags().StringVar(&preflightVmssResourceGroup, "vmss-resource-group", "", "Resource group of the gateway VMSS, defaults to the resource group in cloud config.")
+	preflightCmd.Flags().StringVar(&preflightVmssName, "vmss-name", "", "Name of the gateway VMSS.")
+	preflightCmd.Flags().StringSliceVar(&preflightVmsses, "vmsses", nil, "Gateway VMSSes in resourceGroup/name format separated with ',', instead of --vmss-resource-group and --vmss-name.")
+	rootCmd.AddCommand(preflightCmd)
+}
+
+func runPreflight(cmd *cobra.Command, args []string) {
+	profile, err := preflightProfile()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	az, err := newAzureManager()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	report := (&preflight.Checker{AzureManager: az}).Run(context.Background(), profile)
+	report.Print(cmd.OutOrStdout())
+	if !report.Passed() {
+		os.Exit(1)
+	}
+}
+
+func preflightProfile() (egressgatewayv1alpha1.GatewayVmssProfile, error) {
+	profile := egressgatewayv1alpha1.GatewayVmssProfile{
+		SubscriptionId:    preflightSubscriptionID,
+		VmssResourceGroup: preflightVmssResourceGroup,
+		VmssName:          preflightVmssName,
+	}
+	for _, vmss := range preflightVmsses {
+		rg, name, ok := strings.Cut(vmss, "/")
+		if !ok || rg == "" || name == "" {
+			return profile, fmt.Errorf("invalid vmss %q, expected resourceGroup/name", vmss)
+		}
+		profile.Vmsses = append(profile.Vmsses, egressgatewayv1alpha1.VmssReference{VmssResourceGroup: rg, VmssName: name})
+	}
+	if profile.VmssName == "" && len(profile.Vmsses) == 0 {
+		return profile, fmt.Errorf("--vmss-name or --vmsses must be provided")
+	}
+	return profile, nil
+}
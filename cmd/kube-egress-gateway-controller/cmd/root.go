@@ -5,11 +5,17 @@ package cmd
 import (
 	"context"
 	goflag "flag"
+	"fmt"
+	"net"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -17,19 +23,25 @@ import (
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/configloader"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
-
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
 	controllers "github.com/Azure/kube-egress-gateway/controllers/manager"
 	"github.com/Azure/kube-egress-gateway/pkg/azmanager"
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients/natgatewayclient"
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients/permissionclient"
 	"github.com/Azure/kube-egress-gateway/pkg/config"
 	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/logger"
 	"github.com/Azure/kube-egress-gateway/pkg/metrics"
+	"github.com/Azure/kube-egress-gateway/pkg/tunnel"
+	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -61,7 +73,23 @@ var (
 	enableLeaderElection    bool
 	leaderElectionNamespace string
 	secretNamespace         string
+	keyRotationInterval     time.Duration
+	azureResyncInterval     time.Duration
+	resyncPeriod            time.Duration
+	dryRun                  bool
 	probePort               int
+	enableWebhook           bool
+	webhookPort             int
+	webhookCertDir          string
+	podCidrs                string
+	tunnelCidr              string
+	defaultPrefixSize       int32
+	logFormat               string
+	maxConcurrentReconciles int
+	gracefulShutdownTimeout time.Duration
+	defaultTags             map[string]string
+	circuitBreakerThreshold int
+	circuitBreakerCooldown  time.Duration
 	zapOpts                 = zap.Options{
 		Development: true,
 	}
@@ -89,6 +117,22 @@ func init() {
 			"Enabling this will ensure there is only one active controller manager.")
 	rootCmd.Flags().StringVar(&leaderElectionNamespace, "leader-election-namespace", os.Getenv(consts.PodNamespaceEnvKey), "the namespace to create leader election objects")
 	rootCmd.Flags().StringVar(&secretNamespace, "secret-namespace", os.Getenv(consts.PodNamespaceEnvKey), "The namespace to store server privateKey secrets")
+	rootCmd.Flags().BoolVar(&enableWebhook, "enable-webhook", false, "Enable defaulting and validating admission webhooks for StaticGatewayConfiguration.")
+	rootCmd.Flags().IntVar(&webhookPort, "webhook-port", 9443, "The port the webhook server binds to.")
+	rootCmd.Flags().StringVar(&webhookCertDir, "webhook-cert-dir", "", "The directory containing tls.crt and tls.key of the webhook server, defaults to /tmp/k8s-webhook-server/serving-certs.")
+	rootCmd.Flags().StringVar(&podCidrs, "pod-cidrs", "", "Cluster pod CIDRs separated with ',', which the webhook rejects in excludeCidrs of StaticGatewayConfiguration, and which must not overlap tunnel-cidr.")
+	rootCmd.Flags().StringVar(&tunnelCidr, "tunnel-cidr", consts.DefaultTunnelCidr, "The IPv6 link local subnet addressing the gateway side of pod tunnels, gateways get a TunnelCidrConflict condition when pod-cidrs overlap it. Must match the tunnel-cidr of gateway daemons and cni managers.")
+	rootCmd.Flags().Int32Var(&defaultPrefixSize, "default-public-ip-prefix-size", 31, "The public ip prefix size the webhook sets on gateway vmss profiles without one, between 28 and 31.")
+	rootCmd.Flags().DurationVar(&keyRotationInterval, "wireguard-key-rotation-interval", 0, "The maximum age of gateway wireguard key pairs before they are rotated, 0 to disable scheduled rotation.")
+	rootCmd.Flags().DurationVar(&azureResyncInterval, "azure-resync-interval", 10*time.Minute, "How often gateway Azure resources are checked and corrected when modified out-of-band, 0 to disable periodic resync.")
+	rootCmd.Flags().DurationVar(&resyncPeriod, "resync-period", consts.DefaultResyncPeriod, "How often all watched objects are resynced, re-reconciling every gateway and its LoadBalancer configuration. Shorter periods correct drift sooner at the cost of more Azure requests in large clusters, gateway VMSS and public IP prefixes are checked at azure-resync-interval instead.")
+	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Log intended Azure resource writes with their diff instead of making them.")
+	rootCmd.Flags().StringVar(&logFormat, "log-format", logger.LogFormatText, "Log format, text or json.")
+	rootCmd.Flags().StringToStringVar(&defaultTags, "default-tags", nil, "Azure tags applied to all managed public IP prefixes, in key1=value1,key2=value2 format.")
+	rootCmd.Flags().IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1, "The maximum number of gateways each controller reconciles at the same time.")
+	rootCmd.Flags().DurationVar(&gracefulShutdownTimeout, "graceful-shutdown-timeout", 30*time.Second, "How long in-flight reconciles may run to complete their Azure operations after a termination signal, before they are cancelled and the leader election lease is released.")
+	rootCmd.Flags().IntVar(&circuitBreakerThreshold, "azure-circuit-breaker-threshold", 5, "The number of consecutive throttled, failed or unanswered calls of an Azure operation after which further calls of the operation are short-circuited, 0 to disable circuit breakers.")
+	rootCmd.Flags().DurationVar(&circuitBreakerCooldown, "azure-circuit-breaker-cooldown", time.Minute, "How long calls of an Azure operation are short-circuited before one call is let through to probe Azure.")
 
 	zapOpts.BindFlags(goflag.CommandLine)
 	rootCmd.Flags().AddGoFlagSet(goflag.CommandLine)
@@ -96,11 +140,9 @@ func init() {
 	utilruntime.Must(egressgatewayv1alpha1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 
-	logger := zap.New(zap.UseFlagOptions(&zapOpts))
-	ctrl.SetLogger(logger)
-
 	// Set up metrics
-	ctrlmetrics.Registry.MustRegister(metrics.ControllerReconcileFailCount, metrics.ControllerReconcileLatency)
+	ctrlmetrics.Registry.MustRegister(metrics.ControllerReconcileFailCount, metrics.ControllerReconcileLatency, metrics.ControllerReconcileErrorCount, metrics.AzureRequestThrottledCount,
+		metrics.AzureRequestCount, metrics.AzureRequestLatency, metrics.AzureCircuitBreakerTransitionCount, metrics.AzureCircuitBreakerState)
 }
 
 // initCloudConfig reads in cloud config file and ENV variables if set.
@@ -112,12 +154,75 @@ func startControllers(cmd *cobra.Command, args []string) {
 	var err error
 	var setupLog = ctrl.Log.WithName("setup")
 
+	if err := logger.SetLogFormat(&zapOpts, logFormat); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&zapOpts)))
+
+	if resyncPeriod < consts.MinResyncPeriod {
+		setupLog.Error(fmt.Errorf("resync-period must be at least %s", consts.MinResyncPeriod), "invalid flag")
+		os.Exit(1)
+	}
+
+	if gracefulShutdownTimeout < 0 {
+		setupLog.Error(fmt.Errorf("graceful-shutdown-timeout must not be negative"), "invalid flag")
+		os.Exit(1)
+	}
+
+	if circuitBreakerThreshold < 0 {
+		setupLog.Error(fmt.Errorf("azure-circuit-breaker-threshold must not be negative"), "invalid flag")
+		os.Exit(1)
+	}
+
+	if circuitBreakerThreshold > 0 && circuitBreakerCooldown <= 0 {
+		setupLog.Error(fmt.Errorf("azure-circuit-breaker-cooldown must be positive"), "invalid flag")
+		os.Exit(1)
+	}
+
+	var podIPNets []*net.IPNet
+	for _, cidr := range strings.Split(podCidrs, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			setupLog.Error(err, "invalid pod cidr", "cidr", cidr)
+			os.Exit(1)
+		}
+		podIPNets = append(podIPNets, ipNet)
+	}
+
+	tunnelIPNet, err := tunnel.ParseCIDR(tunnelCidr)
+	if err != nil {
+		setupLog.Error(err, "invalid flag")
+		os.Exit(1)
+	}
+	if overlapping := tunnel.OverlappingCIDRs(tunnelIPNet, podIPNets); len(overlapping) > 0 {
+		setupLog.Info("Pod cidrs overlap the tunnel cidr, pods assigned the gateway address fail to start, "+
+			"move the tunnel cidr of gateway daemons and cni managers", "podCidrs", overlapping, "tunnelCidr", tunnelIPNet)
+	}
+
 	options := ctrl.Options{
+		Cache: cache.Options{
+			SyncPeriod: &resyncPeriod,
+			// we only watch ConfigMaps referenced by excludeCidrsConfigMap, instead of all ConfigMaps in the cluster
+			ByObject: map[client.Object]cache.ByObject{
+				&corev1.ConfigMap{}: {
+					Label: labels.SelectorFromSet(labels.Set{consts.ExcludeCidrsConfigMapLabel: "true"}),
+				},
+			},
+		},
 		Scheme: scheme,
 		Metrics: metricsserver.Options{
 			BindAddress: ":" + strconv.Itoa(metricsPort),
 		},
-		HealthProbeBindAddress:  ":" + strconv.Itoa(probePort),
+		HealthProbeBindAddress: ":" + strconv.Itoa(probePort),
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Port:    webhookPort,
+			CertDir: webhookCertDir,
+		}),
 		LeaderElection:          enableLeaderElection,
 		LeaderElectionNamespace: leaderElectionNamespace,
 		LeaderElectionID:        "0a299682.microsoft.com",
@@ -132,6 +237,9 @@ func startControllers(cmd *cobra.Command, args []string) {
 		// if you are doing or is intended to do any operation such as perform cleanups
 		// after the manager stops then its usage might be unsafe.
 		LeaderElectionReleaseOnCancel: true,
+		// in-flight reconciles are cancelled after gracefulShutdownTimeout, give them a few seconds more to
+		// return before the lease is released
+		GracefulShutdownTimeout: to.Ptr(gracefulShutdownTimeout + 5*time.Second),
 		BaseContext: func() context.Context {
 			return ctrl.LoggerInto(context.Background(), ctrl.Log)
 		},
@@ -142,70 +250,78 @@ func startControllers(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	cloudConfig, err = configloader.Load[config.CloudConfig](context.Background(), nil, &configloader.FileLoaderConfig{FilePath: cloudConfigFile})
-	if err != nil {
-		setupLog.Error(err, "unable to parse config file")
-		os.Exit(1)
-	}
-	cloudConfig.TrimSpace()
-	if err := cloudConfig.Validate(); err != nil {
-		setupLog.Error(err, "cloud configuration is invalid")
-		os.Exit(1)
-	}
-	var authProvider *azclient.AuthProvider
-	authProvider, err = azclient.NewAuthProvider(
-		&cloudConfig.ARMClientConfig,
-		&cloudConfig.AzureAuthConfig)
-	if err != nil {
-		setupLog.Error(err, "unable to create auth provider")
-		os.Exit(1)
-	}
-	var cred azcore.TokenCredential
-	if cloudConfig.UseManagedIdentityExtension {
-		cred = authProvider.ManagedIdentityCredential
-	} else {
-		cred = authProvider.ClientSecretCredential
-	}
-	if cloudConfig.UserAgent == "" {
-		cloudConfig.UserAgent = consts.DefaultUserAgent
-	}
-	var factory azclient.ClientFactory
-	factory, err = azclient.NewClientFactory(&azclient.ClientFactoryConfig{SubscriptionID: cloudConfig.SubscriptionID}, &azclient.ARMClientConfig{Cloud: cloudConfig.Cloud, UserAgent: cloudConfig.UserAgent}, cred)
-	if err != nil {
-		setupLog.Error(err, "unable to create client factory")
-		os.Exit(1)
-	}
-	az, err := azmanager.CreateAzureManager(cloudConfig, factory)
+	az, err := newAzureManager()
 	if err != nil {
 		setupLog.Error(err, "unable to create azure manager")
 		os.Exit(1)
 	}
+	if dryRun {
+		setupLog.Info("Running in dry run mode, Azure resources will not be modified")
+		az.DryRun = true
+	}
+	az.CircuitBreakerThreshold = circuitBreakerThreshold
+	az.CircuitBreakerCooldown = circuitBreakerCooldown
 
 	if err = (&controllers.StaticGatewayConfigurationReconciler{
-		Client:          mgr.GetClient(),
-		SecretNamespace: secretNamespace,
-		Recorder:        mgr.GetEventRecorderFor("staticGatewayConfiguration-controller"),
+		Client:                       mgr.GetClient(),
+		SecretNamespace:              secretNamespace,
+		Recorder:                     mgr.GetEventRecorderFor("staticGatewayConfiguration-controller"),
+		WireguardKeyRotationInterval: keyRotationInterval,
+		DryRun:                       dryRun,
+		MaxConcurrentReconciles:      maxConcurrentReconciles,
+		GracefulShutdownTimeout:      gracefulShutdownTimeout,
+		TunnelCidr:                   tunnelIPNet,
+		PodCidrs:                     podIPNets,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "StaticGatewayConfiguration")
 		os.Exit(1)
 	}
 	if err = (&controllers.GatewayLBConfigurationReconciler{
-		Client:       mgr.GetClient(),
-		AzureManager: az,
-		Recorder:     mgr.GetEventRecorderFor("gatewayLBConfiguration-controller"),
-		LBProbePort:  gatewayLBProbePort,
+		Client:                  mgr.GetClient(),
+		AzureManager:            az,
+		Recorder:                mgr.GetEventRecorderFor("gatewayLBConfiguration-controller"),
+		LBProbePort:             gatewayLBProbePort,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		GracefulShutdownTimeout: gracefulShutdownTimeout,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "GatewayLBConfiguration")
 		os.Exit(1)
 	}
 	if err = (&controllers.GatewayVMConfigurationReconciler{
-		Client:       mgr.GetClient(),
-		AzureManager: az,
-		Recorder:     mgr.GetEventRecorderFor("gatewayVMConfiguration-controller"),
+		Client:                  mgr.GetClient(),
+		AzureManager:            az,
+		Recorder:                mgr.GetEventRecorderFor("gatewayVMConfiguration-controller"),
+		ResyncInterval:          azureResyncInterval,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		GracefulShutdownTimeout: gracefulShutdownTimeout,
+		DefaultTags:             defaultTags,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "GatewayVMConfiguration")
 		os.Exit(1)
 	}
+	if err = (&controllers.ExcludeFQDNReconciler{
+		Client: mgr.GetClient(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ExcludeFQDN")
+		os.Exit(1)
+	}
+	if enableWebhook {
+		if defaultPrefixSize < consts.MinPublicIpPrefixSize || defaultPrefixSize > consts.MaxPublicIpPrefixSize {
+			setupLog.Error(fmt.Errorf("should be between %d and %d", consts.MinPublicIpPrefixSize, consts.MaxPublicIpPrefixSize),
+				"invalid default public ip prefix size", "size", defaultPrefixSize)
+			os.Exit(1)
+		}
+		defaulter := &controllers.StaticGatewayConfigurationDefaulter{DefaultPublicIpPrefixSize: defaultPrefixSize}
+		if err = defaulter.SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "StaticGatewayConfiguration")
+			os.Exit(1)
+		}
+		validator := &controllers.StaticGatewayConfigurationValidator{AzureManager: az, Client: mgr.GetClient(), PodCidrs: podIPNets}
+		if err = validator.SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "StaticGatewayConfiguration")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -223,3 +339,60 @@ func startControllers(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 }
+
+// newAzureManager loads the cloud config file and creates the azure manager with its clients
+func newAzureManager() (*azmanager.AzureManager, error) {
+	var err error
+	cloudConfig, err = configloader.Load[config.CloudConfig](context.Background(), nil, &configloader.FileLoaderConfig{FilePath: cloudConfigFile})
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse config file: %w", err)
+	}
+	cloudConfig.TrimSpace()
+	cloudConfig.DefaultWorkloadIdentity()
+	if err := cloudConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("cloud configuration is invalid: %w", err)
+	}
+	cred, err := azmanager.NewTokenCredential(cloudConfig)
+	if err != nil {
+		return nil, err
+	}
+	if cloudConfig.UserAgent == "" {
+		cloudConfig.UserAgent = consts.DefaultUserAgent
+	}
+	armConfig := &azclient.ARMClientConfig{Cloud: cloudConfig.Cloud, UserAgent: cloudConfig.UserAgent}
+	newSubscriptionClients := func(subscriptionID string) (*azmanager.SubscriptionClients, error) {
+		factoryConfig := &azclient.ClientFactoryConfig{SubscriptionID: subscriptionID}
+		factory, err := azclient.NewClientFactory(factoryConfig, armConfig, cred, azmanager.WithRetryOptions(cloudConfig))
+		if err != nil {
+			return nil, fmt.Errorf("unable to create client factory: %w", err)
+		}
+		// azclient factory does not provide NAT gateway and permission clients, build them with the same options
+		clientOptions, err := azclient.GetDefaultResourceClientOption(armConfig, factoryConfig)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get client options: %w", err)
+		}
+		azmanager.WithRetryOptions(cloudConfig)(clientOptions)
+		natGatewayClient, err := natgatewayclient.New(subscriptionID, cred, clientOptions)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create nat gateway client: %w", err)
+		}
+		permissionClient, err := permissionclient.New(subscriptionID, cred, clientOptions)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create permission client: %w", err)
+		}
+		return &azmanager.SubscriptionClients{Factory: factory, NatGatewayClient: natGatewayClient, PermissionClient: permissionClient}, nil
+	}
+	clients, err := newSubscriptionClients(cloudConfig.SubscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	az, err := azmanager.CreateAzureManager(cloudConfig, clients.Factory)
+	if err != nil {
+		return nil, err
+	}
+	az.NatGatewayClient = clients.NatGatewayClient
+	az.PermissionClient = clients.PermissionClient
+	// gateways may be in other subscriptions the credential has access to
+	az.NewSubscriptionClients = newSubscriptionClients
+	return az, nil
+}
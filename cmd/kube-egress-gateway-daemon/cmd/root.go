@@ -5,6 +5,7 @@ package cmd
 import (
 	"context"
 	goflag "flag"
+	"fmt"
 	"os"
 	"strconv"
 	"time"
@@ -24,6 +25,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
@@ -31,6 +33,10 @@ import (
 	controllers "github.com/Azure/kube-egress-gateway/controllers/daemon"
 	"github.com/Azure/kube-egress-gateway/pkg/consts"
 	"github.com/Azure/kube-egress-gateway/pkg/healthprobe"
+	"github.com/Azure/kube-egress-gateway/pkg/logger"
+	"github.com/Azure/kube-egress-gateway/pkg/metrics"
+	"github.com/Azure/kube-egress-gateway/pkg/peerstate"
+	"github.com/Azure/kube-egress-gateway/pkg/tunnel"
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -51,13 +57,31 @@ func Execute() {
 }
 
 var (
-	scheme             = runtime.NewScheme()
-	setupLog           = ctrl.Log.WithName("setup")
-	metricsPort        int
-	probePort          int
-	gatewayLBProbePort int
-	secretNamespace    string
-	zapOpts            = zap.Options{
+	scheme                    = runtime.NewScheme()
+	setupLog                  = ctrl.Log.WithName("setup")
+	metricsPort               int
+	probePort                 int
+	gatewayLBProbePort        int
+	secretNamespace           string
+	drainTimeout              time.Duration
+	peerHandshakeTimeout      time.Duration
+	peerRetryBaseDelay        time.Duration
+	peerRetryMaxDelay         time.Duration
+	reapplyStalePeers         bool
+	enablePodMetrics          bool
+	enablePeerState           bool
+	hostInterface             string
+	flowLogFile               string
+	netnsPerGateway           bool
+	strictPeerAllowedIPs      bool
+	gracefulRestart           bool
+	resyncPeriod              time.Duration
+	wireguardWatchdogInterval time.Duration
+	conntrackMax              int
+	conntrackWarningPercent   int
+	tunnelCidr                string
+	logFormat                 string
+	zapOpts                   = zap.Options{
 		Development: true,
 	}
 )
@@ -79,6 +103,24 @@ func init() {
 	rootCmd.Flags().IntVar(&probePort, "health-probe-bind-port", 8081, "The port the probe endpoint binds to.")
 	rootCmd.Flags().IntVar(&gatewayLBProbePort, "gateway-lb-probe-port", 8082, "The port the gateway lb probe endpoint binds to.")
 	rootCmd.Flags().StringVar(&secretNamespace, "secret-namespace", os.Getenv(consts.PodNamespaceEnvKey), "The namespace to retrieve server privateKey secrets")
+	rootCmd.Flags().DurationVar(&drainTimeout, "drain-timeout", 60*time.Second, "The maximum time to wait for peers to be migrated to other gateway nodes on shutdown, 0 to exit immediately.")
+	rootCmd.Flags().DurationVar(&peerHandshakeTimeout, "peer-handshake-timeout", 0, "The maximum age of the latest wireguard handshake of a running pod before its tunnel is reported unhealthy, 0 to disable the check. Pods without traffic do not handshake, so set it well above the expected idle time.")
+	rootCmd.Flags().DurationVar(&peerRetryBaseDelay, "peer-retry-base-delay", time.Second, "The delay of retrying a pod wireguard peer failed to configure, doubled on each consecutive failure.")
+	rootCmd.Flags().DurationVar(&peerRetryMaxDelay, "peer-retry-max-delay", 5*time.Minute, "The maximum delay of retrying a pod wireguard peer failed to configure.")
+	rootCmd.Flags().BoolVar(&reapplyStalePeers, "reapply-stale-peers", false, "Re-create wireguard peers whose latest handshake exceeds peer-handshake-timeout.")
+	rootCmd.Flags().BoolVar(&enablePodMetrics, "enable-pod-metrics", false, "Report wireguard traffic statistics of each pod served by the gateway node, labeled with pod namespace and name.")
+	rootCmd.Flags().BoolVar(&enablePeerState, "enable-peer-state", false, "Serve wireguard peer state of gateways on this node on the metrics port for kubectl-egressgateway tunnels. The metrics port is not authenticated, so peer public keys, endpoints and pod IPs are readable by anyone reaching the node.")
+	rootCmd.Flags().StringVar(&hostInterface, "host-interface", "", "The host interface carrying the gateway ILB IP and default route. Detected from the mac address of the primary NIC by default, using the synthetic interface instead of the SR-IOV virtual function when accelerated networking is enabled.")
+	rootCmd.Flags().StringVar(&flowLogFile, "flow-log-file", "", "File that egress flow records of gateways with flowLogSampleRate set are appended to as JSON lines. Records are written to the daemon log when not set.")
+	rootCmd.Flags().BoolVar(&netnsPerGateway, "netns-per-gateway", false, "Configure each gateway in its own network namespace instead of sharing one network namespace across gateways, so that routes and SNAT rules of different gateways are isolated.")
+	rootCmd.Flags().BoolVar(&strictPeerAllowedIPs, "strict-peer-allowed-ips", false, "Limit wireguard allowed IPs of each pod peer to the pod's own address, and refuse to configure a pod IP already used by an older PodEndpoint of the gateway, so that a pod cannot send or receive tunnel traffic of other pods.")
+	rootCmd.Flags().BoolVar(&gracefulRestart, "graceful-restart", false, "Keep wireguard tunnels on this node across daemon restarts: skip draining on exit unless the node is cordoned or being deleted, and take over existing wireguard links and peers on start.")
+	rootCmd.Flags().DurationVar(&resyncPeriod, "resync-period", consts.DefaultResyncPeriod, "How often all watched objects are resynced, re-applying network namespaces, wireguard peers, routes and SNAT rules of every gateway and PodEndpoint on this node. Shorter periods correct drift sooner at the cost of more API server and netlink load on gateway nodes with many pods.")
+	rootCmd.Flags().DurationVar(&wireguardWatchdogInterval, "wireguard-watchdog-interval", 30*time.Second, "How often wireguard devices of gateways configured on this node are checked, a gateway whose device is missing, e.g. deleted by another agent, gets its device recreated and its peers re-applied. 0 disables the check.")
+	rootCmd.Flags().IntVar(&conntrackMax, "conntrack-max", 0, "The minimum nf_conntrack_max ensured on gateway nodes, raised again if another agent lowers it. It limits connection tracking entries of the host and of each gateway network namespace, new connections are dropped beyond it. 0 leaves it unchanged.")
+	rootCmd.Flags().IntVar(&conntrackWarningPercent, "conntrack-warning-percent", 80, "Usage of a connection tracking table, in percent of nf_conntrack_max, above which a warning is logged.")
+	rootCmd.Flags().StringVar(&tunnelCidr, "tunnel-cidr", consts.DefaultTunnelCidr, "The IPv6 link local subnet addressing the gateway side of pod tunnels, gateway wireguard interfaces get its first address and host veth links its second address. Must match the tunnel-cidr of cni managers.")
+	rootCmd.Flags().StringVar(&logFormat, "log-format", logger.LogFormatText, "Log format, text or json.")
 
 	zapOpts.BindFlags(goflag.CommandLine)
 	rootCmd.Flags().AddGoFlagSet(goflag.CommandLine)
@@ -93,11 +135,33 @@ func initCloudConfig() {
 }
 
 func startControllers(cmd *cobra.Command, args []string) {
-
+	if err := logger.SetLogFormat(&zapOpts, logFormat); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&zapOpts)))
 
+	if resyncPeriod < consts.MinResyncPeriod {
+		setupLog.Error(fmt.Errorf("resync-period must be at least %s", consts.MinResyncPeriod), "invalid flag")
+		os.Exit(1)
+	}
+	if conntrackMax < 0 {
+		setupLog.Error(fmt.Errorf("conntrack-max must not be negative"), "invalid flag")
+		os.Exit(1)
+	}
+	if conntrackWarningPercent < 1 || conntrackWarningPercent > 100 {
+		setupLog.Error(fmt.Errorf("conntrack-warning-percent must be between 1 and 100"), "invalid flag")
+		os.Exit(1)
+	}
+	tunnelIPNet, err := tunnel.ParseCIDR(tunnelCidr)
+	if err != nil {
+		setupLog.Error(err, "invalid flag")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Cache: cache.Options{
+			SyncPeriod: &resyncPeriod,
 			// we only watch secrets in the namespace where the kube-egress-gateway pods are running
 			ByObject: map[client.Object]cache.ByObject{
 				&corev1.Secret{}: {
@@ -105,6 +169,12 @@ func startControllers(cmd *cobra.Command, args []string) {
 				},
 			},
 		},
+		Client: client.Options{
+			Cache: &client.CacheOptions{
+				// pods are only read when updating readiness gate condition, avoid caching all pods on gateway nodes
+				DisableFor: []client.Object{&corev1.Pod{}},
+			},
+		},
 		Scheme: scheme,
 		Metrics: metricsserver.Options{
 			BindAddress: ":" + strconv.Itoa(metricsPort),
@@ -123,30 +193,137 @@ func startControllers(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	// Set up metrics, served by the manager metrics server
+	metricsCollector := controllers.NewGatewayMetricsCollector(mgr.GetClient(), enablePodMetrics)
+	metricsCollector.NetnsPerGateway = netnsPerGateway
+	ctrlmetrics.Registry.MustRegister(
+		metrics.ControllerReconcileFailCount,
+		metrics.ControllerReconcileLatency,
+		metricsCollector,
+		controllers.GatewayStalePeers,
+		controllers.GatewayPeerReapplyCount,
+		controllers.GatewayWireguardDeviceRecreateCount,
+		controllers.GatewayConntrackEntries,
+		controllers.GatewayConntrackMax,
+	)
+
+	// Serve wireguard peer state for debugging tools
+	if enablePeerState {
+		peersHandler := controllers.NewGatewayPeersHandler(mgr.GetClient())
+		peersHandler.NetnsPerGateway = netnsPerGateway
+		if err := mgr.AddMetricsServerExtraHandler(peerstate.Path, peersHandler); err != nil {
+			setupLog.Error(err, "unable to set up gateway peers handler")
+			os.Exit(1)
+		}
+	}
+
 	lbProbeServer := healthprobe.NewLBProbeServer(gatewayLBProbePort)
 	if err := mgr.Add(manager.RunnableFunc(lbProbeServer.Start)); err != nil {
 		setupLog.Error(err, "unbaled to set up gateway health probe server")
 		os.Exit(1)
 	}
 
-	gwCleanupEvents := make(chan event.GenericEvent)
-	if err = (&controllers.StaticGatewayConfigurationReconciler{
+	if peerHandshakeTimeout > 0 {
+		if peerHandshakeTimeout < controllers.MinPeerHandshakeTimeout {
+			setupLog.Error(fmt.Errorf("peer-handshake-timeout must be at least %s", controllers.MinPeerHandshakeTimeout), "invalid flag")
+			os.Exit(1)
+		}
+		peerHealthChecker := controllers.NewPeerHealthChecker(mgr.GetClient(), peerHandshakeTimeout, reapplyStalePeers)
+		peerHealthChecker.NetnsPerGateway = netnsPerGateway
+		peerHealthChecker.StrictPeerAllowedIPs = strictPeerAllowedIPs
+		if err := mgr.Add(manager.RunnableFunc(peerHealthChecker.Start)); err != nil {
+			setupLog.Error(err, "unable to set up wireguard peer health checker")
+			os.Exit(1)
+		}
+	}
+
+	flowLogger := controllers.NewFlowLogger(mgr.GetClient(), nil)
+	flowLogger.NetnsPerGateway = netnsPerGateway
+	if flowLogFile != "" {
+		f, err := os.OpenFile(flowLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			setupLog.Error(err, "unable to open flow log file", "file", flowLogFile)
+			os.Exit(1)
+		}
+		defer f.Close()
+		flowLogger.Writer = f
+	}
+	if err := mgr.Add(manager.RunnableFunc(flowLogger.Start)); err != nil {
+		setupLog.Error(err, "unable to set up gateway flow logger")
+		os.Exit(1)
+	}
+
+	drainer := &controllers.GatewayDrainer{
+		Client:          mgr.GetClient(),
+		LBProbeServer:   lbProbeServer,
+		Timeout:         drainTimeout,
+		GracefulRestart: gracefulRestart,
+	}
+	if err := mgr.Add(manager.RunnableFunc(drainer.Start)); err != nil {
+		setupLog.Error(err, "unable to set up gateway drainer")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.GatewayQuarantineReconciler{
 		Client:        mgr.GetClient(),
-		TickerEvents:  gwCleanupEvents,
 		LBProbeServer: lbProbeServer,
 	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "GatewayQuarantine")
+		os.Exit(1)
+	}
+
+	gwCleanupEvents := make(chan event.GenericEvent)
+	gwConfigReconciler := &controllers.StaticGatewayConfigurationReconciler{
+		Client:            mgr.GetClient(),
+		TickerEvents:      gwCleanupEvents,
+		LBProbeServer:     lbProbeServer,
+		HostInterfaceName: hostInterface,
+		NetnsPerGateway:   netnsPerGateway,
+		TunnelCidr:        tunnelIPNet,
+	}
+	if err = gwConfigReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "StaticGatewayConfiguration")
 		os.Exit(1)
 	}
+	if gracefulRestart {
+		if err := gwConfigReconciler.ReattachGateways(ctrl.LoggerInto(context.Background(), setupLog)); err != nil {
+			setupLog.Error(err, "unable to reattach existing wireguard links")
+			os.Exit(1)
+		}
+	}
 
 	peerCleanupEvents := make(chan event.GenericEvent)
-	if err = (&controllers.PodEndpointReconciler{
-		Client:       mgr.GetClient(),
-		TickerEvents: peerCleanupEvents,
-	}).SetupWithManager(mgr); err != nil {
+	podEndpointReconciler := &controllers.PodEndpointReconciler{
+		Client:               mgr.GetClient(),
+		TickerEvents:         peerCleanupEvents,
+		RetryBaseDelay:       peerRetryBaseDelay,
+		RetryMaxDelay:        peerRetryMaxDelay,
+		NetnsPerGateway:      netnsPerGateway,
+		StrictPeerAllowedIPs: strictPeerAllowedIPs,
+	}
+	if err = podEndpointReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "PodEndpoint")
 		os.Exit(1)
 	}
+	if err := mgr.Add(manager.RunnableFunc(podEndpointReconciler.Resync)); err != nil {
+		setupLog.Error(err, "unable to set up PodEndpoint resync")
+		os.Exit(1)
+	}
+	if wireguardWatchdogInterval > 0 {
+		watchdog := controllers.NewWireguardWatchdog(mgr.GetClient(), mgr.GetEventRecorderFor("kube-egress-gateway-daemon"),
+			wireguardWatchdogInterval, gwCleanupEvents, peerCleanupEvents)
+		watchdog.NetnsPerGateway = netnsPerGateway
+		if err := mgr.Add(manager.RunnableFunc(watchdog.Start)); err != nil {
+			setupLog.Error(err, "unable to set up wireguard watchdog")
+			os.Exit(1)
+		}
+	}
+	conntrackMonitor := controllers.NewConntrackMonitor(conntrackMax, conntrackWarningPercent)
+	conntrackMonitor.NetnsPerGateway = netnsPerGateway
+	if err := mgr.Add(manager.RunnableFunc(conntrackMonitor.Start)); err != nil {
+		setupLog.Error(err, "unable to set up conntrack monitor")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -159,7 +336,14 @@ func startControllers(cmd *cobra.Command, args []string) {
 	}
 
 	setupLog.Info("starting manager")
-	ctx := ctrl.SetupSignalHandler()
+	signalCtx := ctrl.SetupSignalHandler()
+	// keep manager running while draining, so that peers can be migrated before exiting
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-signalCtx.Done()
+		drainer.Drain(ctx)
+		cancel()
+	}()
 	startCleanupTicker(ctx, gwCleanupEvents, 1*time.Minute)   // clean up gwConfig network namespace every 1 min
 	startCleanupTicker(ctx, peerCleanupEvents, 1*time.Minute) // clean up wireguard peer configurations every 1 min
 	if err := mgr.Start(ctx); err != nil {
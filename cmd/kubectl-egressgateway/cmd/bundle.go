@@ -0,0 +1,217 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cmd
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+	corev1 "k8s.io/api/core/v1"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+)
+
+// gatewayBundleVersion is the version of the bundle format, bumped on incompatible changes
+const gatewayBundleVersion = 1
+
+// scrypt parameters deriving the key encrypting the wireguard private key from the passphrase
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	scryptSalt   = 16
+)
+
+// gatewayBundle is the snapshot of a static egress gateway written by export and applied by import
+type gatewayBundle struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exportedAt"`
+	Namespace  string    `json:"namespace"`
+	Name       string    `json:"name"`
+	// Spec of the StaticGatewayConfiguration
+	Spec egressgatewayv1alpha1.StaticGatewayConfigurationSpec `json:"spec"`
+	// Resource ID of the public IP prefix of the egress IPs, empty without public IPs
+	PublicIpPrefixId string `json:"publicIpPrefixId,omitempty"`
+	// Egress IP prefix allocated to the gateway
+	EgressIpPrefix string          `json:"egressIpPrefix,omitempty"`
+	Wireguard      bundleWireguard `json:"wireguard"`
+	// Pods peered with the gateway when exported, PodEndpoints are recreated by the CNI plugin when pods start
+	// so they are recorded for reference only
+	Peers []bundlePeer `json:"peers,omitempty"`
+}
+
+// bundleWireguard is the wireguard key pair of the gateway
+type bundleWireguard struct {
+	Port      int32  `json:"port,omitempty"`
+	PublicKey string `json:"publicKey,omitempty"`
+	// Secret holding the private key in the exporting cluster
+	PrivateKeySecretRef *corev1.ObjectReference `json:"privateKeySecretRef,omitempty"`
+	// Private key encrypted with a passphrase, only exported when a passphrase is given
+	EncryptedPrivateKey *encryptedData `json:"encryptedPrivateKey,omitempty"`
+}
+
+// bundlePeer is a pod peered with the gateway
+type bundlePeer struct {
+	Name           string `json:"name"`
+	PodIpAddress   string `json:"podIpAddress,omitempty"`
+	PodIpv6Address string `json:"podIpv6Address,omitempty"`
+	PodPublicKey   string `json:"podPublicKey,omitempty"`
+	GatewayNode    string `json:"gatewayNode,omitempty"`
+}
+
+// encryptedData is data encrypted with AES-256-GCM, keyed by scrypt from a passphrase
+type encryptedData struct {
+	Algorithm  string `json:"algorithm"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+const encryptionAlgorithm = "scrypt-aes256gcm"
+
+// newGatewayBundle builds the bundle of a gateway from its StaticGatewayConfiguration, GatewayVMConfiguration
+// and PodEndpoints, vmConfig may be nil if the gateway is not provisioned yet
+func newGatewayBundle(
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+	vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration,
+	podEndpoints []egressgatewayv1alpha1.PodEndpoint,
+	now time.Time,
+) *gatewayBundle {
+	bundle := &gatewayBundle{
+		Version:          gatewayBundleVersion,
+		ExportedAt:       now.UTC(),
+		Namespace:        gwConfig.Namespace,
+		Name:             gwConfig.Name,
+		Spec:             *gwConfig.Spec.DeepCopy(),
+		PublicIpPrefixId: gwConfig.Spec.PublicIpPrefixId,
+		EgressIpPrefix:   gwConfig.Status.EgressIpPrefix,
+		Wireguard: bundleWireguard{
+			Port:                gwConfig.Status.Port,
+			PublicKey:           gwConfig.Status.PublicKey,
+			PrivateKeySecretRef: gwConfig.Status.PrivateKeySecretRef.DeepCopy(),
+		},
+	}
+	if vmConfig != nil && vmConfig.Status != nil && vmConfig.Status.PublicIpPrefixId != "" {
+		bundle.PublicIpPrefixId = vmConfig.Status.PublicIpPrefixId
+	}
+	for _, podEndpoint := range podEndpoints {
+		if podEndpoint.Spec.StaticGatewayConfiguration != gwConfig.Name {
+			continue
+		}
+		bundle.Peers = append(bundle.Peers, bundlePeer{
+			Name:           podEndpoint.Name,
+			PodIpAddress:   podEndpoint.Spec.PodIpAddress,
+			PodIpv6Address: podEndpoint.Spec.PodIpv6Address,
+			PodPublicKey:   podEndpoint.Spec.PodPublicKey,
+			GatewayNode:    podEndpoint.Status.GatewayNode,
+		})
+	}
+	return bundle
+}
+
+// restoredSpec returns the StaticGatewayConfiguration spec to create from the bundle. A gateway with public IPs
+// references the exported public IP prefix, so that it keeps its egress IPs. The prefix is only read by the
+// controller afterwards, it is never deleted with the restored gateway. Warnings are returned for spec changed.
+func (b *gatewayBundle) restoredSpec() (egressgatewayv1alpha1.StaticGatewayConfigurationSpec, []string) {
+	spec := *b.Spec.DeepCopy()
+	var warnings []string
+	if !spec.ProvisionPublicIps || spec.PublicIpPrefixId != "" || b.PublicIpPrefixId == "" {
+		return spec, warnings
+	}
+	spec.PublicIpPrefixId = b.PublicIpPrefixId
+	if spec.PublicIpPrefixCount > 1 {
+		warnings = append(warnings, fmt.Sprintf("only the first of %d public ip prefixes is reused, publicIpPrefixCount is reset", spec.PublicIpPrefixCount))
+	}
+	spec.PublicIpPrefixCount = 0
+	spec.ReusePublicIpPrefix = false
+	return spec, warnings
+}
+
+func encryptData(plaintext, passphrase []byte) (*encryptedData, error) {
+	data := &encryptedData{Algorithm: encryptionAlgorithm, Salt: make([]byte, scryptSalt)}
+	if _, err := io.ReadFull(rand.Reader, data.Salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	aead, err := newAEAD(passphrase, data.Salt)
+	if err != nil {
+		return nil, err
+	}
+	data.Nonce = make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, data.Nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	data.Ciphertext = aead.Seal(nil, data.Nonce, plaintext, nil)
+	return data, nil
+}
+
+func decryptData(data *encryptedData, passphrase []byte) ([]byte, error) {
+	if data.Algorithm != encryptionAlgorithm {
+		return nil, fmt.Errorf("unsupported encryption algorithm %q", data.Algorithm)
+	}
+	aead, err := newAEAD(passphrase, data.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(data.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size %d", len(data.Nonce))
+	}
+	plaintext, err := aead.Open(nil, data.Nonce, data.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt, wrong passphrase or corrupted bundle: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newAEAD(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive encryption key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// readPassphrase reads the passphrase from file, trailing newlines are ignored
+func readPassphrase(file string) ([]byte, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase file: %w", err)
+	}
+	passphrase := strings.TrimRight(string(content), "\r\n")
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase file %s is empty", file)
+	}
+	return []byte(passphrase), nil
+}
+
+func readBundle(r io.Reader) (*gatewayBundle, error) {
+	bundle := &gatewayBundle{}
+	if err := json.NewDecoder(r).Decode(bundle); err != nil {
+		return nil, fmt.Errorf("failed to parse bundle: %w", err)
+	}
+	if bundle.Version != gatewayBundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d, expected %d", bundle.Version, gatewayBundleVersion)
+	}
+	if bundle.Name == "" {
+		return nil, fmt.Errorf("bundle has no gateway name")
+	}
+	return bundle, nil
+}
+
+func writeBundle(w io.Writer, bundle *gatewayBundle) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(bundle)
+}
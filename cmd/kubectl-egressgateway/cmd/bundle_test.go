@@ -0,0 +1,174 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+)
+
+const testPrefixID = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/egressgateway-uid"
+
+func getTestGateway(privateKey wgtypes.Key) []client.Object {
+	return []client.Object{
+		&egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "ns", UID: "uid"},
+			Spec: egressgatewayv1alpha1.StaticGatewayConfigurationSpec{
+				GatewayNodepoolName: "gwpool",
+				ProvisionPublicIps:  true,
+				PublicIpPrefixCount: 2,
+			},
+			Status: egressgatewayv1alpha1.StaticGatewayConfigurationStatus{
+				EgressIpPrefix: "1.2.3.4/31,1.2.3.6/31",
+				GatewayServerProfile: egressgatewayv1alpha1.GatewayServerProfile{
+					Port:      6000,
+					PublicKey: privateKey.PublicKey().String(),
+					PrivateKeySecretRef: &corev1.ObjectReference{
+						Kind:      "Secret",
+						Namespace: "kube-egress-gateway-system",
+						Name:      "sgw-uid",
+					},
+				},
+			},
+		},
+		&egressgatewayv1alpha1.GatewayVMConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "ns"},
+			Status:     &egressgatewayv1alpha1.GatewayVMConfigurationStatus{PublicIpPrefixId: testPrefixID},
+		},
+		&egressgatewayv1alpha1.PodEndpoint{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "ns"},
+			Spec: egressgatewayv1alpha1.PodEndpointSpec{
+				StaticGatewayConfiguration: "gw",
+				PodIpAddress:               "10.244.0.5/32",
+				PodPublicKey:               "pubkey1",
+			},
+			Status: egressgatewayv1alpha1.PodEndpointStatus{GatewayNode: "node1"},
+		},
+		&egressgatewayv1alpha1.PodEndpoint{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod2", Namespace: "ns"},
+			Spec:       egressgatewayv1alpha1.PodEndpointSpec{StaticGatewayConfiguration: "other"},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "sgw-uid", Namespace: "kube-egress-gateway-system"},
+			Data: map[string][]byte{
+				consts.WireguardPrivateKeyName: []byte(privateKey.String()),
+				consts.WireguardPublicKeyName:  []byte(privateKey.PublicKey().String()),
+			},
+		},
+	}
+}
+
+func TestEncryptData(t *testing.T) {
+	data, err := encryptData([]byte("secret"), []byte("passphrase"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data.Ciphertext), "secret")
+
+	plaintext, err := decryptData(data, []byte("passphrase"))
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(plaintext))
+
+	_, err = decryptData(data, []byte("wrong"))
+	assert.ErrorContains(t, err, "wrong passphrase")
+
+	data.Algorithm = "unknown"
+	_, err = decryptData(data, []byte("passphrase"))
+	assert.ErrorContains(t, err, "unsupported encryption algorithm")
+}
+
+func TestExportImportGateway(t *testing.T) {
+	privateKey, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+	srcClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(getTestGateway(privateKey)...).Build()
+
+	bundle, err := getGatewayBundle(context.TODO(), srcClient, types.NamespacedName{Namespace: "ns", Name: "gw"}, []byte("passphrase"))
+	require.NoError(t, err)
+	assert.Equal(t, testPrefixID, bundle.PublicIpPrefixId)
+	assert.Equal(t, "1.2.3.4/31,1.2.3.6/31", bundle.EgressIpPrefix)
+	assert.Equal(t, int32(6000), bundle.Wireguard.Port)
+	assert.Equal(t, "sgw-uid", bundle.Wireguard.PrivateKeySecretRef.Name)
+	assert.Equal(t, []bundlePeer{{Name: "pod1", PodIpAddress: "10.244.0.5/32", PodPublicKey: "pubkey1", GatewayNode: "node1"}}, bundle.Peers)
+	require.NotNil(t, bundle.Wireguard.EncryptedPrivateKey)
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, writeBundle(buf, bundle))
+	assert.NotContains(t, buf.String(), privateKey.String())
+	bundle, err = readBundle(buf)
+	require.NoError(t, err)
+
+	key, err := decryptData(bundle.Wireguard.EncryptedPrivateKey, []byte("passphrase"))
+	require.NoError(t, err)
+	dstClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	secretNamespace = "kube-egress-gateway-system"
+	warnings, err := restoreGateway(context.TODO(), dstClient, bundle, "restored", key)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"only the first of 2 public ip prefixes is reused, publicIpPrefixCount is reset"}, warnings)
+
+	gwConfig := &egressgatewayv1alpha1.StaticGatewayConfiguration{}
+	require.NoError(t, dstClient.Get(context.TODO(), types.NamespacedName{Namespace: "restored", Name: "gw"}, gwConfig))
+	assert.Equal(t, testPrefixID, gwConfig.Spec.PublicIpPrefixId)
+	assert.Equal(t, int32(0), gwConfig.Spec.PublicIpPrefixCount)
+	assert.Equal(t, "gwpool", gwConfig.Spec.GatewayNodepoolName)
+	assert.NotContains(t, gwConfig.Annotations, consts.SGCReconcilePausedAnnotation)
+
+	secrets := &corev1.SecretList{}
+	require.NoError(t, dstClient.List(context.TODO(), secrets, client.InNamespace("kube-egress-gateway-system")))
+	require.Len(t, secrets.Items, 1)
+	secret := secrets.Items[0]
+	assert.Equal(t, "sgw-"+string(gwConfig.UID), secret.Name)
+	assert.Equal(t, privateKey.String(), string(secret.Data[consts.WireguardPrivateKeyName]))
+	assert.Equal(t, privateKey.PublicKey().String(), string(secret.Data[consts.WireguardPublicKeyName]))
+	assert.Equal(t, "restored", secret.Labels[consts.OwningSGCNamespaceLabel])
+	assert.Equal(t, "gw", secret.Labels[consts.OwningSGCNameLabel])
+}
+
+func TestRestoreGatewayWithoutPrivateKey(t *testing.T) {
+	bundle := &gatewayBundle{
+		Version:    gatewayBundleVersion,
+		ExportedAt: time.Now(),
+		Name:       "gw",
+		Spec: egressgatewayv1alpha1.StaticGatewayConfigurationSpec{
+			ProvisionPublicIps:  true,
+			ReusePublicIpPrefix: true,
+		},
+		PublicIpPrefixId: testPrefixID,
+	}
+	dstClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	warnings, err := restoreGateway(context.TODO(), dstClient, bundle, "ns", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bundle has no wireguard private key, the restored gateway gets a new key pair"}, warnings)
+
+	gwConfig := &egressgatewayv1alpha1.StaticGatewayConfiguration{}
+	require.NoError(t, dstClient.Get(context.TODO(), types.NamespacedName{Namespace: "ns", Name: "gw"}, gwConfig))
+	assert.Equal(t, testPrefixID, gwConfig.Spec.PublicIpPrefixId)
+	assert.False(t, gwConfig.Spec.ReusePublicIpPrefix)
+	assert.Empty(t, gwConfig.Annotations)
+
+	// a gateway without public ips keeps its spec
+	bundle.Spec = egressgatewayv1alpha1.StaticGatewayConfigurationSpec{GatewayNodepoolName: "gwpool"}
+	spec, warnings := bundle.restoredSpec()
+	assert.Empty(t, warnings)
+	assert.Equal(t, bundle.Spec, spec)
+}
+
+func TestReadBundle(t *testing.T) {
+	_, err := readBundle(bytes.NewBufferString(`{"version":2,"name":"gw"}`))
+	assert.ErrorContains(t, err, "unsupported bundle version 2")
+	_, err = readBundle(bytes.NewBufferString(`{"version":1}`))
+	assert.ErrorContains(t, err, "no gateway name")
+	_, err = readBundle(bytes.NewBufferString(`not json`))
+	assert.ErrorContains(t, err, "failed to parse bundle")
+}
@@ -0,0 +1,142 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export <StaticGatewayConfiguration name>",
+	Short: "Export a static egress gateway as a JSON bundle",
+	Long: `Export the effective configuration of a static egress gateway as a JSON bundle for disaster recovery,
+including its spec, public IP prefix ID, egress IP prefix, wireguard public key and the pods peered with it.
+The wireguard private key is only referenced by its secret, unless --passphrase-file is given, in which case
+it is encrypted with the passphrase and included in the bundle. Reading the private key requires "get"
+permission on secrets in the kube-egress-gateway namespace.`,
+	Args: cobra.ExactArgs(1),
+	RunE: exportGateway,
+}
+
+var (
+	bundleFile     string
+	passphraseFile string
+)
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringVarP(&namespace, "namespace", "n", "default", "Namespace of the StaticGatewayConfiguration")
+	exportCmd.Flags().StringVarP(&bundleFile, "file", "f", "", "File to write the bundle to, defaults to stdout")
+	exportCmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "File containing the passphrase to encrypt the wireguard private key with, the key is not exported without it")
+	exportCmd.Flags().DurationVar(&requestTimeout, "timeout", 30*time.Second, "Timeout of the whole command")
+}
+
+func exportGateway(cmd *cobra.Command, args []string) error {
+	var passphrase []byte
+	if passphraseFile != "" {
+		var err error
+		if passphrase, err = readPassphrase(passphraseFile); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), requestTimeout)
+	defer cancel()
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	k8sClient, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	bundle, err := getGatewayBundle(ctx, k8sClient, types.NamespacedName{Namespace: namespace, Name: args[0]}, passphrase)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if bundleFile != "" {
+		// the bundle may carry the encrypted private key, keep it private to the user
+		f, err := os.OpenFile(bundleFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create bundle file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := writeBundle(w, bundle); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	if bundle.Wireguard.EncryptedPrivateKey == nil {
+		fmt.Fprintln(os.Stderr, "Warning: wireguard private key is not exported, the restored gateway gets a new key pair")
+	}
+	return nil
+}
+
+// getGatewayBundle reads the gateway and builds its bundle, the private key is encrypted with passphrase if not empty
+func getGatewayBundle(
+	ctx context.Context,
+	k8sClient client.Client,
+	gwConfigKey types.NamespacedName,
+	passphrase []byte,
+) (*gatewayBundle, error) {
+	gwConfig := &egressgatewayv1alpha1.StaticGatewayConfiguration{}
+	if err := k8sClient.Get(ctx, gwConfigKey, gwConfig); err != nil {
+		return nil, fmt.Errorf("failed to get StaticGatewayConfiguration %s: %w", gwConfigKey, err)
+	}
+	// GatewayVMConfiguration has the same namespace and name as its StaticGatewayConfiguration
+	vmConfig := &egressgatewayv1alpha1.GatewayVMConfiguration{}
+	if err := k8sClient.Get(ctx, gwConfigKey, vmConfig); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to get GatewayVMConfiguration %s: %w", gwConfigKey, err)
+		}
+		vmConfig = nil
+	}
+	podEndpoints := &egressgatewayv1alpha1.PodEndpointList{}
+	if err := k8sClient.List(ctx, podEndpoints, client.InNamespace(gwConfigKey.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list PodEndpoints: %w", err)
+	}
+
+	bundle := newGatewayBundle(gwConfig, vmConfig, podEndpoints.Items, time.Now())
+	if len(passphrase) == 0 {
+		return bundle, nil
+	}
+
+	secretRef := gwConfig.Status.PrivateKeySecretRef
+	if secretRef == nil {
+		return nil, fmt.Errorf("StaticGatewayConfiguration %s has no wireguard private key yet", gwConfigKey)
+	}
+	secret := &corev1.Secret{}
+	if err := k8sClient.Get(ctx, types.NamespacedName{Namespace: secretRef.Namespace, Name: secretRef.Name}, secret); err != nil {
+		return nil, fmt.Errorf("failed to get wireguard private key secret %s/%s: %w", secretRef.Namespace, secretRef.Name, err)
+	}
+	privateKey, ok := secret.Data[consts.WireguardPrivateKeyName]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s has no wireguard private key", secretRef.Namespace, secretRef.Name)
+	}
+	encryptedKey, err := encryptData(privateKey, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt wireguard private key: %w", err)
+	}
+	bundle.Wireguard.EncryptedPrivateKey = encryptedKey
+	return bundle, nil
+}
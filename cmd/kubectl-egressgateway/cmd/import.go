@@ -0,0 +1,177 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+)
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Restore a static egress gateway from a JSON bundle",
+	Long: `Restore a static egress gateway exported with "kubectl egressgateway export", e.g. in a fresh cluster.
+The StaticGatewayConfiguration is created with the exported spec, referencing the exported public IP prefix so
+that the gateway keeps its egress IPs. The prefix is only read afterwards and never deleted with the restored
+gateway. If the bundle has the encrypted wireguard private key, it is decrypted with --passphrase-file and
+restored before the gateway is reconciled, so that the gateway keeps its key pair. Pods peer with the restored
+gateway when they are started, the peers in the bundle are not restored.`,
+	Args: cobra.NoArgs,
+	RunE: importGateway,
+}
+
+var (
+	importNamespace string
+	secretNamespace string
+)
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	importCmd.Flags().StringVarP(&bundleFile, "file", "f", "", `Bundle file to restore, "-" to read from stdin`)
+	importCmd.Flags().StringVarP(&importNamespace, "namespace", "n", "", "Namespace to restore the StaticGatewayConfiguration in, defaults to the exported namespace")
+	importCmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "File containing the passphrase the wireguard private key was exported with")
+	importCmd.Flags().StringVar(&secretNamespace, "secret-namespace", "kube-egress-gateway-system", "Namespace the controller manager stores wireguard private key secrets in")
+	importCmd.Flags().DurationVar(&requestTimeout, "timeout", 30*time.Second, "Timeout of the whole command")
+	_ = importCmd.MarkFlagRequired("file")
+}
+
+func importGateway(cmd *cobra.Command, args []string) error {
+	var r io.Reader = os.Stdin
+	if bundleFile != "-" {
+		f, err := os.Open(bundleFile)
+		if err != nil {
+			return fmt.Errorf("failed to open bundle file: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	bundle, err := readBundle(r)
+	if err != nil {
+		return err
+	}
+
+	var privateKey []byte
+	if bundle.Wireguard.EncryptedPrivateKey != nil {
+		if passphraseFile == "" {
+			return fmt.Errorf("bundle has an encrypted wireguard private key, --passphrase-file is required")
+		}
+		passphrase, err := readPassphrase(passphraseFile)
+		if err != nil {
+			return err
+		}
+		if privateKey, err = decryptData(bundle.Wireguard.EncryptedPrivateKey, passphrase); err != nil {
+			return fmt.Errorf("failed to decrypt wireguard private key: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), requestTimeout)
+	defer cancel()
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	k8sClient, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	ns := importNamespace
+	if ns == "" {
+		ns = bundle.Namespace
+	}
+	warnings, err := restoreGateway(ctx, k8sClient, bundle, ns, privateKey)
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "StaticGatewayConfiguration %s/%s restored\n", ns, bundle.Name)
+	return nil
+}
+
+// restoreGateway creates the StaticGatewayConfiguration of the bundle in namespace. With privateKey, the gateway
+// is created with reconciliation paused until its wireguard key secret is created, so that the controller does
+// not generate a new key pair in between.
+func restoreGateway(
+	ctx context.Context,
+	k8sClient client.Client,
+	bundle *gatewayBundle,
+	namespace string,
+	privateKey []byte,
+) ([]string, error) {
+	spec, warnings := bundle.restoredSpec()
+	var key wgtypes.Key
+	if privateKey != nil {
+		var err error
+		if key, err = wgtypes.ParseKey(string(privateKey)); err != nil {
+			return warnings, fmt.Errorf("invalid wireguard private key in bundle: %w", err)
+		}
+		if bundle.Wireguard.PublicKey != "" && key.PublicKey().String() != bundle.Wireguard.PublicKey {
+			warnings = append(warnings, "wireguard private key does not match the exported public key")
+		}
+	} else {
+		warnings = append(warnings, "bundle has no wireguard private key, the restored gateway gets a new key pair")
+	}
+
+	gwConfig := &egressgatewayv1alpha1.StaticGatewayConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: bundle.Name, Namespace: namespace},
+		Spec:       spec,
+	}
+	if privateKey != nil {
+		gwConfig.Annotations = map[string]string{consts.SGCReconcilePausedAnnotation: "true"}
+	}
+	if err := k8sClient.Create(ctx, gwConfig); err != nil {
+		return warnings, fmt.Errorf("failed to create StaticGatewayConfiguration %s/%s: %w", namespace, bundle.Name, err)
+	}
+	if privateKey == nil {
+		return warnings, nil
+	}
+
+	// named and labeled like the secrets generated by the controller manager
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("sgw-%s", string(gwConfig.UID)),
+			Namespace: secretNamespace,
+			Labels: map[string]string{
+				consts.OwningSGCNamespaceLabel: gwConfig.Namespace,
+				consts.OwningSGCNameLabel:      gwConfig.Name,
+			},
+			Annotations: map[string]string{
+				consts.WireguardKeyGeneratedAtAnnotation: time.Now().UTC().Format(time.RFC3339),
+			},
+		},
+		Data: map[string][]byte{
+			consts.WireguardPrivateKeyName: []byte(key.String()),
+			consts.WireguardPublicKeyName:  []byte(key.PublicKey().String()),
+		},
+	}
+	if err := k8sClient.Create(ctx, secret); err != nil {
+		return warnings, fmt.Errorf("failed to create wireguard private key secret, StaticGatewayConfiguration %s/%s is left paused, "+
+			"delete it before importing again: %w", namespace, bundle.Name, err)
+	}
+
+	original := gwConfig.DeepCopy()
+	delete(gwConfig.Annotations, consts.SGCReconcilePausedAnnotation)
+	if err := k8sClient.Patch(ctx, gwConfig, client.MergeFrom(original)); err != nil {
+		return warnings, fmt.Errorf("failed to resume reconciliation of StaticGatewayConfiguration %s/%s, remove its %s annotation: %w",
+			namespace, bundle.Name, consts.SGCReconcilePausedAnnotation, err)
+	}
+	return warnings, nil
+}
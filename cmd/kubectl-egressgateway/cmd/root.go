@@ -0,0 +1,42 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cmd
+
+import (
+	goflag "flag"
+	"os"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+)
+
+var scheme = runtime.NewScheme()
+
+// rootCmd represents the base command when called without any subcommands
+var rootCmd = &cobra.Command{
+	Use:          "kubectl-egressgateway",
+	Short:        "kubectl plugin to inspect kube-egress-gateway",
+	Long:         `kubectl plugin to inspect static egress gateways, run as "kubectl egressgateway" when installed in PATH`,
+	SilenceUsage: true,
+}
+
+// Execute adds all child commands to the root command and sets flags appropriately.
+// This is called by main.main(). It only needs to happen once to the rootCmd.
+func Execute() {
+	err := rootCmd.Execute()
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(egressgatewayv1alpha1.AddToScheme(scheme))
+
+	// --kubeconfig flag registered by controller-runtime
+	rootCmd.PersistentFlags().AddGoFlagSet(goflag.CommandLine)
+}
@@ -0,0 +1,233 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/peerstate"
+)
+
+// tunnelsCmd represents the tunnels command
+var tunnelsCmd = &cobra.Command{
+	Use:   "tunnels <StaticGatewayConfiguration name>",
+	Short: "Show wireguard tunnels of a static egress gateway",
+	Long: `Show wireguard peers of a static egress gateway on each gateway node, including their latest handshake,
+allowed IPs and transfer counters. Peer state is retrieved from gateway daemons through the apiserver pod proxy,
+which requires "get" permission on "pods/proxy" in the kube-egress-gateway namespace.`,
+	Args: cobra.ExactArgs(1),
+	RunE: showTunnels,
+}
+
+var (
+	namespace         string
+	outputFormat      string
+	daemonSelector    string
+	daemonMetricsPort int
+	requestTimeout    time.Duration
+)
+
+// nodePeers is the wireguard peers of a static egress gateway on a gateway node
+type nodePeers struct {
+	Node  string           `json:"node"`
+	Peers []peerstate.Peer `json:"peers"`
+	Error string           `json:"error,omitempty"`
+}
+
+func init() {
+	rootCmd.AddCommand(tunnelsCmd)
+
+	tunnelsCmd.Flags().StringVarP(&namespace, "namespace", "n", "default", "Namespace of the StaticGatewayConfiguration")
+	tunnelsCmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "Output format, one of table or json")
+	tunnelsCmd.Flags().StringVar(&daemonSelector, "daemon-selector", "kube-egress-gateway-control-plane=daemon-manager", "Label selector of gateway daemon pods")
+	tunnelsCmd.Flags().IntVar(&daemonMetricsPort, "daemon-metrics-port", 8080, "Metrics port of gateway daemons, which serves the peer state")
+	tunnelsCmd.Flags().DurationVar(&requestTimeout, "timeout", 30*time.Second, "Timeout of the whole command")
+}
+
+func showTunnels(cmd *cobra.Command, args []string) error {
+	if outputFormat != "table" && outputFormat != "json" {
+		return fmt.Errorf("unsupported output format %q, should be one of table or json", outputFormat)
+	}
+	selector, err := labels.Parse(daemonSelector)
+	if err != nil {
+		return fmt.Errorf("invalid daemon selector %q: %w", daemonSelector, err)
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), requestTimeout)
+	defer cancel()
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	k8sClient, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes clientset: %w", err)
+	}
+
+	gwConfigKey := types.NamespacedName{Namespace: namespace, Name: args[0]}
+	gwConfig := &egressgatewayv1alpha1.StaticGatewayConfiguration{}
+	if err := k8sClient.Get(ctx, gwConfigKey, gwConfig); err != nil {
+		return fmt.Errorf("failed to get StaticGatewayConfiguration %s: %w", gwConfigKey, err)
+	}
+
+	// GatewayStatus of each gateway node is named after the node, in the namespace of gateway daemons
+	gwStatusList := &egressgatewayv1alpha1.GatewayStatusList{}
+	if err := k8sClient.List(ctx, gwStatusList); err != nil {
+		return fmt.Errorf("failed to list GatewayStatuses: %w", err)
+	}
+	var result []nodePeers
+	for _, gwStatus := range gwStatusList.Items {
+		if !hasGatewayConfiguration(&gwStatus, gwConfigKey.String()) {
+			continue
+		}
+		peers, err := getNodePeers(ctx, clientset, gwStatus.Namespace, gwStatus.Name, selector, gwConfigKey)
+		nodeResult := nodePeers{Node: gwStatus.Name, Peers: peers}
+		if err != nil {
+			nodeResult.Error = err.Error()
+		}
+		result = append(result, nodeResult)
+	}
+	if len(result) == 0 {
+		return fmt.Errorf("StaticGatewayConfiguration %s is not ready on any gateway node", gwConfigKey)
+	}
+
+	if outputFormat == "json" {
+		return printJSON(os.Stdout, result)
+	}
+	return printTable(os.Stdout, result, time.Now())
+}
+
+func hasGatewayConfiguration(gwStatus *egressgatewayv1alpha1.GatewayStatus, gateway string) bool {
+	for _, gwConf := range gwStatus.Spec.ReadyGatewayConfigurations {
+		if gwConf.StaticGatewayConfiguration == gateway {
+			return true
+		}
+	}
+	return false
+}
+
+// getNodePeers retrieves peer state from the gateway daemon running on the node
+func getNodePeers(
+	ctx context.Context,
+	clientset kubernetes.Interface,
+	daemonNamespace, nodeName string,
+	selector labels.Selector,
+	gwConfigKey types.NamespacedName,
+) ([]peerstate.Peer, error) {
+	pods, err := clientset.CoreV1().Pods(daemonNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector.String(),
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list gateway daemon pods: %w", err)
+	}
+	var daemonPod *corev1.Pod
+	for i := range pods.Items {
+		if pods.Items[i].Status.Phase == corev1.PodRunning {
+			daemonPod = &pods.Items[i]
+			break
+		}
+	}
+	if daemonPod == nil {
+		return nil, fmt.Errorf("no running gateway daemon pod on node %s", nodeName)
+	}
+
+	body, err := clientset.CoreV1().Pods(daemonNamespace).
+		ProxyGet("http", daemonPod.Name, strconv.Itoa(daemonMetricsPort), peerstate.Path, map[string]string{
+			"namespace": gwConfigKey.Namespace,
+			"name":      gwConfigKey.Name,
+		}).
+		DoRaw(ctx)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("peer state not found on gateway daemon pod %s, check that helm value gatewayDaemonManager.enablePeerState is set: %w", daemonPod.Name, err)
+		}
+		return nil, fmt.Errorf("failed to get peers from gateway daemon pod %s: %w", daemonPod.Name, err)
+	}
+	var peers []peerstate.Peer
+	if err := json.Unmarshal(body, &peers); err != nil {
+		return nil, fmt.Errorf("failed to parse peers from gateway daemon pod %s: %w", daemonPod.Name, err)
+	}
+	return peers, nil
+}
+
+func printJSON(w io.Writer, result []nodePeers) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
+
+func printTable(w io.Writer, result []nodePeers, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tPOD ENDPOINT\tPUBLIC KEY\tENDPOINT\tALLOWED IPS\tLATEST HANDSHAKE\tRECEIVED\tSENT")
+	for _, node := range result {
+		if node.Error != "" {
+			fmt.Fprintf(tw, "%s\t<error: %s>\t\t\t\t\t\t\n", node.Node, node.Error)
+			continue
+		}
+		for _, peer := range node.Peers {
+			handshake := "never"
+			if !peer.LastHandshakeTime.IsZero() {
+				handshake = duration.HumanDuration(now.Sub(peer.LastHandshakeTime)) + " ago"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				node.Node,
+				valueOrNone(peer.PodEndpoint),
+				peer.PublicKey,
+				valueOrNone(peer.Endpoint),
+				valueOrNone(strings.Join(peer.AllowedIPs, ",")),
+				handshake,
+				formatBytes(peer.ReceiveBytes),
+				formatBytes(peer.TransmitBytes),
+			)
+		}
+	}
+	return tw.Flush()
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
+
+// formatBytes formats byte count in binary units, e.g. 1.5 KiB
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,109 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cnimanager
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	current "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+)
+
+// PodEndpointGatewayIndex indexes PodEndpoints in the cache by <namespace>/<name> of the StaticGatewayConfiguration
+// they use
+const PodEndpointGatewayIndex = "spec.staticGatewayConfiguration"
+
+// PodEndpointGatewayIndexFunc returns the PodEndpointGatewayIndex values of a PodEndpoint
+func PodEndpointGatewayIndexFunc(o client.Object) []string {
+	podEndpoint, ok := o.(*current.PodEndpoint)
+	if !ok || podEndpoint.Spec.StaticGatewayConfiguration == "" {
+		return nil
+	}
+	return []string{podEndpoint.GetStaticGatewayConfigurationKey().String()}
+}
+
+// isGatewayFull returns whether other pods than podKey already take all maxPods slots of gwConfig. PodEndpoints
+// being deleted no longer take a slot, so that the slot is freed as soon as the pod leaves. PodEndpoints of the
+// gateway are selected by PodEndpointGatewayIndex when indexed, otherwise only namespaces allowed to use the gateway
+// are listed since the API server cannot select PodEndpoints by gateway.
+func isGatewayFull(ctx context.Context, reader client.Reader, indexed bool, gwConfig *current.StaticGatewayConfiguration, podKey client.ObjectKey) (bool, error) {
+	if gwConfig.Spec.MaxPods <= 0 {
+		return false, nil
+	}
+	gwConfigKey := client.ObjectKeyFromObject(gwConfig)
+	var podEndpoints []current.PodEndpoint
+	if indexed {
+		podEndpointList := &current.PodEndpointList{}
+		if err := reader.List(ctx, podEndpointList, client.MatchingFields{PodEndpointGatewayIndex: gwConfigKey.String()}); err != nil {
+			return false, fmt.Errorf("failed to list PodEndpoints: %w", err)
+		}
+		podEndpoints = podEndpointList.Items
+	} else {
+		namespaces := slices.Concat([]string{gwConfig.Namespace}, gwConfig.Spec.AllowedNamespaces)
+		slices.Sort(namespaces)
+		for _, namespace := range slices.Compact(namespaces) {
+			podEndpointList := &current.PodEndpointList{}
+			if err := reader.List(ctx, podEndpointList, client.InNamespace(namespace)); err != nil {
+				return false, fmt.Errorf("failed to list PodEndpoints in namespace %s: %w", namespace, err)
+			}
+			podEndpoints = append(podEndpoints, podEndpointList.Items...)
+		}
+	}
+	var pods int32
+	for _, podEndpoint := range podEndpoints {
+		if podEndpoint.GetStaticGatewayConfigurationKey() == gwConfigKey && client.ObjectKeyFromObject(&podEndpoint) != podKey &&
+			podEndpoint.DeletionTimestamp.IsZero() && gwConfig.AllowsNamespace(podEndpoint.Namespace) {
+			pods++
+		}
+	}
+	return pods >= gwConfig.Spec.MaxPods, nil
+}
+
+// isPodAdmitted returns whether the PodEndpoint of podKey already uses gwConfig, so that it keeps its slot when the
+// cni plugin is invoked again for the pod
+func (s *NicService) isPodAdmitted(ctx context.Context, gwConfig *current.StaticGatewayConfiguration, podKey client.ObjectKey) (bool, error) {
+	podEndpoint := &current.PodEndpoint{}
+	if err := s.k8sClient.Get(ctx, podKey, podEndpoint); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return podEndpoint.GetStaticGatewayConfigurationKey() == client.ObjectKeyFromObject(gwConfig), nil
+}
+
+// admitPod rejects a pod new to gwConfig when the gateway is full according to the cache
+func (s *NicService) admitPod(ctx context.Context, gwConfig *current.StaticGatewayConfiguration, podKey client.ObjectKey) error {
+	full, err := isGatewayFull(ctx, s.k8sClient, true, gwConfig, podKey)
+	if err != nil {
+		return status.Errorf(codes.Unknown, "failed to check capacity of gateway %s: %s", client.ObjectKeyFromObject(gwConfig), err)
+	}
+	if full {
+		return gatewayFullError(gwConfig)
+	}
+	return nil
+}
+
+// confirmPodAdmission counts PodEndpoints of gwConfig again from the API server after the PodEndpoint of podKey is
+// created, and releases the slot when pods admitted concurrently on other nodes exceed maxPods. Each racing pod
+// sees the PodEndpoints created before its own count, so at least the last one backs out and the gateway never
+// exceeds maxPods, while pods backing out unnecessarily are admitted when the cni plugin is retried.
+func (s *NicService) confirmPodAdmission(ctx context.Context, gwConfig *current.StaticGatewayConfiguration, podEndpoint *current.PodEndpoint) error {
+	full, err := isGatewayFull(ctx, s.apiReader, false, gwConfig, client.ObjectKeyFromObject(podEndpoint))
+	if err != nil {
+		return status.Errorf(codes.Unknown, "failed to check capacity of gateway %s: %s", client.ObjectKeyFromObject(gwConfig), err)
+	}
+	if !full {
+		return nil
+	}
+	if err := s.k8sClient.Delete(ctx, podEndpoint); client.IgnoreNotFound(err) != nil {
+		return status.Errorf(codes.Unknown, "failed to release PodEndpoint %s/%s of full gateway: %s", podEndpoint.Namespace, podEndpoint.Name, err)
+	}
+	return gatewayFullError(gwConfig)
+}
+
+func gatewayFullError(gwConfig *current.StaticGatewayConfiguration) error {
+	return status.Errorf(codes.ResourceExhausted, "gateway %s is full, it serves at most %d pods", client.ObjectKeyFromObject(gwConfig), gwConfig.Spec.MaxPods)
+}
@@ -0,0 +1,169 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cnimanager
+
+//+kubebuilder:rbac:groups=coordination.k8s.io,namespace=kube-egress-gateway-system,resources=leases,verbs=get;create;update
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	current "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+)
+
+// getPodEgressSourceIP parses the egress source IP pod annotation, the IP should be in the gateway egress prefix
+// and is reserved for the pod, so that no other pod using the gateway pins it
+func (s *NicService) getPodEgressSourceIP(ctx context.Context, pod *corev1.Pod, gwConfig *current.StaticGatewayConfiguration) (string, error) {
+	annotation, ok := pod.GetAnnotations()[consts.CNIEgressSourceIPAnnotationKey]
+	if !ok {
+		return "", nil
+	}
+	ip, ok := parseEgressSourceIP(pod)
+	if !ok {
+		return "", status.Errorf(codes.InvalidArgument, "%s on pod %s/%s should be an IPv4 address, got %q", consts.CNIEgressSourceIPAnnotationKey, pod.Namespace, pod.Name, annotation)
+	}
+	if gwConfig.Status.OutboundType == current.OutboundNatGateway || gwConfig.Status.OutboundType == current.OutboundPrivateIP {
+		return "", status.Errorf(codes.FailedPrecondition, "StaticGatewayConfiguration %s/%s with outbound type %s does not support %s", gwConfig.Namespace, gwConfig.Name, gwConfig.Status.OutboundType, consts.CNIEgressSourceIPAnnotationKey)
+	}
+	if gwConfig.Spec.PeerEndpointIp != "" {
+		// pods connect to the peer endpoint instead of the gateway node the IP is associated with
+		return "", status.Errorf(codes.FailedPrecondition, "StaticGatewayConfiguration %s/%s with peerEndpointIp does not support %s", gwConfig.Namespace, gwConfig.Name, consts.CNIEgressSourceIPAnnotationKey)
+	}
+	if !slices.ContainsFunc(strings.Split(gwConfig.Status.EgressIpPrefix, ","), func(cidr string) bool {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		return err == nil && prefix.Contains(ip)
+	}) {
+		return "", status.Errorf(codes.InvalidArgument, "egress source IP %s of pod %s/%s is not in egress prefix %q of StaticGatewayConfiguration %s/%s", ip, pod.Namespace, pod.Name, gwConfig.Status.EgressIpPrefix, gwConfig.Namespace, gwConfig.Name)
+	}
+	if err := s.claimEgressSourceIP(ctx, pod, gwConfig, ip.String()); err != nil {
+		return "", err
+	}
+	return ip.String(), nil
+}
+
+// parseEgressSourceIP returns the IPv4 address of the egress source IP pod annotation
+func parseEgressSourceIP(pod *corev1.Pod) (netip.Addr, bool) {
+	annotation, ok := pod.GetAnnotations()[consts.CNIEgressSourceIPAnnotationKey]
+	if !ok {
+		return netip.Addr{}, false
+	}
+	ip, err := netip.ParseAddr(annotation)
+	if err != nil || !ip.Is4() {
+		return netip.Addr{}, false
+	}
+	return ip, true
+}
+
+// claimEgressSourceIP reserves ip of gwConfig for pod with a Lease in the cni manager namespace named after both.
+// Creating the Lease fails when it exists, so that pods added concurrently on different nodes cannot pin the same IP,
+// and the Lease is only taken over with an update conflicting with concurrent ones once its holder no longer pins
+// the IP. Leases are kept after pods are deleted, a gateway has at most one per public IP. They are labeled with the
+// gateway UID, the controller manager deletes them with the gateway, and a Lease left by a deleted gateway of the
+// same name is taken over right away.
+func (s *NicService) claimEgressSourceIP(ctx context.Context, pod *corev1.Pod, gwConfig *current.StaticGatewayConfiguration, ip string) error {
+	gwConfigKey := client.ObjectKeyFromObject(gwConfig)
+	holder := client.ObjectKeyFromObject(pod).String()
+	lease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      getEgressSourceIPLeaseName(gwConfig, ip),
+			Namespace: os.Getenv(consts.PodNamespaceEnvKey),
+			Labels:    getEgressSourceIPLeaseLabels(gwConfig),
+		},
+		Spec: coordinationv1.LeaseSpec{HolderIdentity: &holder},
+	}
+	err := s.k8sClient.Create(ctx, lease)
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsAlreadyExists(err) {
+		return status.Errorf(codes.Unknown, "failed to reserve egress source IP %s of StaticGatewayConfiguration %s: %s", ip, gwConfigKey, err)
+	}
+
+	if err := s.apiReader.Get(ctx, client.ObjectKeyFromObject(lease), lease); err != nil {
+		return status.Errorf(codes.Unknown, "failed to retrieve reservation of egress source IP %s of StaticGatewayConfiguration %s: %s", ip, gwConfigKey, err)
+	}
+	ownerUID, labeled := lease.Labels[consts.OwningSGCUIDLabel]
+	stale := labeled && ownerUID != string(gwConfig.UID)
+	if !stale && labeled && lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity == holder {
+		return nil
+	}
+	if !stale && lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity != holder {
+		pinned, err := s.isEgressSourceIPPinned(ctx, *lease.Spec.HolderIdentity, gwConfigKey, ip)
+		if err != nil {
+			return status.Errorf(codes.Unknown, "failed to check holder of egress source IP %s of StaticGatewayConfiguration %s: %s", ip, gwConfigKey, err)
+		}
+		if pinned {
+			return status.Errorf(codes.AlreadyExists, "egress source IP %s of StaticGatewayConfiguration %s is already pinned to pod %s", ip, gwConfigKey, *lease.Spec.HolderIdentity)
+		}
+	}
+	lease.Labels = getEgressSourceIPLeaseLabels(gwConfig)
+	lease.Spec.HolderIdentity = &holder
+	if err := s.k8sClient.Update(ctx, lease); err != nil {
+		if apierrors.IsConflict(err) {
+			return status.Errorf(codes.Aborted, "egress source IP %s of StaticGatewayConfiguration %s was reserved concurrently", ip, gwConfigKey)
+		}
+		return status.Errorf(codes.Unknown, "failed to reserve egress source IP %s of StaticGatewayConfiguration %s: %s", ip, gwConfigKey, err)
+	}
+	return nil
+}
+
+// isEgressSourceIPPinned returns whether the pod named holder still pins ip of the gateway. A pod whose PodEndpoint
+// is not created yet is still being added and keeps the IP.
+func (s *NicService) isEgressSourceIPPinned(ctx context.Context, holder string, gwConfigKey client.ObjectKey, ip string) (bool, error) {
+	namespace, name, _ := strings.Cut(holder, "/")
+	podKey := client.ObjectKey{Namespace: namespace, Name: name}
+	pod := &corev1.Pod{}
+	if err := s.apiReader.Get(ctx, podKey, pod); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	if podIP, ok := parseEgressSourceIP(pod); !ok || podIP.String() != ip || !pod.DeletionTimestamp.IsZero() {
+		return false, nil
+	}
+	podEndpoint := &current.PodEndpoint{}
+	if err := s.apiReader.Get(ctx, podKey, podEndpoint); err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return podEndpoint.GetStaticGatewayConfigurationKey() == gwConfigKey && podEndpoint.Spec.EgressSourceIp == ip, nil
+}
+
+func getEgressSourceIPLeaseName(gwConfig *current.StaticGatewayConfiguration, ip string) string {
+	return fmt.Sprintf("egress-source-ip.%s.%s.%s", gwConfig.Namespace, gwConfig.Name, ip)
+}
+
+func getEgressSourceIPLeaseLabels(gwConfig *current.StaticGatewayConfiguration) map[string]string {
+	return map[string]string{
+		consts.OwningSGCNamespaceLabel: gwConfig.Namespace,
+		consts.OwningSGCNameLabel:      gwConfig.Name,
+		consts.OwningSGCUIDLabel:       string(gwConfig.UID),
+	}
+}
+
+// getEgressSourceIPEndpointIP returns the IP of a ready gateway node ip of gwConfig is associated with
+func (s *NicService) getEgressSourceIPEndpointIP(ctx context.Context, gwConfig *current.StaticGatewayConfiguration, ip string) (string, error) {
+	nodes, err := s.getReadyGatewayNodesWithPublicIP(ctx, gwConfig, ip)
+	if err != nil {
+		return "", err
+	}
+	for _, node := range nodes {
+		if nodeIP := getNodeInternalIP(node); nodeIP != "" {
+			return nodeIP, nil
+		}
+	}
+	return "", status.Errorf(codes.Unavailable, "no ready gateway node of StaticGatewayConfiguration %s/%s has egress source IP %s", gwConfig.Namespace, gwConfig.Name, ip)
+}
@@ -0,0 +1,231 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cnimanager
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	current "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/logger"
+	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/wgctrlwrapper"
+)
+
+// GatewayFailover periodically checks the gateways used by pods on this node that list more than one gateway, and
+// re-homes the pod tunnel to the next healthy gateway when the current one becomes unhealthy. With failback enabled,
+// pods also move back to a higher priority gateway once it recovers. Pods connected to a gateway node directly
+// instead of the gateway internal load balancer are moved to another endpoint when the node no longer serves it.
+type GatewayFailover struct {
+	nicService *NicService
+	nodeName   string
+	netns      netnswrapper.Interface
+	wgCtrl     wgctrlwrapper.Interface
+	// endpointsOnly limits the check to pods connected to a gateway node directly, keeping their gateway
+	endpointsOnly bool
+}
+
+func NewGatewayFailover(nicService *NicService, nodeName string) *GatewayFailover {
+	return &GatewayFailover{
+		nicService: nicService,
+		nodeName:   nodeName,
+		netns:      netnswrapper.NewNetNS(),
+		wgCtrl:     wgctrlwrapper.NewWgCtrl(),
+	}
+}
+
+// WithEndpointsOnly limits the check to pods connected to a gateway node directly, which are moved to another ready
+// node of their gateway or back to the gateway internal load balancer, so that they keep the failover of the load
+// balancer health probe without moving pods between gateways
+func (f *GatewayFailover) WithEndpointsOnly() *GatewayFailover {
+	f.endpointsOnly = true
+	return f
+}
+
+// WithNetNSAndWgCtrl overrides how pod network namespaces and wireguard devices are accessed
+func (f *GatewayFailover) WithNetNSAndWgCtrl(netns netnswrapper.Interface, wgCtrl wgctrlwrapper.Interface) *GatewayFailover {
+	f.netns = netns
+	f.wgCtrl = wgCtrl
+	return f
+}
+
+// Check re-homes pods on this node whose gateway should change, errors are logged and retried in the next check
+func (f *GatewayFailover) Check(ctx context.Context) {
+	f.nicService.forEachLocalPodEndpoint(ctx, f.nodeName, "fail over pod gateway", func(podEndpoint *current.PodEndpoint) bool {
+		if f.endpointsOnly {
+			return podEndpoint.Spec.GatewayEndpointIp == ""
+		}
+		return len(podEndpoint.Spec.GatewayCandidates) < 2 && podEndpoint.Spec.GatewayEndpointIp == ""
+	}, f.reconcilePodEndpoint)
+}
+
+func (f *GatewayFailover) reconcilePodEndpoint(ctx context.Context, local *localPodEndpoint) error {
+	if len(local.podEndpoint.Spec.GatewayCandidates) > 1 && !f.endpointsOnly {
+		switched, err := f.reconcileGatewayCandidates(ctx, local)
+		if err != nil || switched {
+			return err
+		}
+	}
+	if local.podEndpoint.Spec.GatewayEndpointIp == "" || local.gwConfig == nil {
+		return nil
+	}
+	return f.reconcileGatewayEndpoint(ctx, local.pod, local.podEndpoint, local.gwConfig)
+}
+
+// reconcileGatewayCandidates switches the pod to the first healthy gateway in its candidates when needed, and
+// reports whether it did
+func (f *GatewayFailover) reconcileGatewayCandidates(ctx context.Context, local *localPodEndpoint) (bool, error) {
+	pod, podEndpoint := local.pod, local.podEndpoint
+	currentKey := podEndpoint.GetStaticGatewayConfigurationKey()
+	if !podEndpoint.Spec.Failback && local.gwConfig != nil {
+		// a deleted gateway is unhealthy
+		healthy, err := f.nicService.isGatewayHealthy(ctx, local.gwConfig)
+		if err != nil || healthy {
+			return false, err
+		}
+	}
+
+	for _, candidate := range podEndpoint.Spec.GatewayCandidates {
+		gwConfig, err := f.nicService.getGatewayConfiguration(ctx, candidate, pod)
+		if err != nil {
+			continue
+		}
+		healthy, err := f.nicService.isGatewayHealthy(ctx, gwConfig)
+		if err != nil {
+			return false, err
+		}
+		if !healthy {
+			continue
+		}
+		if client.ObjectKeyFromObject(gwConfig) == currentKey {
+			return false, nil
+		}
+		full, err := isGatewayFull(ctx, f.nicService.k8sClient, true, gwConfig, client.ObjectKeyFromObject(podEndpoint))
+		if err != nil {
+			return false, err
+		}
+		if full {
+			continue
+		}
+		return true, f.switchGateway(ctx, pod, podEndpoint, gwConfig)
+	}
+	// no healthy gateway to move to, keep the current one until any recovers
+	return false, nil
+}
+
+// reconcileGatewayEndpoint points the pod tunnel to another endpoint of the same gateway when the gateway node it
+// connects to is no longer ready or serving the gateway. The new endpoint is picked the same way as for new pods,
+// falling back to the gateway internal load balancer when there is no other ready gateway node in the zone.
+func (f *GatewayFailover) reconcileGatewayEndpoint(ctx context.Context, pod *corev1.Pod, podEndpoint *current.PodEndpoint, gwConfig *current.StaticGatewayConfiguration) error {
+	nodes, err := f.nicService.getReadyGatewayNodes(ctx, gwConfig)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if getNodeInternalIP(node) == podEndpoint.Spec.GatewayEndpointIp {
+			return nil
+		}
+	}
+
+	endpointIP, err := f.nicService.getGatewayEndpointIP(ctx, pod, gwConfig)
+	if err != nil {
+		return err
+	}
+	if err := f.configurePodPeer(ctx, pod, podEndpoint.Spec.PodNetnsPath, gwConfig, endpointIP); err != nil {
+		return err
+	}
+	from := podEndpoint.Spec.GatewayEndpointIp
+	podEndpoint.Spec.GatewayEndpointIp = getGatewayNodeEndpointIP(gwConfig, endpointIP)
+	podEndpoint.Spec.GatewayPublicKey = gwConfig.Status.PublicKey
+	if err := f.nicService.k8sClient.Update(ctx, podEndpoint); err != nil {
+		return fmt.Errorf("failed to update PodEndpoint: %w", err)
+	}
+	logger.GetLogger().Info("pod tunnel moved to another gateway endpoint", "pod", client.ObjectKeyFromObject(pod), "from", from, "to", endpointIP)
+	return nil
+}
+
+// switchGateway points the pod tunnel to the new gateway first and then updates the PodEndpoint, so that a failed
+// PodEndpoint update is retried in the next check while the old gateway is still recorded as unhealthy
+func (f *GatewayFailover) switchGateway(ctx context.Context, pod *corev1.Pod, podEndpoint *current.PodEndpoint, gwConfig *current.StaticGatewayConfiguration) error {
+	egressSourceIP, err := f.nicService.getPodEgressSourceIP(ctx, pod, gwConfig)
+	if err != nil {
+		return err
+	}
+	endpointIP, err := f.nicService.getGatewayEndpointIP(ctx, pod, gwConfig)
+	if err != nil {
+		return err
+	}
+	if err := f.configurePodPeer(ctx, pod, podEndpoint.Spec.PodNetnsPath, gwConfig, endpointIP); err != nil {
+		return err
+	}
+
+	from := podEndpoint.Spec.StaticGatewayConfiguration
+	podEndpoint.Spec.StaticGatewayConfiguration = gatewayConfigurationRef(gwConfig, pod.Namespace)
+	podEndpoint.Spec.EgressSourceIp = egressSourceIP
+	podEndpoint.Spec.GatewayEndpointIp = getGatewayNodeEndpointIP(gwConfig, endpointIP)
+	podEndpoint.Spec.GatewayPublicKey = gwConfig.Status.PublicKey
+	if err := f.nicService.k8sClient.Update(ctx, podEndpoint); err != nil {
+		return fmt.Errorf("failed to update PodEndpoint: %w", err)
+	}
+	logger.GetLogger().Info("pod egress moved to another gateway", "pod", client.ObjectKeyFromObject(pod), "from", from, "to", podEndpoint.Spec.StaticGatewayConfiguration)
+	return nil
+}
+
+// configurePodPeer replaces the wireguard peer in the pod network namespace with the new gateway
+func (f *GatewayFailover) configurePodPeer(ctx context.Context, pod *corev1.Pod, netnsPath string, gwConfig *current.StaticGatewayConfiguration, endpointIP string) error {
+	gwPublicKey, err := wgtypes.ParseKey(gwConfig.Status.PublicKey)
+	if err != nil {
+		return fmt.Errorf("failed to parse gateway public key: %w", err)
+	}
+	seconds, err := f.nicService.getPersistentKeepaliveSeconds(ctx, pod, gwConfig)
+	if err != nil {
+		return err
+	}
+	var keepalive *time.Duration
+	if seconds > 0 {
+		interval := time.Duration(seconds) * time.Second
+		keepalive = &interval
+	}
+
+	podNs, err := f.netns.GetNSByPath(netnsPath)
+	if err != nil {
+		return fmt.Errorf("failed to get pod network namespace %s: %w", netnsPath, err)
+	}
+	defer podNs.Close()
+	return podNs.Do(func(nn ns.NetNS) error {
+		wgClient, err := f.wgCtrl.New()
+		if err != nil {
+			return fmt.Errorf("failed to create wg client: %w", err)
+		}
+		defer wgClient.Close()
+		err = wgClient.ConfigureDevice(consts.WireguardLinkName, wgtypes.Config{
+			ReplacePeers: true,
+			Peers: []wgtypes.PeerConfig{
+				{
+					PublicKey:                   gwPublicKey,
+					PersistentKeepaliveInterval: keepalive,
+					Endpoint: &net.UDPAddr{
+						IP:   net.ParseIP(endpointIP),
+						Port: int(gwConfig.Status.Port),
+					},
+					AllowedIPs: []net.IPNet{
+						{IP: net.IPv4zero, Mask: net.CIDRMask(0, 8*net.IPv4len)},
+						{IP: net.IPv6zero, Mask: net.CIDRMask(0, 8*net.IPv6len)},
+					},
+				},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to configure wg device: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,227 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cnimanager_test
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	current "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/controllers/cnimanager"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper/mocknetnswrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/wgctrlwrapper/mockwgctrlwrapper"
+)
+
+var _ = Describe("GatewayFailover", func() {
+	const netnsPath = "/var/run/netns/cni-1234"
+	var (
+		fakeClient  client.Client
+		failover    *cnimanager.GatewayFailover
+		mnetns      *mocknetnswrapper.MockInterface
+		mwg         *mockwgctrlwrapper.MockInterface
+		mclient     *mockwgctrlwrapper.MockClient
+		podEndpoint *current.PodEndpoint
+		gwKeys      map[string]wgtypes.Key
+	)
+
+	newGateway := func(name string) *current.StaticGatewayConfiguration {
+		privateKey, err := wgtypes.GeneratePrivateKey()
+		Expect(err).NotTo(HaveOccurred())
+		gwKeys[name] = privateKey.PublicKey()
+		return &current.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Status: current.StaticGatewayConfigurationStatus{
+				GatewayServerProfile: current.GatewayServerProfile{
+					Ip:        "10.1.0.100",
+					PublicKey: privateKey.PublicKey().String(),
+					Port:      6000,
+				},
+			},
+		}
+	}
+	newNode := func(name string, ready bool) *corev1.Node {
+		readyStatus := corev1.ConditionTrue
+		if !ready {
+			readyStatus = corev1.ConditionFalse
+		}
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: readyStatus}}},
+		}
+	}
+	newGatewayStatus := func(node, gwConfig string) *current.GatewayStatus {
+		return &current.GatewayStatus{
+			ObjectMeta: metav1.ObjectMeta{Name: node, Namespace: "kube-egress-gateway-system"},
+			Spec: current.GatewayStatusSpec{
+				ReadyGatewayConfigurations: []current.GatewayConfiguration{{StaticGatewayConfiguration: gwConfig}},
+			},
+		}
+	}
+	setNodeReady := func(name string, ready bool) {
+		node := &corev1.Node{}
+		Expect(fakeClient.Get(context.Background(), client.ObjectKey{Name: name}, node)).To(Succeed())
+		node.Status = newNode(name, ready).Status
+		Expect(fakeClient.Status().Update(context.Background(), node)).To(Succeed())
+	}
+	getPodEndpoint := func() *current.PodEndpoint {
+		got := &current.PodEndpoint{}
+		Expect(fakeClient.Get(context.Background(), client.ObjectKeyFromObject(podEndpoint), got)).To(Succeed())
+		return got
+	}
+
+	BeforeEach(func() {
+		gwKeys = make(map[string]wgtypes.Key)
+		apischeme := runtime.NewScheme()
+		utilruntime.Must(clientgoscheme.AddToScheme(apischeme))
+		utilruntime.Must(current.AddToScheme(apischeme))
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+			Spec:       corev1.PodSpec{NodeName: "node1"},
+		}
+		podEndpoint = &current.PodEndpoint{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+			Spec: current.PodEndpointSpec{
+				StaticGatewayConfiguration: "tgw1",
+				PodIpAddress:               "10.244.0.10/32",
+				GatewayCandidates:          []string{"tgw1", "tgw2"},
+				PodNetnsPath:               netnsPath,
+			},
+		}
+		fakeClient = fake.NewClientBuilder().WithScheme(apischeme).WithRuntimeObjects(
+			pod, podEndpoint, newGateway("tgw1"), newGateway("tgw2"),
+			newNode("node1", true), newNode("gw1", true), newNode("gw2", true),
+			newGatewayStatus("gw1", "default/tgw1"), newGatewayStatus("gw2", "default/tgw2"),
+		).WithIndex(&current.PodEndpoint{}, cnimanager.PodEndpointGatewayIndex, cnimanager.PodEndpointGatewayIndexFunc).Build()
+
+		mctrl := gomock.NewController(GinkgoT())
+		mnetns = mocknetnswrapper.NewMockInterface(mctrl)
+		mwg = mockwgctrlwrapper.NewMockInterface(mctrl)
+		mclient = mockwgctrlwrapper.NewMockClient(mctrl)
+		failover = cnimanager.NewGatewayFailover(cnimanager.NewNicService(fakeClient), "node1").WithNetNSAndWgCtrl(mnetns, mwg)
+	})
+
+	expectPeerConfigured := func(gwName string, configureErr error) {
+		mnetns.EXPECT().GetNSByPath(netnsPath).Return(&mocknetnswrapper.MockNetNS{Name: netnsPath}, nil)
+		mwg.EXPECT().New().Return(mclient, nil)
+		mclient.EXPECT().Close()
+		mclient.EXPECT().ConfigureDevice(consts.WireguardLinkName, gomock.Any()).DoAndReturn(func(_ string, cfg wgtypes.Config) error {
+			Expect(cfg.ReplacePeers).To(BeTrue())
+			Expect(cfg.Peers).To(HaveLen(1))
+			Expect(cfg.Peers[0].PublicKey).To(Equal(gwKeys[gwName]))
+			Expect(cfg.Peers[0].Endpoint.String()).To(Equal("10.1.0.100:6000"))
+			Expect(cfg.Peers[0].AllowedIPs).To(HaveLen(2))
+			Expect(cfg.Peers[0].PersistentKeepaliveInterval).To(BeNil())
+			return configureErr
+		})
+	}
+
+	It("should keep pods on the healthy gateway", func() {
+		failover.Check(context.Background())
+		Expect(getPodEndpoint().Spec.StaticGatewayConfiguration).To(Equal("tgw1"))
+	})
+
+	It("should move pods to the next healthy gateway when the current one fails", func() {
+		setNodeReady("gw1", false)
+		expectPeerConfigured("tgw2", nil)
+		failover.Check(context.Background())
+		Expect(getPodEndpoint().Spec.StaticGatewayConfiguration).To(Equal("tgw2"))
+	})
+
+	It("should move pods away from a deleted gateway", func() {
+		Expect(fakeClient.Delete(context.Background(), &current.StaticGatewayConfiguration{ObjectMeta: metav1.ObjectMeta{Name: "tgw1", Namespace: "default"}})).To(Succeed())
+		expectPeerConfigured("tgw2", nil)
+		failover.Check(context.Background())
+		Expect(getPodEndpoint().Spec.StaticGatewayConfiguration).To(Equal("tgw2"))
+	})
+
+	It("should keep pods on the current gateway when no gateway is healthy", func() {
+		setNodeReady("gw1", false)
+		setNodeReady("gw2", false)
+		failover.Check(context.Background())
+		Expect(getPodEndpoint().Spec.StaticGatewayConfiguration).To(Equal("tgw1"))
+	})
+
+	It("should not update PodEndpoint when pod peer cannot be configured", func() {
+		setNodeReady("gw1", false)
+		expectPeerConfigured("tgw2", errors.New("failed"))
+		failover.Check(context.Background())
+		Expect(getPodEndpoint().Spec.StaticGatewayConfiguration).To(Equal("tgw1"))
+	})
+
+	It("should ignore pods on other nodes", func() {
+		setNodeReady("gw1", false)
+		failover = cnimanager.NewGatewayFailover(cnimanager.NewNicService(fakeClient), "node2").WithNetNSAndWgCtrl(mnetns, mwg)
+		failover.Check(context.Background())
+		Expect(getPodEndpoint().Spec.StaticGatewayConfiguration).To(Equal("tgw1"))
+	})
+
+	It("should move pods to the gateway ILB when the gateway node they connect to no longer serves the gateway", func() {
+		podEndpoint.Spec.GatewayEndpointIp = "10.1.0.4"
+		Expect(fakeClient.Update(context.Background(), podEndpoint)).To(Succeed())
+		expectPeerConfigured("tgw1", nil)
+		failover.Check(context.Background())
+		Expect(getPodEndpoint().Spec.StaticGatewayConfiguration).To(Equal("tgw1"))
+		Expect(getPodEndpoint().Spec.GatewayEndpointIp).To(BeEmpty())
+	})
+
+	When("only pods connected to a gateway node directly are checked", func() {
+		BeforeEach(func() {
+			failover = failover.WithEndpointsOnly()
+		})
+
+		It("should keep pods on their gateway when it fails", func() {
+			setNodeReady("gw1", false)
+			failover.Check(context.Background())
+			Expect(getPodEndpoint().Spec.StaticGatewayConfiguration).To(Equal("tgw1"))
+		})
+
+		It("should move pods to the gateway ILB when the gateway node they connect to fails", func() {
+			podEndpoint.Spec.GatewayEndpointIp = "10.1.0.4"
+			Expect(fakeClient.Update(context.Background(), podEndpoint)).To(Succeed())
+			setNodeReady("gw1", false)
+			expectPeerConfigured("tgw1", nil)
+			failover.Check(context.Background())
+			Expect(getPodEndpoint().Spec.StaticGatewayConfiguration).To(Equal("tgw1"))
+			Expect(getPodEndpoint().Spec.GatewayEndpointIp).To(BeEmpty())
+		})
+	})
+
+	When("pod uses a lower priority gateway", func() {
+		BeforeEach(func() {
+			podEndpoint.Spec.StaticGatewayConfiguration = "tgw2"
+			Expect(fakeClient.Update(context.Background(), podEndpoint)).To(Succeed())
+		})
+
+		It("should not fail back without failback enabled", func() {
+			failover.Check(context.Background())
+			Expect(getPodEndpoint().Spec.StaticGatewayConfiguration).To(Equal("tgw2"))
+		})
+
+		It("should fail back once the higher priority gateway recovers", func() {
+			podEndpoint = getPodEndpoint()
+			podEndpoint.Spec.Failback = true
+			Expect(fakeClient.Update(context.Background(), podEndpoint)).To(Succeed())
+			setNodeReady("gw1", false)
+			failover.Check(context.Background())
+			Expect(getPodEndpoint().Spec.StaticGatewayConfiguration).To(Equal("tgw2"))
+
+			setNodeReady("gw1", true)
+			expectPeerConfigured("tgw1", nil)
+			failover.Check(context.Background())
+			Expect(getPodEndpoint().Spec.StaticGatewayConfiguration).To(Equal("tgw1"))
+		})
+	})
+})
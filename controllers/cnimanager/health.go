@@ -0,0 +1,118 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cnimanager
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"google.golang.org/grpc/health"
+	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
+	"k8s.io/client-go/rest"
+
+	cniprotocol "github.com/Azure/kube-egress-gateway/pkg/cniprotocol/v1"
+	"github.com/Azure/kube-egress-gateway/pkg/logger"
+)
+
+const (
+	// ReadinessService is the grpc health service reporting whether cni requests can be served on this node.
+	// The overall "" service stays serving as long as the grpc server is up and is meant for liveness probes,
+	// so that a temporary api server outage does not restart the cni manager.
+	ReadinessService = "readiness"
+
+	defaultHealthCheckInterval = 10 * time.Second
+	healthCheckTimeout         = 5 * time.Second
+)
+
+// HealthCheck returns an error when a dependency of the cni manager is unavailable
+type HealthCheck func(ctx context.Context) error
+
+// HealthChecker periodically runs readiness checks and reports the result through the grpc health server
+type HealthChecker struct {
+	server   *health.Server
+	checks   map[string]HealthCheck
+	interval time.Duration
+	status   healthgrpc.HealthCheckResponse_ServingStatus
+}
+
+func NewHealthChecker(server *health.Server, checks map[string]HealthCheck) *HealthChecker {
+	return &HealthChecker{server: server, checks: checks, interval: defaultHealthCheckInterval}
+}
+
+// WithInterval overrides how often the checks run
+func (h *HealthChecker) WithInterval(interval time.Duration) *HealthChecker {
+	h.interval = interval
+	return h
+}
+
+// Start marks the cni manager not ready and runs the checks until ctx is done
+func (h *HealthChecker) Start(ctx context.Context) error {
+	h.setStatus(healthgrpc.HealthCheckResponse_NOT_SERVING)
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		h.check(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *HealthChecker) check(ctx context.Context) {
+	log := logger.GetLogger()
+	names := make([]string, 0, len(h.checks))
+	for name := range h.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	status := healthgrpc.HealthCheckResponse_SERVING
+	for _, name := range names {
+		checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		err := h.checks[name](checkCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				// shutting down, serving status is updated by the health server shutdown
+				return
+			}
+			log.Error(err, "health check failed", "check", name)
+			status = healthgrpc.HealthCheckResponse_NOT_SERVING
+		}
+	}
+	if status != h.status {
+		log.Info("cni manager serving status changed", "status", status.String())
+	}
+	h.setStatus(status)
+}
+
+func (h *HealthChecker) setStatus(status healthgrpc.HealthCheckResponse_ServingStatus) {
+	h.status = status
+	h.server.SetServingStatus(ReadinessService, status)
+	h.server.SetServingStatus(cniprotocol.NicService_ServiceDesc.ServiceName, status)
+}
+
+// APIServerHealthCheck checks the api server is reachable through its readyz endpoint
+func APIServerHealthCheck(restClient rest.Interface) HealthCheck {
+	return func(ctx context.Context) error {
+		if err := restClient.Get().AbsPath("/readyz").Do(ctx).Error(); err != nil {
+			return fmt.Errorf("api server is not reachable: %w", err)
+		}
+		return nil
+	}
+}
+
+// WireguardHealthCheck checks the wireguard kernel module is available on the node
+func WireguardHealthCheck() HealthCheck {
+	return func(ctx context.Context) error {
+		if _, err := netlink.GenlFamilyGet("wireguard"); err != nil {
+			return fmt.Errorf("wireguard is not available on the node: %w", err)
+		}
+		return nil
+	}
+}
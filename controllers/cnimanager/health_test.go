@@ -0,0 +1,129 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cnimanager_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/health"
+	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+
+	"github.com/Azure/kube-egress-gateway/controllers/cnimanager"
+	cniprotocol "github.com/Azure/kube-egress-gateway/pkg/cniprotocol/v1"
+)
+
+var _ = Describe("HealthChecker", func() {
+	var healthServer *health.Server
+	var ctx context.Context
+	var cancel context.CancelFunc
+	var apiServerErr, wireguardErr atomic.Value
+	var done chan struct{}
+
+	servingStatus := func(service string) func() healthgrpc.HealthCheckResponse_ServingStatus {
+		return func() healthgrpc.HealthCheckResponse_ServingStatus {
+			resp, err := healthServer.Check(context.Background(), &healthgrpc.HealthCheckRequest{Service: service})
+			if err != nil {
+				return healthgrpc.HealthCheckResponse_UNKNOWN
+			}
+			return resp.GetStatus()
+		}
+	}
+	failure := func(msg string) error {
+		if msg == "" {
+			return nil
+		}
+		return fmt.Errorf("%s", msg)
+	}
+
+	BeforeEach(func() {
+		healthServer = health.NewServer()
+		healthServer.SetServingStatus("", healthgrpc.HealthCheckResponse_SERVING)
+		apiServerErr.Store("")
+		wireguardErr.Store("")
+		ctx, cancel = context.WithCancel(context.Background())
+		done = nil
+	})
+
+	AfterEach(func() {
+		cancel()
+		if done != nil {
+			Eventually(done).Should(BeClosed())
+		}
+	})
+
+	start := func() {
+		checker := cnimanager.NewHealthChecker(healthServer, map[string]cnimanager.HealthCheck{
+			"apiserver": func(context.Context) error { return failure(apiServerErr.Load().(string)) },
+			"wireguard": func(context.Context) error { return failure(wireguardErr.Load().(string)) },
+		}).WithInterval(10 * time.Millisecond)
+		done = make(chan struct{})
+		go func() {
+			defer close(done)
+			Expect(checker.Start(ctx)).To(Succeed())
+		}()
+	}
+
+	It("should report ready when all checks pass", func() {
+		start()
+		Eventually(servingStatus(cnimanager.ReadinessService)).Should(Equal(healthgrpc.HealthCheckResponse_SERVING))
+		Expect(servingStatus(cniprotocol.NicService_ServiceDesc.ServiceName)()).To(Equal(healthgrpc.HealthCheckResponse_SERVING))
+		Expect(servingStatus("")()).To(Equal(healthgrpc.HealthCheckResponse_SERVING))
+	})
+
+	It("should follow check results while keeping liveness serving", func() {
+		wireguardErr.Store("wireguard not found")
+		start()
+		Eventually(servingStatus(cnimanager.ReadinessService)).Should(Equal(healthgrpc.HealthCheckResponse_NOT_SERVING))
+		Consistently(servingStatus(cnimanager.ReadinessService), 100*time.Millisecond).Should(Equal(healthgrpc.HealthCheckResponse_NOT_SERVING))
+
+		wireguardErr.Store("")
+		Eventually(servingStatus(cnimanager.ReadinessService)).Should(Equal(healthgrpc.HealthCheckResponse_SERVING))
+
+		apiServerErr.Store("connection refused")
+		Eventually(servingStatus(cnimanager.ReadinessService)).Should(Equal(healthgrpc.HealthCheckResponse_NOT_SERVING))
+		Expect(servingStatus(cniprotocol.NicService_ServiceDesc.ServiceName)()).To(Equal(healthgrpc.HealthCheckResponse_NOT_SERVING))
+		Expect(servingStatus("")()).To(Equal(healthgrpc.HealthCheckResponse_SERVING))
+	})
+
+	It("should stay not serving after health server shutdown", func() {
+		start()
+		Eventually(servingStatus(cnimanager.ReadinessService)).Should(Equal(healthgrpc.HealthCheckResponse_SERVING))
+		healthServer.Shutdown()
+		Consistently(servingStatus(cnimanager.ReadinessService), 100*time.Millisecond).Should(Equal(healthgrpc.HealthCheckResponse_NOT_SERVING))
+		Expect(servingStatus("")()).To(Equal(healthgrpc.HealthCheckResponse_NOT_SERVING))
+	})
+
+	Context("APIServerHealthCheck", func() {
+		var readyz int32
+
+		checkAPIServer := func() error {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).To(Equal("/readyz"))
+				w.WriteHeader(int(atomic.LoadInt32(&readyz)))
+			}))
+			defer server.Close()
+			discoveryClient, err := discovery.NewDiscoveryClientForConfig(&rest.Config{Host: server.URL})
+			Expect(err).NotTo(HaveOccurred())
+			return cnimanager.APIServerHealthCheck(discoveryClient.RESTClient())(context.Background())
+		}
+
+		It("should pass when api server is ready", func() {
+			atomic.StoreInt32(&readyz, http.StatusOK)
+			Expect(checkAPIServer()).To(Succeed())
+		})
+
+		It("should fail when api server is not ready", func() {
+			atomic.StoreInt32(&readyz, http.StatusInternalServerError)
+			Expect(checkAPIServer()).To(MatchError(ContainSubstring("api server is not reachable")))
+		})
+	})
+})
@@ -0,0 +1,120 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cnimanager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/logger"
+	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/wgctrlwrapper"
+)
+
+// PodKeySync periodically moves the gateway peer of running pods on this node to the new public key after the
+// gateway key is rotated. The peer keeps its endpoint, allowed IPs and keepalive, and pod routes are left untouched,
+// so the tunnel recovers with the next handshake instead of requiring a pod restart.
+type PodKeySync struct {
+	nicService *NicService
+	nodeName   string
+	netns      netnswrapper.Interface
+	wgCtrl     wgctrlwrapper.Interface
+}
+
+func NewPodKeySync(nicService *NicService, nodeName string) *PodKeySync {
+	return &PodKeySync{
+		nicService: nicService,
+		nodeName:   nodeName,
+		netns:      netnswrapper.NewNetNS(),
+		wgCtrl:     wgctrlwrapper.NewWgCtrl(),
+	}
+}
+
+// WithNetNSAndWgCtrl overrides how pod network namespaces and wireguard devices are accessed
+func (s *PodKeySync) WithNetNSAndWgCtrl(netns netnswrapper.Interface, wgCtrl wgctrlwrapper.Interface) *PodKeySync {
+	s.netns = netns
+	s.wgCtrl = wgCtrl
+	return s
+}
+
+// Sync moves pods on this node whose gateway key changed to the new key, errors are logged and retried in the next sync
+func (s *PodKeySync) Sync(ctx context.Context) {
+	s.nicService.forEachLocalPodEndpoint(ctx, s.nodeName, "sync pod gateway key", nil, s.syncPodEndpoint)
+}
+
+func (s *PodKeySync) syncPodEndpoint(ctx context.Context, local *localPodEndpoint) error {
+	podEndpoint, pod, gwConfig := local.podEndpoint, local.pod, local.gwConfig
+	if gwConfig == nil || gwConfig.Status.PublicKey == "" || gwConfig.Status.PublicKey == podEndpoint.Spec.GatewayPublicKey {
+		return nil
+	}
+
+	if err := s.updatePodPeerKey(podEndpoint.Spec.PodNetnsPath, gwConfig.Status.PublicKey); err != nil {
+		return err
+	}
+	from := podEndpoint.Spec.GatewayPublicKey
+	podEndpoint.Spec.GatewayPublicKey = gwConfig.Status.PublicKey
+	if err := s.nicService.k8sClient.Update(ctx, podEndpoint); err != nil {
+		return fmt.Errorf("failed to update PodEndpoint: %w", err)
+	}
+	logger.GetLogger().Info("pod tunnel moved to rotated gateway key", "pod", client.ObjectKeyFromObject(pod), "from", from, "to", podEndpoint.Spec.GatewayPublicKey)
+	return nil
+}
+
+// updatePodPeerKey replaces the gateway peer in the pod network namespace with a peer on publicKey, copying the
+// endpoint, allowed IPs and keepalive of the current peer. It does nothing when the peer already uses publicKey.
+func (s *PodKeySync) updatePodPeerKey(netnsPath string, publicKey string) error {
+	gwPublicKey, err := wgtypes.ParseKey(publicKey)
+	if err != nil {
+		return fmt.Errorf("failed to parse gateway public key: %w", err)
+	}
+
+	podNs, err := s.netns.GetNSByPath(netnsPath)
+	if err != nil {
+		return fmt.Errorf("failed to get pod network namespace %s: %w", netnsPath, err)
+	}
+	defer podNs.Close()
+	return podNs.Do(func(nn ns.NetNS) error {
+		wgClient, err := s.wgCtrl.New()
+		if err != nil {
+			return fmt.Errorf("failed to create wg client: %w", err)
+		}
+		defer wgClient.Close()
+		device, err := wgClient.Device(consts.WireguardLinkName)
+		if err != nil {
+			return fmt.Errorf("failed to get wg device: %w", err)
+		}
+		if len(device.Peers) != 1 {
+			return fmt.Errorf("wg device has %d peers, expected the gateway peer only", len(device.Peers))
+		}
+		peer := device.Peers[0]
+		if peer.PublicKey == gwPublicKey {
+			return nil
+		}
+		var keepalive *time.Duration
+		if peer.PersistentKeepaliveInterval > 0 {
+			keepalive = &peer.PersistentKeepaliveInterval
+		}
+		err = wgClient.ConfigureDevice(consts.WireguardLinkName, wgtypes.Config{
+			ReplacePeers: true,
+			Peers: []wgtypes.PeerConfig{
+				{
+					PublicKey:                   gwPublicKey,
+					PersistentKeepaliveInterval: keepalive,
+					Endpoint:                    peer.Endpoint,
+					ReplaceAllowedIPs:           true,
+					AllowedIPs:                  peer.AllowedIPs,
+				},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to configure wg device: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,166 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cnimanager_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	current "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/controllers/cnimanager"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper/mocknetnswrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/wgctrlwrapper/mockwgctrlwrapper"
+)
+
+var _ = Describe("PodKeySync", func() {
+	const netnsPath = "/var/run/netns/cni-1234"
+	var (
+		fakeClient  client.Client
+		keySync     *cnimanager.PodKeySync
+		mnetns      *mocknetnswrapper.MockInterface
+		mwg         *mockwgctrlwrapper.MockInterface
+		mclient     *mockwgctrlwrapper.MockClient
+		podEndpoint *current.PodEndpoint
+		gwConfig    *current.StaticGatewayConfiguration
+		oldKey      wgtypes.Key
+		newKey      wgtypes.Key
+		podPeer     wgtypes.Peer
+	)
+
+	getPodEndpoint := func() *current.PodEndpoint {
+		got := &current.PodEndpoint{}
+		Expect(fakeClient.Get(context.Background(), client.ObjectKeyFromObject(podEndpoint), got)).To(Succeed())
+		return got
+	}
+	rotateGatewayKey := func() {
+		Expect(fakeClient.Get(context.Background(), client.ObjectKeyFromObject(gwConfig), gwConfig)).To(Succeed())
+		gwConfig.Status.PublicKey = newKey.String()
+		gwConfig.Status.PreviousPublicKey = oldKey.String()
+		Expect(fakeClient.Status().Update(context.Background(), gwConfig)).To(Succeed())
+	}
+	// the pod wireguard device, updated by ConfigureDevice like the kernel does
+	expectPodDevice := func() {
+		mnetns.EXPECT().GetNSByPath(netnsPath).Return(&mocknetnswrapper.MockNetNS{Name: netnsPath}, nil)
+		mwg.EXPECT().New().Return(mclient, nil)
+		mclient.EXPECT().Close()
+		mclient.EXPECT().Device(consts.WireguardLinkName).DoAndReturn(func(_ string) (*wgtypes.Device, error) {
+			return &wgtypes.Device{Name: consts.WireguardLinkName, Peers: []wgtypes.Peer{podPeer}}, nil
+		})
+	}
+
+	BeforeEach(func() {
+		apischeme := runtime.NewScheme()
+		utilruntime.Must(clientgoscheme.AddToScheme(apischeme))
+		utilruntime.Must(current.AddToScheme(apischeme))
+		privateKey, err := wgtypes.GeneratePrivateKey()
+		Expect(err).NotTo(HaveOccurred())
+		oldKey = privateKey.PublicKey()
+		privateKey, err = wgtypes.GeneratePrivateKey()
+		Expect(err).NotTo(HaveOccurred())
+		newKey = privateKey.PublicKey()
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+			Spec:       corev1.PodSpec{NodeName: "node1"},
+		}
+		gwConfig = &current.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "tgw1", Namespace: "default"},
+			Status: current.StaticGatewayConfigurationStatus{
+				GatewayServerProfile: current.GatewayServerProfile{Ip: "10.1.0.100", Port: 6000, PublicKey: oldKey.String()},
+			},
+		}
+		podEndpoint = &current.PodEndpoint{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+			Spec: current.PodEndpointSpec{
+				StaticGatewayConfiguration: "tgw1",
+				PodIpAddress:               "10.244.0.10/32",
+				PodNetnsPath:               netnsPath,
+				GatewayPublicKey:           oldKey.String(),
+				GatewayEndpointIp:          "10.1.0.4",
+			},
+		}
+		podPeer = wgtypes.Peer{
+			PublicKey:                   oldKey,
+			Endpoint:                    &net.UDPAddr{IP: net.ParseIP("10.1.0.4"), Port: 6000},
+			PersistentKeepaliveInterval: 25 * time.Second,
+			AllowedIPs: []net.IPNet{
+				{IP: net.IPv4zero, Mask: net.CIDRMask(0, 8*net.IPv4len)},
+				{IP: net.IPv6zero, Mask: net.CIDRMask(0, 8*net.IPv6len)},
+			},
+		}
+		fakeClient = fake.NewClientBuilder().WithScheme(apischeme).WithRuntimeObjects(pod, podEndpoint, gwConfig).WithStatusSubresource(gwConfig).Build()
+
+		mctrl := gomock.NewController(GinkgoT())
+		mnetns = mocknetnswrapper.NewMockInterface(mctrl)
+		mwg = mockwgctrlwrapper.NewMockInterface(mctrl)
+		mclient = mockwgctrlwrapper.NewMockClient(mctrl)
+		keySync = cnimanager.NewPodKeySync(cnimanager.NewNicService(fakeClient), "node1").WithNetNSAndWgCtrl(mnetns, mwg)
+	})
+
+	It("should not touch pods on the current gateway key", func() {
+		keySync.Sync(context.Background())
+		Expect(getPodEndpoint().Spec.GatewayPublicKey).To(Equal(oldKey.String()))
+	})
+
+	It("should keep the pod tunnel connected across a gateway key rotation", func() {
+		rotateGatewayKey()
+		expectPodDevice()
+		mclient.EXPECT().ConfigureDevice(consts.WireguardLinkName, gomock.Any()).DoAndReturn(func(_ string, cfg wgtypes.Config) error {
+			// the peer only changes its key, the tunnel keeps its endpoint, addresses and keepalive
+			Expect(cfg.ReplacePeers).To(BeTrue())
+			Expect(cfg.Peers).To(HaveLen(1))
+			Expect(cfg.Peers[0].PublicKey).To(Equal(newKey))
+			Expect(cfg.Peers[0].Endpoint).To(Equal(podPeer.Endpoint))
+			Expect(cfg.Peers[0].AllowedIPs).To(Equal(podPeer.AllowedIPs))
+			Expect(cfg.Peers[0].ReplaceAllowedIPs).To(BeTrue())
+			Expect(*cfg.Peers[0].PersistentKeepaliveInterval).To(Equal(25 * time.Second))
+			podPeer.PublicKey = cfg.Peers[0].PublicKey
+			return nil
+		})
+		keySync.Sync(context.Background())
+		Expect(getPodEndpoint().Spec.GatewayPublicKey).To(Equal(newKey.String()))
+		Expect(getPodEndpoint().Spec.GatewayEndpointIp).To(Equal("10.1.0.4"))
+
+		// the moved pod is not reconfigured again
+		keySync.Sync(context.Background())
+		Expect(podPeer.PublicKey).To(Equal(newKey))
+	})
+
+	It("should only record the key when the pod peer already uses it", func() {
+		rotateGatewayKey()
+		podPeer.PublicKey = newKey
+		expectPodDevice()
+		keySync.Sync(context.Background())
+		Expect(getPodEndpoint().Spec.GatewayPublicKey).To(Equal(newKey.String()))
+	})
+
+	It("should retry pods whose peer cannot be configured", func() {
+		rotateGatewayKey()
+		expectPodDevice()
+		mclient.EXPECT().ConfigureDevice(consts.WireguardLinkName, gomock.Any()).Return(errors.New("failed"))
+		keySync.Sync(context.Background())
+		Expect(getPodEndpoint().Spec.GatewayPublicKey).To(Equal(oldKey.String()))
+	})
+
+	It("should ignore pods on other nodes", func() {
+		rotateGatewayKey()
+		keySync = cnimanager.NewPodKeySync(cnimanager.NewNicService(fakeClient), "node2").WithNetNSAndWgCtrl(mnetns, mwg)
+		keySync.Sync(context.Background())
+		Expect(getPodEndpoint().Spec.GatewayPublicKey).To(Equal(oldKey.String()))
+	})
+})
@@ -0,0 +1,135 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cnimanager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	current "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/logger"
+)
+
+// PodSyncLoop runs the periodic jobs on pods of this node, e.g. gateway failover, pod route and key sync, from a
+// single ticker firing at the shortest job interval. Each job runs once its own interval has passed.
+type PodSyncLoop struct {
+	jobs []*podSyncJob
+}
+
+type podSyncJob struct {
+	interval time.Duration
+	run      func(context.Context)
+	next     time.Time
+}
+
+func NewPodSyncLoop() *PodSyncLoop {
+	return &PodSyncLoop{}
+}
+
+// Add runs job every interval
+func (l *PodSyncLoop) Add(interval time.Duration, job func(context.Context)) *PodSyncLoop {
+	l.jobs = append(l.jobs, &podSyncJob{interval: interval, run: job})
+	return l
+}
+
+// Empty returns whether no job was added
+func (l *PodSyncLoop) Empty() bool {
+	return len(l.jobs) == 0
+}
+
+// Start runs the jobs until ctx is done, each job runs right away first
+func (l *PodSyncLoop) Start(ctx context.Context) error {
+	if l.Empty() {
+		return nil
+	}
+	tick := l.jobs[0].interval
+	for _, job := range l.jobs {
+		tick = min(tick, job.interval)
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		for _, job := range l.jobs {
+			if now.Before(job.next) {
+				continue
+			}
+			job.run(ctx)
+			// ticks may come slightly early, a job is due on the tick closest to its interval
+			job.next = now.Add(job.interval - tick/2)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// localPodEndpoint is the PodEndpoint of a pod running on this node, with the pod and its current gateway
+type localPodEndpoint struct {
+	podEndpoint *current.PodEndpoint
+	pod         *corev1.Pod
+	// gwConfig is nil when the gateway of the PodEndpoint no longer exists
+	gwConfig *current.StaticGatewayConfiguration
+}
+
+// forEachLocalPodEndpoint calls sync with each PodEndpoint not being deleted whose pod network namespace is known
+// and whose pod runs on nodeName, as the network namespace is only reachable from its own node. PodEndpoints for
+// which skip returns true are ignored before their pod and gateway are read. Errors are logged with action and are
+// retried by the next call.
+func (s *NicService) forEachLocalPodEndpoint(
+	ctx context.Context,
+	nodeName string,
+	action string,
+	skip func(*current.PodEndpoint) bool,
+	sync func(context.Context, *localPodEndpoint) error,
+) {
+	log := logger.GetLogger()
+	podEndpointList := &current.PodEndpointList{}
+	if err := s.k8sClient.List(ctx, podEndpointList); err != nil {
+		log.Error(err, "failed to list PodEndpoints")
+		return
+	}
+	for i := range podEndpointList.Items {
+		podEndpoint := &podEndpointList.Items[i]
+		if podEndpoint.Spec.PodNetnsPath == "" || !podEndpoint.DeletionTimestamp.IsZero() || (skip != nil && skip(podEndpoint)) {
+			continue
+		}
+		local, err := s.getLocalPodEndpoint(ctx, nodeName, podEndpoint)
+		if err == nil && local != nil {
+			err = sync(ctx, local)
+		}
+		if err != nil {
+			log.Error(err, "failed to "+action, "podEndpoint", client.ObjectKeyFromObject(podEndpoint))
+		}
+	}
+}
+
+// getLocalPodEndpoint reads the pod and gateway of podEndpoint, it returns nil when the pod does not exist or runs
+// on another node than nodeName
+func (s *NicService) getLocalPodEndpoint(ctx context.Context, nodeName string, podEndpoint *current.PodEndpoint) (*localPodEndpoint, error) {
+	pod := &corev1.Pod{}
+	if err := s.k8sClient.Get(ctx, client.ObjectKeyFromObject(podEndpoint), pod); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to retrieve pod: %w", err)
+	}
+	if pod.Spec.NodeName != nodeName {
+		return nil, nil
+	}
+	gwConfig := &current.StaticGatewayConfiguration{}
+	if err := s.k8sClient.Get(ctx, podEndpoint.GetStaticGatewayConfigurationKey(), gwConfig); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to retrieve StaticGatewayConfiguration %s: %w", podEndpoint.GetStaticGatewayConfigurationKey(), err)
+		}
+		gwConfig = nil
+	}
+	return &localPodEndpoint{podEndpoint: podEndpoint, pod: pod, gwConfig: gwConfig}, nil
+}
@@ -0,0 +1,41 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cnimanager_test
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/Azure/kube-egress-gateway/controllers/cnimanager"
+)
+
+var _ = Describe("PodSyncLoop", func() {
+	It("should run each job at its own interval from one ticker", func() {
+		var fast, slow atomic.Int32
+		loop := cnimanager.NewPodSyncLoop().
+			Add(10*time.Millisecond, func(context.Context) { fast.Add(1) }).
+			Add(40*time.Millisecond, func(context.Context) { slow.Add(1) })
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			Expect(loop.Start(ctx)).To(Succeed())
+		}()
+		// both jobs run right away
+		Eventually(slow.Load).Should(BeNumerically(">=", 1))
+		Eventually(fast.Load).Should(BeNumerically(">=", 8))
+		cancel()
+		<-done
+		Expect(slow.Load()).To(BeNumerically("<", fast.Load()/2))
+	})
+
+	It("should return right away without jobs", func() {
+		loop := cnimanager.NewPodSyncLoop()
+		Expect(loop.Empty()).To(BeTrue())
+		Expect(loop.Start(context.Background())).To(Succeed())
+	})
+})
@@ -0,0 +1,91 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cnimanager
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	PeerPlacementHash        = "hash"
+	PeerPlacementRoundRobin  = "round-robin"
+	PeerPlacementLeastLoaded = "least-loaded"
+)
+
+// PeerPlacementStrategy picks the gateway node a pod tunnel connects to
+type PeerPlacementStrategy interface {
+	// Place returns one of candidates, the internal IPs of the ready gateway nodes of gateway sorted in ascending
+	// order. peerCounts is the number of other pods connected to each candidate, only counted for
+	// LeastLoadedPlacement.
+	Place(pod, gateway client.ObjectKey, candidates []string, peerCounts map[string]int) string
+}
+
+// NewPeerPlacementStrategy returns the placement strategy with the given name
+func NewPeerPlacementStrategy(name string) (PeerPlacementStrategy, error) {
+	switch name {
+	case PeerPlacementHash:
+		return &HashPlacement{}, nil
+	case PeerPlacementRoundRobin:
+		return NewRoundRobinPlacement(), nil
+	case PeerPlacementLeastLoaded:
+		return &LeastLoadedPlacement{}, nil
+	default:
+		return nil, fmt.Errorf("unknown peer placement strategy %q, must be one of %s, %s, %s",
+			name, PeerPlacementHash, PeerPlacementRoundRobin, PeerPlacementLeastLoaded)
+	}
+}
+
+// HashPlacement picks a candidate by hashing the pod name, so that the same pod always picks the same node as
+// long as the candidates do not change
+type HashPlacement struct{}
+
+func (p *HashPlacement) Place(pod, gateway client.ObjectKey, candidates []string, peerCounts map[string]int) string {
+	return candidates[hashPod(pod)%uint32(len(candidates))]
+}
+
+// RoundRobinPlacement rotates through the candidates of each gateway. Every CNI manager rotates independently, so
+// pods are spread evenly as long as they are started evenly across nodes.
+type RoundRobinPlacement struct {
+	lock sync.Mutex
+	next map[client.ObjectKey]int
+}
+
+func NewRoundRobinPlacement() *RoundRobinPlacement {
+	return &RoundRobinPlacement{next: make(map[client.ObjectKey]int)}
+}
+
+func (p *RoundRobinPlacement) Place(pod, gateway client.ObjectKey, candidates []string, peerCounts map[string]int) string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	i := p.next[gateway] % len(candidates)
+	p.next[gateway] = i + 1
+	return candidates[i]
+}
+
+// LeastLoadedPlacement picks the candidate with the fewest peers, ties are broken by hashing the pod name so that
+// CNI managers placing pods at the same time do not all pick the same node
+type LeastLoadedPlacement struct{}
+
+func (p *LeastLoadedPlacement) Place(pod, gateway client.ObjectKey, candidates []string, peerCounts map[string]int) string {
+	var leastLoaded []string
+	for _, candidate := range candidates {
+		if len(leastLoaded) > 0 && peerCounts[candidate] > peerCounts[leastLoaded[0]] {
+			continue
+		}
+		if len(leastLoaded) > 0 && peerCounts[candidate] < peerCounts[leastLoaded[0]] {
+			leastLoaded = leastLoaded[:0]
+		}
+		leastLoaded = append(leastLoaded, candidate)
+	}
+	return leastLoaded[hashPod(pod)%uint32(len(leastLoaded))]
+}
+
+func hashPod(pod client.ObjectKey) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(pod.Namespace + "/" + pod.Name))
+	return h.Sum32()
+}
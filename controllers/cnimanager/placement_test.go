@@ -0,0 +1,83 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cnimanager_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Azure/kube-egress-gateway/controllers/cnimanager"
+)
+
+var _ = Describe("PeerPlacementStrategy", func() {
+	candidates := []string{"10.1.0.4", "10.1.0.5", "10.1.0.6"}
+	gateway := client.ObjectKey{Namespace: "default", Name: "tgw1"}
+	pod := client.ObjectKey{Namespace: "default", Name: "test"}
+
+	DescribeTable("should be created by name", func(name string, expected cnimanager.PeerPlacementStrategy) {
+		strategy, err := cnimanager.NewPeerPlacementStrategy(name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strategy).To(BeAssignableToTypeOf(expected))
+	},
+		Entry("hash", cnimanager.PeerPlacementHash, &cnimanager.HashPlacement{}),
+		Entry("round-robin", cnimanager.PeerPlacementRoundRobin, &cnimanager.RoundRobinPlacement{}),
+		Entry("least-loaded", cnimanager.PeerPlacementLeastLoaded, &cnimanager.LeastLoadedPlacement{}),
+	)
+
+	It("should return error for unknown strategy", func() {
+		_, err := cnimanager.NewPeerPlacementStrategy("random")
+		Expect(err).To(MatchError(ContainSubstring(`unknown peer placement strategy "random"`)))
+	})
+
+	Context("hash", func() {
+		It("should always place the same pod on the same node", func() {
+			strategy := &cnimanager.HashPlacement{}
+			placed := strategy.Place(pod, gateway, candidates, nil)
+			Expect(candidates).To(ContainElement(placed))
+			Expect(strategy.Place(pod, gateway, candidates, map[string]int{placed: 10})).To(Equal(placed))
+		})
+	})
+
+	Context("round-robin", func() {
+		It("should rotate through the candidates of each gateway", func() {
+			strategy := cnimanager.NewRoundRobinPlacement()
+			other := client.ObjectKey{Namespace: "default", Name: "tgw2"}
+			Expect(strategy.Place(pod, gateway, candidates, nil)).To(Equal("10.1.0.4"))
+			Expect(strategy.Place(pod, gateway, candidates, nil)).To(Equal("10.1.0.5"))
+			Expect(strategy.Place(pod, other, candidates, nil)).To(Equal("10.1.0.4"))
+			Expect(strategy.Place(pod, gateway, candidates, nil)).To(Equal("10.1.0.6"))
+			Expect(strategy.Place(pod, gateway, candidates, nil)).To(Equal("10.1.0.4"))
+		})
+
+		It("should keep rotating when candidates shrink", func() {
+			strategy := cnimanager.NewRoundRobinPlacement()
+			Expect(strategy.Place(pod, gateway, candidates, nil)).To(Equal("10.1.0.4"))
+			Expect(strategy.Place(pod, gateway, candidates, nil)).To(Equal("10.1.0.5"))
+			Expect(strategy.Place(pod, gateway, candidates[:1], nil)).To(Equal("10.1.0.4"))
+			Expect(strategy.Place(pod, gateway, candidates, nil)).To(Equal("10.1.0.5"))
+		})
+	})
+
+	Context("least-loaded", func() {
+		It("should place pod on the node with the fewest peers", func() {
+			strategy := &cnimanager.LeastLoadedPlacement{}
+			Expect(strategy.Place(pod, gateway, candidates, map[string]int{"10.1.0.4": 3, "10.1.0.5": 1, "10.1.0.6": 2})).To(Equal("10.1.0.5"))
+		})
+
+		It("should prefer nodes without peers", func() {
+			strategy := &cnimanager.LeastLoadedPlacement{}
+			Expect(strategy.Place(pod, gateway, candidates, map[string]int{"10.1.0.4": 1, "10.1.0.5": 1})).To(Equal("10.1.0.6"))
+		})
+
+		It("should break ties among the least loaded nodes only", func() {
+			strategy := &cnimanager.LeastLoadedPlacement{}
+			peerCounts := map[string]int{"10.1.0.4": 2, "10.1.0.5": 1, "10.1.0.6": 1}
+			for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+				placed := strategy.Place(client.ObjectKey{Namespace: "default", Name: name}, gateway, candidates, peerCounts)
+				Expect(placed).To(BeElementOf("10.1.0.5", "10.1.0.6"))
+				Expect(strategy.Place(client.ObjectKey{Namespace: "default", Name: name}, gateway, candidates, peerCounts)).To(Equal(placed))
+			}
+		})
+	})
+})
@@ -0,0 +1,314 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cnimanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	current "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/logger"
+	"github.com/Azure/kube-egress-gateway/pkg/netlinkwrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper"
+)
+
+// PodRouteSync periodically applies defaultRoute, excludeCidrs and includeCidrs changes of gateways to running pods on
+// this node. Only default routes and routes of added or removed CIDRs are changed in the pod network namespace, the pod wireguard interface and
+// its gateway peer are left untouched so that the tunnel is not reset.
+type PodRouteSync struct {
+	nicService *NicService
+	nodeName   string
+	// exception cidrs of the node cni configuration, which stay routed to the pod primary interface
+	nodeExceptionCidrs []string
+	netns              netnswrapper.Interface
+	netlink            netlinkwrapper.Interface
+	// fqdnOnly limits the sync to pods of gateways with excludeFqdns, whose resolved CIDRs change over time
+	fqdnOnly bool
+}
+
+func NewPodRouteSync(nicService *NicService, nodeName string, nodeExceptionCidrs []string) *PodRouteSync {
+	return &PodRouteSync{
+		nicService:         nicService,
+		nodeName:           nodeName,
+		nodeExceptionCidrs: nodeExceptionCidrs,
+		netns:              netnswrapper.NewNetNS(),
+		netlink:            netlinkwrapper.NewNetLink(),
+	}
+}
+
+// WithFQDNOnly limits the sync to pods of gateways with excludeFqdns, so that re-resolved CIDRs reach running pods
+// without applying other excludeCidrs and includeCidrs changes
+func (s *PodRouteSync) WithFQDNOnly() *PodRouteSync {
+	s.fqdnOnly = true
+	return s
+}
+
+// WithNetNSAndNetlink overrides how pod network namespaces and routes are accessed
+func (s *PodRouteSync) WithNetNSAndNetlink(netns netnswrapper.Interface, netlink netlinkwrapper.Interface) *PodRouteSync {
+	s.netns = netns
+	s.netlink = netlink
+	return s
+}
+
+// Sync updates routes of pods on this node whose gateway cidrs changed, errors are logged and retried in the next sync
+func (s *PodRouteSync) Sync(ctx context.Context) {
+	s.nicService.forEachLocalPodEndpoint(ctx, s.nodeName, "sync pod routes", nil, s.syncPodEndpoint)
+}
+
+func (s *PodRouteSync) syncPodEndpoint(ctx context.Context, local *localPodEndpoint) error {
+	podEndpoint, pod, gwConfig := local.podEndpoint, local.pod, local.gwConfig
+	if gwConfig == nil {
+		return nil
+	}
+	if s.fqdnOnly && len(gwConfig.Spec.ExcludeFQDNs) == 0 && len(gwConfig.Status.ResolvedExcludeCidrs) == 0 {
+		return nil
+	}
+	// routes follow the IP versions the pod tunnels, the same as when the pod was added
+	tunnelConfig, err := getPodTunnelConfiguration(pod, gwConfig)
+	if err != nil {
+		return err
+	}
+
+	defaultRoute, exceptionCidrs, includeCidrs := getPodRouteCidrs(tunnelConfig)
+	routeType := getRouteType(defaultRoute)
+	recordedRouteType := podEndpoint.Spec.DefaultRoute
+	if recordedRouteType == "" {
+		// pods configured before the default route was recorded are on the current one
+		recordedRouteType = routeType
+	}
+	if recordedRouteType == routeType && slices.Equal(exceptionCidrs, podEndpoint.Spec.ExceptionCidrs) && slices.Equal(includeCidrs, podEndpoint.Spec.IncludeCidrs) {
+		return nil
+	}
+
+	addExceptions, delExceptions := diffCidrs(podEndpoint.Spec.ExceptionCidrs, exceptionCidrs)
+	addIncludes, delIncludes := diffCidrs(podEndpoint.Spec.IncludeCidrs, includeCidrs)
+	delExceptions = slices.DeleteFunc(delExceptions, func(cidr string) bool {
+		return slices.Contains(s.nodeExceptionCidrs, cidr)
+	})
+	var moveDefaultRoute current.RouteType
+	if recordedRouteType != routeType {
+		moveDefaultRoute = routeType
+	}
+	enableIPv6 := tunnelConfig.TunnelsIPVersion(current.IPv6) && podEndpoint.Spec.PodIpv6Address != ""
+	ipv4ViaNode := tunnelConfig.BypassesIPVersion(current.IPv4)
+	if err := s.updatePodRoutes(podEndpoint.Spec.PodNetnsPath, moveDefaultRoute, addExceptions, delExceptions, addIncludes, delIncludes, enableIPv6, ipv4ViaNode); err != nil {
+		return err
+	}
+
+	podEndpoint.Spec.ExceptionCidrs = exceptionCidrs
+	podEndpoint.Spec.IncludeCidrs = includeCidrs
+	podEndpoint.Spec.DefaultRoute = routeType
+	if err := s.nicService.k8sClient.Update(ctx, podEndpoint); err != nil {
+		return fmt.Errorf("failed to update PodEndpoint: %w", err)
+	}
+	logger.GetLogger().Info("pod routes updated", "pod", client.ObjectKeyFromObject(pod), "movedDefaultRoute", moveDefaultRoute,
+		"addedExceptionCidrs", addExceptions, "removedExceptionCidrs", delExceptions,
+		"addedIncludeCidrs", addIncludes, "removedIncludeCidrs", delIncludes)
+	return nil
+}
+
+// updatePodRoutes adds routes of new cidrs before removing routes of old ones, so that traffic to a cidr moved
+// between the two sets always has a route. When moveDefaultRoute is set, the pod default routes are moved to the
+// gateway or the pod primary interface the same way, except those of IPv4 when ipv4ViaNode.
+func (s *PodRouteSync) updatePodRoutes(netnsPath string, moveDefaultRoute current.RouteType, addExceptions, delExceptions, addIncludes, delIncludes []string, enableIPv6, ipv4ViaNode bool) error {
+	podNs, err := s.netns.GetNSByPath(netnsPath)
+	if err != nil {
+		return fmt.Errorf("failed to get pod network namespace %s: %w", netnsPath, err)
+	}
+	defer podNs.Close()
+	return podNs.Do(func(nn ns.NetNS) error {
+		eth0Link, err := s.netlink.LinkByName("eth0")
+		if err != nil {
+			return fmt.Errorf("failed to retrieve eth0 interface: %w", err)
+		}
+		wgLink, err := s.netlink.LinkByName(consts.WireguardLinkName)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve wireguard interface: %w", err)
+		}
+		eth0Gw, err := s.getEth0Gateway(eth0Link, nl.FAMILY_V4)
+		if err != nil {
+			return err
+		}
+		if eth0Gw == nil {
+			return errors.New("failed to find eth0 gateway")
+		}
+		var defaultCidrs []string
+		if moveDefaultRoute != "" {
+			if !ipv4ViaNode {
+				defaultCidrs = append(defaultCidrs, "0.0.0.0/0")
+			}
+			if enableIPv6 {
+				defaultCidrs = append(defaultCidrs, "::/0")
+			}
+		}
+		var eth0IPv6Gw net.IP
+		if slices.ContainsFunc(slices.Concat(addExceptions, defaultCidrs), isIPv6Cidr) {
+			if eth0IPv6Gw, err = s.getEth0Gateway(eth0Link, nl.FAMILY_V6); err != nil {
+				return err
+			}
+		}
+
+		// default routes are added like exception or include routes, and removed from the other interface last
+		addDefaultExceptions, addDefaultIncludes, oldDefaultLink := defaultCidrs, []string(nil), wgLink
+		if moveDefaultRoute == current.RouteStaticEgressGateway {
+			addDefaultExceptions, addDefaultIncludes, oldDefaultLink = nil, defaultCidrs, eth0Link
+		}
+		for _, cidr := range slices.Concat(addDefaultExceptions, addExceptions) {
+			route, err := getExceptionRoute(cidr, eth0Link, eth0Gw, eth0IPv6Gw)
+			if err != nil {
+				return err
+			}
+			if route == nil {
+				continue
+			}
+			if err := s.netlink.RouteReplace(route); err != nil {
+				return fmt.Errorf("failed to add route (%s): %w", route, err)
+			}
+		}
+		for _, cidr := range slices.Concat(addDefaultIncludes, addIncludes) {
+			route, err := getIncludeRoute(cidr, wgLink, s.nicService.gatewayIP, enableIPv6)
+			if err != nil {
+				return err
+			}
+			if route == nil {
+				continue
+			}
+			if err := s.netlink.RouteReplace(route); err != nil {
+				return fmt.Errorf("failed to add route (%s): %w", route, err)
+			}
+		}
+		for _, cidr := range delExceptions {
+			if err := s.deleteRoute(cidr, eth0Link); err != nil {
+				return err
+			}
+		}
+		for _, cidr := range delIncludes {
+			if err := s.deleteRoute(cidr, wgLink); err != nil {
+				return err
+			}
+		}
+		for _, cidr := range defaultCidrs {
+			if err := s.deleteRoute(cidr, oldDefaultLink); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// getEth0Gateway returns the gateway of pod primary interface routes of family, or nil when there is none. When the
+// pod default route is the gateway, the cni plugin removes the eth0 default route but keeps the original gateway on
+// exception routes.
+func (s *PodRouteSync) getEth0Gateway(eth0Link netlink.Link, family int) (net.IP, error) {
+	routes, err := s.netlink.RouteList(eth0Link, family)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routes on eth0: %w", err)
+	}
+	for _, route := range routes {
+		if route.Gw != nil {
+			return route.Gw, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *PodRouteSync) deleteRoute(cidr string, link netlink.Link) error {
+	_, dst, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("failed to parse cidr (%s): %w", cidr, err)
+	}
+	route := &netlink.Route{Dst: dst, LinkIndex: link.Attrs().Index}
+	if err := s.netlink.RouteDel(route); err != nil && !errors.Is(err, unix.ESRCH) {
+		return fmt.Errorf("failed to delete route (%s): %w", route, err)
+	}
+	return nil
+}
+
+// getExceptionRoute returns the route of cidr via pod primary interface like the cni plugin adds it, IPv6 cidrs are
+// skipped when the pod has no IPv6 gateway on eth0
+func getExceptionRoute(cidr string, eth0Link netlink.Link, eth0Gw, eth0IPv6Gw net.IP) (*netlink.Route, error) {
+	_, dst, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cidr (%s): %w", cidr, err)
+	}
+	if dst.IP.To4() == nil {
+		if eth0IPv6Gw == nil {
+			return nil, nil
+		}
+		return &netlink.Route{
+			Dst:       dst,
+			Gw:        eth0IPv6Gw,
+			LinkIndex: eth0Link.Attrs().Index,
+			Protocol:  unix.RTPROT_STATIC,
+			Family:    nl.FAMILY_V6,
+		}, nil
+	}
+	return &netlink.Route{
+		Dst:       dst,
+		Gw:        eth0Gw,
+		LinkIndex: eth0Link.Attrs().Index,
+		Protocol:  unix.RTPROT_STATIC,
+	}, nil
+}
+
+// getIncludeRoute returns the route of cidr via the wireguard interface like the cni plugin adds it
+func getIncludeRoute(cidr string, wgLink netlink.Link, gatewayIP net.IP, enableIPv6 bool) (*netlink.Route, error) {
+	_, dst, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cidr (%s): %w", cidr, err)
+	}
+	if dst.IP.To4() == nil {
+		if !enableIPv6 {
+			// gateway does not provide ipv6 egress
+			return nil, nil
+		}
+		return &netlink.Route{
+			Dst:       dst,
+			Gw:        gatewayIP,
+			LinkIndex: wgLink.Attrs().Index,
+			Scope:     netlink.SCOPE_UNIVERSE,
+			Family:    nl.FAMILY_V6,
+		}, nil
+	}
+	return &netlink.Route{
+		Dst: dst,
+		Via: &netlink.Via{
+			Addr:       gatewayIP,
+			AddrFamily: nl.FAMILY_V6,
+		},
+		LinkIndex: wgLink.Attrs().Index,
+		Scope:     netlink.SCOPE_UNIVERSE,
+		Family:    nl.FAMILY_V4,
+	}, nil
+}
+
+func isIPv6Cidr(cidr string) bool {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	return err == nil && ipNet.IP.To4() == nil
+}
+
+// diffCidrs returns cidrs in desired but not in recorded, and cidrs in recorded but not in desired
+func diffCidrs(recorded, desired []string) ([]string, []string) {
+	var added, removed []string
+	for _, cidr := range desired {
+		if !slices.Contains(recorded, cidr) {
+			added = append(added, cidr)
+		}
+	}
+	for _, cidr := range recorded {
+		if !slices.Contains(desired, cidr) {
+			removed = append(removed, cidr)
+		}
+	}
+	return added, removed
+}
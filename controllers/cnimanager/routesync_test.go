@@ -0,0 +1,319 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cnimanager_test
+
+import (
+	"context"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/sys/unix"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	current "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/controllers/cnimanager"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/netlinkwrapper/mocknetlinkwrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper/mocknetnswrapper"
+)
+
+var _ = Describe("PodRouteSync", func() {
+	const netnsPath = "/var/run/netns/cni-1234"
+	var (
+		fakeClient  client.Client
+		routeSync   *cnimanager.PodRouteSync
+		mnetns      *mocknetnswrapper.MockInterface
+		mnl         *mocknetlinkwrapper.MockInterface
+		gwConfig    *current.StaticGatewayConfiguration
+		podEndpoint *current.PodEndpoint
+		eth0        = &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth0", Index: 1}}
+		wg0         = &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "wg0", Index: 2}}
+		eth0Gw      = net.IPv4(10, 244, 0, 1)
+	)
+
+	getIPNet := func(cidr string) *net.IPNet {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		Expect(err).NotTo(HaveOccurred())
+		return ipNet
+	}
+	getPodEndpoint := func() *current.PodEndpoint {
+		got := &current.PodEndpoint{}
+		Expect(fakeClient.Get(context.Background(), client.ObjectKeyFromObject(podEndpoint), got)).To(Succeed())
+		return got
+	}
+	updateGwConfig := func(update func(*current.StaticGatewayConfiguration)) {
+		got := &current.StaticGatewayConfiguration{}
+		Expect(fakeClient.Get(context.Background(), client.ObjectKeyFromObject(gwConfig), got)).To(Succeed())
+		update(got)
+		Expect(fakeClient.Update(context.Background(), got)).To(Succeed())
+	}
+	expectPodLinks := func() {
+		mnetns.EXPECT().GetNSByPath(netnsPath).Return(&mocknetnswrapper.MockNetNS{Name: netnsPath}, nil)
+		mnl.EXPECT().LinkByName("eth0").Return(eth0, nil)
+		mnl.EXPECT().LinkByName("wg0").Return(wg0, nil)
+		mnl.EXPECT().RouteList(eth0, nl.FAMILY_V4).Return([]netlink.Route{
+			{Dst: getIPNet("10.244.0.1/32"), LinkIndex: 1, Scope: netlink.SCOPE_LINK},
+			{Dst: getIPNet("1.1.0.0/16"), Gw: eth0Gw, LinkIndex: 1},
+		}, nil)
+	}
+
+	BeforeEach(func() {
+		apischeme := runtime.NewScheme()
+		utilruntime.Must(clientgoscheme.AddToScheme(apischeme))
+		utilruntime.Must(current.AddToScheme(apischeme))
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+			Spec:       corev1.PodSpec{NodeName: "node1"},
+		}
+		gwConfig = &current.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "tgw1", Namespace: "default"},
+			Spec: current.StaticGatewayConfigurationSpec{
+				ExcludeCidrs: []string{"1.1.0.0/16", "10.0.0.0/8"},
+			},
+		}
+		podEndpoint = &current.PodEndpoint{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+			Spec: current.PodEndpointSpec{
+				StaticGatewayConfiguration: "tgw1",
+				PodIpAddress:               "10.244.0.10/32",
+				PodNetnsPath:               netnsPath,
+				ExceptionCidrs:             []string{"1.1.0.0/16", "10.0.0.0/8"},
+			},
+		}
+		fakeClient = fake.NewClientBuilder().WithScheme(apischeme).WithRuntimeObjects(pod, gwConfig, podEndpoint).Build()
+
+		// wireguard link and peers of the pod are not expected to be touched, any such call fails the test
+		mctrl := gomock.NewController(GinkgoT())
+		mnetns = mocknetnswrapper.NewMockInterface(mctrl)
+		mnl = mocknetlinkwrapper.NewMockInterface(mctrl)
+		routeSync = cnimanager.NewPodRouteSync(cnimanager.NewNicService(fakeClient), "node1", []string{"10.0.0.0/8"}).WithNetNSAndNetlink(mnetns, mnl)
+	})
+
+	It("should not access pod network namespace when gateway cidrs are unchanged", func() {
+		routeSync.Sync(context.Background())
+		Expect(getPodEndpoint().Spec.ExceptionCidrs).To(Equal([]string{"1.1.0.0/16", "10.0.0.0/8"}))
+	})
+
+	It("should only update routes of changed excludeCidrs without resetting the tunnel", func() {
+		updateGwConfig(func(gwConfig *current.StaticGatewayConfiguration) {
+			gwConfig.Spec.ExcludeCidrs = []string{"2.2.0.0/16"}
+		})
+		expectPodLinks()
+		gomock.InOrder(
+			mnl.EXPECT().RouteReplace(&netlink.Route{Dst: getIPNet("2.2.0.0/16"), Gw: eth0Gw, LinkIndex: 1, Protocol: unix.RTPROT_STATIC}).Return(nil),
+			// 10.0.0.0/8 is also excluded by the node cni configuration and stays
+			mnl.EXPECT().RouteDel(&netlink.Route{Dst: getIPNet("1.1.0.0/16"), LinkIndex: 1}).Return(nil),
+		)
+		routeSync.Sync(context.Background())
+		Expect(getPodEndpoint().Spec.ExceptionCidrs).To(Equal([]string{"2.2.0.0/16"}))
+
+		// applied once
+		routeSync.Sync(context.Background())
+	})
+
+	It("should route ipv6 excludeCidrs via the eth0 ipv6 gateway", func() {
+		eth0IPv6Gw := net.ParseIP("fe80::1234:5678:9abc")
+		updateGwConfig(func(gwConfig *current.StaticGatewayConfiguration) {
+			gwConfig.Spec.ExcludeCidrs = []string{"1.1.0.0/16", "10.0.0.0/8", "fd00:10::/64"}
+		})
+		expectPodLinks()
+		mnl.EXPECT().RouteList(eth0, nl.FAMILY_V6).Return([]netlink.Route{
+			{Dst: getIPNet("fe80::/64"), LinkIndex: 1},
+			{Dst: getIPNet("fd00:20::/64"), Gw: eth0IPv6Gw, LinkIndex: 1},
+		}, nil)
+		mnl.EXPECT().RouteReplace(&netlink.Route{
+			Dst:       getIPNet("fd00:10::/64"),
+			Gw:        eth0IPv6Gw,
+			LinkIndex: 1,
+			Protocol:  unix.RTPROT_STATIC,
+			Family:    nl.FAMILY_V6,
+		}).Return(nil)
+		routeSync.Sync(context.Background())
+		Expect(getPodEndpoint().Spec.ExceptionCidrs).To(Equal([]string{"1.1.0.0/16", "10.0.0.0/8", "fd00:10::/64"}))
+
+		updateGwConfig(func(gwConfig *current.StaticGatewayConfiguration) {
+			gwConfig.Spec.ExcludeCidrs = []string{"1.1.0.0/16", "10.0.0.0/8"}
+		})
+		expectPodLinks()
+		mnl.EXPECT().RouteDel(&netlink.Route{Dst: getIPNet("fd00:10::/64"), LinkIndex: 1}).Return(nil)
+		routeSync.Sync(context.Background())
+		Expect(getPodEndpoint().Spec.ExceptionCidrs).To(Equal([]string{"1.1.0.0/16", "10.0.0.0/8"}))
+	})
+
+	It("should not route excludeCidrs of ip versions the pod does not tunnel", func() {
+		pod := &corev1.Pod{}
+		Expect(fakeClient.Get(context.Background(), client.ObjectKeyFromObject(podEndpoint), pod)).To(Succeed())
+		pod.Annotations = map[string]string{consts.CNITunnelIPVersionsAnnotationKey: string(current.IPv4)}
+		Expect(fakeClient.Update(context.Background(), pod)).To(Succeed())
+		updateGwConfig(func(gwConfig *current.StaticGatewayConfiguration) {
+			gwConfig.Spec.EnableIPv6 = true
+			gwConfig.Spec.ExcludeCidrs = []string{"1.1.0.0/16", "10.0.0.0/8", "fd00:10::/64"}
+		})
+		// the ipv6 cidr is left out, so the pod routes are unchanged
+		routeSync.Sync(context.Background())
+		Expect(getPodEndpoint().Spec.ExceptionCidrs).To(Equal([]string{"1.1.0.0/16", "10.0.0.0/8"}))
+
+		updateGwConfig(func(gwConfig *current.StaticGatewayConfiguration) {
+			gwConfig.Spec.ExcludeCidrs = []string{"2.2.0.0/16", "fd00:10::/64"}
+		})
+		expectPodLinks()
+		gomock.InOrder(
+			mnl.EXPECT().RouteReplace(&netlink.Route{Dst: getIPNet("2.2.0.0/16"), Gw: eth0Gw, LinkIndex: 1, Protocol: unix.RTPROT_STATIC}).Return(nil),
+			mnl.EXPECT().RouteDel(&netlink.Route{Dst: getIPNet("1.1.0.0/16"), LinkIndex: 1}).Return(nil),
+		)
+		routeSync.Sync(context.Background())
+		Expect(getPodEndpoint().Spec.ExceptionCidrs).To(Equal([]string{"2.2.0.0/16"}))
+	})
+
+	It("should skip ipv6 excludeCidrs when pod has no eth0 ipv6 gateway", func() {
+		updateGwConfig(func(gwConfig *current.StaticGatewayConfiguration) {
+			gwConfig.Spec.ExcludeCidrs = []string{"1.1.0.0/16", "10.0.0.0/8", "fd00:10::/64"}
+		})
+		expectPodLinks()
+		mnl.EXPECT().RouteList(eth0, nl.FAMILY_V6).Return(nil, nil)
+		routeSync.Sync(context.Background())
+		Expect(getPodEndpoint().Spec.ExceptionCidrs).To(Equal([]string{"1.1.0.0/16", "10.0.0.0/8", "fd00:10::/64"}))
+	})
+
+	It("should route excludeCidrs to the gateway when gateway has no includeCidrs", func() {
+		podEndpoint = getPodEndpoint()
+		podEndpoint.Spec.ExceptionCidrs = nil
+		podEndpoint.Spec.IncludeCidrs = []string{"1.1.0.0/16", "10.0.0.0/8"}
+		Expect(fakeClient.Update(context.Background(), podEndpoint)).To(Succeed())
+		updateGwConfig(func(gwConfig *current.StaticGatewayConfiguration) {
+			gwConfig.Spec.DefaultRoute = current.RouteAzureNetworking
+			gwConfig.Spec.ExcludeCidrs = []string{"1.1.0.0/16", "3.3.0.0/16", "fd00::/64"}
+		})
+		expectPodLinks()
+		mnl.EXPECT().RouteReplace(&netlink.Route{
+			Dst:       getIPNet("3.3.0.0/16"),
+			Via:       &netlink.Via{Addr: net.ParseIP("fe80::1"), AddrFamily: nl.FAMILY_V6},
+			LinkIndex: 2,
+			Scope:     netlink.SCOPE_UNIVERSE,
+			Family:    nl.FAMILY_V4,
+		}).Return(nil)
+		mnl.EXPECT().RouteDel(&netlink.Route{Dst: getIPNet("10.0.0.0/8"), LinkIndex: 2}).Return(unix.ESRCH)
+		routeSync.Sync(context.Background())
+		Expect(getPodEndpoint().Spec.IncludeCidrs).To(Equal([]string{"1.1.0.0/16", "3.3.0.0/16", "fd00::/64"}))
+	})
+
+	It("should route included cidrs to the gateway tunnel address", func() {
+		_, tunnelCidr, _ := net.ParseCIDR("fe80:0:0:ffff::/64")
+		routeSync = cnimanager.NewPodRouteSync(cnimanager.NewNicService(fakeClient).WithTunnelCidr(tunnelCidr), "node1", []string{"10.0.0.0/8"}).WithNetNSAndNetlink(mnetns, mnl)
+		podEndpoint = getPodEndpoint()
+		podEndpoint.Spec.ExceptionCidrs = nil
+		podEndpoint.Spec.IncludeCidrs = []string{"1.1.0.0/16"}
+		Expect(fakeClient.Update(context.Background(), podEndpoint)).To(Succeed())
+		updateGwConfig(func(gwConfig *current.StaticGatewayConfiguration) {
+			gwConfig.Spec.DefaultRoute = current.RouteAzureNetworking
+			gwConfig.Spec.ExcludeCidrs = []string{"1.1.0.0/16", "3.3.0.0/16"}
+		})
+		expectPodLinks()
+		mnl.EXPECT().RouteReplace(&netlink.Route{
+			Dst:       getIPNet("3.3.0.0/16"),
+			Via:       &netlink.Via{Addr: net.ParseIP("fe80:0:0:ffff::1"), AddrFamily: nl.FAMILY_V6},
+			LinkIndex: 2,
+			Scope:     netlink.SCOPE_UNIVERSE,
+			Family:    nl.FAMILY_V4,
+		}).Return(nil)
+		routeSync.Sync(context.Background())
+		Expect(getPodEndpoint().Spec.IncludeCidrs).To(Equal([]string{"1.1.0.0/16", "3.3.0.0/16"}))
+	})
+
+	It("should move the pod default route to eth0 when gateway defaultRoute changes to azureNetworking", func() {
+		podEndpoint = getPodEndpoint()
+		podEndpoint.Spec.DefaultRoute = current.RouteStaticEgressGateway
+		Expect(fakeClient.Update(context.Background(), podEndpoint)).To(Succeed())
+		updateGwConfig(func(gwConfig *current.StaticGatewayConfiguration) {
+			gwConfig.Spec.DefaultRoute = current.RouteAzureNetworking
+			gwConfig.Spec.IncludeCidrs = []string{"3.3.0.0/16"}
+		})
+		expectPodLinks()
+		gomock.InOrder(
+			mnl.EXPECT().RouteReplace(&netlink.Route{Dst: getIPNet("0.0.0.0/0"), Gw: eth0Gw, LinkIndex: 1, Protocol: unix.RTPROT_STATIC}).Return(nil),
+			mnl.EXPECT().RouteReplace(&netlink.Route{
+				Dst:       getIPNet("3.3.0.0/16"),
+				Via:       &netlink.Via{Addr: net.ParseIP("fe80::1"), AddrFamily: nl.FAMILY_V6},
+				LinkIndex: 2,
+				Scope:     netlink.SCOPE_UNIVERSE,
+				Family:    nl.FAMILY_V4,
+			}).Return(nil),
+			mnl.EXPECT().RouteDel(&netlink.Route{Dst: getIPNet("0.0.0.0/0"), LinkIndex: 2}).Return(nil),
+		)
+		routeSync.Sync(context.Background())
+		Expect(getPodEndpoint().Spec.DefaultRoute).To(Equal(current.RouteAzureNetworking))
+		Expect(getPodEndpoint().Spec.IncludeCidrs).To(Equal([]string{"3.3.0.0/16"}))
+
+		// applied once
+		routeSync.Sync(context.Background())
+	})
+
+	It("should move the pod default route to the gateway when gateway defaultRoute changes to staticEgressGateway", func() {
+		podEndpoint = getPodEndpoint()
+		podEndpoint.Spec.DefaultRoute = current.RouteAzureNetworking
+		podEndpoint.Spec.IncludeCidrs = []string{"3.3.0.0/16"}
+		Expect(fakeClient.Update(context.Background(), podEndpoint)).To(Succeed())
+		expectPodLinks()
+		gomock.InOrder(
+			mnl.EXPECT().RouteReplace(&netlink.Route{
+				Dst:       getIPNet("0.0.0.0/0"),
+				Via:       &netlink.Via{Addr: net.ParseIP("fe80::1"), AddrFamily: nl.FAMILY_V6},
+				LinkIndex: 2,
+				Scope:     netlink.SCOPE_UNIVERSE,
+				Family:    nl.FAMILY_V4,
+			}).Return(nil),
+			mnl.EXPECT().RouteDel(&netlink.Route{Dst: getIPNet("3.3.0.0/16"), LinkIndex: 2}).Return(nil),
+			mnl.EXPECT().RouteDel(&netlink.Route{Dst: getIPNet("0.0.0.0/0"), LinkIndex: 1}).Return(nil),
+		)
+		routeSync.Sync(context.Background())
+		Expect(getPodEndpoint().Spec.DefaultRoute).To(Equal(current.RouteStaticEgressGateway))
+		Expect(getPodEndpoint().Spec.IncludeCidrs).To(BeEmpty())
+	})
+
+	It("should retry when routes cannot be updated", func() {
+		updateGwConfig(func(gwConfig *current.StaticGatewayConfiguration) {
+			gwConfig.Spec.ExcludeCidrs = nil
+		})
+		expectPodLinks()
+		mnl.EXPECT().RouteDel(&netlink.Route{Dst: getIPNet("1.1.0.0/16"), LinkIndex: 1}).Return(unix.EPERM)
+		routeSync.Sync(context.Background())
+		Expect(getPodEndpoint().Spec.ExceptionCidrs).To(Equal([]string{"1.1.0.0/16", "10.0.0.0/8"}))
+	})
+
+	It("should ignore pods on other nodes", func() {
+		updateGwConfig(func(gwConfig *current.StaticGatewayConfiguration) {
+			gwConfig.Spec.ExcludeCidrs = nil
+		})
+		routeSync = cnimanager.NewPodRouteSync(cnimanager.NewNicService(fakeClient), "node2", nil).WithNetNSAndNetlink(mnetns, mnl)
+		routeSync.Sync(context.Background())
+		Expect(getPodEndpoint().Spec.ExceptionCidrs).To(Equal([]string{"1.1.0.0/16", "10.0.0.0/8"}))
+	})
+	It("should only sync pods of gateways with excludeFqdns in fqdn only mode", func() {
+		updateGwConfig(func(gwConfig *current.StaticGatewayConfiguration) {
+			gwConfig.Spec.ExcludeCidrs = []string{"1.1.0.0/16", "10.0.0.0/8", "2.2.0.0/16"}
+		})
+		routeSync = routeSync.WithFQDNOnly()
+		routeSync.Sync(context.Background())
+		Expect(getPodEndpoint().Spec.ExceptionCidrs).To(Equal([]string{"1.1.0.0/16", "10.0.0.0/8"}))
+
+		updateGwConfig(func(gwConfig *current.StaticGatewayConfiguration) {
+			gwConfig.Spec.ExcludeCidrs = []string{"1.1.0.0/16", "10.0.0.0/8"}
+			gwConfig.Spec.ExcludeFQDNs = []string{"a.example.com"}
+			gwConfig.Status.ResolvedExcludeCidrs = []string{"3.3.3.3/32"}
+		})
+		expectPodLinks()
+		mnl.EXPECT().RouteReplace(&netlink.Route{Dst: getIPNet("3.3.3.3/32"), Gw: eth0Gw, LinkIndex: 1, Protocol: unix.RTPROT_STATIC}).Return(nil)
+		routeSync.Sync(context.Background())
+		Expect(getPodEndpoint().Spec.ExceptionCidrs).To(Equal([]string{"1.1.0.0/16", "10.0.0.0/8", "3.3.3.3/32"}))
+	})
+})
@@ -7,71 +7,680 @@ package cnimanager
 //+kubebuilder:rbac:groups=egressgateway.kubernetes.azure.com,resources=podendpoints,verbs=list;watch;create;update;patch;delete;
 //+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
 //+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
+//+kubebuilder:rbac:groups=egressgateway.kubernetes.azure.com,resources=gatewaystatuses,verbs=get;list;watch
 
 import (
 	"context"
+	"fmt"
+	"maps"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	current "github.com/Azure/kube-egress-gateway/api/v1alpha1"
 	cniprotocol "github.com/Azure/kube-egress-gateway/pkg/cniprotocol/v1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/tunnel"
 )
 
 type NicService struct {
 	k8sClient client.Client
+	// reads from the API server instead of the cache, e.g. to count pods of a gateway without lag
+	apiReader client.Reader
+	// whether pods connect to a gateway node in their own zone instead of the gateway ILB
+	preferSameZoneGateway bool
+	// whether pods running on a gateway node connect to the gateway daemon on the same node
+	preferLocalGateway bool
+	// picks the gateway node pods connect to, pods connect to the gateway ILB unless it or zone preference is set
+	peerPlacement PeerPlacementStrategy
+	// address of gateway wireguard interfaces, the next hop of pod routes
+	gatewayIP net.IP
 	cniprotocol.UnimplementedNicServiceServer
 }
 
 func NewNicService(k8sClient client.Client) *NicService {
-	return &NicService{k8sClient: k8sClient}
+	tunnelCidr, _ := tunnel.ParseCIDR(consts.DefaultTunnelCidr)
+	return &NicService{k8sClient: k8sClient, apiReader: k8sClient, gatewayIP: tunnel.GatewayIP(tunnelCidr).IP}
+}
+
+// WithAPIReader overrides how objects are read from the API server bypassing the cache
+func (s *NicService) WithAPIReader(apiReader client.Reader) *NicService {
+	s.apiReader = apiReader
+	return s
+}
+
+// WithPreferSameZoneGateway sets whether pods connect to a ready gateway node in their own zone instead of the
+// gateway ILB, so that their traffic does not cross zones before egressing
+func (s *NicService) WithPreferSameZoneGateway(preferSameZoneGateway bool) *NicService {
+	s.preferSameZoneGateway = preferSameZoneGateway
+	return s
+}
+
+// WithPreferLocalGateway sets whether pods running on a gateway node of their gateway connect to that node instead
+// of the gateway ILB, so that their traffic does not leave the node before egressing
+func (s *NicService) WithPreferLocalGateway(preferLocalGateway bool) *NicService {
+	s.preferLocalGateway = preferLocalGateway
+	return s
+}
+
+// WithTunnelCidr sets the subnet addressing the gateway side of pod tunnels, which must match the one of gateway
+// daemons, pods route traffic to the gateway wireguard interface address in it
+func (s *NicService) WithTunnelCidr(tunnelCidr *net.IPNet) *NicService {
+	s.gatewayIP = tunnel.GatewayIP(tunnelCidr).IP
+	return s
+}
+
+// WithPeerPlacementStrategy sets how pods are spread over the ready gateway nodes of their gateway. Pods connect to
+// a gateway node picked by strategy instead of the gateway ILB, restricted to their own zone when zone preference
+// is enabled and such nodes exist.
+func (s *NicService) WithPeerPlacementStrategy(strategy PeerPlacementStrategy) *NicService {
+	s.peerPlacement = strategy
+	return s
 }
 
 // NicAdd add nic
 
 func (s *NicService) NicAdd(ctx context.Context, in *cniprotocol.NicAddRequest) (*cniprotocol.NicAddResponse, error) {
-	gwConfig := &current.StaticGatewayConfiguration{}
-	if err := s.k8sClient.Get(ctx, client.ObjectKey{Name: in.GetGatewayName(), Namespace: in.GetPodConfig().GetPodNamespace()}, gwConfig); err != nil {
-		return nil, status.Errorf(codes.Unknown, "failed to retrieve StaticGatewayConfiguration %s/%s: %s", in.GetPodConfig().GetPodNamespace(), in.GetGatewayName(), err)
+	pod := &corev1.Pod{}
+	if err := s.k8sClient.Get(ctx, client.ObjectKey{Name: in.GetPodConfig().GetPodName(), Namespace: in.GetPodConfig().GetPodNamespace()}, pod); err != nil {
+		return nil, status.Errorf(codes.Unknown, "failed to retrieve pod %s/%s: %s", in.GetPodConfig().GetPodNamespace(), in.GetPodConfig().GetPodName(), err)
+	}
+	candidates := parseGatewayCandidates(in.GetGatewayName())
+	var gwConfig *current.StaticGatewayConfiguration
+	var err error
+	if len(candidates) > 1 {
+		gwConfig, err = s.selectGatewayConfiguration(ctx, candidates, pod)
+	} else {
+		gwConfig, err = s.getGatewayConfiguration(ctx, in.GetGatewayName(), pod)
+	}
+	if err != nil {
+		return nil, err
+	}
+	failback, err := getPodGatewayFailback(pod)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid gateway failback annotation on pod %s/%s: %s", in.GetPodConfig().GetPodNamespace(), in.GetPodConfig().GetPodName(), err)
 	}
 	if len(gwConfig.Status.Ip) == 0 {
 		return nil, status.Errorf(codes.FailedPrecondition, "the gateway is not ready yet.")
 	}
-	pod := &corev1.Pod{}
-	if err := s.k8sClient.Get(ctx, client.ObjectKey{Name: in.GetPodConfig().GetPodName(), Namespace: in.GetPodConfig().GetPodNamespace()}, pod); err != nil {
-		return nil, status.Errorf(codes.Unknown, "failed to retrieve pod %s/%s: %s", in.GetPodConfig().GetPodNamespace(), in.GetPodConfig().GetPodName(), err)
+	podKey := client.ObjectKeyFromObject(pod)
+	admitted, err := s.isPodAdmitted(ctx, gwConfig, podKey)
+	if err != nil {
+		return nil, status.Errorf(codes.Unknown, "failed to retrieve PodEndpoint %s: %s", podKey, err)
+	}
+	if !admitted {
+		if err := s.admitPod(ctx, gwConfig, podKey); err != nil {
+			return nil, err
+		}
+	}
+	rateLimitMbps, burstKB, err := getPodEgressRateLimit(pod)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid egress rate limit annotation on pod %s/%s: %s", in.GetPodConfig().GetPodNamespace(), in.GetPodConfig().GetPodName(), err)
+	}
+	dscp, err := getPodEgressDSCP(pod)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid egress dscp annotation on pod %s/%s: %s", in.GetPodConfig().GetPodNamespace(), in.GetPodConfig().GetPodName(), err)
 	}
+	tunnelConfig, err := getPodTunnelConfiguration(pod, gwConfig)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid tunnel ip versions annotation on pod %s/%s: %s", in.GetPodConfig().GetPodNamespace(), in.GetPodConfig().GetPodName(), err)
+	}
+	egressSourceIP, err := s.getPodEgressSourceIP(ctx, pod, gwConfig)
+	if err != nil {
+		return nil, err
+	}
+	endpointIP, err := s.getGatewayEndpointIP(ctx, pod, gwConfig)
+	if err != nil {
+		return nil, err
+	}
+	keepaliveSeconds, err := s.getPersistentKeepaliveSeconds(ctx, pod, gwConfig)
+	if err != nil {
+		return nil, err
+	}
+	defaultRoute, exceptionCidrs, includeCidrs := getPodRouteCidrs(tunnelConfig)
 	podEndpoint := &current.PodEndpoint{ObjectMeta: metav1.ObjectMeta{Name: in.GetPodConfig().GetPodName(), Namespace: in.GetPodConfig().GetPodNamespace()}}
 	if _, err := controllerutil.CreateOrUpdate(ctx, s.k8sClient, podEndpoint, func() error {
 		if err := controllerutil.SetControllerReference(pod, podEndpoint, s.k8sClient.Scheme()); err != nil {
 			return err
 		}
 		podEndpoint.Spec.PodIpAddress = in.GetAllowedIp()
-		podEndpoint.Spec.StaticGatewayConfiguration = in.GetGatewayName()
+		podEndpoint.Spec.PodIpv6Address = ""
+		if tunnelConfig.TunnelsIPVersion(current.IPv6) {
+			podEndpoint.Spec.PodIpv6Address = in.GetAllowedIpv6()
+		}
+		podEndpoint.Spec.StaticGatewayConfiguration = gatewayConfigurationRef(gwConfig, pod.Namespace)
 		podEndpoint.Spec.PodPublicKey = in.PublicKey
+		podEndpoint.Spec.GatewayPublicKey = gwConfig.Status.PublicKey
+		podEndpoint.Spec.EgressRateLimitMbps = rateLimitMbps
+		podEndpoint.Spec.EgressBurstKB = burstKB
+		podEndpoint.Spec.EgressDscp = dscp
+		podEndpoint.Spec.EgressSourceIp = egressSourceIP
+		podEndpoint.Spec.GatewayCandidates = nil
+		podEndpoint.Spec.Failback = false
+		if len(candidates) > 1 {
+			podEndpoint.Spec.GatewayCandidates = candidates
+			podEndpoint.Spec.Failback = failback
+		}
+		podEndpoint.Spec.PodNetnsPath = in.GetNetnsPath()
+		podEndpoint.Spec.GatewayEndpointIp = getGatewayNodeEndpointIP(gwConfig, endpointIP)
+		podEndpoint.Spec.ExceptionCidrs = exceptionCidrs
+		podEndpoint.Spec.IncludeCidrs = includeCidrs
+		podEndpoint.Spec.DefaultRoute = getRouteType(defaultRoute)
 		return nil
 	}); err != nil {
 		return nil, status.Errorf(codes.Unknown, "failed to update PodEndpoint %s/%s: %s", in.GetPodConfig().GetPodNamespace(), in.GetPodConfig().GetPodName(), err)
 	}
-
-	defaultRoute := cniprotocol.DefaultRoute_DEFAULT_ROUTE_STATIC_EGRESS_GATEWAY
-	if gwConfig.Spec.DefaultRoute == current.RouteAzureNetworking {
-		defaultRoute = cniprotocol.DefaultRoute_DEFAULT_ROUTE_AZURE_NETWORKING
+	if !admitted {
+		if err := s.confirmPodAdmission(ctx, gwConfig, podEndpoint); err != nil {
+			return nil, err
+		}
 	}
+
 	return &cniprotocol.NicAddResponse{
-		EndpointIp:     gwConfig.Status.Ip,
-		ListenPort:     gwConfig.Status.Port,
-		PublicKey:      gwConfig.Status.PublicKey,
-		ExceptionCidrs: gwConfig.Spec.ExcludeCidrs,
-		DefaultRoute:   defaultRoute,
+		EndpointIp:                 endpointIP,
+		ListenPort:                 gwConfig.Status.Port,
+		PublicKey:                  gwConfig.Status.PublicKey,
+		ExceptionCidrs:             exceptionCidrs,
+		IncludeCidrs:               includeCidrs,
+		DefaultRoute:               defaultRoute,
+		EnableIpv6:                 tunnelConfig.TunnelsIPVersion(current.IPv6) && gwConfig.Status.EgressIpv6Prefix != "",
+		Mtu:                        gwConfig.Spec.Mtu,
+		PersistentKeepaliveSeconds: keepaliveSeconds,
+		GatewayDns:                 gwConfig.Spec.GatewayDNS,
+		Ipv4ViaNode:                tunnelConfig.BypassesIPVersion(current.IPv4),
+		Ipv6ViaNode:                tunnelConfig.BypassesIPVersion(current.IPv6),
+		GatewayIp:                  s.gatewayIP.String(),
 	}, nil
 }
 
+// getPodRouteCidrs returns the pod default route of gwConfig, the destination CIDRs routed to the pod primary
+// interface and, when the default route is not the gateway, the destination CIDRs routed to the gateway.
+// CIDRs read from the exclude CIDRs ConfigMap are excluded along with excludeCidrs, and stay excluded when
+// excludeCidrs are routed to the gateway for lack of includeCidrs. PrivateCidrs are always routed to
+// the gateway, they do not overlap excludeCidrs. The peer endpoint IP, when set, is routed to the pod primary
+// interface so that tunnel traffic does not loop into the tunnel. CIDRs of IP versions left out of tunnelIPVersions
+// are dropped, the pod keeps its node path for them.
+func getPodRouteCidrs(gwConfig *current.StaticGatewayConfiguration) (cniprotocol.DefaultRoute, []string, []string) {
+	exceptionCidrs := slices.Concat(gwConfig.Spec.ExcludeCidrs, gwConfig.Status.ConfigMapExcludeCidrs, gwConfig.Status.ResolvedExcludeCidrs)
+	var endpointCidrs []string
+	if gwConfig.Spec.PeerEndpointIp != "" {
+		endpointCidrs = []string{gwConfig.Spec.PeerEndpointIp + "/32"}
+	}
+	if gwConfig.Spec.DefaultRoute != current.RouteAzureNetworking {
+		return cniprotocol.DefaultRoute_DEFAULT_ROUTE_STATIC_EGRESS_GATEWAY, filterTunneledCidrs(gwConfig, slices.Concat(exceptionCidrs, endpointCidrs)), nil
+	}
+	if len(gwConfig.Spec.IncludeCidrs) == 0 {
+		// gateways without includeCidrs route excludeCidrs to the gateway, CIDRs of the ConfigMap and addresses of
+		// excluded FQDNs stay excluded
+		return cniprotocol.DefaultRoute_DEFAULT_ROUTE_AZURE_NETWORKING,
+			filterTunneledCidrs(gwConfig, slices.Concat(gwConfig.Status.ConfigMapExcludeCidrs, gwConfig.Status.ResolvedExcludeCidrs)),
+			filterTunneledCidrs(gwConfig, slices.Concat(gwConfig.Spec.ExcludeCidrs, gwConfig.Spec.PrivateCidrs))
+	}
+	return cniprotocol.DefaultRoute_DEFAULT_ROUTE_AZURE_NETWORKING, filterTunneledCidrs(gwConfig, slices.Concat(exceptionCidrs, endpointCidrs)),
+		filterTunneledCidrs(gwConfig, slices.Concat(gwConfig.Spec.IncludeCidrs, gwConfig.Spec.PrivateCidrs))
+}
+
+// getRouteType returns the route type of the pod default route
+func getRouteType(defaultRoute cniprotocol.DefaultRoute) current.RouteType {
+	if defaultRoute == cniprotocol.DefaultRoute_DEFAULT_ROUTE_STATIC_EGRESS_GATEWAY {
+		return current.RouteStaticEgressGateway
+	}
+	return current.RouteAzureNetworking
+}
+
+// filterTunneledCidrs removes CIDRs of IP versions bypassing the gateway, returning cidrs as is when none does
+func filterTunneledCidrs(gwConfig *current.StaticGatewayConfiguration, cidrs []string) []string {
+	if !gwConfig.BypassesIPVersion(current.IPv4) && !gwConfig.BypassesIPVersion(current.IPv6) {
+		return cidrs
+	}
+	var filtered []string
+	for _, cidr := range cidrs {
+		version := current.IPv4
+		if prefix, err := netip.ParsePrefix(cidr); err == nil && !prefix.Addr().Is4() {
+			version = current.IPv6
+		}
+		if !gwConfig.BypassesIPVersion(version) {
+			filtered = append(filtered, cidr)
+		}
+	}
+	return filtered
+}
+
+// parseGatewayCandidates splits the gateway annotation into the prioritized list of gateways
+func parseGatewayCandidates(gwName string) []string {
+	var candidates []string
+	for _, candidate := range strings.Split(gwName, ",") {
+		if candidate = strings.TrimSpace(candidate); candidate != "" {
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates
+}
+
+// gatewayConfigurationRef returns how PodEndpoints of pods in podNamespace refer to the StaticGatewayConfiguration
+func gatewayConfigurationRef(gwConfig *current.StaticGatewayConfiguration, podNamespace string) string {
+	if gwConfig.Namespace != podNamespace {
+		return fmt.Sprintf("%s/%s", gwConfig.Namespace, gwConfig.Name)
+	}
+	return gwConfig.Name
+}
+
+// selectGatewayConfiguration returns the first healthy gateway in candidates, or the first one that can be
+// retrieved when none is healthy so that the pod still gets configured once the gateway becomes ready
+func (s *NicService) selectGatewayConfiguration(ctx context.Context, candidates []string, pod *corev1.Pod) (*current.StaticGatewayConfiguration, error) {
+	var fallback *current.StaticGatewayConfiguration
+	var firstErr error
+	for _, candidate := range candidates {
+		gwConfig, err := s.getGatewayConfiguration(ctx, candidate, pod)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		healthy, err := s.isGatewayHealthy(ctx, gwConfig)
+		if err != nil {
+			return nil, err
+		}
+		if healthy {
+			full, err := isGatewayFull(ctx, s.k8sClient, true, gwConfig, client.ObjectKeyFromObject(pod))
+			if err != nil {
+				return nil, status.Errorf(codes.Unknown, "failed to check capacity of gateway %s: %s", client.ObjectKeyFromObject(gwConfig), err)
+			}
+			if full {
+				// the pod is rejected if all healthy gateways are full
+				if fallback == nil {
+					fallback = gwConfig
+				}
+				continue
+			}
+			return gwConfig, nil
+		}
+		if fallback == nil {
+			fallback = gwConfig
+		}
+	}
+	if fallback != nil {
+		return fallback, nil
+	}
+	return nil, firstErr
+}
+
+// isGatewayHealthy returns whether the gateway is provisioned and at least one ready gateway node serves it
+func (s *NicService) isGatewayHealthy(ctx context.Context, gwConfig *current.StaticGatewayConfiguration) (bool, error) {
+	if gwConfig.Status.Ip == "" || gwConfig.Status.PublicKey == "" {
+		return false, nil
+	}
+	nodes, err := s.getReadyGatewayNodes(ctx, gwConfig)
+	if err != nil {
+		return false, err
+	}
+	return len(nodes) > 0, nil
+}
+
+// getPodGatewayFailback parses the gateway failback pod annotation, failback is disabled by default
+func getPodGatewayFailback(pod *corev1.Pod) (bool, error) {
+	annotation, ok := pod.GetAnnotations()[consts.CNIGatewayFailbackAnnotationKey]
+	if !ok {
+		return false, nil
+	}
+	failback, err := strconv.ParseBool(annotation)
+	if err != nil {
+		return false, fmt.Errorf("%s should be a boolean, got %q", consts.CNIGatewayFailbackAnnotationKey, annotation)
+	}
+	return failback, nil
+}
+
+// getPodGatewayDisabled returns whether the pod bypasses the egress gateway for debugging
+func getPodGatewayDisabled(pod *corev1.Pod) (bool, error) {
+	annotation, ok := pod.GetAnnotations()[consts.CNIGatewayDisabledAnnotationKey]
+	if !ok {
+		return false, nil
+	}
+	disabled, err := strconv.ParseBool(annotation)
+	if err != nil {
+		return false, fmt.Errorf("%s should be a boolean, got %q", consts.CNIGatewayDisabledAnnotationKey, annotation)
+	}
+	return disabled, nil
+}
+
+// getGatewayConfiguration returns the StaticGatewayConfiguration with the given name, which is in pod namespace
+// unless given as <namespace>/<name>, or the only one in pod namespace matching the label selector in pod
+// annotation when name is empty
+func (s *NicService) getGatewayConfiguration(ctx context.Context, gwName string, pod *corev1.Pod) (*current.StaticGatewayConfiguration, error) {
+	if gwName != "" {
+		gwConfigKey := client.ObjectKey{Name: gwName, Namespace: pod.Namespace}
+		if namespace, name, found := strings.Cut(gwName, "/"); found {
+			gwConfigKey = client.ObjectKey{Name: name, Namespace: namespace}
+		}
+		gwConfig := &current.StaticGatewayConfiguration{}
+		if err := s.k8sClient.Get(ctx, gwConfigKey, gwConfig); err != nil {
+			return nil, status.Errorf(codes.Unknown, "failed to retrieve StaticGatewayConfiguration %s: %s", gwConfigKey, err)
+		}
+		if !gwConfig.AllowsNamespace(pod.Namespace) {
+			return nil, status.Errorf(codes.PermissionDenied, "pods in namespace %s are not allowed to use StaticGatewayConfiguration %s, the namespace should be listed in its spec.allowedNamespaces", pod.Namespace, gwConfigKey)
+		}
+		return gwConfig, nil
+	}
+
+	selectorStr, ok := pod.GetAnnotations()[consts.CNIGatewaySelectorAnnotationKey]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "pod %s/%s has neither %s nor %s annotation", pod.Namespace, pod.Name, consts.CNIGatewayAnnotationKey, consts.CNIGatewaySelectorAnnotationKey)
+	}
+	selector, err := labels.Parse(selectorStr)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid gateway selector %q on pod %s/%s: %s", selectorStr, pod.Namespace, pod.Name, err)
+	}
+	if selector.Empty() {
+		return nil, status.Errorf(codes.InvalidArgument, "gateway selector on pod %s/%s should not be empty", pod.Namespace, pod.Name)
+	}
+
+	gwConfigList := &current.StaticGatewayConfigurationList{}
+	if err := s.k8sClient.List(ctx, gwConfigList, client.InNamespace(pod.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, status.Errorf(codes.Unknown, "failed to list StaticGatewayConfigurations in namespace %s: %s", pod.Namespace, err)
+	}
+	switch len(gwConfigList.Items) {
+	case 0:
+		return nil, status.Errorf(codes.NotFound, "no StaticGatewayConfiguration in namespace %s matches selector %q", pod.Namespace, selectorStr)
+	case 1:
+		return &gwConfigList.Items[0], nil
+	default:
+		names := make([]string, 0, len(gwConfigList.Items))
+		for _, gwConfig := range gwConfigList.Items {
+			names = append(names, gwConfig.Name)
+		}
+		slices.Sort(names)
+		return nil, status.Errorf(codes.FailedPrecondition, "multiple StaticGatewayConfigurations in namespace %s match selector %q: %v", pod.Namespace, selectorStr, names)
+	}
+}
+
+// getPodEgressRateLimit parses egress rate limit and burst size from pod annotations
+func getPodEgressRateLimit(pod *corev1.Pod) (int32, int32, error) {
+	var rateLimitMbps, burstKB int32
+	for key, value := range map[string]*int32{
+		consts.CNIEgressRateLimitAnnotationKey: &rateLimitMbps,
+		consts.CNIEgressBurstAnnotationKey:     &burstKB,
+	} {
+		annotation, ok := pod.GetAnnotations()[key]
+		if !ok {
+			continue
+		}
+		parsed, err := strconv.ParseInt(annotation, 10, 32)
+		if err != nil || parsed < 0 {
+			return 0, 0, fmt.Errorf("%s should be a non-negative integer, got %q", key, annotation)
+		}
+		*value = int32(parsed)
+	}
+	if rateLimitMbps > consts.MaxEgressRateLimitMbps {
+		return 0, 0, fmt.Errorf("%s should not exceed %d", consts.CNIEgressRateLimitAnnotationKey, consts.MaxEgressRateLimitMbps)
+	}
+	if burstKB > 0 && rateLimitMbps == 0 {
+		return 0, 0, fmt.Errorf("%s is set without %s", consts.CNIEgressBurstAnnotationKey, consts.CNIEgressRateLimitAnnotationKey)
+	}
+	return rateLimitMbps, burstKB, nil
+}
+
+// getPodEgressDSCP parses the DSCP value egress packets of the pod are marked with from pod annotation
+func getPodEgressDSCP(pod *corev1.Pod) (int32, error) {
+	annotation, ok := pod.GetAnnotations()[consts.CNIEgressDSCPAnnotationKey]
+	if !ok {
+		return 0, nil
+	}
+	dscp, err := strconv.ParseInt(annotation, 10, 32)
+	if err != nil || dscp < 0 || dscp > consts.MaxEgressDSCP {
+		return 0, fmt.Errorf("%s should be an integer between 0 and %d, got %q", consts.CNIEgressDSCPAnnotationKey, consts.MaxEgressDSCP, annotation)
+	}
+	return int32(dscp), nil
+}
+
+// getPodTunnelConfiguration returns gwConfig with tunnelIPVersions narrowed to the IP versions in the pod annotation,
+// or gwConfig itself when the pod is not annotated. Only IP versions tunneled by the gateway can be selected.
+func getPodTunnelConfiguration(pod *corev1.Pod, gwConfig *current.StaticGatewayConfiguration) (*current.StaticGatewayConfiguration, error) {
+	annotation, ok := pod.GetAnnotations()[consts.CNITunnelIPVersionsAnnotationKey]
+	if !ok {
+		return gwConfig, nil
+	}
+	var versions []current.IPVersion
+	for _, v := range strings.Split(annotation, ",") {
+		version := current.IPVersion(strings.TrimSpace(v))
+		if version != current.IPv4 && version != current.IPv6 {
+			return nil, fmt.Errorf("%s should be a comma separated list of %s and %s, got %q", consts.CNITunnelIPVersionsAnnotationKey, current.IPv4, current.IPv6, annotation)
+		}
+		if !gwConfig.TunnelsIPVersion(version) {
+			return nil, fmt.Errorf("gateway %s/%s does not tunnel %s traffic", gwConfig.Namespace, gwConfig.Name, version)
+		}
+		if !slices.Contains(versions, version) {
+			versions = append(versions, version)
+		}
+	}
+	tunnelConfig := gwConfig.DeepCopy()
+	tunnelConfig.Spec.TunnelIPVersions = versions
+	return tunnelConfig, nil
+}
+
+// getGatewayEndpointIP returns the IP the pod tunnel connects to, which is the gateway ILB frontend IP unless zone
+// preference or a peer placement strategy is enabled. With zone preference, pods connect to one of the ready
+// gateway nodes in the same zone as the pod's node, so that tunnel traffic stays in the zone. With a peer placement
+// strategy, pods connect to one of the ready gateway nodes, in the same zone when zone preference is enabled and
+// there are such nodes. The node is picked by the strategy, or by hashing the pod name without one. The peer
+// endpoint IP of the gateway takes precedence over both.
+func (s *NicService) getGatewayEndpointIP(ctx context.Context, pod *corev1.Pod, gwConfig *current.StaticGatewayConfiguration) (string, error) {
+	if gwConfig.Spec.PeerEndpointIp != "" {
+		return gwConfig.Spec.PeerEndpointIp, nil
+	}
+	if ip, ok := parseEgressSourceIP(pod); ok {
+		// only the gateway node the pinned public IP is associated with sNATs pod traffic to it
+		return s.getEgressSourceIPEndpointIP(ctx, gwConfig, ip.String())
+	}
+	if pod.Spec.NodeName == "" {
+		return gwConfig.Status.Ip, nil
+	}
+	if s.preferLocalGateway && slices.Contains(gwConfig.Status.GatewayNodes, pod.Spec.NodeName) {
+		nodes, err := s.getReadyGatewayNodes(ctx, gwConfig)
+		if err != nil {
+			return "", err
+		}
+		for _, node := range nodes {
+			if node.Name != pod.Spec.NodeName {
+				continue
+			}
+			if ip := getNodeInternalIP(node); ip != "" {
+				return ip, nil
+			}
+		}
+	}
+	if !s.preferSameZoneGateway && s.peerPlacement == nil {
+		return gwConfig.Status.Ip, nil
+	}
+	var zone string
+	if s.preferSameZoneGateway {
+		podNode := &corev1.Node{}
+		if err := s.k8sClient.Get(ctx, client.ObjectKey{Name: pod.Spec.NodeName}, podNode); err != nil {
+			return "", status.Errorf(codes.Unknown, "failed to retrieve node %s of pod %s/%s: %s", pod.Spec.NodeName, pod.Namespace, pod.Name, err)
+		}
+		zone = getNodeZone(podNode)
+		if zone == "" && s.peerPlacement == nil {
+			return gwConfig.Status.Ip, nil
+		}
+	}
+
+	nodes, err := s.getReadyGatewayNodes(ctx, gwConfig)
+	if err != nil {
+		return "", err
+	}
+	var candidates, zoneCandidates []string
+	for _, node := range nodes {
+		ip := getNodeInternalIP(node)
+		if ip == "" {
+			continue
+		}
+		candidates = append(candidates, ip)
+		if zone != "" && getNodeZone(node) == zone {
+			zoneCandidates = append(zoneCandidates, ip)
+		}
+	}
+	// without a placement strategy, pods only leave the gateway ILB for nodes in their zone
+	if zone != "" && (len(zoneCandidates) > 0 || s.peerPlacement == nil) {
+		candidates = zoneCandidates
+	}
+	if len(candidates) == 0 {
+		return gwConfig.Status.Ip, nil
+	}
+	// sort so that the same pod always picks the same node
+	slices.Sort(candidates)
+	placement := s.peerPlacement
+	if placement == nil {
+		placement = &HashPlacement{}
+	}
+	// only the least loaded strategy looks at peer counts, spare listing PodEndpoints for the others
+	var peerCounts map[string]int
+	if _, ok := placement.(*LeastLoadedPlacement); ok {
+		if peerCounts, err = s.getGatewayNodePeerCounts(ctx, gwConfig, pod); err != nil {
+			return "", err
+		}
+	}
+	return placement.Place(client.ObjectKeyFromObject(pod), client.ObjectKeyFromObject(gwConfig), candidates, peerCounts), nil
+}
+
+// getGatewayNodePeerCounts returns the number of pods other than pod connected to each gateway node of gwConfig,
+// keyed by the gateway node endpoint IP
+func (s *NicService) getGatewayNodePeerCounts(ctx context.Context, gwConfig *current.StaticGatewayConfiguration, pod *corev1.Pod) (map[string]int, error) {
+	gwConfigKey := client.ObjectKeyFromObject(gwConfig)
+	podEndpointList := &current.PodEndpointList{}
+	if err := s.k8sClient.List(ctx, podEndpointList, client.MatchingFields{PodEndpointGatewayIndex: gwConfigKey.String()}); err != nil {
+		return nil, status.Errorf(codes.Unknown, "failed to list PodEndpoints: %s", err)
+	}
+	peerCounts := make(map[string]int)
+	for _, podEndpoint := range podEndpointList.Items {
+		if podEndpoint.Spec.GatewayEndpointIp == "" || podEndpoint.GetStaticGatewayConfigurationKey() != gwConfigKey ||
+			(podEndpoint.Namespace == pod.Namespace && podEndpoint.Name == pod.Name) {
+			continue
+		}
+		peerCounts[podEndpoint.Spec.GatewayEndpointIp]++
+	}
+	return peerCounts, nil
+}
+
+// getGatewayNodeEndpointIP returns endpointIP if it is a gateway node, or empty string if it is the gateway
+// internal load balancer frontend or peer endpoint IP
+func getGatewayNodeEndpointIP(gwConfig *current.StaticGatewayConfiguration, endpointIP string) string {
+	if endpointIP == gwConfig.Status.Ip || endpointIP == gwConfig.Spec.PeerEndpointIp {
+		return ""
+	}
+	return endpointIP
+}
+
+// getReadyGatewayNodes returns the ready gateway nodes that are neither draining nor quarantined and have the
+// gateway configured
+func (s *NicService) getReadyGatewayNodes(ctx context.Context, gwConfig *current.StaticGatewayConfiguration) ([]*corev1.Node, error) {
+	return s.getReadyGatewayNodesWithPublicIP(ctx, gwConfig, "")
+}
+
+// getReadyGatewayNodesWithPublicIP returns the ready gateway nodes like getReadyGatewayNodes, restricted to the nodes
+// the public IP of gwConfig is associated with unless publicIP is empty
+func (s *NicService) getReadyGatewayNodesWithPublicIP(ctx context.Context, gwConfig *current.StaticGatewayConfiguration, publicIP string) ([]*corev1.Node, error) {
+	gwStatusList := &current.GatewayStatusList{}
+	if err := s.k8sClient.List(ctx, gwStatusList); err != nil {
+		return nil, status.Errorf(codes.Unknown, "failed to list GatewayStatuses: %s", err)
+	}
+	gwConfigKey := fmt.Sprintf("%s/%s", gwConfig.Namespace, gwConfig.Name)
+	var nodes []*corev1.Node
+	for _, gwStatus := range gwStatusList.Items {
+		if gwStatus.Spec.Draining || gwStatus.Spec.Quarantined || !slices.ContainsFunc(gwStatus.Spec.ReadyGatewayConfigurations, func(config current.GatewayConfiguration) bool {
+			return config.StaticGatewayConfiguration == gwConfigKey && (publicIP == "" || slices.Contains(config.PublicIps, publicIP))
+		}) {
+			continue
+		}
+		// GatewayStatus is named after the gateway node
+		node := &corev1.Node{}
+		if err := s.k8sClient.Get(ctx, client.ObjectKey{Name: gwStatus.Name}, node); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, status.Errorf(codes.Unknown, "failed to retrieve gateway node %s: %s", gwStatus.Name, err)
+		}
+		if isNodeReady(node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+// getPersistentKeepaliveSeconds returns the wireguard persistent keepalive interval of the pod peer. Without one set
+// by the gateway, pods on nodes with pod CIDRs, e.g. with kubenet or overlay networking, keep the mapping of the node
+// sNAT their tunnel traffic goes through alive, while other pods reach the gateway with their own IP and don't send
+// keepalives.
+func (s *NicService) getPersistentKeepaliveSeconds(ctx context.Context, pod *corev1.Pod, gwConfig *current.StaticGatewayConfiguration) (int32, error) {
+	if gwConfig.Spec.PersistentKeepaliveSeconds != nil {
+		return *gwConfig.Spec.PersistentKeepaliveSeconds, nil
+	}
+	if pod.Spec.NodeName == "" {
+		return 0, nil
+	}
+	node := &corev1.Node{}
+	if err := s.k8sClient.Get(ctx, client.ObjectKey{Name: pod.Spec.NodeName}, node); err != nil {
+		return 0, status.Errorf(codes.Unknown, "failed to retrieve node %s of pod %s/%s: %s", pod.Spec.NodeName, pod.Namespace, pod.Name, err)
+	}
+	if node.Spec.PodCIDR == "" && len(node.Spec.PodCIDRs) == 0 {
+		return 0, nil
+	}
+	return consts.DefaultNATPersistentKeepaliveSeconds, nil
+}
+
+// getNodeZone returns the availability zone of the node, or empty string if the node is not in any zone. Zonal azure
+// nodes are labeled with <region>-<zone>, which is reduced to the zone so that nodes labeled with the zone only match
+// them. Non-zonal azure nodes are labeled with their fault domain number instead, they are told apart from nodes
+// labeled with the zone only by the region label azure nodes have.
+func getNodeZone(node *corev1.Node) string {
+	zone := node.GetLabels()[corev1.LabelTopologyZone]
+	region := node.GetLabels()[corev1.LabelTopologyRegion]
+	if region == "" {
+		return zone
+	}
+	if zonePrefix := strings.ToLower(region) + "-"; strings.HasPrefix(strings.ToLower(zone), zonePrefix) {
+		return zone[len(zonePrefix):]
+	}
+	if _, err := strconv.Atoi(zone); err == nil {
+		// fault domain of a non-zonal azure node
+		return ""
+	}
+	return zone
+}
+
+func isNodeReady(node *corev1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func getNodeInternalIP(node *corev1.Node) string {
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == corev1.NodeInternalIP {
+			if ip, err := netip.ParseAddr(addr.Address); err == nil && ip.Is4() {
+				return addr.Address
+			}
+		}
+	}
+	return ""
+}
+
 func (s *NicService) NicDel(ctx context.Context, in *cniprotocol.NicDelRequest) (*cniprotocol.NicDelResponse, error) {
 	podEndpoint := &current.PodEndpoint{ObjectMeta: metav1.ObjectMeta{Name: in.GetPodConfig().GetPodName(), Namespace: in.GetPodConfig().GetPodNamespace()}}
 	if err := s.k8sClient.Delete(ctx, podEndpoint); err != nil {
@@ -87,7 +696,74 @@ func (s *NicService) PodRetrieve(ctx context.Context, in *cniprotocol.PodRetriev
 	if err := s.k8sClient.Get(ctx, client.ObjectKey{Name: in.GetPodConfig().GetPodName(), Namespace: in.GetPodConfig().GetPodNamespace()}, pod); err != nil {
 		return nil, status.Errorf(codes.Unknown, "failed to retrieve pod %s/%s: %s", in.GetPodConfig().GetPodNamespace(), in.GetPodConfig().GetPodName(), err)
 	}
+	annotations, err := s.getPodGatewayAnnotations(ctx, pod)
+	if err != nil {
+		return nil, err
+	}
 	return &cniprotocol.PodRetrieveResponse{
-		Annotations: pod.ObjectMeta.GetAnnotations(),
+		Annotations: annotations,
 	}, nil
 }
+
+// getPodGatewayAnnotations returns pod annotations with the effective gateway: the gateway or selector in pod
+// annotations takes precedence, then the gateway of pod ServiceAccount, then the default gateway of pod namespace.
+// An empty gateway annotation without selector on the pod or its ServiceAccount opts the pod out and is dropped,
+// so that the pod is not configured with any gateway. The gateway disabled annotation on the pod overrides all of
+// them and drops the gateway and selector annotations.
+func (s *NicService) getPodGatewayAnnotations(ctx context.Context, pod *corev1.Pod) (map[string]string, error) {
+	annotations := pod.GetAnnotations()
+	disabled, err := getPodGatewayDisabled(pod)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid gateway disabled annotation on pod %s/%s: %s", pod.Namespace, pod.Name, err)
+	}
+	if disabled {
+		annotations = maps.Clone(annotations)
+		delete(annotations, consts.CNIGatewayAnnotationKey)
+		delete(annotations, consts.CNIGatewaySelectorAnnotationKey)
+		return annotations, nil
+	}
+	gwName, hasName := annotations[consts.CNIGatewayAnnotationKey]
+	if _, hasSelector := annotations[consts.CNIGatewaySelectorAnnotationKey]; hasSelector || gwName != "" {
+		return annotations, nil
+	}
+	if hasName {
+		annotations = maps.Clone(annotations)
+		delete(annotations, consts.CNIGatewayAnnotationKey)
+		return annotations, nil
+	}
+
+	serviceAccountName := pod.Spec.ServiceAccountName
+	if serviceAccountName == "" {
+		serviceAccountName = "default"
+	}
+	serviceAccount := &corev1.ServiceAccount{}
+	if err := s.k8sClient.Get(ctx, client.ObjectKey{Name: serviceAccountName, Namespace: pod.Namespace}, serviceAccount); client.IgnoreNotFound(err) != nil {
+		return nil, status.Errorf(codes.Unknown, "failed to retrieve service account %s/%s: %s", pod.Namespace, serviceAccountName, err)
+	}
+	if gwName, hasName := serviceAccount.GetAnnotations()[consts.ServiceAccountGatewayAnnotationKey]; hasName {
+		if gwName != "" {
+			annotations = maps.Clone(annotations)
+			if annotations == nil {
+				annotations = make(map[string]string)
+			}
+			annotations[consts.CNIGatewayAnnotationKey] = gwName
+		}
+		return annotations, nil
+	}
+
+	namespace := &corev1.Namespace{}
+	if err := s.k8sClient.Get(ctx, client.ObjectKey{Name: pod.Namespace}, namespace); err != nil {
+		if apierrors.IsNotFound(err) {
+			return annotations, nil
+		}
+		return nil, status.Errorf(codes.Unknown, "failed to retrieve namespace %s: %s", pod.Namespace, err)
+	}
+	if defaultGateway := namespace.GetAnnotations()[consts.NamespaceDefaultGatewayAnnotationKey]; defaultGateway != "" {
+		annotations = maps.Clone(annotations)
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[consts.CNIGatewayAnnotationKey] = defaultGateway
+	}
+	return annotations, nil
+}
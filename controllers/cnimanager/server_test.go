@@ -4,10 +4,15 @@ package cnimanager_test
 
 import (
 	"context"
+	"net"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	coordinationv1 "k8s.io/api/coordination/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -18,6 +23,8 @@ import (
 	current "github.com/Azure/kube-egress-gateway/api/v1alpha1"
 	"github.com/Azure/kube-egress-gateway/controllers/cnimanager"
 	cniprotocol "github.com/Azure/kube-egress-gateway/pkg/cniprotocol/v1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
 )
 
 var _ = Describe("Server", func() {
@@ -74,6 +81,7 @@ var _ = Describe("Server", func() {
 			PodConfig: nicAddInputRequest.PodConfig,
 		}
 		fakeClientBuilder.WithRuntimeObjects(gatewayProfile, pod)
+		fakeClientBuilder.WithIndex(&current.PodEndpoint{}, cnimanager.PodEndpointGatewayIndex, cnimanager.PodEndpointGatewayIndexFunc)
 		fakeClient = fakeClientBuilder.Build()
 		service = cnimanager.NewNicService(fakeClient)
 	})
@@ -135,7 +143,855 @@ var _ = Describe("Server", func() {
 				Expect(err).NotTo(HaveOccurred())
 				Expect(resp.DefaultRoute).To(Equal(cniprotocol.DefaultRoute_DEFAULT_ROUTE_AZURE_NETWORKING))
 			})
+
+			It("should return includeCidrs to route to gateway and excludeCidrs as exceptions", func() {
+				gatewayProfile.Spec.DefaultRoute = current.RouteAzureNetworking
+				gatewayProfile.Spec.IncludeCidrs = []string{"20.0.0.0/8"}
+				gatewayProfile.Spec.ExcludeCidrs = []string{"20.1.0.0/16"}
+				fakeClient.Update(context.Background(), gatewayProfile) //nolint:errcheck
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.IncludeCidrs).To(Equal([]string{"20.0.0.0/8"}))
+				Expect(resp.ExceptionCidrs).To(Equal([]string{"20.1.0.0/16"}))
+				podEndpoint := &current.PodEndpoint{}
+				Expect(fakeClient.Get(context.Background(), client.ObjectKey{Name: "test", Namespace: "default"}, podEndpoint)).To(Succeed())
+				Expect(podEndpoint.Spec.IncludeCidrs).To(Equal([]string{"20.0.0.0/8"}))
+				Expect(podEndpoint.Spec.ExceptionCidrs).To(Equal([]string{"20.1.0.0/16"}))
+			})
+
+			It("should route excludeCidrs to gateway when includeCidrs is empty", func() {
+				gatewayProfile.Spec.DefaultRoute = current.RouteAzureNetworking
+				gatewayProfile.Spec.ExcludeCidrs = []string{"20.1.0.0/16"}
+				fakeClient.Update(context.Background(), gatewayProfile) //nolint:errcheck
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.IncludeCidrs).To(Equal([]string{"20.1.0.0/16"}))
+				Expect(resp.ExceptionCidrs).To(BeEmpty())
+			})
+
+			It("should keep resolved excluded FQDNs as exceptions when includeCidrs is empty", func() {
+				gatewayProfile.Spec.DefaultRoute = current.RouteAzureNetworking
+				gatewayProfile.Spec.ExcludeCidrs = []string{"20.1.0.0/16"}
+				gatewayProfile.Spec.ExcludeFQDNs = []string{"a.example.com"}
+				gatewayProfile.Status.ResolvedExcludeCidrs = []string{"20.1.2.3/32", "1.2.3.4/32"}
+				fakeClient.Update(context.Background(), gatewayProfile) //nolint:errcheck
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.IncludeCidrs).To(Equal([]string{"20.1.0.0/16"}))
+				Expect(resp.ExceptionCidrs).To(Equal([]string{"20.1.2.3/32", "1.2.3.4/32"}))
+				podEndpoint := &current.PodEndpoint{}
+				Expect(fakeClient.Get(context.Background(), client.ObjectKey{Name: "test", Namespace: "default"}, podEndpoint)).To(Succeed())
+				Expect(podEndpoint.Spec.IncludeCidrs).To(Equal([]string{"20.1.0.0/16"}))
+				Expect(podEndpoint.Spec.ExceptionCidrs).To(Equal([]string{"20.1.2.3/32", "1.2.3.4/32"}))
+			})
+
+			It("should keep ConfigMap CIDRs as exceptions when includeCidrs is empty", func() {
+				gatewayProfile.Spec.DefaultRoute = current.RouteAzureNetworking
+				gatewayProfile.Spec.ExcludeCidrs = []string{"20.1.0.0/16"}
+				gatewayProfile.Status.ConfigMapExcludeCidrs = []string{"20.1.2.0/24"}
+				gatewayProfile.Status.ResolvedExcludeCidrs = []string{"20.1.3.4/32"}
+				fakeClient.Update(context.Background(), gatewayProfile) //nolint:errcheck
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.IncludeCidrs).To(Equal([]string{"20.1.0.0/16"}))
+				Expect(resp.ExceptionCidrs).To(Equal([]string{"20.1.2.0/24", "20.1.3.4/32"}))
+			})
+
+			It("should route privateCidrs to gateway along with includeCidrs", func() {
+				gatewayProfile.Spec.DefaultRoute = current.RouteAzureNetworking
+				gatewayProfile.Spec.IncludeCidrs = []string{"20.0.0.0/8"}
+				gatewayProfile.Spec.PrivateCidrs = []string{"10.2.0.0/24"}
+				fakeClient.Update(context.Background(), gatewayProfile) //nolint:errcheck
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.IncludeCidrs).To(Equal([]string{"20.0.0.0/8", "10.2.0.0/24"}))
+			})
+		})
+		When("gateway has resolved excluded FQDNs", func() {
+			It("should return both static and resolved CIDRs as exceptions", func() {
+				gatewayProfile.Spec.ExcludeCidrs = []string{"10.0.0.0/16"}
+				gatewayProfile.Status.ResolvedExcludeCidrs = []string{"1.2.3.4/32"}
+				fakeClient.Update(context.Background(), gatewayProfile) //nolint:errcheck
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.ExceptionCidrs).To(Equal([]string{"10.0.0.0/16", "1.2.3.4/32"}))
+			})
+		})
+		When("gateway has CIDRs from exclude CIDRs ConfigMap", func() {
+			It("should return both inline and ConfigMap CIDRs as exceptions", func() {
+				gatewayProfile.Spec.ExcludeCidrs = []string{"10.0.0.0/16"}
+				gatewayProfile.Status.ConfigMapExcludeCidrs = []string{"172.16.0.0/12", "192.168.0.0/16"}
+				fakeClient.Update(context.Background(), gatewayProfile) //nolint:errcheck
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.ExceptionCidrs).To(Equal([]string{"10.0.0.0/16", "172.16.0.0/12", "192.168.0.0/16"}))
+			})
+		})
+		When("gateway has ipv6 egress enabled", func() {
+			It("should record pod ipv6 address and enable ipv6 in response", func() {
+				gatewayProfile.Spec.EnableIPv6 = true
+				gatewayProfile.Status.EgressIpv6Prefix = "2001:db8::/124"
+				fakeClient.Update(context.Background(), gatewayProfile) //nolint:errcheck
+				nicAddInputRequest.AllowedIpv6 = "2001:db8:1::10/128"
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.EnableIpv6).To(BeTrue())
+				podEndpoint := &current.PodEndpoint{}
+				err = fakeClient.Get(context.Background(), client.ObjectKey{
+					Name:      nicAddInputRequest.PodConfig.PodName,
+					Namespace: nicAddInputRequest.PodConfig.PodNamespace,
+				}, podEndpoint)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(podEndpoint.Spec.PodIpv6Address).To(Equal(nicAddInputRequest.AllowedIpv6))
+			})
+		})
+		When("gateway only tunnels some ip versions", func() {
+			BeforeEach(func() {
+				gatewayProfile.Spec.EnableIPv6 = true
+				gatewayProfile.Status.EgressIpv6Prefix = "2001:db8::/124"
+				gatewayProfile.Spec.ExcludeCidrs = []string{"10.0.0.0/16", "fd00::/64"}
+				nicAddInputRequest.AllowedIpv6 = "2001:db8:1::10/128"
+			})
+			It("should keep ipv6 traffic on node path when only ipv4 is tunneled", func() {
+				gatewayProfile.Spec.TunnelIPVersions = []current.IPVersion{current.IPv4}
+				fakeClient.Update(context.Background(), gatewayProfile) //nolint:errcheck
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.EnableIpv6).To(BeFalse())
+				Expect(resp.Ipv4ViaNode).To(BeFalse())
+				Expect(resp.Ipv6ViaNode).To(BeTrue())
+				Expect(resp.ExceptionCidrs).To(Equal([]string{"10.0.0.0/16"}))
+				podEndpoint := &current.PodEndpoint{}
+				err = fakeClient.Get(context.Background(), client.ObjectKey{
+					Name:      nicAddInputRequest.PodConfig.PodName,
+					Namespace: nicAddInputRequest.PodConfig.PodNamespace,
+				}, podEndpoint)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(podEndpoint.Spec.PodIpv6Address).To(BeEmpty())
+			})
+			It("should narrow tunneled ip versions by pod annotation", func() {
+				fakeClient.Update(context.Background(), gatewayProfile) //nolint:errcheck
+				pod.Annotations[consts.CNITunnelIPVersionsAnnotationKey] = "IPv6"
+				fakeClient.Update(context.Background(), pod) //nolint:errcheck
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.EnableIpv6).To(BeTrue())
+				Expect(resp.Ipv4ViaNode).To(BeTrue())
+				Expect(resp.Ipv6ViaNode).To(BeFalse())
+				Expect(resp.ExceptionCidrs).To(Equal([]string{"fd00::/64"}))
+			})
+			DescribeTable("should return invalid argument error for invalid tunnel ip versions", func(value string) {
+				gatewayProfile.Spec.TunnelIPVersions = []current.IPVersion{current.IPv4}
+				fakeClient.Update(context.Background(), gatewayProfile) //nolint:errcheck
+				pod.Annotations[consts.CNITunnelIPVersionsAnnotationKey] = value
+				fakeClient.Update(context.Background(), pod) //nolint:errcheck
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			},
+				Entry("unknown ip version", "IPv5"),
+				Entry("ip version not tunneled by gateway", "IPv4,IPv6"),
+			)
+		})
+		When("gateway has custom mtu", func() {
+			It("should return mtu in response", func() {
+				gatewayProfile.Spec.Mtu = 1380
+				fakeClient.Update(context.Background(), gatewayProfile) //nolint:errcheck
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.Mtu).To(Equal(int32(1380)))
+			})
+		})
+		When("gateway has persistent keepalive", func() {
+			It("should return keepalive interval in response", func() {
+				gatewayProfile.Spec.PersistentKeepaliveSeconds = to.Ptr(int32(25))
+				fakeClient.Update(context.Background(), gatewayProfile) //nolint:errcheck
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.PersistentKeepaliveSeconds).To(Equal(int32(25)))
+			})
 		})
+		When("gateway does not set persistent keepalive", func() {
+			BeforeEach(func() {
+				pod.Spec.NodeName = "node1"
+				Expect(fakeClient.Update(context.Background(), pod)).To(Succeed())
+			})
+			It("should return default keepalive interval for pods behind node sNAT", func() {
+				Expect(fakeClient.Create(context.Background(), &corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+					Spec:       corev1.NodeSpec{PodCIDR: "10.244.0.0/24", PodCIDRs: []string{"10.244.0.0/24"}},
+				})).To(Succeed())
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.PersistentKeepaliveSeconds).To(Equal(consts.DefaultNATPersistentKeepaliveSeconds))
+			})
+			It("should disable keepalive for pods with virtual network IPs", func() {
+				Expect(fakeClient.Create(context.Background(), &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})).To(Succeed())
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.PersistentKeepaliveSeconds).To(BeZero())
+			})
+			It("should keep keepalive disabled when the gateway disables it", func() {
+				Expect(fakeClient.Create(context.Background(), &corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+					Spec:       corev1.NodeSpec{PodCIDR: "10.244.0.0/24"},
+				})).To(Succeed())
+				gatewayProfile.Spec.PersistentKeepaliveSeconds = to.Ptr(int32(0))
+				Expect(fakeClient.Update(context.Background(), gatewayProfile)).To(Succeed())
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.PersistentKeepaliveSeconds).To(BeZero())
+			})
+		})
+		When("tunnel cidr is moved", func() {
+			It("should return the gateway tunnel address in response", func() {
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.GatewayIp).To(Equal("fe80::1"))
+				_, tunnelCidr, _ := net.ParseCIDR("fe80:0:0:ffff::/64")
+				resp, err = service.WithTunnelCidr(tunnelCidr).NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.GatewayIp).To(Equal("fe80:0:0:ffff::1"))
+			})
+		})
+		When("gateway has dns server", func() {
+			It("should return dns server in response", func() {
+				gatewayProfile.Spec.GatewayDNS = "10.1.0.53"
+				fakeClient.Update(context.Background(), gatewayProfile) //nolint:errcheck
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.GatewayDns).To(Equal("10.1.0.53"))
+			})
+		})
+		When("gateway has peer endpoint ip", func() {
+			It("should connect to the peer endpoint ip and route it outside the tunnel", func() {
+				gatewayProfile.Spec.PeerEndpointIp = "10.100.0.4"
+				Expect(fakeClient.Update(context.Background(), gatewayProfile)).To(Succeed())
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.EndpointIp).To(Equal("10.100.0.4"))
+				Expect(resp.ExceptionCidrs).To(ContainElement("10.100.0.4/32"))
+				podEndpoint := &current.PodEndpoint{}
+				Expect(fakeClient.Get(context.Background(), client.ObjectKey{Name: "test", Namespace: "default"}, podEndpoint)).To(Succeed())
+				Expect(podEndpoint.Spec.GatewayEndpointIp).To(BeEmpty())
+			})
+		})
+		When("gateway has maxPods", func() {
+			var other *current.PodEndpoint
+			BeforeEach(func() {
+				gatewayProfile.Spec.MaxPods = 1
+				Expect(fakeClient.Update(context.Background(), gatewayProfile)).To(Succeed())
+				other = &current.PodEndpoint{
+					ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"},
+					Spec:       current.PodEndpointSpec{StaticGatewayConfiguration: gatewayProfile.Name},
+				}
+			})
+			It("should return resource exhausted error and don't create pod endpoint when gateway is full", func() {
+				Expect(fakeClient.Create(context.Background(), other)).To(Succeed())
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+				Expect(err.Error()).To(ContainSubstring("default/tgw1 is full"))
+				err = fakeClient.Get(context.Background(), client.ObjectKey{Name: "test", Namespace: "default"}, &current.PodEndpoint{})
+				Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			})
+			It("should admit pod again when it already uses the full gateway", func() {
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				_, err = service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+			})
+			It("should admit pod when other pods left the gateway", func() {
+				Expect(fakeClient.Create(context.Background(), other)).To(Succeed())
+				Expect(fakeClient.Delete(context.Background(), other)).To(Succeed())
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+			})
+			It("should release pod endpoint when a concurrently admitted pod filled the gateway", func() {
+				// the cache has not seen the pod endpoint created on another node yet
+				apiReader := fake.NewClientBuilder().WithScheme(fakeClient.Scheme()).WithRuntimeObjects(other).Build()
+				service.WithAPIReader(apiReader)
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+				err = fakeClient.Get(context.Background(), client.ObjectKey{Name: "test", Namespace: "default"}, &current.PodEndpoint{})
+				Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			})
+			It("should count pods of allowed namespaces when confirming admission", func() {
+				gatewayProfile.Spec.AllowedNamespaces = []string{"team"}
+				Expect(fakeClient.Update(context.Background(), gatewayProfile)).To(Succeed())
+				other.Namespace = "team"
+				other.Spec.StaticGatewayConfiguration = "default/" + gatewayProfile.Name
+				denied := &current.PodEndpoint{
+					ObjectMeta: metav1.ObjectMeta{Name: "denied", Namespace: "other"},
+					Spec:       current.PodEndpointSpec{StaticGatewayConfiguration: "default/" + gatewayProfile.Name},
+				}
+				apiReader := fake.NewClientBuilder().WithScheme(fakeClient.Scheme()).WithRuntimeObjects(denied).Build()
+				service.WithAPIReader(apiReader)
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(apiReader.Create(context.Background(), other)).To(Succeed())
+				nicAddInputRequest.PodConfig.PodName = "test2"
+				pod2 := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test2", Namespace: "default"}}
+				Expect(fakeClient.Create(context.Background(), pod2)).To(Succeed())
+				_, err = service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+			})
+		})
+		When("pod has egress rate limit annotations", func() {
+			It("should record rate limit in pod endpoint", func() {
+				pod.Annotations[consts.CNIEgressRateLimitAnnotationKey] = "100"
+				pod.Annotations[consts.CNIEgressBurstAnnotationKey] = "256"
+				fakeClient.Update(context.Background(), pod) //nolint:errcheck
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				podEndpoint := &current.PodEndpoint{}
+				err = fakeClient.Get(context.Background(), client.ObjectKey{
+					Name:      nicAddInputRequest.PodConfig.PodName,
+					Namespace: nicAddInputRequest.PodConfig.PodNamespace,
+				}, podEndpoint)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(podEndpoint.Spec.EgressRateLimitMbps).To(Equal(int32(100)))
+				Expect(podEndpoint.Spec.EgressBurstKB).To(Equal(int32(256)))
+			})
+		})
+		When("pod has invalid egress rate limit annotations", func() {
+			DescribeTable("should return invalid argument error and don't create pod endpoint", func(annotations map[string]string) {
+				for k, v := range annotations {
+					pod.Annotations[k] = v
+				}
+				fakeClient.Update(context.Background(), pod) //nolint:errcheck
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+				podEndpoint := &current.PodEndpoint{}
+				err = fakeClient.Get(context.Background(), client.ObjectKey{
+					Name:      nicAddInputRequest.PodConfig.PodName,
+					Namespace: nicAddInputRequest.PodConfig.PodNamespace,
+				}, podEndpoint)
+				Expect(err).To(HaveOccurred())
+			},
+				Entry("non-numeric rate", map[string]string{consts.CNIEgressRateLimitAnnotationKey: "fast"}),
+				Entry("negative rate", map[string]string{consts.CNIEgressRateLimitAnnotationKey: "-1"}),
+				Entry("rate above maximum", map[string]string{consts.CNIEgressRateLimitAnnotationKey: "32001"}),
+				Entry("burst without rate", map[string]string{consts.CNIEgressBurstAnnotationKey: "256"}),
+			)
+		})
+		When("pod has egress dscp annotation", func() {
+			It("should record dscp in pod endpoint", func() {
+				pod.Annotations[consts.CNIEgressDSCPAnnotationKey] = "46"
+				fakeClient.Update(context.Background(), pod) //nolint:errcheck
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				podEndpoint := &current.PodEndpoint{}
+				err = fakeClient.Get(context.Background(), client.ObjectKey{
+					Name:      nicAddInputRequest.PodConfig.PodName,
+					Namespace: nicAddInputRequest.PodConfig.PodNamespace,
+				}, podEndpoint)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(podEndpoint.Spec.EgressDscp).To(Equal(int32(46)))
+			})
+			DescribeTable("should return invalid argument error for invalid dscp", func(value string) {
+				pod.Annotations[consts.CNIEgressDSCPAnnotationKey] = value
+				fakeClient.Update(context.Background(), pod) //nolint:errcheck
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			},
+				Entry("non-numeric dscp", "EF"),
+				Entry("negative dscp", "-1"),
+				Entry("dscp above maximum", "64"),
+			)
+		})
+		When("pod has egress source IP annotation", func() {
+			newGatewayNode := func(name, ip string, publicIPs ...string) []client.Object {
+				return []client.Object{
+					&corev1.Node{
+						ObjectMeta: metav1.ObjectMeta{Name: name},
+						Status: corev1.NodeStatus{
+							Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+							Addresses:  []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: ip}},
+						},
+					},
+					&current.GatewayStatus{
+						ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "kube-egress-gateway-system"},
+						Spec: current.GatewayStatusSpec{
+							ReadyGatewayConfigurations: []current.GatewayConfiguration{{StaticGatewayConfiguration: "default/tgw1", InterfaceName: "wg-6000", PublicIps: publicIPs}},
+						},
+					},
+				}
+			}
+			newPinnedPod := func(name string) *corev1.Pod {
+				return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+					Name:        name,
+					Namespace:   "default",
+					Annotations: map[string]string{consts.CNIEgressSourceIPAnnotationKey: "1.2.3.5"},
+				}}
+			}
+			getPodEndpoint := func() *current.PodEndpoint {
+				podEndpoint := &current.PodEndpoint{}
+				Expect(fakeClient.Get(context.Background(), client.ObjectKey{
+					Name:      nicAddInputRequest.PodConfig.PodName,
+					Namespace: nicAddInputRequest.PodConfig.PodNamespace,
+				}, podEndpoint)).To(Succeed())
+				return podEndpoint
+			}
+			BeforeEach(func() {
+				gatewayProfile.Status.EgressIpPrefix = "1.2.3.4/31"
+				fakeClient.Update(context.Background(), gatewayProfile) //nolint:errcheck
+				objects := append(newGatewayNode("gw1", "10.1.0.4", "1.2.3.4"), newGatewayNode("gw2", "10.1.0.5", "1.2.3.5")...)
+				for _, obj := range objects {
+					Expect(fakeClient.Create(context.Background(), obj)).To(Succeed())
+				}
+			})
+			It("should record egress source IP in pod endpoint and connect to the gateway node owning it", func() {
+				pod.Annotations[consts.CNIEgressSourceIPAnnotationKey] = "1.2.3.5"
+				fakeClient.Update(context.Background(), pod) //nolint:errcheck
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.EndpointIp).To(Equal("10.1.0.5"))
+				podEndpoint := getPodEndpoint()
+				Expect(podEndpoint.Spec.EgressSourceIp).To(Equal("1.2.3.5"))
+				Expect(podEndpoint.Spec.GatewayEndpointIp).To(Equal("10.1.0.5"))
+
+				// the pod keeps its reservation when added again
+				_, err = service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+			})
+			It("should return unavailable error when no ready gateway node owns egress source IP", func() {
+				node := &corev1.Node{}
+				Expect(fakeClient.Get(context.Background(), client.ObjectKey{Name: "gw2"}, node)).To(Succeed())
+				node.Status.Conditions[0].Status = corev1.ConditionFalse
+				Expect(fakeClient.Status().Update(context.Background(), node)).To(Succeed())
+				pod.Annotations[consts.CNIEgressSourceIPAnnotationKey] = "1.2.3.5"
+				fakeClient.Update(context.Background(), pod) //nolint:errcheck
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(status.Code(err)).To(Equal(codes.Unavailable))
+			})
+			DescribeTable("should return invalid argument error", func(ip string) {
+				pod.Annotations[consts.CNIEgressSourceIPAnnotationKey] = ip
+				fakeClient.Update(context.Background(), pod) //nolint:errcheck
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			},
+				Entry("invalid IP", "1.2.3"),
+				Entry("IPv6", "2001:db8::1"),
+				Entry("IP not in egress prefix", "1.2.3.6"),
+			)
+			It("should return failed precondition error when gateway egresses through NAT gateway", func() {
+				gatewayProfile.Status.OutboundType = current.OutboundNatGateway
+				fakeClient.Update(context.Background(), gatewayProfile) //nolint:errcheck
+				pod.Annotations[consts.CNIEgressSourceIPAnnotationKey] = "1.2.3.5"
+				fakeClient.Update(context.Background(), pod) //nolint:errcheck
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+			})
+			It("should return failed precondition error when gateway has peer endpoint IP", func() {
+				gatewayProfile.Spec.PeerEndpointIp = "10.2.0.4"
+				fakeClient.Update(context.Background(), gatewayProfile) //nolint:errcheck
+				pod.Annotations[consts.CNIEgressSourceIPAnnotationKey] = "1.2.3.5"
+				fakeClient.Update(context.Background(), pod) //nolint:errcheck
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+			})
+			It("should return already exists error when egress source IP is pinned to another pod", func() {
+				other := newPinnedPod("other")
+				Expect(fakeClient.Create(context.Background(), other)).To(Succeed())
+				otherRequest := &cniprotocol.NicAddRequest{
+					PodConfig:   &cniprotocol.PodInfo{PodName: "other", PodNamespace: "default"},
+					AllowedIp:   "192.168.1.11/32",
+					PublicKey:   "OTHERPUBLICKEY",
+					GatewayName: gatewayProfile.Name,
+				}
+				_, err := service.NicAdd(context.Background(), otherRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				pod.Annotations[consts.CNIEgressSourceIPAnnotationKey] = "1.2.3.5"
+				fakeClient.Update(context.Background(), pod) //nolint:errcheck
+				_, err = service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(status.Code(err)).To(Equal(codes.AlreadyExists))
+			})
+			It("should return already exists error when egress source IP is reserved by a pod being added", func() {
+				// the other pod reserved the IP and has no PodEndpoint yet
+				Expect(fakeClient.Create(context.Background(), newPinnedPod("other"))).To(Succeed())
+				holder := "default/other"
+				Expect(fakeClient.Create(context.Background(), &coordinationv1.Lease{
+					ObjectMeta: metav1.ObjectMeta{Name: "egress-source-ip.default.tgw1.1.2.3.5"},
+					Spec:       coordinationv1.LeaseSpec{HolderIdentity: &holder},
+				})).To(Succeed())
+				pod.Annotations[consts.CNIEgressSourceIPAnnotationKey] = "1.2.3.5"
+				fakeClient.Update(context.Background(), pod) //nolint:errcheck
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(status.Code(err)).To(Equal(codes.AlreadyExists))
+			})
+			It("should take over egress source IP of deleted pod", func() {
+				holder := "default/deleted"
+				Expect(fakeClient.Create(context.Background(), &coordinationv1.Lease{
+					ObjectMeta: metav1.ObjectMeta{Name: "egress-source-ip.default.tgw1.1.2.3.5"},
+					Spec:       coordinationv1.LeaseSpec{HolderIdentity: &holder},
+				})).To(Succeed())
+				pod.Annotations[consts.CNIEgressSourceIPAnnotationKey] = "1.2.3.5"
+				fakeClient.Update(context.Background(), pod) //nolint:errcheck
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				lease := &coordinationv1.Lease{}
+				Expect(fakeClient.Get(context.Background(), client.ObjectKey{Name: "egress-source-ip.default.tgw1.1.2.3.5"}, lease)).To(Succeed())
+				Expect(*lease.Spec.HolderIdentity).To(Equal("default/test"))
+				Expect(lease.Labels).To(HaveKeyWithValue(consts.OwningSGCNameLabel, "tgw1"))
+				Expect(lease.Labels).To(HaveKeyWithValue(consts.OwningSGCUIDLabel, string(gatewayProfile.UID)))
+				Expect(getPodEndpoint().Spec.EgressSourceIp).To(Equal("1.2.3.5"))
+			})
+			It("should take over egress source IP reserved for a deleted gateway of the same name", func() {
+				// the other pod still pins the IP, but of the deleted gateway
+				Expect(fakeClient.Create(context.Background(), newPinnedPod("other"))).To(Succeed())
+				holder := "default/other"
+				Expect(fakeClient.Create(context.Background(), &coordinationv1.Lease{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   "egress-source-ip.default.tgw1.1.2.3.5",
+						Labels: map[string]string{consts.OwningSGCUIDLabel: "deleted-gateway-uid"},
+					},
+					Spec: coordinationv1.LeaseSpec{HolderIdentity: &holder},
+				})).To(Succeed())
+				pod.Annotations[consts.CNIEgressSourceIPAnnotationKey] = "1.2.3.5"
+				fakeClient.Update(context.Background(), pod) //nolint:errcheck
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				lease := &coordinationv1.Lease{}
+				Expect(fakeClient.Get(context.Background(), client.ObjectKey{Name: "egress-source-ip.default.tgw1.1.2.3.5"}, lease)).To(Succeed())
+				Expect(*lease.Spec.HolderIdentity).To(Equal("default/test"))
+				Expect(lease.Labels).To(HaveKeyWithValue(consts.OwningSGCUIDLabel, string(gatewayProfile.UID)))
+			})
+		})
+		When("pod selects gateway by labels", func() {
+			BeforeEach(func() {
+				nicAddInputRequest.GatewayName = ""
+			})
+			It("should resolve the only matching gateway", func() {
+				gatewayProfile.Labels = map[string]string{"tier": "premium"}
+				fakeClient.Update(context.Background(), gatewayProfile) //nolint:errcheck
+				pod.Annotations[consts.CNIGatewaySelectorAnnotationKey] = "tier=premium"
+				fakeClient.Update(context.Background(), pod) //nolint:errcheck
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.PublicKey).To(Equal(gatewayProfile.Status.GatewayServerProfile.PublicKey))
+				podEndpoint := &current.PodEndpoint{}
+				err = fakeClient.Get(context.Background(), client.ObjectKey{
+					Name:      nicAddInputRequest.PodConfig.PodName,
+					Namespace: nicAddInputRequest.PodConfig.PodNamespace,
+				}, podEndpoint)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(podEndpoint.Spec.StaticGatewayConfiguration).To(Equal(gatewayProfile.Name))
+			})
+			It("should return not found error when no gateway matches", func() {
+				pod.Annotations[consts.CNIGatewaySelectorAnnotationKey] = "tier=premium"
+				fakeClient.Update(context.Background(), pod) //nolint:errcheck
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(status.Code(err)).To(Equal(codes.NotFound))
+			})
+			It("should return error when multiple gateways match", func() {
+				gatewayProfile.Labels = map[string]string{"tier": "premium"}
+				fakeClient.Update(context.Background(), gatewayProfile) //nolint:errcheck
+				another := gatewayProfile.DeepCopy()
+				another.ObjectMeta = metav1.ObjectMeta{Name: "tgw2", Namespace: gatewayProfile.Namespace, Labels: gatewayProfile.Labels}
+				Expect(fakeClient.Create(context.Background(), another)).To(Succeed())
+				pod.Annotations[consts.CNIGatewaySelectorAnnotationKey] = "tier=premium"
+				fakeClient.Update(context.Background(), pod) //nolint:errcheck
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+				Expect(err.Error()).To(ContainSubstring("[tgw1 tgw2]"))
+			})
+			It("should ignore gateways in other namespaces", func() {
+				another := gatewayProfile.DeepCopy()
+				another.ObjectMeta = metav1.ObjectMeta{Name: "tgw1", Namespace: "other", Labels: map[string]string{"tier": "premium"}}
+				Expect(fakeClient.Create(context.Background(), another)).To(Succeed())
+				pod.Annotations[consts.CNIGatewaySelectorAnnotationKey] = "tier=premium"
+				fakeClient.Update(context.Background(), pod) //nolint:errcheck
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(status.Code(err)).To(Equal(codes.NotFound))
+			})
+			DescribeTable("should return invalid argument error for bad selector", func(selector string) {
+				pod.Annotations[consts.CNIGatewaySelectorAnnotationKey] = selector
+				fakeClient.Update(context.Background(), pod) //nolint:errcheck
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			},
+				Entry("malformed selector", "tier in (premium"),
+				Entry("empty selector", ""),
+			)
+			It("should return invalid argument error when pod has no gateway annotation", func() {
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			})
+		})
+		When("pod references gateway in another namespace", func() {
+			BeforeEach(func() {
+				another := gatewayProfile.DeepCopy()
+				another.ObjectMeta = metav1.ObjectMeta{Name: "tgw1", Namespace: "egress-system"}
+				Expect(fakeClient.Create(context.Background(), another)).To(Succeed())
+				nicAddInputRequest.GatewayName = "egress-system/tgw1"
+			})
+			It("should record namespaced gateway reference in pod endpoint when namespace is allowed", func() {
+				another := &current.StaticGatewayConfiguration{}
+				Expect(fakeClient.Get(context.Background(), client.ObjectKey{Name: "tgw1", Namespace: "egress-system"}, another)).To(Succeed())
+				another.Spec.AllowedNamespaces = []string{"default"}
+				Expect(fakeClient.Update(context.Background(), another)).To(Succeed())
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				podEndpoint := &current.PodEndpoint{}
+				err = fakeClient.Get(context.Background(), client.ObjectKey{
+					Name:      nicAddInputRequest.PodConfig.PodName,
+					Namespace: nicAddInputRequest.PodConfig.PodNamespace,
+				}, podEndpoint)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(podEndpoint.Spec.StaticGatewayConfiguration).To(Equal("egress-system/tgw1"))
+			})
+			It("should return permission denied error and don't create pod endpoint when namespace is not allowed", func() {
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(status.Code(err)).To(Equal(codes.PermissionDenied))
+				Expect(err.Error()).To(ContainSubstring("pods in namespace default are not allowed to use StaticGatewayConfiguration egress-system/tgw1"))
+				podEndpoint := &current.PodEndpoint{}
+				err = fakeClient.Get(context.Background(), client.ObjectKey{
+					Name:      nicAddInputRequest.PodConfig.PodName,
+					Namespace: nicAddInputRequest.PodConfig.PodNamespace,
+				}, podEndpoint)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+		When("zone preference is enabled", func() {
+			newNode := func(name, zone, ip string, ready bool) *corev1.Node {
+				readyStatus := corev1.ConditionTrue
+				if !ready {
+					readyStatus = corev1.ConditionFalse
+				}
+				return &corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{corev1.LabelTopologyRegion: "eastus", corev1.LabelTopologyZone: zone}},
+					Status: corev1.NodeStatus{
+						Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: readyStatus}},
+						Addresses:  []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: ip}},
+					},
+				}
+			}
+			newGatewayStatus := func(node string, draining bool) *current.GatewayStatus {
+				return &current.GatewayStatus{
+					ObjectMeta: metav1.ObjectMeta{Name: node, Namespace: "kube-egress-gateway-system"},
+					Spec: current.GatewayStatusSpec{
+						ReadyGatewayConfigurations: []current.GatewayConfiguration{{StaticGatewayConfiguration: "default/tgw1", InterfaceName: "wg-6000"}},
+						Draining:                   draining,
+					},
+				}
+			}
+			BeforeEach(func() {
+				pod.Spec.NodeName = "node1"
+				Expect(fakeClient.Update(context.Background(), pod)).To(Succeed())
+				for _, obj := range []client.Object{
+					newNode("node1", "eastus-1", "10.0.0.4", true),
+					newNode("gw1", "eastus-2", "10.1.0.4", true),
+					newNode("gw2", "eastus-1", "10.1.0.5", true),
+					newNode("gw3", "eastus-1", "10.1.0.6", false),
+					newNode("gw4", "eastus-1", "10.1.0.7", true),
+					newGatewayStatus("gw1", false),
+					newGatewayStatus("gw2", false),
+					newGatewayStatus("gw3", false),
+					newGatewayStatus("gw4", true),
+				} {
+					Expect(fakeClient.Create(context.Background(), obj)).To(Succeed())
+				}
+				service = cnimanager.NewNicService(fakeClient).WithPreferSameZoneGateway(true)
+			})
+
+			It("should return ready gateway node in the same zone", func() {
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.EndpointIp).To(Equal("10.1.0.5"))
+			})
+
+			It("should fall back to gateway ILB IP when no gateway node is in the same zone", func() {
+				gwStatus := newGatewayStatus("gw2", false)
+				Expect(fakeClient.Delete(context.Background(), gwStatus)).To(Succeed())
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.EndpointIp).To(Equal(gatewayProfile.Status.Ip))
+			})
+
+			It("should not return quarantined gateway node", func() {
+				gwStatus := &current.GatewayStatus{}
+				Expect(fakeClient.Get(context.Background(), client.ObjectKey{Name: "gw2", Namespace: "kube-egress-gateway-system"}, gwStatus)).To(Succeed())
+				gwStatus.Spec.Quarantined = true
+				Expect(fakeClient.Update(context.Background(), gwStatus)).To(Succeed())
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.EndpointIp).To(Equal(gatewayProfile.Status.Ip))
+			})
+
+			It("should return gateway ILB IP when pod node is not zonal", func() {
+				Expect(fakeClient.Update(context.Background(), newNode("node1", "0", "10.0.0.4", true))).To(Succeed())
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.EndpointIp).To(Equal(gatewayProfile.Status.Ip))
+			})
+
+			It("should match nodes labeled with the zone only", func() {
+				node := &corev1.Node{}
+				Expect(fakeClient.Get(context.Background(), client.ObjectKey{Name: "node1"}, node)).To(Succeed())
+				node.Labels = map[string]string{corev1.LabelTopologyZone: "1"}
+				Expect(fakeClient.Update(context.Background(), node)).To(Succeed())
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.EndpointIp).To(Equal("10.1.0.5"))
+			})
+
+			When("local gateway preference is enabled", func() {
+				BeforeEach(func() {
+					pod.Spec.NodeName = "gw4"
+					Expect(fakeClient.Update(context.Background(), pod)).To(Succeed())
+					gatewayProfile.Status.GatewayNodes = []string{"gw1", "gw2", "gw3", "gw4"}
+					Expect(fakeClient.Update(context.Background(), gatewayProfile)).To(Succeed())
+					service = cnimanager.NewNicService(fakeClient).WithPreferSameZoneGateway(true).WithPreferLocalGateway(true)
+				})
+
+				It("should return the gateway node the pod runs on", func() {
+					service = cnimanager.NewNicService(fakeClient).WithPreferLocalGateway(true)
+					pod.Spec.NodeName = "gw2"
+					Expect(fakeClient.Update(context.Background(), pod)).To(Succeed())
+					resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(resp.EndpointIp).To(Equal("10.1.0.5"))
+				})
+
+				It("should fall back to zone preference when the local gateway node is draining", func() {
+					resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(resp.EndpointIp).To(Equal("10.1.0.5"))
+				})
+
+				It("should not prefer nodes that are not gateway nodes of the gateway", func() {
+					gatewayProfile.Status.GatewayNodes = []string{"gw1"}
+					Expect(fakeClient.Update(context.Background(), gatewayProfile)).To(Succeed())
+					service = cnimanager.NewNicService(fakeClient).WithPreferLocalGateway(true)
+					pod.Spec.NodeName = "gw2"
+					Expect(fakeClient.Update(context.Background(), pod)).To(Succeed())
+					resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(resp.EndpointIp).To(Equal(gatewayProfile.Status.Ip))
+				})
+			})
+			When("peer placement strategy is set", func() {
+				BeforeEach(func() {
+					Expect(fakeClient.Create(context.Background(), &current.PodEndpoint{
+						ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"},
+						Spec:       current.PodEndpointSpec{StaticGatewayConfiguration: "tgw1", GatewayEndpointIp: "10.1.0.4"},
+					})).To(Succeed())
+				})
+
+				It("should connect pod to the least loaded gateway node", func() {
+					service = cnimanager.NewNicService(fakeClient).WithPeerPlacementStrategy(&cnimanager.LeastLoadedPlacement{})
+					resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(resp.EndpointIp).To(Equal("10.1.0.5"))
+					podEndpoint := &current.PodEndpoint{}
+					Expect(fakeClient.Get(context.Background(), client.ObjectKey{Name: "test", Namespace: "default"}, podEndpoint)).To(Succeed())
+					Expect(podEndpoint.Spec.GatewayEndpointIp).To(Equal("10.1.0.5"))
+				})
+
+				It("should not count peers of other gateways", func() {
+					Expect(fakeClient.Create(context.Background(), &current.PodEndpoint{
+						ObjectMeta: metav1.ObjectMeta{Name: "another", Namespace: "default"},
+						Spec:       current.PodEndpointSpec{StaticGatewayConfiguration: "tgw2", GatewayEndpointIp: "10.1.0.5"},
+					})).To(Succeed())
+					Expect(fakeClient.Create(context.Background(), &current.PodEndpoint{
+						ObjectMeta: metav1.ObjectMeta{Name: "third", Namespace: "default"},
+						Spec:       current.PodEndpointSpec{StaticGatewayConfiguration: "tgw2", GatewayEndpointIp: "10.1.0.5"},
+					})).To(Succeed())
+					service = cnimanager.NewNicService(fakeClient).WithPeerPlacementStrategy(&cnimanager.LeastLoadedPlacement{})
+					resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(resp.EndpointIp).To(Equal("10.1.0.5"))
+				})
+
+				It("should only place pod on gateway nodes in the same zone when zone preference is enabled", func() {
+					Expect(fakeClient.Create(context.Background(), &current.PodEndpoint{
+						ObjectMeta: metav1.ObjectMeta{Name: "another", Namespace: "default"},
+						Spec:       current.PodEndpointSpec{StaticGatewayConfiguration: "tgw1", GatewayEndpointIp: "10.1.0.5"},
+					})).To(Succeed())
+					Expect(fakeClient.Create(context.Background(), &current.PodEndpoint{
+						ObjectMeta: metav1.ObjectMeta{Name: "third", Namespace: "default"},
+						Spec:       current.PodEndpointSpec{StaticGatewayConfiguration: "tgw1", GatewayEndpointIp: "10.1.0.5"},
+					})).To(Succeed())
+					service = cnimanager.NewNicService(fakeClient).WithPreferSameZoneGateway(true).WithPeerPlacementStrategy(&cnimanager.LeastLoadedPlacement{})
+					resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(resp.EndpointIp).To(Equal("10.1.0.5"))
+				})
+
+				It("should place pod on any gateway node when none is in the same zone", func() {
+					Expect(fakeClient.Update(context.Background(), newNode("node1", "eastus-3", "10.0.0.4", true))).To(Succeed())
+					service = cnimanager.NewNicService(fakeClient).WithPreferSameZoneGateway(true).WithPeerPlacementStrategy(cnimanager.NewRoundRobinPlacement())
+					resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(resp.EndpointIp).To(Equal("10.1.0.4"))
+				})
+			})
+		})
+
+		When("multiple gateways are listed", func() {
+			var secondary *current.StaticGatewayConfiguration
+			BeforeEach(func() {
+				secondary = gatewayProfile.DeepCopy()
+				secondary.ResourceVersion = ""
+				secondary.Name = "tgw2"
+				secondary.Status.PublicKey = "secondarypublickey"
+				for _, obj := range []client.Object{
+					secondary,
+					&corev1.Node{
+						ObjectMeta: metav1.ObjectMeta{Name: "gw2"},
+						Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}},
+					},
+					&current.GatewayStatus{
+						ObjectMeta: metav1.ObjectMeta{Name: "gw2", Namespace: "kube-egress-gateway-system"},
+						Spec: current.GatewayStatusSpec{
+							ReadyGatewayConfigurations: []current.GatewayConfiguration{{StaticGatewayConfiguration: "default/tgw2"}},
+						},
+					},
+				} {
+					Expect(fakeClient.Create(context.Background(), obj)).To(Succeed())
+				}
+				nicAddInputRequest.GatewayName = "tgw1, tgw2"
+				nicAddInputRequest.NetnsPath = "/var/run/netns/cni-1234"
+			})
+
+			It("should use the first healthy gateway and record candidates in pod endpoint", func() {
+				pod.Annotations[consts.CNIGatewayFailbackAnnotationKey] = "true"
+				Expect(fakeClient.Update(context.Background(), pod)).To(Succeed())
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.PublicKey).To(Equal("secondarypublickey"))
+				podEndpoint := &current.PodEndpoint{}
+				Expect(fakeClient.Get(context.Background(), client.ObjectKey{Name: "test", Namespace: "default"}, podEndpoint)).To(Succeed())
+				Expect(podEndpoint.Spec.StaticGatewayConfiguration).To(Equal("tgw2"))
+				Expect(podEndpoint.Spec.GatewayCandidates).To(Equal([]string{"tgw1", "tgw2"}))
+				Expect(podEndpoint.Spec.Failback).To(BeTrue())
+				Expect(podEndpoint.Spec.PodNetnsPath).To(Equal("/var/run/netns/cni-1234"))
+			})
+
+			It("should use the first available gateway when none is healthy", func() {
+				nicAddInputRequest.GatewayName = "missing,tgw1,tgw2"
+				Expect(fakeClient.Delete(context.Background(), secondary)).To(Succeed())
+				resp, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.PublicKey).To(Equal(gatewayProfile.Status.PublicKey))
+			})
+
+			It("should return error when no gateway can be retrieved", func() {
+				nicAddInputRequest.GatewayName = "missing1,missing2"
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("missing1"))
+			})
+
+			It("should return invalid argument error for bad failback annotation", func() {
+				pod.Annotations[consts.CNIGatewayFailbackAnnotationKey] = "sometimes"
+				Expect(fakeClient.Update(context.Background(), pod)).To(Succeed())
+				_, err := service.NicAdd(context.Background(), nicAddInputRequest)
+				Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			})
+		})
+
 		When("gateway is not found", func() {
 			It("should return error and don't create pod endpoint", func() {
 				fakeClient.Delete(context.Background(), gatewayProfile) //nolint:errcheck
@@ -177,4 +1033,129 @@ var _ = Describe("Server", func() {
 			})
 		})
 	})
+
+	Context("requesting pod metadata in namespace with default gateway", func() {
+		BeforeEach(func() {
+			namespace := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "default",
+					Annotations: map[string]string{consts.NamespaceDefaultGatewayAnnotationKey: "nsgw"},
+				},
+			}
+			Expect(fakeClient.Create(context.Background(), namespace)).To(Succeed())
+		})
+
+		DescribeTable("should resolve effective gateway by precedence", func(podAnnotations, expected map[string]string) {
+			pod.Annotations = podAnnotations
+			Expect(fakeClient.Update(context.Background(), pod)).To(Succeed())
+			resp, err := service.PodRetrieve(context.Background(), podRetrieveRequest)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.GetAnnotations()).To(Equal(expected))
+		},
+			Entry("namespace default when pod has no gateway annotation",
+				map[string]string{"key1": "value1"},
+				map[string]string{"key1": "value1", consts.CNIGatewayAnnotationKey: "nsgw"}),
+			Entry("namespace default when pod has no annotation at all",
+				nil,
+				map[string]string{consts.CNIGatewayAnnotationKey: "nsgw"}),
+			Entry("pod gateway annotation over namespace default",
+				map[string]string{consts.CNIGatewayAnnotationKey: "podgw"},
+				map[string]string{consts.CNIGatewayAnnotationKey: "podgw"}),
+			Entry("pod gateway selector over namespace default",
+				map[string]string{consts.CNIGatewaySelectorAnnotationKey: "tier=premium"},
+				map[string]string{consts.CNIGatewaySelectorAnnotationKey: "tier=premium"}),
+			Entry("no gateway when pod opts out with empty gateway annotation",
+				map[string]string{"key1": "value1", consts.CNIGatewayAnnotationKey: ""},
+				map[string]string{"key1": "value1"}),
+			Entry("no gateway when pod gateway is disabled",
+				map[string]string{"key1": "value1", consts.CNIGatewayDisabledAnnotationKey: "true"},
+				map[string]string{"key1": "value1", consts.CNIGatewayDisabledAnnotationKey: "true"}),
+			Entry("no gateway when pod gateway annotation and selector are disabled",
+				map[string]string{consts.CNIGatewayAnnotationKey: "podgw", consts.CNIGatewaySelectorAnnotationKey: "tier=premium", consts.CNIGatewayDisabledAnnotationKey: "true"},
+				map[string]string{consts.CNIGatewayDisabledAnnotationKey: "true"}),
+			Entry("namespace default when pod gateway is not disabled",
+				map[string]string{consts.CNIGatewayDisabledAnnotationKey: "false"},
+				map[string]string{consts.CNIGatewayDisabledAnnotationKey: "false", consts.CNIGatewayAnnotationKey: "nsgw"}),
+		)
+
+		It("should report error when gateway disabled annotation is invalid", func() {
+			pod.Annotations = map[string]string{consts.CNIGatewayAnnotationKey: "podgw", consts.CNIGatewayDisabledAnnotationKey: "yes"}
+			Expect(fakeClient.Update(context.Background(), pod)).To(Succeed())
+			_, err := service.PodRetrieve(context.Background(), podRetrieveRequest)
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+
+		It("should not change pod annotations when namespace default is empty", func() {
+			namespace := &corev1.Namespace{}
+			Expect(fakeClient.Get(context.Background(), client.ObjectKey{Name: "default"}, namespace)).To(Succeed())
+			namespace.Annotations[consts.NamespaceDefaultGatewayAnnotationKey] = ""
+			Expect(fakeClient.Update(context.Background(), namespace)).To(Succeed())
+			resp, err := service.PodRetrieve(context.Background(), podRetrieveRequest)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.GetAnnotations()).To(Equal(pod.Annotations))
+		})
+	})
+
+	Context("requesting pod metadata of pod with service account gateway", func() {
+		var serviceAccount *corev1.ServiceAccount
+		BeforeEach(func() {
+			namespace := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "default",
+					Annotations: map[string]string{consts.NamespaceDefaultGatewayAnnotationKey: "nsgw"},
+				},
+			}
+			serviceAccount = &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "app",
+					Namespace:   "default",
+					Annotations: map[string]string{consts.ServiceAccountGatewayAnnotationKey: "sagw"},
+				},
+			}
+			Expect(fakeClient.Create(context.Background(), namespace)).To(Succeed())
+			Expect(fakeClient.Create(context.Background(), serviceAccount)).To(Succeed())
+			pod.Spec.ServiceAccountName = "app"
+		})
+
+		DescribeTable("should resolve effective gateway by precedence", func(podAnnotations, expected map[string]string) {
+			pod.Annotations = podAnnotations
+			Expect(fakeClient.Update(context.Background(), pod)).To(Succeed())
+			resp, err := service.PodRetrieve(context.Background(), podRetrieveRequest)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.GetAnnotations()).To(Equal(expected))
+		},
+			Entry("service account gateway over namespace default",
+				map[string]string{"key1": "value1"},
+				map[string]string{"key1": "value1", consts.CNIGatewayAnnotationKey: "sagw"}),
+			Entry("pod gateway annotation over service account gateway",
+				map[string]string{consts.CNIGatewayAnnotationKey: "podgw"},
+				map[string]string{consts.CNIGatewayAnnotationKey: "podgw"}),
+			Entry("pod gateway selector over service account gateway",
+				map[string]string{consts.CNIGatewaySelectorAnnotationKey: "tier=premium"},
+				map[string]string{consts.CNIGatewaySelectorAnnotationKey: "tier=premium"}),
+			Entry("no gateway when pod opts out with empty gateway annotation",
+				map[string]string{"key1": "value1", consts.CNIGatewayAnnotationKey: ""},
+				map[string]string{"key1": "value1"}),
+			Entry("no gateway when pod gateway is disabled",
+				map[string]string{"key1": "value1", consts.CNIGatewayDisabledAnnotationKey: "true"},
+				map[string]string{"key1": "value1", consts.CNIGatewayDisabledAnnotationKey: "true"}),
+		)
+
+		It("should not use namespace default when service account opts out", func() {
+			serviceAccount.Annotations[consts.ServiceAccountGatewayAnnotationKey] = ""
+			Expect(fakeClient.Update(context.Background(), serviceAccount)).To(Succeed())
+			Expect(fakeClient.Update(context.Background(), pod)).To(Succeed())
+			resp, err := service.PodRetrieve(context.Background(), podRetrieveRequest)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.GetAnnotations()).To(Equal(pod.Annotations))
+		})
+
+		It("should use namespace default when service account is not annotated", func() {
+			pod.Spec.ServiceAccountName = ""
+			Expect(fakeClient.Update(context.Background(), pod)).To(Succeed())
+			resp, err := service.PodRetrieve(context.Background(), podRetrieveRequest)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.GetAnnotations()).To(HaveKeyWithValue(consts.CNIGatewayAnnotationKey, "nsgw"))
+		})
+	})
 })
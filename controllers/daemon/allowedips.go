@@ -0,0 +1,92 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+)
+
+// podEndpointIPIndex indexes PodEndpoints by <namespace>/<name>/<pod IP> of the StaticGatewayConfiguration they use
+// and each of their pod addresses
+const podEndpointIPIndex = "spec.podIpAddresses"
+
+func podEndpointIPIndexFunc(o client.Object) []string {
+	podEndpoint, ok := o.(*egressgatewayv1alpha1.PodEndpoint)
+	if !ok || podEndpoint.Spec.StaticGatewayConfiguration == "" {
+		return nil
+	}
+	var values []string
+	for _, cidr := range []string{podEndpoint.Spec.PodIpAddress, podEndpoint.Spec.PodIpv6Address} {
+		if ip, _, err := net.ParseCIDR(cidr); err == nil {
+			values = append(values, podEndpointIPIndexValue(podEndpoint.GetStaticGatewayConfigurationKey(), ip))
+		}
+	}
+	return values
+}
+
+func podEndpointIPIndexValue(gwConfigKey client.ObjectKey, ip net.IP) string {
+	return gwConfigKey.String() + "/" + ip.String()
+}
+
+// parsePodAllowedIP returns the allowed IPs of a pod address in CIDR notation, the whole prefix unless allowed IPs
+// are strict, in which case only the pod address itself
+func parsePodAllowedIP(cidr string, strict bool) (*net.IPNet, error) {
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	if !strict {
+		return ipNet, nil
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// checkPodIPConflict returns an error when an older PodEndpoint of the gateway has the same pod IP. Wireguard moves
+// an allowed IP to the peer configured last, so the check keeps a PodEndpoint from taking over the tunnel traffic
+// of another pod, while the first PodEndpoint created with the IP keeps it whatever order they are reconciled in.
+func (r *PodEndpointReconciler) checkPodIPConflict(
+	ctx context.Context,
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+	podEndpoint *egressgatewayv1alpha1.PodEndpoint,
+) error {
+	allowedIPs, err := getPodAllowedIPs(podEndpoint, true)
+	if err != nil {
+		return err
+	}
+	for _, ipNet := range allowedIPs {
+		podEndpointList := &egressgatewayv1alpha1.PodEndpointList{}
+		if err := r.List(ctx, podEndpointList, client.MatchingFields{
+			podEndpointIPIndex: podEndpointIPIndexValue(client.ObjectKeyFromObject(gwConfig), ipNet.IP),
+		}); err != nil {
+			return fmt.Errorf("failed to list PodEndpoints: %w", err)
+		}
+		for i := range podEndpointList.Items {
+			other := &podEndpointList.Items[i]
+			if !other.DeletionTimestamp.IsZero() || !createdBefore(other, podEndpoint) {
+				continue
+			}
+			return fmt.Errorf("pod IP %s is already used by PodEndpoint %s/%s", ipNet.String(), other.Namespace, other.Name)
+		}
+	}
+	return nil
+}
+
+// createdBefore returns whether PodEndpoint a was created before b, PodEndpoints created in the same second are
+// ordered by namespace and name
+func createdBefore(a, b *egressgatewayv1alpha1.PodEndpoint) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	return client.ObjectKeyFromObject(a).String() < client.ObjectKeyFromObject(b).String()
+}
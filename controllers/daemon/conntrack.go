@@ -0,0 +1,183 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper"
+)
+
+const (
+	// defaultConntrackMonitorInterval is how often conntrack usage of gateway nodes is checked
+	defaultConntrackMonitorInterval = 30 * time.Second
+	// hostNetnsLabel is the netns label value of the host network namespace the daemon runs in
+	hostNetnsLabel = "host"
+
+	conntrackMaxSysctl   = "net/netfilter/nf_conntrack_max"
+	conntrackCountSysctl = "net/netfilter/nf_conntrack_count"
+)
+
+var (
+	GatewayConntrackEntries = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_conntrack_entries",
+			Help: "Number of connection tracking entries in the network namespace on the gateway node, host for the host network namespace",
+		},
+		[]string{"netns"},
+	)
+
+	GatewayConntrackMax = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "gateway_conntrack_max",
+			Help: "Maximum number of connection tracking entries of each network namespace on the gateway node, new connections are dropped beyond it",
+		},
+	)
+)
+
+// ConntrackMonitor periodically raises nf_conntrack_max of the gateway node to the configured value, and reports
+// connection tracking usage of the host and gateway network namespaces. The limit is set node wide but applies to
+// each network namespace separately, so every gateway namespace is checked against it.
+type ConntrackMonitor struct {
+	NetNS netnswrapper.Interface
+	// NetnsPerGateway configures each gateway in its own network namespace
+	NetnsPerGateway bool
+	// Max is the minimum nf_conntrack_max ensured on the node, it is never lowered. 0 leaves it unchanged.
+	Max int
+	// WarningPercent is the usage of the conntrack table, in percent of the max, above which a warning is logged
+	WarningPercent int
+	Interval       time.Duration
+	// SysctlDir is the mount point of sysctls, net sysctls are read in the network namespace of the caller
+	SysctlDir string
+
+	// network namespaces whose usage is above the warning threshold
+	warned map[string]bool
+}
+
+func NewConntrackMonitor(max, warningPercent int) *ConntrackMonitor {
+	return &ConntrackMonitor{
+		NetNS:          netnswrapper.NewNetNS(),
+		Max:            max,
+		WarningPercent: warningPercent,
+		Interval:       defaultConntrackMonitorInterval,
+		SysctlDir:      "/proc/sys",
+		warned:         make(map[string]bool),
+	}
+}
+
+// Start checks conntrack usage every interval until ctx is done.
+func (m *ConntrackMonitor) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := m.check(ctx); err != nil {
+			log.FromContext(ctx).Error(err, "failed to check conntrack usage")
+		}
+	}, m.Interval)
+	return nil
+}
+
+func (m *ConntrackMonitor) check(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("conntrack-monitor")
+
+	max, err := m.ensureMax(ctx)
+	if err != nil {
+		return err
+	}
+	GatewayConntrackMax.Set(float64(max))
+
+	counts := make(map[string]int)
+	count, err := m.readSysctl(conntrackCountSysctl)
+	if err != nil {
+		return err
+	}
+	counts[hostNetnsLabel] = count
+	nsNames, err := listGatewayNetns(m.NetNS, m.NetnsPerGateway)
+	if err != nil {
+		return err
+	}
+	for _, nsName := range nsNames {
+		count, err := m.getNetnsCount(nsName)
+		if err != nil {
+			// do not block checking other network namespaces
+			log.Error(err, "failed to read conntrack usage of gateway network namespace", "netns", nsName)
+			continue
+		}
+		counts[nsName] = count
+	}
+
+	GatewayConntrackEntries.Reset()
+	for nsName, count := range counts {
+		GatewayConntrackEntries.WithLabelValues(nsName).Set(float64(count))
+		nearlyFull := max > 0 && count*100 >= max*m.WarningPercent
+		if nearlyFull && !m.warned[nsName] {
+			log.Info("Connection tracking table is nearly full, new connections are dropped when it is full, "+
+				"raise conntrack max or add gateway nodes", "netns", nsName, "entries", count, "max", max)
+		} else if !nearlyFull && m.warned[nsName] {
+			log.Info("Connection tracking table usage is back below the warning threshold", "netns", nsName, "entries", count, "max", max)
+		}
+		m.warned[nsName] = nearlyFull
+	}
+	for nsName := range m.warned {
+		if _, ok := counts[nsName]; !ok {
+			delete(m.warned, nsName)
+		}
+	}
+	return nil
+}
+
+// ensureMax raises nf_conntrack_max to Max if it is lower, e.g. after kube-proxy or another agent set it, and
+// returns the resulting value
+func (m *ConntrackMonitor) ensureMax(ctx context.Context) (int, error) {
+	max, err := m.readSysctl(conntrackMaxSysctl)
+	if err != nil {
+		return 0, err
+	}
+	if m.Max <= max {
+		return max, nil
+	}
+	log.FromContext(ctx).Info("Raising conntrack max", "orig", max, "cur", m.Max)
+	if err := os.WriteFile(filepath.Join(m.SysctlDir, conntrackMaxSysctl), []byte(strconv.Itoa(m.Max)), 0644); err != nil {
+		return 0, fmt.Errorf("failed to set %s: %w", conntrackMaxSysctl, err)
+	}
+	return m.Max, nil
+}
+
+func (m *ConntrackMonitor) getNetnsCount(nsName string) (int, error) {
+	gwns, err := m.NetNS.GetNS(nsName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get network namespace %s: %w", nsName, err)
+	}
+	defer gwns.Close()
+
+	var count int
+	if err := gwns.Do(func(nn ns.NetNS) error {
+		count, err = m.readSysctl(conntrackCountSysctl)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (m *ConntrackMonitor) readSysctl(name string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(m.SysctlDir, name))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	value, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return value, nil
+}
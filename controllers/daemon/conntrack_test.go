@@ -0,0 +1,96 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/mock/gomock"
+
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper/mocknetnswrapper"
+)
+
+var _ = Describe("Daemon conntrack monitor unit tests", func() {
+	var (
+		m   *ConntrackMonitor
+		mns *mocknetnswrapper.MockInterface
+	)
+
+	writeSysctl := func(name string, value int) {
+		Expect(os.WriteFile(filepath.Join(m.SysctlDir, name), []byte(fmt.Sprintf("%d\n", value)), 0644)).To(Succeed())
+	}
+
+	readSysctl := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(m.SysctlDir, name))
+		Expect(err).NotTo(HaveOccurred())
+		return strings.TrimSpace(string(data))
+	}
+
+	BeforeEach(func() {
+		mns = mocknetnswrapper.NewMockInterface(gomock.NewController(GinkgoT()))
+		m = NewConntrackMonitor(0, 80)
+		m.NetNS = mns
+		m.SysctlDir = GinkgoT().TempDir()
+		Expect(os.MkdirAll(filepath.Join(m.SysctlDir, "net/netfilter"), 0755)).To(Succeed())
+		writeSysctl(conntrackMaxSysctl, 1000)
+		writeSysctl(conntrackCountSysctl, 100)
+	})
+
+	It("should leave conntrack max unchanged when not configured", func() {
+		mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(&mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}, nil)
+		Expect(m.check(context.TODO())).To(Succeed())
+		Expect(readSysctl(conntrackMaxSysctl)).To(Equal("1000"))
+		Expect(testutil.ToFloat64(GatewayConntrackMax)).To(Equal(float64(1000)))
+	})
+
+	It("should raise conntrack max but never lower it", func() {
+		mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(&mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}, nil).Times(2)
+		m.Max = 2000
+		Expect(m.check(context.TODO())).To(Succeed())
+		Expect(readSysctl(conntrackMaxSysctl)).To(Equal("2000"))
+		Expect(testutil.ToFloat64(GatewayConntrackMax)).To(Equal(float64(2000)))
+
+		writeSysctl(conntrackMaxSysctl, 3000)
+		Expect(m.check(context.TODO())).To(Succeed())
+		Expect(readSysctl(conntrackMaxSysctl)).To(Equal("3000"))
+		Expect(testutil.ToFloat64(GatewayConntrackMax)).To(Equal(float64(3000)))
+	})
+
+	It("should report conntrack usage of host and gateway network namespaces", func() {
+		m.NetnsPerGateway = true
+		gomock.InOrder(
+			mns.EXPECT().ListNS().Return([]string{"cni-1234", "ns-static-egress-gateway-6000"}, nil),
+			mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(nil, fmt.Errorf("not found")),
+			mns.EXPECT().GetNS("ns-static-egress-gateway-6000").Return(&mocknetnswrapper.MockNetNS{Name: "ns-static-egress-gateway-6000"}, nil),
+		)
+		Expect(m.check(context.TODO())).To(Succeed())
+		Expect(testutil.CollectAndCount(GatewayConntrackEntries)).To(Equal(2))
+		Expect(testutil.ToFloat64(GatewayConntrackEntries.WithLabelValues(hostNetnsLabel))).To(Equal(float64(100)))
+		Expect(testutil.ToFloat64(GatewayConntrackEntries.WithLabelValues("ns-static-egress-gateway-6000"))).To(Equal(float64(100)))
+	})
+
+	It("should warn when usage is above the threshold until it drops below", func() {
+		mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(&mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}, nil).Times(2)
+		writeSysctl(conntrackCountSysctl, 800)
+		Expect(m.check(context.TODO())).To(Succeed())
+		Expect(m.warned).To(Equal(map[string]bool{hostNetnsLabel: true, consts.GatewayNetnsName: true}))
+
+		writeSysctl(conntrackCountSysctl, 799)
+		Expect(m.check(context.TODO())).To(Succeed())
+		Expect(m.warned).To(Equal(map[string]bool{hostNetnsLabel: false, consts.GatewayNetnsName: false}))
+	})
+
+	It("should report error when conntrack is not loaded", func() {
+		Expect(os.Remove(filepath.Join(m.SysctlDir, conntrackMaxSysctl))).To(Succeed())
+		Expect(m.check(context.TODO())).To(MatchError(ContainSubstring("failed to read net/netfilter/nf_conntrack_max")))
+	})
+})
@@ -0,0 +1,189 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/healthprobe"
+)
+
+const defaultDrainPollInterval = 5 * time.Second
+
+// GatewayDrainer moves traffic off this gateway node before the daemon exits.
+// Every gateway node of a pool is configured with all peers of the gateway, so draining
+// only needs to fail the lb health probe and wait until another ready gateway node serves
+// the same peers.
+type GatewayDrainer struct {
+	client.Client
+	LBProbeServer *healthprobe.LBProbeServer
+	Timeout       time.Duration
+	PollInterval  time.Duration
+	// GracefulRestart skips draining unless this node is cordoned or being deleted. Wireguard links, peers and
+	// rules in gateway network namespaces keep forwarding traffic without the daemon, so tunnels are kept while
+	// the daemon restarts, e.g. on upgrade.
+	GracefulRestart bool
+}
+
+// Start clears draining flag left by a previous daemon instance on this node, and blocks until ctx is done.
+func (d *GatewayDrainer) Start(ctx context.Context) error {
+	if err := d.setDraining(ctx, false); err != nil {
+		return fmt.Errorf("failed to reset gateway draining status: %w", err)
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// Drain marks this node as draining and waits until peers on this node are ready on
+// other gateway nodes, or until timeout.
+func (d *GatewayDrainer) Drain(ctx context.Context) {
+	log := log.FromContext(ctx).WithName("drain")
+	if d.Timeout <= 0 {
+		return
+	}
+	if d.GracefulRestart {
+		leaving, err := d.isNodeLeaving(ctx)
+		if err != nil {
+			log.Error(err, "failed to get node, draining for safety")
+		} else if !leaving {
+			log.Info("Skipping gateway node drain for graceful restart")
+			return
+		}
+	}
+	log.Info("Draining gateway node", "timeout", d.Timeout)
+
+	d.LBProbeServer.SetDraining(true)
+	if err := d.setDraining(ctx, true); err != nil {
+		log.Error(err, "failed to mark gateway node as draining")
+	}
+
+	pollInterval := d.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultDrainPollInterval
+	}
+	reported := sets.New[string]()
+	if err := wait.PollUntilContextTimeout(ctx, pollInterval, d.Timeout, true, func(ctx context.Context) (bool, error) {
+		pending, err := getUnmigratedGateways(ctx, d.Client)
+		if err != nil {
+			log.Error(err, "failed to check peer migration")
+			return false, nil
+		}
+		for gateway, reason := range pending {
+			if !reported.Has(gateway) {
+				log.Info("Waiting for gateway peers to be migrated", "gateway", gateway, "reason", reason)
+				reported.Insert(gateway)
+			}
+		}
+		return len(pending) == 0, nil
+	}); err != nil {
+		log.Info("Gateway node drain timed out, exiting with peers not migrated")
+		return
+	}
+	log.Info("Gateway node drained")
+}
+
+// isNodeLeaving returns whether this node is cordoned or being deleted, so that its gateway peers should be moved
+// to other gateway nodes even if the daemon is expected to restart
+func (d *GatewayDrainer) isNodeLeaving(ctx context.Context) (bool, error) {
+	node := &corev1.Node{}
+	if err := d.Get(ctx, types.NamespacedName{Name: os.Getenv(consts.NodeNameEnvKey)}, node); err != nil {
+		return false, err
+	}
+	return node.Spec.Unschedulable || !node.DeletionTimestamp.IsZero(), nil
+}
+
+// setDraining updates draining flag in GatewayStatus of this node
+func (d *GatewayDrainer) setDraining(ctx context.Context, draining bool) error {
+	gwStatus := &egressgatewayv1alpha1.GatewayStatus{}
+	if err := d.Get(ctx, getGatewayStatusKey(), gwStatus); err != nil {
+		// node without gateway status has nothing to drain
+		return client.IgnoreNotFound(err)
+	}
+	if gwStatus.Spec.Draining == draining {
+		return nil
+	}
+	gwStatus.Spec.Draining = draining
+	return d.Update(ctx, gwStatus)
+}
+
+// getUnmigratedGateways returns gateways on this node whose peers are not ready on another
+// gateway node that is neither draining nor quarantined, along with the reason
+func getUnmigratedGateways(ctx context.Context, c client.Reader) (map[string]string, error) {
+	gwStatusKey := getGatewayStatusKey()
+	gwStatus := &egressgatewayv1alpha1.GatewayStatus{}
+	if err := c.Get(ctx, gwStatusKey, gwStatus); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	gwStatusList := &egressgatewayv1alpha1.GatewayStatusList{}
+	if err := c.List(ctx, gwStatusList, client.InNamespace(gwStatusKey.Namespace)); err != nil {
+		return nil, err
+	}
+
+	pending := make(map[string]string)
+	for _, gwConf := range gwStatus.Spec.ReadyGatewayConfigurations {
+		peers := sets.New[string]()
+		for _, peer := range gwStatus.Spec.ReadyPeerConfigurations {
+			if peer.InterfaceName == gwConf.InterfaceName {
+				peers.Insert(peer.PublicKey)
+			}
+		}
+
+		reason := "no other gateway node is available"
+		for _, other := range gwStatusList.Items {
+			if other.Name == gwStatusKey.Name || other.Spec.Draining || other.Spec.Quarantined {
+				continue
+			}
+			if !hasGatewayConfiguration(&other, gwConf.StaticGatewayConfiguration) {
+				continue
+			}
+			otherPeers := sets.New[string]()
+			for _, peer := range other.Spec.ReadyPeerConfigurations {
+				if peer.InterfaceName == gwConf.InterfaceName {
+					otherPeers.Insert(peer.PublicKey)
+				}
+			}
+			if otherPeers.IsSuperset(peers) {
+				reason = ""
+				break
+			}
+			reason = fmt.Sprintf("peers are not ready on gateway node %s yet", other.Name)
+		}
+		if reason != "" {
+			pending[gwConf.StaticGatewayConfiguration] = reason
+		}
+	}
+	return pending, nil
+}
+
+func hasGatewayConfiguration(gwStatus *egressgatewayv1alpha1.GatewayStatus, gateway string) bool {
+	for _, gwConf := range gwStatus.Spec.ReadyGatewayConfigurations {
+		if gwConf.StaticGatewayConfiguration == gateway {
+			return true
+		}
+	}
+	return false
+}
+
+func getGatewayStatusKey() types.NamespacedName {
+	return types.NamespacedName{
+		Namespace: os.Getenv(consts.PodNamespaceEnvKey),
+		Name:      os.Getenv(consts.NodeNameEnvKey),
+	}
+}
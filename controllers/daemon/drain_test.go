@@ -0,0 +1,172 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"context"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/healthprobe"
+)
+
+var _ = Describe("Daemon gateway drainer unit tests", func() {
+	var (
+		d          *GatewayDrainer
+		gatewayKey = testNamespace + "/" + testName
+	)
+
+	getTestDrainer := func(objects ...runtime.Object) {
+		cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(objects...).Build()
+		d = &GatewayDrainer{
+			Client:        cl,
+			LBProbeServer: healthprobe.NewLBProbeServer(1000),
+			Timeout:       time.Second,
+			PollInterval:  10 * time.Millisecond,
+		}
+	}
+
+	getTestGatewayStatus := func(nodeName string, publicKeys ...string) *egressgatewayv1alpha1.GatewayStatus {
+		gwStatus := &egressgatewayv1alpha1.GatewayStatus{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      nodeName,
+				Namespace: testPodNamespace,
+			},
+			Spec: egressgatewayv1alpha1.GatewayStatusSpec{
+				ReadyGatewayConfigurations: []egressgatewayv1alpha1.GatewayConfiguration{
+					{StaticGatewayConfiguration: gatewayKey, InterfaceName: "wg-6000"},
+				},
+			},
+		}
+		for _, publicKey := range publicKeys {
+			gwStatus.Spec.ReadyPeerConfigurations = append(gwStatus.Spec.ReadyPeerConfigurations, egressgatewayv1alpha1.PeerConfiguration{
+				InterfaceName: "wg-6000",
+				PublicKey:     publicKey,
+			})
+		}
+		return gwStatus
+	}
+
+	isDraining := func() bool {
+		gwStatus := &egressgatewayv1alpha1.GatewayStatus{}
+		Expect(d.Get(context.TODO(), types.NamespacedName{Name: testNodeName, Namespace: testPodNamespace}, gwStatus)).To(Succeed())
+		return gwStatus.Spec.Draining
+	}
+
+	BeforeEach(func() {
+		os.Setenv(consts.PodNamespaceEnvKey, testPodNamespace)
+		os.Setenv(consts.NodeNameEnvKey, testNodeName)
+	})
+
+	AfterEach(func() {
+		os.Setenv(consts.PodNamespaceEnvKey, "")
+		os.Setenv(consts.NodeNameEnvKey, "")
+	})
+
+	It("should clear draining flag on start", func() {
+		gwStatus := getTestGatewayStatus(testNodeName)
+		gwStatus.Spec.Draining = true
+		getTestDrainer(gwStatus)
+		ctx, cancel := context.WithCancel(context.TODO())
+		cancel()
+		Expect(d.Start(ctx)).To(Succeed())
+		Expect(isDraining()).To(BeFalse())
+	})
+
+	It("should not fail on start when node has no gateway status", func() {
+		getTestDrainer()
+		ctx, cancel := context.WithCancel(context.TODO())
+		cancel()
+		Expect(d.Start(ctx)).To(Succeed())
+	})
+
+	It("should report gateway as pending when there is no other gateway node", func() {
+		getTestDrainer(getTestGatewayStatus(testNodeName, pubK))
+		pending, err := getUnmigratedGateways(context.TODO(), d.Client)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pending).To(Equal(map[string]string{gatewayKey: "no other gateway node is available"}))
+	})
+
+	It("should report gateway as pending when other gateway node is draining", func() {
+		other := getTestGatewayStatus("other", pubK)
+		other.Spec.Draining = true
+		getTestDrainer(getTestGatewayStatus(testNodeName, pubK), other)
+		pending, err := getUnmigratedGateways(context.TODO(), d.Client)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pending).To(Equal(map[string]string{gatewayKey: "no other gateway node is available"}))
+	})
+
+	It("should report gateway as pending when other gateway node is quarantined", func() {
+		other := getTestGatewayStatus("other", pubK)
+		other.Spec.Quarantined = true
+		getTestDrainer(getTestGatewayStatus(testNodeName, pubK), other)
+		pending, err := getUnmigratedGateways(context.TODO(), d.Client)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pending).To(Equal(map[string]string{gatewayKey: "no other gateway node is available"}))
+	})
+
+	It("should report gateway as pending when peers are not ready on other gateway node", func() {
+		getTestDrainer(getTestGatewayStatus(testNodeName, pubK, pubK2), getTestGatewayStatus("other", pubK))
+		pending, err := getUnmigratedGateways(context.TODO(), d.Client)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pending).To(Equal(map[string]string{gatewayKey: "peers are not ready on gateway node other yet"}))
+	})
+
+	It("should not report gateway whose peers are ready on other gateway node", func() {
+		getTestDrainer(getTestGatewayStatus(testNodeName, pubK), getTestGatewayStatus("other", pubK, pubK2))
+		pending, err := getUnmigratedGateways(context.TODO(), d.Client)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pending).To(BeEmpty())
+	})
+
+	It("should mark node as draining and return once peers are migrated", func() {
+		getTestDrainer(getTestGatewayStatus(testNodeName, pubK), getTestGatewayStatus("other", pubK))
+		start := time.Now()
+		d.Drain(context.TODO())
+		Expect(time.Since(start)).To(BeNumerically("<", d.Timeout))
+		Expect(isDraining()).To(BeTrue())
+	})
+
+	It("should exit after timeout when no other gateway node is available", func() {
+		getTestDrainer(getTestGatewayStatus(testNodeName, pubK))
+		d.Timeout = 100 * time.Millisecond
+		start := time.Now()
+		d.Drain(context.TODO())
+		Expect(time.Since(start)).To(BeNumerically(">=", d.Timeout))
+		Expect(isDraining()).To(BeTrue())
+	})
+
+	It("should skip draining for graceful restart", func() {
+		getTestDrainer(getTestGatewayStatus(testNodeName, pubK), &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: testNodeName}})
+		d.GracefulRestart = true
+		d.Drain(context.TODO())
+		Expect(isDraining()).To(BeFalse())
+	})
+
+	It("should drain cordoned node for graceful restart", func() {
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: testNodeName}, Spec: corev1.NodeSpec{Unschedulable: true}}
+		getTestDrainer(getTestGatewayStatus(testNodeName, pubK), getTestGatewayStatus("other", pubK), node)
+		d.GracefulRestart = true
+		d.Drain(context.TODO())
+		Expect(isDraining()).To(BeTrue())
+	})
+
+	It("should exit immediately when drain timeout is not set", func() {
+		getTestDrainer(getTestGatewayStatus(testNodeName, pubK))
+		d.Timeout = 0
+		d.Drain(context.TODO())
+		Expect(isDraining()).To(BeFalse())
+	})
+})
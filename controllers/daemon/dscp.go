@@ -0,0 +1,102 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+	utiliptables "k8s.io/kubernetes/pkg/util/iptables"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+)
+
+// ensurePodDSCPMarks sets the DSCP value of packets forwarded from the wireguard link of gwConfig for pods with an
+// egress DSCP, keyed on their tunnel IPs. The chain is removed when no pod of the gateway is marked any more. Must be
+// called in gateway namespace.
+func (r *PodEndpointReconciler) ensurePodDSCPMarks(ctx context.Context, gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) error {
+	log := log.FromContext(ctx)
+	linkName := getWireguardInterfaceName(gwConfig)
+	mark, err := getPacketMark(linkName)
+	if err != nil {
+		return err
+	}
+	chain := utiliptables.Chain(fmt.Sprintf("EGRESS-GATEWAY-DSCP-%d", mark))
+	jumpRule := []string{"-m", "comment", "--comment", fmt.Sprintf("kube-egress-gateway mark dscp of pods on gateway link %s", linkName), "-j", string(chain)}
+
+	podEndpointList := &egressgatewayv1alpha1.PodEndpointList{}
+	if err := r.List(ctx, podEndpointList); err != nil {
+		return fmt.Errorf("failed to list PodEndpoints: %w", err)
+	}
+	gwConfigKey := types.NamespacedName{Namespace: gwConfig.Namespace, Name: gwConfig.Name}
+	var marked []egressgatewayv1alpha1.PodEndpoint
+	for _, podEndpoint := range podEndpointList.Items {
+		if podEndpoint.Spec.EgressDscp > 0 && podEndpoint.DeletionTimestamp.IsZero() &&
+			podEndpoint.GetStaticGatewayConfigurationKey() == gwConfigKey && gwConfig.AllowsNamespace(podEndpoint.Namespace) {
+			marked = append(marked, podEndpoint)
+		}
+	}
+
+	if len(marked) == 0 {
+		exists, err := r.IPTables.ChainExists(utiliptables.TableMangle, chain)
+		if err != nil || !exists {
+			return err
+		}
+		log.Info("Releasing pod dscp marks", "chain", chain)
+		if err := r.IPTables.DeleteRule(utiliptables.TableMangle, utiliptables.ChainForward, jumpRule...); err != nil {
+			return fmt.Errorf("failed to delete jump rule to chain %s: %w", chain, err)
+		}
+		if err := r.IPTables.FlushChain(utiliptables.TableMangle, chain); err != nil {
+			return fmt.Errorf("failed to flush chain %s: %w", chain, err)
+		}
+		return r.IPTables.DeleteChain(utiliptables.TableMangle, chain)
+	}
+
+	rules, err := getPodDSCPRules(linkName, marked)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.IPTables.EnsureChain(utiliptables.TableMangle, chain); err != nil {
+		return fmt.Errorf("failed to ensure chain %s: %w", chain, err)
+	}
+	if _, err := r.IPTables.EnsureRule(utiliptables.Prepend, utiliptables.TableMangle, utiliptables.ChainForward, jumpRule...); err != nil {
+		return fmt.Errorf("failed to ensure jump rule to chain %s: %w", chain, err)
+	}
+	lines := bytes.NewBuffer(nil)
+	writeLine(lines, "*"+string(utiliptables.TableMangle))
+	writeLine(lines, utiliptables.MakeChainLine(chain))
+	for _, rule := range rules {
+		writeRule(lines, string(utiliptables.Append), chain, rule...)
+	}
+	writeLine(lines, "COMMIT")
+	log.Info("Restoring pod dscp rules", "rules", lines.String())
+	if err := r.IPTables.RestoreAll(lines.Bytes(), utiliptables.NoFlushTables, utiliptables.NoRestoreCounters); err != nil {
+		return fmt.Errorf("failed to restore rules in chain %s: %w", chain, err)
+	}
+	return nil
+}
+
+// getPodDSCPRules returns rules setting the DSCP value of packets received from marked pods on the wireguard link
+func getPodDSCPRules(linkName string, marked []egressgatewayv1alpha1.PodEndpoint) ([][]string, error) {
+	// keep rules stable regardless of list order
+	slices.SortFunc(marked, func(a, b egressgatewayv1alpha1.PodEndpoint) int {
+		return strings.Compare(a.Namespace+"/"+a.Name, b.Namespace+"/"+b.Name)
+	})
+	var rules [][]string
+	for _, podEndpoint := range marked {
+		_, podIPNet, err := net.ParseCIDR(podEndpoint.Spec.PodIpAddress)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse IP address of PodEndpoint %s/%s: %w", podEndpoint.Namespace, podEndpoint.Name, err)
+		}
+		rules = append(rules, []string{"-i", linkName, "-s", podIPNet.String(), "-j", "DSCP", "--set-dscp", fmt.Sprintf("%d", podEndpoint.Spec.EgressDscp)})
+	}
+	return rules, nil
+}
@@ -0,0 +1,94 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"bytes"
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	utiliptables "k8s.io/kubernetes/pkg/util/iptables"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	fakeiptables "github.com/Azure/kube-egress-gateway/pkg/iptableswrapper"
+)
+
+var _ = Describe("Daemon pod dscp unit tests", func() {
+	var (
+		r        *PodEndpointReconciler
+		fipt     *fakeiptables.FakeIPTables
+		gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration
+	)
+
+	getTestReconciler := func(objects ...runtime.Object) {
+		cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(objects...).Build()
+		fipt = fakeiptables.NewFake()
+		r = &PodEndpointReconciler{
+			Client:   cl,
+			IPTables: fipt,
+		}
+	}
+
+	getMarkedPodEndpoint := func(name, podIP string, dscp int32) *egressgatewayv1alpha1.PodEndpoint {
+		return &egressgatewayv1alpha1.PodEndpoint{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+			Spec: egressgatewayv1alpha1.PodEndpointSpec{
+				StaticGatewayConfiguration: testName,
+				PodIpAddress:               podIP,
+				EgressDscp:                 dscp,
+			},
+		}
+	}
+
+	getMangleDump := func() string {
+		buf := bytes.NewBuffer(nil)
+		Expect(fipt.SaveInto(utiliptables.TableMangle, buf)).To(Succeed())
+		return buf.String()
+	}
+
+	BeforeEach(func() {
+		gwConfig = &egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: testName, Namespace: testNamespace},
+			Status:     getTestGwConfigStatus(),
+		}
+	})
+
+	It("should mark egress packets of pods with their dscp", func() {
+		otherGateway := getMarkedPodEndpoint("pod3", "10.244.0.7/32", 10)
+		otherGateway.Spec.StaticGatewayConfiguration = "other"
+		getTestReconciler(
+			getMarkedPodEndpoint("pod2", "10.244.0.6/32", 46),
+			getMarkedPodEndpoint("pod1", "10.244.0.5/32", 10),
+			otherGateway,
+			getMarkedPodEndpoint("pod4", "10.244.0.8/32", 0),
+		)
+		Expect(r.ensurePodDSCPMarks(context.TODO(), gwConfig)).To(Succeed())
+		dump := getMangleDump()
+		Expect(dump).To(ContainSubstring("-A FORWARD -m comment --comment kube-egress-gateway mark dscp of pods on gateway link wg-6000 -j EGRESS-GATEWAY-DSCP-6000\n"))
+		Expect(dump).To(ContainSubstring("-A EGRESS-GATEWAY-DSCP-6000 -i wg-6000 -s 10.244.0.5/32 -j DSCP --set-dscp 10\n" +
+			"-A EGRESS-GATEWAY-DSCP-6000 -i wg-6000 -s 10.244.0.6/32 -j DSCP --set-dscp 46\nCOMMIT\n"))
+	})
+
+	It("should not create chain when no pod is marked", func() {
+		getTestReconciler(getMarkedPodEndpoint("pod1", "10.244.0.5/32", 0))
+		Expect(r.ensurePodDSCPMarks(context.TODO(), gwConfig)).To(Succeed())
+		Expect(getMangleDump()).NotTo(ContainSubstring("EGRESS-GATEWAY-DSCP-6000"))
+	})
+
+	It("should release dscp mark when PodEndpoint is deleted", func() {
+		podEndpoint := getMarkedPodEndpoint("pod1", "10.244.0.5/32", 46)
+		getTestReconciler(podEndpoint)
+		Expect(r.ensurePodDSCPMarks(context.TODO(), gwConfig)).To(Succeed())
+		Expect(getMangleDump()).To(ContainSubstring("EGRESS-GATEWAY-DSCP-6000"))
+
+		Expect(r.Delete(context.TODO(), podEndpoint)).To(Succeed())
+		Expect(r.ensurePodDSCPMarks(context.TODO(), gwConfig)).To(Succeed())
+		Expect(getMangleDump()).NotTo(ContainSubstring("EGRESS-GATEWAY-DSCP-6000"))
+	})
+})
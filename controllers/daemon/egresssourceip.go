@@ -0,0 +1,182 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+	utiliptables "k8s.io/kubernetes/pkg/util/iptables"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/imds"
+)
+
+// ensureEgressSourceIPs sNATs connections of pods pinned to an egress source IP of gwConfig to the private IP of this
+// node associated with that public IP. Pods pinned to public IPs of other gateway nodes are sNATed as usual, the chain
+// is removed when no pod is pinned any more. Must be called in gateway namespace.
+func (r *PodEndpointReconciler) ensureEgressSourceIPs(ctx context.Context, gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) error {
+	log := log.FromContext(ctx)
+	linkName := getWireguardInterfaceName(gwConfig)
+	mark, err := getPacketMark(linkName)
+	if err != nil {
+		return err
+	}
+	chain := utiliptables.Chain(fmt.Sprintf("EGRESS-GATEWAY-PIN-%d", mark))
+	jumpRule := []string{"-m", "comment", "--comment", fmt.Sprintf("kube-egress-gateway pin egress source IP of pods on gateway link %s", linkName), "-j", string(chain)}
+
+	podEndpointList := &egressgatewayv1alpha1.PodEndpointList{}
+	if err := r.List(ctx, podEndpointList); err != nil {
+		return fmt.Errorf("failed to list PodEndpoints: %w", err)
+	}
+	gwConfigKey := types.NamespacedName{Namespace: gwConfig.Namespace, Name: gwConfig.Name}
+	var pinned []egressgatewayv1alpha1.PodEndpoint
+	for _, podEndpoint := range podEndpointList.Items {
+		if podEndpoint.Spec.EgressSourceIp != "" && podEndpoint.DeletionTimestamp.IsZero() &&
+			podEndpoint.GetStaticGatewayConfigurationKey() == gwConfigKey && gwConfig.AllowsNamespace(podEndpoint.Namespace) {
+			pinned = append(pinned, podEndpoint)
+		}
+	}
+
+	if len(pinned) == 0 {
+		exists, err := r.IPTables.ChainExists(utiliptables.TableNAT, chain)
+		if err != nil || !exists {
+			return err
+		}
+		log.Info("Releasing egress source IPs", "chain", chain)
+		if err := r.IPTables.DeleteRule(utiliptables.TableNAT, utiliptables.ChainPostrouting, jumpRule...); err != nil {
+			return fmt.Errorf("failed to delete jump rule to chain %s: %w", chain, err)
+		}
+		if err := r.IPTables.FlushChain(utiliptables.TableNAT, chain); err != nil {
+			return fmt.Errorf("failed to flush chain %s: %w", chain, err)
+		}
+		return r.IPTables.DeleteChain(utiliptables.TableNAT, chain)
+	}
+
+	// public IPs of ipConfigs are only known after the gateway prefix is provisioned, so always query the latest
+	metadata, err := r.instanceMetadata()
+	if err != nil {
+		return fmt.Errorf("failed to get instance metadata: %w", err)
+	}
+	rules, err := getEgressSourceIPRules(mark, pinned, getPrivateIPsByPublicIP(metadata))
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.IPTables.EnsureChain(utiliptables.TableNAT, chain); err != nil {
+		return fmt.Errorf("failed to ensure chain %s: %w", chain, err)
+	}
+	// the jump rule must precede the round robin sNAT rules of the gateway, re-prepend it only when they were
+	// recreated before it, so that pinned connections are never sNATed to other IPs in between
+	precedes, err := r.isJumpBeforeSNAT(mark, chain)
+	if err != nil {
+		return err
+	}
+	if !precedes {
+		if err := r.IPTables.DeleteRule(utiliptables.TableNAT, utiliptables.ChainPostrouting, jumpRule...); err != nil {
+			return fmt.Errorf("failed to delete jump rule to chain %s: %w", chain, err)
+		}
+		if _, err := r.IPTables.EnsureRule(utiliptables.Prepend, utiliptables.TableNAT, utiliptables.ChainPostrouting, jumpRule...); err != nil {
+			return fmt.Errorf("failed to ensure jump rule to chain %s: %w", chain, err)
+		}
+	}
+	lines := bytes.NewBuffer(nil)
+	writeLine(lines, "*"+string(utiliptables.TableNAT))
+	writeLine(lines, utiliptables.MakeChainLine(chain))
+	for _, rule := range rules {
+		writeRule(lines, string(utiliptables.Append), chain, rule...)
+	}
+	writeLine(lines, "COMMIT")
+	log.Info("Restoring egress source IP rules", "rules", lines.String())
+	if err := r.IPTables.RestoreAll(lines.Bytes(), utiliptables.NoFlushTables, utiliptables.NoRestoreCounters); err != nil {
+		return fmt.Errorf("failed to restore rules in chain %s: %w", chain, err)
+	}
+	return nil
+}
+
+// isJumpBeforeSNAT returns whether the jump rule to chain exists in nat POSTROUTING before the jump rule to the round
+// robin sNAT chain of the gateway with mark. Chains preceding it only match distinct pods, so their order among each
+// other doesn't matter.
+func (r *PodEndpointReconciler) isJumpBeforeSNAT(mark int, chain utiliptables.Chain) (bool, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := r.IPTables.SaveInto(utiliptables.TableNAT, buf); err != nil {
+		return false, fmt.Errorf("failed to save nat table: %w", err)
+	}
+	prefix := "-A " + string(utiliptables.ChainPostrouting) + " "
+	snatChain := fmt.Sprintf("EGRESS-GATEWAY-SNAT-%d", mark)
+	for _, line := range strings.Split(buf.String(), "\n") {
+		fields := strings.Fields(line)
+		if !strings.HasPrefix(line, prefix) || len(fields) < 2 || fields[len(fields)-2] != "-j" {
+			continue
+		}
+		switch fields[len(fields)-1] {
+		case string(chain):
+			return true, nil
+		case snatChain:
+			return false, nil
+		}
+	}
+	return false, nil
+}
+
+// getEgressSourceIPRules returns sNAT rules of pinned pods whose egress source IP is associated with this node
+func getEgressSourceIPRules(mark int, pinned []egressgatewayv1alpha1.PodEndpoint, privateIPs map[string]string) ([][]string, error) {
+	// keep rules stable regardless of list order
+	slices.SortFunc(pinned, func(a, b egressgatewayv1alpha1.PodEndpoint) int {
+		return strings.Compare(a.Namespace+"/"+a.Name, b.Namespace+"/"+b.Name)
+	})
+	var rules [][]string
+	for _, podEndpoint := range pinned {
+		privateIP, ok := privateIPs[podEndpoint.Spec.EgressSourceIp]
+		if !ok {
+			continue
+		}
+		_, podIPNet, err := net.ParseCIDR(podEndpoint.Spec.PodIpAddress)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse IP address of PodEndpoint %s/%s: %w", podEndpoint.Namespace, podEndpoint.Name, err)
+		}
+		rules = append(rules, []string{"-s", podIPNet.String(), "-o", consts.HostLinkName, "-m", "connmark", "--mark", fmt.Sprintf("%d", mark), "-j", "SNAT", "--to-source", privateIP})
+	}
+	return rules, nil
+}
+
+// getVMPublicIPs returns the public IPs associated with snatIPs of this node. Public IPs of ipConfigs are only known
+// after the gateway prefix is provisioned, so the latest instance metadata is queried.
+func (r *StaticGatewayConfigurationReconciler) getVMPublicIPs(snatIPs []string) ([]string, error) {
+	metadata, err := r.instanceMetadata()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get instance metadata: %w", err)
+	}
+	var publicIPs []string
+	for publicIP, privateIP := range getPrivateIPsByPublicIP(metadata) {
+		if slices.Contains(snatIPs, privateIP) {
+			publicIPs = append(publicIPs, publicIP)
+		}
+	}
+	slices.Sort(publicIPs)
+	return publicIPs, nil
+}
+
+// getPrivateIPsByPublicIP returns private IPs of this node keyed by their associated public IPs
+func getPrivateIPsByPublicIP(metadata *imds.InstanceMetadata) map[string]string {
+	privateIPs := make(map[string]string)
+	if metadata == nil || metadata.Network == nil {
+		return privateIPs
+	}
+	for _, nic := range metadata.Network.Interface {
+		for _, ip := range nic.IPv4.IPAddress {
+			if ip.PublicIP != "" {
+				privateIPs[ip.PublicIP] = ip.PrivateIP
+			}
+		}
+	}
+	return privateIPs
+}
@@ -0,0 +1,143 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"bytes"
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	utiliptables "k8s.io/kubernetes/pkg/util/iptables"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/imds"
+	fakeiptables "github.com/Azure/kube-egress-gateway/pkg/iptableswrapper"
+)
+
+var _ = Describe("Daemon egress source IP unit tests", func() {
+	var (
+		r        *PodEndpointReconciler
+		fipt     *fakeiptables.FakeIPTables
+		gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration
+		metadata = &imds.InstanceMetadata{
+			Network: &imds.NetworkMetadata{
+				Interface: []imds.NetworkInterface{{
+					IPv4: imds.IPData{IPAddress: []imds.IPAddress{
+						{PrivateIP: "10.0.0.5"},
+						{PrivateIP: "10.0.0.6", PublicIP: "1.2.3.4"},
+					}},
+				}},
+			},
+		}
+	)
+
+	getTestReconciler := func(objects ...runtime.Object) {
+		cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(objects...).Build()
+		fipt = fakeiptables.NewFake()
+		r = &PodEndpointReconciler{
+			Client:           cl,
+			IPTables:         fipt,
+			instanceMetadata: func() (*imds.InstanceMetadata, error) { return metadata, nil },
+		}
+	}
+
+	getPinnedPodEndpoint := func(name, podIP, egressSourceIP string) *egressgatewayv1alpha1.PodEndpoint {
+		return &egressgatewayv1alpha1.PodEndpoint{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+			Spec: egressgatewayv1alpha1.PodEndpointSpec{
+				StaticGatewayConfiguration: testName,
+				PodIpAddress:               podIP,
+				EgressSourceIp:             egressSourceIP,
+			},
+		}
+	}
+
+	getNatDump := func() string {
+		buf := bytes.NewBuffer(nil)
+		Expect(fipt.SaveInto(utiliptables.TableNAT, buf)).To(Succeed())
+		return buf.String()
+	}
+
+	BeforeEach(func() {
+		gwConfig = &egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: testName, Namespace: testNamespace},
+			Status:     getTestGwConfigStatus(),
+		}
+	})
+
+	It("should map public IPs to private IPs of this node", func() {
+		Expect(getPrivateIPsByPublicIP(metadata)).To(Equal(map[string]string{"1.2.3.4": "10.0.0.6"}))
+		Expect(getPrivateIPsByPublicIP(&imds.InstanceMetadata{})).To(BeEmpty())
+	})
+
+	It("should sNAT pinned pods to the private IP of their egress source IP", func() {
+		otherGateway := getPinnedPodEndpoint("pod3", "10.244.0.7/32", "1.2.3.4")
+		otherGateway.Spec.StaticGatewayConfiguration = "other"
+		getTestReconciler(
+			getPinnedPodEndpoint("pod1", "10.244.0.5/32", "1.2.3.4"),
+			// served by another gateway node
+			getPinnedPodEndpoint("pod2", "10.244.0.6/32", "1.2.3.5"),
+			otherGateway,
+			getPinnedPodEndpoint("pod4", "10.244.0.8/32", ""),
+		)
+		Expect(r.ensureEgressSourceIPs(context.TODO(), gwConfig)).To(Succeed())
+		dump := getNatDump()
+		Expect(dump).To(ContainSubstring("-A POSTROUTING -m comment --comment kube-egress-gateway pin egress source IP of pods on gateway link wg-6000 -j EGRESS-GATEWAY-PIN-6000\n"))
+		Expect(dump).To(ContainSubstring("-A EGRESS-GATEWAY-PIN-6000 -s 10.244.0.5/32 -o host0 -m connmark --mark 6000 -j SNAT --to-source 10.0.0.6\nCOMMIT\n"))
+	})
+
+	It("should keep the jump rule before sNAT rules of the gateway", func() {
+		getTestReconciler(getPinnedPodEndpoint("pod1", "10.244.0.5/32", "1.2.3.4"))
+		Expect(r.ensureEgressSourceIPs(context.TODO(), gwConfig)).To(Succeed())
+		_, err := fipt.EnsureChain(utiliptables.TableNAT, "EGRESS-GATEWAY-SNAT-6000")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = fipt.EnsureRule(utiliptables.Prepend, utiliptables.TableNAT, utiliptables.ChainPostrouting, "-j", "EGRESS-GATEWAY-SNAT-6000")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.ensureEgressSourceIPs(context.TODO(), gwConfig)).To(Succeed())
+		Expect(getNatDump()).To(ContainSubstring("-A POSTROUTING -m comment --comment kube-egress-gateway pin egress source IP of pods on gateway link wg-6000 -j EGRESS-GATEWAY-PIN-6000\n" +
+			"-A POSTROUTING -j EGRESS-GATEWAY-SNAT-6000\n"))
+	})
+
+	It("should not move the jump rule when it precedes sNAT rules of the gateway", func() {
+		getTestReconciler(getPinnedPodEndpoint("pod1", "10.244.0.5/32", "1.2.3.4"))
+		Expect(r.ensureEgressSourceIPs(context.TODO(), gwConfig)).To(Succeed())
+		_, err := fipt.EnsureChain(utiliptables.TableNAT, "EGRESS-GATEWAY-SNAT-6000")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = fipt.EnsureRule(utiliptables.Append, utiliptables.TableNAT, utiliptables.ChainPostrouting, "-j", "EGRESS-GATEWAY-SNAT-6000")
+		Expect(err).NotTo(HaveOccurred())
+		// rules of other chains may come first
+		_, err = fipt.EnsureChain(utiliptables.TableNAT, "KUBE-POSTROUTING")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = fipt.EnsureRule(utiliptables.Prepend, utiliptables.TableNAT, utiliptables.ChainPostrouting, "-j", "KUBE-POSTROUTING")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.ensureEgressSourceIPs(context.TODO(), gwConfig)).To(Succeed())
+		Expect(getNatDump()).To(ContainSubstring("-A POSTROUTING -j KUBE-POSTROUTING\n" +
+			"-A POSTROUTING -m comment --comment kube-egress-gateway pin egress source IP of pods on gateway link wg-6000 -j EGRESS-GATEWAY-PIN-6000\n" +
+			"-A POSTROUTING -j EGRESS-GATEWAY-SNAT-6000\n"))
+	})
+
+	It("should report public IPs associated with sNAT IPs of the gateway", func() {
+		sgcReconciler := &StaticGatewayConfigurationReconciler{
+			instanceMetadata: func() (*imds.InstanceMetadata, error) { return metadata, nil },
+		}
+		Expect(sgcReconciler.getVMPublicIPs([]string{"10.0.0.6"})).To(Equal([]string{"1.2.3.4"}))
+		Expect(sgcReconciler.getVMPublicIPs([]string{"10.0.0.5"})).To(BeEmpty())
+	})
+
+	It("should release egress source IP when PodEndpoint is deleted", func() {
+		podEndpoint := getPinnedPodEndpoint("pod1", "10.244.0.5/32", "1.2.3.4")
+		getTestReconciler(podEndpoint)
+		Expect(r.ensureEgressSourceIPs(context.TODO(), gwConfig)).To(Succeed())
+		Expect(getNatDump()).To(ContainSubstring("EGRESS-GATEWAY-PIN-6000"))
+
+		Expect(r.Delete(context.TODO(), podEndpoint)).To(Succeed())
+		Expect(r.ensureEgressSourceIPs(context.TODO(), gwConfig)).To(Succeed())
+		Expect(getNatDump()).NotTo(ContainSubstring("EGRESS-GATEWAY-PIN-6000"))
+	})
+})
@@ -0,0 +1,289 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/go-logr/logr"
+	"github.com/vishvananda/netlink"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/conntrackwrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper"
+)
+
+// defaultFlowLogInterval is how often the conntrack table is scanned for new flows. Conntrack keeps closed
+// tcp connections for 2 minutes and idle udp flows for 30 seconds, so short-lived flows are still seen.
+const defaultFlowLogInterval = 10 * time.Second
+
+// FlowRecord is an egress flow of a pod through the gateway
+type FlowRecord struct {
+	Time         time.Time `json:"time"`
+	Gateway      string    `json:"gateway"`
+	PodNamespace string    `json:"podNamespace,omitempty"`
+	Pod          string    `json:"pod,omitempty"`
+	Protocol     string    `json:"protocol"`
+	SourceIP     string    `json:"sourceIP"`
+	SourcePort   uint16    `json:"sourcePort"`
+	DestIP       string    `json:"destinationIP"`
+	DestPort     uint16    `json:"destinationPort"`
+	EgressIP     string    `json:"egressIP"`
+	EgressPort   uint16    `json:"egressPort"`
+}
+
+// flowLogGateway is a gateway with flow logging enabled on this node
+type flowLogGateway struct {
+	key        types.NamespacedName
+	netnsName  string
+	sampleRate uint32
+	// pod IP -> PodEndpoint
+	pods map[netip.Addr]types.NamespacedName
+}
+
+// FlowLogger periodically logs new egress flows of gateways with flowLogSampleRate set. Flows are read from
+// the conntrack table of the gateway namespace and attributed to gateways by the connection mark set on
+// packets from their wireguard links.
+type FlowLogger struct {
+	client.Client
+	NetNS     netnswrapper.Interface
+	Conntrack conntrackwrapper.Interface
+	// NetnsPerGateway configures each gateway in its own network namespace
+	NetnsPerGateway bool
+	// Writer receives flow records as JSON lines, records are written to the daemon log when nil
+	Writer   io.Writer
+	Interval time.Duration
+
+	// flows seen in the previous scan, so that long running flows are logged only once
+	seen map[string]struct{}
+	now  func() time.Time
+}
+
+func NewFlowLogger(c client.Client, writer io.Writer) *FlowLogger {
+	return &FlowLogger{
+		Client:    c,
+		NetNS:     netnswrapper.NewNetNS(),
+		Conntrack: conntrackwrapper.NewConntrack(),
+		Writer:    writer,
+		Interval:  defaultFlowLogInterval,
+		seen:      make(map[string]struct{}),
+		now:       time.Now,
+	}
+}
+
+// Start logs new flows every interval until ctx is done.
+func (l *FlowLogger) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := l.scan(ctx); err != nil {
+			log.FromContext(ctx).Error(err, "failed to log gateway flows")
+		}
+	}, l.Interval)
+	return nil
+}
+
+func (l *FlowLogger) scan(ctx context.Context) error {
+	gateways, err := l.getFlowLogGateways(ctx)
+	if err != nil {
+		return err
+	}
+	if len(gateways) == 0 {
+		l.seen = make(map[string]struct{})
+		return nil
+	}
+
+	// each network namespace has its own conntrack table
+	nsNames := make(map[string]struct{})
+	for _, gateway := range gateways {
+		nsNames[gateway.netnsName] = struct{}{}
+	}
+	var flows []*netlink.ConntrackFlow
+	for nsName := range nsNames {
+		nsFlows, err := l.listFlows(nsName)
+		if err != nil {
+			return err
+		}
+		flows = append(flows, nsFlows...)
+	}
+
+	seen := make(map[string]struct{}, len(l.seen))
+	for _, flow := range flows {
+		gateway, ok := gateways[flow.Mark]
+		if !ok {
+			continue
+		}
+		key := flowKey(flow)
+		seen[key] = struct{}{}
+		if _, ok := l.seen[key]; ok || !sampleFlow(key, gateway.sampleRate) {
+			continue
+		}
+		l.write(ctx, l.newFlowRecord(gateway, flow))
+	}
+	l.seen = seen
+	return nil
+}
+
+func (l *FlowLogger) listFlows(nsName string) ([]*netlink.ConntrackFlow, error) {
+	gwns, err := l.NetNS.GetNS(nsName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network namespace %s: %w", nsName, err)
+	}
+	defer gwns.Close()
+
+	var flows []*netlink.ConntrackFlow
+	if err := gwns.Do(func(nn ns.NetNS) error {
+		for _, family := range []netlink.InetFamily{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+			familyFlows, err := l.Conntrack.ConntrackTableList(netlink.ConntrackTable, family)
+			if err != nil {
+				return fmt.Errorf("failed to list conntrack table: %w", err)
+			}
+			flows = append(flows, familyFlows...)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return flows, nil
+}
+
+// getFlowLogGateways returns gateways on this node with flow logging enabled, keyed by their packet mark
+func (l *FlowLogger) getFlowLogGateways(ctx context.Context) (map[uint32]*flowLogGateway, error) {
+	gwConfigList := &egressgatewayv1alpha1.StaticGatewayConfigurationList{}
+	if err := l.List(ctx, gwConfigList); err != nil {
+		return nil, fmt.Errorf("failed to list staticGatewayConfigurations: %w", err)
+	}
+	gateways := make(map[uint32]*flowLogGateway)
+	byKey := make(map[types.NamespacedName]*flowLogGateway)
+	for i := range gwConfigList.Items {
+		gwConfig := &gwConfigList.Items[i]
+		if gwConfig.Spec.FlowLogSampleRate <= 0 || !isReady(gwConfig) || !applyToNode(gwConfig) || !gwConfig.DeletionTimestamp.IsZero() {
+			continue
+		}
+		mark, err := getPacketMark(getWireguardInterfaceName(gwConfig))
+		if err != nil {
+			return nil, err
+		}
+		gateway := &flowLogGateway{
+			key:        client.ObjectKeyFromObject(gwConfig),
+			netnsName:  getGatewayNetnsName(gwConfig, l.NetnsPerGateway),
+			sampleRate: uint32(gwConfig.Spec.FlowLogSampleRate),
+			pods:       make(map[netip.Addr]types.NamespacedName),
+		}
+		gateways[uint32(mark)] = gateway
+		byKey[gateway.key] = gateway
+	}
+	if len(gateways) == 0 {
+		return gateways, nil
+	}
+
+	podEndpointList := &egressgatewayv1alpha1.PodEndpointList{}
+	if err := l.List(ctx, podEndpointList); err != nil {
+		return nil, fmt.Errorf("failed to list PodEndpoints: %w", err)
+	}
+	for _, podEndpoint := range podEndpointList.Items {
+		gateway, ok := byKey[podEndpoint.GetStaticGatewayConfigurationKey()]
+		if !ok {
+			continue
+		}
+		for _, cidr := range []string{podEndpoint.Spec.PodIpAddress, podEndpoint.Spec.PodIpv6Address} {
+			if prefix, err := netip.ParsePrefix(cidr); err == nil {
+				gateway.pods[prefix.Addr()] = client.ObjectKeyFromObject(&podEndpoint)
+			}
+		}
+	}
+	return gateways, nil
+}
+
+func (l *FlowLogger) newFlowRecord(gateway *flowLogGateway, flow *netlink.ConntrackFlow) *FlowRecord {
+	record := &FlowRecord{
+		Time:       l.now().UTC(),
+		Gateway:    gateway.key.String(),
+		Protocol:   protocolName(flow.Forward.Protocol),
+		SourceIP:   flow.Forward.SrcIP.String(),
+		SourcePort: flow.Forward.SrcPort,
+		DestIP:     flow.Forward.DstIP.String(),
+		DestPort:   flow.Forward.DstPort,
+		// replies of sNATed flows are addressed to the egress IP and port
+		EgressIP:   flow.Reverse.DstIP.String(),
+		EgressPort: flow.Reverse.DstPort,
+	}
+	if srcIP, ok := netip.AddrFromSlice(flow.Forward.SrcIP); ok {
+		if pod, ok := gateway.pods[srcIP.Unmap()]; ok {
+			record.PodNamespace, record.Pod = pod.Namespace, pod.Name
+		}
+	}
+	return record
+}
+
+func (l *FlowLogger) write(ctx context.Context, record *FlowRecord) {
+	if l.Writer == nil {
+		logFlowRecord(log.FromContext(ctx).WithName("flow-log"), record)
+		return
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "failed to marshal flow record")
+		return
+	}
+	if _, err := l.Writer.Write(append(line, '\n')); err != nil {
+		log.FromContext(ctx).Error(err, "failed to write flow record")
+	}
+}
+
+func logFlowRecord(log logr.Logger, record *FlowRecord) {
+	log.Info("Egress flow",
+		"gateway", record.Gateway,
+		"podNamespace", record.PodNamespace,
+		"pod", record.Pod,
+		"protocol", record.Protocol,
+		"sourceIP", record.SourceIP,
+		"sourcePort", record.SourcePort,
+		"destinationIP", record.DestIP,
+		"destinationPort", record.DestPort,
+		"egressIP", record.EgressIP,
+		"egressPort", record.EgressPort)
+}
+
+// flowKey identifies a flow by its original direction tuple
+func flowKey(flow *netlink.ConntrackFlow) string {
+	return fmt.Sprintf("%d %s:%d %s:%d", flow.Forward.Protocol, flow.Forward.SrcIP, flow.Forward.SrcPort, flow.Forward.DstIP, flow.Forward.DstPort)
+}
+
+// sampleFlow picks one of every sampleRate flows, hashing the flow key so that the decision does not depend
+// on the order flows are listed in
+func sampleFlow(key string, sampleRate uint32) bool {
+	if sampleRate <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()%sampleRate == 0
+}
+
+func protocolName(protocol uint8) string {
+	switch protocol {
+	case syscall.IPPROTO_TCP:
+		return "tcp"
+	case syscall.IPPROTO_UDP:
+		return "udp"
+	case syscall.IPPROTO_ICMP:
+		return "icmp"
+	case syscall.IPPROTO_ICMPV6:
+		return "icmpv6"
+	default:
+		return strconv.Itoa(int(protocol))
+	}
+}
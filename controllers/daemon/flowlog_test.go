@@ -0,0 +1,157 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+	"go.uber.org/mock/gomock"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/conntrackwrapper/mockconntrackwrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/imds"
+	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper/mocknetnswrapper"
+)
+
+var _ = Describe("Daemon flow logger unit tests", func() {
+	var (
+		l    *FlowLogger
+		mns  *mocknetnswrapper.MockInterface
+		mct  *mockconntrackwrapper.MockInterface
+		out  *bytes.Buffer
+		now  = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		flow = func(mark uint32, src string, sport uint16, dst string, dport uint16) *netlink.ConntrackFlow {
+			ct := &netlink.ConntrackFlow{Mark: mark}
+			ct.Forward.Protocol = syscall.IPPROTO_TCP
+			ct.Forward.SrcIP, ct.Forward.SrcPort = net.ParseIP(src), sport
+			ct.Forward.DstIP, ct.Forward.DstPort = net.ParseIP(dst), dport
+			ct.Reverse.Protocol = syscall.IPPROTO_TCP
+			ct.Reverse.SrcIP, ct.Reverse.SrcPort = net.ParseIP(dst), dport
+			ct.Reverse.DstIP, ct.Reverse.DstPort = net.ParseIP("20.1.2.3"), 40000+sport
+			return ct
+		}
+	)
+
+	getTestGwConfig := func(name string, port, sampleRate int32) *egressgatewayv1alpha1.StaticGatewayConfiguration {
+		gwConfig := &egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+			Spec: egressgatewayv1alpha1.StaticGatewayConfigurationSpec{
+				GatewayVmssProfile: egressgatewayv1alpha1.GatewayVmssProfile{
+					VmssResourceGroup:  vmssRG,
+					VmssName:           vmssName,
+					PublicIpPrefixSize: 31,
+				},
+				FlowLogSampleRate: sampleRate,
+			},
+			Status: getTestGwConfigStatus(),
+		}
+		gwConfig.Status.GatewayServerProfile.Port = port
+		return gwConfig
+	}
+
+	getTestFlowLogger := func(objects ...runtime.Object) {
+		mctrl := gomock.NewController(GinkgoT())
+		mns = mocknetnswrapper.NewMockInterface(mctrl)
+		mct = mockconntrackwrapper.NewMockInterface(mctrl)
+		out = bytes.NewBuffer(nil)
+		l = NewFlowLogger(fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(objects...).Build(), out)
+		l.NetNS = mns
+		l.Conntrack = mct
+		l.now = func() time.Time { return now }
+	}
+
+	expectFlows := func(flows ...*netlink.ConntrackFlow) {
+		mns.EXPECT().GetNS(gomock.Any()).Return(&mocknetnswrapper.MockNetNS{}, nil)
+		table := netlink.ConntrackTableType(netlink.ConntrackTable)
+		mct.EXPECT().ConntrackTableList(table, netlink.InetFamily(netlink.FAMILY_V4)).Return(flows, nil)
+		mct.EXPECT().ConntrackTableList(table, netlink.InetFamily(netlink.FAMILY_V6)).Return(nil, nil)
+	}
+
+	getRecords := func() []FlowRecord {
+		var records []FlowRecord
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			record := FlowRecord{}
+			Expect(json.Unmarshal([]byte(line), &record)).To(Succeed())
+			records = append(records, record)
+		}
+		out.Reset()
+		return records
+	}
+
+	BeforeEach(func() {
+		nodeMeta = &imds.InstanceMetadata{
+			Compute: &imds.ComputeMetadata{
+				VMScaleSetName:    vmssName,
+				ResourceGroupName: vmssRG,
+			},
+		}
+	})
+
+	It("should not read conntrack table when no gateway enables flow logging", func() {
+		getTestFlowLogger(getTestGwConfig("gw1", 6000, 0))
+		Expect(l.scan(context.Background())).To(Succeed())
+		Expect(out.Len()).To(BeZero())
+	})
+
+	It("should log new flows of gateways with flow logging enabled once", func() {
+		podEndpoint := &egressgatewayv1alpha1.PodEndpoint{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: testNamespace},
+			Spec:       egressgatewayv1alpha1.PodEndpointSpec{StaticGatewayConfiguration: "gw1", PodIpAddress: "10.244.0.5/32"},
+		}
+		getTestFlowLogger(getTestGwConfig("gw1", 6000, 1), getTestGwConfig("gw2", 6001, 0), podEndpoint)
+
+		existing := flow(6000, "10.244.0.5", 1000, "1.1.1.1", 443)
+		expectFlows(existing, flow(6001, "10.244.0.6", 1000, "1.1.1.1", 443), flow(0, "10.0.0.4", 1000, "1.1.1.1", 443))
+		Expect(l.scan(context.Background())).To(Succeed())
+		Expect(getRecords()).To(Equal([]FlowRecord{{
+			Time:         now,
+			Gateway:      testNamespace + "/gw1",
+			PodNamespace: testNamespace,
+			Pod:          "pod1",
+			Protocol:     "tcp",
+			SourceIP:     "10.244.0.5",
+			SourcePort:   1000,
+			DestIP:       "1.1.1.1",
+			DestPort:     443,
+			EgressIP:     "20.1.2.3",
+			EgressPort:   41000,
+		}}))
+
+		expectFlows(existing, flow(6000, "10.244.0.7", 2000, "8.8.8.8", 53))
+		Expect(l.scan(context.Background())).To(Succeed())
+		records := getRecords()
+		Expect(records).To(HaveLen(1))
+		Expect(records[0].SourceIP).To(Equal("10.244.0.7"))
+		Expect(records[0].Pod).To(BeEmpty())
+	})
+
+	It("should sample flows by sample rate", func() {
+		getTestFlowLogger(getTestGwConfig("gw1", 6000, 4))
+		var flows []*netlink.ConntrackFlow
+		for port := uint16(1000); port < 1400; port++ {
+			flows = append(flows, flow(6000, "10.244.0.5", port, "1.1.1.1", 443))
+		}
+		expectFlows(flows...)
+		Expect(l.scan(context.Background())).To(Succeed())
+		records := getRecords()
+		Expect(len(records)).To(BeNumerically(">", 50))
+		Expect(len(records)).To(BeNumerically("<", 150))
+	})
+})
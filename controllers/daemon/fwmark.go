@@ -0,0 +1,118 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+)
+
+// getWireguardFwMark returns the firewall mark of the gateway wireguard link, 0 for none
+func getWireguardFwMark(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) int {
+	if gwConfig.Spec.WireguardFwMark == nil {
+		return 0
+	}
+	return int(gwConfig.Spec.WireguardFwMark.Mark)
+}
+
+// reconcileWireguardFwMarkRule ensures the policy routing rule in host namespace sending wireguard packets with the
+// fwmark of the gateway to its route table. Gateways sharing a mark are expected to use the same route table, rules of
+// marks no longer used are removed by cleanUpWireguardFwMarkRules.
+func (r *StaticGatewayConfigurationReconciler) reconcileWireguardFwMarkRule(ctx context.Context, gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) error {
+	fwMark := gwConfig.Spec.WireguardFwMark
+	if fwMark == nil || fwMark.RouteTable == 0 {
+		return nil
+	}
+	log := log.FromContext(ctx)
+	rules, err := r.Netlink.RuleList(nl.FAMILY_V4)
+	if err != nil {
+		return fmt.Errorf("failed to list route rules: %w", err)
+	}
+	found := false
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Priority != consts.WireguardFwMarkRulePriority || rule.Mark != int(fwMark.Mark) {
+			continue
+		}
+		if rule.Table == int(fwMark.RouteTable) {
+			found = true
+			continue
+		}
+		log.Info("Deleting outdated wireguard fwmark rule", "rule", rule.String())
+		if err := r.Netlink.RuleDel(rule); err != nil {
+			return fmt.Errorf("failed to delete route rule %s: %w", rule, err)
+		}
+	}
+	// recorded before adding, so that a rule added by a failed call is still cleaned up
+	r.wireguardFwMarks.Store(int(fwMark.Mark), struct{}{})
+	if found {
+		return nil
+	}
+	rule := getWireguardFwMarkRule(int(fwMark.Mark), int(fwMark.RouteTable))
+	log.Info("Adding wireguard fwmark rule", "rule", rule.String())
+	if err := r.Netlink.RuleAdd(rule); err != nil {
+		return fmt.Errorf("failed to add route rule %s: %w", rule, err)
+	}
+	return nil
+}
+
+// cleanUpWireguardFwMarkRules removes wireguard fwmark rules in host namespace not wanted by active gateways, keyed by
+// getWireguardFwMarkRuleKey. Only rules of marks this daemon set are removed, marks no longer wanted are forgotten
+// once their rules are gone.
+func (r *StaticGatewayConfigurationReconciler) cleanUpWireguardFwMarkRules(ctx context.Context, wanted map[string]struct{}) error {
+	var marks []int
+	r.wireguardFwMarks.Range(func(key, _ any) bool {
+		marks = append(marks, key.(int))
+		return true
+	})
+	if len(marks) == 0 {
+		return nil
+	}
+	rules, err := r.Netlink.RuleList(nl.FAMILY_V4)
+	if err != nil {
+		return fmt.Errorf("failed to list route rules: %w", err)
+	}
+	wantedMarks := make(map[int]struct{})
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Priority != consts.WireguardFwMarkRulePriority || !slices.Contains(marks, rule.Mark) {
+			continue
+		}
+		if _, ok := wanted[getWireguardFwMarkRuleKey(rule.Mark, rule.Table)]; ok {
+			wantedMarks[rule.Mark] = struct{}{}
+			continue
+		}
+		log.FromContext(ctx).Info("Deleting orphaned wireguard fwmark rule", "rule", rule.String())
+		if err := r.Netlink.RuleDel(rule); err != nil {
+			return fmt.Errorf("failed to delete route rule %s: %w", rule, err)
+		}
+	}
+	for _, mark := range marks {
+		if _, ok := wantedMarks[mark]; !ok {
+			r.wireguardFwMarks.Delete(mark)
+		}
+	}
+	return nil
+}
+
+func getWireguardFwMarkRule(mark, table int) *netlink.Rule {
+	rule := netlink.NewRule()
+	rule.Family = nl.FAMILY_V4
+	rule.Mark = mark
+	rule.Table = table
+	rule.Priority = consts.WireguardFwMarkRulePriority
+	return rule
+}
+
+func getWireguardFwMarkRuleKey(mark, table int) string {
+	return fmt.Sprintf("%d/%d", mark, table)
+}
@@ -0,0 +1,92 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package daemon
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/vishvananda/netlink"
+)
+
+// defaultHostInterfaceName is the host interface used when it is neither configured nor detected
+const defaultHostInterfaceName = "eth0"
+
+// setupHostInterface decides the host interface carrying the gateway ILB IP and default route, unless it is configured with
+// HostInterfaceName. With accelerated networking, the SR-IOV virtual function shares the mac address of the
+// primary NIC and is enslaved to the synthetic interface. Addresses must stay on the synthetic interface, which
+// keeps working when the virtual function is revoked, e.g. during host servicing.
+func (r *StaticGatewayConfigurationReconciler) setupHostInterface(log logr.Logger) error {
+	if r.HostInterfaceName != "" {
+		log.Info("Using configured host interface, skipping accelerated networking detection", "interface", r.HostInterfaceName)
+		return nil
+	}
+	if nodeMeta == nil || nodeMeta.Network == nil || len(nodeMeta.Network.Interface) == 0 || nodeMeta.Network.Interface[0].MacAddress == "" {
+		log.Info("Imds does not provide mac address of the primary NIC, using default host interface", "interface", defaultHostInterfaceName)
+		r.HostInterfaceName = defaultHostInterfaceName
+		return nil
+	}
+	links, err := r.Netlink.LinkList()
+	if err != nil {
+		return fmt.Errorf("failed to list links: %w", err)
+	}
+	name, vf, err := findHostInterface(links, nodeMeta.Network.Interface[0].MacAddress)
+	if err != nil {
+		return err
+	}
+	if vf != "" {
+		log.Info("Accelerated networking detected, using synthetic interface as host interface", "interface", name, "virtualFunction", vf)
+	} else {
+		log.Info("Accelerated networking not detected, using primary NIC as host interface", "interface", name)
+	}
+	r.HostInterfaceName = name
+	return nil
+}
+
+// findHostInterface returns the name of the non-VF interface with the mac address, and the name of its SR-IOV
+// virtual function if accelerated networking is enabled
+func findHostInterface(links []netlink.Link, macAddress string) (string, string, error) {
+	var candidates []netlink.Link
+	for _, link := range links {
+		if normalizeMacAddress(link.Attrs().HardwareAddr.String()) == normalizeMacAddress(macAddress) {
+			candidates = append(candidates, link)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return "", "", fmt.Errorf("no interface found with mac address %s of the primary NIC", macAddress)
+	case 1:
+		return candidates[0].Attrs().Name, "", nil
+	}
+	// the virtual function is enslaved to the synthetic interface
+	var synthetic, vf netlink.Link
+	for _, link := range candidates {
+		for _, other := range candidates {
+			if other.Attrs().MasterIndex == link.Attrs().Index {
+				synthetic, vf = link, other
+			}
+		}
+	}
+	if synthetic == nil {
+		names := make([]string, 0, len(candidates))
+		for _, link := range candidates {
+			names = append(names, link.Attrs().Name)
+		}
+		return "", "", fmt.Errorf("interfaces %s share mac address %s but none is the synthetic interface of the others, "+
+			"set the host interface explicitly", strings.Join(names, ","), macAddress)
+	}
+	return synthetic.Attrs().Name, vf.Attrs().Name, nil
+}
+
+// normalizeMacAddress converts mac addresses of imds (000D3A0A0B0C) and netlink (00:0d:3a:0a:0b:0c) to the same format
+func normalizeMacAddress(mac string) string {
+	return strings.ToLower(strings.NewReplacer(":", "", "-", "").Replace(mac))
+}
+
+func (r *StaticGatewayConfigurationReconciler) hostInterfaceName() string {
+	if r.HostInterfaceName == "" {
+		return defaultHostInterfaceName
+	}
+	return r.HostInterfaceName
+}
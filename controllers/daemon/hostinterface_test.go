@@ -0,0 +1,101 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+	"go.uber.org/mock/gomock"
+
+	"github.com/Azure/kube-egress-gateway/pkg/imds"
+	"github.com/Azure/kube-egress-gateway/pkg/netlinkwrapper/mocknetlinkwrapper"
+)
+
+var _ = Describe("Daemon host interface unit tests", func() {
+	var (
+		mac, _ = net.ParseMAC("00:0d:3a:0a:0b:0c")
+		// synthetic interface and its SR-IOV virtual function with the same mac address
+		eth0  = &netlink.Device{LinkAttrs: netlink.LinkAttrs{Index: 2, Name: "eth0", HardwareAddr: mac}}
+		vf    = &netlink.Device{LinkAttrs: netlink.LinkAttrs{Index: 3, Name: "enP1234s1", HardwareAddr: mac, MasterIndex: 2}}
+		lo    = &netlink.Device{LinkAttrs: netlink.LinkAttrs{Index: 1, Name: "lo"}}
+		other = &netlink.Device{LinkAttrs: netlink.LinkAttrs{Index: 4, Name: "eth1", HardwareAddr: mac}}
+	)
+
+	Context("Test findHostInterface", func() {
+		It("should use the only interface with the mac address", func() {
+			name, vfName, err := findHostInterface([]netlink.Link{lo, eth0}, "000D3A0A0B0C")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(name).To(Equal("eth0"))
+			Expect(vfName).To(BeEmpty())
+		})
+
+		It("should use the synthetic interface with accelerated networking", func() {
+			name, vfName, err := findHostInterface([]netlink.Link{lo, vf, eth0}, "000D3A0A0B0C")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(name).To(Equal("eth0"))
+			Expect(vfName).To(Equal("enP1234s1"))
+		})
+
+		It("should return error when no interface has the mac address", func() {
+			_, _, err := findHostInterface([]netlink.Link{lo}, "000D3A0A0B0C")
+			Expect(err).To(MatchError("no interface found with mac address 000D3A0A0B0C of the primary NIC"))
+		})
+
+		It("should return error when interfaces share the mac address without a synthetic interface", func() {
+			_, _, err := findHostInterface([]netlink.Link{eth0, other}, "000D3A0A0B0C")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("Test setupHostInterface", func() {
+		var (
+			r     *StaticGatewayConfigurationReconciler
+			mctrl *gomock.Controller
+			mnl   *mocknetlinkwrapper.MockInterface
+		)
+
+		BeforeEach(func() {
+			mctrl = gomock.NewController(GinkgoT())
+			mnl = mocknetlinkwrapper.NewMockInterface(mctrl)
+			r = &StaticGatewayConfigurationReconciler{Netlink: mnl}
+			nodeMeta = &imds.InstanceMetadata{
+				Network: &imds.NetworkMetadata{
+					Interface: []imds.NetworkInterface{{MacAddress: "000D3A0A0B0C"}},
+				},
+			}
+		})
+
+		AfterEach(func() {
+			mctrl.Finish()
+		})
+
+		It("should keep configured host interface", func() {
+			r.HostInterfaceName = "eth1"
+			Expect(r.setupHostInterface(logr.Discard())).To(Succeed())
+			Expect(r.hostInterfaceName()).To(Equal("eth1"))
+		})
+
+		It("should detect synthetic interface", func() {
+			mnl.EXPECT().LinkList().Return([]netlink.Link{lo, vf, eth0}, nil)
+			Expect(r.setupHostInterface(logr.Discard())).To(Succeed())
+			Expect(r.hostInterfaceName()).To(Equal("eth0"))
+		})
+
+		It("should use default host interface without mac address from imds", func() {
+			nodeMeta.Network.Interface = nil
+			Expect(r.setupHostInterface(logr.Discard())).To(Succeed())
+			Expect(r.hostInterfaceName()).To(Equal(defaultHostInterfaceName))
+		})
+
+		It("should return error when failing to list links", func() {
+			mnl.EXPECT().LinkList().Return(nil, fmt.Errorf("failed"))
+			Expect(r.setupHostInterface(logr.Discard())).To(MatchError("failed to list links: failed"))
+		})
+	})
+})
@@ -0,0 +1,334 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/coreos/go-iptables/iptables"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/iptableswrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/netlinkwrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/wgctrlwrapper"
+)
+
+const (
+	// peerActiveTimeout is how long a peer is considered active after its latest handshake,
+	// wireguard stops using a session after 180 seconds without a new handshake
+	peerActiveTimeout = 3 * time.Minute
+	// collectTimeout bounds the time spent listing gateways on each scrape
+	collectTimeout = 10 * time.Second
+)
+
+var (
+	gatewayLabels           = []string{"namespace", "name"}
+	gatewayPodLabels        = []string{"namespace", "name", "pod_namespace", "pod"}
+	gatewayConnectionLabels = []string{"namespace", "name", "action"}
+
+	gatewayReceiveBytesDesc = prometheus.NewDesc(
+		"gateway_wireguard_receive_bytes_total",
+		"Number of bytes received from current wireguard peers of the static egress gateway",
+		gatewayLabels, nil,
+	)
+	gatewayTransmitBytesDesc = prometheus.NewDesc(
+		"gateway_wireguard_transmit_bytes_total",
+		"Number of bytes sent to current wireguard peers of the static egress gateway",
+		gatewayLabels, nil,
+	)
+	gatewayReceivePacketsDesc = prometheus.NewDesc(
+		"gateway_wireguard_receive_packets_total",
+		"Number of packets received on the wireguard interface of the static egress gateway",
+		gatewayLabels, nil,
+	)
+	gatewayTransmitPacketsDesc = prometheus.NewDesc(
+		"gateway_wireguard_transmit_packets_total",
+		"Number of packets sent on the wireguard interface of the static egress gateway",
+		gatewayLabels, nil,
+	)
+	gatewayActivePeersDesc = prometheus.NewDesc(
+		"gateway_wireguard_active_peers",
+		"Number of wireguard peers of the static egress gateway with a recent handshake",
+		gatewayLabels, nil,
+	)
+	gatewayDroppedPacketsDesc = prometheus.NewDesc(
+		"gateway_dropped_packets_total",
+		"Number of packets from the wireguard interface of the static egress gateway dropped by destination port filtering",
+		gatewayLabels, nil,
+	)
+	gatewayConnectionsDesc = prometheus.NewDesc(
+		"gateway_connections_total",
+		"Number of connections from the wireguard interface of the static egress gateway, by action: "+
+			"snat for connections sNATed to the egress IP, preserve_source_ip for connections to preserveSourceIpCidrs",
+		gatewayConnectionLabels, nil,
+	)
+	gatewayPodReceiveBytesDesc = prometheus.NewDesc(
+		"gateway_pod_wireguard_receive_bytes_total",
+		"Number of bytes received from the wireguard peer of a pod on this gateway node, i.e. egress traffic sent by the pod",
+		gatewayPodLabels, nil,
+	)
+	gatewayPodTransmitBytesDesc = prometheus.NewDesc(
+		"gateway_pod_wireguard_transmit_bytes_total",
+		"Number of bytes sent to the wireguard peer of a pod on this gateway node, i.e. return traffic received by the pod",
+		gatewayPodLabels, nil,
+	)
+)
+
+var _ prometheus.Collector = &GatewayMetricsCollector{}
+
+// GatewayMetricsCollector collects wireguard traffic statistics of static egress gateways on this node
+type GatewayMetricsCollector struct {
+	client.Reader
+	Netlink netlinkwrapper.Interface
+	NetNS   netnswrapper.Interface
+	WgCtrl  wgctrlwrapper.Interface
+	// NetnsPerGateway configures each gateway in its own network namespace
+	NetnsPerGateway bool
+	// IPTables reads packet counters of iptables rules the daemon configures for each gateway
+	IPTables iptableswrapper.Interface
+	// PodMetrics reports traffic statistics of each pod peer, labeled with the pod namespace and name.
+	// It adds a series per pod and gateway node, so it is disabled by default.
+	PodMetrics bool
+
+	now func() time.Time
+}
+
+func NewGatewayMetricsCollector(reader client.Reader, podMetrics bool) *GatewayMetricsCollector {
+	return &GatewayMetricsCollector{
+		Reader:     reader,
+		Netlink:    netlinkwrapper.NewNetLink(),
+		NetNS:      netnswrapper.NewNetNS(),
+		WgCtrl:     wgctrlwrapper.NewWgCtrl(),
+		IPTables:   iptableswrapper.NewIPTables(),
+		PodMetrics: podMetrics,
+		now:        time.Now,
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *GatewayMetricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- gatewayReceiveBytesDesc
+	ch <- gatewayTransmitBytesDesc
+	ch <- gatewayReceivePacketsDesc
+	ch <- gatewayTransmitPacketsDesc
+	ch <- gatewayActivePeersDesc
+	ch <- gatewayDroppedPacketsDesc
+	ch <- gatewayConnectionsDesc
+	if c.PodMetrics {
+		ch <- gatewayPodReceiveBytesDesc
+		ch <- gatewayPodTransmitBytesDesc
+	}
+}
+
+// Collect implements prometheus.Collector
+func (c *GatewayMetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+	log := log.FromContext(ctx).WithName("gateway-metrics")
+
+	gwConfigList := &egressgatewayv1alpha1.StaticGatewayConfigurationList{}
+	if err := c.List(ctx, gwConfigList); err != nil {
+		log.Error(err, "failed to list staticGatewayConfigurations")
+		return
+	}
+	var gwConfigs []*egressgatewayv1alpha1.StaticGatewayConfiguration
+	for i := range gwConfigList.Items {
+		gwConfig := &gwConfigList.Items[i]
+		if isReady(gwConfig) && applyToNode(gwConfig) && gwConfig.ObjectMeta.DeletionTimestamp.IsZero() {
+			gwConfigs = append(gwConfigs, gwConfig)
+		}
+	}
+	if len(gwConfigs) == 0 {
+		return
+	}
+
+	var podEndpoints map[string]map[string]string
+	if c.PodMetrics {
+		var err error
+		if podEndpoints, err = c.getPodEndpointsByPeer(ctx); err != nil {
+			// gateway level metrics are still reported
+			log.Error(err, "failed to get PodEndpoints of wireguard peers")
+		}
+	}
+
+	for nsName, nsGwConfigs := range groupByNetns(gwConfigs, c.NetnsPerGateway) {
+		c.collectNetns(ch, log, nsName, nsGwConfigs, podEndpoints)
+	}
+}
+
+// collectNetns collects metrics of gateways configured in the network namespace
+func (c *GatewayMetricsCollector) collectNetns(
+	ch chan<- prometheus.Metric,
+	log logr.Logger,
+	nsName string,
+	gwConfigs []*egressgatewayv1alpha1.StaticGatewayConfiguration,
+	podEndpoints map[string]map[string]string,
+) {
+	gwns, err := c.NetNS.GetNS(nsName)
+	if err != nil {
+		log.Error(err, "failed to get gateway network namespace", "netns", nsName)
+		return
+	}
+	defer gwns.Close()
+
+	if err := gwns.Do(func(nn ns.NetNS) error {
+		wgClient, err := c.WgCtrl.New()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = wgClient.Close() }()
+
+		var ipts []iptableswrapper.IpTables
+		for _, proto := range []iptables.Protocol{iptables.ProtocolIPv4, iptables.ProtocolIPv6} {
+			ipt, err := c.IPTables.NewWithProtocol(proto)
+			if err != nil {
+				return err
+			}
+			ipts = append(ipts, ipt)
+		}
+
+		for _, gwConfig := range gwConfigs {
+			wglinkName := getWireguardInterfaceName(gwConfig)
+			labels := []string{gwConfig.Namespace, gwConfig.Name}
+
+			device, err := wgClient.Device(wglinkName)
+			if err != nil {
+				// do not block collecting metrics of other gateways
+				log.Error(err, "failed to get wireguard device", "wglink", wglinkName)
+				continue
+			}
+			var rxBytes, txBytes int64
+			activePeers := 0
+			for _, peer := range device.Peers {
+				rxBytes += peer.ReceiveBytes
+				txBytes += peer.TransmitBytes
+				if c.now().Sub(peer.LastHandshakeTime) < peerActiveTimeout {
+					activePeers++
+				}
+				podEndpoint, ok := podEndpoints[wglinkName][peer.PublicKey.String()]
+				if !ok {
+					continue
+				}
+				podNamespace, podName, found := strings.Cut(podEndpoint, "/")
+				if !found {
+					continue
+				}
+				podLabels := []string{gwConfig.Namespace, gwConfig.Name, podNamespace, podName}
+				ch <- prometheus.MustNewConstMetric(gatewayPodReceiveBytesDesc, prometheus.CounterValue, float64(peer.ReceiveBytes), podLabels...)
+				ch <- prometheus.MustNewConstMetric(gatewayPodTransmitBytesDesc, prometheus.CounterValue, float64(peer.TransmitBytes), podLabels...)
+			}
+			ch <- prometheus.MustNewConstMetric(gatewayReceiveBytesDesc, prometheus.CounterValue, float64(rxBytes), labels...)
+			ch <- prometheus.MustNewConstMetric(gatewayTransmitBytesDesc, prometheus.CounterValue, float64(txBytes), labels...)
+			ch <- prometheus.MustNewConstMetric(gatewayActivePeersDesc, prometheus.GaugeValue, float64(activePeers), labels...)
+
+			wgLink, err := c.Netlink.LinkByName(wglinkName)
+			if err != nil {
+				log.Error(err, "failed to get wireguard link", "wglink", wglinkName)
+				continue
+			}
+			if stats := wgLink.Attrs().Statistics; stats != nil {
+				ch <- prometheus.MustNewConstMetric(gatewayReceivePacketsDesc, prometheus.CounterValue, float64(stats.RxPackets), labels...)
+				ch <- prometheus.MustNewConstMetric(gatewayTransmitPacketsDesc, prometheus.CounterValue, float64(stats.TxPackets), labels...)
+			}
+
+			counters, err := getRuleCounters(ipts, wglinkName)
+			if err != nil {
+				log.Error(err, "failed to get iptables rule counters", "wglink", wglinkName)
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(gatewayDroppedPacketsDesc, prometheus.CounterValue, float64(counters.dropped), labels...)
+			ch <- prometheus.MustNewConstMetric(gatewayConnectionsDesc, prometheus.CounterValue, float64(counters.snat), gwConfig.Namespace, gwConfig.Name, "snat")
+			ch <- prometheus.MustNewConstMetric(gatewayConnectionsDesc, prometheus.CounterValue, float64(counters.preserveSourceIP), gwConfig.Namespace, gwConfig.Name, "preserve_source_ip")
+		}
+		return nil
+	}); err != nil {
+		log.Error(err, "failed to collect gateway metrics")
+	}
+}
+
+// ruleCounters are packet counters of iptables rules of a gateway, summed over IPv4 and IPv6
+type ruleCounters struct {
+	// packets dropped by the destination port filter
+	dropped uint64
+	// connections marked for sNAT, only the first packet of a connection traverses the nat table
+	snat uint64
+	// connections to preserveSourceIpCidrs, which are left unmarked
+	preserveSourceIP uint64
+}
+
+// getRuleCounters reads packet counters of the destination port filter and mark chains of the gateway. Chains
+// are only restored when their rules change, the counters start over from zero then and when the daemon restarts.
+func getRuleCounters(ipts []iptableswrapper.IpTables, wglinkName string) (*ruleCounters, error) {
+	mark, err := getPacketMark(wglinkName)
+	if err != nil {
+		return nil, err
+	}
+	counters := &ruleCounters{}
+	for _, ipt := range ipts {
+		stats, err := listChainStats(ipt, "filter", fmt.Sprintf("EGRESS-GATEWAY-PORTS-%d", mark))
+		if err != nil {
+			return nil, err
+		}
+		for _, stat := range stats {
+			if stat.Target == "DROP" {
+				counters.dropped += stat.Packets
+			}
+		}
+		stats, err = listChainStats(ipt, "nat", fmt.Sprintf("EGRESS-GATEWAY-MARK-%d", mark))
+		if err != nil {
+			return nil, err
+		}
+		for _, stat := range stats {
+			switch stat.Target {
+			case "CONNMARK":
+				counters.snat += stat.Packets
+			case "RETURN":
+				counters.preserveSourceIP += stat.Packets
+			}
+		}
+	}
+	return counters, nil
+}
+
+// listChainStats lists counters of rules in the chain, the chain does not exist when its feature is not
+// configured on the gateway or the gateway has no address of the IP family
+func listChainStats(ipt iptableswrapper.IpTables, table, chain string) ([]iptables.Stat, error) {
+	stats, err := ipt.StructuredStats(table, chain)
+	if err != nil {
+		var iptErr *iptables.Error
+		if errors.As(err, &iptErr) && iptErr.IsNotExist() {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list counters of %s chain %s: %w", table, chain, err)
+	}
+	return stats, nil
+}
+
+// getPodEndpointsByPeer returns the PodEndpoint in <namespace>/<name> pattern of each wireguard peer
+// configured on this node, keyed by wireguard interface name and peer public key. PodEndpoint has the
+// same namespace/name as its pod.
+func (c *GatewayMetricsCollector) getPodEndpointsByPeer(ctx context.Context) (map[string]map[string]string, error) {
+	gwStatus := &egressgatewayv1alpha1.GatewayStatus{}
+	if err := c.Get(ctx, getGatewayStatusKey(), gwStatus); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	podEndpoints := make(map[string]map[string]string)
+	for _, peerConfig := range gwStatus.Spec.ReadyPeerConfigurations {
+		if _, ok := podEndpoints[peerConfig.InterfaceName]; !ok {
+			podEndpoints[peerConfig.InterfaceName] = make(map[string]string)
+		}
+		podEndpoints[peerConfig.InterfaceName][peerConfig.PublicKey] = peerConfig.PodEndpoint
+	}
+	return podEndpoints, nil
+}
@@ -0,0 +1,301 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-iptables/iptables"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/vishvananda/netlink"
+	"go.uber.org/mock/gomock"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/imds"
+	"github.com/Azure/kube-egress-gateway/pkg/iptableswrapper/mockiptableswrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/netlinkwrapper/mocknetlinkwrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper/mocknetnswrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/wgctrlwrapper/mockwgctrlwrapper"
+)
+
+var _ = Describe("Daemon gateway metrics collector unit tests", func() {
+	var (
+		c       *GatewayMetricsCollector
+		mnl     *mocknetlinkwrapper.MockInterface
+		mns     *mocknetnswrapper.MockInterface
+		mwg     *mockwgctrlwrapper.MockInterface
+		mclient *mockwgctrlwrapper.MockClient
+		mipt    *mockiptableswrapper.MockInterface
+		mipt4   *mockiptableswrapper.MockIpTables
+		mipt6   *mockiptableswrapper.MockIpTables
+		now     = time.Now()
+	)
+
+	getTestCollector := func(objects ...runtime.Object) {
+		mctrl := gomock.NewController(GinkgoT())
+		cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(objects...).Build()
+		mnl = mocknetlinkwrapper.NewMockInterface(mctrl)
+		mns = mocknetnswrapper.NewMockInterface(mctrl)
+		mwg = mockwgctrlwrapper.NewMockInterface(mctrl)
+		mclient = mockwgctrlwrapper.NewMockClient(mctrl)
+		mipt = mockiptableswrapper.NewMockInterface(mctrl)
+		mipt4 = mockiptableswrapper.NewMockIpTables(mctrl)
+		mipt6 = mockiptableswrapper.NewMockIpTables(mctrl)
+		c = &GatewayMetricsCollector{
+			Reader:   cl,
+			Netlink:  mnl,
+			NetNS:    mns,
+			WgCtrl:   mwg,
+			IPTables: mipt,
+			now:      func() time.Time { return now },
+		}
+	}
+
+	expectIPTables := func() {
+		mipt.EXPECT().NewWithProtocol(iptables.ProtocolIPv4).Return(mipt4, nil)
+		mipt.EXPECT().NewWithProtocol(iptables.ProtocolIPv6).Return(mipt6, nil)
+	}
+
+	// expectNoRuleCounters expects gateways without destination port filter and preserveSourceIpCidrs
+	expectNoRuleCounters := func() {
+		expectIPTables()
+		for _, ipt := range []*mockiptableswrapper.MockIpTables{mipt4, mipt6} {
+			ipt.EXPECT().StructuredStats(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+		}
+	}
+
+	getTestGwConfig := func(name string, port int32) *egressgatewayv1alpha1.StaticGatewayConfiguration {
+		gwConfig := &egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: testNamespace,
+			},
+			Spec: egressgatewayv1alpha1.StaticGatewayConfigurationSpec{
+				GatewayVmssProfile: egressgatewayv1alpha1.GatewayVmssProfile{
+					VmssResourceGroup:  vmssRG,
+					VmssName:           vmssName,
+					PublicIpPrefixSize: 31,
+				},
+			},
+			Status: getTestGwConfigStatus(),
+		}
+		gwConfig.Status.GatewayServerProfile.Port = port
+		return gwConfig
+	}
+
+	expectedMetrics := func(lines ...string) *strings.Reader {
+		return strings.NewReader(`
+# HELP gateway_connections_total Number of connections from the wireguard interface of the static egress gateway, by action: snat for connections sNATed to the egress IP, preserve_source_ip for connections to preserveSourceIpCidrs
+# TYPE gateway_connections_total counter
+# HELP gateway_dropped_packets_total Number of packets from the wireguard interface of the static egress gateway dropped by destination port filtering
+# TYPE gateway_dropped_packets_total counter
+# HELP gateway_wireguard_active_peers Number of wireguard peers of the static egress gateway with a recent handshake
+# TYPE gateway_wireguard_active_peers gauge
+# HELP gateway_wireguard_receive_bytes_total Number of bytes received from current wireguard peers of the static egress gateway
+# TYPE gateway_wireguard_receive_bytes_total counter
+# HELP gateway_wireguard_receive_packets_total Number of packets received on the wireguard interface of the static egress gateway
+# TYPE gateway_wireguard_receive_packets_total counter
+# HELP gateway_wireguard_transmit_bytes_total Number of bytes sent to current wireguard peers of the static egress gateway
+# TYPE gateway_wireguard_transmit_bytes_total counter
+# HELP gateway_wireguard_transmit_packets_total Number of packets sent on the wireguard interface of the static egress gateway
+# TYPE gateway_wireguard_transmit_packets_total counter
+` + strings.Join(lines, "\n") + "\n")
+	}
+
+	BeforeEach(func() {
+		nodeMeta = &imds.InstanceMetadata{
+			Compute: &imds.ComputeMetadata{
+				VMScaleSetName:    vmssName,
+				ResourceGroupName: vmssRG,
+			},
+		}
+	})
+
+	It("should not report anything when there is no gateway on the node", func() {
+		gwConfig := getTestGwConfig("gw1", 6000)
+		gwConfig.Spec.GatewayVmssProfile.VmssName = "other"
+		getTestCollector(gwConfig)
+		Expect(testutil.CollectAndCount(c)).To(Equal(0))
+	})
+
+	It("should report wireguard statistics of each gateway", func() {
+		getTestCollector(getTestGwConfig("gw1", 6000), getTestGwConfig("gw2", 6001))
+		wg0 := &netlink.Wireguard{LinkAttrs: netlink.LinkAttrs{Statistics: &netlink.LinkStatistics{RxPackets: 10, TxPackets: 20}}}
+		wg1 := &netlink.Wireguard{LinkAttrs: netlink.LinkAttrs{Statistics: &netlink.LinkStatistics{RxPackets: 30, TxPackets: 40}}}
+		mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(&mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}, nil)
+		mwg.EXPECT().New().Return(mclient, nil)
+		expectNoRuleCounters()
+		mclient.EXPECT().Device("wg-6000").Return(&wgtypes.Device{Peers: []wgtypes.Peer{
+			{ReceiveBytes: 100, TransmitBytes: 200, LastHandshakeTime: now.Add(-time.Minute)},
+			{ReceiveBytes: 1000, TransmitBytes: 2000, LastHandshakeTime: now.Add(-time.Hour)},
+		}}, nil)
+		mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil)
+		mclient.EXPECT().Device("wg-6001").Return(&wgtypes.Device{Peers: []wgtypes.Peer{
+			{ReceiveBytes: 300, TransmitBytes: 400, LastHandshakeTime: now},
+		}}, nil)
+		mnl.EXPECT().LinkByName("wg-6001").Return(wg1, nil)
+		mclient.EXPECT().Close().Return(nil)
+
+		Expect(testutil.CollectAndCompare(c, expectedMetrics(
+			fmt.Sprintf(`gateway_connections_total{action="preserve_source_ip",name="gw1",namespace="%s"} 0`, testNamespace),
+			fmt.Sprintf(`gateway_connections_total{action="preserve_source_ip",name="gw2",namespace="%s"} 0`, testNamespace),
+			fmt.Sprintf(`gateway_connections_total{action="snat",name="gw1",namespace="%s"} 0`, testNamespace),
+			fmt.Sprintf(`gateway_connections_total{action="snat",name="gw2",namespace="%s"} 0`, testNamespace),
+			fmt.Sprintf(`gateway_dropped_packets_total{name="gw1",namespace="%s"} 0`, testNamespace),
+			fmt.Sprintf(`gateway_dropped_packets_total{name="gw2",namespace="%s"} 0`, testNamespace),
+			fmt.Sprintf(`gateway_wireguard_active_peers{name="gw1",namespace="%s"} 1`, testNamespace),
+			fmt.Sprintf(`gateway_wireguard_active_peers{name="gw2",namespace="%s"} 1`, testNamespace),
+			fmt.Sprintf(`gateway_wireguard_receive_bytes_total{name="gw1",namespace="%s"} 1100`, testNamespace),
+			fmt.Sprintf(`gateway_wireguard_receive_bytes_total{name="gw2",namespace="%s"} 300`, testNamespace),
+			fmt.Sprintf(`gateway_wireguard_receive_packets_total{name="gw1",namespace="%s"} 10`, testNamespace),
+			fmt.Sprintf(`gateway_wireguard_receive_packets_total{name="gw2",namespace="%s"} 30`, testNamespace),
+			fmt.Sprintf(`gateway_wireguard_transmit_bytes_total{name="gw1",namespace="%s"} 2200`, testNamespace),
+			fmt.Sprintf(`gateway_wireguard_transmit_bytes_total{name="gw2",namespace="%s"} 400`, testNamespace),
+			fmt.Sprintf(`gateway_wireguard_transmit_packets_total{name="gw1",namespace="%s"} 20`, testNamespace),
+			fmt.Sprintf(`gateway_wireguard_transmit_packets_total{name="gw2",namespace="%s"} 40`, testNamespace),
+		))).To(Succeed())
+	})
+
+	It("should report wireguard statistics of each pod when enabled", func() {
+		os.Setenv(consts.PodNamespaceEnvKey, testPodNamespace)
+		os.Setenv(consts.NodeNameEnvKey, testNodeName)
+		defer func() {
+			os.Setenv(consts.PodNamespaceEnvKey, "")
+			os.Setenv(consts.NodeNameEnvKey, "")
+		}()
+		gwStatus := &egressgatewayv1alpha1.GatewayStatus{
+			ObjectMeta: metav1.ObjectMeta{Name: testNodeName, Namespace: testPodNamespace},
+			Spec: egressgatewayv1alpha1.GatewayStatusSpec{
+				ReadyPeerConfigurations: []egressgatewayv1alpha1.PeerConfiguration{
+					{PodEndpoint: "ns1/pod1", InterfaceName: "wg-6000", PublicKey: pubK},
+					// same key on another gateway is not mixed up
+					{PodEndpoint: "ns2/pod2", InterfaceName: "wg-6001", PublicKey: pubK},
+				},
+			},
+		}
+		getTestCollector(getTestGwConfig("gw1", 6000), gwStatus)
+		c.PodMetrics = true
+		key, _ := wgtypes.ParseKey(pubK)
+		key2, _ := wgtypes.ParseKey(pubK2)
+		wg0 := &netlink.Wireguard{LinkAttrs: netlink.LinkAttrs{Statistics: &netlink.LinkStatistics{RxPackets: 10, TxPackets: 20}}}
+		mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(&mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}, nil)
+		mwg.EXPECT().New().Return(mclient, nil)
+		expectNoRuleCounters()
+		mclient.EXPECT().Device("wg-6000").Return(&wgtypes.Device{Peers: []wgtypes.Peer{
+			{PublicKey: key, ReceiveBytes: 100, TransmitBytes: 200, LastHandshakeTime: now},
+			// peer without PodEndpoint is only counted in gateway metrics
+			{PublicKey: key2, ReceiveBytes: 1000, TransmitBytes: 2000, LastHandshakeTime: now},
+		}}, nil)
+		mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil)
+		mclient.EXPECT().Close().Return(nil)
+
+		Expect(testutil.CollectAndCompare(c, strings.NewReader(`
+# HELP gateway_pod_wireguard_receive_bytes_total Number of bytes received from the wireguard peer of a pod on this gateway node, i.e. egress traffic sent by the pod
+# TYPE gateway_pod_wireguard_receive_bytes_total counter
+`+fmt.Sprintf(`gateway_pod_wireguard_receive_bytes_total{name="gw1",namespace="%s",pod="pod1",pod_namespace="ns1"} 100`, testNamespace)+`
+# HELP gateway_pod_wireguard_transmit_bytes_total Number of bytes sent to the wireguard peer of a pod on this gateway node, i.e. return traffic received by the pod
+# TYPE gateway_pod_wireguard_transmit_bytes_total counter
+`+fmt.Sprintf(`gateway_pod_wireguard_transmit_bytes_total{name="gw1",namespace="%s",pod="pod1",pod_namespace="ns1"} 200`, testNamespace)+`
+# HELP gateway_wireguard_receive_bytes_total Number of bytes received from current wireguard peers of the static egress gateway
+# TYPE gateway_wireguard_receive_bytes_total counter
+`+fmt.Sprintf(`gateway_wireguard_receive_bytes_total{name="gw1",namespace="%s"} 1100`, testNamespace)+`
+`), "gateway_pod_wireguard_receive_bytes_total", "gateway_pod_wireguard_transmit_bytes_total", "gateway_wireguard_receive_bytes_total")).To(Succeed())
+	})
+
+	It("should skip gateway whose wireguard device is not found", func() {
+		getTestCollector(getTestGwConfig("gw1", 6000), getTestGwConfig("gw2", 6001))
+		wg1 := &netlink.Wireguard{LinkAttrs: netlink.LinkAttrs{Statistics: &netlink.LinkStatistics{RxPackets: 30, TxPackets: 40}}}
+		mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(&mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}, nil)
+		mwg.EXPECT().New().Return(mclient, nil)
+		expectNoRuleCounters()
+		mclient.EXPECT().Device("wg-6000").Return(nil, fmt.Errorf("not found"))
+		mclient.EXPECT().Device("wg-6001").Return(&wgtypes.Device{}, nil)
+		mnl.EXPECT().LinkByName("wg-6001").Return(wg1, nil)
+		mclient.EXPECT().Close().Return(nil)
+
+		Expect(testutil.CollectAndCompare(c, expectedMetrics(
+			fmt.Sprintf(`gateway_connections_total{action="preserve_source_ip",name="gw2",namespace="%s"} 0`, testNamespace),
+			fmt.Sprintf(`gateway_connections_total{action="snat",name="gw2",namespace="%s"} 0`, testNamespace),
+			fmt.Sprintf(`gateway_dropped_packets_total{name="gw2",namespace="%s"} 0`, testNamespace),
+			fmt.Sprintf(`gateway_wireguard_active_peers{name="gw2",namespace="%s"} 0`, testNamespace),
+			fmt.Sprintf(`gateway_wireguard_receive_bytes_total{name="gw2",namespace="%s"} 0`, testNamespace),
+			fmt.Sprintf(`gateway_wireguard_receive_packets_total{name="gw2",namespace="%s"} 30`, testNamespace),
+			fmt.Sprintf(`gateway_wireguard_transmit_bytes_total{name="gw2",namespace="%s"} 0`, testNamespace),
+			fmt.Sprintf(`gateway_wireguard_transmit_packets_total{name="gw2",namespace="%s"} 40`, testNamespace),
+		))).To(Succeed())
+	})
+
+	It("should report dropped packets and connections from iptables rule counters", func() {
+		getTestCollector(getTestGwConfig("gw1", 6000))
+		wg0 := &netlink.Wireguard{LinkAttrs: netlink.LinkAttrs{Statistics: &netlink.LinkStatistics{RxPackets: 10, TxPackets: 20}}}
+		mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(&mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}, nil)
+		mwg.EXPECT().New().Return(mclient, nil)
+		expectIPTables()
+		mclient.EXPECT().Device("wg-6000").Return(&wgtypes.Device{}, nil)
+		mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil)
+		mipt4.EXPECT().StructuredStats("filter", "EGRESS-GATEWAY-PORTS-6000").Return([]iptables.Stat{
+			{Packets: 5, Target: "RETURN"},
+			{Packets: 7, Target: "LOG"},
+			{Packets: 7, Target: "DROP"},
+		}, nil)
+		mipt4.EXPECT().StructuredStats("nat", "EGRESS-GATEWAY-MARK-6000").Return([]iptables.Stat{
+			{Packets: 2, Target: "RETURN"},
+			{Packets: 10, Target: "CONNMARK"},
+		}, nil)
+		mipt6.EXPECT().StructuredStats("filter", "EGRESS-GATEWAY-PORTS-6000").Return([]iptables.Stat{
+			{Packets: 3, Target: "DROP"},
+		}, nil)
+		mipt6.EXPECT().StructuredStats("nat", "EGRESS-GATEWAY-MARK-6000").Return([]iptables.Stat{
+			{Packets: 4, Target: "CONNMARK"},
+		}, nil)
+		mclient.EXPECT().Close().Return(nil)
+
+		Expect(testutil.CollectAndCompare(c, strings.NewReader(`
+# HELP gateway_connections_total Number of connections from the wireguard interface of the static egress gateway, by action: snat for connections sNATed to the egress IP, preserve_source_ip for connections to preserveSourceIpCidrs
+# TYPE gateway_connections_total counter
+`+fmt.Sprintf(`gateway_connections_total{action="preserve_source_ip",name="gw1",namespace="%s"} 2`, testNamespace)+`
+`+fmt.Sprintf(`gateway_connections_total{action="snat",name="gw1",namespace="%s"} 14`, testNamespace)+`
+# HELP gateway_dropped_packets_total Number of packets from the wireguard interface of the static egress gateway dropped by destination port filtering
+# TYPE gateway_dropped_packets_total counter
+`+fmt.Sprintf(`gateway_dropped_packets_total{name="gw1",namespace="%s"} 10`, testNamespace)+`
+`), "gateway_connections_total", "gateway_dropped_packets_total")).To(Succeed())
+	})
+
+	It("should still report wireguard statistics when iptables rule counters cannot be read", func() {
+		getTestCollector(getTestGwConfig("gw1", 6000))
+		wg0 := &netlink.Wireguard{LinkAttrs: netlink.LinkAttrs{Statistics: &netlink.LinkStatistics{RxPackets: 10, TxPackets: 20}}}
+		mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(&mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}, nil)
+		mwg.EXPECT().New().Return(mclient, nil)
+		expectIPTables()
+		mclient.EXPECT().Device("wg-6000").Return(&wgtypes.Device{}, nil)
+		mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil)
+		mipt4.EXPECT().StructuredStats("filter", "EGRESS-GATEWAY-PORTS-6000").Return(nil, fmt.Errorf("failed"))
+		mclient.EXPECT().Close().Return(nil)
+
+		Expect(testutil.CollectAndCompare(c, expectedMetrics(
+			fmt.Sprintf(`gateway_wireguard_active_peers{name="gw1",namespace="%s"} 0`, testNamespace),
+			fmt.Sprintf(`gateway_wireguard_receive_bytes_total{name="gw1",namespace="%s"} 0`, testNamespace),
+			fmt.Sprintf(`gateway_wireguard_receive_packets_total{name="gw1",namespace="%s"} 10`, testNamespace),
+			fmt.Sprintf(`gateway_wireguard_transmit_bytes_total{name="gw1",namespace="%s"} 0`, testNamespace),
+			fmt.Sprintf(`gateway_wireguard_transmit_packets_total{name="gw1",namespace="%s"} 20`, testNamespace),
+		))).To(Succeed())
+	})
+
+	It("should not report anything when gateway namespace is not found", func() {
+		getTestCollector(getTestGwConfig("gw1", 6000))
+		mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(nil, fmt.Errorf("not found"))
+		Expect(testutil.CollectAndCount(c)).To(Equal(0))
+	})
+})
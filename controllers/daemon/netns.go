@@ -0,0 +1,86 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper"
+)
+
+// Components of the daemon take a NetnsPerGateway field, which configures each gateway in its own network namespace,
+// named after the gateway port, instead of the shared gateway namespace created on node setup. It is passed as
+// perGateway to the helpers below.
+
+// getGatewayNetnsName returns the network namespace holding the wireguard link and SNAT IPs of the gateway
+func getGatewayNetnsName(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration, perGateway bool) string {
+	if !perGateway {
+		return consts.GatewayNetnsName
+	}
+	return consts.GatewayNetnsNamePrefix + fmt.Sprintf("%d", gwConfig.Status.Port)
+}
+
+// getHostVethLinkName returns the host namespace end of the veth pair connecting to the gateway network namespace
+func getHostVethLinkName(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration, perGateway bool) string {
+	if !perGateway {
+		return consts.HostVethLinkName
+	}
+	return consts.HostVethLinkNamePrefix + fmt.Sprintf("%d", gwConfig.Status.Port)
+}
+
+// groupByNetns groups gateways by the network namespace they are configured in
+func groupByNetns(gwConfigs []*egressgatewayv1alpha1.StaticGatewayConfiguration, perGateway bool) map[string][]*egressgatewayv1alpha1.StaticGatewayConfiguration {
+	groups := make(map[string][]*egressgatewayv1alpha1.StaticGatewayConfiguration)
+	for _, gwConfig := range gwConfigs {
+		nsName := getGatewayNetnsName(gwConfig, perGateway)
+		groups[nsName] = append(groups[nsName], gwConfig)
+	}
+	return groups
+}
+
+// listGatewayNetns returns all network namespaces that may hold gateway configurations, the shared gateway
+// namespace first, followed by per gateway namespaces when enabled
+func listGatewayNetns(netNS netnswrapper.Interface, perGateway bool) ([]string, error) {
+	nsNames := []string{consts.GatewayNetnsName}
+	if !perGateway {
+		return nsNames, nil
+	}
+	names, err := netNS.ListNS()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list network namespaces: %w", err)
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, consts.GatewayNetnsNamePrefix) {
+			nsNames = append(nsNames, name)
+		}
+	}
+	return nsNames, nil
+}
+
+// getOrCreateGatewayNetns returns the network namespace of the gateway, per gateway namespaces are created on
+// first use while the shared namespace is expected to exist
+func getOrCreateGatewayNetns(ctx context.Context, netNS netnswrapper.Interface, nsName string, perGateway bool) (ns.NetNS, error) {
+	gwns, err := netNS.GetNS(nsName)
+	if err == nil {
+		return gwns, nil
+	}
+	var notExistErr ns.NSPathNotExistErr
+	if !perGateway || nsName == consts.GatewayNetnsName || !errors.As(err, &notExistErr) {
+		return nil, fmt.Errorf("failed to get network namespace %s: %w", nsName, err)
+	}
+	log.FromContext(ctx).Info("Creating gateway network namespace", "netns", nsName)
+	gwns, err = netNS.NewNS(nsName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create network namespace %s: %w", nsName, err)
+	}
+	return gwns, nil
+}
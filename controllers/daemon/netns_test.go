@@ -0,0 +1,47 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper/mocknetnswrapper"
+)
+
+var _ = Describe("Gateway network namespace", func() {
+	getTestGwConfig := func(port int32) *egressgatewayv1alpha1.StaticGatewayConfiguration {
+		gwConfig := &egressgatewayv1alpha1.StaticGatewayConfiguration{}
+		gwConfig.Status.GatewayServerProfile.Port = port
+		return gwConfig
+	}
+
+	It("should share gateway network namespace by default", func() {
+		mns := mocknetnswrapper.NewMockInterface(gomock.NewController(GinkgoT()))
+		gwConfig1, gwConfig2 := getTestGwConfig(6000), getTestGwConfig(6001)
+		Expect(getGatewayNetnsName(gwConfig1, false)).To(Equal(consts.GatewayNetnsName))
+		Expect(getHostVethLinkName(gwConfig1, false)).To(Equal(consts.HostVethLinkName))
+		Expect(groupByNetns([]*egressgatewayv1alpha1.StaticGatewayConfiguration{gwConfig1, gwConfig2}, false)).To(Equal(
+			map[string][]*egressgatewayv1alpha1.StaticGatewayConfiguration{consts.GatewayNetnsName: {gwConfig1, gwConfig2}}))
+		Expect(listGatewayNetns(mns, false)).To(Equal([]string{consts.GatewayNetnsName}))
+	})
+
+	It("should name network namespace and veth link after gateway port when each gateway has its own network namespace", func() {
+		mns := mocknetnswrapper.NewMockInterface(gomock.NewController(GinkgoT()))
+		gwConfig1, gwConfig2 := getTestGwConfig(6000), getTestGwConfig(6001)
+		Expect(getGatewayNetnsName(gwConfig1, true)).To(Equal("ns-static-egress-gateway-6000"))
+		Expect(getHostVethLinkName(gwConfig1, true)).To(Equal("host-gw-6000"))
+		Expect(groupByNetns([]*egressgatewayv1alpha1.StaticGatewayConfiguration{gwConfig1, gwConfig2}, true)).To(Equal(
+			map[string][]*egressgatewayv1alpha1.StaticGatewayConfiguration{
+				"ns-static-egress-gateway-6000": {gwConfig1},
+				"ns-static-egress-gateway-6001": {gwConfig2},
+			}))
+
+		mns.EXPECT().ListNS().Return([]string{"cni-1234", "ns-static-egress-gateway-6000", consts.GatewayNetnsName}, nil)
+		Expect(listGatewayNetns(mns, true)).To(Equal([]string{consts.GatewayNetnsName, "ns-static-egress-gateway-6000"}))
+	})
+})
@@ -0,0 +1,354 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/wgctrlwrapper"
+)
+
+const (
+	// MinPeerHandshakeTimeout is the smallest allowed handshake staleness threshold, a peer with
+	// traffic completes a new handshake every 2 minutes and its session expires after 3 minutes
+	MinPeerHandshakeTimeout = peerActiveTimeout
+
+	defaultPeerHealthCheckInterval = 30 * time.Second
+)
+
+var (
+	GatewayStalePeers = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_wireguard_stale_peers",
+			Help: "Number of wireguard peers of running pods without a handshake within the threshold",
+		},
+		gatewayLabels,
+	)
+
+	GatewayPeerReapplyCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_wireguard_peer_reapply_count",
+			Help: "Number of times stale wireguard peers of the static egress gateway are re-applied",
+		},
+		gatewayLabels,
+	)
+)
+
+// peerHealth is the handshake state of a wireguard peer on this node
+type peerHealth struct {
+	gwConfig      *egressgatewayv1alpha1.StaticGatewayConfiguration
+	podEndpoint   *egressgatewayv1alpha1.PodEndpoint
+	lastHandshake time.Time
+}
+
+// PeerHealthChecker periodically checks the latest handshake of wireguard peers on this node.
+// Peers without any handshake are served by other gateway nodes and are not checked.
+type PeerHealthChecker struct {
+	client.Client
+	NetNS  netnswrapper.Interface
+	WgCtrl wgctrlwrapper.Interface
+	// NetnsPerGateway configures each gateway in its own network namespace
+	NetnsPerGateway bool
+	// Threshold is the maximum age of the latest handshake of a healthy peer
+	Threshold time.Duration
+	// ReapplyStalePeers re-creates stale peers so that the pod starts a new handshake
+	ReapplyStalePeers bool
+	// StrictPeerAllowedIPs limits allowed IPs of re-created peers to the pod address like PodEndpointReconciler
+	StrictPeerAllowedIPs bool
+	Interval             time.Duration
+
+	now func() time.Time
+}
+
+func NewPeerHealthChecker(c client.Client, threshold time.Duration, reapplyStalePeers bool) *PeerHealthChecker {
+	return &PeerHealthChecker{
+		Client:            c,
+		NetNS:             netnswrapper.NewNetNS(),
+		WgCtrl:            wgctrlwrapper.NewWgCtrl(),
+		Threshold:         threshold,
+		ReapplyStalePeers: reapplyStalePeers,
+		Interval:          defaultPeerHealthCheckInterval,
+		now:               time.Now,
+	}
+}
+
+// Start checks peer health every interval until ctx is done.
+func (c *PeerHealthChecker) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := c.check(ctx); err != nil {
+			log.FromContext(ctx).Error(err, "failed to check wireguard peer health")
+		}
+	}, c.Interval)
+	return nil
+}
+
+func (c *PeerHealthChecker) check(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("peer-health")
+
+	peers, err := c.getPeerHealth(ctx)
+	if err != nil {
+		return err
+	}
+
+	stalePeers := make(map[types.NamespacedName]int)
+	var peersToReapply []peerHealth
+	for _, peer := range peers {
+		gwConfigKey := types.NamespacedName{Namespace: peer.gwConfig.Namespace, Name: peer.gwConfig.Name}
+		if _, ok := stalePeers[gwConfigKey]; !ok {
+			stalePeers[gwConfigKey] = 0
+		}
+		healthy := c.now().Sub(peer.lastHandshake) <= c.Threshold
+		if !healthy {
+			running, err := c.isPodRunning(ctx, peer.podEndpoint)
+			if err != nil {
+				log.Error(err, "failed to get pod", "pod", client.ObjectKeyFromObject(peer.podEndpoint))
+				continue
+			}
+			if !running {
+				// peer is removed in PodEndpoint controller cleanup once the pod is gone
+				continue
+			}
+			stalePeers[gwConfigKey]++
+			if c.ReapplyStalePeers {
+				peersToReapply = append(peersToReapply, peer)
+			}
+		}
+		if err := c.updateTunnelHealthyCondition(ctx, peer.podEndpoint, healthy); err != nil {
+			log.Error(err, "failed to update PodEndpoint tunnel healthy condition", "podEndpoint", client.ObjectKeyFromObject(peer.podEndpoint))
+		}
+	}
+
+	GatewayStalePeers.Reset()
+	for gwConfigKey, count := range stalePeers {
+		GatewayStalePeers.WithLabelValues(gwConfigKey.Namespace, gwConfigKey.Name).Set(float64(count))
+	}
+
+	if len(peersToReapply) > 0 {
+		if err := c.reapplyPeers(ctx, peersToReapply); err != nil {
+			return fmt.Errorf("failed to re-apply stale wireguard peers: %w", err)
+		}
+	}
+	return nil
+}
+
+// getPeerHealth returns handshake state of wireguard peers of PodEndpoints on this node
+func (c *PeerHealthChecker) getPeerHealth(ctx context.Context) ([]peerHealth, error) {
+	gwConfigList := &egressgatewayv1alpha1.StaticGatewayConfigurationList{}
+	if err := c.List(ctx, gwConfigList); err != nil {
+		return nil, fmt.Errorf("failed to list staticGatewayConfigurations: %w", err)
+	}
+	gwConfigMap := make(map[string]*egressgatewayv1alpha1.StaticGatewayConfiguration)
+	var gwConfigs []*egressgatewayv1alpha1.StaticGatewayConfiguration
+	for i := range gwConfigList.Items {
+		gwConfig := &gwConfigList.Items[i]
+		if isReady(gwConfig) && applyToNode(gwConfig) && gwConfig.ObjectMeta.DeletionTimestamp.IsZero() {
+			gwConfigMap[strings.ToLower(fmt.Sprintf("%s/%s", gwConfig.Namespace, gwConfig.Name))] = gwConfig
+			gwConfigs = append(gwConfigs, gwConfig)
+		}
+	}
+	if len(gwConfigMap) == 0 {
+		return nil, nil
+	}
+
+	podEndpointList := &egressgatewayv1alpha1.PodEndpointList{}
+	if err := c.List(ctx, podEndpointList); err != nil {
+		return nil, fmt.Errorf("failed to list PodEndpoints: %w", err)
+	}
+	// map: wglink name -> peer public key -> PodEndpoint
+	podEndpointMap := make(map[string]map[string]*egressgatewayv1alpha1.PodEndpoint)
+	for i := range podEndpointList.Items {
+		podEndpoint := &podEndpointList.Items[i]
+		gwConfig, ok := gwConfigMap[strings.ToLower(podEndpoint.GetStaticGatewayConfigurationKey().String())]
+		if !ok || !gwConfig.AllowsNamespace(podEndpoint.Namespace) {
+			continue
+		}
+		wglinkName := getWireguardInterfaceName(gwConfig)
+		if _, exists := podEndpointMap[wglinkName]; !exists {
+			podEndpointMap[wglinkName] = make(map[string]*egressgatewayv1alpha1.PodEndpoint)
+		}
+		podEndpointMap[wglinkName][podEndpoint.Spec.PodPublicKey] = podEndpoint
+	}
+
+	var peers []peerHealth
+	for nsName, nsGwConfigs := range groupByNetns(gwConfigs, c.NetnsPerGateway) {
+		nsPeers, err := c.getNetnsPeerHealth(ctx, nsName, nsGwConfigs, podEndpointMap)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, nsPeers...)
+	}
+	return peers, nil
+}
+
+// getNetnsPeerHealth returns handshake state of wireguard peers of gateways configured in the network namespace
+func (c *PeerHealthChecker) getNetnsPeerHealth(
+	ctx context.Context,
+	nsName string,
+	gwConfigs []*egressgatewayv1alpha1.StaticGatewayConfiguration,
+	podEndpointMap map[string]map[string]*egressgatewayv1alpha1.PodEndpoint,
+) ([]peerHealth, error) {
+	log := log.FromContext(ctx)
+	gwns, err := c.NetNS.GetNS(nsName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gateway network namespace %s: %w", nsName, err)
+	}
+	defer gwns.Close()
+
+	var peers []peerHealth
+	if err := gwns.Do(func(nn ns.NetNS) error {
+		wgClient, err := c.WgCtrl.New()
+		if err != nil {
+			return fmt.Errorf("failed to create wgctrl client: %w", err)
+		}
+		defer func() { _ = wgClient.Close() }()
+
+		for _, gwConfig := range gwConfigs {
+			wglinkName := getWireguardInterfaceName(gwConfig)
+			device, err := wgClient.Device(wglinkName)
+			if err != nil {
+				// do not block checking peers of other gateways
+				log.Error(err, "failed to get wireguard device", "wglink", wglinkName)
+				continue
+			}
+			for _, peer := range device.Peers {
+				podEndpoint, ok := podEndpointMap[wglinkName][peer.PublicKey.String()]
+				if !ok || peer.LastHandshakeTime.IsZero() {
+					continue
+				}
+				peers = append(peers, peerHealth{gwConfig: gwConfig, podEndpoint: podEndpoint, lastHandshake: peer.LastHandshakeTime})
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return peers, nil
+}
+
+// isPodRunning returns whether the pod owning podEndpoint is running
+func (c *PeerHealthChecker) isPodRunning(ctx context.Context, podEndpoint *egressgatewayv1alpha1.PodEndpoint) (bool, error) {
+	// podEndpoint has the same namespace/name as the pod
+	pod := &corev1.Pod{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: podEndpoint.Namespace, Name: podEndpoint.Name}, pod); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp.IsZero(), nil
+}
+
+// updateTunnelHealthyCondition sets tunnel healthy condition of podEndpoint. A stale peer is only reported by
+// the gateway node which last reported the tunnel, as the pod may be served by another gateway node now.
+func (c *PeerHealthChecker) updateTunnelHealthyCondition(
+	ctx context.Context,
+	podEndpoint *egressgatewayv1alpha1.PodEndpoint,
+	healthy bool,
+) error {
+	nodeName := os.Getenv(consts.NodeNameEnvKey)
+	if !healthy && podEndpoint.Status.GatewayNode != "" && podEndpoint.Status.GatewayNode != nodeName {
+		return nil
+	}
+
+	original := podEndpoint.DeepCopy()
+	podEndpoint.Status.GatewayNode = nodeName
+	condition := metav1.Condition{
+		Type:               consts.PodEndpointTunnelHealthyConditionType,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: podEndpoint.Generation,
+		Reason:             consts.PodEndpointTunnelHealthyReasonHandshakeRecent,
+		Message:            fmt.Sprintf("wireguard handshake with gateway node %s within %s", nodeName, c.Threshold),
+	}
+	if !healthy {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = consts.PodEndpointTunnelHealthyReasonHandshakeStale
+		condition.Message = fmt.Sprintf("no wireguard handshake with gateway node %s for more than %s", nodeName, c.Threshold)
+	}
+	meta.SetStatusCondition(&podEndpoint.Status.Conditions, condition)
+	if equality.Semantic.DeepEqual(original.Status, podEndpoint.Status) {
+		return nil
+	}
+	log.FromContext(ctx).Info("Updating PodEndpoint tunnel healthy condition", "podEndpoint", client.ObjectKeyFromObject(podEndpoint), "healthy", healthy)
+	return c.Status().Patch(ctx, podEndpoint, client.MergeFrom(original))
+}
+
+// reapplyPeers removes and adds back stale peers, dropping wireguard sessions on gateway side,
+// so that the pod has to complete a new handshake before sending more traffic
+func (c *PeerHealthChecker) reapplyPeers(ctx context.Context, peers []peerHealth) error {
+	peersByNetns := make(map[string][]peerHealth)
+	for _, peer := range peers {
+		nsName := getGatewayNetnsName(peer.gwConfig, c.NetnsPerGateway)
+		peersByNetns[nsName] = append(peersByNetns[nsName], peer)
+	}
+	for nsName, nsPeers := range peersByNetns {
+		if err := c.reapplyNetnsPeers(ctx, nsName, nsPeers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *PeerHealthChecker) reapplyNetnsPeers(ctx context.Context, nsName string, peers []peerHealth) error {
+	log := log.FromContext(ctx)
+
+	gwns, err := c.NetNS.GetNS(nsName)
+	if err != nil {
+		return fmt.Errorf("failed to get gateway network namespace %s: %w", nsName, err)
+	}
+	defer gwns.Close()
+
+	return gwns.Do(func(nn ns.NetNS) error {
+		wgClient, err := c.WgCtrl.New()
+		if err != nil {
+			return fmt.Errorf("failed to create wgctrl client: %w", err)
+		}
+		defer func() { _ = wgClient.Close() }()
+
+		for _, peer := range peers {
+			wglinkName := getWireguardInterfaceName(peer.gwConfig)
+			podPublicKey, err := wgtypes.ParseKey(peer.podEndpoint.Spec.PodPublicKey)
+			if err != nil {
+				return fmt.Errorf("failed to parse pod wireguard public key: %w", err)
+			}
+			allowedIPs, err := getPodAllowedIPs(peer.podEndpoint, c.StrictPeerAllowedIPs)
+			if err != nil {
+				return err
+			}
+			if err := wgClient.ConfigureDevice(wglinkName, wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{PublicKey: podPublicKey, Remove: true}},
+			}); err != nil {
+				return fmt.Errorf("failed to remove peer from wireguard device %s: %w", wglinkName, err)
+			}
+			if err := wgClient.ConfigureDevice(wglinkName, wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey:                   podPublicKey,
+					PersistentKeepaliveInterval: getPeerKeepalive(peer.gwConfig),
+					ReplaceAllowedIPs:           true,
+					AllowedIPs:                  allowedIPs,
+				}},
+			}); err != nil {
+				return fmt.Errorf("failed to add peer to wireguard device %s: %w", wglinkName, err)
+			}
+			GatewayPeerReapplyCount.WithLabelValues(peer.gwConfig.Namespace, peer.gwConfig.Name).Inc()
+			log.Info("Re-applied stale wireguard peer", "pod", client.ObjectKeyFromObject(peer.podEndpoint), "wglink", wglinkName)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,205 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"context"
+	"net"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/mock/gomock"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/imds"
+	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper/mocknetnswrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/wgctrlwrapper/mockwgctrlwrapper"
+)
+
+var _ = Describe("Daemon wireguard peer health checker unit tests", func() {
+	var (
+		c       *PeerHealthChecker
+		mns     *mocknetnswrapper.MockInterface
+		mwg     *mockwgctrlwrapper.MockInterface
+		mclient *mockwgctrlwrapper.MockClient
+		now     = time.Now()
+		key1, _ = wgtypes.ParseKey(pubK)
+	)
+
+	getTestChecker := func(reapply bool, objects ...runtime.Object) {
+		mctrl := gomock.NewController(GinkgoT())
+		cl := fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithRuntimeObjects(objects...).
+			WithStatusSubresource(&egressgatewayv1alpha1.PodEndpoint{}).
+			Build()
+		mns = mocknetnswrapper.NewMockInterface(mctrl)
+		mwg = mockwgctrlwrapper.NewMockInterface(mctrl)
+		mclient = mockwgctrlwrapper.NewMockClient(mctrl)
+		c = &PeerHealthChecker{
+			Client:            cl,
+			NetNS:             mns,
+			WgCtrl:            mwg,
+			Threshold:         5 * time.Minute,
+			ReapplyStalePeers: reapply,
+			now:               func() time.Time { return now },
+		}
+	}
+
+	getTestGwConfig := func() *egressgatewayv1alpha1.StaticGatewayConfiguration {
+		gwConfig := &egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      testName,
+				Namespace: testNamespace,
+			},
+			Spec: egressgatewayv1alpha1.StaticGatewayConfigurationSpec{
+				GatewayVmssProfile: egressgatewayv1alpha1.GatewayVmssProfile{
+					VmssResourceGroup:  vmssRG,
+					VmssName:           vmssName,
+					PublicIpPrefixSize: 31,
+				},
+			},
+			Status: getTestGwConfigStatus(),
+		}
+		gwConfig.Status.GatewayServerProfile.Port = 6000
+		return gwConfig
+	}
+
+	getTestPodEndpoint := func(gatewayNode string) *egressgatewayv1alpha1.PodEndpoint {
+		return &egressgatewayv1alpha1.PodEndpoint{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: testNamespace},
+			Spec: egressgatewayv1alpha1.PodEndpointSpec{
+				StaticGatewayConfiguration: testName,
+				PodIpAddress:               podIPAddrNet,
+				PodPublicKey:               pubK,
+			},
+			Status: egressgatewayv1alpha1.PodEndpointStatus{GatewayNode: gatewayNode},
+		}
+	}
+
+	getTestPod := func(phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: testNamespace},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+	}
+
+	expectPeers := func(peers ...wgtypes.Peer) {
+		mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(&mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}, nil)
+		mwg.EXPECT().New().Return(mclient, nil)
+		mclient.EXPECT().Device("wg-6000").Return(&wgtypes.Device{Peers: peers}, nil)
+		mclient.EXPECT().Close().Return(nil)
+	}
+
+	getTunnelHealthyCondition := func() (*metav1.Condition, string) {
+		podEndpoint := &egressgatewayv1alpha1.PodEndpoint{}
+		Expect(c.Get(context.TODO(), types.NamespacedName{Name: "pod1", Namespace: testNamespace}, podEndpoint)).To(Succeed())
+		return meta.FindStatusCondition(podEndpoint.Status.Conditions, consts.PodEndpointTunnelHealthyConditionType), podEndpoint.Status.GatewayNode
+	}
+
+	BeforeEach(func() {
+		os.Setenv(consts.NodeNameEnvKey, testNodeName)
+		nodeMeta = &imds.InstanceMetadata{
+			Compute: &imds.ComputeMetadata{
+				VMScaleSetName:    vmssName,
+				ResourceGroupName: vmssRG,
+			},
+		}
+		GatewayStalePeers.Reset()
+		GatewayPeerReapplyCount.Reset()
+	})
+
+	AfterEach(func() {
+		os.Setenv(consts.NodeNameEnvKey, "")
+	})
+
+	It("should report healthy tunnel with recent handshake", func() {
+		getTestChecker(false, getTestGwConfig(), getTestPodEndpoint(""), getTestPod(corev1.PodRunning))
+		expectPeers(wgtypes.Peer{PublicKey: key1, LastHandshakeTime: now.Add(-time.Minute)})
+
+		Expect(c.check(context.TODO())).To(Succeed())
+		condition, gatewayNode := getTunnelHealthyCondition()
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition.Reason).To(Equal(consts.PodEndpointTunnelHealthyReasonHandshakeRecent))
+		Expect(gatewayNode).To(Equal(testNodeName))
+		Expect(testutil.ToFloat64(GatewayStalePeers.WithLabelValues(testNamespace, testName))).To(BeZero())
+	})
+
+	It("should report stale tunnel of running pod", func() {
+		getTestChecker(false, getTestGwConfig(), getTestPodEndpoint(testNodeName), getTestPod(corev1.PodRunning))
+		expectPeers(wgtypes.Peer{PublicKey: key1, LastHandshakeTime: now.Add(-10 * time.Minute)})
+
+		Expect(c.check(context.TODO())).To(Succeed())
+		condition, _ := getTunnelHealthyCondition()
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(consts.PodEndpointTunnelHealthyReasonHandshakeStale))
+		Expect(testutil.CollectAndCount(GatewayStalePeers)).To(Equal(1))
+		Expect(testutil.ToFloat64(GatewayStalePeers.WithLabelValues(testNamespace, testName))).To(Equal(float64(1)))
+		Expect(testutil.CollectAndCount(GatewayPeerReapplyCount)).To(BeZero())
+	})
+
+	It("should not report stale tunnel served by another gateway node", func() {
+		getTestChecker(false, getTestGwConfig(), getTestPodEndpoint("other"), getTestPod(corev1.PodRunning))
+		expectPeers(wgtypes.Peer{PublicKey: key1, LastHandshakeTime: now.Add(-10 * time.Minute)})
+
+		Expect(c.check(context.TODO())).To(Succeed())
+		condition, gatewayNode := getTunnelHealthyCondition()
+		Expect(condition).To(BeNil())
+		Expect(gatewayNode).To(Equal("other"))
+	})
+
+	It("should skip stale peer of pod that is not running", func() {
+		getTestChecker(true, getTestGwConfig(), getTestPodEndpoint(testNodeName), getTestPod(corev1.PodSucceeded))
+		expectPeers(wgtypes.Peer{PublicKey: key1, LastHandshakeTime: now.Add(-10 * time.Minute)})
+
+		Expect(c.check(context.TODO())).To(Succeed())
+		condition, _ := getTunnelHealthyCondition()
+		Expect(condition).To(BeNil())
+		Expect(testutil.ToFloat64(GatewayStalePeers.WithLabelValues(testNamespace, testName))).To(BeZero())
+	})
+
+	It("should skip peer without any handshake on this node", func() {
+		getTestChecker(false, getTestGwConfig(), getTestPodEndpoint(""), getTestPod(corev1.PodRunning))
+		expectPeers(wgtypes.Peer{PublicKey: key1})
+
+		Expect(c.check(context.TODO())).To(Succeed())
+		condition, gatewayNode := getTunnelHealthyCondition()
+		Expect(condition).To(BeNil())
+		Expect(gatewayNode).To(BeEmpty())
+	})
+
+	It("should re-apply stale peer when enabled", func() {
+		getTestChecker(true, getTestGwConfig(), getTestPodEndpoint(testNodeName), getTestPod(corev1.PodRunning))
+		expectPeers(wgtypes.Peer{PublicKey: key1, LastHandshakeTime: now.Add(-10 * time.Minute)})
+		mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(&mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}, nil)
+		mwg.EXPECT().New().Return(mclient, nil)
+		_, podIPNet, _ := net.ParseCIDR(podIPAddrNet)
+		gomock.InOrder(
+			mclient.EXPECT().ConfigureDevice("wg-6000", wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{PublicKey: key1, Remove: true}},
+			}).Return(nil),
+			mclient.EXPECT().ConfigureDevice("wg-6000", wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{PublicKey: key1, PersistentKeepaliveInterval: new(time.Duration), ReplaceAllowedIPs: true, AllowedIPs: []net.IPNet{*podIPNet}}},
+			}).Return(nil),
+		)
+		mclient.EXPECT().Close().Return(nil)
+
+		Expect(c.check(context.TODO())).To(Succeed())
+		Expect(testutil.ToFloat64(GatewayPeerReapplyCount.WithLabelValues(testNamespace, testName))).To(Equal(float64(1)))
+	})
+})
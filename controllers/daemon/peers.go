@@ -0,0 +1,143 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/peerstate"
+	"github.com/Azure/kube-egress-gateway/pkg/wgctrlwrapper"
+)
+
+var _ http.Handler = &GatewayPeersHandler{}
+
+// GatewayPeersHandler serves wireguard peer state of a static egress gateway on this node in json
+type GatewayPeersHandler struct {
+	client.Reader
+	NetNS  netnswrapper.Interface
+	WgCtrl wgctrlwrapper.Interface
+	// NetnsPerGateway configures each gateway in its own network namespace
+	NetnsPerGateway bool
+}
+
+func NewGatewayPeersHandler(reader client.Reader) *GatewayPeersHandler {
+	return &GatewayPeersHandler{
+		Reader: reader,
+		NetNS:  netnswrapper.NewNetNS(),
+		WgCtrl: wgctrlwrapper.NewWgCtrl(),
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (h *GatewayPeersHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	log := log.FromContext(ctx).WithName("gateway-peers")
+
+	gwConfigKey := types.NamespacedName{
+		Namespace: req.URL.Query().Get("namespace"),
+		Name:      req.URL.Query().Get("name"),
+	}
+	if gwConfigKey.Namespace == "" || gwConfigKey.Name == "" {
+		http.Error(w, "namespace and name of the StaticGatewayConfiguration are required", http.StatusBadRequest)
+		return
+	}
+
+	gwConfig := &egressgatewayv1alpha1.StaticGatewayConfiguration{}
+	if err := h.Get(ctx, gwConfigKey, gwConfig); err != nil {
+		if apierrors.IsNotFound(err) {
+			http.Error(w, fmt.Sprintf("StaticGatewayConfiguration %s is not found", gwConfigKey), http.StatusNotFound)
+			return
+		}
+		log.Error(err, "failed to get StaticGatewayConfiguration", "gateway", gwConfigKey)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !applyToNode(gwConfig) {
+		http.Error(w, fmt.Sprintf("StaticGatewayConfiguration %s is not deployed on this node", gwConfigKey), http.StatusNotFound)
+		return
+	}
+
+	peers, err := h.getPeers(ctx, gwConfig)
+	if err != nil {
+		log.Error(err, "failed to get wireguard peers", "gateway", gwConfigKey)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(peers); err != nil {
+		log.Error(err, "failed to write wireguard peers")
+	}
+}
+
+func (h *GatewayPeersHandler) getPeers(
+	ctx context.Context,
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+) ([]peerstate.Peer, error) {
+	// GatewayStatus records which PodEndpoint each configured peer belongs to
+	podEndpoints := make(map[string]string)
+	gwStatus := &egressgatewayv1alpha1.GatewayStatus{}
+	if err := h.Get(ctx, getGatewayStatusKey(), gwStatus); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to get gateway status: %w", err)
+		}
+	}
+	wglinkName := getWireguardInterfaceName(gwConfig)
+	for _, peerConfig := range gwStatus.Spec.ReadyPeerConfigurations {
+		if peerConfig.InterfaceName == wglinkName {
+			podEndpoints[peerConfig.PublicKey] = peerConfig.PodEndpoint
+		}
+	}
+
+	nsName := getGatewayNetnsName(gwConfig, h.NetnsPerGateway)
+	gwns, err := h.NetNS.GetNS(nsName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gateway network namespace %s: %w", nsName, err)
+	}
+	defer gwns.Close()
+
+	peers := make([]peerstate.Peer, 0)
+	if err := gwns.Do(func(nn ns.NetNS) error {
+		wgClient, err := h.WgCtrl.New()
+		if err != nil {
+			return fmt.Errorf("failed to create wgctrl client: %w", err)
+		}
+		defer func() { _ = wgClient.Close() }()
+
+		device, err := wgClient.Device(wglinkName)
+		if err != nil {
+			return fmt.Errorf("failed to get wireguard link configuration: %w", err)
+		}
+		for _, peer := range device.Peers {
+			state := peerstate.Peer{
+				PodEndpoint:       podEndpoints[peer.PublicKey.String()],
+				PublicKey:         peer.PublicKey.String(),
+				LastHandshakeTime: peer.LastHandshakeTime,
+				ReceiveBytes:      peer.ReceiveBytes,
+				TransmitBytes:     peer.TransmitBytes,
+			}
+			if peer.Endpoint != nil {
+				state.Endpoint = peer.Endpoint.String()
+			}
+			for _, ipNet := range peer.AllowedIPs {
+				state.AllowedIPs = append(state.AllowedIPs, ipNet.String())
+			}
+			peers = append(peers, state)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return peers, nil
+}
@@ -0,0 +1,167 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/imds"
+	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper/mocknetnswrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/peerstate"
+	"github.com/Azure/kube-egress-gateway/pkg/wgctrlwrapper/mockwgctrlwrapper"
+)
+
+var _ = Describe("Daemon gateway peers handler unit tests", func() {
+	var (
+		h       *GatewayPeersHandler
+		mns     *mocknetnswrapper.MockNetNS
+		mnsi    *mocknetnswrapper.MockInterface
+		mwg     *mockwgctrlwrapper.MockInterface
+		mclient *mockwgctrlwrapper.MockClient
+	)
+
+	getTestHandler := func(objects ...runtime.Object) {
+		mctrl := gomock.NewController(GinkgoT())
+		cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(objects...).Build()
+		mns = &mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}
+		mnsi = mocknetnswrapper.NewMockInterface(mctrl)
+		mwg = mockwgctrlwrapper.NewMockInterface(mctrl)
+		mclient = mockwgctrlwrapper.NewMockClient(mctrl)
+		h = &GatewayPeersHandler{
+			Reader: cl,
+			NetNS:  mnsi,
+			WgCtrl: mwg,
+		}
+	}
+
+	getTestGwConfig := func() *egressgatewayv1alpha1.StaticGatewayConfiguration {
+		return &egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      testName,
+				Namespace: testNamespace,
+			},
+			Spec: egressgatewayv1alpha1.StaticGatewayConfigurationSpec{
+				GatewayVmssProfile: egressgatewayv1alpha1.GatewayVmssProfile{
+					VmssResourceGroup:  vmssRG,
+					VmssName:           vmssName,
+					PublicIpPrefixSize: 31,
+				},
+			},
+			Status: getTestGwConfigStatus(),
+		}
+	}
+
+	serve := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, peerstate.Path+query, nil))
+		return rec
+	}
+
+	BeforeEach(func() {
+		os.Setenv(consts.PodNamespaceEnvKey, testPodNamespace)
+		os.Setenv(consts.NodeNameEnvKey, testNodeName)
+		nodeMeta = &imds.InstanceMetadata{
+			Compute: &imds.ComputeMetadata{
+				VMScaleSetName:    vmssName,
+				ResourceGroupName: vmssRG,
+			},
+		}
+	})
+
+	AfterEach(func() {
+		os.Setenv(consts.PodNamespaceEnvKey, "")
+		os.Setenv(consts.NodeNameEnvKey, "")
+	})
+
+	It("should reject request without gateway name", func() {
+		getTestHandler()
+		Expect(serve("?namespace=" + testNamespace).Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should return not found when gateway does not exist", func() {
+		getTestHandler()
+		Expect(serve(fmt.Sprintf("?namespace=%s&name=%s", testNamespace, testName)).Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should return not found when gateway is not deployed on this node", func() {
+		gwConfig := getTestGwConfig()
+		gwConfig.Spec.GatewayVmssProfile.VmssName = "other"
+		getTestHandler(gwConfig)
+		Expect(serve(fmt.Sprintf("?namespace=%s&name=%s", testNamespace, testName)).Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should return peers of the gateway", func() {
+		gwStatus := &egressgatewayv1alpha1.GatewayStatus{
+			ObjectMeta: metav1.ObjectMeta{Name: testNodeName, Namespace: testPodNamespace},
+			Spec: egressgatewayv1alpha1.GatewayStatusSpec{
+				ReadyPeerConfigurations: []egressgatewayv1alpha1.PeerConfiguration{
+					{PodEndpoint: testNamespace + "/pod1", InterfaceName: "wg-6000", PublicKey: pubK},
+					{PodEndpoint: testNamespace + "/pod2", InterfaceName: "wg-6001", PublicKey: pubK2},
+				},
+			},
+		}
+		getTestHandler(getTestGwConfig(), gwStatus)
+		key1, _ := wgtypes.ParseKey(pubK)
+		key2, _ := wgtypes.ParseKey(pubK2)
+		_, allowedIP, _ := net.ParseCIDR("10.0.0.5/32")
+		handshake := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		mnsi.EXPECT().GetNS(consts.GatewayNetnsName).Return(mns, nil)
+		mwg.EXPECT().New().Return(mclient, nil)
+		mclient.EXPECT().Device("wg-6000").Return(&wgtypes.Device{Peers: []wgtypes.Peer{
+			{
+				PublicKey:         key1,
+				Endpoint:          &net.UDPAddr{IP: net.ParseIP("10.1.0.4"), Port: 51820},
+				AllowedIPs:        []net.IPNet{*allowedIP},
+				LastHandshakeTime: handshake,
+				ReceiveBytes:      100,
+				TransmitBytes:     200,
+			},
+			{PublicKey: key2},
+		}}, nil)
+		mclient.EXPECT().Close().Return(nil)
+
+		rec := serve(fmt.Sprintf("?namespace=%s&name=%s", testNamespace, testName))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var peers []peerstate.Peer
+		Expect(json.Unmarshal(rec.Body.Bytes(), &peers)).To(Succeed())
+		Expect(peers).To(Equal([]peerstate.Peer{
+			{
+				PodEndpoint:       testNamespace + "/pod1",
+				PublicKey:         pubK,
+				Endpoint:          "10.1.0.4:51820",
+				AllowedIPs:        []string{"10.0.0.5/32"},
+				LastHandshakeTime: handshake,
+				ReceiveBytes:      100,
+				TransmitBytes:     200,
+			},
+			{PublicKey: pubK2},
+		}))
+	})
+
+	It("should return error when wireguard device is not found", func() {
+		getTestHandler(getTestGwConfig())
+		mnsi.EXPECT().GetNS(consts.GatewayNetnsName).Return(mns, nil)
+		mwg.EXPECT().New().Return(mclient, nil)
+		mclient.EXPECT().Device("wg-6000").Return(nil, fmt.Errorf("not found"))
+		mclient.EXPECT().Close().Return(nil)
+		Expect(serve(fmt.Sprintf("?namespace=%s&name=%s", testNamespace, testName)).Code).To(Equal(http.StatusInternalServerError))
+	})
+})
@@ -5,49 +5,99 @@ package daemon
 
 import (
 	"context"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"net"
 	"os"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/containernetworking/plugins/pkg/ns"
 	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	utiliptables "k8s.io/kubernetes/pkg/util/iptables"
+	utilexec "k8s.io/utils/exec"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/conntrackwrapper"
 	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/imds"
+	"github.com/Azure/kube-egress-gateway/pkg/logger"
+	"github.com/Azure/kube-egress-gateway/pkg/metrics"
 	"github.com/Azure/kube-egress-gateway/pkg/netlinkwrapper"
 	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
 	"github.com/Azure/kube-egress-gateway/pkg/wgctrlwrapper"
 )
 
 var _ reconcile.Reconciler = &PodEndpointReconciler{}
 
+// resyncBackoff retries PodEndpoints failed to resync on start for about 10 minutes, e.g. while wireguard links are
+// being recreated after a node restart, later failures are left to regular reconciles
+var resyncBackoff = wait.Backoff{Duration: time.Second, Factor: 2, Cap: time.Minute, Steps: 15}
+
+// default delays of retrying PodEndpoints failed to reconcile, doubled on each consecutive failure
+const (
+	defaultPeerRetryBaseDelay = time.Second
+	defaultPeerRetryMaxDelay  = 5 * time.Minute
+)
+
 // PodEndpointReconciler reconciles gateway node network according to a PodEndpoint object
 type PodEndpointReconciler struct {
 	client.Client
 	TickerEvents chan event.GenericEvent
-	Netlink      netlinkwrapper.Interface
-	NetNS        netnswrapper.Interface
-	WgCtrl       wgctrlwrapper.Interface
+	// RetryBaseDelay and RetryMaxDelay bound the exponential backoff of retrying failed PodEndpoints, so that
+	// transient failures like a busy wireguard device are not retried in a tight loop
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	Netlink        netlinkwrapper.Interface
+	NetNS          netnswrapper.Interface
+	WgCtrl         wgctrlwrapper.Interface
+	Conntrack      conntrackwrapper.Interface
+	IPTables       utiliptables.Interface
+	// NetnsPerGateway configures each gateway in its own network namespace, named after the gateway port,
+	// instead of the shared gateway namespace created on node setup
+	NetnsPerGateway bool
+	// StrictPeerAllowedIPs limits wireguard allowed IPs of each pod peer to the single pod address, whatever prefix
+	// length the PodEndpoint carries, and refuses to configure a pod IP claimed by an older PodEndpoint of the gateway
+	StrictPeerAllowedIPs bool
+
+	// instanceMetadata queries instance metadata of this node
+	instanceMetadata func() (*imds.InstanceMetadata, error)
+
+	// tcLock serializes tc qdisc and filter changes on wireguard links
+	tcLock sync.Mutex
 }
 
 //+kubebuilder:rbac:groups=egressgateway.kubernetes.azure.com,resources=podendpoints,verbs=get;list;watch;
 //+kubebuilder:rbac:groups=egressgateway.kubernetes.azure.com,resources=podendpoints/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get
+//+kubebuilder:rbac:groups=core,resources=pods/status,verbs=patch
 //+kubebuilder:rbac:groups=egressgateway.kubernetes.azure.com,resources=staticgatewayconfigurations,verbs=get;list;watch
+//+kubebuilder:rbac:groups=egressgateway.kubernetes.azure.com,resources=gatewayvmconfigurations,verbs=get;list;watch
 //+kubebuilder:rbac:groups=egressgateway.kubernetes.azure.com,resources=gatewaystatuses,verbs=get;list;watch;create;update;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -79,21 +129,37 @@ func (r *PodEndpointReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, err
 	}
 
-	gwConfigKey := types.NamespacedName{
-		Namespace: podEndpoint.Namespace,
-		Name:      podEndpoint.Spec.StaticGatewayConfiguration,
-	}
+	gwConfigKey := podEndpoint.GetStaticGatewayConfigurationKey()
 	// Fetch the StaticGatewayConfiguration instance.
 	gwConfig := &egressgatewayv1alpha1.StaticGatewayConfiguration{}
 	if err := r.Get(ctx, gwConfigKey, gwConfig); err != nil {
+		if apierrors.IsNotFound(err) {
+			if err := r.updatePodTunnelReadyCondition(ctx, podEndpoint, corev1.ConditionFalse, consts.PodTunnelReadyReasonGatewayNotFound,
+				fmt.Sprintf("StaticGatewayConfiguration %s/%s is not found", gwConfigKey.Namespace, gwConfigKey.Name)); err != nil {
+				log.Error(err, "failed to update pod tunnel ready condition")
+			}
+		}
 		return ctrl.Result{}, fmt.Errorf("failed to fetch StaticGatewayConfiguration(%s/%s): %w", gwConfigKey.Namespace, gwConfigKey.Name, err)
 	}
+	ctx = logger.WithGateway(ctx, gwConfig)
 
 	if !applyToNode(gwConfig) {
 		// gwConfig does not apply to this node
 		return ctrl.Result{}, nil
 	}
 
+	if !gwConfig.AllowsNamespace(podEndpoint.Namespace) {
+		// peer configured before the namespace is removed from allowed namespaces is removed in cleanup
+		return ctrl.Result{}, r.updatePodTunnelReadyCondition(ctx, podEndpoint, corev1.ConditionFalse, consts.PodTunnelReadyReasonNamespaceNotAllowed,
+			fmt.Sprintf("namespace %s is not allowed to use StaticGatewayConfiguration %s/%s", podEndpoint.Namespace, gwConfigKey.Namespace, gwConfigKey.Name))
+	}
+
+	if !gwConfig.ObjectMeta.DeletionTimestamp.IsZero() {
+		// peers are removed along with the wireguard link in staticGatewayConfiguration controller
+		return ctrl.Result{}, r.updatePodTunnelReadyCondition(ctx, podEndpoint, corev1.ConditionFalse, consts.PodTunnelReadyReasonGatewayDeleting,
+			fmt.Sprintf("StaticGatewayConfiguration %s/%s is being deleted", gwConfigKey.Namespace, gwConfigKey.Name))
+	}
+
 	// Reconcile wireguard peer
 	return r.reconcile(ctx, gwConfig, podEndpoint)
 }
@@ -103,11 +169,32 @@ func (r *PodEndpointReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.Netlink = netlinkwrapper.NewNetLink()
 	r.NetNS = netnswrapper.NewNetNS()
 	r.WgCtrl = wgctrlwrapper.NewWgCtrl()
-	controller, err := ctrl.NewControllerManagedBy(mgr).For(&egressgatewayv1alpha1.PodEndpoint{}).Build(r)
+	r.Conntrack = conntrackwrapper.NewConntrack()
+	r.IPTables = utiliptables.New(utilexec.New(), utiliptables.ProtocolIPv4)
+	r.instanceMetadata = imds.GetInstanceMetadata
+	if r.RetryBaseDelay <= 0 {
+		r.RetryBaseDelay = defaultPeerRetryBaseDelay
+	}
+	if r.RetryMaxDelay <= 0 {
+		r.RetryMaxDelay = defaultPeerRetryMaxDelay
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.TODO(), &egressgatewayv1alpha1.PodEndpoint{}, podEndpointIPIndex, podEndpointIPIndexFunc); err != nil {
+		return err
+	}
+	c, err := ctrl.NewControllerManagedBy(mgr).
+		// status updates, e.g. of peer failures, do not need the peer to be configured again
+		For(&egressgatewayv1alpha1.PodEndpoint{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(controller.Options{
+			// the backoff of a PodEndpoint is reset once it is reconciled successfully
+			RateLimiter: workqueue.NewItemExponentialFailureRateLimiter(r.RetryBaseDelay, r.RetryMaxDelay),
+		}).
+		// watch StaticGatewayConfiguration to update tunnel ready condition of pods when the gateway is deleted
+		Watches(&egressgatewayv1alpha1.StaticGatewayConfiguration{}, handler.EnqueueRequestsFromMapFunc(r.mapGatewayToPodEndpoints)).
+		Build(r)
 	if err != nil {
 		return err
 	}
-	return controller.Watch(source.Channel(r.TickerEvents, &handler.EnqueueRequestForObject{}))
+	return c.Watch(source.Channel(r.TickerEvents, &handler.EnqueueRequestForObject{}))
 }
 
 func (r *PodEndpointReconciler) reconcile(
@@ -118,14 +205,64 @@ func (r *PodEndpointReconciler) reconcile(
 	log := log.FromContext(ctx)
 	log.Info("Reconciling PodEndpoint")
 
-	nsName := consts.GatewayNetnsName
+	mc := metrics.NewMetricsContext(
+		os.Getenv(consts.PodNamespaceEnvKey),
+		"daemon_reconcile_pod_endpoint",
+		"n/a",
+		"n/a",
+		strings.ToLower(fmt.Sprintf("%s/%s", gwConfig.Namespace, gwConfig.Name)),
+	) // report per gateway rather than per pod to keep metrics cardinality low
+	succeeded := false
+	defer func() { mc.ObserveControllerReconcileMetrics(succeeded) }()
+
+	if err := r.configurePeer(ctx, gwConfig, podEndpoint); err != nil {
+		r.updatePeerFailure(ctx, podEndpoint, err)
+		return ctrl.Result{}, err
+	}
+	r.updatePeerFailure(ctx, podEndpoint, nil)
+
+	peerConfigs := []egressgatewayv1alpha1.PeerConfiguration{
+		{
+			PodEndpoint:   fmt.Sprintf("%s/%s", podEndpoint.Namespace, podEndpoint.Name),
+			InterfaceName: getWireguardInterfaceName(gwConfig),
+			PublicKey:     podEndpoint.Spec.PodPublicKey,
+		},
+	}
+	if err := r.updateGatewayNodeStatus(ctx, peerConfigs, true /* add */); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.updatePodTunnelReadyCondition(ctx, podEndpoint, corev1.ConditionTrue, consts.PodTunnelReadyReasonPeerConfigured,
+		fmt.Sprintf("wireguard peer is configured on gateway node %s", os.Getenv(consts.NodeNameEnvKey))); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to update pod tunnel ready condition: %w", err)
+	}
+
+	log.Info("Pod wireguard endpoint reconciled")
+	succeeded = true
+	return ctrl.Result{}, nil
+}
+
+// configurePeer adds the pod wireguard peer and its routes, rate limit and egress source IP in the gateway network
+// namespace
+func (r *PodEndpointReconciler) configurePeer(
+	ctx context.Context,
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+	podEndpoint *egressgatewayv1alpha1.PodEndpoint,
+) error {
+	if r.StrictPeerAllowedIPs {
+		if err := r.checkPodIPConflict(ctx, gwConfig, podEndpoint); err != nil {
+			return err
+		}
+	}
+
+	nsName := getGatewayNetnsName(gwConfig, r.NetnsPerGateway)
 	gwns, err := r.NetNS.GetNS(nsName)
 	if err != nil {
-		return ctrl.Result{}, fmt.Errorf("failed to get gateway network namespace %s: %w", nsName, err)
+		return fmt.Errorf("failed to get gateway network namespace %s: %w", nsName, err)
 	}
 	defer gwns.Close()
 
-	if err := gwns.Do(func(nn ns.NetNS) error {
+	return gwns.Do(func(nn ns.NetNS) error {
 		wgClient, err := r.WgCtrl.New()
 		if err != nil {
 			return fmt.Errorf("failed to create wgctrl client: %w", err)
@@ -137,19 +274,18 @@ func (r *PodEndpointReconciler) reconcile(
 			return fmt.Errorf("failed to parse pod wireguard public key: %w", err)
 		}
 
-		_, podIPNet, err := net.ParseCIDR(podEndpoint.Spec.PodIpAddress)
+		allowedIPs, err := getPodAllowedIPs(podEndpoint, r.StrictPeerAllowedIPs)
 		if err != nil {
-			return fmt.Errorf("failed to parse pod IPv4 address: %w", err)
+			return err
 		}
 
 		wgConfig := wgtypes.Config{
 			Peers: []wgtypes.PeerConfig{
 				{
-					PublicKey:         podPublicKey,
-					ReplaceAllowedIPs: true,
-					AllowedIPs: []net.IPNet{
-						*podIPNet,
-					},
+					PublicKey:                   podPublicKey,
+					PersistentKeepaliveInterval: getPeerKeepalive(gwConfig),
+					ReplaceAllowedIPs:           true,
+					AllowedIPs:                  allowedIPs,
 				},
 			},
 		}
@@ -161,24 +297,196 @@ func (r *PodEndpointReconciler) reconcile(
 		if err := r.addWireguardPeerRoutes(gwConfig, podEndpoint); err != nil {
 			return fmt.Errorf("failed to add pod route: %w", err)
 		}
+
+		if err := r.ensurePodRateLimit(gwConfig, podEndpoint); err != nil {
+			return fmt.Errorf("failed to apply pod egress rate limit: %w", err)
+		}
+
+		if podEndpoint.Spec.EgressDscp > 0 {
+			if err := r.ensurePodDSCPMarks(ctx, gwConfig); err != nil {
+				return fmt.Errorf("failed to mark pod egress dscp: %w", err)
+			}
+		}
+
+		if podEndpoint.Spec.EgressSourceIp != "" {
+			if err := r.ensureEgressSourceIPs(ctx, gwConfig); err != nil {
+				return fmt.Errorf("failed to pin pod egress source IP: %w", err)
+			}
+		}
+
+		if gwConfig.Spec.SnatPortRangeSize > 0 || podEndpoint.Status.SnatPortRange != "" {
+			if err := r.ensureSNATPortRanges(ctx, gwConfig); err != nil {
+				return fmt.Errorf("failed to pin pod sNAT port range: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// Resync re-applies wireguard peers, routes and SNAT rules of all PodEndpoints served by this node once on daemon
+// start. Wireguard links are recreated empty after a node restart, and peers would otherwise wait for their next
+// PodEndpoint change. Applying a PodEndpoint is idempotent, so peers already configured are not duplicated.
+func (r *PodEndpointReconciler) Resync(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("resync")
+	synced := make(map[types.NamespacedName]struct{})
+	err := wait.ExponentialBackoffWithContext(ctx, resyncBackoff, func(ctx context.Context) (bool, error) {
+		pending, err := r.resync(ctx, synced)
+		if err != nil {
+			log.Error(err, "failed to resync PodEndpoints")
+			return false, nil
+		}
+		if pending > 0 {
+			log.Info("Retrying PodEndpoints not resynced", "pending", pending)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Error(err, "gave up resyncing PodEndpoints, leaving them to regular reconciles")
+		}
 		return nil
-	}); err != nil {
-		return ctrl.Result{}, err
 	}
+	log.Info("PodEndpoints resynced", "count", len(synced))
+	return nil
+}
 
-	peerConfigs := []egressgatewayv1alpha1.PeerConfiguration{
-		{
-			PodEndpoint:   fmt.Sprintf("%s/%s", podEndpoint.Namespace, podEndpoint.Name),
-			InterfaceName: getWireguardInterfaceName(gwConfig),
-			PublicKey:     podEndpoint.Spec.PodPublicKey,
-		},
+// resync applies PodEndpoints of ready gateways on this node not in synced yet, and returns the number of failed ones
+func (r *PodEndpointReconciler) resync(ctx context.Context, synced map[types.NamespacedName]struct{}) (int, error) {
+	log := log.FromContext(ctx)
+	gwConfigList := &egressgatewayv1alpha1.StaticGatewayConfigurationList{}
+	if err := r.List(ctx, gwConfigList); err != nil {
+		return 0, fmt.Errorf("failed to list staticGatewayConfigurations: %w", err)
 	}
-	if err := r.updateGatewayNodeStatus(ctx, peerConfigs, true /* add */); err != nil {
-		return ctrl.Result{}, err
+	gwConfigMap := make(map[types.NamespacedName]*egressgatewayv1alpha1.StaticGatewayConfiguration)
+	for i := range gwConfigList.Items {
+		gwConfig := &gwConfigList.Items[i]
+		// peers of gateways not ready yet are applied when the gateway status is updated
+		if isReady(gwConfig) && applyToNode(gwConfig) && gwConfig.ObjectMeta.DeletionTimestamp.IsZero() {
+			gwConfigMap[client.ObjectKeyFromObject(gwConfig)] = gwConfig
+		}
+	}
+	if len(gwConfigMap) == 0 {
+		return 0, nil
 	}
 
-	log.Info("Pod wireguard endpoint reconciled")
-	return ctrl.Result{}, nil
+	podEndpointList := &egressgatewayv1alpha1.PodEndpointList{}
+	if err := r.List(ctx, podEndpointList); err != nil {
+		return 0, fmt.Errorf("failed to list PodEndpoints: %w", err)
+	}
+	pending := 0
+	for i := range podEndpointList.Items {
+		podEndpoint := &podEndpointList.Items[i]
+		key := client.ObjectKeyFromObject(podEndpoint)
+		if _, ok := synced[key]; ok {
+			continue
+		}
+		gwConfig, ok := gwConfigMap[podEndpoint.GetStaticGatewayConfigurationKey()]
+		if !ok || !gwConfig.AllowsNamespace(podEndpoint.Namespace) {
+			continue
+		}
+		if _, err := r.reconcile(logger.WithGateway(ctx, gwConfig), gwConfig, podEndpoint); err != nil {
+			log.Error(err, "failed to resync PodEndpoint", "podEndpoint", key)
+			pending++
+			continue
+		}
+		synced[key] = struct{}{}
+	}
+	return pending, nil
+}
+
+// mapGatewayToPodEndpoints enqueues PodEndpoints using the StaticGatewayConfiguration
+func (r *PodEndpointReconciler) mapGatewayToPodEndpoints(ctx context.Context, obj client.Object) []reconcile.Request {
+	log := log.FromContext(ctx)
+	// pods in other namespaces may use the gateway as well
+	podEndpointList := &egressgatewayv1alpha1.PodEndpointList{}
+	if err := r.List(ctx, podEndpointList); err != nil {
+		log.Error(err, "failed to list PodEndpoints")
+		return nil
+	}
+	gwConfigKey := types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+	var requests []reconcile.Request
+	for _, podEndpoint := range podEndpointList.Items {
+		if podEndpoint.GetStaticGatewayConfigurationKey() == gwConfigKey {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: podEndpoint.Namespace, Name: podEndpoint.Name}})
+		}
+	}
+	return requests
+}
+
+// updatePodTunnelReadyCondition sets tunnel ready condition of the pod owning podEndpoint,
+// pods not declaring the readiness gate are skipped
+func (r *PodEndpointReconciler) updatePodTunnelReadyCondition(
+	ctx context.Context,
+	podEndpoint *egressgatewayv1alpha1.PodEndpoint,
+	status corev1.ConditionStatus,
+	reason, message string,
+) error {
+	log := log.FromContext(ctx)
+
+	// podEndpoint has the same namespace/name as the pod
+	pod := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: podEndpoint.Namespace, Name: podEndpoint.Name}, pod); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !slices.ContainsFunc(pod.Spec.ReadinessGates, func(gate corev1.PodReadinessGate) bool {
+		return gate.ConditionType == consts.PodTunnelReadyConditionType
+	}) {
+		return nil
+	}
+
+	original := pod.DeepCopy()
+	condition := corev1.PodCondition{
+		Type:               consts.PodTunnelReadyConditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: metav1.Now(),
+	}
+	if i := slices.IndexFunc(pod.Status.Conditions, func(c corev1.PodCondition) bool {
+		return c.Type == consts.PodTunnelReadyConditionType
+	}); i >= 0 {
+		existing := pod.Status.Conditions[i]
+		if existing.Status == status && existing.Reason == reason {
+			return nil
+		}
+		if existing.Status == status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+		pod.Status.Conditions[i] = condition
+	} else {
+		pod.Status.Conditions = append(pod.Status.Conditions, condition)
+	}
+	log.Info("Updating pod tunnel ready condition", "status", status, "reason", reason)
+	return r.Status().Patch(ctx, pod, client.StrategicMergeFrom(original))
+}
+
+// updatePeerFailure counts consecutive failures of this node to configure the pod wireguard peer in podEndpoint
+// status, and removes them once peerErr is nil. The patch only touches the entry of this node, so that gateway nodes
+// serving the pod concurrently keep their own failures. Errors of the status update are only logged, as the peer is
+// retried anyway.
+func (r *PodEndpointReconciler) updatePeerFailure(ctx context.Context, podEndpoint *egressgatewayv1alpha1.PodEndpoint, peerErr error) {
+	nodeName := os.Getenv(consts.NodeNameEnvKey)
+	failure, failed := podEndpoint.Status.PeerFailures[nodeName]
+	var nodeFailure *egressgatewayv1alpha1.PeerFailure
+	switch {
+	case peerErr != nil:
+		nodeFailure = &egressgatewayv1alpha1.PeerFailure{Retries: failure.Retries + 1, LastError: peerErr.Error()}
+	case !failed:
+		return
+	}
+	patch, err := json.Marshal(map[string]any{
+		"status": map[string]any{
+			"peerFailures": map[string]*egressgatewayv1alpha1.PeerFailure{nodeName: nodeFailure},
+		},
+	})
+	if err != nil {
+		log.FromContext(ctx).Error(err, "failed to marshal PodEndpoint peer failure status")
+		return
+	}
+	if err := r.Status().Patch(ctx, podEndpoint, client.RawPatch(types.MergePatchType, patch)); err != nil {
+		log.FromContext(ctx).Error(err, "failed to update PodEndpoint peer failure status")
+	}
 }
 
 func (r *PodEndpointReconciler) cleanUp(ctx context.Context) error {
@@ -193,19 +501,22 @@ func (r *PodEndpointReconciler) cleanUp(ctx context.Context) error {
 	if err := r.List(ctx, gwConfigList); err != nil {
 		return fmt.Errorf("failed to list staticGatewayConfigurations: %w", err)
 	}
-	gwConfigMap := make(map[string]string)
-	for _, gwConfig := range gwConfigList.Items {
-		gwConfig := gwConfig
+	gwConfigMap := make(map[string]*egressgatewayv1alpha1.StaticGatewayConfiguration)
+	for i := range gwConfigList.Items {
+		gwConfig := &gwConfigList.Items[i]
 		// skip deleting gwConfig, as the wglink will be deleted in staticGatewayConfiguration controller
-		if applyToNode(&gwConfig) && gwConfig.ObjectMeta.DeletionTimestamp.IsZero() {
-			gwConfigMap[strings.ToLower(fmt.Sprintf("%s/%s", gwConfig.Namespace, gwConfig.Name))] = getWireguardInterfaceName(&gwConfig)
+		if applyToNode(gwConfig) && gwConfig.ObjectMeta.DeletionTimestamp.IsZero() {
+			gwConfigMap[strings.ToLower(fmt.Sprintf("%s/%s", gwConfig.Namespace, gwConfig.Name))] = gwConfig
 		}
 	}
 
-	// map: gw-namespace-name -> set of peer public keys
+	// map: wglink name -> set of peer public keys
 	peerMap := make(map[string]map[string]struct{})
 	for _, podEndpoint := range podEndpointList.Items {
-		if wglinkName, ok := gwConfigMap[strings.ToLower(fmt.Sprintf("%s/%s", podEndpoint.Namespace, podEndpoint.Spec.StaticGatewayConfiguration))]; ok {
+		gwConfig, ok := gwConfigMap[strings.ToLower(podEndpoint.GetStaticGatewayConfigurationKey().String())]
+		// peers of pods in namespaces no longer allowed to use the gateway are removed as well
+		if ok && gwConfig.AllowsNamespace(podEndpoint.Namespace) {
+			wglinkName := getWireguardInterfaceName(gwConfig)
 			if _, exists := peerMap[wglinkName]; !exists {
 				peerMap[wglinkName] = make(map[string]struct{})
 			}
@@ -214,8 +525,9 @@ func (r *PodEndpointReconciler) cleanUp(ctx context.Context) error {
 	}
 
 	var peersToDelete []egressgatewayv1alpha1.PeerConfiguration
-	for _, wglinkName := range gwConfigMap {
-		peers, err := r.cleanUpWgLink(ctx, wglinkName, peerMap)
+	for _, gwConfig := range gwConfigMap {
+		wglinkName := getWireguardInterfaceName(gwConfig)
+		peers, err := r.cleanUpWgLink(ctx, gwConfig, peerMap)
 		if err != nil {
 			// do not block cleaning up rest namespaces
 			log.Error(err, fmt.Sprintf("failed to clean up peers for wgLink %s", wglinkName))
@@ -232,16 +544,18 @@ func (r *PodEndpointReconciler) cleanUp(ctx context.Context) error {
 
 func (r *PodEndpointReconciler) cleanUpWgLink(
 	ctx context.Context,
-	wglinkName string,
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
 	peerMap map[string]map[string]struct{},
 ) ([]egressgatewayv1alpha1.PeerConfiguration, error) {
 	log := log.FromContext(ctx)
+	wglinkName := getWireguardInterfaceName(gwConfig)
 
 	peersToDelete := make([]egressgatewayv1alpha1.PeerConfiguration, 0)
 
-	gwns, err := r.NetNS.GetNS(consts.GatewayNetnsName)
+	nsName := getGatewayNetnsName(gwConfig, r.NetnsPerGateway)
+	gwns, err := r.NetNS.GetNS(nsName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get gateway network namespace %s: %w", consts.GatewayNetnsName, err)
+		return nil, fmt.Errorf("failed to get gateway network namespace %s: %w", nsName, err)
 	}
 	defer gwns.Close()
 
@@ -276,14 +590,37 @@ func (r *PodEndpointReconciler) cleanUpWgLink(
 				return fmt.Errorf("failed to delete pod route on wglink %s: %w", wglinkName, err)
 			}
 
+			if err := r.deletePodRateLimits(wglinkName, podIPToDel); err != nil {
+				return fmt.Errorf("failed to delete pod egress rate limit on wglink %s: %w", wglinkName, err)
+			}
+
 			if err := wgClient.ConfigureDevice(wglinkName, wgConfig); err != nil {
 				return fmt.Errorf("failed to remove peers from wireguard device %s: %w", wglinkName, err)
 			}
 
+			// flush after peers are removed so that no new connection is tracked for the pod ips,
+			// otherwise existing connections keep the old SNAT ip until conntrack entries expire
+			r.flushPodConntrackEntries(ctx, podIPToDel)
+
 			for _, peer := range wgConfig.Peers {
 				peersToDelete = append(peersToDelete, egressgatewayv1alpha1.PeerConfiguration{PublicKey: peer.PublicKey.String()})
 			}
 		}
+
+		// release egress source IPs of deleted PodEndpoints
+		if err := r.ensureEgressSourceIPs(ctx, gwConfig); err != nil {
+			return fmt.Errorf("failed to reconcile egress source IPs on wglink %s: %w", wglinkName, err)
+		}
+
+		// release dscp marks of deleted PodEndpoints
+		if err := r.ensurePodDSCPMarks(ctx, gwConfig); err != nil {
+			return fmt.Errorf("failed to reconcile pod dscp marks on wglink %s: %w", wglinkName, err)
+		}
+
+		// release sNAT port ranges of deleted PodEndpoints
+		if err := r.ensureSNATPortRanges(ctx, gwConfig); err != nil {
+			return fmt.Errorf("failed to reconcile sNAT port ranges on wglink %s: %w", wglinkName, err)
+		}
 		return nil
 	}); err != nil {
 		return nil, err
@@ -300,23 +637,52 @@ func (r *PodEndpointReconciler) addWireguardPeerRoutes(
 		return fmt.Errorf("failed to retrieve wireguard device: %w", err)
 	}
 
-	_, dst, err := net.ParseCIDR(podEndpoint.Spec.PodIpAddress)
+	allowedIPs, err := getPodAllowedIPs(podEndpoint, r.StrictPeerAllowedIPs)
 	if err != nil {
-		return fmt.Errorf("failed to parse pod ip net %s: %w", podEndpoint.Spec.PodIpAddress, err)
+		return err
 	}
 
-	route := &netlink.Route{
-		LinkIndex: wgLink.Attrs().Index,
-		Scope:     netlink.SCOPE_LINK,
-		Dst:       dst,
-	}
-	if err := r.Netlink.RouteReplace(route); err != nil {
-		return fmt.Errorf("failed to add route %s: %w", route, err)
+	for i := range allowedIPs {
+		route := &netlink.Route{
+			LinkIndex: wgLink.Attrs().Index,
+			Scope:     netlink.SCOPE_LINK,
+			Dst:       &allowedIPs[i],
+		}
+		if err := r.Netlink.RouteReplace(route); err != nil {
+			return fmt.Errorf("failed to add route %s: %w", route, err)
+		}
 	}
 
 	return nil
 }
 
+// getPeerKeepalive returns the persistent keepalive interval of pod peers, it is always set so that
+// disabling keepalive on the gateway takes effect on existing peers as well. Without one set by the gateway, only
+// pods behind NAT send keepalives, the gateway side has nothing to keep alive.
+func getPeerKeepalive(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) *time.Duration {
+	keepalive := time.Duration(to.Val(gwConfig.Spec.PersistentKeepaliveSeconds)) * time.Second
+	return &keepalive
+}
+
+// getPodAllowedIPs returns pod IPv4 address and, for dual-stack pods, IPv6 address as wireguard peer allowed IPs,
+// limited to the pod addresses when strict
+func getPodAllowedIPs(podEndpoint *egressgatewayv1alpha1.PodEndpoint, strict bool) ([]net.IPNet, error) {
+	podIPNet, err := parsePodAllowedIP(podEndpoint.Spec.PodIpAddress, strict)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pod IPv4 address %s: %w", podEndpoint.Spec.PodIpAddress, err)
+	}
+	allowedIPs := []net.IPNet{*podIPNet}
+
+	if podEndpoint.Spec.PodIpv6Address != "" {
+		podIPv6Net, err := parsePodAllowedIP(podEndpoint.Spec.PodIpv6Address, strict)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse pod IPv6 address %s: %w", podEndpoint.Spec.PodIpv6Address, err)
+		}
+		allowedIPs = append(allowedIPs, *podIPv6Net)
+	}
+	return allowedIPs, nil
+}
+
 func (r *PodEndpointReconciler) deleteWireguardPeerRoutes(
 	wglinkName string,
 	podIPToDel map[string]bool,
@@ -343,6 +709,237 @@ func (r *PodEndpointReconciler) deleteWireguardPeerRoutes(
 	return nil
 }
 
+// flushPodConntrackEntries deletes conntrack entries originated from the pod ips in current network namespace
+func (r *PodEndpointReconciler) flushPodConntrackEntries(ctx context.Context, podIPToDel map[string]bool) {
+	log := log.FromContext(ctx)
+	for podIP := range podIPToDel {
+		ip := net.ParseIP(podIP)
+		if ip == nil {
+			continue
+		}
+		family := netlink.InetFamily(netlink.FAMILY_V4)
+		if ip.To4() == nil {
+			family = netlink.InetFamily(netlink.FAMILY_V6)
+		}
+		filter := &netlink.ConntrackFilter{}
+		if err := filter.AddIP(netlink.ConntrackOrigSrcIP, ip); err != nil {
+			log.Error(err, "failed to build conntrack filter", "podIP", podIP)
+			continue
+		}
+		deleted, err := r.Conntrack.ConntrackDeleteFilter(netlink.ConntrackTable, family, filter)
+		if err != nil {
+			// peer is already removed, do not fail the cleanup because of stale conntrack entries
+			log.Error(err, "failed to flush conntrack entries", "podIP", podIP)
+			continue
+		}
+		if deleted > 0 {
+			log.Info(fmt.Sprintf("Flushed %d conntrack entries of pod ip %s", deleted, podIP))
+		}
+	}
+}
+
+// ensurePodRateLimit polices traffic from the pod on ingress of the wireguard link, which limits the pod egress bandwidth.
+// Filters of the pod are removed when the rate limit is cleared.
+func (r *PodEndpointReconciler) ensurePodRateLimit(
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+	podEndpoint *egressgatewayv1alpha1.PodEndpoint,
+) error {
+	allowedIPs, err := getPodAllowedIPs(podEndpoint, r.StrictPeerAllowedIPs)
+	if err != nil {
+		return err
+	}
+	podIPs := make([]net.IP, 0, len(allowedIPs))
+	for _, ipNet := range allowedIPs {
+		podIPs = append(podIPs, ipNet.IP)
+	}
+
+	wgLink, err := r.Netlink.LinkByName(getWireguardInterfaceName(gwConfig))
+	if err != nil {
+		return fmt.Errorf("failed to retrieve wireguard device: %w", err)
+	}
+
+	r.tcLock.Lock()
+	defer r.tcLock.Unlock()
+
+	qdiscs, err := r.Netlink.QdiscList(wgLink)
+	if err != nil {
+		return fmt.Errorf("failed to list qdiscs on wireguard device: %w", err)
+	}
+	if podEndpoint.Spec.EgressRateLimitMbps <= 0 {
+		if !hasIngressQdisc(qdiscs) {
+			return nil
+		}
+		return r.deleteIPFilters(wgLink, podIPs)
+	}
+	if !hasIngressQdisc(qdiscs) {
+		qdisc := &netlink.Ingress{
+			QdiscAttrs: netlink.QdiscAttrs{
+				LinkIndex: wgLink.Attrs().Index,
+				Handle:    netlink.MakeHandle(0xffff, 0),
+				Parent:    netlink.HANDLE_INGRESS,
+			},
+		}
+		if err := r.Netlink.QdiscAdd(qdisc); err != nil {
+			return fmt.Errorf("failed to add ingress qdisc on wireguard device: %w", err)
+		}
+	}
+
+	rate := uint32(podEndpoint.Spec.EgressRateLimitMbps) * 125000 // bytes per second
+	burst := rate / 10                                            // bytes sent in 100ms
+	if podEndpoint.Spec.EgressBurstKB > 0 {
+		burst = uint32(podEndpoint.Spec.EgressBurstKB) * 1024
+	}
+
+	filters, err := r.Netlink.FilterList(wgLink, netlink.HANDLE_INGRESS)
+	if err != nil {
+		return fmt.Errorf("failed to list ingress filters on wireguard device: %w", err)
+	}
+	for _, ip := range podIPs {
+		upToDate := false
+		for _, filter := range filters {
+			u32, ok := filter.(*netlink.U32)
+			if !ok || !ipMatchesFilter(u32, ip) {
+				continue
+			}
+			// burst is not compared as kernel reports it in scheduler ticks
+			if police := getPoliceAction(u32); police != nil && police.Rate == rate {
+				upToDate = true
+				continue
+			}
+			if err := r.Netlink.FilterDel(u32); err != nil {
+				return fmt.Errorf("failed to delete outdated ingress filter for pod ip %s: %w", ip, err)
+			}
+		}
+		if upToDate {
+			continue
+		}
+		if err := r.Netlink.FilterAdd(getPodRateLimitFilter(wgLink.Attrs().Index, ip, rate, burst)); err != nil {
+			return fmt.Errorf("failed to add ingress filter for pod ip %s: %w", ip, err)
+		}
+	}
+	return nil
+}
+
+// getPodRateLimitFilter returns the filter policing packets from ip, IPv4 and IPv6 filters have different priorities
+// as filters of the same priority must have the same protocol
+func getPodRateLimitFilter(linkIndex int, ip net.IP, rate, burst uint32) *netlink.U32 {
+	police := netlink.NewPoliceAction()
+	police.Rate = rate
+	police.Burst = burst
+	police.ExceedAction = netlink.TC_POLICE_SHOT
+	filter := &netlink.U32{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: linkIndex,
+			Parent:    netlink.HANDLE_INGRESS,
+			Priority:  1,
+			Protocol:  unix.ETH_P_IP,
+		},
+		Sel: &netlink.TcU32Sel{
+			Flags: nl.TC_U32_TERMINAL,
+			// match source ip in ip header, wireguard link has no link layer header
+			Keys: getSourceIPKeys(ip),
+		},
+		Actions: []netlink.Action{police},
+	}
+	if ip.To4() == nil {
+		filter.Priority = 2
+		filter.Protocol = unix.ETH_P_IPV6
+	}
+	return filter
+}
+
+// getSourceIPKeys returns u32 keys matching ip as source address, at offset 12 of the IPv4 header or offset 8 of the
+// IPv6 header
+func getSourceIPKeys(ip net.IP) []netlink.TcU32Key {
+	if ip4 := ip.To4(); ip4 != nil {
+		return []netlink.TcU32Key{{Mask: 0xffffffff, Val: binary.BigEndian.Uint32(ip4), Off: 12}}
+	}
+	ip6 := ip.To16()
+	keys := make([]netlink.TcU32Key, 0, 4)
+	for i := 0; i < 4; i++ {
+		keys = append(keys, netlink.TcU32Key{Mask: 0xffffffff, Val: binary.BigEndian.Uint32(ip6[i*4 : i*4+4]), Off: int32(8 + i*4)})
+	}
+	return keys
+}
+
+// deletePodRateLimits removes ingress filters of deleted pods from the wireguard link
+func (r *PodEndpointReconciler) deletePodRateLimits(
+	wglinkName string,
+	podIPToDel map[string]bool,
+) error {
+	wgLink, err := r.Netlink.LinkByName(wglinkName)
+	if err != nil {
+		return fmt.Errorf("failed to get wglink %s: %w", wglinkName, err)
+	}
+
+	r.tcLock.Lock()
+	defer r.tcLock.Unlock()
+
+	qdiscs, err := r.Netlink.QdiscList(wgLink)
+	if err != nil {
+		return fmt.Errorf("failed to list qdiscs on wglink %s: %w", wglinkName, err)
+	}
+	if !hasIngressQdisc(qdiscs) {
+		return nil
+	}
+
+	podIPs := make([]net.IP, 0, len(podIPToDel))
+	for podIP := range podIPToDel {
+		podIPs = append(podIPs, net.ParseIP(podIP))
+	}
+	return r.deleteIPFilters(wgLink, podIPs)
+}
+
+// deleteIPFilters removes ingress filters of ips from wgLink, tcLock must be held
+func (r *PodEndpointReconciler) deleteIPFilters(wgLink netlink.Link, ips []net.IP) error {
+	filters, err := r.Netlink.FilterList(wgLink, netlink.HANDLE_INGRESS)
+	if err != nil {
+		return fmt.Errorf("failed to list ingress filters on wglink %s: %w", wgLink.Attrs().Name, err)
+	}
+	for _, filter := range filters {
+		u32, ok := filter.(*netlink.U32)
+		if !ok {
+			continue
+		}
+		for _, ip := range ips {
+			if ipMatchesFilter(u32, ip) {
+				if err := r.Netlink.FilterDel(u32); err != nil {
+					return fmt.Errorf("failed to delete ingress filter for pod ip %s: %w", ip, err)
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func hasIngressQdisc(qdiscs []netlink.Qdisc) bool {
+	for _, qdisc := range qdiscs {
+		if qdisc.Type() == "ingress" {
+			return true
+		}
+	}
+	return false
+}
+
+func ipMatchesFilter(u32 *netlink.U32, ip net.IP) bool {
+	if ip == nil || u32.Sel == nil {
+		return false
+	}
+	return slices.EqualFunc(u32.Sel.Keys, getSourceIPKeys(ip), func(a, b netlink.TcU32Key) bool {
+		return a.Off == b.Off && a.Mask == b.Mask && a.Val == b.Val
+	})
+}
+
+func getPoliceAction(u32 *netlink.U32) *netlink.PoliceAction {
+	for _, action := range u32.Actions {
+		if police, ok := action.(*netlink.PoliceAction); ok {
+			return police
+		}
+	}
+	return nil
+}
+
 func (r *PodEndpointReconciler) updateGatewayNodeStatus(
 	ctx context.Context,
 	peerConfigs []egressgatewayv1alpha1.PeerConfiguration,
@@ -4,22 +4,28 @@ package daemon
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"net"
 	"os"
 	"sort"
+	"sync"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
 	"go.uber.org/mock/gomock"
+	"golang.org/x/sys/unix"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -27,10 +33,13 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/conntrackwrapper/mockconntrackwrapper"
 	"github.com/Azure/kube-egress-gateway/pkg/consts"
 	"github.com/Azure/kube-egress-gateway/pkg/imds"
+	fakeiptables "github.com/Azure/kube-egress-gateway/pkg/iptableswrapper"
 	"github.com/Azure/kube-egress-gateway/pkg/netlinkwrapper/mocknetlinkwrapper"
 	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper/mocknetnswrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
 	"github.com/Azure/kube-egress-gateway/pkg/wgctrlwrapper/mockwgctrlwrapper"
 )
 
@@ -54,11 +63,15 @@ var _ = Describe("Daemon PodEndpoint controller unit tests", func() {
 
 	getTestReconciler := func(objects ...runtime.Object) {
 		mctrl := gomock.NewController(GinkgoT())
-		cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(objects...).Build()
+		cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(objects...).
+			WithIndex(&egressgatewayv1alpha1.PodEndpoint{}, podEndpointIPIndex, podEndpointIPIndexFunc).
+			Build()
 		r = &PodEndpointReconciler{Client: cl}
 		r.Netlink = mocknetlinkwrapper.NewMockInterface(mctrl)
 		r.NetNS = mocknetnswrapper.NewMockInterface(mctrl)
 		r.WgCtrl = mockwgctrlwrapper.NewMockInterface(mctrl)
+		r.Conntrack = mockconntrackwrapper.NewMockInterface(mctrl)
+		r.IPTables = fakeiptables.NewFake()
 		mclient = mockwgctrlwrapper.NewMockClient(mctrl)
 	}
 
@@ -188,8 +201,9 @@ var _ = Describe("Daemon PodEndpoint controller unit tests", func() {
 			config := wgtypes.Config{
 				Peers: []wgtypes.PeerConfig{
 					{
-						PublicKey:         pk,
-						ReplaceAllowedIPs: true,
+						PublicKey:                   pk,
+						PersistentKeepaliveInterval: new(time.Duration),
+						ReplaceAllowedIPs:           true,
 						AllowedIPs: []net.IPNet{
 							*getIPNet(podIPAddrNet),
 						},
@@ -206,6 +220,85 @@ var _ = Describe("Daemon PodEndpoint controller unit tests", func() {
 			Expect(errors.Unwrap(reconcileErr)).To(Equal(fmt.Errorf("failed")))
 		})
 
+		It("should configure persistent keepalive of the peer", func() {
+			gwConfig.Spec.PersistentKeepaliveSeconds = to.Ptr(int32(25))
+			getTestReconciler(podEndpoint, gwConfig, node)
+			mns := r.NetNS.(*mocknetnswrapper.MockInterface)
+			mwg := r.WgCtrl.(*mockwgctrlwrapper.MockInterface)
+			gwns := &mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}
+			pk, _ := wgtypes.ParseKey(pubK)
+			keepalive := 25 * time.Second
+			config := wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{
+					{
+						PublicKey:                   pk,
+						PersistentKeepaliveInterval: &keepalive,
+						ReplaceAllowedIPs:           true,
+						AllowedIPs: []net.IPNet{
+							*getIPNet(podIPAddrNet),
+						},
+					},
+				},
+			}
+			gomock.InOrder(
+				mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(gwns, nil),
+				mwg.EXPECT().New().Return(mclient, nil),
+				mclient.EXPECT().ConfigureDevice("wg-6000", config).Return(fmt.Errorf("failed")),
+				mclient.EXPECT().Close().Return(nil),
+			)
+			_, reconcileErr = r.Reconcile(context.TODO(), req)
+			Expect(errors.Unwrap(reconcileErr)).To(Equal(fmt.Errorf("failed")))
+		})
+
+		It("should keep the peer handshake when route cidrs of the pod change", func() {
+			mns := r.NetNS.(*mocknetnswrapper.MockInterface)
+			mwg := r.WgCtrl.(*mockwgctrlwrapper.MockInterface)
+			mnl := r.Netlink.(*mocknetlinkwrapper.MockInterface)
+			gwns := &mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}
+			wg0 := &netlink.Wireguard{}
+			pk, _ := wgtypes.ParseKey(pubK)
+			handshake := time.Now().Add(-time.Minute).Truncate(time.Second)
+			// the gateway wireguard device, updated by ConfigureDevice like the kernel does, which resets the
+			// handshake of removed or replaced peers only
+			peers := map[wgtypes.Key]wgtypes.Peer{pk: {PublicKey: pk, LastHandshakeTime: handshake}}
+			mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(gwns, nil).Times(2)
+			mwg.EXPECT().New().Return(mclient, nil).Times(2)
+			mclient.EXPECT().Close().Return(nil).Times(2)
+			mclient.EXPECT().ConfigureDevice("wg-6000", gomock.Any()).DoAndReturn(func(_ string, cfg wgtypes.Config) error {
+				if cfg.ReplacePeers {
+					clear(peers)
+				}
+				for _, peerConfig := range cfg.Peers {
+					peer, ok := peers[peerConfig.PublicKey]
+					if peerConfig.Remove {
+						delete(peers, peerConfig.PublicKey)
+						continue
+					}
+					if !ok {
+						peer = wgtypes.Peer{PublicKey: peerConfig.PublicKey}
+					}
+					peer.AllowedIPs = peerConfig.AllowedIPs
+					peers[peerConfig.PublicKey] = peer
+				}
+				return nil
+			}).Times(2)
+			mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil).AnyTimes()
+			mnl.EXPECT().RouteReplace(&netlink.Route{LinkIndex: 0, Scope: netlink.SCOPE_LINK, Dst: getIPNet(podIPAddrNet)}).Return(nil).Times(2)
+			mnl.EXPECT().QdiscList(wg0).Return(nil, nil).Times(2)
+
+			_, reconcileErr = r.Reconcile(context.TODO(), req)
+			Expect(reconcileErr).To(BeNil())
+			// the cni manager records route cidrs changes applied to the running pod
+			Expect(r.Get(context.TODO(), req.NamespacedName, podEndpoint)).To(Succeed())
+			podEndpoint.Spec.ExceptionCidrs = []string{"1.1.0.0/16"}
+			podEndpoint.Spec.IncludeCidrs = []string{"3.3.0.0/16"}
+			Expect(r.Update(context.TODO(), podEndpoint)).To(Succeed())
+			_, reconcileErr = r.Reconcile(context.TODO(), req)
+			Expect(reconcileErr).To(BeNil())
+			Expect(peers).To(HaveKey(pk))
+			Expect(peers[pk].LastHandshakeTime).To(Equal(handshake))
+		})
+
 		Context("test adding peer route", func() {
 			BeforeEach(func() {
 				mns := r.NetNS.(*mocknetnswrapper.MockInterface)
@@ -215,8 +308,9 @@ var _ = Describe("Daemon PodEndpoint controller unit tests", func() {
 				config := wgtypes.Config{
 					Peers: []wgtypes.PeerConfig{
 						{
-							PublicKey:         pk,
-							ReplaceAllowedIPs: true,
+							PublicKey:                   pk,
+							PersistentKeepaliveInterval: new(time.Duration),
+							ReplaceAllowedIPs:           true,
 							AllowedIPs: []net.IPNet{
 								*getIPNet(podIPAddrNet),
 							},
@@ -256,6 +350,8 @@ var _ = Describe("Daemon PodEndpoint controller unit tests", func() {
 				gomock.InOrder(
 					mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
 					mnl.EXPECT().RouteReplace(&netlink.Route{LinkIndex: 0, Scope: netlink.SCOPE_LINK, Dst: getIPNet(podIPAddrNet)}).Return(nil),
+					mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+					mnl.EXPECT().QdiscList(wg0).Return(nil, nil),
 				)
 				_, reconcileErr = r.Reconcile(context.TODO(), req)
 				Expect(reconcileErr).To(BeNil())
@@ -270,6 +366,657 @@ var _ = Describe("Daemon PodEndpoint controller unit tests", func() {
 					},
 				}))
 			})
+
+			It("should set tunnel ready condition on pod declaring the readiness gate", func() {
+				mnl := r.Netlink.(*mocknetlinkwrapper.MockInterface)
+				wg0 := &netlink.Wireguard{}
+				gomock.InOrder(
+					mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+					mnl.EXPECT().RouteReplace(&netlink.Route{LinkIndex: 0, Scope: netlink.SCOPE_LINK, Dst: getIPNet(podIPAddrNet)}).Return(nil),
+					mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+					mnl.EXPECT().QdiscList(wg0).Return(nil, nil),
+				)
+				Expect(r.Create(context.TODO(), getTestPod())).To(Succeed())
+				_, reconcileErr = r.Reconcile(context.TODO(), req)
+				Expect(reconcileErr).To(BeNil())
+				condition := getPodTunnelReadyCondition(r.Client)
+				Expect(condition).NotTo(BeNil())
+				Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+				Expect(condition.Reason).To(Equal(consts.PodTunnelReadyReasonPeerConfigured))
+			})
+		})
+	})
+
+	Context("Test strict peer allowed IPs", func() {
+		var (
+			mns  *mocknetnswrapper.MockInterface
+			mwg  *mockwgctrlwrapper.MockInterface
+			mnl  *mocknetlinkwrapper.MockInterface
+			gwns = &mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}
+		)
+
+		getExpectedConfig := func(allowedIP string) wgtypes.Config {
+			pk, _ := wgtypes.ParseKey(pubK)
+			return wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{
+					{
+						PublicKey:                   pk,
+						PersistentKeepaliveInterval: new(time.Duration),
+						ReplaceAllowedIPs:           true,
+						AllowedIPs:                  []net.IPNet{*getIPNet(allowedIP)},
+					},
+				},
+			}
+		}
+
+		BeforeEach(func() {
+			req = reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      testName,
+					Namespace: testNamespace,
+				},
+			}
+			podEndpoint = getTestPodEndpoint()
+			// a prefix wider than the pod address would allow the pod to send with source IPs of other pods
+			podEndpoint.Spec.PodIpAddress = "10.0.0.25/24"
+			gwConfig = getTestGwConfig()
+			nodeMeta = &imds.InstanceMetadata{
+				Compute: &imds.ComputeMetadata{
+					VMScaleSetName:    vmssName,
+					ResourceGroupName: vmssRG,
+				},
+			}
+			os.Setenv(consts.PodNamespaceEnvKey, testPodNamespace)
+			os.Setenv(consts.NodeNameEnvKey, testNodeName)
+		})
+
+		AfterEach(func() {
+			os.Setenv(consts.PodNamespaceEnvKey, "")
+			os.Setenv(consts.NodeNameEnvKey, "")
+		})
+
+		getStrictTestReconciler := func(objects ...runtime.Object) {
+			getTestReconciler(objects...)
+			r.StrictPeerAllowedIPs = true
+		}
+
+		expectPeerConfigured := func(allowedIP string) {
+			mns = r.NetNS.(*mocknetnswrapper.MockInterface)
+			mwg = r.WgCtrl.(*mockwgctrlwrapper.MockInterface)
+			mnl = r.Netlink.(*mocknetlinkwrapper.MockInterface)
+			gomock.InOrder(
+				mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(gwns, nil),
+				mwg.EXPECT().New().Return(mclient, nil),
+				mclient.EXPECT().ConfigureDevice("wg-6000", getExpectedConfig(allowedIP)).Return(nil),
+				mnl.EXPECT().LinkByName("wg-6000").Return(&netlink.Wireguard{}, nil),
+				mnl.EXPECT().RouteReplace(&netlink.Route{LinkIndex: 0, Scope: netlink.SCOPE_LINK, Dst: getIPNet(allowedIP)}).Return(nil),
+				mnl.EXPECT().LinkByName("wg-6000").Return(&netlink.Wireguard{}, nil),
+				mnl.EXPECT().QdiscList(gomock.Any()).Return(nil, nil),
+				mclient.EXPECT().Close().Return(nil),
+			)
+		}
+
+		It("should limit allowed IPs and route to the pod address", func() {
+			getStrictTestReconciler(podEndpoint, gwConfig, node)
+			expectPeerConfigured("10.0.0.25/32")
+			_, reconcileErr = r.Reconcile(context.TODO(), req)
+			Expect(reconcileErr).To(BeNil())
+		})
+
+		It("should keep the prefix of pod address when not strict", func() {
+			getTestReconciler(podEndpoint, gwConfig, node)
+			expectPeerConfigured("10.0.0.0/24")
+			_, reconcileErr = r.Reconcile(context.TODO(), req)
+			Expect(reconcileErr).To(BeNil())
+		})
+
+		It("should configure pods with different IPs of the same gateway", func() {
+			another := getTestPodEndpoint()
+			another.Name = "another"
+			another.Spec.PodIpAddress = "10.0.0.26/32"
+			getStrictTestReconciler(podEndpoint, another, gwConfig, node)
+			expectPeerConfigured("10.0.0.25/32")
+			_, reconcileErr = r.Reconcile(context.TODO(), req)
+			Expect(reconcileErr).To(BeNil())
+		})
+
+		It("should configure pods with the same IP on different gateways", func() {
+			another := getTestPodEndpoint()
+			another.Name = "another"
+			another.Spec.StaticGatewayConfiguration = "another-gateway"
+			another.Spec.PodIpAddress = "10.0.0.25/32"
+			getStrictTestReconciler(podEndpoint, another, gwConfig, node)
+			expectPeerConfigured("10.0.0.25/32")
+			_, reconcileErr = r.Reconcile(context.TODO(), req)
+			Expect(reconcileErr).To(BeNil())
+		})
+
+		It("should keep pod IP used by PodEndpoints of the gateway on the oldest one", func() {
+			created := time.Now().Truncate(time.Second)
+			podEndpoint.CreationTimestamp = metav1.NewTime(created)
+			another := getTestPodEndpoint()
+			another.Name = "another"
+			another.Spec.PodPublicKey = pubK2
+			another.Spec.PodIpAddress = "10.0.0.25/32"
+			another.CreationTimestamp = metav1.NewTime(created.Add(time.Second))
+			getStrictTestReconciler(podEndpoint, another, gwConfig, node)
+
+			// the newer PodEndpoint is refused without network namespace or wireguard access
+			_, reconcileErr = r.Reconcile(context.TODO(), reconcile.Request{NamespacedName: types.NamespacedName{Name: "another", Namespace: testNamespace}})
+			Expect(reconcileErr).To(MatchError(ContainSubstring("pod IP 10.0.0.25/32 is already used by PodEndpoint " + testNamespace + "/" + testName)))
+
+			// the older one is configured whatever order they are reconciled in
+			expectPeerConfigured("10.0.0.25/32")
+			_, reconcileErr = r.Reconcile(context.TODO(), req)
+			Expect(reconcileErr).To(BeNil())
+		})
+
+		It("should keep pod IP used by PodEndpoints created at the same time on the first by name", func() {
+			another := getTestPodEndpoint()
+			another.Name = "another"
+			another.Spec.PodPublicKey = pubK2
+			another.Spec.PodIpAddress = "10.0.0.25/32"
+			getStrictTestReconciler(podEndpoint, another, gwConfig, node)
+			_, reconcileErr = r.Reconcile(context.TODO(), req)
+			Expect(reconcileErr).To(MatchError(ContainSubstring("pod IP 10.0.0.25/32 is already used by PodEndpoint " + testNamespace + "/another")))
+		})
+
+		It("should limit ipv6 allowed IPs to the pod address", func() {
+			ipNet, err := parsePodAllowedIP("fd00:10::25/64", true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ipNet.String()).To(Equal("fd00:10::25/128"))
+		})
+	})
+
+	Context("Test pod tunnel ready condition", func() {
+		BeforeEach(func() {
+			req = reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      testName,
+					Namespace: testNamespace,
+				},
+			}
+			podEndpoint = getTestPodEndpoint()
+			gwConfig = getTestGwConfig()
+			nodeMeta = &imds.InstanceMetadata{
+				Compute: &imds.ComputeMetadata{
+					VMScaleSetName:    vmssName,
+					ResourceGroupName: vmssRG,
+				},
+			}
+		})
+
+		It("should set condition to false when gateway is not found", func() {
+			pod := getTestPod()
+			pod.Status.Conditions = []corev1.PodCondition{{Type: consts.PodTunnelReadyConditionType, Status: corev1.ConditionTrue, Reason: consts.PodTunnelReadyReasonPeerConfigured}}
+			getTestReconciler(podEndpoint, pod)
+			_, reconcileErr = r.Reconcile(context.TODO(), req)
+			Expect(apierrors.IsNotFound(reconcileErr)).To(BeTrue())
+			condition := getPodTunnelReadyCondition(r.Client)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(consts.PodTunnelReadyReasonGatewayNotFound))
+		})
+
+		It("should set condition to false and skip configuring peer when gateway is being deleted", func() {
+			gwConfig.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+			gwConfig.Finalizers = []string{consts.SGCFinalizerName}
+			getTestReconciler(podEndpoint, gwConfig, getTestPod())
+			_, reconcileErr = r.Reconcile(context.TODO(), req)
+			Expect(reconcileErr).To(BeNil())
+			condition := getPodTunnelReadyCondition(r.Client)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(consts.PodTunnelReadyReasonGatewayDeleting))
+		})
+
+		It("should not update pod without the readiness gate", func() {
+			pod := getTestPod()
+			pod.Spec.ReadinessGates = nil
+			getTestReconciler(podEndpoint, pod)
+			_, reconcileErr = r.Reconcile(context.TODO(), req)
+			Expect(apierrors.IsNotFound(reconcileErr)).To(BeTrue())
+			Expect(getPodTunnelReadyCondition(r.Client)).To(BeNil())
+		})
+
+		It("should enqueue pod endpoints using the gateway", func() {
+			other := getTestPodEndpoint()
+			other.Name = "other"
+			other.Spec.StaticGatewayConfiguration = "other"
+			getTestReconciler(podEndpoint, other)
+			Expect(r.mapGatewayToPodEndpoints(context.TODO(), gwConfig)).To(Equal([]reconcile.Request{req}))
+		})
+
+		It("should enqueue pod endpoints in other namespaces referencing the gateway", func() {
+			gwConfig.Namespace = "egress-system"
+			podEndpoint.Spec.StaticGatewayConfiguration = "egress-system/" + testName
+			other := getTestPodEndpoint()
+			other.Name = "other"
+			getTestReconciler(podEndpoint, other)
+			Expect(r.mapGatewayToPodEndpoints(context.TODO(), gwConfig)).To(Equal([]reconcile.Request{req}))
+		})
+
+		It("should set condition to false and skip configuring peer when namespace is not allowed to use the gateway", func() {
+			gwConfig.Namespace = "egress-system"
+			podEndpoint.Spec.StaticGatewayConfiguration = "egress-system/" + testName
+			getTestReconciler(podEndpoint, gwConfig, getTestPod())
+			_, reconcileErr = r.Reconcile(context.TODO(), req)
+			Expect(reconcileErr).To(BeNil())
+			condition := getPodTunnelReadyCondition(r.Client)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(consts.PodTunnelReadyReasonNamespaceNotAllowed))
+		})
+
+		It("should configure peer when namespace is allowed to use the gateway", func() {
+			gwConfig.Namespace = "egress-system"
+			gwConfig.Spec.AllowedNamespaces = []string{testNamespace}
+			podEndpoint.Spec.StaticGatewayConfiguration = "egress-system/" + testName
+			getTestReconciler(podEndpoint, gwConfig)
+			mns := r.NetNS.(*mocknetnswrapper.MockInterface)
+			mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(nil, fmt.Errorf("failed"))
+			_, reconcileErr = r.Reconcile(context.TODO(), req)
+			Expect(reconcileErr).To(MatchError(ContainSubstring("failed to get gateway network namespace")))
+		})
+	})
+
+	Context("Test peer failure status", func() {
+		const otherNode = "other-node"
+		BeforeEach(func() {
+			req = reconcile.Request{NamespacedName: types.NamespacedName{Name: testName, Namespace: testNamespace}}
+			podEndpoint = getTestPodEndpoint()
+			gwConfig = getTestGwConfig()
+			nodeMeta = &imds.InstanceMetadata{
+				Compute: &imds.ComputeMetadata{
+					VMScaleSetName:    vmssName,
+					ResourceGroupName: vmssRG,
+				},
+			}
+			os.Setenv(consts.NodeNameEnvKey, testNodeName)
+		})
+
+		AfterEach(func() {
+			os.Setenv(consts.NodeNameEnvKey, "")
+		})
+
+		getTestStatusReconciler := func() {
+			getTestReconciler()
+			r.Client = fake.NewClientBuilder().WithScheme(scheme.Scheme).
+				WithObjects(podEndpoint, gwConfig).
+				WithStatusSubresource(&egressgatewayv1alpha1.PodEndpoint{}).
+				Build()
+		}
+
+		getStatus := func() egressgatewayv1alpha1.PodEndpointStatus {
+			got := &egressgatewayv1alpha1.PodEndpoint{}
+			Expect(r.Get(context.TODO(), req.NamespacedName, got)).To(Succeed())
+			return got.Status
+		}
+
+		failReconcile := func() {
+			mns := r.NetNS.(*mocknetnswrapper.MockInterface)
+			mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(nil, fmt.Errorf("device busy"))
+			_, reconcileErr = r.Reconcile(context.TODO(), req)
+			Expect(reconcileErr).To(HaveOccurred())
+		}
+
+		It("should count consecutive failures of this node", func() {
+			getTestStatusReconciler()
+			failReconcile()
+			failReconcile()
+			status := getStatus()
+			Expect(status.PeerFailures).To(HaveLen(1))
+			Expect(status.PeerFailures[testNodeName].Retries).To(Equal(int32(2)))
+			Expect(status.PeerFailures[testNodeName].LastError).To(ContainSubstring("device busy"))
+		})
+
+		It("should count failures of this node next to failures reported by another node", func() {
+			podEndpoint.Status = egressgatewayv1alpha1.PodEndpointStatus{PeerFailures: map[string]egressgatewayv1alpha1.PeerFailure{
+				otherNode: {Retries: 5, LastError: "failed"},
+			}}
+			getTestStatusReconciler()
+			failReconcile()
+			Expect(getStatus().PeerFailures).To(Equal(map[string]egressgatewayv1alpha1.PeerFailure{
+				otherNode:    {Retries: 5, LastError: "failed"},
+				testNodeName: {Retries: 1, LastError: "failed to get gateway network namespace ns-static-egress-gateway: device busy"},
+			}))
+		})
+
+		It("should remove failures of this node once the peer is configured", func() {
+			podEndpoint.Status = egressgatewayv1alpha1.PodEndpointStatus{PeerFailures: map[string]egressgatewayv1alpha1.PeerFailure{
+				testNodeName: {Retries: 3, LastError: "failed"},
+			}}
+			getTestStatusReconciler()
+			r.updatePeerFailure(context.TODO(), podEndpoint, nil)
+			Expect(getStatus()).To(Equal(egressgatewayv1alpha1.PodEndpointStatus{}))
+		})
+
+		It("should keep failures reported by another node when the peer is configured", func() {
+			podEndpoint.Status = egressgatewayv1alpha1.PodEndpointStatus{PeerFailures: map[string]egressgatewayv1alpha1.PeerFailure{
+				otherNode:    {Retries: 3, LastError: "failed"},
+				testNodeName: {Retries: 1, LastError: "failed"},
+			}}
+			getTestStatusReconciler()
+			// another node reports its failure after this node read the PodEndpoint
+			stale := podEndpoint.DeepCopy()
+			delete(stale.Status.PeerFailures, otherNode)
+			r.updatePeerFailure(context.TODO(), stale, nil)
+			Expect(getStatus().PeerFailures).To(Equal(map[string]egressgatewayv1alpha1.PeerFailure{otherNode: {Retries: 3, LastError: "failed"}}))
+		})
+	})
+
+	Context("Test pod egress rate limit", func() {
+		var (
+			mnl  *mocknetlinkwrapper.MockInterface
+			wg0  *netlink.Wireguard
+			rate uint32
+		)
+
+		BeforeEach(func() {
+			getTestReconciler()
+			mnl = r.Netlink.(*mocknetlinkwrapper.MockInterface)
+			wg0 = &netlink.Wireguard{LinkAttrs: netlink.LinkAttrs{Index: 5}}
+			podEndpoint = getTestPodEndpoint()
+			podEndpoint.Spec.EgressRateLimitMbps = 100
+			gwConfig = getTestGwConfig()
+			rate = 100 * 125000
+		})
+
+		getPodFilter := func(ip string, rate uint32) *netlink.U32 {
+			police := netlink.NewPoliceAction()
+			police.Rate = rate
+			police.Burst = rate / 10
+			police.ExceedAction = netlink.TC_POLICE_SHOT
+			return &netlink.U32{
+				FilterAttrs: netlink.FilterAttrs{LinkIndex: 5, Parent: netlink.HANDLE_INGRESS, Priority: 1, Protocol: unix.ETH_P_IP},
+				Sel: &netlink.TcU32Sel{
+					Flags: nl.TC_U32_TERMINAL,
+					Keys:  []netlink.TcU32Key{{Mask: 0xffffffff, Val: binary.BigEndian.Uint32(net.ParseIP(ip).To4()), Off: 12}},
+				},
+				Actions: []netlink.Action{police},
+			}
+		}
+
+		It("should not install tc rules when rate limit is not set", func() {
+			podEndpoint.Spec.EgressRateLimitMbps = 0
+			gomock.InOrder(
+				mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+				mnl.EXPECT().QdiscList(wg0).Return(nil, nil),
+			)
+			Expect(r.ensurePodRateLimit(gwConfig, podEndpoint)).To(Succeed())
+		})
+
+		It("should delete filter of the pod when rate limit is cleared", func() {
+			podEndpoint.Spec.EgressRateLimitMbps = 0
+			cleared := getPodFilter("10.0.0.25", rate)
+			gomock.InOrder(
+				mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+				mnl.EXPECT().QdiscList(wg0).Return([]netlink.Qdisc{&netlink.Ingress{}}, nil),
+				mnl.EXPECT().FilterList(wg0, uint32(netlink.HANDLE_INGRESS)).Return([]netlink.Filter{getPodFilter("10.0.0.24", rate), cleared}, nil),
+				mnl.EXPECT().FilterDel(cleared).Return(nil),
+			)
+			Expect(r.ensurePodRateLimit(gwConfig, podEndpoint)).To(Succeed())
+		})
+
+		It("should police ipv6 traffic of dual-stack pod", func() {
+			podEndpoint.Spec.PodIpv6Address = "fd00::25/128"
+			ipv6Filter := getPodFilter("10.0.0.25", rate)
+			ipv6Filter.Priority = 2
+			ipv6Filter.Protocol = unix.ETH_P_IPV6
+			ipv6Filter.Sel.Keys = []netlink.TcU32Key{
+				{Mask: 0xffffffff, Val: 0xfd000000, Off: 8},
+				{Mask: 0xffffffff, Val: 0, Off: 12},
+				{Mask: 0xffffffff, Val: 0, Off: 16},
+				{Mask: 0xffffffff, Val: 0x25, Off: 20},
+			}
+			gomock.InOrder(
+				mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+				mnl.EXPECT().QdiscList(wg0).Return([]netlink.Qdisc{&netlink.Ingress{}}, nil),
+				mnl.EXPECT().FilterList(wg0, uint32(netlink.HANDLE_INGRESS)).Return([]netlink.Filter{getPodFilter("10.0.0.25", rate)}, nil),
+				mnl.EXPECT().FilterAdd(ipv6Filter).Return(nil),
+			)
+			Expect(r.ensurePodRateLimit(gwConfig, podEndpoint)).To(Succeed())
+
+			// ipv6 filter is removed with the pod
+			gomock.InOrder(
+				mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+				mnl.EXPECT().QdiscList(wg0).Return([]netlink.Qdisc{&netlink.Ingress{}}, nil),
+				mnl.EXPECT().FilterList(wg0, uint32(netlink.HANDLE_INGRESS)).Return([]netlink.Filter{getPodFilter("10.0.0.25", rate), ipv6Filter}, nil),
+				mnl.EXPECT().FilterDel(ipv6Filter).Return(nil),
+			)
+			Expect(r.deletePodRateLimits("wg-6000", map[string]bool{"fd00::25": true})).To(Succeed())
+		})
+
+		It("should add ingress qdisc and police filter for the pod", func() {
+			gomock.InOrder(
+				mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+				mnl.EXPECT().QdiscList(wg0).Return(nil, nil),
+				mnl.EXPECT().QdiscAdd(&netlink.Ingress{QdiscAttrs: netlink.QdiscAttrs{
+					LinkIndex: 5,
+					Handle:    netlink.MakeHandle(0xffff, 0),
+					Parent:    netlink.HANDLE_INGRESS,
+				}}).Return(nil),
+				mnl.EXPECT().FilterList(wg0, uint32(netlink.HANDLE_INGRESS)).Return(nil, nil),
+				mnl.EXPECT().FilterAdd(getPodFilter("10.0.0.25", rate)).Return(nil),
+			)
+			Expect(r.ensurePodRateLimit(gwConfig, podEndpoint)).To(Succeed())
+		})
+
+		It("should use burst size from pod endpoint", func() {
+			podEndpoint.Spec.EgressBurstKB = 64
+			filter := getPodFilter("10.0.0.25", rate)
+			filter.Actions[0].(*netlink.PoliceAction).Burst = 64 * 1024
+			gomock.InOrder(
+				mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+				mnl.EXPECT().QdiscList(wg0).Return([]netlink.Qdisc{&netlink.Ingress{}}, nil),
+				mnl.EXPECT().FilterList(wg0, uint32(netlink.HANDLE_INGRESS)).Return(nil, nil),
+				mnl.EXPECT().FilterAdd(filter).Return(nil),
+			)
+			Expect(r.ensurePodRateLimit(gwConfig, podEndpoint)).To(Succeed())
+		})
+
+		It("should not change anything when filter is up to date", func() {
+			gomock.InOrder(
+				mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+				mnl.EXPECT().QdiscList(wg0).Return([]netlink.Qdisc{&netlink.Ingress{}}, nil),
+				mnl.EXPECT().FilterList(wg0, uint32(netlink.HANDLE_INGRESS)).Return([]netlink.Filter{getPodFilter("10.0.0.24", rate), getPodFilter("10.0.0.25", rate)}, nil),
+			)
+			Expect(r.ensurePodRateLimit(gwConfig, podEndpoint)).To(Succeed())
+		})
+
+		It("should replace outdated filter", func() {
+			outdated := getPodFilter("10.0.0.25", 2*rate)
+			gomock.InOrder(
+				mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+				mnl.EXPECT().QdiscList(wg0).Return([]netlink.Qdisc{&netlink.Ingress{}}, nil),
+				mnl.EXPECT().FilterList(wg0, uint32(netlink.HANDLE_INGRESS)).Return([]netlink.Filter{outdated}, nil),
+				mnl.EXPECT().FilterDel(outdated).Return(nil),
+				mnl.EXPECT().FilterAdd(getPodFilter("10.0.0.25", rate)).Return(nil),
+			)
+			Expect(r.ensurePodRateLimit(gwConfig, podEndpoint)).To(Succeed())
+		})
+
+		It("should report error when failed to add filter", func() {
+			gomock.InOrder(
+				mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+				mnl.EXPECT().QdiscList(wg0).Return([]netlink.Qdisc{&netlink.Ingress{}}, nil),
+				mnl.EXPECT().FilterList(wg0, uint32(netlink.HANDLE_INGRESS)).Return(nil, nil),
+				mnl.EXPECT().FilterAdd(gomock.Any()).Return(fmt.Errorf("failed")),
+			)
+			err := r.ensurePodRateLimit(gwConfig, podEndpoint)
+			Expect(errors.Unwrap(err)).To(Equal(fmt.Errorf("failed")))
+		})
+
+		It("should delete filters of deleted pods", func() {
+			deleted := getPodFilter("10.0.0.25", rate)
+			gomock.InOrder(
+				mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+				mnl.EXPECT().QdiscList(wg0).Return([]netlink.Qdisc{&netlink.Ingress{}}, nil),
+				mnl.EXPECT().FilterList(wg0, uint32(netlink.HANDLE_INGRESS)).Return([]netlink.Filter{getPodFilter("10.0.0.24", rate), deleted}, nil),
+				mnl.EXPECT().FilterDel(deleted).Return(nil),
+			)
+			Expect(r.deletePodRateLimits("wg-6000", map[string]bool{"10.0.0.25": true})).To(Succeed())
+		})
+
+		It("should not list filters when ingress qdisc does not exist", func() {
+			gomock.InOrder(
+				mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+				mnl.EXPECT().QdiscList(wg0).Return(nil, nil),
+			)
+			Expect(r.deletePodRateLimits("wg-6000", map[string]bool{"10.0.0.25": true})).To(Succeed())
+		})
+
+		It("should serialize tc changes of concurrent pod adds", func() {
+			const concurrency = 10
+			assertLocked := func() {
+				defer GinkgoRecover()
+				Expect(r.tcLock.TryLock()).To(BeFalse(), "tc change is made without holding tcLock")
+			}
+			mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil).Times(concurrency)
+			mnl.EXPECT().QdiscList(wg0).DoAndReturn(func(netlink.Link) ([]netlink.Qdisc, error) {
+				assertLocked()
+				return []netlink.Qdisc{&netlink.Ingress{}}, nil
+			}).Times(concurrency)
+			mnl.EXPECT().FilterList(wg0, uint32(netlink.HANDLE_INGRESS)).DoAndReturn(func(netlink.Link, uint32) ([]netlink.Filter, error) {
+				assertLocked()
+				return nil, nil
+			}).Times(concurrency)
+			mnl.EXPECT().FilterAdd(gomock.Any()).DoAndReturn(func(netlink.Filter) error {
+				assertLocked()
+				return nil
+			}).Times(concurrency)
+
+			var wg sync.WaitGroup
+			for i := 0; i < concurrency; i++ {
+				pe := podEndpoint.DeepCopy()
+				pe.Spec.PodIpAddress = fmt.Sprintf("10.0.1.%d/32", i)
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					Expect(r.ensurePodRateLimit(gwConfig, pe)).To(Succeed())
+				}()
+			}
+			wg.Wait()
+		})
+	})
+
+	Context("Test resync on start", func() {
+		var (
+			podEndpoints []runtime.Object
+			podKeys      []string
+			backoff      wait.Backoff
+		)
+
+		BeforeEach(func() {
+			backoff = resyncBackoff
+			resyncBackoff = wait.Backoff{Duration: time.Millisecond, Steps: 3}
+			nodeMeta = &imds.InstanceMetadata{
+				Compute: &imds.ComputeMetadata{
+					VMScaleSetName:    vmssName,
+					ResourceGroupName: vmssRG,
+				},
+			}
+			os.Setenv(consts.PodNamespaceEnvKey, testPodNamespace)
+			os.Setenv(consts.NodeNameEnvKey, testNodeName)
+
+			podEndpoints, podKeys = nil, nil
+			for i := 0; i < 3; i++ {
+				privateKey, err := wgtypes.GeneratePrivateKey()
+				Expect(err).NotTo(HaveOccurred())
+				podEndpoint := getTestPodEndpoint()
+				podEndpoint.Name = fmt.Sprintf("pod%d", i)
+				podEndpoint.Spec.PodIpAddress = fmt.Sprintf("10.0.0.%d/32", 30+i)
+				podEndpoint.Spec.PodPublicKey = privateKey.PublicKey().String()
+				podEndpoints = append(podEndpoints, podEndpoint)
+				podKeys = append(podKeys, podEndpoint.Spec.PodPublicKey)
+			}
+			// PodEndpoint of a gateway not on this node is not applied
+			otherPodEndpoint := getTestPodEndpoint()
+			otherPodEndpoint.Name = "other"
+			otherPodEndpoint.Spec.StaticGatewayConfiguration = "other"
+			podEndpoints = append(podEndpoints, otherPodEndpoint)
+		})
+
+		AfterEach(func() {
+			resyncBackoff = backoff
+			os.Setenv(consts.PodNamespaceEnvKey, "")
+			os.Setenv(consts.NodeNameEnvKey, "")
+		})
+
+		expectPeers := func(configureDevice func(wgtypes.Config) error) {
+			mns := r.NetNS.(*mocknetnswrapper.MockInterface)
+			mwg := r.WgCtrl.(*mockwgctrlwrapper.MockInterface)
+			mnl := r.Netlink.(*mocknetlinkwrapper.MockInterface)
+			gwns := &mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}
+			mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(gwns, nil).AnyTimes()
+			mwg.EXPECT().New().Return(mclient, nil).AnyTimes()
+			mclient.EXPECT().Close().Return(nil).AnyTimes()
+			mclient.EXPECT().ConfigureDevice("wg-6000", gomock.Any()).DoAndReturn(func(_ string, config wgtypes.Config) error {
+				return configureDevice(config)
+			}).AnyTimes()
+			mnl.EXPECT().LinkByName("wg-6000").Return(&netlink.Wireguard{}, nil).AnyTimes()
+			mnl.EXPECT().RouteReplace(gomock.Any()).Return(nil).AnyTimes()
+			mnl.EXPECT().QdiscList(gomock.Any()).Return(nil, nil).AnyTimes()
+		}
+
+		getReadyPeerKeys := func() []string {
+			gwStatus := &egressgatewayv1alpha1.GatewayStatus{}
+			Expect(getGatewayStatus(r.Client, gwStatus)).To(Succeed())
+			var keys []string
+			for _, peer := range gwStatus.Spec.ReadyPeerConfigurations {
+				keys = append(keys, peer.PublicKey)
+			}
+			return keys
+		}
+
+		It("should apply peers of all PodEndpoints once without duplicates", func() {
+			// gateway status survives node restart while wireguard link is recreated without peers
+			gwStatus := &egressgatewayv1alpha1.GatewayStatus{
+				ObjectMeta: metav1.ObjectMeta{Name: testNodeName, Namespace: testPodNamespace},
+				Spec: egressgatewayv1alpha1.GatewayStatusSpec{
+					ReadyPeerConfigurations: []egressgatewayv1alpha1.PeerConfiguration{
+						{PodEndpoint: testNamespace + "/pod0", InterfaceName: "wg-6000", PublicKey: podKeys[0]},
+					},
+				},
+			}
+			getTestReconciler(append(podEndpoints, getTestGwConfig(), node, gwStatus)...)
+			configured := make(map[string]int)
+			expectPeers(func(config wgtypes.Config) error {
+				Expect(config.Peers).To(HaveLen(1))
+				configured[config.Peers[0].PublicKey.String()]++
+				return nil
+			})
+
+			Expect(r.Resync(context.TODO())).To(Succeed())
+			Expect(configured).To(HaveLen(3))
+			for _, key := range podKeys {
+				Expect(configured[key]).To(Equal(1))
+			}
+			Expect(getReadyPeerKeys()).To(ConsistOf(podKeys))
+		})
+
+		It("should retry PodEndpoints failed to apply", func() {
+			getTestReconciler(append(podEndpoints, getTestGwConfig(), node)...)
+			configured := make(map[string]int)
+			failed := false
+			expectPeers(func(config wgtypes.Config) error {
+				key := config.Peers[0].PublicKey.String()
+				if key == podKeys[1] && !failed {
+					// wireguard link is not recreated yet
+					failed = true
+					return fmt.Errorf("failed")
+				}
+				configured[key]++
+				return nil
+			})
+
+			Expect(r.Resync(context.TODO())).To(Succeed())
+			Expect(failed).To(BeTrue())
+			for _, key := range podKeys {
+				Expect(configured[key]).To(Equal(1))
+			}
+			Expect(getReadyPeerKeys()).To(ConsistOf(podKeys))
 		})
 	})
 
@@ -412,6 +1159,7 @@ var _ = Describe("Daemon PodEndpoint controller unit tests", func() {
 			mns := r.NetNS.(*mocknetnswrapper.MockInterface)
 			mwg := r.WgCtrl.(*mockwgctrlwrapper.MockInterface)
 			mnl := r.Netlink.(*mocknetlinkwrapper.MockInterface)
+			mct := r.Conntrack.(*mockconntrackwrapper.MockInterface)
 			wg0 := &netlink.Wireguard{}
 			gwns := &mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}
 			pk, _ := wgtypes.ParseKey(pubK)
@@ -441,9 +1189,13 @@ var _ = Describe("Daemon PodEndpoint controller unit tests", func() {
 				mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
 				mnl.EXPECT().RouteList(wg0, netlink.FAMILY_ALL).Return([]netlink.Route{{Dst: getIPNet("10.0.0.1/32")}}, nil),
 				mnl.EXPECT().RouteDel(&netlink.Route{Dst: getIPNet("10.0.0.1/32")}).Return(nil),
+				mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+				mnl.EXPECT().QdiscList(wg0).Return(nil, nil),
 				mclient.EXPECT().ConfigureDevice("wg-6000", config).Return(nil),
 				mclient.EXPECT().Close().Return(nil),
 			)
+			mct.EXPECT().ConntrackDeleteFilter(netlink.ConntrackTableType(netlink.ConntrackTable), netlink.InetFamily(netlink.FAMILY_V4), getPodConntrackFilter("10.0.0.1")).Return(uint(3), nil)
+			mct.EXPECT().ConntrackDeleteFilter(netlink.ConntrackTableType(netlink.ConntrackTable), netlink.InetFamily(netlink.FAMILY_V4), getPodConntrackFilter("10.0.0.2")).Return(uint(0), nil)
 			_, reconcileErr = r.Reconcile(context.TODO(), req)
 			Expect(reconcileErr).To(BeNil())
 			err := getGatewayStatus(r.Client, gwStatus)
@@ -451,6 +1203,50 @@ var _ = Describe("Daemon PodEndpoint controller unit tests", func() {
 			Expect(gwStatus.Spec.ReadyPeerConfigurations).To(BeEmpty())
 		})
 
+		It("should flush conntrack entries of ipv6 pod ip and not fail when flushing fails", func() {
+			gwConfig = getTestGwConfig()
+			getTestReconciler(gwConfig)
+			mns := r.NetNS.(*mocknetnswrapper.MockInterface)
+			mwg := r.WgCtrl.(*mockwgctrlwrapper.MockInterface)
+			mnl := r.Netlink.(*mocknetlinkwrapper.MockInterface)
+			mct := r.Conntrack.(*mockconntrackwrapper.MockInterface)
+			wg0 := &netlink.Wireguard{}
+			gwns := &mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}
+			pk, _ := wgtypes.ParseKey(pubK)
+			device := &wgtypes.Device{
+				Peers: []wgtypes.Peer{
+					{
+						PublicKey: pk,
+						AllowedIPs: []net.IPNet{
+							*getIPNet("fd00::1/128"),
+						},
+					},
+				},
+			}
+			config := wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{
+					{
+						PublicKey: pk,
+						Remove:    true,
+					},
+				},
+			}
+			gomock.InOrder(
+				mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(gwns, nil),
+				mwg.EXPECT().New().Return(mclient, nil),
+				mclient.EXPECT().Device("wg-6000").Return(device, nil),
+				mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+				mnl.EXPECT().RouteList(wg0, netlink.FAMILY_ALL).Return(nil, nil),
+				mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+				mnl.EXPECT().QdiscList(wg0).Return(nil, nil),
+				mclient.EXPECT().ConfigureDevice("wg-6000", config).Return(nil),
+				mct.EXPECT().ConntrackDeleteFilter(netlink.ConntrackTableType(netlink.ConntrackTable), netlink.InetFamily(netlink.FAMILY_V6), getPodConntrackFilter("fd00::1")).Return(uint(0), fmt.Errorf("failed")),
+				mclient.EXPECT().Close().Return(nil),
+			)
+			_, reconcileErr = r.Reconcile(context.TODO(), req)
+			Expect(reconcileErr).To(BeNil())
+		})
+
 		It("should not clean existing peer and route", func() {
 			podEndpoint = getTestPodEndpoint()
 			podEndpoint.Name = testName + "a"
@@ -480,6 +1276,37 @@ var _ = Describe("Daemon PodEndpoint controller unit tests", func() {
 			Expect(reconcileErr).To(BeNil())
 		})
 
+		It("should not clean peer of pod in other namespace allowed to use the gateway", func() {
+			podEndpoint = getTestPodEndpoint()
+			podEndpoint.Namespace = "app"
+			podEndpoint.Spec.StaticGatewayConfiguration = testNamespace + "/" + testName
+			gwConfig = getTestGwConfig()
+			gwConfig.Spec.AllowedNamespaces = []string{"app"}
+			getTestReconciler(podEndpoint, gwConfig)
+			mns := r.NetNS.(*mocknetnswrapper.MockInterface)
+			mwg := r.WgCtrl.(*mockwgctrlwrapper.MockInterface)
+			gwns := &mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}
+			pk, _ := wgtypes.ParseKey(pubK)
+			device := &wgtypes.Device{
+				Peers: []wgtypes.Peer{
+					{
+						PublicKey: pk,
+						AllowedIPs: []net.IPNet{
+							*getIPNet("10.0.0.1/32"),
+						},
+					},
+				},
+			}
+			gomock.InOrder(
+				mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(gwns, nil),
+				mwg.EXPECT().New().Return(mclient, nil),
+				mclient.EXPECT().Device("wg-6000").Return(device, nil),
+				mclient.EXPECT().Close().Return(nil),
+			)
+			_, reconcileErr = r.Reconcile(context.TODO(), req)
+			Expect(reconcileErr).To(BeNil())
+		})
+
 		It("should handle multiple gateway namespaces properly", func() {
 			objects := []runtime.Object{
 				getTestGwConfig(),
@@ -546,10 +1373,12 @@ var _ = Describe("Daemon PodEndpoint controller unit tests", func() {
 			mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(gwns, nil)
 			mwg.EXPECT().New().Return(mclient, nil)
 			mclient.EXPECT().Device("wg-6000").Return(device, nil)
-			mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil)
+			mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil).Times(2)
 			mnl.EXPECT().RouteList(wg0, netlink.FAMILY_ALL).Return([]netlink.Route{{Dst: getIPNet("10.0.0.1/32")}, {Dst: getIPNet("10.0.0.2/32")}}, nil)
+			mnl.EXPECT().QdiscList(wg0).Return(nil, nil)
 			mnl.EXPECT().RouteDel(&netlink.Route{Dst: getIPNet("10.0.0.2/32")}).Return(nil)
 			mclient.EXPECT().ConfigureDevice("wg-6000", config).Return(nil)
+			r.Conntrack.(*mockconntrackwrapper.MockInterface).EXPECT().ConntrackDeleteFilter(netlink.ConntrackTableType(netlink.ConntrackTable), netlink.InetFamily(netlink.FAMILY_V4), getPodConntrackFilter("10.0.0.2")).Return(uint(1), nil)
 			mclient.EXPECT().Close().Return(nil)
 			// 2nd gateway namespace, return error, should not block
 			mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(nil, fmt.Errorf("failed"))
@@ -559,6 +1388,35 @@ var _ = Describe("Daemon PodEndpoint controller unit tests", func() {
 	})
 })
 
+func getPodConntrackFilter(podIP string) *netlink.ConntrackFilter {
+	filter := &netlink.ConntrackFilter{}
+	Expect(filter.AddIP(netlink.ConntrackOrigSrcIP, net.ParseIP(podIP))).To(Succeed())
+	return filter
+}
+
+func getTestPod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testName,
+			Namespace: testNamespace,
+		},
+		Spec: corev1.PodSpec{
+			ReadinessGates: []corev1.PodReadinessGate{{ConditionType: consts.PodTunnelReadyConditionType}},
+		},
+	}
+}
+
+func getPodTunnelReadyCondition(cl client.Client) *corev1.PodCondition {
+	pod := &corev1.Pod{}
+	Expect(cl.Get(context.TODO(), types.NamespacedName{Name: testName, Namespace: testNamespace}, pod)).To(Succeed())
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == consts.PodTunnelReadyConditionType {
+			return &pod.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
 func getGatewayStatus(cl client.Client, gwStatus *egressgatewayv1alpha1.GatewayStatus) error {
 	key := types.NamespacedName{
 		Name:      testNodeName,
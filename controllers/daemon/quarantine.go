@@ -0,0 +1,101 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"context"
+	"os"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/healthprobe"
+)
+
+// defaultQuarantineCheckInterval is how often peer migration and the quarantined flag in GatewayStatus are
+// re-checked while this node is quarantined
+const defaultQuarantineCheckInterval = 30 * time.Second
+
+// GatewayQuarantineReconciler quarantines this gateway node while it has the quarantine annotation. A quarantined
+// node fails the lb health probe, so that the lb moves new traffic as well as existing wireguard flows, which are
+// udp, to other gateway nodes already configured with the same peers. The node stays in the VMSS and keeps its
+// gateway configurations, removing the annotation brings it back into rotation.
+type GatewayQuarantineReconciler struct {
+	client.Client
+	LBProbeServer *healthprobe.LBProbeServer
+	CheckInterval time.Duration
+}
+
+//+kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
+//+kubebuilder:rbac:groups=egressgateway.kubernetes.azure.com,resources=gatewaystatuses,verbs=get;list;watch;update
+
+// Reconcile applies the quarantine annotation of this node.
+func (r *GatewayQuarantineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	node := &corev1.Node{}
+	if err := r.Get(ctx, req.NamespacedName, node); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	reason, quarantined := node.Annotations[consts.GatewayNodeQuarantineAnnotationKey]
+	r.LBProbeServer.SetQuarantined(quarantined)
+	if err := r.setQuarantined(ctx, quarantined); err != nil {
+		log.Error(err, "failed to update gateway quarantine status")
+		return ctrl.Result{}, err
+	}
+	if !quarantined {
+		return ctrl.Result{}, nil
+	}
+
+	pending, err := getUnmigratedGateways(ctx, r.Client)
+	if err != nil {
+		log.Error(err, "failed to check peer migration")
+	} else if len(pending) == 0 {
+		log.Info("Gateway node is quarantined, all peers are served by other gateway nodes", "reason", reason)
+	} else {
+		for gateway, pendingReason := range pending {
+			log.Info("Gateway node is quarantined, waiting for gateway peers to be migrated", "reason", reason, "gateway", gateway, "pendingReason", pendingReason)
+		}
+	}
+
+	interval := r.CheckInterval
+	if interval <= 0 {
+		interval = defaultQuarantineCheckInterval
+	}
+	// GatewayStatus may be (re)created without the flag, e.g. when the first gateway is configured on this node
+	return ctrl.Result{RequeueAfter: interval}, nil
+}
+
+// setQuarantined updates quarantined flag in GatewayStatus of this node
+func (r *GatewayQuarantineReconciler) setQuarantined(ctx context.Context, quarantined bool) error {
+	gwStatus := &egressgatewayv1alpha1.GatewayStatus{}
+	if err := r.Get(ctx, getGatewayStatusKey(), gwStatus); err != nil {
+		// node without gateway status does not serve any gateway yet
+		return client.IgnoreNotFound(err)
+	}
+	if gwStatus.Spec.Quarantined == quarantined {
+		return nil
+	}
+	log.FromContext(ctx).Info("Updating gateway quarantine status", "quarantined", quarantined)
+	gwStatus.Spec.Quarantined = quarantined
+	return r.Update(ctx, gwStatus)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *GatewayQuarantineReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	nodeName := os.Getenv(consts.NodeNameEnvKey)
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("gatewayquarantine").
+		For(&corev1.Node{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(o client.Object) bool {
+			return o.GetName() == nodeName
+		}), predicate.AnnotationChangedPredicate{})).
+		Complete(r)
+}
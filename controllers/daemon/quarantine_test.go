@@ -0,0 +1,103 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"context"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/healthprobe"
+)
+
+var _ = Describe("Daemon gateway quarantine reconciler unit tests", func() {
+	var (
+		r   *GatewayQuarantineReconciler
+		req = ctrl.Request{NamespacedName: types.NamespacedName{Name: testNodeName}}
+	)
+
+	getTestReconciler := func(objects ...runtime.Object) {
+		cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(objects...).Build()
+		r = &GatewayQuarantineReconciler{
+			Client:        cl,
+			LBProbeServer: healthprobe.NewLBProbeServer(1000),
+			CheckInterval: time.Minute,
+		}
+	}
+
+	getTestNode := func(reason *string) *corev1.Node {
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: testNodeName}}
+		if reason != nil {
+			node.Annotations = map[string]string{consts.GatewayNodeQuarantineAnnotationKey: *reason}
+		}
+		return node
+	}
+
+	getTestGatewayStatus := func(quarantined bool) *egressgatewayv1alpha1.GatewayStatus {
+		return &egressgatewayv1alpha1.GatewayStatus{
+			ObjectMeta: metav1.ObjectMeta{Name: testNodeName, Namespace: testPodNamespace},
+			Spec:       egressgatewayv1alpha1.GatewayStatusSpec{Quarantined: quarantined},
+		}
+	}
+
+	isQuarantined := func() bool {
+		gwStatus := &egressgatewayv1alpha1.GatewayStatus{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testNodeName, Namespace: testPodNamespace}, gwStatus)).To(Succeed())
+		return gwStatus.Spec.Quarantined
+	}
+
+	BeforeEach(func() {
+		os.Setenv(consts.PodNamespaceEnvKey, testPodNamespace)
+		os.Setenv(consts.NodeNameEnvKey, testNodeName)
+	})
+
+	AfterEach(func() {
+		os.Setenv(consts.PodNamespaceEnvKey, "")
+		os.Setenv(consts.NodeNameEnvKey, "")
+	})
+
+	It("should set quarantined flag and requeue when node is annotated", func() {
+		reason := "packet loss"
+		getTestReconciler(getTestNode(&reason), getTestGatewayStatus(false))
+		res, err := r.Reconcile(context.TODO(), req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.RequeueAfter).To(Equal(time.Minute))
+		Expect(isQuarantined()).To(BeTrue())
+	})
+
+	It("should clear quarantined flag when annotation is removed", func() {
+		getTestReconciler(getTestNode(nil), getTestGatewayStatus(true))
+		res, err := r.Reconcile(context.TODO(), req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(ctrl.Result{}))
+		Expect(isQuarantined()).To(BeFalse())
+	})
+
+	It("should not fail when node has no gateway status", func() {
+		reason := ""
+		getTestReconciler(getTestNode(&reason))
+		res, err := r.Reconcile(context.TODO(), req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.RequeueAfter).To(Equal(time.Minute))
+	})
+
+	It("should ignore deleted node", func() {
+		getTestReconciler()
+		res, err := r.Reconcile(context.TODO(), req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(ctrl.Result{}))
+	})
+})
@@ -0,0 +1,70 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+)
+
+// ReattachGateways takes over wireguard links left in gateway network namespaces by a previous daemon instance on
+// daemon start. Gateways of the links, identified by link alias, report healthy in the lb health probe right away,
+// so that lb keeps sending tunneled traffic to this node while they are reconciled. Reconciles reuse existing links
+// and peers rather than recreating them, so handshakes of pods survive the restart. Links of gateways removed in
+// the meantime are left to the regular cleanup.
+func (r *StaticGatewayConfigurationReconciler) ReattachGateways(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("reattach")
+	nsNames, err := listGatewayNetns(r.NetNS, r.NetnsPerGateway)
+	if err != nil {
+		return err
+	}
+	for _, nsName := range nsNames {
+		links, err := r.listWireguardLinks(nsName)
+		if err != nil {
+			return err
+		}
+		for _, link := range links {
+			if link.Attrs().Alias == "" {
+				continue
+			}
+			log.Info("Reattaching existing wireguard link", "link", link.Attrs().Name, "netns", nsName, "gateway", link.Attrs().Alias)
+			if err := r.LBProbeServer.AddGateway(link.Attrs().Alias); err != nil {
+				return fmt.Errorf("failed to add gateway %s to lb probe server: %w", link.Attrs().Alias, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *StaticGatewayConfigurationReconciler) listWireguardLinks(nsName string) ([]netlink.Link, error) {
+	gwns, err := r.NetNS.GetNS(nsName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network namespace %s: %w", nsName, err)
+	}
+	defer gwns.Close()
+
+	var wgLinks []netlink.Link
+	if err := gwns.Do(func(nn ns.NetNS) error {
+		links, err := r.Netlink.LinkList()
+		if err != nil {
+			return fmt.Errorf("failed to list links in gateway namespace: %w", err)
+		}
+		for _, link := range links {
+			if strings.HasPrefix(link.Attrs().Name, consts.WiregaurdLinkNamePrefix) {
+				wgLinks = append(wgLinks, link)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return wgLinks, nil
+}
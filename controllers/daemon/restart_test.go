@@ -0,0 +1,164 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+	"go.uber.org/mock/gomock"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/healthprobe"
+	"github.com/Azure/kube-egress-gateway/pkg/imds"
+	fakeiptables "github.com/Azure/kube-egress-gateway/pkg/iptableswrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/netlinkwrapper/mocknetlinkwrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper/mocknetnswrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/wgctrlwrapper/mockwgctrlwrapper"
+)
+
+var _ = Describe("Daemon graceful restart unit tests", func() {
+	var (
+		mns     *mocknetnswrapper.MockInterface
+		mnl     *mocknetlinkwrapper.MockInterface
+		mwg     *mockwgctrlwrapper.MockInterface
+		mclient *mockwgctrlwrapper.MockClient
+		gwns    = &mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}
+		wgLink  = &netlink.Wireguard{LinkAttrs: netlink.LinkAttrs{Name: "wg-6000", Alias: testUID}}
+	)
+
+	BeforeEach(func() {
+		mctrl := gomock.NewController(GinkgoT())
+		mns = mocknetnswrapper.NewMockInterface(mctrl)
+		mnl = mocknetlinkwrapper.NewMockInterface(mctrl)
+		mwg = mockwgctrlwrapper.NewMockInterface(mctrl)
+		mclient = mockwgctrlwrapper.NewMockClient(mctrl)
+		nodeMeta = &imds.InstanceMetadata{
+			Compute: &imds.ComputeMetadata{
+				VMScaleSetName:    vmssName,
+				ResourceGroupName: vmssRG,
+			},
+		}
+		os.Setenv(consts.PodNamespaceEnvKey, testPodNamespace)
+		os.Setenv(consts.NodeNameEnvKey, testNodeName)
+	})
+
+	AfterEach(func() {
+		os.Setenv(consts.PodNamespaceEnvKey, "")
+		os.Setenv(consts.NodeNameEnvKey, "")
+	})
+
+	// newGatewayReconciler returns the gateway reconciler of a newly started daemon
+	newGatewayReconciler := func() *StaticGatewayConfigurationReconciler {
+		cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		return &StaticGatewayConfigurationReconciler{
+			Client:        cl,
+			LBProbeServer: healthprobe.NewLBProbeServer(1000),
+			Netlink:       mnl,
+			NetNS:         mns,
+			instanceMetadata: func() (*imds.InstanceMetadata, error) {
+				return nodeMeta, nil
+			},
+		}
+	}
+
+	It("should report gateways of existing wireguard links healthy on start", func() {
+		r := newGatewayReconciler()
+		mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(gwns, nil)
+		mnl.EXPECT().LinkList().Return([]netlink.Link{
+			wgLink,
+			&netlink.Wireguard{LinkAttrs: netlink.LinkAttrs{Name: "wg-6001"}},
+			&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "host0", Alias: "host"}},
+		}, nil)
+		Expect(r.ReattachGateways(context.TODO())).To(Succeed())
+		Expect(r.LBProbeServer.GetGateways()).To(Equal([]string{testUID}))
+	})
+
+	It("should not report any gateway on first start", func() {
+		r := newGatewayReconciler()
+		mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(gwns, nil)
+		mnl.EXPECT().LinkList().Return([]netlink.Link{}, nil)
+		Expect(r.ReattachGateways(context.TODO())).To(Succeed())
+		Expect(r.LBProbeServer.GetGateways()).To(BeEmpty())
+	})
+
+	It("should keep wireguard link and peers across daemon restart", func() {
+		gwConfig := &egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: testName, Namespace: testNamespace, UID: testUID},
+			Spec: egressgatewayv1alpha1.StaticGatewayConfigurationSpec{
+				GatewayVmssProfile: egressgatewayv1alpha1.GatewayVmssProfile{
+					VmssResourceGroup:  vmssRG,
+					VmssName:           vmssName,
+					PublicIpPrefixSize: 31,
+				},
+			},
+			Status: getTestGwConfigStatus(),
+		}
+		objects := []runtime.Object{gwConfig, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: testNodeName}}}
+		var peers []wgtypes.Peer
+		for i, key := range []string{pubK, pubK2} {
+			podIP := net.IPv4(10, 0, 0, byte(30+i))
+			objects = append(objects, &egressgatewayv1alpha1.PodEndpoint{
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("pod%d", i), Namespace: testNamespace},
+				Spec: egressgatewayv1alpha1.PodEndpointSpec{
+					StaticGatewayConfiguration: testName,
+					PodIpAddress:               podIP.String() + "/32",
+					PodPublicKey:               key,
+				},
+			})
+			publicKey, err := wgtypes.ParseKey(key)
+			Expect(err).NotTo(HaveOccurred())
+			peers = append(peers, wgtypes.Peer{PublicKey: publicKey, AllowedIPs: []net.IPNet{{IP: podIP, Mask: net.CIDRMask(32, 32)}}})
+		}
+
+		// wireguard link with peers is left by the previous daemon instance, and is neither recreated nor
+		// flushed: any LinkAdd or LinkDel call fails the test
+		mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(gwns, nil).AnyTimes()
+		mnl.EXPECT().LinkList().Return([]netlink.Link{wgLink}, nil)
+		mnl.EXPECT().LinkByName("wg-6000").Return(wgLink, nil).AnyTimes()
+		mnl.EXPECT().RouteReplace(gomock.Any()).Return(nil).AnyTimes()
+		mnl.EXPECT().QdiscList(gomock.Any()).Return(nil, nil).AnyTimes()
+		mwg.EXPECT().New().Return(mclient, nil).AnyTimes()
+		mclient.EXPECT().Close().Return(nil).AnyTimes()
+		mclient.EXPECT().Device("wg-6000").Return(&wgtypes.Device{Name: "wg-6000", Peers: peers}, nil).AnyTimes()
+		mclient.EXPECT().ConfigureDevice("wg-6000", gomock.Any()).DoAndReturn(func(_ string, config wgtypes.Config) error {
+			Expect(config.ReplacePeers).To(BeFalse())
+			for _, peer := range config.Peers {
+				Expect(peer.Remove).To(BeFalse())
+			}
+			return nil
+		}).AnyTimes()
+
+		gwReconciler := newGatewayReconciler()
+		Expect(gwReconciler.ReattachGateways(context.TODO())).To(Succeed())
+		Expect(gwReconciler.LBProbeServer.GetGateways()).To(Equal([]string{testUID}))
+
+		r := &PodEndpointReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(objects...).Build()}
+		r.Netlink = mnl
+		r.NetNS = mns
+		r.WgCtrl = mwg
+		r.IPTables = fakeiptables.NewFake()
+		Expect(r.Resync(context.TODO())).To(Succeed())
+		// peer cleanup of the new daemon instance keeps peers of existing PodEndpoints
+		_, err := r.Reconcile(context.TODO(), ctrl.Request{})
+		Expect(err).NotTo(HaveOccurred())
+
+		gwStatus := &egressgatewayv1alpha1.GatewayStatus{}
+		Expect(getGatewayStatus(r.Client, gwStatus)).To(Succeed())
+		Expect(gwStatus.Spec.ReadyPeerConfigurations).To(HaveLen(2))
+	})
+})
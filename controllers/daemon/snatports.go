@@ -0,0 +1,312 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utiliptables "k8s.io/kubernetes/pkg/util/iptables"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+)
+
+const (
+	// source ports assigned to pods, well-known ports are left out
+	snatPortMin = 1024
+	snatPortMax = 65535
+)
+
+// snatPortRange is a range of source ports a pod is sNATed to, both ends included
+type snatPortRange struct {
+	first, last int
+}
+
+func (p snatPortRange) String() string {
+	return fmt.Sprintf("%d-%d", p.first, p.last)
+}
+
+// ensureSNATPortRanges sNATs TCP and UDP connections of each pod of gwConfig to its own source port range of the
+// gateway private IP when snatPortRangeSize is set, and reports the assignment on PodEndpoint status. Pods left
+// without a range once all ranges are taken are sNATed as usual. The chain is removed when snatPortRangeSize is
+// unset or no pod uses the gateway any more. Only IPv4 pods are pinned, IPv6 traffic is sNATed as usual. Must be
+// called in gateway namespace.
+func (r *PodEndpointReconciler) ensureSNATPortRanges(ctx context.Context, gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) error {
+	log := log.FromContext(ctx)
+	linkName := getWireguardInterfaceName(gwConfig)
+	mark, err := getPacketMark(linkName)
+	if err != nil {
+		return err
+	}
+	chain := utiliptables.Chain(fmt.Sprintf("EGRESS-GATEWAY-SNATPORTS-%d", mark))
+	jumpRule := []string{"-m", "comment", "--comment", fmt.Sprintf("kube-egress-gateway pin sNAT ports of pods on gateway link %s", linkName), "-j", string(chain)}
+
+	podEndpointList := &egressgatewayv1alpha1.PodEndpointList{}
+	if err := r.List(ctx, podEndpointList); err != nil {
+		return fmt.Errorf("failed to list PodEndpoints: %w", err)
+	}
+	gwConfigKey := types.NamespacedName{Namespace: gwConfig.Namespace, Name: gwConfig.Name}
+	var podEndpoints []egressgatewayv1alpha1.PodEndpoint
+	for _, podEndpoint := range podEndpointList.Items {
+		if podEndpoint.DeletionTimestamp.IsZero() && podEndpoint.GetStaticGatewayConfigurationKey() == gwConfigKey &&
+			gwConfig.AllowsNamespace(podEndpoint.Namespace) {
+			podEndpoints = append(podEndpoints, podEndpoint)
+		}
+	}
+
+	var assigned map[types.NamespacedName]snatPortRange
+	var rules [][]string
+	if gwConfig.Spec.SnatPortRangeSize > 0 && len(podEndpoints) > 0 {
+		_, vmSecondaryIP, err := getVMIP(ctx, r, gwConfig)
+		if err != nil {
+			return err
+		}
+		assigned, err = assignSNATPortRanges(podEndpoints, int(gwConfig.Spec.SnatPortRangeSize))
+		if err != nil {
+			return err
+		}
+		if rules, err = getSNATPortRangeRules(mark, vmSecondaryIP, podEndpoints, assigned); err != nil {
+			return err
+		}
+	}
+
+	if len(rules) == 0 {
+		exists, err := r.IPTables.ChainExists(utiliptables.TableNAT, chain)
+		if err != nil {
+			return err
+		}
+		if exists {
+			log.Info("Releasing sNAT port ranges", "chain", chain)
+			if err := r.IPTables.DeleteRule(utiliptables.TableNAT, utiliptables.ChainPostrouting, jumpRule...); err != nil {
+				return fmt.Errorf("failed to delete jump rule to chain %s: %w", chain, err)
+			}
+			if err := r.IPTables.FlushChain(utiliptables.TableNAT, chain); err != nil {
+				return fmt.Errorf("failed to flush chain %s: %w", chain, err)
+			}
+			if err := r.IPTables.DeleteChain(utiliptables.TableNAT, chain); err != nil {
+				return err
+			}
+		}
+	} else {
+		if _, err := r.IPTables.EnsureChain(utiliptables.TableNAT, chain); err != nil {
+			return fmt.Errorf("failed to ensure chain %s: %w", chain, err)
+		}
+		// the jump rule must precede the round robin sNAT rules of the gateway, re-prepend it only when they were
+		// recreated before it, so that pods are never sNATed to other ports in between
+		precedes, err := r.isJumpBeforeSNAT(mark, chain)
+		if err != nil {
+			return err
+		}
+		if !precedes {
+			if err := r.IPTables.DeleteRule(utiliptables.TableNAT, utiliptables.ChainPostrouting, jumpRule...); err != nil {
+				return fmt.Errorf("failed to delete jump rule to chain %s: %w", chain, err)
+			}
+			if _, err := r.IPTables.EnsureRule(utiliptables.Prepend, utiliptables.TableNAT, utiliptables.ChainPostrouting, jumpRule...); err != nil {
+				return fmt.Errorf("failed to ensure jump rule to chain %s: %w", chain, err)
+			}
+		}
+		lines := bytes.NewBuffer(nil)
+		writeLine(lines, "*"+string(utiliptables.TableNAT))
+		writeLine(lines, utiliptables.MakeChainLine(chain))
+		for _, rule := range rules {
+			writeRule(lines, string(utiliptables.Append), chain, rule...)
+		}
+		writeLine(lines, "COMMIT")
+		log.Info("Restoring sNAT port range rules", "rules", lines.String())
+		if err := r.IPTables.RestoreAll(lines.Bytes(), utiliptables.NoFlushTables, utiliptables.NoRestoreCounters); err != nil {
+			return fmt.Errorf("failed to restore rules in chain %s: %w", chain, err)
+		}
+	}
+
+	if len(podEndpoints) == 0 {
+		return nil
+	}
+	vmConfig := &egressgatewayv1alpha1.GatewayVMConfiguration{}
+	if err := r.Get(ctx, gwConfigKey, vmConfig); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get GatewayVMConfiguration %s: %w", gwConfigKey, err)
+	}
+	if vmConfig.Status == nil {
+		return nil
+	}
+	for i := range podEndpoints {
+		if !ownsSNATPortRangeStatus(&podEndpoints[i], vmConfig.Status.GatewayVMProfiles) {
+			continue
+		}
+		if err := r.updateSNATPortRangeStatus(ctx, &podEndpoints[i], gwConfig.Spec.SnatPortRangeSize > 0, assigned); err != nil {
+			return fmt.Errorf("failed to update sNAT port range of PodEndpoint %s/%s: %w", podEndpoints[i].Namespace, podEndpoints[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// assignSNATPortRanges assigns a source port range of size ports to each pod that is not pinned to an egress source
+// IP. Ranges already reported on PodEndpoint status are kept, so that existing pods keep their ports as pods come
+// and go. Other pods get the range indexed by their IP, or the next free range if it is taken. Pods are left out
+// once all ranges are taken.
+func assignSNATPortRanges(podEndpoints []egressgatewayv1alpha1.PodEndpoint, size int) (map[types.NamespacedName]snatPortRange, error) {
+	count := (snatPortMax - snatPortMin + 1) / size
+	taken := make([]bool, count)
+	assigned := make(map[types.NamespacedName]snatPortRange)
+	getRange := func(index int) snatPortRange {
+		first := snatPortMin + index*size
+		return snatPortRange{first: first, last: first + size - 1}
+	}
+
+	// keep assignments stable regardless of list order
+	podEndpoints = slices.Clone(podEndpoints)
+	slices.SortFunc(podEndpoints, func(a, b egressgatewayv1alpha1.PodEndpoint) int {
+		return strings.Compare(a.Namespace+"/"+a.Name, b.Namespace+"/"+b.Name)
+	})
+	var unassigned []egressgatewayv1alpha1.PodEndpoint
+	for _, podEndpoint := range podEndpoints {
+		if podEndpoint.Spec.EgressSourceIp != "" {
+			continue
+		}
+		// a reported range is only kept if it is still one of the ranges and not taken by another pod
+		if index, ok := parseSNATPortRangeIndex(podEndpoint.Status.SnatPortRange, size, count); ok && !taken[index] {
+			taken[index] = true
+			assigned[types.NamespacedName{Namespace: podEndpoint.Namespace, Name: podEndpoint.Name}] = getRange(index)
+			continue
+		}
+		unassigned = append(unassigned, podEndpoint)
+	}
+	for _, podEndpoint := range unassigned {
+		ip, _, err := net.ParseCIDR(podEndpoint.Spec.PodIpAddress)
+		if err != nil || ip.To4() == nil {
+			return nil, fmt.Errorf("failed to parse IP address of PodEndpoint %s/%s: %s", podEndpoint.Namespace, podEndpoint.Name, podEndpoint.Spec.PodIpAddress)
+		}
+		preferred := int(binary.BigEndian.Uint32(ip.To4()) % uint32(count))
+		for i := 0; i < count; i++ {
+			if index := (preferred + i) % count; !taken[index] {
+				taken[index] = true
+				assigned[types.NamespacedName{Namespace: podEndpoint.Namespace, Name: podEndpoint.Name}] = getRange(index)
+				break
+			}
+		}
+	}
+	return assigned, nil
+}
+
+// parseSNATPortRangeIndex returns the index of portRange, e.g. 1024-1087, among count ranges of size ports
+func parseSNATPortRangeIndex(portRange string, size, count int) (int, bool) {
+	firstStr, lastStr, found := strings.Cut(portRange, "-")
+	if !found {
+		return 0, false
+	}
+	first, err := strconv.Atoi(firstStr)
+	if err != nil {
+		return 0, false
+	}
+	last, err := strconv.Atoi(lastStr)
+	if err != nil || first < snatPortMin || last != first+size-1 || (first-snatPortMin)%size != 0 {
+		return 0, false
+	}
+	index := (first - snatPortMin) / size
+	return index, index < count
+}
+
+// getSNATPortRangeRules returns rules sNATing TCP and UDP connections of pods to their source port range of snatIP
+func getSNATPortRangeRules(
+	mark int,
+	snatIP string,
+	podEndpoints []egressgatewayv1alpha1.PodEndpoint,
+	assigned map[types.NamespacedName]snatPortRange,
+) ([][]string, error) {
+	// keep rules stable regardless of list order
+	podEndpoints = slices.Clone(podEndpoints)
+	slices.SortFunc(podEndpoints, func(a, b egressgatewayv1alpha1.PodEndpoint) int {
+		return strings.Compare(a.Namespace+"/"+a.Name, b.Namespace+"/"+b.Name)
+	})
+	var rules [][]string
+	for _, podEndpoint := range podEndpoints {
+		portRange, ok := assigned[types.NamespacedName{Namespace: podEndpoint.Namespace, Name: podEndpoint.Name}]
+		if !ok {
+			continue
+		}
+		_, podIPNet, err := net.ParseCIDR(podEndpoint.Spec.PodIpAddress)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse IP address of PodEndpoint %s/%s: %w", podEndpoint.Namespace, podEndpoint.Name, err)
+		}
+		for _, protocol := range []string{"tcp", "udp"} {
+			rules = append(rules, []string{"-s", podIPNet.String(), "-o", consts.HostLinkName, "-p", protocol, "-m", "connmark", "--mark", fmt.Sprintf("%d", mark),
+				"-j", "SNAT", "--to-source", fmt.Sprintf("%s:%s", snatIP, portRange)})
+		}
+	}
+	return rules, nil
+}
+
+// ownsSNATPortRangeStatus returns whether this node reports the sNAT port range of podEndpoint, so that gateway
+// nodes don't patch the same status concurrently: the node the pod tunnel connects to, or the first gateway node by
+// name when it connects to the gateway ILB frontend. All nodes assign the same ranges from the reported ones.
+func ownsSNATPortRangeStatus(podEndpoint *egressgatewayv1alpha1.PodEndpoint, vmProfiles []egressgatewayv1alpha1.GatewayVMProfile) bool {
+	nodeName := nodeMeta.Compute.OSProfile.ComputerName
+	var owner string
+	for _, vmProfile := range vmProfiles {
+		if podEndpoint.Spec.GatewayEndpointIp != "" {
+			if vmProfile.PrimaryIP == podEndpoint.Spec.GatewayEndpointIp {
+				return vmProfile.NodeName == nodeName
+			}
+		} else if owner == "" || vmProfile.NodeName < owner {
+			owner = vmProfile.NodeName
+		}
+	}
+	return owner != "" && owner == nodeName
+}
+
+// updateSNATPortRangeStatus reports the source port range assigned to podEndpoint, or that none is left. Both are
+// cleared when port ranges are disabled or the pod is pinned to an egress source IP.
+func (r *PodEndpointReconciler) updateSNATPortRangeStatus(
+	ctx context.Context,
+	podEndpoint *egressgatewayv1alpha1.PodEndpoint,
+	enabled bool,
+	assigned map[types.NamespacedName]snatPortRange,
+) error {
+	original := podEndpoint.DeepCopy()
+	portRange, ok := assigned[types.NamespacedName{Namespace: podEndpoint.Namespace, Name: podEndpoint.Name}]
+	switch {
+	case !enabled || podEndpoint.Spec.EgressSourceIp != "":
+		podEndpoint.Status.SnatPortRange = ""
+		meta.RemoveStatusCondition(&podEndpoint.Status.Conditions, consts.PodEndpointSNATPortRangeAssignedConditionType)
+	case ok:
+		podEndpoint.Status.SnatPortRange = portRange.String()
+		meta.SetStatusCondition(&podEndpoint.Status.Conditions, metav1.Condition{
+			Type:               consts.PodEndpointSNATPortRangeAssignedConditionType,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: podEndpoint.Generation,
+			Reason:             consts.PodEndpointSNATPortRangeAssignedReasonAssigned,
+			Message:            fmt.Sprintf("sNATed to source ports %s", portRange),
+		})
+	default:
+		podEndpoint.Status.SnatPortRange = ""
+		meta.SetStatusCondition(&podEndpoint.Status.Conditions, metav1.Condition{
+			Type:               consts.PodEndpointSNATPortRangeAssignedConditionType,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: podEndpoint.Generation,
+			Reason:             consts.PodEndpointSNATPortRangeAssignedReasonExhausted,
+			Message:            "all source port ranges of the gateway are assigned to other pods, sNATed from the shared pool",
+		})
+	}
+	if equality.Semantic.DeepEqual(original.Status, podEndpoint.Status) {
+		return nil
+	}
+	log.FromContext(ctx).Info("Updating PodEndpoint sNAT port range", "podEndpoint", client.ObjectKeyFromObject(podEndpoint), "portRange", podEndpoint.Status.SnatPortRange)
+	return r.Status().Patch(ctx, podEndpoint, client.MergeFrom(original))
+}
@@ -0,0 +1,216 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"bytes"
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	utiliptables "k8s.io/kubernetes/pkg/util/iptables"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/imds"
+	fakeiptables "github.com/Azure/kube-egress-gateway/pkg/iptableswrapper"
+)
+
+var _ = Describe("Daemon sNAT port range unit tests", func() {
+	var (
+		r        *PodEndpointReconciler
+		fipt     *fakeiptables.FakeIPTables
+		gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration
+		vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration
+	)
+
+	getTestReconciler := func(objects ...client.Object) {
+		cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objects...).WithStatusSubresource(objects...).Build()
+		fipt = fakeiptables.NewFake()
+		r = &PodEndpointReconciler{Client: cl, IPTables: fipt}
+	}
+
+	getPodEndpoint := func(name, podIP, portRange string) *egressgatewayv1alpha1.PodEndpoint {
+		return &egressgatewayv1alpha1.PodEndpoint{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+			Spec: egressgatewayv1alpha1.PodEndpointSpec{
+				StaticGatewayConfiguration: testName,
+				PodIpAddress:               podIP,
+			},
+			Status: egressgatewayv1alpha1.PodEndpointStatus{SnatPortRange: portRange},
+		}
+	}
+
+	getNatDump := func() string {
+		buf := bytes.NewBuffer(nil)
+		Expect(fipt.SaveInto(utiliptables.TableNAT, buf)).To(Succeed())
+		return buf.String()
+	}
+
+	getStatus := func(name string) egressgatewayv1alpha1.PodEndpointStatus {
+		podEndpoint := &egressgatewayv1alpha1.PodEndpoint{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Namespace: testNamespace, Name: name}, podEndpoint)).To(Succeed())
+		return podEndpoint.Status
+	}
+
+	BeforeEach(func() {
+		nodeMeta = &imds.InstanceMetadata{Compute: &imds.ComputeMetadata{OSProfile: imds.OSProfile{ComputerName: testNodeName}}}
+		gwConfig = &egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: testName, Namespace: testNamespace},
+			Spec:       egressgatewayv1alpha1.StaticGatewayConfigurationSpec{SnatPortRangeSize: 64},
+			Status:     getTestGwConfigStatus(),
+		}
+		vmConfig = &egressgatewayv1alpha1.GatewayVMConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: testName, Namespace: testNamespace},
+			Status: &egressgatewayv1alpha1.GatewayVMConfigurationStatus{
+				GatewayVMProfiles: []egressgatewayv1alpha1.GatewayVMProfile{
+					{NodeName: testNodeName, PrimaryIP: "10.0.0.5", SecondaryIP: "10.0.0.6"},
+				},
+			},
+		}
+	})
+
+	It("should assign port ranges derived from pod IPs", func() {
+		pinned := getPodEndpoint("pod4", "10.244.0.8/32", "")
+		pinned.Spec.EgressSourceIp = "1.2.3.4"
+		assigned, err := assignSNATPortRanges([]egressgatewayv1alpha1.PodEndpoint{
+			*getPodEndpoint("pod1", "10.244.0.5/32", ""),
+			*getPodEndpoint("pod2", "10.244.0.6/32", ""),
+			*pinned,
+		}, 64)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(assigned).To(Equal(map[types.NamespacedName]snatPortRange{
+			{Namespace: testNamespace, Name: "pod1"}: {first: 34112, last: 34175},
+			{Namespace: testNamespace, Name: "pod2"}: {first: 34176, last: 34239},
+		}))
+	})
+
+	It("should keep reported port ranges and move colliding pods to the next free range", func() {
+		assigned, err := assignSNATPortRanges([]egressgatewayv1alpha1.PodEndpoint{
+			// pod1 prefers the range reported by pod2, 34176-34239 is taken by pod3 as well
+			*getPodEndpoint("pod1", "10.244.0.6/32", ""),
+			*getPodEndpoint("pod2", "10.244.0.5/32", "34176-34239"),
+			*getPodEndpoint("pod3", "10.244.0.7/32", "34176-34239"),
+			// not a range of the gateway
+			*getPodEndpoint("pod4", "10.244.0.9/32", "34177-34240"),
+		}, 64)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(assigned).To(Equal(map[types.NamespacedName]snatPortRange{
+			{Namespace: testNamespace, Name: "pod2"}: {first: 34176, last: 34239},
+			{Namespace: testNamespace, Name: "pod1"}: {first: 34240, last: 34303},
+			{Namespace: testNamespace, Name: "pod3"}: {first: 34304, last: 34367},
+			{Namespace: testNamespace, Name: "pod4"}: {first: 34368, last: 34431},
+		}))
+	})
+
+	It("should leave pods out once all port ranges are taken", func() {
+		assigned, err := assignSNATPortRanges([]egressgatewayv1alpha1.PodEndpoint{
+			*getPodEndpoint("pod1", "10.244.0.5/32", ""),
+			*getPodEndpoint("pod2", "10.244.0.6/32", ""),
+			*getPodEndpoint("pod3", "10.244.0.7/32", ""),
+		}, 32256)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(assigned).To(Equal(map[types.NamespacedName]snatPortRange{
+			{Namespace: testNamespace, Name: "pod1"}: {first: 33280, last: 65535},
+			{Namespace: testNamespace, Name: "pod2"}: {first: 1024, last: 33279},
+		}))
+	})
+
+	It("should report error for invalid pod IP", func() {
+		_, err := assignSNATPortRanges([]egressgatewayv1alpha1.PodEndpoint{*getPodEndpoint("pod1", "fd00::1/128", "")}, 64)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should sNAT pods to their port ranges and report them on PodEndpoint status", func() {
+		gwConfig.Spec.SnatPortRangeSize = 32256
+		getTestReconciler(vmConfig,
+			getPodEndpoint("pod1", "10.244.0.5/32", ""),
+			getPodEndpoint("pod2", "10.244.0.6/32", ""),
+			getPodEndpoint("pod3", "10.244.0.7/32", ""),
+		)
+		Expect(r.ensureSNATPortRanges(context.TODO(), gwConfig)).To(Succeed())
+		dump := getNatDump()
+		Expect(dump).To(ContainSubstring("-A POSTROUTING -m comment --comment kube-egress-gateway pin sNAT ports of pods on gateway link wg-6000 -j EGRESS-GATEWAY-SNATPORTS-6000\n"))
+		Expect(dump).To(ContainSubstring(
+			"-A EGRESS-GATEWAY-SNATPORTS-6000 -s 10.244.0.5/32 -o host0 -p tcp -m connmark --mark 6000 -j SNAT --to-source 10.0.0.6:33280-65535\n" +
+				"-A EGRESS-GATEWAY-SNATPORTS-6000 -s 10.244.0.5/32 -o host0 -p udp -m connmark --mark 6000 -j SNAT --to-source 10.0.0.6:33280-65535\n" +
+				"-A EGRESS-GATEWAY-SNATPORTS-6000 -s 10.244.0.6/32 -o host0 -p tcp -m connmark --mark 6000 -j SNAT --to-source 10.0.0.6:1024-33279\n" +
+				"-A EGRESS-GATEWAY-SNATPORTS-6000 -s 10.244.0.6/32 -o host0 -p udp -m connmark --mark 6000 -j SNAT --to-source 10.0.0.6:1024-33279\n" +
+				"COMMIT\n"))
+
+		status := getStatus("pod1")
+		Expect(status.SnatPortRange).To(Equal("33280-65535"))
+		Expect(meta.IsStatusConditionTrue(status.Conditions, consts.PodEndpointSNATPortRangeAssignedConditionType)).To(BeTrue())
+		status = getStatus("pod3")
+		Expect(status.SnatPortRange).To(BeEmpty())
+		cond := meta.FindStatusCondition(status.Conditions, consts.PodEndpointSNATPortRangeAssignedConditionType)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal(consts.PodEndpointSNATPortRangeAssignedReasonExhausted))
+	})
+
+	It("should not move the jump rule when it precedes sNAT rules of the gateway", func() {
+		getTestReconciler(vmConfig, getPodEndpoint("pod1", "10.244.0.5/32", ""))
+		_, err := fipt.EnsureChain(utiliptables.TableNAT, "EGRESS-GATEWAY-SNAT-6000")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = fipt.EnsureRule(utiliptables.Append, utiliptables.TableNAT, utiliptables.ChainPostrouting, "-j", "EGRESS-GATEWAY-SNAT-6000")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.ensureSNATPortRanges(context.TODO(), gwConfig)).To(Succeed())
+		// rules of other chains of the gateway may come first
+		_, err = fipt.EnsureChain(utiliptables.TableNAT, "EGRESS-GATEWAY-PIN-6000")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = fipt.EnsureRule(utiliptables.Prepend, utiliptables.TableNAT, utiliptables.ChainPostrouting, "-j", "EGRESS-GATEWAY-PIN-6000")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.ensureSNATPortRanges(context.TODO(), gwConfig)).To(Succeed())
+		Expect(getNatDump()).To(ContainSubstring("-A POSTROUTING -j EGRESS-GATEWAY-PIN-6000\n" +
+			"-A POSTROUTING -m comment --comment kube-egress-gateway pin sNAT ports of pods on gateway link wg-6000 -j EGRESS-GATEWAY-SNATPORTS-6000\n" +
+			"-A POSTROUTING -j EGRESS-GATEWAY-SNAT-6000\n"))
+	})
+
+	It("should only report port ranges of pods whose tunnel this node owns", func() {
+		vmConfig.Status.GatewayVMProfiles = append(vmConfig.Status.GatewayVMProfiles,
+			egressgatewayv1alpha1.GatewayVMProfile{NodeName: "aNode", PrimaryIP: "10.0.0.7", SecondaryIP: "10.0.0.8"})
+		local := getPodEndpoint("pod1", "10.244.0.5/32", "")
+		local.Spec.GatewayEndpointIp = "10.0.0.5"
+		remote := getPodEndpoint("pod2", "10.244.0.6/32", "")
+		remote.Spec.GatewayEndpointIp = "10.0.0.7"
+		getTestReconciler(vmConfig, local, remote, getPodEndpoint("pod3", "10.244.0.7/32", ""))
+		Expect(r.ensureSNATPortRanges(context.TODO(), gwConfig)).To(Succeed())
+		// all pods are pinned on each gateway node
+		dump := getNatDump()
+		Expect(dump).To(ContainSubstring("-s 10.244.0.6/32 -o host0 -p tcp -m connmark --mark 6000 -j SNAT --to-source 10.0.0.6:34176-34239\n"))
+		Expect(dump).To(ContainSubstring("-s 10.244.0.7/32 -o host0 -p tcp -m connmark --mark 6000 -j SNAT --to-source 10.0.0.6:34240-34303\n"))
+		Expect(getStatus("pod1").SnatPortRange).To(Equal("34112-34175"))
+		// reported by the node the tunnel connects to
+		Expect(getStatus("pod2").SnatPortRange).To(BeEmpty())
+		// pods connected to the gateway ILB frontend are reported by the first gateway node
+		Expect(getStatus("pod3").SnatPortRange).To(BeEmpty())
+
+		nodeMeta.Compute.OSProfile.ComputerName = "aNode"
+		Expect(r.ensureSNATPortRanges(context.TODO(), gwConfig)).To(Succeed())
+		Expect(getStatus("pod1").SnatPortRange).To(Equal("34112-34175"))
+		Expect(getStatus("pod2").SnatPortRange).To(Equal("34176-34239"))
+		Expect(getStatus("pod3").SnatPortRange).To(Equal("34240-34303"))
+	})
+
+	It("should release port ranges when disabled", func() {
+		getTestReconciler(vmConfig, getPodEndpoint("pod1", "10.244.0.5/32", ""))
+		Expect(r.ensureSNATPortRanges(context.TODO(), gwConfig)).To(Succeed())
+		Expect(getNatDump()).To(ContainSubstring("EGRESS-GATEWAY-SNATPORTS-6000"))
+		Expect(getStatus("pod1").SnatPortRange).To(Equal("34112-34175"))
+
+		gwConfig.Spec.SnatPortRangeSize = 0
+		Expect(r.ensureSNATPortRanges(context.TODO(), gwConfig)).To(Succeed())
+		Expect(getNatDump()).NotTo(ContainSubstring("EGRESS-GATEWAY-SNATPORTS-6000"))
+		status := getStatus("pod1")
+		Expect(status.SnatPortRange).To(BeEmpty())
+		Expect(status.Conditions).To(BeEmpty())
+	})
+})
@@ -9,12 +9,15 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/containernetworking/plugins/pkg/ns"
 	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -35,8 +38,11 @@ import (
 	"github.com/Azure/kube-egress-gateway/pkg/consts"
 	"github.com/Azure/kube-egress-gateway/pkg/healthprobe"
 	"github.com/Azure/kube-egress-gateway/pkg/imds"
+	"github.com/Azure/kube-egress-gateway/pkg/logger"
+	"github.com/Azure/kube-egress-gateway/pkg/metrics"
 	"github.com/Azure/kube-egress-gateway/pkg/netlinkwrapper"
 	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/tunnel"
 	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
 	"github.com/Azure/kube-egress-gateway/pkg/wgctrlwrapper"
 )
@@ -51,7 +57,26 @@ type StaticGatewayConfigurationReconciler struct {
 	Netlink       netlinkwrapper.Interface
 	NetNS         netnswrapper.Interface
 	IPTables      utiliptables.Interface
+	IP6Tables     utiliptables.Interface
 	WgCtrl        wgctrlwrapper.Interface
+	// HostInterfaceName is the host interface carrying the gateway ILB IP and default route, detected on setup
+	// if empty
+	HostInterfaceName string
+	// NetnsPerGateway configures each gateway in its own network namespace, named after the gateway port,
+	// instead of the shared gateway namespace created on node setup
+	NetnsPerGateway bool
+	// TunnelCidr is the IPv6 link local subnet addressing gateway wireguard interfaces and host veth links,
+	// consts.DefaultTunnelCidr if nil
+	TunnelCidr *net.IPNet
+
+	// instanceMetadata queries instance metadata of this node
+	instanceMetadata func() (*imds.InstanceMetadata, error)
+	// restoredChains records the rules last restored in each chain, keyed by chainKey, so that unchanged chains
+	// are not restored again and keep their packet counters
+	restoredChains sync.Map
+	// wireguardFwMarks records marks of the wireguard fwmark rules this daemon set, only rules of these marks are
+	// cleaned up, rules of other agents at the same priority are left untouched
+	wireguardFwMarks sync.Map
 }
 
 //+kubebuilder:rbac:groups=egressgateway.kubernetes.azure.com,resources=staticgatewayconfigurations,verbs=get;list;watch
@@ -115,6 +140,7 @@ func (r *StaticGatewayConfigurationReconciler) Reconcile(ctx context.Context, re
 		log.Error(err, "unable to fetch StaticGatewayConfiguration instance")
 		return ctrl.Result{}, err
 	}
+	ctx = logger.WithGateway(ctx, gwConfig)
 
 	if !isReady(gwConfig) {
 		// gateway setup hasn't completed yet
@@ -122,7 +148,17 @@ func (r *StaticGatewayConfigurationReconciler) Reconcile(ctx context.Context, re
 	}
 
 	if !applyToNode(gwConfig) {
-		// gwConfig does not apply to this node
+		// gwConfig does not apply to this node, tear down the gateway if it was configured here before,
+		// e.g. this node's vmss has been removed from the gateway, so that peers move to remaining nodes
+		configured, err := r.isGatewayConfiguredOnNode(ctx, gwConfig)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if configured {
+			if err := r.cleanUp(ctx); err != nil {
+				return ctrl.Result{}, fmt.Errorf("failed to clean up StaticGatewayConfiguration %s/%s removed from node: %w", gwConfig.Namespace, gwConfig.Name, err)
+			}
+		}
 		return ctrl.Result{}, nil
 	}
 
@@ -142,7 +178,12 @@ func (r *StaticGatewayConfigurationReconciler) SetupWithManager(mgr ctrl.Manager
 	r.Netlink = netlinkwrapper.NewNetLink()
 	r.NetNS = netnswrapper.NewNetNS()
 	r.IPTables = utiliptables.New(utilexec.New(), utiliptables.ProtocolIPv4)
+	r.IP6Tables = utiliptables.New(utilexec.New(), utiliptables.ProtocolIPv6)
 	r.WgCtrl = wgctrlwrapper.NewWgCtrl()
+	r.instanceMetadata = imds.GetInstanceMetadata
+	if err := r.setupHostInterface(mgr.GetLogger().WithName("host-interface")); err != nil {
+		return err
+	}
 	controller, err := ctrl.NewControllerManagedBy(mgr).
 		For(&egressgatewayv1alpha1.StaticGatewayConfiguration{}).
 		// We need to watch GatewayVMConfiguration also, because vmSecondaryIP may change, e.g. duing upgrade
@@ -162,30 +203,50 @@ func (r *StaticGatewayConfigurationReconciler) reconcile(
 	log := log.FromContext(ctx)
 	log.Info("Reconciling gateway configuration")
 
+	mc := metrics.NewMetricsContext(
+		os.Getenv(consts.PodNamespaceEnvKey),
+		"daemon_reconcile_static_gateway_configuration",
+		"n/a",
+		"n/a",
+		strings.ToLower(fmt.Sprintf("%s/%s", gwConfig.Namespace, gwConfig.Name)),
+	) // no subscription_id/resource_group for daemon reconciler
+	succeeded := false
+	defer func() { mc.ObserveControllerReconcileMetrics(succeeded) }()
+
 	// get wireguard private key from secret
 	privateKey, err := r.getWireguardPrivateKey(ctx, gwConfig)
 	if err != nil {
 		return err
 	}
 
-	// add lb ip (if not exists) to eth0
+	// add lb ip (if not exists) to host interface
 	if err := r.reconcileIlbIPOnHost(ctx, gwConfig.Status.GatewayServerProfile.Ip); err != nil {
 		return err
 	}
 
-	// remove secondary ip from eth0
-	vmPrimaryIP, vmSecondaryIP, err := r.getVMIP(ctx, gwConfig)
+	// remove secondary ip from host interface
+	vmPrimaryIP, vmSecondaryIP, err := getVMIP(ctx, r, gwConfig)
 	if err != nil {
 		return err
 	}
 
-	if err := r.removeSecondaryIpFromHost(ctx, vmSecondaryIP); err != nil {
+	// secondary IPs of additional public ip prefixes, egress traffic is sNATed to all of them
+	vmAdditionalSecondaryIPs, err := r.getVMAdditionalSecondaryIPs(ctx, gwConfig)
+	if err != nil {
 		return err
 	}
+	snatIPs := append([]string{vmSecondaryIP}, vmAdditionalSecondaryIPs...)
+
+	for _, snatIP := range snatIPs {
+		if err := r.removeSecondaryIpFromHost(ctx, snatIP); err != nil {
+			return err
+		}
+	}
 
 	// avoid masquerading packets from gateway namespace, as they're already sNATed
 	if err := r.ensureIPTablesChain(
 		ctx,
+		r.IPTables,
 		utiliptables.TableNAT,
 		utiliptables.Chain("EGRESS-GATEWAY-SNAT"), // target chain
 		utiliptables.ChainPostrouting,             // source chain
@@ -194,20 +255,61 @@ func (r *StaticGatewayConfigurationReconciler) reconcile(
 		return err
 	}
 
-	if err := r.ensureIPTablesChain(
-		ctx,
-		utiliptables.TableNAT,
-		utiliptables.Chain(fmt.Sprintf("EGRESS-%s", strings.ReplaceAll(vmSecondaryIP, ".", "-"))), // target chain
-		utiliptables.Chain("EGRESS-GATEWAY-SNAT"),                                                 // source chain
-		fmt.Sprintf("kube-egress-gateway no sNAT packet from ip %s", vmSecondaryIP),
-		[][]string{
-			{"-s", vmSecondaryIP + "/32", "-j", "ACCEPT"},
-		}); err != nil {
-		return err
+	for _, snatIP := range snatIPs {
+		if err := r.ensureIPTablesChain(
+			ctx,
+			r.IPTables,
+			utiliptables.TableNAT,
+			utiliptables.Chain(fmt.Sprintf("EGRESS-%s", strings.ReplaceAll(snatIP, ".", "-"))), // target chain
+			utiliptables.Chain("EGRESS-GATEWAY-SNAT"),                                          // source chain
+			fmt.Sprintf("kube-egress-gateway no sNAT packet from ip %s", snatIP),
+			[][]string{
+				{"-s", snatIP + "/32", "-j", "ACCEPT"},
+			}); err != nil {
+			return err
+		}
 	}
 
 	// configure gateway namespace (if not exists)
-	if err := r.configureGatewayNamespace(ctx, gwConfig, privateKey, vmPrimaryIP, vmSecondaryIP); err != nil {
+	if err := r.configureGatewayNamespace(ctx, gwConfig, privateKey, vmPrimaryIP, vmSecondaryIP, vmAdditionalSecondaryIPs...); err != nil {
+		return err
+	}
+
+	// mirror egress traffic leaving the gateway namespace, or stop mirroring it. Mirroring is best effort, a missing
+	// target interface must not keep the gateway from serving pods, the error is returned once the gateway is
+	// configured so that it is retried.
+	mirrorErr := r.reconcileTrafficMirror(ctx, gwConfig, snatIPs)
+	if mirrorErr != nil {
+		log.Error(mirrorErr, "failed to reconcile traffic mirror")
+	}
+
+	// keep sNATed traffic on the default route of host interface when the main route table is customized
+	if err := r.reconcileEgressRouteRules(ctx, snatIPs, gwConfig.Spec.RoutePriority); err != nil {
+		return err
+	}
+
+	// route wireguard packets of the gateway by their fwmark
+	if err := r.reconcileWireguardFwMarkRule(ctx, gwConfig); err != nil {
+		return err
+	}
+
+	// configure ipv6 egress if the gateway has ipv6 public ip prefix provisioned
+	vmSecondaryIPv6, err := r.getVMSecondaryIPv6(ctx, gwConfig)
+	if err != nil {
+		return err
+	}
+	if vmSecondaryIPv6 != "" {
+		if err := r.removeSecondaryIpFromHost(ctx, vmSecondaryIPv6); err != nil {
+			return err
+		}
+		if err := r.configureGatewayNamespaceIPv6(ctx, gwConfig, vmSecondaryIPv6); err != nil {
+			return err
+		}
+	}
+
+	// public IPs of this node, pods pinned to one of them connect to this node
+	publicIPs, err := r.getVMPublicIPs(snatIPs)
+	if err != nil {
 		return err
 	}
 
@@ -215,6 +317,7 @@ func (r *StaticGatewayConfigurationReconciler) reconcile(
 	gwStatus := egressgatewayv1alpha1.GatewayConfiguration{
 		StaticGatewayConfiguration: fmt.Sprintf("%s/%s", gwConfig.Namespace, gwConfig.Name),
 		InterfaceName:              getWireguardInterfaceName(gwConfig),
+		PublicIps:                  publicIPs,
 	}
 	if err := r.updateGatewayNodeStatus(ctx, gwStatus, true /* add */); err != nil {
 		return err
@@ -224,7 +327,11 @@ func (r *StaticGatewayConfigurationReconciler) reconcile(
 		return err
 	}
 
+	if mirrorErr != nil {
+		return fmt.Errorf("failed to mirror traffic: %w", mirrorErr)
+	}
 	log.Info("Gateway configuration reconciled")
+	succeeded = true
 	return nil
 }
 
@@ -236,25 +343,124 @@ func (r *StaticGatewayConfigurationReconciler) cleanUp(ctx context.Context) erro
 	if err := r.List(ctx, gwConfigList); err != nil {
 		return fmt.Errorf("failed to list staticGatewayConfigurations: %w", err)
 	}
-	existingWgLinks := make(map[string]struct{})
-	existingIPs := make(map[string]struct{})
+	// network namespace name -> wireguard links and IPs of active gateways in it
+	existing := make(map[string]*gatewayNetnsResources)
+	// SNAT IPs and vxlan links of active gateways mirroring their traffic
+	mirroredIPs := make(map[string]struct{})
+	mirrorLinks := make(map[string]struct{})
+	// wireguard fwmark rules of active gateways
+	fwMarkRules := make(map[string]struct{})
 	hasActiveGateway := false
 	for _, gwConfig := range gwConfigList.Items {
 		if applyToNode(&gwConfig) && gwConfig.DeletionTimestamp.IsZero() {
-			_, vmSecondaryIP, err := r.getVMIP(ctx, &gwConfig)
+			_, vmSecondaryIP, err := getVMIP(ctx, r, &gwConfig)
 			if err != nil {
 				log.Error(err, "failed to get VM secondaryIP during cleanup", "gwConfig", fmt.Sprintf("%s/%s", gwConfig.Namespace, gwConfig.Name))
 				continue
 			}
-			existingWgLinks[getWireguardInterfaceName(&gwConfig)] = struct{}{}
-			existingIPs[vmSecondaryIP] = struct{}{}
+			nsName := getGatewayNetnsName(&gwConfig, r.NetnsPerGateway)
+			resources, ok := existing[nsName]
+			if !ok {
+				resources = &gatewayNetnsResources{wgLinks: make(map[string]struct{}), ips: make(map[string]struct{})}
+				existing[nsName] = resources
+			}
+			resources.wgLinks[getWireguardInterfaceName(&gwConfig)] = struct{}{}
+			resources.ips[vmSecondaryIP] = struct{}{}
+			snatIPs := []string{vmSecondaryIP}
+			if vmAdditionalSecondaryIPs, err := r.getVMAdditionalSecondaryIPs(ctx, &gwConfig); err == nil {
+				for _, ip := range vmAdditionalSecondaryIPs {
+					resources.ips[ip] = struct{}{}
+				}
+				snatIPs = append(snatIPs, vmAdditionalSecondaryIPs...)
+			}
+			if mirror := gwConfig.Spec.TrafficMirror; mirror != nil {
+				for _, ip := range snatIPs {
+					mirroredIPs[ip] = struct{}{}
+				}
+				if mirror.Vxlan != nil {
+					mirrorLinks[getTrafficMirrorLinkName(&gwConfig)] = struct{}{}
+				}
+			}
+			if fwMark := gwConfig.Spec.WireguardFwMark; fwMark != nil && fwMark.RouteTable != 0 {
+				fwMarkRules[getWireguardFwMarkRuleKey(int(fwMark.Mark), int(fwMark.RouteTable))] = struct{}{}
+			}
+			if vmSecondaryIPv6, err := r.getVMSecondaryIPv6(ctx, &gwConfig); err == nil && vmSecondaryIPv6 != "" {
+				resources.ips[vmSecondaryIPv6] = struct{}{}
+			}
 			hasActiveGateway = true
 		}
 	}
 
-	gwns, err := r.NetNS.GetNS(consts.GatewayNetnsName)
+	nsNames, err := listGatewayNetns(r.NetNS, r.NetnsPerGateway)
 	if err != nil {
-		return fmt.Errorf("failed to get network namespace %s: %w", consts.GatewayNetnsName, err)
+		return err
+	}
+	for _, nsName := range nsNames {
+		resources, ok := existing[nsName]
+		if !ok {
+			resources = &gatewayNetnsResources{}
+		}
+		cleaned, err := r.cleanUpNetns(ctx, nsName, resources)
+		if err != nil {
+			if nsName == consts.GatewayNetnsName {
+				return err
+			}
+			// do not block cleaning up rest namespaces
+			log.Error(err, "failed to clean up gateway network namespace", "netns", nsName)
+			continue
+		}
+		// keep the namespace until its links are removed, so that gateway status and lb probe get updated
+		if cleaned && !ok && nsName != consts.GatewayNetnsName {
+			log.Info("Removing orphaned gateway network namespace", "netns", nsName)
+			if err := r.NetNS.UnmountNS(nsName); err != nil {
+				log.Error(err, "failed to remove gateway network namespace", "netns", nsName)
+			}
+		}
+	}
+
+	if err := r.cleanUpTrafficMirror(ctx, mirroredIPs, mirrorLinks); err != nil {
+		return err
+	}
+
+	if err := r.cleanUpWireguardFwMarkRules(ctx, fwMarkRules); err != nil {
+		return err
+	}
+
+	if !hasActiveGateway {
+		log.Info("No active gateway found, cleaning up leftover network configurations")
+		if err := r.reconcileIlbIPOnHost(ctx, ""); err != nil {
+			return fmt.Errorf("failed to cleanup ILB IP on host: %w", err)
+		}
+
+		if err := r.removeIPTablesChains(
+			ctx,
+			r.IPTables,
+			utiliptables.TableNAT,
+			[]utiliptables.Chain{utiliptables.Chain("EGRESS-GATEWAY-SNAT")},
+			[]utiliptables.Chain{utiliptables.ChainPostrouting},
+			[]string{"kube-egress-gateway no MASQUERADE"},
+		); err != nil {
+			return fmt.Errorf("failed to delete iptables chain EGRESS-GATEWAY-SNAT: %w", err)
+		}
+	}
+
+	log.Info("Network namespace cleanup completed")
+	return nil
+}
+
+// gatewayNetnsResources are the wireguard links and IPs of active gateways in a gateway network namespace
+type gatewayNetnsResources struct {
+	wgLinks map[string]struct{}
+	ips     map[string]struct{}
+}
+
+// cleanUpNetns removes wireguard links and IPs not belonging to active gateways from the network namespace,
+// and reports whether all of them are removed
+func (r *StaticGatewayConfigurationReconciler) cleanUpNetns(ctx context.Context, nsName string, existing *gatewayNetnsResources) (bool, error) {
+	log := log.FromContext(ctx)
+	gwns, err := r.NetNS.GetNS(nsName)
+	if err != nil {
+		return false, fmt.Errorf("failed to get network namespace %s: %w", nsName, err)
 	}
 	defer gwns.Close()
 
@@ -268,6 +474,10 @@ func (r *StaticGatewayConfigurationReconciler) cleanUp(ctx context.Context) erro
 		}
 		hostLink, err := r.Netlink.LinkByName(consts.HostLinkName)
 		if err != nil {
+			if _, ok := err.(netlink.LinkNotFoundError); ok && nsName != consts.GatewayNetnsName {
+				// per gateway namespace created without the veth pair configured yet
+				return nil
+			}
 			return fmt.Errorf("failed to get host link in gateway namespace: %w", err)
 		}
 		ips, err = r.Netlink.AddrList(hostLink, nl.FAMILY_ALL)
@@ -276,48 +486,36 @@ func (r *StaticGatewayConfigurationReconciler) cleanUp(ctx context.Context) erro
 		}
 		return nil
 	}); err != nil {
-		return err
+		return false, err
 	}
 
+	cleaned := true
 	for _, ip := range ips {
-		if _, ok := existingIPs[ip.IP.String()]; !ok {
-			log.Info("Removing orphaned IP", "ip", ip.IP.String())
+		if ip.IP.IsLinkLocalUnicast() {
+			// link local addresses are managed by kernel
+			continue
+		}
+		if _, ok := existing.ips[ip.IP.String()]; !ok {
+			log.Info("Removing orphaned IP", "ip", ip.IP.String(), "netns", nsName)
 			if err := r.ensureDeleteIP(ctx, gwns, ip); err != nil {
 				log.Error(err, fmt.Sprintf("failed to cleanup vmSecondaryIP %s", ip.IP.String()))
+				cleaned = false
 			}
 		}
 	}
 
 	for _, link := range links {
 		if strings.HasPrefix(link.Attrs().Name, consts.WiregaurdLinkNamePrefix) {
-			if _, ok := existingWgLinks[link.Attrs().Name]; !ok {
-				log.Info("Removing orphaned wireguard link", "link", link.Attrs().Name)
+			if _, ok := existing.wgLinks[link.Attrs().Name]; !ok {
+				log.Info("Removing orphaned wireguard link", "link", link.Attrs().Name, "netns", nsName)
 				if err := r.ensureDeleteLink(ctx, gwns, link); err != nil {
 					log.Error(err, fmt.Sprintf("failed to cleanup wireguard link %s", link.Attrs().Name))
+					cleaned = false
 				}
 			}
 		}
 	}
-
-	if !hasActiveGateway {
-		log.Info("No active gateway found, cleaning up leftover network configurations")
-		if err := r.reconcileIlbIPOnHost(ctx, ""); err != nil {
-			return fmt.Errorf("failed to cleanup ILB IP on host: %w", err)
-		}
-
-		if err := r.removeIPTablesChains(
-			ctx,
-			utiliptables.TableNAT,
-			[]utiliptables.Chain{utiliptables.Chain("EGRESS-GATEWAY-SNAT")},
-			[]utiliptables.Chain{utiliptables.ChainPostrouting},
-			[]string{"kube-egress-gateway no MASQUERADE"},
-		); err != nil {
-			return fmt.Errorf("failed to delete iptables chain EGRESS-GATEWAY-SNAT: %w", err)
-		}
-	}
-
-	log.Info("Network namespace cleanup completed")
-	return nil
+	return cleaned, nil
 }
 
 func (r *StaticGatewayConfigurationReconciler) ensureDeleteLink(ctx context.Context, gwns ns.NetNS, link netlink.Link) error {
@@ -336,23 +534,64 @@ func (r *StaticGatewayConfigurationReconciler) ensureDeleteLink(ctx context.Cont
 			return err
 		}
 		log.Info("Removing iptables rules", "mark", mark)
-		if err := r.removeIPTablesChains(
-			ctx,
-			utiliptables.TableNAT,
-			[]utiliptables.Chain{
-				utiliptables.Chain(fmt.Sprintf("EGRESS-GATEWAY-MARK-%d", mark)),
-				utiliptables.Chain(fmt.Sprintf("EGRESS-GATEWAY-SNAT-%d", mark)),
-			}, // target chain
-			[]utiliptables.Chain{
-				utiliptables.ChainPrerouting,
-				utiliptables.ChainPostrouting,
-			}, // source chain
-			[]string{
-				fmt.Sprintf("kube-egress-gateway mark packets from gateway link %s", linkName),
-				fmt.Sprintf("kube-egress-gateway sNAT packets from gateway link %s", linkName),
-			},
-		); err != nil {
-			return fmt.Errorf("failed to cleanup iptables rules for link %s and mark %d: %w", linkName, mark, err)
+		for _, ipt := range []utiliptables.Interface{r.IPTables, r.IP6Tables} {
+			if ipt == nil {
+				continue
+			}
+			if err := r.removeIPTablesChains(
+				ctx,
+				ipt,
+				utiliptables.TableNAT,
+				[]utiliptables.Chain{
+					utiliptables.Chain(fmt.Sprintf("EGRESS-GATEWAY-MARK-%d", mark)),
+					utiliptables.Chain(fmt.Sprintf("EGRESS-GATEWAY-SNAT-%d", mark)),
+					utiliptables.Chain(fmt.Sprintf("EGRESS-GATEWAY-PIN-%d", mark)),
+					utiliptables.Chain(fmt.Sprintf("EGRESS-GATEWAY-SNATPORTS-%d", mark)),
+				}, // target chain
+				[]utiliptables.Chain{
+					utiliptables.ChainPrerouting,
+					utiliptables.ChainPostrouting,
+					utiliptables.ChainPostrouting,
+					utiliptables.ChainPostrouting,
+				}, // source chain
+				[]string{
+					fmt.Sprintf("kube-egress-gateway mark packets from gateway link %s", linkName),
+					fmt.Sprintf("kube-egress-gateway sNAT packets from gateway link %s", linkName),
+					fmt.Sprintf("kube-egress-gateway pin egress source IP of pods on gateway link %s", linkName),
+					fmt.Sprintf("kube-egress-gateway pin sNAT ports of pods on gateway link %s", linkName),
+				},
+			); err != nil {
+				return fmt.Errorf("failed to cleanup iptables rules for link %s and mark %d: %w", linkName, mark, err)
+			}
+			if err := r.removeIPTablesChains(
+				ctx,
+				ipt,
+				utiliptables.TableMangle,
+				[]utiliptables.Chain{
+					utiliptables.Chain(fmt.Sprintf("EGRESS-GATEWAY-MSS-%d", mark)),
+					utiliptables.Chain(fmt.Sprintf("EGRESS-GATEWAY-DSCP-%d", mark)),
+				}, // target chain
+				[]utiliptables.Chain{
+					utiliptables.ChainForward,
+					utiliptables.ChainForward,
+				}, // source chain
+				[]string{
+					fmt.Sprintf("kube-egress-gateway clamp tcp mss on gateway link %s", linkName),
+					fmt.Sprintf("kube-egress-gateway mark dscp of pods on gateway link %s", linkName),
+				},
+			); err != nil {
+				return fmt.Errorf("failed to cleanup tcp mss clamping and dscp rules for link %s: %w", linkName, err)
+			}
+			if err := r.removeIPTablesChains(
+				ctx,
+				ipt,
+				utiliptables.TableFilter,
+				[]utiliptables.Chain{utiliptables.Chain(fmt.Sprintf("EGRESS-GATEWAY-PORTS-%d", mark))},
+				[]utiliptables.Chain{utiliptables.ChainForward},
+				[]string{fmt.Sprintf("kube-egress-gateway filter destination ports on gateway link %s", linkName)},
+			); err != nil {
+				return fmt.Errorf("failed to cleanup destination port filter rules for link %s: %w", linkName, err)
+			}
 		}
 		return nil
 	}); err != nil {
@@ -403,9 +642,16 @@ func (r *StaticGatewayConfigurationReconciler) ensureDeleteIP(ctx context.Contex
 		}
 	}
 
+	if ip.IP.To4() != nil {
+		if err := r.reconcileEgressRouteRules(ctx, []string{ip.IP.String()}, 0); err != nil {
+			return err
+		}
+	}
+
 	log.Info("Deleting no-sNAT rule for vmSecondaryIP", "ip", ip.IP.String())
 	if err := r.removeIPTablesChains(
 		ctx,
+		r.IPTables,
 		utiliptables.TableNAT,
 		[]utiliptables.Chain{utiliptables.Chain(fmt.Sprintf("EGRESS-%s", strings.ReplaceAll(ip.IP.String(), ".", "-")))}, // target chain
 		[]utiliptables.Chain{utiliptables.Chain("EGRESS-GATEWAY-SNAT")},                                                  // source chain
@@ -440,8 +686,10 @@ func (r *StaticGatewayConfigurationReconciler) getWireguardPrivateKey(
 	return &wgPrivateKey, nil
 }
 
-func (r *StaticGatewayConfigurationReconciler) getVMIP(
+// getVMIP returns the primary and secondary IP of this node in the gateway from GatewayVMConfiguration status
+func getVMIP(
 	ctx context.Context,
+	c client.Reader,
 	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
 ) (string, string, error) {
 	log := log.FromContext(ctx)
@@ -451,7 +699,7 @@ func (r *StaticGatewayConfigurationReconciler) getVMIP(
 
 	// Fetch the StaticGatewayConfiguration instance.
 	vmConfig := &egressgatewayv1alpha1.GatewayVMConfiguration{}
-	if err := r.Get(ctx, types.NamespacedName{Namespace: gwConfig.Namespace, Name: gwConfig.Name}, vmConfig); err != nil {
+	if err := c.Get(ctx, types.NamespacedName{Namespace: gwConfig.Namespace, Name: gwConfig.Name}, vmConfig); err != nil {
 		return "", "", err
 	}
 
@@ -477,6 +725,54 @@ func (r *StaticGatewayConfigurationReconciler) getVMIP(
 	return primaryIP, secondaryIP, nil
 }
 
+func (r *StaticGatewayConfigurationReconciler) getVMSecondaryIPv6(
+	ctx context.Context,
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+) (string, error) {
+	if !gwConfig.TunnelsIPVersion(egressgatewayv1alpha1.IPv6) {
+		return "", nil
+	}
+
+	nodeName := nodeMeta.Compute.OSProfile.ComputerName
+	vmConfig := &egressgatewayv1alpha1.GatewayVMConfiguration{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: gwConfig.Namespace, Name: gwConfig.Name}, vmConfig); err != nil {
+		return "", err
+	}
+	if vmConfig.Status == nil {
+		return "", fmt.Errorf("status is nil for GatewayVMConfiguration %s/%s", vmConfig.Namespace, vmConfig.Name)
+	}
+	for _, vmProfile := range vmConfig.Status.GatewayVMProfiles {
+		if vmProfile.NodeName == nodeName {
+			return vmProfile.SecondaryIPv6, nil
+		}
+	}
+	return "", nil
+}
+
+func (r *StaticGatewayConfigurationReconciler) getVMAdditionalSecondaryIPs(
+	ctx context.Context,
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+) ([]string, error) {
+	if gwConfig.Spec.PublicIpPrefixCount <= 1 {
+		return nil, nil
+	}
+
+	nodeName := nodeMeta.Compute.OSProfile.ComputerName
+	vmConfig := &egressgatewayv1alpha1.GatewayVMConfiguration{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: gwConfig.Namespace, Name: gwConfig.Name}, vmConfig); err != nil {
+		return nil, err
+	}
+	if vmConfig.Status == nil {
+		return nil, fmt.Errorf("status is nil for GatewayVMConfiguration %s/%s", vmConfig.Namespace, vmConfig.Name)
+	}
+	for _, vmProfile := range vmConfig.Status.GatewayVMProfiles {
+		if vmProfile.NodeName == nodeName {
+			return vmProfile.AdditionalSecondaryIPs, nil
+		}
+	}
+	return nil, nil
+}
+
 func isReady(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) bool {
 	wgProfile := gwConfig.Status.GatewayServerProfile
 	return gwConfig.Status.EgressIpPrefix != "" && wgProfile.Ip != "" &&
@@ -489,9 +785,13 @@ func applyToNode(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) boo
 		name, ok := nodeTags[consts.AKSNodepoolTagKey]
 		return ok && strings.EqualFold(name, gwConfig.Spec.GatewayNodepoolName)
 	} else {
-		vmssProfile := gwConfig.Spec.GatewayVmssProfile
-		return strings.EqualFold(vmssProfile.VmssName, nodeMeta.Compute.VMScaleSetName) &&
-			strings.EqualFold(vmssProfile.VmssResourceGroup, nodeMeta.Compute.ResourceGroupName)
+		for _, vmss := range gwConfig.Spec.GatewayVmssProfile.VmssReferences() {
+			if strings.EqualFold(vmss.VmssName, nodeMeta.Compute.VMScaleSetName) &&
+				strings.EqualFold(vmss.VmssResourceGroup, nodeMeta.Compute.ResourceGroupName) {
+				return true
+			}
+		}
+		return false
 	}
 }
 
@@ -509,9 +809,9 @@ func parseNodeTags() map[string]string {
 
 func (r *StaticGatewayConfigurationReconciler) reconcileIlbIPOnHost(ctx context.Context, ilbIP string) error {
 	log := log.FromContext(ctx)
-	eth0, err := r.Netlink.LinkByName("eth0")
+	hostInterface, err := r.Netlink.LinkByName(r.hostInterfaceName())
 	if err != nil {
-		return fmt.Errorf("failed to retrieve link eth0: %w", err)
+		return fmt.Errorf("failed to retrieve link %s: %w", r.hostInterfaceName(), err)
 	}
 
 	if len(nodeMeta.Network.Interface) == 0 || len(nodeMeta.Network.Interface[0].IPv4.Subnet) == 0 {
@@ -522,18 +822,18 @@ func (r *StaticGatewayConfigurationReconciler) reconcileIlbIPOnHost(ctx context.
 		return fmt.Errorf("failed to retrieve and parse prefix: %w", err)
 	}
 
-	addresses, err := r.Netlink.AddrList(eth0, nl.FAMILY_ALL)
+	addresses, err := r.Netlink.AddrList(hostInterface, nl.FAMILY_ALL)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve IP addresses for eth0: %w", err)
+		return fmt.Errorf("failed to retrieve IP addresses for %s: %w", r.hostInterfaceName(), err)
 	}
 
 	if ilbIP == "" {
 		// cleanup process
 		for _, address := range addresses {
 			if address.Label == consts.ILBIPLabel {
-				log.Info("Removing ILB IP from eth0", "ilb IP", address.IPNet.String())
-				if err := r.Netlink.AddrDel(eth0, &address); err != nil {
-					return fmt.Errorf("failed to delete ILB IP from eth0: %w", err)
+				log.Info("Removing ILB IP from host interface", "interface", r.hostInterfaceName(), "ilb IP", address.IPNet.String())
+				if err := r.Netlink.AddrDel(hostInterface, &address); err != nil {
+					return fmt.Errorf("failed to delete ILB IP from %s: %w", r.hostInterfaceName(), err)
 				}
 			}
 		}
@@ -555,12 +855,12 @@ func (r *StaticGatewayConfigurationReconciler) reconcileIlbIPOnHost(ctx context.
 	}
 
 	if !addressPresent {
-		log.Info("Adding ILB IP to eth0", "ilb IP", ilbIpCidr)
-		if err := r.Netlink.AddrAdd(eth0, &netlink.Addr{
+		log.Info("Adding ILB IP to host interface", "interface", r.hostInterfaceName(), "ilb IP", ilbIpCidr)
+		if err := r.Netlink.AddrAdd(hostInterface, &netlink.Addr{
 			IPNet: ilbIpNet,
 			Label: consts.ILBIPLabel,
 		}); err != nil {
-			return fmt.Errorf("failed to add ILB IP to eth0: %w", err)
+			return fmt.Errorf("failed to add ILB IP to %s: %w", r.hostInterfaceName(), err)
 		}
 	}
 
@@ -569,21 +869,21 @@ func (r *StaticGatewayConfigurationReconciler) reconcileIlbIPOnHost(ctx context.
 
 func (r *StaticGatewayConfigurationReconciler) removeSecondaryIpFromHost(ctx context.Context, ip string) error {
 	log := log.FromContext(ctx)
-	eth0, err := r.Netlink.LinkByName("eth0")
+	hostInterface, err := r.Netlink.LinkByName(r.hostInterfaceName())
 	if err != nil {
-		return fmt.Errorf("failed to retrieve link eth0: %w", err)
+		return fmt.Errorf("failed to retrieve link %s: %w", r.hostInterfaceName(), err)
 	}
 
-	addresses, err := r.Netlink.AddrList(eth0, nl.FAMILY_ALL)
+	addresses, err := r.Netlink.AddrList(hostInterface, nl.FAMILY_ALL)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve IP addresses for eth0: %w", err)
+		return fmt.Errorf("failed to retrieve IP addresses for %s: %w", r.hostInterfaceName(), err)
 	}
 
 	for _, address := range addresses {
 		if address.IP.String() == ip {
-			log.Info("Removing secondary IP from eth0", "secondary_ip", address.IP.String())
-			if err := r.Netlink.AddrDel(eth0, &address); err != nil {
-				return fmt.Errorf("failed to remove secondary ip from eth0: %w", err)
+			log.Info("Removing secondary IP from host interface", "interface", r.hostInterfaceName(), "secondary_ip", address.IP.String())
+			if err := r.Netlink.AddrDel(hostInterface, &address); err != nil {
+				return fmt.Errorf("failed to remove secondary ip from %s: %w", r.hostInterfaceName(), err)
 			}
 		}
 	}
@@ -597,10 +897,11 @@ func (r *StaticGatewayConfigurationReconciler) configureGatewayNamespace(
 	privateKey *wgtypes.Key,
 	vmPrimaryIP string,
 	vmSecondaryIP string,
+	vmAdditionalSecondaryIPs ...string,
 ) error {
-	gwns, err := r.NetNS.GetNS(consts.GatewayNetnsName)
+	gwns, err := getOrCreateGatewayNetns(ctx, r.NetNS, getGatewayNetnsName(gwConfig, r.NetnsPerGateway), r.NetnsPerGateway)
 	if err != nil {
-		return fmt.Errorf("failed to get network namespace %s: %w", consts.GatewayNetnsName, err)
+		return err
 	}
 	defer gwns.Close()
 
@@ -608,10 +909,17 @@ func (r *StaticGatewayConfigurationReconciler) configureGatewayNamespace(
 		return err
 	}
 
-	if err := r.reconcileVethPair(ctx, gwns, vmPrimaryIP, vmSecondaryIP); err != nil {
+	vethName := getHostVethLinkName(gwConfig, r.NetnsPerGateway)
+	if err := r.reconcileVethPair(ctx, gwns, vethName, vmPrimaryIP, vmSecondaryIP); err != nil {
 		return err
 	}
 
+	for _, ip := range vmAdditionalSecondaryIPs {
+		if err := r.reconcileAdditionalSNATIP(ctx, gwns, vethName, ip); err != nil {
+			return err
+		}
+	}
+
 	return gwns.Do(func(nn ns.NetNS) error {
 		looplink, err := r.Netlink.LinkByName("lo")
 		if err != nil {
@@ -621,39 +929,301 @@ func (r *StaticGatewayConfigurationReconciler) configureGatewayNamespace(
 			return fmt.Errorf("failed to set lo up: %w", err)
 		}
 
-		linkName := getWireguardInterfaceName(gwConfig)
-		mark, err := getPacketMark(linkName)
-		if err != nil {
+		snatIPs := append([]string{vmSecondaryIP}, vmAdditionalSecondaryIPs...)
+		if err := r.ensureGatewayNamespaceSNAT(ctx, r.IPTables, getWireguardInterfaceName(gwConfig), getPreserveSourceIPCidrs(gwConfig, false), getPrivateCidrs(gwConfig, false), snatIPs...); err != nil {
 			return err
 		}
-		if err := r.ensureIPTablesChain(
-			ctx,
-			utiliptables.TableNAT,
-			utiliptables.Chain(fmt.Sprintf("EGRESS-GATEWAY-MARK-%d", mark)), // target chain
-			utiliptables.ChainPrerouting,                                    // source chain
-			fmt.Sprintf("kube-egress-gateway mark packets from gateway link %s", linkName),
-			[][]string{
-				{"-i", linkName, "-j", "CONNMARK", "--set-mark", fmt.Sprintf("%d", mark)},
-			}); err != nil {
+		if err := r.reconcileTCPMSSClamping(ctx, r.IPTables, gwConfig, consts.IPv4TCPHeaderSize); err != nil {
 			return err
 		}
+		return r.reconcileDestinationPortFilter(ctx, r.IPTables, gwConfig)
+	})
+}
 
-		if err := r.ensureIPTablesChain(
-			ctx,
-			utiliptables.TableNAT,
-			utiliptables.Chain(fmt.Sprintf("EGRESS-GATEWAY-SNAT-%d", mark)), // target chain
-			utiliptables.ChainPostrouting,                                   // source chain
-			fmt.Sprintf("kube-egress-gateway sNAT packets from gateway link %s", linkName),
-			[][]string{
-				{"-o", consts.HostLinkName, "-m", "connmark", "--mark", fmt.Sprintf("%d", mark), "-j", "SNAT", "--to-source", vmSecondaryIP},
-			}); err != nil {
+// reconcileAdditionalSNATIP routes an additional SNAT IP from host namespace to the gateway namespace
+// and assigns it to the host link there, the veth pair must have been created.
+func (r *StaticGatewayConfigurationReconciler) reconcileAdditionalSNATIP(
+	ctx context.Context,
+	gwns ns.NetNS,
+	vethName string,
+	snatIP string,
+) error {
+	mainLink, err := r.Netlink.LinkByName(vethName)
+	if err != nil {
+		return fmt.Errorf("failed to get veth link in host namespace: %w", err)
+	}
+	_, snatIPNet, err := net.ParseCIDR(snatIP + "/32")
+	if err != nil {
+		return fmt.Errorf("failed to parse SNAT IP %s: %w", snatIP+"/32", err)
+	}
+	if err := r.addOrReplaceRoute(ctx, &netlink.Route{
+		LinkIndex: mainLink.Attrs().Index,
+		Scope:     netlink.SCOPE_UNIVERSE,
+		Dst:       snatIPNet,
+	}); err != nil {
+		return fmt.Errorf("failed to create route to SNAT IP %s via gateway interface: %w", snatIP, err)
+	}
+
+	return gwns.Do(func(nn ns.NetNS) error {
+		hostLink, err := r.Netlink.LinkByName(consts.HostLinkName)
+		if err != nil {
+			return fmt.Errorf("failed to get host link in gateway namespace: %w", err)
+		}
+		if err := r.ensureLinkAddr(ctx, hostLink, snatIPNet); err != nil {
+			return fmt.Errorf("failed to add SNAT IP %s to host link in gateway namespace: %w", snatIP, err)
+		}
+		return nil
+	})
+}
+
+func (r *StaticGatewayConfigurationReconciler) configureGatewayNamespaceIPv6(
+	ctx context.Context,
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+	vmSecondaryIPv6 string,
+) error {
+	log := log.FromContext(ctx)
+	nsName := getGatewayNetnsName(gwConfig, r.NetnsPerGateway)
+	gwns, err := r.NetNS.GetNS(nsName)
+	if err != nil {
+		return fmt.Errorf("failed to get network namespace %s: %w", nsName, err)
+	}
+	defer gwns.Close()
+
+	// veth pair is already created when configuring ipv4
+	mainLink, err := r.Netlink.LinkByName(getHostVethLinkName(gwConfig, r.NetnsPerGateway))
+	if err != nil {
+		return fmt.Errorf("failed to get veth link in host namespace: %w", err)
+	}
+	vethIPNet := tunnel.HostVethIP(r.tunnelCidr())
+	if err := r.ensureLinkAddr(ctx, mainLink, vethIPNet); err != nil {
+		return fmt.Errorf("failed to add ipv6 link local address to veth link in host namespace: %w", err)
+	}
+
+	_, snatIPNet, err := net.ParseCIDR(vmSecondaryIPv6 + "/128")
+	if err != nil {
+		return fmt.Errorf("failed to parse SNAT IPv6 %s: %w", vmSecondaryIPv6+"/128", err)
+	}
+	if err := r.addOrReplaceRoute(ctx, &netlink.Route{
+		LinkIndex: mainLink.Attrs().Index,
+		Scope:     netlink.SCOPE_UNIVERSE,
+		Dst:       snatIPNet,
+	}); err != nil {
+		return fmt.Errorf("failed to create route to SNAT IPv6 %s via gateway interface: %w", vmSecondaryIPv6, err)
+	}
+
+	return gwns.Do(func(nn ns.NetNS) error {
+		hostLink, err := r.Netlink.LinkByName(consts.HostLinkName)
+		if err != nil {
+			return fmt.Errorf("failed to get host link in gateway namespace: %w", err)
+		}
+		if err := r.ensureLinkAddr(ctx, hostLink, snatIPNet); err != nil {
+			return fmt.Errorf("failed to add SNAT IPv6 to host link in gateway namespace: %w", err)
+		}
+
+		log.Info("Ensuring ipv6 default route in gateway namespace")
+		if err := r.addOrReplaceRoute(ctx, &netlink.Route{
+			LinkIndex: hostLink.Attrs().Index,
+			Scope:     netlink.SCOPE_UNIVERSE,
+			Dst:       nil,
+			Gw:        vethIPNet.IP,
+		}); err != nil {
+			return fmt.Errorf("failed to create ipv6 default route via %s: %w", vethIPNet.IP, err)
+		}
+
+		if err := r.ensureGatewayNamespaceSNAT(ctx, r.IP6Tables, getWireguardInterfaceName(gwConfig), getPreserveSourceIPCidrs(gwConfig, true), getPrivateCidrs(gwConfig, true), vmSecondaryIPv6); err != nil {
 			return err
 		}
+		if err := r.reconcileTCPMSSClamping(ctx, r.IP6Tables, gwConfig, consts.IPv6TCPHeaderSize); err != nil {
+			return err
+		}
+		return r.reconcileDestinationPortFilter(ctx, r.IP6Tables, gwConfig)
+	})
+}
 
-		return nil
+// reconcileTCPMSSClamping rewrites the MSS of TCP SYN packets forwarded from and to the wireguard link so that
+// segments of both directions fit in the wireguard MTU, or removes the rules when clamping is disabled. Must be
+// called in gateway namespace.
+func (r *StaticGatewayConfigurationReconciler) reconcileTCPMSSClamping(
+	ctx context.Context,
+	ipt utiliptables.Interface,
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+	headerSize int,
+) error {
+	linkName := getWireguardInterfaceName(gwConfig)
+	mark, err := getPacketMark(linkName)
+	if err != nil {
+		return err
+	}
+	chain := utiliptables.Chain(fmt.Sprintf("EGRESS-GATEWAY-MSS-%d", mark))
+	comment := fmt.Sprintf("kube-egress-gateway clamp tcp mss on gateway link %s", linkName)
+	if !gwConfig.Spec.EnableTcpMssClamping {
+		return r.removeIPTablesChains(ctx, ipt, utiliptables.TableMangle, []utiliptables.Chain{chain}, []utiliptables.Chain{utiliptables.ChainForward}, []string{comment})
+	}
+	mss := fmt.Sprintf("%d", getWireguardMtu(gwConfig)-headerSize)
+	return r.ensureIPTablesChain(ctx, ipt, utiliptables.TableMangle, chain, utiliptables.ChainForward, comment, [][]string{
+		{"-i", linkName, "-p", "tcp", "--tcp-flags", "SYN,RST", "SYN", "-j", "TCPMSS", "--set-mss", mss},
+		{"-o", linkName, "-p", "tcp", "--tcp-flags", "SYN,RST", "SYN", "-j", "TCPMSS", "--set-mss", mss},
 	})
 }
 
+// reconcileDestinationPortFilter drops TCP and UDP packets forwarded from the wireguard link to destination ports
+// not in allowedDestinationPorts or in deniedDestinationPorts, or removes the rules when neither is set so that all
+// ports are allowed. Must be called in gateway namespace.
+func (r *StaticGatewayConfigurationReconciler) reconcileDestinationPortFilter(
+	ctx context.Context,
+	ipt utiliptables.Interface,
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+) error {
+	linkName := getWireguardInterfaceName(gwConfig)
+	mark, err := getPacketMark(linkName)
+	if err != nil {
+		return err
+	}
+	chain := utiliptables.Chain(fmt.Sprintf("EGRESS-GATEWAY-PORTS-%d", mark))
+	comment := fmt.Sprintf("kube-egress-gateway filter destination ports on gateway link %s", linkName)
+	if len(gwConfig.Spec.AllowedDestinationPorts) == 0 && len(gwConfig.Spec.DeniedDestinationPorts) == 0 {
+		return r.removeIPTablesChains(ctx, ipt, utiliptables.TableFilter, []utiliptables.Chain{chain}, []utiliptables.Chain{utiliptables.ChainForward}, []string{comment})
+	}
+	return r.ensureIPTablesChain(ctx, ipt, utiliptables.TableFilter, chain, utiliptables.ChainForward, comment, getDestinationPortRules(linkName, mark, gwConfig))
+}
+
+// getDestinationPortRules returns rules of the destination port filter chain. Allowed ports return to the FORWARD
+// chain before the trailing drop rules, denied ports are dropped right away. Dropped packets are counted by the
+// drop rules and optionally logged with a rate limit, prefixed with the chain name.
+func getDestinationPortRules(linkName string, mark int, gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) [][]string {
+	drop := func(match ...string) [][]string {
+		var rules [][]string
+		if gwConfig.Spec.LogDroppedPackets {
+			rules = append(rules, append(append([]string{"-i", linkName}, match...),
+				"-m", "limit", "--limit", "10/minute", "-j", "LOG", "--log-prefix", fmt.Sprintf("EGRESS-GATEWAY-PORTS-%d:", mark)))
+		}
+		return append(rules, append(append([]string{"-i", linkName}, match...), "-j", "DROP"))
+	}
+
+	var rules [][]string
+	for _, protocol := range []string{"tcp", "udp"} {
+		if len(gwConfig.Spec.AllowedDestinationPorts) > 0 {
+			for _, port := range gwConfig.Spec.AllowedDestinationPorts {
+				rules = append(rules, []string{"-i", linkName, "-p", protocol, "--dport", strings.Replace(port, "-", ":", 1), "-j", "RETURN"})
+			}
+			rules = append(rules, drop("-p", protocol)...)
+			continue
+		}
+		for _, port := range gwConfig.Spec.DeniedDestinationPorts {
+			rules = append(rules, drop("-p", protocol, "--dport", strings.Replace(port, "-", ":", 1))...)
+		}
+	}
+	return rules
+}
+
+// ensureGatewayNamespaceSNAT marks packets coming from the wireguard link and sNATs them to the VM secondary IPs,
+// except packets to preserveSourceIPCidrs which keep the pod IP as source. Packets to privateCidrs are sNATed to
+// the first of snatIPs only. Must be called in gateway namespace.
+func (r *StaticGatewayConfigurationReconciler) ensureGatewayNamespaceSNAT(
+	ctx context.Context,
+	ipt utiliptables.Interface,
+	linkName string,
+	preserveSourceIPCidrs []string,
+	privateCidrs []string,
+	snatIPs ...string,
+) error {
+	mark, err := getPacketMark(linkName)
+	if err != nil {
+		return err
+	}
+	if err := r.ensureIPTablesChain(
+		ctx,
+		ipt,
+		utiliptables.TableNAT,
+		utiliptables.Chain(fmt.Sprintf("EGRESS-GATEWAY-MARK-%d", mark)), // target chain
+		utiliptables.ChainPrerouting,                                    // source chain
+		fmt.Sprintf("kube-egress-gateway mark packets from gateway link %s", linkName),
+		getMarkRules(linkName, mark, preserveSourceIPCidrs)); err != nil {
+		return err
+	}
+
+	return r.ensureIPTablesChain(
+		ctx,
+		ipt,
+		utiliptables.TableNAT,
+		utiliptables.Chain(fmt.Sprintf("EGRESS-GATEWAY-SNAT-%d", mark)), // target chain
+		utiliptables.ChainPostrouting,                                   // source chain
+		fmt.Sprintf("kube-egress-gateway sNAT packets from gateway link %s", linkName),
+		getSNATRules(mark, privateCidrs, snatIPs))
+}
+
+// getMarkRules marks connections from the wireguard link for sNAT. Connections to preserveSourceIPCidrs are left
+// unmarked, so that neither sNAT nor egress source IP rules, which all match the mark, apply to them.
+func getMarkRules(linkName string, mark int, preserveSourceIPCidrs []string) [][]string {
+	var rules [][]string
+	for _, cidr := range preserveSourceIPCidrs {
+		rules = append(rules, []string{"-i", linkName, "-d", cidr, "-j", "RETURN"})
+	}
+	return append(rules, []string{"-i", linkName, "-j", "CONNMARK", "--set-mark", fmt.Sprintf("%d", mark)})
+}
+
+// getPreserveSourceIPCidrs returns preserveSourceIpCidrs of gwConfig in the given IP family
+func getPreserveSourceIPCidrs(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration, ipv6 bool) []string {
+	return getCidrsOfFamily(gwConfig.Spec.PreserveSourceIpCidrs, ipv6)
+}
+
+// getPrivateCidrs returns privateCidrs of gwConfig in the given IP family, followed by the virtual network address
+// space unless snatVnetTraffic is set, so that resources in the virtual network see the gateway private IP as source
+func getPrivateCidrs(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration, ipv6 bool) []string {
+	cidrs := gwConfig.Spec.PrivateCidrs
+	if !gwConfig.Spec.SnatVnetTraffic {
+		cidrs = append(slices.Clone(cidrs), gwConfig.Status.VnetAddressSpace...)
+	}
+	return getCidrsOfFamily(cidrs, ipv6)
+}
+
+func getCidrsOfFamily(cidrList []string, ipv6 bool) []string {
+	var cidrs []string
+	for _, cidr := range cidrList {
+		if _, ipNet, err := net.ParseCIDR(cidr); err == nil && (ipNet.IP.To4() == nil) == ipv6 {
+			cidrs = append(cidrs, ipNet.String())
+		}
+	}
+	return cidrs
+}
+
+// getSNATRules spreads new connections across snatIPs in round robin. Rules in nat table only apply to the
+// first packet of a connection, so existing connections keep their source IP when more snatIPs are added.
+// Connections to privateCidrs always use the first snatIP, which is the VM secondary IP of the gateway.
+func getSNATRules(mark int, privateCidrs []string, snatIPs []string) [][]string {
+	var rules [][]string
+	if len(snatIPs) > 0 {
+		for _, cidr := range privateCidrs {
+			rules = append(rules, []string{"-o", consts.HostLinkName, "-d", cidr, "-m", "connmark", "--mark", fmt.Sprintf("%d", mark), "-j", "SNAT", "--to-source", snatIPs[0]})
+		}
+	}
+	for i, snatIP := range snatIPs {
+		rule := []string{"-o", consts.HostLinkName, "-m", "connmark", "--mark", fmt.Sprintf("%d", mark)}
+		if remaining := len(snatIPs) - i; remaining > 1 {
+			// the n-th remaining rule matches 1 of every n connections reaching it
+			rule = append(rule, "-m", "statistic", "--mode", "nth", "--every", fmt.Sprintf("%d", remaining), "--packet", "0")
+		}
+		rules = append(rules, append(rule, "-j", "SNAT", "--to-source", snatIP))
+	}
+	return rules
+}
+
+func (r *StaticGatewayConfigurationReconciler) ensureLinkAddr(ctx context.Context, link netlink.Link, ipNet *net.IPNet) error {
+	log := log.FromContext(ctx)
+	linkAddr := netlink.Addr{IPNet: ipNet}
+	addrs, err := r.Netlink.AddrList(link, nl.FAMILY_ALL)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve address list from link %s: %w", link.Attrs().Name, err)
+	}
+	for _, addr := range addrs {
+		if addr.Equal(linkAddr) {
+			return nil
+		}
+	}
+	log.Info("Adding link address", "link", link.Attrs().Name, "address", ipNet.String())
+	return r.Netlink.AddrAdd(link, &linkAddr)
+}
+
 func (r *StaticGatewayConfigurationReconciler) reconcileWireguardLink(
 	ctx context.Context,
 	gwns ns.NetNS,
@@ -689,9 +1259,8 @@ func (r *StaticGatewayConfigurationReconciler) reconcileWireguardLink(
 		if err != nil {
 			return fmt.Errorf("failed to get wireguard link in gateway namespace after creation: %w", err)
 		}
-		gwIP, _ := netlink.ParseIPNet(consts.GatewayIP)
 		gwLinkAddr := netlink.Addr{
-			IPNet: gwIP,
+			IPNet: tunnel.GatewayIP(r.tunnelCidr()),
 		}
 
 		wgLinkAddrs, err := r.Netlink.AddrList(wgLink, nl.FAMILY_ALL)
@@ -716,6 +1285,14 @@ func (r *StaticGatewayConfigurationReconciler) reconcileWireguardLink(
 			}
 		}
 
+		mtu := getWireguardMtu(gwConfig)
+		if wgLink.Attrs().MTU != mtu {
+			log.Info("Setting wireguard link mtu", "orig mtu", wgLink.Attrs().MTU, "cur mtu", mtu)
+			if err := r.Netlink.LinkSetMTU(wgLink, mtu); err != nil {
+				return fmt.Errorf("failed to set wireguard link mtu: %w", err)
+			}
+		}
+
 		err = r.Netlink.LinkSetUp(wgLink)
 		if err != nil {
 			return fmt.Errorf("failed to set wireguard link up: %w", err)
@@ -737,8 +1314,14 @@ func (r *StaticGatewayConfigurationReconciler) reconcileWireguardLink(
 			return fmt.Errorf("failed to get wireguard link configuration: %w", err)
 		}
 
-		if device.PrivateKey.String() != wgConfig.PrivateKey.String() || device.ListenPort != to.Val(wgConfig.ListenPort) {
+		if fwMark := getWireguardFwMark(gwConfig); device.FirewallMark != fwMark {
+			wgConfig.FirewallMark = to.Ptr(fwMark)
+		}
+
+		if device.PrivateKey.String() != wgConfig.PrivateKey.String() || device.ListenPort != to.Val(wgConfig.ListenPort) ||
+			wgConfig.FirewallMark != nil {
 			log.Info("Updating wireguard link config", "orig port", device.ListenPort, "cur port", to.Val(wgConfig.ListenPort),
+				"orig fwmark", device.FirewallMark, "cur fwmark", getWireguardFwMark(gwConfig),
 				"private key difference", device.PrivateKey.String() != wgConfig.PrivateKey.String())
 			err = wgClient.ConfigureDevice(linkName, wgConfig)
 			if err != nil {
@@ -781,11 +1364,12 @@ func (r *StaticGatewayConfigurationReconciler) createWireguardLink(gwns ns.NetNS
 func (r *StaticGatewayConfigurationReconciler) reconcileVethPair(
 	ctx context.Context,
 	gwns ns.NetNS,
+	vethName string,
 	vmPrimaryIP string,
 	vmSecondaryIP string,
 ) error {
 	log := log.FromContext(ctx)
-	if err := r.reconcileVethPairInHost(ctx, gwns, vmSecondaryIP); err != nil {
+	if err := r.reconcileVethPairInHost(ctx, gwns, vethName, vmSecondaryIP); err != nil {
 		return fmt.Errorf("failed to reconcile veth pair in host namespace: %w", err)
 	}
 
@@ -858,13 +1442,14 @@ func (r *StaticGatewayConfigurationReconciler) reconcileVethPair(
 func (r *StaticGatewayConfigurationReconciler) reconcileVethPairInHost(
 	ctx context.Context,
 	gwns ns.NetNS,
+	vethName string,
 	snatIP string,
 ) error {
 	log := log.FromContext(ctx)
 	succeed := false
 
 	la := netlink.NewLinkAttrs()
-	la.Name = consts.HostVethLinkName
+	la.Name = vethName
 
 	mainLink, err := r.Netlink.LinkByName(la.Name)
 	if _, ok := err.(netlink.LinkNotFoundError); ok {
@@ -953,8 +1538,106 @@ func (r *StaticGatewayConfigurationReconciler) addOrReplaceRoute(ctx context.Con
 	return nil
 }
 
+// reconcileEgressRouteRules ensures policy routing rules of the given priority sending traffic from snatIPs to
+// the gateway route table, which holds the default route of host interface only, 0 priority removes the rules
+func (r *StaticGatewayConfigurationReconciler) reconcileEgressRouteRules(ctx context.Context, snatIPs []string, priority int32) error {
+	log := log.FromContext(ctx)
+	if priority != 0 {
+		if err := r.ensureGatewayRouteTable(ctx); err != nil {
+			return err
+		}
+	}
+
+	rules, err := r.Netlink.RuleList(nl.FAMILY_V4)
+	if err != nil {
+		return fmt.Errorf("failed to list route rules: %w", err)
+	}
+	netlinkwrapper.SortRulesByPriority(rules)
+	foundRules := make(map[string]bool)
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Table != consts.GatewayRouteTable || rule.Src == nil || !slices.Contains(snatIPs, rule.Src.IP.String()) {
+			continue
+		}
+		if priority != 0 && rule.Priority == int(priority) {
+			foundRules[rule.Src.IP.String()] = true
+			continue
+		}
+		log.Info("Deleting egress route rule", "rule", rule.String())
+		if err := r.Netlink.RuleDel(rule); err != nil {
+			return fmt.Errorf("failed to delete route rule %s: %w", rule, err)
+		}
+	}
+	if priority == 0 {
+		return nil
+	}
+
+	for _, snatIP := range snatIPs {
+		if foundRules[snatIP] {
+			continue
+		}
+		_, srcIPNet, err := net.ParseCIDR(snatIP + "/32")
+		if err != nil {
+			return fmt.Errorf("failed to parse SNAT IP %s: %w", snatIP+"/32", err)
+		}
+		rule := netlink.NewRule()
+		rule.Family = nl.FAMILY_V4
+		rule.Src = srcIPNet
+		rule.Table = consts.GatewayRouteTable
+		rule.Priority = int(priority)
+		log.Info("Adding egress route rule", "rule", rule.String())
+		if err := r.Netlink.RuleAdd(rule); err != nil {
+			return fmt.Errorf("failed to add route rule %s: %w", rule, err)
+		}
+	}
+
+	// rules evaluated earlier still win, e.g. ones added by other agents for all sources
+	for _, rule := range rules {
+		if rule.Priority >= int(priority) {
+			break
+		}
+		if rule.Src == nil && rule.Table != unix.RT_TABLE_LOCAL {
+			log.Info("Route rule takes precedence over egress route rules", "rule", rule.String(), "priority", priority)
+		}
+	}
+	return nil
+}
+
+// ensureGatewayRouteTable copies the default route of host interface in the main table to the gateway route table
+func (r *StaticGatewayConfigurationReconciler) ensureGatewayRouteTable(ctx context.Context) error {
+	hostInterface, err := r.Netlink.LinkByName(r.hostInterfaceName())
+	if err != nil {
+		return fmt.Errorf("failed to retrieve link %s: %w", r.hostInterfaceName(), err)
+	}
+	routes, err := r.Netlink.RouteList(hostInterface, nl.FAMILY_V4)
+	if err != nil {
+		return fmt.Errorf("failed to list routes of %s: %w", r.hostInterfaceName(), err)
+	}
+	for _, route := range routes {
+		if route.Gw == nil || (route.Dst != nil && !isDefaultRouteDst(route.Dst)) {
+			continue
+		}
+		if err := r.Netlink.RouteReplace(&netlink.Route{
+			LinkIndex: hostInterface.Attrs().Index,
+			Scope:     netlink.SCOPE_UNIVERSE,
+			Gw:        route.Gw,
+			Table:     consts.GatewayRouteTable,
+		}); err != nil {
+			return fmt.Errorf("failed to add default route via %s to gateway route table: %w", route.Gw, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("default route of %s is not found", r.hostInterfaceName())
+}
+
+func isDefaultRouteDst(dst *net.IPNet) bool {
+	ones, _ := dst.Mask.Size()
+	return ones == 0
+}
+
 func (r *StaticGatewayConfigurationReconciler) ensureIPTablesChain(
 	ctx context.Context,
+	ipt utiliptables.Interface,
 	table utiliptables.Table,
 	targetChain utiliptables.Chain,
 	sourceChain utiliptables.Chain,
@@ -965,13 +1648,14 @@ func (r *StaticGatewayConfigurationReconciler) ensureIPTablesChain(
 
 	// ensure target chain exists
 	log.Info("Ensuring iptables chain", "table", table, "target chain", targetChain)
-	if _, err := r.IPTables.EnsureChain(table, targetChain); err != nil {
+	existed, err := ipt.EnsureChain(table, targetChain)
+	if err != nil {
 		return fmt.Errorf("failed to ensure chain %s in table %s: %w", targetChain, table, err)
 	}
 
 	// ensure jump rule exists, we use EnsureRule because we do not want to flush all rules in the source chain
 	log.Info("Ensuring jump rule", "source chain", sourceChain)
-	if _, err := r.IPTables.EnsureRule(utiliptables.Prepend, table, sourceChain, "-m", "comment", "--comment", jumpRuleComment, "-j", string(targetChain)); err != nil {
+	if _, err := ipt.EnsureRule(utiliptables.Prepend, table, sourceChain, "-m", "comment", "--comment", jumpRuleComment, "-j", string(targetChain)); err != nil {
 		return fmt.Errorf("failed to ensure jump rule from chain %s to chain %s in table %s: %w", sourceChain, targetChain, table, err)
 	}
 
@@ -987,15 +1671,52 @@ func (r *StaticGatewayConfigurationReconciler) ensureIPTablesChain(
 		writeRule(lines, string(utiliptables.Append), targetChain, rule...)
 	}
 	writeLine(lines, "COMMIT")
+
+	// restoring the chain resets packet counters of its rules, which are reported as gateway metrics, so skip it
+	// when the chain still has the rules restored last time
+	key := chainKey(ipt, table, targetChain)
+	if restored, ok := r.restoredChains.Load(key); ok && existed && restored.(string) == lines.String() {
+		count, err := countChainRules(ipt, table, targetChain)
+		if err != nil {
+			return err
+		}
+		if count == len(chainRules) {
+			return nil
+		}
+	}
 	log.Info("Restoring rules", "rules", lines.String())
-	if err := r.IPTables.RestoreAll(lines.Bytes(), utiliptables.NoFlushTables, utiliptables.NoRestoreCounters); err != nil {
+	if err := ipt.RestoreAll(lines.Bytes(), utiliptables.NoFlushTables, utiliptables.NoRestoreCounters); err != nil {
+		r.restoredChains.Delete(key)
 		return fmt.Errorf("failed to restore rules in chain %s in table %s: %w", targetChain, table, err)
 	}
+	r.restoredChains.Store(key, lines.String())
 	return nil
 }
 
+// chainKey identifies a chain restored by ensureIPTablesChain, chains of IPv4 and IPv6 share names
+func chainKey(ipt utiliptables.Interface, table utiliptables.Table, chain utiliptables.Chain) string {
+	return fmt.Sprintf("%t/%s/%s", ipt.IsIPv6(), table, chain)
+}
+
+// countChainRules returns the number of rules in the chain
+func countChainRules(ipt utiliptables.Interface, table utiliptables.Table, chain utiliptables.Chain) (int, error) {
+	iptablesData := bytes.NewBuffer(nil)
+	if err := ipt.SaveInto(table, iptablesData); err != nil {
+		return 0, fmt.Errorf("failed to save iptables data for table %s: %w", table, err)
+	}
+	prefix := []byte(fmt.Sprintf("-A %s ", chain))
+	count := 0
+	for _, line := range bytes.Split(iptablesData.Bytes(), []byte("\n")) {
+		if bytes.HasPrefix(line, prefix) {
+			count++
+		}
+	}
+	return count, nil
+}
+
 func (r *StaticGatewayConfigurationReconciler) removeIPTablesChains(
 	ctx context.Context,
+	ipt utiliptables.Interface,
 	table utiliptables.Table,
 	targetChains []utiliptables.Chain,
 	sourceChains []utiliptables.Chain,
@@ -1004,7 +1725,7 @@ func (r *StaticGatewayConfigurationReconciler) removeIPTablesChains(
 	log := log.FromContext(ctx)
 
 	iptablesData := bytes.NewBuffer(nil)
-	if err := r.IPTables.SaveInto(table, iptablesData); err != nil {
+	if err := ipt.SaveInto(table, iptablesData); err != nil {
 		return fmt.Errorf("failed to save iptables data for table %s: %w", table, err)
 	}
 
@@ -1015,7 +1736,7 @@ func (r *StaticGatewayConfigurationReconciler) removeIPTablesChains(
 		if _, ok := existingChains[targetChain]; ok {
 			// delete jump rule first
 			log.Info("Deleting jump rule", "source chain", sourceChain, "target chain", targetChain)
-			if err := r.IPTables.DeleteRule(table, sourceChain, "-m", "comment", "--comment", jumpRuleComment, "-j", string(targetChain)); err != nil {
+			if err := ipt.DeleteRule(table, sourceChain, "-m", "comment", "--comment", jumpRuleComment, "-j", string(targetChain)); err != nil {
 				return fmt.Errorf("failed to delete jump rule from chain %s to chain %s in table %s: %w", sourceChain, targetChain, table, err)
 			}
 
@@ -1025,9 +1746,10 @@ func (r *StaticGatewayConfigurationReconciler) removeIPTablesChains(
 			writeLine(lines, utiliptables.MakeChainLine(targetChain))
 			writeLine(lines, "-X", string(targetChain))
 			writeLine(lines, "COMMIT")
-			if err := r.IPTables.Restore(table, lines.Bytes(), utiliptables.NoFlushTables, utiliptables.NoRestoreCounters); err != nil {
+			if err := ipt.Restore(table, lines.Bytes(), utiliptables.NoFlushTables, utiliptables.NoRestoreCounters); err != nil {
 				return fmt.Errorf("failed to restore iptables table %s: %w", table, err)
 			}
+			r.restoredChains.Delete(chainKey(ipt, table, targetChain))
 		}
 	}
 	return nil
@@ -1088,6 +1810,10 @@ func (r *StaticGatewayConfigurationReconciler) updateGatewayNodeStatus(
 				if !add {
 					changed = true
 					gwStatus.Spec.ReadyGatewayConfigurations = append(gwStatus.Spec.ReadyGatewayConfigurations[:i], gwStatus.Spec.ReadyGatewayConfigurations[i+1:]...)
+				} else if !slices.Equal(gwConf.PublicIps, gwConfig.PublicIps) {
+					// public IPs are associated after the gateway prefix is provisioned
+					changed = true
+					gwStatus.Spec.ReadyGatewayConfigurations[i].PublicIps = gwConfig.PublicIps
 				}
 				found = true
 				break
@@ -1115,10 +1841,52 @@ func (r *StaticGatewayConfigurationReconciler) updateGatewayNodeStatus(
 	return nil
 }
 
+// isGatewayConfiguredOnNode returns whether gwConfig is recorded as ready in the gateway status of this node
+func (r *StaticGatewayConfigurationReconciler) isGatewayConfiguredOnNode(
+	ctx context.Context,
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+) (bool, error) {
+	gwStatusKey := types.NamespacedName{
+		Namespace: os.Getenv(consts.PodNamespaceEnvKey),
+		Name:      os.Getenv(consts.NodeNameEnvKey),
+	}
+	gwStatus := &egressgatewayv1alpha1.GatewayStatus{}
+	if err := r.Get(ctx, gwStatusKey, gwStatus); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get gateway status(%s/%s): %w", gwStatusKey.Namespace, gwStatusKey.Name, err)
+	}
+	name := fmt.Sprintf("%s/%s", gwConfig.Namespace, gwConfig.Name)
+	for _, gwConf := range gwStatus.Spec.ReadyGatewayConfigurations {
+		if gwConf.StaticGatewayConfiguration == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// tunnelCidr returns the subnet addressing gateway wireguard interfaces and host veth links
+func (r *StaticGatewayConfigurationReconciler) tunnelCidr() *net.IPNet {
+	if r.TunnelCidr == nil {
+		tunnelCidr, _ := tunnel.ParseCIDR(consts.DefaultTunnelCidr)
+		return tunnelCidr
+	}
+	return r.TunnelCidr
+}
+
 func getWireguardInterfaceName(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) string {
 	return consts.WiregaurdLinkNamePrefix + fmt.Sprintf("%d", gwConfig.Status.Port)
 }
 
+// getWireguardMtu returns the MTU of the wireguard link of the gateway
+func getWireguardMtu(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) int {
+	if gwConfig.Spec.Mtu != 0 {
+		return int(gwConfig.Spec.Mtu)
+	}
+	return int(consts.DefaultWireguardMtu)
+}
+
 func getPacketMark(linkName string) (int, error) {
 	mark, err := strconv.Atoi(strings.TrimPrefix(linkName, consts.WiregaurdLinkNamePrefix))
 	if err != nil {
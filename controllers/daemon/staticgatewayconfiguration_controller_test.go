@@ -14,6 +14,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/containernetworking/plugins/pkg/ns"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/vishvananda/netlink"
@@ -79,9 +80,11 @@ var _ = Describe("Daemon StaticGatewayConfiguration controller unit tests", func
 		mctrl := gomock.NewController(GinkgoT())
 		cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(objects...).Build()
 		r = &StaticGatewayConfigurationReconciler{Client: cl, LBProbeServer: healthprobe.NewLBProbeServer(1000)}
+		r.instanceMetadata = func() (*imds.InstanceMetadata, error) { return nodeMeta, nil }
 		r.Netlink = mocknetlinkwrapper.NewMockInterface(mctrl)
 		r.NetNS = mocknetnswrapper.NewMockInterface(mctrl)
 		r.IPTables = fakeiptables.NewFake()
+		r.IP6Tables = fakeiptables.NewIPv6Fake()
 		r.WgCtrl = mockwgctrlwrapper.NewMockInterface(mctrl)
 		mclient = mockwgctrlwrapper.NewMockClient(mctrl)
 	}
@@ -227,6 +230,19 @@ var _ = Describe("Daemon StaticGatewayConfiguration controller unit tests", func
 			Expect(got).To(Equal(expected))
 		})
 
+		It("should apply to nodes in any of the listed vmsses", func() {
+			Expect(applyToNode(gwConfig)).To(BeTrue())
+			gwConfig.Spec.GatewayVmssProfile = egressgatewayv1alpha1.GatewayVmssProfile{
+				Vmsses: []egressgatewayv1alpha1.VmssReference{
+					{VmssResourceGroup: "otherRG", VmssName: "otherVMSS"},
+					{VmssResourceGroup: strings.ToUpper(vmssRG), VmssName: vmssName},
+				},
+			}
+			Expect(applyToNode(gwConfig)).To(BeTrue())
+			gwConfig.Spec.GatewayVmssProfile.Vmsses = gwConfig.Spec.GatewayVmssProfile.Vmsses[:1]
+			Expect(applyToNode(gwConfig)).To(BeFalse())
+		})
+
 		It("should add ilb ip to eth0", func() {
 			mnl := r.Netlink.(*mocknetlinkwrapper.MockInterface)
 			eth0 := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth0"}}
@@ -274,7 +290,7 @@ var _ = Describe("Daemon StaticGatewayConfiguration controller unit tests", func
 		})
 
 		It("should retrieve vm ips", func() {
-			primaryIP, secondaryIP, err := r.getVMIP(context.TODO(), gwConfig)
+			primaryIP, secondaryIP, err := getVMIP(context.TODO(), r, gwConfig)
 			Expect(err).To(BeNil())
 			Expect(primaryIP).To(Equal("10.0.0.5"))
 			Expect(secondaryIP).To(Equal("10.0.0.6"))
@@ -361,7 +377,8 @@ var _ = Describe("Daemon StaticGatewayConfiguration controller unit tests", func
 				// add address to wg0
 				mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
 				mnl.EXPECT().AddrList(wg0, nl.FAMILY_ALL).Return([]netlink.Addr{}, nil),
-				mnl.EXPECT().AddrAdd(wg0, &netlink.Addr{IPNet: getIPNetWithActualIP(consts.GatewayIP)}),
+				mnl.EXPECT().AddrAdd(wg0, &netlink.Addr{IPNet: getIPNetWithActualIP("fe80::1/64")}),
+				mnl.EXPECT().LinkSetMTU(wg0, 1420).Return(nil),
 				mnl.EXPECT().LinkSetUp(wg0).Return(nil),
 				mwg.EXPECT().New().Return(mclient, nil),
 				mclient.EXPECT().Device("wg-6000").Return(device, nil),
@@ -401,6 +418,19 @@ var _ = Describe("Daemon StaticGatewayConfiguration controller unit tests", func
 			Expect(buf.String()).To(Equal(expectedDump))
 		})
 
+		It("should create network namespace of the gateway when each gateway has its own network namespace", func() {
+			r.NetnsPerGateway = true
+			pk, _ := wgtypes.ParseKey(privK)
+			mns := r.NetNS.(*mocknetnswrapper.MockInterface)
+			gomock.InOrder(
+				mns.EXPECT().GetNS("ns-static-egress-gateway-6000").Return(nil, ns.NSPathNotExistErr{}),
+				mns.EXPECT().NewNS("ns-static-egress-gateway-6000").Return(nil, fmt.Errorf("failed")),
+			)
+			err := r.configureGatewayNamespace(context.TODO(), gwConfig, &pk, "10.0.0.5", "10.0.0.6")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("failed to create network namespace ns-static-egress-gateway-6000"))
+		})
+
 		It("should not change anything when setup is complete", func() {
 			pk, _ := wgtypes.ParseKey(privK)
 			mnl := r.Netlink.(*mocknetlinkwrapper.MockInterface)
@@ -408,6 +438,7 @@ var _ = Describe("Daemon StaticGatewayConfiguration controller unit tests", func
 			mwg := r.WgCtrl.(*mockwgctrlwrapper.MockInterface)
 			la1, la2 := netlink.NewLinkAttrs(), netlink.NewLinkAttrs()
 			la1.Name = "wg-6000"
+			la1.MTU = 1420
 			la2.Name = "host-gateway"
 			wg0 := &netlink.Wireguard{LinkAttrs: la1}
 			veth := &netlink.Veth{LinkAttrs: la2, PeerName: "host0"}
@@ -421,7 +452,7 @@ var _ = Describe("Daemon StaticGatewayConfiguration controller unit tests", func
 				mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
 				// check address and wg config for wg0
 				mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
-				mnl.EXPECT().AddrList(wg0, nl.FAMILY_ALL).Return([]netlink.Addr{{IPNet: getIPNetWithActualIP(consts.GatewayIP)}}, nil),
+				mnl.EXPECT().AddrList(wg0, nl.FAMILY_ALL).Return([]netlink.Addr{{IPNet: getIPNetWithActualIP("fe80::1/64")}}, nil),
 				mnl.EXPECT().LinkSetUp(wg0).Return(nil),
 				mwg.EXPECT().New().Return(mclient, nil),
 				mclient.EXPECT().Device("wg-6000").Return(device, nil),
@@ -459,6 +490,31 @@ var _ = Describe("Daemon StaticGatewayConfiguration controller unit tests", func
 			Expect(buf.String()).To(Equal(expectedDump))
 		})
 
+		It("should update mtu of existing wireguard link", func() {
+			pk, _ := wgtypes.ParseKey(privK)
+			mnl := r.Netlink.(*mocknetlinkwrapper.MockInterface)
+			mwg := r.WgCtrl.(*mockwgctrlwrapper.MockInterface)
+			la1 := netlink.NewLinkAttrs()
+			la1.Name = "wg-6000"
+			la1.MTU = 1420
+			wg0 := &netlink.Wireguard{LinkAttrs: la1}
+			device := &wgtypes.Device{Name: "wg-6000", ListenPort: 6000, PrivateKey: pk}
+			gwns := &mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}
+			gwConfig.Spec.Mtu = 1380
+			gomock.InOrder(
+				mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+				mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+				mnl.EXPECT().AddrList(wg0, nl.FAMILY_ALL).Return([]netlink.Addr{{IPNet: getIPNetWithActualIP("fe80::1/64")}}, nil),
+				mnl.EXPECT().LinkSetMTU(wg0, 1380).Return(nil),
+				mnl.EXPECT().LinkSetUp(wg0).Return(nil),
+				mwg.EXPECT().New().Return(mclient, nil),
+				mclient.EXPECT().Device("wg-6000").Return(device, nil),
+				mclient.EXPECT().Close().Return(nil),
+			)
+			err := r.reconcileWireguardLink(context.TODO(), gwns, gwConfig, &pk)
+			Expect(err).To(BeNil())
+		})
+
 		It("should delete wireguard link if any setup fails", func() {
 			pk, _ := wgtypes.ParseKey(privK)
 			mnl := r.Netlink.(*mocknetlinkwrapper.MockInterface)
@@ -490,6 +546,7 @@ var _ = Describe("Daemon StaticGatewayConfiguration controller unit tests", func
 			mwg := r.WgCtrl.(*mockwgctrlwrapper.MockInterface)
 			la1, la2 := netlink.NewLinkAttrs(), netlink.NewLinkAttrs()
 			la1.Name = "wg-6000"
+			la1.MTU = 1420
 			la2.Name = "host-gateway"
 			wg0 := &netlink.Wireguard{LinkAttrs: la1}
 			veth := &netlink.Veth{LinkAttrs: la2, PeerName: "host0"}
@@ -501,7 +558,7 @@ var _ = Describe("Daemon StaticGatewayConfiguration controller unit tests", func
 				mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
 				// check address and wg config for wg0
 				mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
-				mnl.EXPECT().AddrList(wg0, nl.FAMILY_ALL).Return([]netlink.Addr{{IPNet: getIPNetWithActualIP(consts.GatewayIP)}}, nil),
+				mnl.EXPECT().AddrList(wg0, nl.FAMILY_ALL).Return([]netlink.Addr{{IPNet: getIPNetWithActualIP("fe80::1/64")}}, nil),
 				mnl.EXPECT().LinkSetUp(wg0).Return(nil),
 				mwg.EXPECT().New().Return(mclient, nil),
 				mclient.EXPECT().Device("wg-6000").Return(device, nil),
@@ -517,6 +574,422 @@ var _ = Describe("Daemon StaticGatewayConfiguration controller unit tests", func
 			Expect(errors.Unwrap(errors.Unwrap(err))).To(Equal(fmt.Errorf("failed")))
 		})
 
+		It("should configure ipv6 egress in gateway namespace", func() {
+			mnl := r.Netlink.(*mocknetlinkwrapper.MockInterface)
+			mns := r.NetNS.(*mocknetnswrapper.MockInterface)
+			la := netlink.NewLinkAttrs()
+			la.Name = "host-gateway"
+			veth := &netlink.Veth{LinkAttrs: la, PeerName: "host0"}
+			host0 := &netlink.Veth{}
+			gwns := &mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}
+			gomock.InOrder(
+				mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(gwns, nil),
+				// add link local address and route to SNAT IPv6 in host namespace
+				mnl.EXPECT().LinkByName("host-gateway").Return(veth, nil),
+				mnl.EXPECT().AddrList(veth, nl.FAMILY_ALL).Return([]netlink.Addr{}, nil),
+				mnl.EXPECT().AddrAdd(veth, &netlink.Addr{IPNet: getIPNetWithActualIP("fe80::2/64")}).Return(nil),
+				mnl.EXPECT().RouteList(nil, nl.FAMILY_ALL).Return([]netlink.Route{}, nil),
+				mnl.EXPECT().RouteReplace(&netlink.Route{LinkIndex: 0, Scope: netlink.SCOPE_UNIVERSE, Dst: getIPNet("2001:db8::6/128")}).Return(nil),
+				// add address and default route in gw namespace
+				mnl.EXPECT().LinkByName("host0").Return(host0, nil),
+				mnl.EXPECT().AddrList(host0, nl.FAMILY_ALL).Return([]netlink.Addr{}, nil),
+				mnl.EXPECT().AddrAdd(host0, &netlink.Addr{IPNet: getIPNet("2001:db8::6/128")}).Return(nil),
+				mnl.EXPECT().RouteList(nil, nl.FAMILY_ALL).Return([]netlink.Route{}, nil),
+				mnl.EXPECT().RouteReplace(&netlink.Route{LinkIndex: 0, Scope: netlink.SCOPE_UNIVERSE, Gw: net.ParseIP("fe80::2")}).Return(nil),
+			)
+			err := r.configureGatewayNamespaceIPv6(context.TODO(), gwConfig, "2001:db8::6")
+			Expect(err).To(BeNil())
+
+			fipt, ok := r.IP6Tables.(*fakeiptables.FakeIPTables)
+			Expect(ok).To(BeTrue())
+			buf := bytes.NewBuffer(nil)
+			Expect(fipt.SaveInto("nat", buf)).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("-A EGRESS-GATEWAY-SNAT-6000 -o host0 -m connmark --mark 6000 -j SNAT --to-source 2001:db8::6"))
+		})
+
+		It("should use the host veth address of the tunnel cidr as ipv6 default gateway", func() {
+			_, r.TunnelCidr, _ = net.ParseCIDR("fe80:0:0:ffff::/64")
+			mnl := r.Netlink.(*mocknetlinkwrapper.MockInterface)
+			mns := r.NetNS.(*mocknetnswrapper.MockInterface)
+			la := netlink.NewLinkAttrs()
+			la.Name = "host-gateway"
+			veth := &netlink.Veth{LinkAttrs: la, PeerName: "host0"}
+			host0 := &netlink.Veth{}
+			gwns := &mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}
+			gomock.InOrder(
+				mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(gwns, nil),
+				mnl.EXPECT().LinkByName("host-gateway").Return(veth, nil),
+				mnl.EXPECT().AddrList(veth, nl.FAMILY_ALL).Return([]netlink.Addr{}, nil),
+				mnl.EXPECT().AddrAdd(veth, &netlink.Addr{IPNet: getIPNetWithActualIP("fe80:0:0:ffff::2/64")}).Return(nil),
+				mnl.EXPECT().RouteList(nil, nl.FAMILY_ALL).Return([]netlink.Route{}, nil),
+				mnl.EXPECT().RouteReplace(&netlink.Route{LinkIndex: 0, Scope: netlink.SCOPE_UNIVERSE, Dst: getIPNet("2001:db8::6/128")}).Return(nil),
+				mnl.EXPECT().LinkByName("host0").Return(host0, nil),
+				mnl.EXPECT().AddrList(host0, nl.FAMILY_ALL).Return([]netlink.Addr{}, nil),
+				mnl.EXPECT().AddrAdd(host0, &netlink.Addr{IPNet: getIPNet("2001:db8::6/128")}).Return(nil),
+				mnl.EXPECT().RouteList(nil, nl.FAMILY_ALL).Return([]netlink.Route{}, nil),
+				mnl.EXPECT().RouteReplace(&netlink.Route{LinkIndex: 0, Scope: netlink.SCOPE_UNIVERSE, Gw: net.ParseIP("fe80:0:0:ffff::2")}).Return(nil),
+			)
+			Expect(r.configureGatewayNamespaceIPv6(context.TODO(), gwConfig, "2001:db8::6")).To(Succeed())
+		})
+
+		It("should retrieve additional vm secondary ips only when multiple public ip prefixes are requested", func() {
+			vmConfig := &egressgatewayv1alpha1.GatewayVMConfiguration{}
+			Expect(r.Get(context.TODO(), types.NamespacedName{Name: testName, Namespace: testNamespace}, vmConfig)).To(Succeed())
+			vmConfig.Status.GatewayVMProfiles[0].AdditionalSecondaryIPs = []string{"10.0.0.7", "10.0.0.8"}
+			Expect(r.Update(context.TODO(), vmConfig)).To(Succeed())
+
+			ips, err := r.getVMAdditionalSecondaryIPs(context.TODO(), gwConfig)
+			Expect(err).To(BeNil())
+			Expect(ips).To(BeEmpty())
+
+			gwConfig.Spec.PublicIpPrefixCount = 3
+			ips, err = r.getVMAdditionalSecondaryIPs(context.TODO(), gwConfig)
+			Expect(err).To(BeNil())
+			Expect(ips).To(Equal([]string{"10.0.0.7", "10.0.0.8"}))
+		})
+
+		It("should route additional SNAT IP to gateway namespace", func() {
+			mnl := r.Netlink.(*mocknetlinkwrapper.MockInterface)
+			la := netlink.NewLinkAttrs()
+			la.Name = "host-gateway"
+			veth := &netlink.Veth{LinkAttrs: la, PeerName: "host0"}
+			host0 := &netlink.Veth{}
+			gwns := &mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}
+			gomock.InOrder(
+				mnl.EXPECT().LinkByName("host-gateway").Return(veth, nil),
+				mnl.EXPECT().RouteList(nil, nl.FAMILY_ALL).Return([]netlink.Route{}, nil),
+				mnl.EXPECT().RouteReplace(&netlink.Route{LinkIndex: 0, Scope: netlink.SCOPE_UNIVERSE, Dst: getIPNet("10.0.0.7/32")}).Return(nil),
+				mnl.EXPECT().LinkByName("host0").Return(host0, nil),
+				mnl.EXPECT().AddrList(host0, nl.FAMILY_ALL).Return([]netlink.Addr{}, nil),
+				mnl.EXPECT().AddrAdd(host0, &netlink.Addr{IPNet: getIPNet("10.0.0.7/32")}).Return(nil),
+			)
+			err := r.reconcileAdditionalSNATIP(context.TODO(), gwns, consts.HostVethLinkName, "10.0.0.7")
+			Expect(err).To(BeNil())
+		})
+
+		Context("Test egress route rules", func() {
+			newRule := func(src string, priority int) *netlink.Rule {
+				rule := netlink.NewRule()
+				rule.Family = nl.FAMILY_V4
+				rule.Src = getIPNet(src)
+				rule.Table = consts.GatewayRouteTable
+				rule.Priority = priority
+				return rule
+			}
+			var mnl *mocknetlinkwrapper.MockInterface
+			var eth0 *netlink.Device
+			BeforeEach(func() {
+				mnl = r.Netlink.(*mocknetlinkwrapper.MockInterface)
+				eth0 = &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth0", Index: 2}}
+			})
+
+			It("should add rules for all SNAT IPs and default route to gateway route table", func() {
+				gomock.InOrder(
+					mnl.EXPECT().LinkByName("eth0").Return(eth0, nil),
+					mnl.EXPECT().RouteList(eth0, nl.FAMILY_V4).Return([]netlink.Route{
+						{LinkIndex: 2, Dst: getIPNet("10.0.0.0/24"), Scope: netlink.SCOPE_LINK},
+						{LinkIndex: 2, Gw: net.ParseIP("10.0.0.1")},
+					}, nil),
+					mnl.EXPECT().RouteReplace(&netlink.Route{LinkIndex: 2, Scope: netlink.SCOPE_UNIVERSE, Gw: net.ParseIP("10.0.0.1"), Table: consts.GatewayRouteTable}).Return(nil),
+					mnl.EXPECT().RuleList(nl.FAMILY_V4).Return([]netlink.Rule{}, nil),
+					mnl.EXPECT().RuleAdd(newRule("10.0.0.6/32", 100)).Return(nil),
+					mnl.EXPECT().RuleAdd(newRule("10.0.0.7/32", 100)).Return(nil),
+				)
+				err := r.reconcileEgressRouteRules(context.TODO(), []string{"10.0.0.6", "10.0.0.7"}, 100)
+				Expect(err).To(BeNil())
+			})
+
+			It("should replace rules with outdated priority and keep rules of other gateways", func() {
+				gomock.InOrder(
+					mnl.EXPECT().LinkByName("eth0").Return(eth0, nil),
+					mnl.EXPECT().RouteList(eth0, nl.FAMILY_V4).Return([]netlink.Route{{LinkIndex: 2, Gw: net.ParseIP("10.0.0.1")}}, nil),
+					mnl.EXPECT().RouteReplace(&netlink.Route{LinkIndex: 2, Scope: netlink.SCOPE_UNIVERSE, Gw: net.ParseIP("10.0.0.1"), Table: consts.GatewayRouteTable}).Return(nil),
+					mnl.EXPECT().RuleList(nl.FAMILY_V4).Return([]netlink.Rule{*newRule("10.0.0.8/32", 100), *newRule("10.0.0.6/32", 200)}, nil),
+					mnl.EXPECT().RuleDel(newRule("10.0.0.6/32", 200)).Return(nil),
+					mnl.EXPECT().RuleAdd(newRule("10.0.0.6/32", 100)).Return(nil),
+				)
+				err := r.reconcileEgressRouteRules(context.TODO(), []string{"10.0.0.6"}, 100)
+				Expect(err).To(BeNil())
+			})
+
+			It("should only remove rules when priority is not specified", func() {
+				gomock.InOrder(
+					mnl.EXPECT().RuleList(nl.FAMILY_V4).Return([]netlink.Rule{*newRule("10.0.0.6/32", 100)}, nil),
+					mnl.EXPECT().RuleDel(newRule("10.0.0.6/32", 100)).Return(nil),
+				)
+				err := r.reconcileEgressRouteRules(context.TODO(), []string{"10.0.0.6"}, 0)
+				Expect(err).To(BeNil())
+			})
+
+			It("should report error when eth0 has no default route", func() {
+				gomock.InOrder(
+					mnl.EXPECT().LinkByName("eth0").Return(eth0, nil),
+					mnl.EXPECT().RouteList(eth0, nl.FAMILY_V4).Return([]netlink.Route{{LinkIndex: 2, Dst: getIPNet("10.0.0.0/24")}}, nil),
+				)
+				err := r.reconcileEgressRouteRules(context.TODO(), []string{"10.0.0.6"}, 100)
+				Expect(err).To(MatchError("default route of eth0 is not found"))
+			})
+		})
+
+		Context("Test wireguard fwmark", func() {
+			var mnl *mocknetlinkwrapper.MockInterface
+			BeforeEach(func() {
+				mnl = r.Netlink.(*mocknetlinkwrapper.MockInterface)
+				gwConfig.Spec.WireguardFwMark = &egressgatewayv1alpha1.WireguardFwMark{Mark: 100, RouteTable: 200}
+			})
+
+			It("should apply fwmark to wireguard device", func() {
+				pk, _ := wgtypes.ParseKey(privK)
+				mwg := r.WgCtrl.(*mockwgctrlwrapper.MockInterface)
+				la1 := netlink.NewLinkAttrs()
+				la1.Name = "wg-6000"
+				la1.MTU = 1420
+				wg0 := &netlink.Wireguard{LinkAttrs: la1}
+				device := &wgtypes.Device{Name: "wg-6000", ListenPort: 6000, PrivateKey: pk}
+				gwns := &mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}
+				gomock.InOrder(
+					mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+					mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+					mnl.EXPECT().AddrList(wg0, nl.FAMILY_ALL).Return([]netlink.Addr{{IPNet: getIPNetWithActualIP("fe80::1/64")}}, nil),
+					mnl.EXPECT().LinkSetUp(wg0).Return(nil),
+					mwg.EXPECT().New().Return(mclient, nil),
+					mclient.EXPECT().Device("wg-6000").Return(device, nil),
+					mclient.EXPECT().ConfigureDevice("wg-6000", wgtypes.Config{ListenPort: to.Ptr[int](6000), PrivateKey: &pk, FirewallMark: to.Ptr(100)}).Return(nil),
+					mclient.EXPECT().Close().Return(nil),
+				)
+				err := r.reconcileWireguardLink(context.TODO(), gwns, gwConfig, &pk)
+				Expect(err).To(BeNil())
+			})
+
+			It("should clear fwmark of wireguard device when unset", func() {
+				pk, _ := wgtypes.ParseKey(privK)
+				mwg := r.WgCtrl.(*mockwgctrlwrapper.MockInterface)
+				la1 := netlink.NewLinkAttrs()
+				la1.Name = "wg-6000"
+				la1.MTU = 1420
+				wg0 := &netlink.Wireguard{LinkAttrs: la1}
+				device := &wgtypes.Device{Name: "wg-6000", ListenPort: 6000, PrivateKey: pk, FirewallMark: 100}
+				gwns := &mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}
+				gwConfig.Spec.WireguardFwMark = nil
+				gomock.InOrder(
+					mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+					mnl.EXPECT().LinkByName("wg-6000").Return(wg0, nil),
+					mnl.EXPECT().AddrList(wg0, nl.FAMILY_ALL).Return([]netlink.Addr{{IPNet: getIPNetWithActualIP("fe80::1/64")}}, nil),
+					mnl.EXPECT().LinkSetUp(wg0).Return(nil),
+					mwg.EXPECT().New().Return(mclient, nil),
+					mclient.EXPECT().Device("wg-6000").Return(device, nil),
+					mclient.EXPECT().ConfigureDevice("wg-6000", wgtypes.Config{ListenPort: to.Ptr[int](6000), PrivateKey: &pk, FirewallMark: to.Ptr(0)}).Return(nil),
+					mclient.EXPECT().Close().Return(nil),
+				)
+				err := r.reconcileWireguardLink(context.TODO(), gwns, gwConfig, &pk)
+				Expect(err).To(BeNil())
+			})
+
+			It("should add fwmark rule and replace rule with outdated route table", func() {
+				gomock.InOrder(
+					mnl.EXPECT().RuleList(nl.FAMILY_V4).Return([]netlink.Rule{*getWireguardFwMarkRule(100, 300), *getWireguardFwMarkRule(101, 300)}, nil),
+					mnl.EXPECT().RuleDel(getWireguardFwMarkRule(100, 300)).Return(nil),
+					mnl.EXPECT().RuleAdd(getWireguardFwMarkRule(100, 200)).Return(nil),
+				)
+				err := r.reconcileWireguardFwMarkRule(context.TODO(), gwConfig)
+				Expect(err).To(BeNil())
+			})
+
+			It("should not add fwmark rule when it exists or route table is not specified", func() {
+				mnl.EXPECT().RuleList(nl.FAMILY_V4).Return([]netlink.Rule{*getWireguardFwMarkRule(100, 200)}, nil)
+				Expect(r.reconcileWireguardFwMarkRule(context.TODO(), gwConfig)).To(Succeed())
+
+				gwConfig.Spec.WireguardFwMark.RouteTable = 0
+				Expect(r.reconcileWireguardFwMarkRule(context.TODO(), gwConfig)).To(Succeed())
+			})
+
+			It("should only remove fwmark rules it set that are not wanted by active gateways", func() {
+				r.wireguardFwMarks.Store(100, struct{}{})
+				r.wireguardFwMarks.Store(101, struct{}{})
+				other := netlink.NewRule()
+				other.Mark = 300
+				other.Table = 300
+				other.Priority = 100
+				// a rule of another agent at the same priority
+				foreign := getWireguardFwMarkRule(102, 202)
+				gomock.InOrder(
+					mnl.EXPECT().RuleList(nl.FAMILY_V4).Return([]netlink.Rule{*getWireguardFwMarkRule(100, 200), *getWireguardFwMarkRule(101, 201), *other, *foreign}, nil),
+					mnl.EXPECT().RuleDel(getWireguardFwMarkRule(101, 201)).Return(nil),
+				)
+				err := r.cleanUpWireguardFwMarkRules(context.TODO(), map[string]struct{}{getWireguardFwMarkRuleKey(100, 200): {}})
+				Expect(err).To(BeNil())
+				_, ok := r.wireguardFwMarks.Load(101)
+				Expect(ok).To(BeFalse())
+				_, ok = r.wireguardFwMarks.Load(100)
+				Expect(ok).To(BeTrue())
+			})
+
+			It("should not touch route rules when it set no fwmark rule", func() {
+				Expect(r.cleanUpWireguardFwMarkRules(context.TODO(), map[string]struct{}{})).To(Succeed())
+			})
+
+			It("should record the mark of fwmark rules it set", func() {
+				mnl.EXPECT().RuleList(nl.FAMILY_V4).Return(nil, nil)
+				mnl.EXPECT().RuleAdd(getWireguardFwMarkRule(100, 200)).Return(nil)
+				Expect(r.reconcileWireguardFwMarkRule(context.TODO(), gwConfig)).To(Succeed())
+				_, ok := r.wireguardFwMarks.Load(100)
+				Expect(ok).To(BeTrue())
+			})
+		})
+
+		It("should spread sNAT across all secondary ips", func() {
+			err := r.ensureGatewayNamespaceSNAT(context.TODO(), r.IPTables, "wg-6000", nil, nil, "10.0.0.6", "10.0.0.7", "10.0.0.8")
+			Expect(err).To(BeNil())
+
+			fipt, ok := r.IPTables.(*fakeiptables.FakeIPTables)
+			Expect(ok).To(BeTrue())
+			buf := bytes.NewBuffer(nil)
+			Expect(fipt.SaveInto("nat", buf)).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("-A EGRESS-GATEWAY-SNAT-6000 -o host0 -m connmark --mark 6000 -m statistic --mode nth --every 3 --packet 0 -j SNAT --to-source 10.0.0.6\n" +
+				"-A EGRESS-GATEWAY-SNAT-6000 -o host0 -m connmark --mark 6000 -m statistic --mode nth --every 2 --packet 0 -j SNAT --to-source 10.0.0.7\n" +
+				"-A EGRESS-GATEWAY-SNAT-6000 -o host0 -m connmark --mark 6000 -j SNAT --to-source 10.0.0.8\n"))
+		})
+
+		It("should sNAT connections to private cidrs to the vm secondary ip only", func() {
+			gwConfig.Spec.PrivateCidrs = []string{"10.1.0.0/24", "fd00::/64"}
+			err := r.ensureGatewayNamespaceSNAT(context.TODO(), r.IPTables, "wg-6000", nil, getPrivateCidrs(gwConfig, false), "10.0.0.6", "10.0.0.7")
+			Expect(err).To(BeNil())
+
+			fipt, ok := r.IPTables.(*fakeiptables.FakeIPTables)
+			Expect(ok).To(BeTrue())
+			buf := bytes.NewBuffer(nil)
+			Expect(fipt.SaveInto("nat", buf)).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("-A EGRESS-GATEWAY-SNAT-6000 -o host0 -d 10.1.0.0/24 -m connmark --mark 6000 -j SNAT --to-source 10.0.0.6\n" +
+				"-A EGRESS-GATEWAY-SNAT-6000 -o host0 -m connmark --mark 6000 -m statistic --mode nth --every 2 --packet 0 -j SNAT --to-source 10.0.0.6\n" +
+				"-A EGRESS-GATEWAY-SNAT-6000 -o host0 -m connmark --mark 6000 -j SNAT --to-source 10.0.0.7\n"))
+			Expect(getPrivateCidrs(gwConfig, true)).To(Equal([]string{"fd00::/64"}))
+		})
+
+		It("should sNAT connections to the virtual network to the vm secondary ip unless disabled", func() {
+			gwConfig.Spec.PrivateCidrs = []string{"10.1.0.0/24"}
+			gwConfig.Status.VnetAddressSpace = []string{"10.0.0.0/16", "fd00::/48"}
+			Expect(getPrivateCidrs(gwConfig, false)).To(Equal([]string{"10.1.0.0/24", "10.0.0.0/16"}))
+			Expect(getPrivateCidrs(gwConfig, true)).To(Equal([]string{"fd00::/48"}))
+			err := r.ensureGatewayNamespaceSNAT(context.TODO(), r.IPTables, "wg-6000", nil, getPrivateCidrs(gwConfig, false), "10.0.0.6", "10.0.0.7")
+			Expect(err).To(BeNil())
+
+			fipt, ok := r.IPTables.(*fakeiptables.FakeIPTables)
+			Expect(ok).To(BeTrue())
+			buf := bytes.NewBuffer(nil)
+			Expect(fipt.SaveInto("nat", buf)).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("-A EGRESS-GATEWAY-SNAT-6000 -o host0 -d 10.1.0.0/24 -m connmark --mark 6000 -j SNAT --to-source 10.0.0.6\n" +
+				"-A EGRESS-GATEWAY-SNAT-6000 -o host0 -d 10.0.0.0/16 -m connmark --mark 6000 -j SNAT --to-source 10.0.0.6\n" +
+				"-A EGRESS-GATEWAY-SNAT-6000 -o host0 -m connmark --mark 6000 -m statistic --mode nth --every 2 --packet 0 -j SNAT --to-source 10.0.0.6\n"))
+
+			gwConfig.Spec.SnatVnetTraffic = true
+			Expect(getPrivateCidrs(gwConfig, false)).To(Equal([]string{"10.1.0.0/24"}))
+			Expect(getPrivateCidrs(gwConfig, true)).To(BeEmpty())
+			Expect(gwConfig.Spec.PrivateCidrs).To(Equal([]string{"10.1.0.0/24"}))
+		})
+
+		It("should clamp tcp mss to the wireguard mtu only when enabled", func() {
+			getMangleTable := func(ipt utiliptables.Interface) string {
+				buf := bytes.NewBuffer(nil)
+				Expect(ipt.SaveInto(utiliptables.TableMangle, buf)).NotTo(HaveOccurred())
+				return buf.String()
+			}
+			gwConfig.Spec.Mtu = 1380
+			gwConfig.Spec.EnableTcpMssClamping = true
+			Expect(r.reconcileTCPMSSClamping(context.TODO(), r.IPTables, gwConfig, consts.IPv4TCPHeaderSize)).To(Succeed())
+			Expect(r.reconcileTCPMSSClamping(context.TODO(), r.IP6Tables, gwConfig, consts.IPv6TCPHeaderSize)).To(Succeed())
+			Expect(getMangleTable(r.IPTables)).To(ContainSubstring("-A FORWARD -m comment --comment kube-egress-gateway clamp tcp mss on gateway link wg-6000 -j EGRESS-GATEWAY-MSS-6000\n" +
+				"-A EGRESS-GATEWAY-MSS-6000 -i wg-6000 -p tcp --tcp-flags SYN,RST SYN -j TCPMSS --set-mss 1340\n" +
+				"-A EGRESS-GATEWAY-MSS-6000 -o wg-6000 -p tcp --tcp-flags SYN,RST SYN -j TCPMSS --set-mss 1340\n"))
+			Expect(getMangleTable(r.IP6Tables)).To(ContainSubstring("-A EGRESS-GATEWAY-MSS-6000 -i wg-6000 -p tcp --tcp-flags SYN,RST SYN -j TCPMSS --set-mss 1320\n"))
+
+			gwConfig.Spec.EnableTcpMssClamping = false
+			Expect(r.reconcileTCPMSSClamping(context.TODO(), r.IPTables, gwConfig, consts.IPv4TCPHeaderSize)).To(Succeed())
+			Expect(getMangleTable(r.IPTables)).NotTo(ContainSubstring("EGRESS-GATEWAY-MSS-6000"))
+		})
+
+		Context("Test destination port filter", func() {
+			getFilterTable := func(ipt utiliptables.Interface) string {
+				buf := bytes.NewBuffer(nil)
+				Expect(ipt.SaveInto(utiliptables.TableFilter, buf)).NotTo(HaveOccurred())
+				return buf.String()
+			}
+
+			It("should not filter any port when unset", func() {
+				Expect(r.reconcileDestinationPortFilter(context.TODO(), r.IPTables, gwConfig)).To(Succeed())
+				Expect(getFilterTable(r.IPTables)).NotTo(ContainSubstring("EGRESS-GATEWAY-PORTS-6000"))
+			})
+
+			It("should only allow allowed destination ports", func() {
+				gwConfig.Spec.AllowedDestinationPorts = []string{"443", "8000-8080"}
+				Expect(r.reconcileDestinationPortFilter(context.TODO(), r.IPTables, gwConfig)).To(Succeed())
+				Expect(r.reconcileDestinationPortFilter(context.TODO(), r.IP6Tables, gwConfig)).To(Succeed())
+				for _, ipt := range []utiliptables.Interface{r.IPTables, r.IP6Tables} {
+					Expect(getFilterTable(ipt)).To(ContainSubstring("-A FORWARD -m comment --comment kube-egress-gateway filter destination ports on gateway link wg-6000 -j EGRESS-GATEWAY-PORTS-6000\n" +
+						"-A EGRESS-GATEWAY-PORTS-6000 -i wg-6000 -p tcp --dport 443 -j RETURN\n" +
+						"-A EGRESS-GATEWAY-PORTS-6000 -i wg-6000 -p tcp --dport 8000:8080 -j RETURN\n" +
+						"-A EGRESS-GATEWAY-PORTS-6000 -i wg-6000 -p tcp -j DROP\n" +
+						"-A EGRESS-GATEWAY-PORTS-6000 -i wg-6000 -p udp --dport 443 -j RETURN\n" +
+						"-A EGRESS-GATEWAY-PORTS-6000 -i wg-6000 -p udp --dport 8000:8080 -j RETURN\n" +
+						"-A EGRESS-GATEWAY-PORTS-6000 -i wg-6000 -p udp -j DROP\n"))
+				}
+
+				gwConfig.Spec.AllowedDestinationPorts = nil
+				Expect(r.reconcileDestinationPortFilter(context.TODO(), r.IPTables, gwConfig)).To(Succeed())
+				Expect(getFilterTable(r.IPTables)).NotTo(ContainSubstring("EGRESS-GATEWAY-PORTS-6000"))
+			})
+
+			It("should drop denied destination ports", func() {
+				gwConfig.Spec.DeniedDestinationPorts = []string{"25"}
+				Expect(r.reconcileDestinationPortFilter(context.TODO(), r.IPTables, gwConfig)).To(Succeed())
+				table := getFilterTable(r.IPTables)
+				Expect(table).To(ContainSubstring("-A EGRESS-GATEWAY-PORTS-6000 -i wg-6000 -p tcp --dport 25 -j DROP\n" +
+					"-A EGRESS-GATEWAY-PORTS-6000 -i wg-6000 -p udp --dport 25 -j DROP\n"))
+				Expect(table).NotTo(ContainSubstring("RETURN"))
+				Expect(table).NotTo(ContainSubstring("LOG"))
+			})
+
+			It("should log dropped packets when enabled", func() {
+				gwConfig.Spec.DeniedDestinationPorts = []string{"6660-6669"}
+				gwConfig.Spec.LogDroppedPackets = true
+				Expect(r.reconcileDestinationPortFilter(context.TODO(), r.IPTables, gwConfig)).To(Succeed())
+				Expect(getFilterTable(r.IPTables)).To(ContainSubstring("-A EGRESS-GATEWAY-PORTS-6000 -i wg-6000 -p tcp --dport 6660:6669 -m limit --limit 10/minute -j LOG --log-prefix EGRESS-GATEWAY-PORTS-6000:\n" +
+					"-A EGRESS-GATEWAY-PORTS-6000 -i wg-6000 -p tcp --dport 6660:6669 -j DROP\n"))
+			})
+
+			It("should only restore the chain when its rules change to keep drop counters", func() {
+				ipt := &restoreCountingIPTables{Interface: r.IPTables}
+				gwConfig.Spec.DeniedDestinationPorts = []string{"25"}
+				Expect(r.reconcileDestinationPortFilter(context.TODO(), ipt, gwConfig)).To(Succeed())
+				Expect(r.reconcileDestinationPortFilter(context.TODO(), ipt, gwConfig)).To(Succeed())
+				Expect(ipt.restores).To(Equal(1))
+
+				gwConfig.Spec.DeniedDestinationPorts = []string{"25", "465"}
+				Expect(r.reconcileDestinationPortFilter(context.TODO(), ipt, gwConfig)).To(Succeed())
+				Expect(ipt.restores).To(Equal(2))
+				Expect(getFilterTable(ipt)).To(ContainSubstring("-A EGRESS-GATEWAY-PORTS-6000 -i wg-6000 -p tcp --dport 465 -j DROP\n"))
+
+				// rules removed by someone else are restored
+				Expect(ipt.FlushChain(utiliptables.TableFilter, utiliptables.Chain("EGRESS-GATEWAY-PORTS-6000"))).To(Succeed())
+				Expect(r.reconcileDestinationPortFilter(context.TODO(), ipt, gwConfig)).To(Succeed())
+				Expect(ipt.restores).To(Equal(3))
+				Expect(getFilterTable(ipt)).To(ContainSubstring("-A EGRESS-GATEWAY-PORTS-6000 -i wg-6000 -p tcp --dport 465 -j DROP\n"))
+			})
+		})
+
+		It("should not mark connections to preserved source ip cidrs", func() {
+			gwConfig.Spec.PreserveSourceIpCidrs = []string{"192.168.0.0/16", "fd00::/64", "invalid"}
+			err := r.ensureGatewayNamespaceSNAT(context.TODO(), r.IPTables, "wg-6000", getPreserveSourceIPCidrs(gwConfig, false), nil, "10.0.0.6")
+			Expect(err).To(BeNil())
+
+			fipt, ok := r.IPTables.(*fakeiptables.FakeIPTables)
+			Expect(ok).To(BeTrue())
+			buf := bytes.NewBuffer(nil)
+			Expect(fipt.SaveInto("nat", buf)).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("-A EGRESS-GATEWAY-MARK-6000 -i wg-6000 -d 192.168.0.0/16 -j RETURN\n" +
+				"-A EGRESS-GATEWAY-MARK-6000 -i wg-6000 -j CONNMARK --set-mark 6000\n"))
+			Expect(getPreserveSourceIPCidrs(gwConfig, true)).To(Equal([]string{"fd00::/64"}))
+		})
+
 		Context("Test updating gateway node status", func() {
 			BeforeEach(func() {
 				os.Setenv(consts.PodNamespaceEnvKey, testPodNamespace)
@@ -718,6 +1191,9 @@ var _ = Describe("Daemon StaticGatewayConfiguration controller unit tests", func
 			gwns := &mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}
 			linkToDel := &netlink.Wireguard{LinkAttrs: netlink.LinkAttrs{Name: "wg-6001", Alias: "deletingUID"}}
 			routeToDel := netlink.Route{LinkIndex: 0, Scope: netlink.SCOPE_UNIVERSE, Dst: getIPNet("10.0.0.7/32")}
+			ruleToKeep, ruleToDel := *netlink.NewRule(), *netlink.NewRule()
+			ruleToKeep.Src, ruleToKeep.Table, ruleToKeep.Priority = getIPNet("10.0.0.6/32"), consts.GatewayRouteTable, 100
+			ruleToDel.Src, ruleToDel.Table, ruleToDel.Priority = getIPNet("10.0.0.7/32"), consts.GatewayRouteTable, 100
 
 			// create existing iptables rules first
 			existingHostDump := getHostNamespaceIptablesDump("10.0.0.6", "10.0.0.7")
@@ -726,6 +1202,16 @@ var _ = Describe("Daemon StaticGatewayConfiguration controller unit tests", func
 			Expect(ok).To(BeTrue())
 			Expect(fipt.RestoreAll([]byte(existingHostDump), utiliptables.NoFlushTables, utiliptables.NoRestoreCounters)).NotTo(HaveOccurred())
 			Expect(fipt.RestoreAll([]byte(existingGWDump), utiliptables.NoFlushTables, utiliptables.NoRestoreCounters)).NotTo(HaveOccurred())
+			_, err := fipt.EnsureChain(utiliptables.TableMangle, "EGRESS-GATEWAY-DSCP-6001")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = fipt.EnsureRule(utiliptables.Prepend, utiliptables.TableMangle, utiliptables.ChainForward,
+				"-m", "comment", "--comment", "kube-egress-gateway mark dscp of pods on gateway link wg-6001", "-j", "EGRESS-GATEWAY-DSCP-6001")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = fipt.EnsureChain(utiliptables.TableNAT, "EGRESS-GATEWAY-SNATPORTS-6001")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = fipt.EnsureRule(utiliptables.Prepend, utiliptables.TableNAT, utiliptables.ChainPostrouting,
+				"-m", "comment", "--comment", "kube-egress-gateway pin sNAT ports of pods on gateway link wg-6001", "-j", "EGRESS-GATEWAY-SNATPORTS-6001")
+			Expect(err).NotTo(HaveOccurred())
 
 			// add ActiveGateways
 			Expect(r.LBProbeServer.AddGateway("deletingUID")).To(Succeed())
@@ -748,13 +1234,16 @@ var _ = Describe("Daemon StaticGatewayConfiguration controller unit tests", func
 					routeToDel,
 				}, nil),
 				mnl.EXPECT().RouteDel(&routeToDel).Return(nil),
+				mnl.EXPECT().RuleList(nl.FAMILY_V4).Return([]netlink.Rule{ruleToKeep, ruleToDel}, nil),
+				mnl.EXPECT().RuleDel(&ruleToDel).Return(nil),
 				mnl.EXPECT().LinkDel(linkToDel).Return(nil),
+				mnl.EXPECT().LinkList().Return([]netlink.Link{&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth0"}}}, nil),
 			)
 			res, reconcileErr = r.Reconcile(context.TODO(), req)
 			Expect(reconcileErr).To(BeNil())
 			Expect(res).To(Equal(ctrl.Result{}))
 			gwStatus := &egressgatewayv1alpha1.GatewayStatus{}
-			err := getGatewayStatus(r.Client, gwStatus)
+			err = getGatewayStatus(r.Client, gwStatus)
 			Expect(err).To(BeNil())
 			Expect(len(gwStatus.Spec.ReadyGatewayConfigurations)).To(Equal(1))
 			Expect(len(gwStatus.Spec.ReadyPeerConfigurations)).To(Equal(1))
@@ -769,10 +1258,62 @@ var _ = Describe("Daemon StaticGatewayConfiguration controller unit tests", func
 			existingBuf := bytes.NewBuffer(nil)
 			Expect(fipt.SaveInto("nat", existingBuf)).NotTo(HaveOccurred())
 			Expect(existingBuf.String()).To(Equal(expectedBuf.String()))
+			mangleBuf := bytes.NewBuffer(nil)
+			Expect(fipt.SaveInto("mangle", mangleBuf)).NotTo(HaveOccurred())
+			Expect(mangleBuf.String()).NotTo(ContainSubstring("EGRESS-GATEWAY-DSCP-6001"))
 
 			Expect(r.LBProbeServer.GetGateways()).To(Equal([]string{"notDeletingUID"}))
 		})
 
+		It("should clean up gateway when node's vmss is removed from the gateway", func() {
+			req = reconcile.Request{NamespacedName: types.NamespacedName{Name: testName, Namespace: testNamespace}}
+			gwConfig.Spec.GatewayVmssProfile = egressgatewayv1alpha1.GatewayVmssProfile{
+				Vmsses: []egressgatewayv1alpha1.VmssReference{{VmssResourceGroup: vmssRG, VmssName: "otherVMSS"}},
+			}
+			gwStatus.Spec.ReadyGatewayConfigurations[0].StaticGatewayConfiguration = fmt.Sprintf("%s/%s", testNamespace, testName)
+			getTestReconciler(node, gwConfig, vmConfig, gwStatus)
+			mns := r.NetNS.(*mocknetnswrapper.MockInterface)
+			mnl := r.Netlink.(*mocknetlinkwrapper.MockInterface)
+			eth0 := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth0"}}
+			host0 := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "host0"}}
+			gwns := &mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}
+			linkToDel := &netlink.Wireguard{LinkAttrs: netlink.LinkAttrs{Name: "wg-6000", Alias: testUID}}
+			Expect(r.LBProbeServer.AddGateway(testUID)).To(Succeed())
+
+			gomock.InOrder(
+				mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(gwns, nil),
+				mnl.EXPECT().LinkList().Return([]netlink.Link{
+					linkToDel,
+					&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "host0"}},
+				}, nil),
+				mnl.EXPECT().LinkByName("host0").Return(host0, nil),
+				mnl.EXPECT().AddrList(host0, nl.FAMILY_ALL).Return([]netlink.Addr{}, nil),
+				mnl.EXPECT().LinkDel(linkToDel).Return(nil),
+				mnl.EXPECT().LinkList().Return([]netlink.Link{eth0}, nil),
+				mnl.EXPECT().LinkByName("eth0").Return(eth0, nil),
+				mnl.EXPECT().AddrList(eth0, nl.FAMILY_ALL).Return([]netlink.Addr{}, nil),
+			)
+			res, reconcileErr = r.Reconcile(context.TODO(), req)
+			Expect(reconcileErr).To(BeNil())
+			Expect(res).To(Equal(ctrl.Result{}))
+			gwStatus := &egressgatewayv1alpha1.GatewayStatus{}
+			Expect(getGatewayStatus(r.Client, gwStatus)).To(Succeed())
+			Expect(gwStatus.Spec.ReadyGatewayConfigurations).To(Equal([]egressgatewayv1alpha1.GatewayConfiguration{{InterfaceName: "wg-6001"}}))
+			Expect(gwStatus.Spec.ReadyPeerConfigurations).To(HaveLen(2))
+			Expect(r.LBProbeServer.GetGateways()).To(BeEmpty())
+		})
+
+		It("should not clean up when gateway not applying to the node was never configured on it", func() {
+			req = reconcile.Request{NamespacedName: types.NamespacedName{Name: testName, Namespace: testNamespace}}
+			gwConfig.Spec.GatewayVmssProfile = egressgatewayv1alpha1.GatewayVmssProfile{
+				Vmsses: []egressgatewayv1alpha1.VmssReference{{VmssResourceGroup: vmssRG, VmssName: "otherVMSS"}},
+			}
+			getTestReconciler(node, gwConfig, vmConfig, gwStatus)
+			res, reconcileErr = r.Reconcile(context.TODO(), req)
+			Expect(reconcileErr).To(BeNil())
+			Expect(res).To(Equal(ctrl.Result{}))
+		})
+
 		It("should do fully cleanup when there's no active gwConfig", func() {
 			gwConfig.ObjectMeta.DeletionTimestamp = &metav1.Time{Time: time.Now()}
 			controllerutil.AddFinalizer(gwConfig, consts.SGCFinalizerName)
@@ -797,6 +1338,7 @@ var _ = Describe("Daemon StaticGatewayConfiguration controller unit tests", func
 				}, nil),
 				mnl.EXPECT().LinkByName("host0").Return(host0, nil),
 				mnl.EXPECT().AddrList(host0, nl.FAMILY_ALL).Return([]netlink.Addr{}, nil),
+				mnl.EXPECT().LinkList().Return([]netlink.Link{eth0}, nil),
 				mnl.EXPECT().LinkByName("eth0").Return(eth0, nil),
 				mnl.EXPECT().AddrList(eth0, nl.FAMILY_ALL).Return([]netlink.Addr{linkToDel}, nil),
 				mnl.EXPECT().AddrDel(eth0, &linkToDel).Return(nil),
@@ -812,6 +1354,51 @@ COMMIT
 			Expect(fipt.SaveInto("nat", buf)).NotTo(HaveOccurred())
 			Expect(buf.String()).To(Equal(expectedDump))
 		})
+
+		It("should remove network namespace of deleted gateway when each gateway has its own network namespace", func() {
+			getTestReconciler(node, gwConfig, vmConfig, gwStatus)
+			r.NetnsPerGateway = true
+			mns := r.NetNS.(*mocknetnswrapper.MockInterface)
+			mnl := r.Netlink.(*mocknetlinkwrapper.MockInterface)
+			host0 := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "host0"}}
+			sharedns := &mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}
+			gwns1 := &mocknetnswrapper.MockNetNS{Name: "ns-static-egress-gateway-6000"}
+			gwns2 := &mocknetnswrapper.MockNetNS{Name: "ns-static-egress-gateway-6001"}
+			linkToDel := &netlink.Wireguard{LinkAttrs: netlink.LinkAttrs{Name: "wg-6001", Alias: "deletingUID"}}
+			Expect(r.LBProbeServer.AddGateway("deletingUID")).To(Succeed())
+
+			gomock.InOrder(
+				mns.EXPECT().ListNS().Return([]string{"cni-1234", consts.GatewayNetnsName, "ns-static-egress-gateway-6000", "ns-static-egress-gateway-6001"}, nil),
+				// shared namespace is kept
+				mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(sharedns, nil),
+				mnl.EXPECT().LinkList().Return([]netlink.Link{&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "lo"}}}, nil),
+				mnl.EXPECT().LinkByName("host0").Return(host0, nil),
+				mnl.EXPECT().AddrList(host0, nl.FAMILY_ALL).Return([]netlink.Addr{}, nil),
+				// namespace of existing gateway is kept
+				mns.EXPECT().GetNS("ns-static-egress-gateway-6000").Return(gwns1, nil),
+				mnl.EXPECT().LinkList().Return([]netlink.Link{
+					&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "wg-6000"}},
+					&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "host0"}},
+				}, nil),
+				mnl.EXPECT().LinkByName("host0").Return(host0, nil),
+				mnl.EXPECT().AddrList(host0, nl.FAMILY_ALL).Return([]netlink.Addr{{IPNet: getIPNet("10.0.0.6/32")}}, nil),
+				// namespace of deleted gateway is removed after its wireguard link
+				mns.EXPECT().GetNS("ns-static-egress-gateway-6001").Return(gwns2, nil),
+				mnl.EXPECT().LinkList().Return([]netlink.Link{linkToDel}, nil),
+				mnl.EXPECT().LinkByName("host0").Return(nil, netlink.LinkNotFoundError{}),
+				mnl.EXPECT().LinkDel(linkToDel).Return(nil),
+				mns.EXPECT().UnmountNS("ns-static-egress-gateway-6001").Return(nil),
+				mnl.EXPECT().LinkList().Return([]netlink.Link{&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "host-gw-6000"}}}, nil),
+				mnl.EXPECT().QdiscList(gomock.Any()).Return(nil, nil),
+			)
+			res, reconcileErr = r.Reconcile(context.TODO(), req)
+			Expect(reconcileErr).To(BeNil())
+			Expect(res).To(Equal(ctrl.Result{}))
+			gwStatus := &egressgatewayv1alpha1.GatewayStatus{}
+			Expect(getGatewayStatus(r.Client, gwStatus)).To(Succeed())
+			Expect(gwStatus.Spec.ReadyGatewayConfigurations).To(Equal([]egressgatewayv1alpha1.GatewayConfiguration{{InterfaceName: "wg-6000"}}))
+			Expect(r.LBProbeServer.GetGateways()).To(BeEmpty())
+		})
 	})
 })
 
@@ -887,3 +1474,14 @@ func getGatewayNamespaceIptablesDump(marks ...int) string {
 `
 	return res
 }
+
+// restoreCountingIPTables counts restores of iptables rules, which reset rule counters
+type restoreCountingIPTables struct {
+	utiliptables.Interface
+	restores int
+}
+
+func (ipt *restoreCountingIPTables) RestoreAll(data []byte, flush utiliptables.FlushFlag, counters utiliptables.RestoreCountersFlag) error {
+	ipt.restores++
+	return ipt.Interface.RestoreAll(data, flush, counters)
+}
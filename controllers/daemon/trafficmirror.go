@@ -0,0 +1,341 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+)
+
+// trafficMirrorFilterPriority is the priority of ingress filters mirroring egress packets on host veth links
+const trafficMirrorFilterPriority = 10
+
+// trafficMirrorSampledProtocols are the protocols copied by sampling traffic mirror filters. Packets are sampled by
+// their transport checksum, which differs between packets of the same flow, unlike the IPv4 identification that is
+// often 0 in packets with DF set. off is the 32-bit word holding the checksum in packets without IPv4 options, and
+// shift the position of the checksum in it.
+var trafficMirrorSampledProtocols = []struct {
+	protocol uint32
+	off      int32
+	shift    int
+}{
+	{protocol: unix.IPPROTO_TCP, off: 36, shift: 16},
+	{protocol: unix.IPPROTO_UDP, off: 24, shift: 0},
+	{protocol: unix.IPPROTO_ICMP, off: 20, shift: 0},
+}
+
+// getTrafficMirrorLinkName returns the vxlan link in host namespace mirrored packets of the gateway are sent to
+func getTrafficMirrorLinkName(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) string {
+	return consts.TrafficMirrorLinkNamePrefix + fmt.Sprintf("%d", gwConfig.Status.Port)
+}
+
+// reconcileTrafficMirror mirrors egress packets of the gateway to the target of spec.trafficMirror, or stops
+// mirroring them when it is not set. Packets are mirrored when they leave the gateway namespace through the host
+// veth link, i.e. after being sNATed to one of snatIPs.
+func (r *StaticGatewayConfigurationReconciler) reconcileTrafficMirror(
+	ctx context.Context,
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+	snatIPs []string,
+) error {
+	vethLink, err := r.Netlink.LinkByName(getHostVethLinkName(gwConfig, r.NetnsPerGateway))
+	if err != nil {
+		return fmt.Errorf("failed to get veth link in host namespace: %w", err)
+	}
+
+	mirror := gwConfig.Spec.TrafficMirror
+	var target netlink.Link
+	if mirror != nil {
+		if mirror.TargetInterface != "" {
+			target, err = r.Netlink.LinkByName(mirror.TargetInterface)
+			if err != nil {
+				return fmt.Errorf("failed to get traffic mirror target interface %s: %w", mirror.TargetInterface, err)
+			}
+		} else if target, err = r.ensureTrafficMirrorVxlanLink(ctx, gwConfig); err != nil {
+			return err
+		}
+	}
+
+	if err := r.reconcileTrafficMirrorFilters(ctx, vethLink, snatIPs, mirror, target); err != nil {
+		return err
+	}
+
+	if mirror == nil || mirror.Vxlan == nil {
+		link, err := r.Netlink.LinkByName(getTrafficMirrorLinkName(gwConfig))
+		if err != nil {
+			if _, ok := err.(netlink.LinkNotFoundError); ok {
+				return nil
+			}
+			return fmt.Errorf("failed to get traffic mirror vxlan link: %w", err)
+		}
+		log.FromContext(ctx).Info("Deleting traffic mirror vxlan link", "link", link.Attrs().Name)
+		if err := r.Netlink.LinkDel(link); err != nil {
+			return fmt.Errorf("failed to delete traffic mirror vxlan link %s: %w", link.Attrs().Name, err)
+		}
+	}
+	return nil
+}
+
+// ensureTrafficMirrorVxlanLink creates the vxlan link to the collector of the gateway, recreating it when its
+// tunnel parameters changed
+func (r *StaticGatewayConfigurationReconciler) ensureTrafficMirrorVxlanLink(
+	ctx context.Context,
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+) (netlink.Link, error) {
+	log := log.FromContext(ctx)
+	spec := gwConfig.Spec.TrafficMirror.Vxlan
+	port := spec.Port
+	if port == 0 {
+		port = consts.DefaultTrafficMirrorVxlanPort
+	}
+	la := netlink.NewLinkAttrs()
+	la.Name = getTrafficMirrorLinkName(gwConfig)
+	vxlan := &netlink.Vxlan{
+		LinkAttrs: la,
+		VxlanId:   int(spec.Vni),
+		Group:     net.ParseIP(spec.CollectorIp),
+		Port:      int(port),
+	}
+
+	link, err := r.Netlink.LinkByName(la.Name)
+	if err == nil {
+		existing, ok := link.(*netlink.Vxlan)
+		if ok && existing.VxlanId == vxlan.VxlanId && existing.Group.Equal(vxlan.Group) && existing.Port == vxlan.Port {
+			if err := r.Netlink.LinkSetUp(link); err != nil {
+				return nil, fmt.Errorf("failed to set traffic mirror vxlan link up: %w", err)
+			}
+			return link, nil
+		}
+		log.Info("Recreating outdated traffic mirror vxlan link", "link", la.Name)
+		if err := r.Netlink.LinkDel(link); err != nil {
+			return nil, fmt.Errorf("failed to delete outdated traffic mirror vxlan link: %w", err)
+		}
+	} else if _, ok := err.(netlink.LinkNotFoundError); !ok {
+		return nil, fmt.Errorf("failed to get traffic mirror vxlan link: %w", err)
+	}
+
+	log.Info("Creating traffic mirror vxlan link", "link", la.Name, "collector", spec.CollectorIp, "vni", spec.Vni)
+	if err := r.Netlink.LinkAdd(vxlan); err != nil {
+		return nil, fmt.Errorf("failed to add traffic mirror vxlan link: %w", err)
+	}
+	link, err = r.Netlink.LinkByName(la.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get traffic mirror vxlan link after creation: %w", err)
+	}
+	if err := r.Netlink.LinkSetUp(link); err != nil {
+		return nil, fmt.Errorf("failed to set traffic mirror vxlan link up: %w", err)
+	}
+	return link, nil
+}
+
+// reconcileTrafficMirrorFilters keeps one ingress filter mirroring packets from each of snatIPs to target on the
+// host veth link, or removes them when target is nil. Filters of other gateways sharing the link are kept.
+func (r *StaticGatewayConfigurationReconciler) reconcileTrafficMirrorFilters(
+	ctx context.Context,
+	vethLink netlink.Link,
+	snatIPs []string,
+	mirror *egressgatewayv1alpha1.TrafficMirror,
+	target netlink.Link,
+) error {
+	log := log.FromContext(ctx)
+	qdiscs, err := r.Netlink.QdiscList(vethLink)
+	if err != nil {
+		return fmt.Errorf("failed to list qdiscs on veth link: %w", err)
+	}
+	if !hasIngressQdisc(qdiscs) {
+		if target == nil {
+			return nil
+		}
+		qdisc := &netlink.Ingress{
+			QdiscAttrs: netlink.QdiscAttrs{
+				LinkIndex: vethLink.Attrs().Index,
+				Handle:    netlink.MakeHandle(0xffff, 0),
+				Parent:    netlink.HANDLE_INGRESS,
+			},
+		}
+		if err := r.Netlink.QdiscAdd(qdisc); err != nil {
+			return fmt.Errorf("failed to add ingress qdisc on veth link: %w", err)
+		}
+	}
+
+	expected := make(map[string][]*netlink.U32)
+	if target != nil {
+		for _, snatIP := range snatIPs {
+			expected[snatIP] = getTrafficMirrorFilters(vethLink.Attrs().Index, net.ParseIP(snatIP), mirror.SampleRate, target.Attrs().Index)
+		}
+	}
+
+	filters, err := r.Netlink.FilterList(vethLink, netlink.HANDLE_INGRESS)
+	if err != nil {
+		return fmt.Errorf("failed to list ingress filters on veth link: %w", err)
+	}
+	for _, filter := range filters {
+		srcIP := getTrafficMirrorSourceIP(filter)
+		if srcIP == "" || !slices.Contains(snatIPs, srcIP) {
+			continue
+		}
+		if i := slices.IndexFunc(expected[srcIP], func(want *netlink.U32) bool {
+			return trafficMirrorFilterEqual(filter.(*netlink.U32), want)
+		}); i >= 0 {
+			expected[srcIP] = slices.Delete(expected[srcIP], i, i+1)
+			continue
+		}
+		log.Info("Deleting traffic mirror filter", "ip", srcIP)
+		if err := r.Netlink.FilterDel(filter); err != nil {
+			return fmt.Errorf("failed to delete traffic mirror filter for ip %s: %w", srcIP, err)
+		}
+	}
+
+	for _, snatIP := range snatIPs {
+		for _, filter := range expected[snatIP] {
+			log.Info("Adding traffic mirror filter", "ip", snatIP, "target", target.Attrs().Name)
+			if err := r.Netlink.FilterAdd(filter); err != nil {
+				return fmt.Errorf("failed to add traffic mirror filter for ip %s: %w", snatIP, err)
+			}
+		}
+	}
+	return nil
+}
+
+// cleanUpTrafficMirror removes traffic mirror filters on host veth links whose source IP is not in mirroredIPs,
+// and traffic mirror vxlan links not in mirrorLinks
+func (r *StaticGatewayConfigurationReconciler) cleanUpTrafficMirror(
+	ctx context.Context,
+	mirroredIPs map[string]struct{},
+	mirrorLinks map[string]struct{},
+) error {
+	log := log.FromContext(ctx)
+	links, err := r.Netlink.LinkList()
+	if err != nil {
+		return fmt.Errorf("failed to list links in host namespace: %w", err)
+	}
+	for _, link := range links {
+		linkName := link.Attrs().Name
+		if strings.HasPrefix(linkName, consts.TrafficMirrorLinkNamePrefix) {
+			if _, ok := mirrorLinks[linkName]; !ok {
+				log.Info("Removing orphaned traffic mirror vxlan link", "link", linkName)
+				if err := r.Netlink.LinkDel(link); err != nil {
+					return fmt.Errorf("failed to delete traffic mirror vxlan link %s: %w", linkName, err)
+				}
+			}
+			continue
+		}
+		if linkName != consts.HostVethLinkName && !strings.HasPrefix(linkName, consts.HostVethLinkNamePrefix) {
+			continue
+		}
+		qdiscs, err := r.Netlink.QdiscList(link)
+		if err != nil {
+			return fmt.Errorf("failed to list qdiscs on veth link %s: %w", linkName, err)
+		}
+		if !hasIngressQdisc(qdiscs) {
+			continue
+		}
+		filters, err := r.Netlink.FilterList(link, netlink.HANDLE_INGRESS)
+		if err != nil {
+			return fmt.Errorf("failed to list ingress filters on veth link %s: %w", linkName, err)
+		}
+		for _, filter := range filters {
+			srcIP := getTrafficMirrorSourceIP(filter)
+			if srcIP == "" {
+				continue
+			}
+			if _, ok := mirroredIPs[srcIP]; !ok {
+				log.Info("Removing orphaned traffic mirror filter", "link", linkName, "ip", srcIP)
+				if err := r.Netlink.FilterDel(filter); err != nil {
+					return fmt.Errorf("failed to delete traffic mirror filter for ip %s on veth link %s: %w", srcIP, linkName, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// getTrafficMirrorFilters returns the ingress filters on the host veth link copying packets from snatIP to the
+// egress of the target link. When sampleRate, a power of 2, is larger than 1, only TCP, UDP and ICMP packets whose
+// checksum is a multiple of it are copied, one filter per protocol.
+func getTrafficMirrorFilters(linkIndex int, snatIP net.IP, sampleRate int32, targetIndex int) []*netlink.U32 {
+	// match source ip in ipv4 header, offsets are relative to the network header on ingress
+	srcKey := netlink.TcU32Key{Mask: 0xffffffff, Val: binary.BigEndian.Uint32(snatIP.To4()), Off: 12}
+	if sampleRate <= 1 {
+		return []*netlink.U32{getTrafficMirrorFilter(linkIndex, []netlink.TcU32Key{srcKey}, targetIndex)}
+	}
+	var filters []*netlink.U32
+	for _, sampled := range trafficMirrorSampledProtocols {
+		filters = append(filters, getTrafficMirrorFilter(linkIndex, []netlink.TcU32Key{
+			srcKey,
+			// ipv4 header without options, so that the transport header starts at offset 20
+			{Mask: 0x0f000000, Val: 0x05000000, Off: 0},
+			// first fragment, later ones carry no transport header
+			{Mask: 0x00001fff, Val: 0, Off: 4},
+			// protocol is the second byte of the third 32-bit word of ipv4 header
+			{Mask: 0x00ff0000, Val: sampled.protocol << 16, Off: 8},
+			{Mask: uint32(sampleRate-1) << sampled.shift, Val: 0, Off: sampled.off},
+		}, targetIndex))
+	}
+	return filters
+}
+
+// getTrafficMirrorFilter returns an ingress filter on the host veth link copying packets matching keys to the egress
+// of the target link
+func getTrafficMirrorFilter(linkIndex int, keys []netlink.TcU32Key, targetIndex int) *netlink.U32 {
+	return &netlink.U32{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: linkIndex,
+			Parent:    netlink.HANDLE_INGRESS,
+			Priority:  trafficMirrorFilterPriority,
+			Protocol:  unix.ETH_P_IP,
+		},
+		Sel: &netlink.TcU32Sel{
+			Flags: nl.TC_U32_TERMINAL,
+			Keys:  keys,
+		},
+		Actions: []netlink.Action{
+			&netlink.MirredAction{
+				// continue delivering the original packet
+				ActionAttrs:  netlink.ActionAttrs{Action: netlink.TC_ACT_PIPE},
+				MirredAction: netlink.TCA_EGRESS_MIRROR,
+				Ifindex:      targetIndex,
+			},
+		},
+	}
+}
+
+// getTrafficMirrorSourceIP returns the source IP matched by a traffic mirror filter, or empty for other filters
+func getTrafficMirrorSourceIP(filter netlink.Filter) string {
+	u32, ok := filter.(*netlink.U32)
+	if !ok || u32.Priority != trafficMirrorFilterPriority || u32.Sel == nil || len(u32.Sel.Keys) == 0 {
+		return ""
+	}
+	key := u32.Sel.Keys[0]
+	if key.Off != 12 || key.Mask != 0xffffffff {
+		return ""
+	}
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, key.Val)
+	return ip.String()
+}
+
+func trafficMirrorFilterEqual(u32, want *netlink.U32) bool {
+	if len(u32.Sel.Keys) != len(want.Sel.Keys) || len(u32.Actions) != 1 {
+		return false
+	}
+	for i, key := range u32.Sel.Keys {
+		if key.Off != want.Sel.Keys[i].Off || key.Mask != want.Sel.Keys[i].Mask || key.Val != want.Sel.Keys[i].Val {
+			return false
+		}
+	}
+	mirred, ok := u32.Actions[0].(*netlink.MirredAction)
+	return ok && mirred.MirredAction == netlink.TCA_EGRESS_MIRROR && mirred.Ifindex == want.Actions[0].(*netlink.MirredAction).Ifindex
+}
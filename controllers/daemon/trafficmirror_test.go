@@ -0,0 +1,174 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"context"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/sys/unix"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/netlinkwrapper/mocknetlinkwrapper"
+)
+
+var _ = Describe("Daemon traffic mirror unit tests", func() {
+	var (
+		r        *StaticGatewayConfigurationReconciler
+		mnl      *mocknetlinkwrapper.MockInterface
+		gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration
+		veth     = &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "host-gateway", Index: 5}}
+		ingress  = &netlink.Ingress{QdiscAttrs: netlink.QdiscAttrs{LinkIndex: 5, Handle: netlink.MakeHandle(0xffff, 0), Parent: netlink.HANDLE_INGRESS}}
+		snatIPs  = []string{"10.0.0.6", "10.0.0.7"}
+	)
+
+	BeforeEach(func() {
+		mnl = mocknetlinkwrapper.NewMockInterface(gomock.NewController(GinkgoT()))
+		r = &StaticGatewayConfigurationReconciler{Netlink: mnl}
+		gwConfig = &egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: testName, Namespace: testNamespace},
+			Status: egressgatewayv1alpha1.StaticGatewayConfigurationStatus{
+				GatewayServerProfile: egressgatewayv1alpha1.GatewayServerProfile{Port: 6000},
+			},
+		}
+	})
+
+	It("should mirror packets from each snat ip to the target interface with a tc mirred rule", func() {
+		gwConfig.Spec.TrafficMirror = &egressgatewayv1alpha1.TrafficMirror{TargetInterface: "eth1", SampleRate: 64}
+		eth1 := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth1", Index: 7}}
+		outdated := getTrafficMirrorFilters(5, net.ParseIP("10.0.0.7"), 0, 7)[0]
+		otherGateway := getTrafficMirrorFilters(5, net.ParseIP("10.0.0.9"), 64, 7)[0]
+		var added []*netlink.U32
+		gomock.InOrder(
+			mnl.EXPECT().LinkByName("host-gateway").Return(veth, nil),
+			mnl.EXPECT().LinkByName("eth1").Return(eth1, nil),
+			mnl.EXPECT().QdiscList(veth).Return(nil, nil),
+			mnl.EXPECT().QdiscAdd(ingress).Return(nil),
+			mnl.EXPECT().FilterList(veth, uint32(netlink.HANDLE_INGRESS)).Return([]netlink.Filter{outdated, otherGateway}, nil),
+			mnl.EXPECT().FilterDel(outdated).Return(nil),
+			mnl.EXPECT().FilterAdd(gomock.Any()).DoAndReturn(func(filter netlink.Filter) error {
+				added = append(added, filter.(*netlink.U32))
+				return nil
+			}).Times(6),
+			mnl.EXPECT().LinkByName("egmir-6000").Return(nil, netlink.LinkNotFoundError{}),
+		)
+		Expect(r.reconcileTrafficMirror(context.TODO(), gwConfig, snatIPs)).To(Succeed())
+
+		Expect(added).To(HaveLen(6))
+		for i, filter := range added {
+			Expect(filter.FilterAttrs).To(Equal(netlink.FilterAttrs{
+				LinkIndex: 5,
+				Parent:    netlink.HANDLE_INGRESS,
+				Priority:  trafficMirrorFilterPriority,
+				Protocol:  unix.ETH_P_IP,
+			}))
+			Expect(filter.Sel.Flags).To(Equal(uint8(nl.TC_U32_TERMINAL)))
+			Expect(getTrafficMirrorSourceIP(filter)).To(Equal(snatIPs[i/3]))
+			Expect(filter.Sel.Keys[1:4]).To(Equal([]netlink.TcU32Key{
+				{Mask: 0x0f000000, Val: 0x05000000, Off: 0},
+				{Mask: 0x00001fff, Val: 0, Off: 4},
+				{Mask: 0x00ff0000, Val: []uint32{unix.IPPROTO_TCP, unix.IPPROTO_UDP, unix.IPPROTO_ICMP}[i%3] << 16, Off: 8},
+			}))
+			// one of every 64 packets by tcp, udp and icmp checksum
+			Expect(filter.Sel.Keys[4]).To(Equal([]netlink.TcU32Key{
+				{Mask: 0x3f0000, Val: 0, Off: 36},
+				{Mask: 0x3f, Val: 0, Off: 24},
+				{Mask: 0x3f, Val: 0, Off: 20},
+			}[i%3]))
+			Expect(filter.Actions).To(Equal([]netlink.Action{&netlink.MirredAction{
+				ActionAttrs:  netlink.ActionAttrs{Action: netlink.TC_ACT_PIPE},
+				MirredAction: netlink.TCA_EGRESS_MIRROR,
+				Ifindex:      7,
+			}}))
+		}
+	})
+
+	It("should create vxlan link to the collector and keep up-to-date filters", func() {
+		gwConfig.Spec.TrafficMirror = &egressgatewayv1alpha1.TrafficMirror{
+			Vxlan: &egressgatewayv1alpha1.TrafficMirrorVxlan{CollectorIp: "10.1.0.100", Vni: 100},
+		}
+		vxlan := &netlink.Vxlan{LinkAttrs: netlink.LinkAttrs{Name: "egmir-6000", Index: 8}, VxlanId: 100, Group: net.ParseIP("10.1.0.100"), Port: 4789}
+		upToDate := getTrafficMirrorFilters(5, net.ParseIP("10.0.0.6"), 0, 8)[0]
+		gomock.InOrder(
+			mnl.EXPECT().LinkByName("host-gateway").Return(veth, nil),
+			mnl.EXPECT().LinkByName("egmir-6000").Return(nil, netlink.LinkNotFoundError{}),
+			mnl.EXPECT().LinkAdd(gomock.Any()).DoAndReturn(func(link netlink.Link) error {
+				created := link.(*netlink.Vxlan)
+				Expect(created.Name).To(Equal("egmir-6000"))
+				Expect(created.VxlanId).To(Equal(100))
+				Expect(created.Group.String()).To(Equal("10.1.0.100"))
+				Expect(created.Port).To(Equal(4789))
+				Expect(created.Learning).To(BeFalse())
+				return nil
+			}),
+			mnl.EXPECT().LinkByName("egmir-6000").Return(vxlan, nil),
+			mnl.EXPECT().LinkSetUp(vxlan).Return(nil),
+			mnl.EXPECT().QdiscList(veth).Return([]netlink.Qdisc{ingress}, nil),
+			mnl.EXPECT().FilterList(veth, uint32(netlink.HANDLE_INGRESS)).Return([]netlink.Filter{upToDate}, nil),
+			mnl.EXPECT().FilterAdd(getTrafficMirrorFilters(5, net.ParseIP("10.0.0.7"), 0, 8)[0]).Return(nil),
+		)
+		Expect(r.reconcileTrafficMirror(context.TODO(), gwConfig, snatIPs)).To(Succeed())
+	})
+
+	It("should keep up-to-date sampling filters of each protocol", func() {
+		gwConfig.Spec.TrafficMirror = &egressgatewayv1alpha1.TrafficMirror{TargetInterface: "eth1", SampleRate: 64}
+		eth1 := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth1", Index: 7}}
+		upToDate := getTrafficMirrorFilters(5, net.ParseIP("10.0.0.6"), 64, 7)
+		missing := getTrafficMirrorFilters(5, net.ParseIP("10.0.0.7"), 64, 7)
+		gomock.InOrder(
+			mnl.EXPECT().LinkByName("host-gateway").Return(veth, nil),
+			mnl.EXPECT().LinkByName("eth1").Return(eth1, nil),
+			mnl.EXPECT().QdiscList(veth).Return([]netlink.Qdisc{ingress}, nil),
+			mnl.EXPECT().FilterList(veth, uint32(netlink.HANDLE_INGRESS)).Return([]netlink.Filter{upToDate[2], upToDate[0], missing[1], upToDate[1]}, nil),
+			mnl.EXPECT().FilterAdd(missing[0]).Return(nil),
+			mnl.EXPECT().FilterAdd(missing[2]).Return(nil),
+			mnl.EXPECT().LinkByName("egmir-6000").Return(nil, netlink.LinkNotFoundError{}),
+		)
+		Expect(r.reconcileTrafficMirror(context.TODO(), gwConfig, snatIPs)).To(Succeed())
+	})
+
+	It("should remove filters and vxlan link of the gateway when mirroring is disabled", func() {
+		vxlan := &netlink.Vxlan{LinkAttrs: netlink.LinkAttrs{Name: "egmir-6000", Index: 8}}
+		filter := getTrafficMirrorFilters(5, net.ParseIP("10.0.0.6"), 0, 8)[0]
+		gomock.InOrder(
+			mnl.EXPECT().LinkByName("host-gateway").Return(veth, nil),
+			mnl.EXPECT().QdiscList(veth).Return([]netlink.Qdisc{ingress}, nil),
+			mnl.EXPECT().FilterList(veth, uint32(netlink.HANDLE_INGRESS)).Return([]netlink.Filter{filter}, nil),
+			mnl.EXPECT().FilterDel(filter).Return(nil),
+			mnl.EXPECT().LinkByName("egmir-6000").Return(vxlan, nil),
+			mnl.EXPECT().LinkDel(vxlan).Return(nil),
+		)
+		Expect(r.reconcileTrafficMirror(context.TODO(), gwConfig, snatIPs)).To(Succeed())
+	})
+
+	It("should clean up filters and vxlan links of deleted gateways", func() {
+		vethPerGateway := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "host-gw-6001", Index: 6}}
+		activeLink := &netlink.Vxlan{LinkAttrs: netlink.LinkAttrs{Name: "egmir-6000"}}
+		orphanedLink := &netlink.Vxlan{LinkAttrs: netlink.LinkAttrs{Name: "egmir-6001"}}
+		active := getTrafficMirrorFilters(5, net.ParseIP("10.0.0.6"), 0, 8)[0]
+		orphaned := getTrafficMirrorFilters(6, net.ParseIP("10.0.0.7"), 0, 9)[0]
+		gomock.InOrder(
+			mnl.EXPECT().LinkList().Return([]netlink.Link{
+				&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth0"}},
+				veth, vethPerGateway, activeLink, orphanedLink,
+			}, nil),
+			mnl.EXPECT().QdiscList(veth).Return([]netlink.Qdisc{ingress}, nil),
+			mnl.EXPECT().FilterList(veth, uint32(netlink.HANDLE_INGRESS)).Return([]netlink.Filter{active}, nil),
+			mnl.EXPECT().QdiscList(vethPerGateway).Return([]netlink.Qdisc{ingress}, nil),
+			mnl.EXPECT().FilterList(vethPerGateway, uint32(netlink.HANDLE_INGRESS)).Return([]netlink.Filter{orphaned}, nil),
+			mnl.EXPECT().FilterDel(orphaned).Return(nil),
+			mnl.EXPECT().LinkDel(orphanedLink).Return(nil),
+		)
+		Expect(r.cleanUpTrafficMirror(context.TODO(),
+			map[string]struct{}{"10.0.0.6": {}},
+			map[string]struct{}{"egmir-6000": {}},
+		)).To(Succeed())
+	})
+})
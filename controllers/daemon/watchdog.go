@@ -0,0 +1,209 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vishvananda/netlink"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/netlinkwrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper"
+)
+
+var GatewayWireguardDeviceRecreateCount = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "gateway_wireguard_device_recreate_count",
+		Help: "Number of times the wireguard device of the static egress gateway is found missing and recreated",
+	},
+	gatewayLabels,
+)
+
+// WireguardWatchdog periodically verifies that wireguard devices of gateways configured on this node exist, e.g.
+// they are not deleted by another agent. Gateways with a missing device are reconciled again, which recreates the
+// device, and so are their PodEndpoints, which re-applies the peers.
+type WireguardWatchdog struct {
+	client.Client
+	Netlink netlinkwrapper.Interface
+	NetNS   netnswrapper.Interface
+	// NetnsPerGateway configures each gateway in its own network namespace
+	NetnsPerGateway bool
+	Recorder        record.EventRecorder
+	Interval        time.Duration
+	// GatewayEvents and PeerEvents enqueue StaticGatewayConfigurations and PodEndpoints to their reconcilers
+	GatewayEvents chan<- event.GenericEvent
+	PeerEvents    chan<- event.GenericEvent
+}
+
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+
+func NewWireguardWatchdog(
+	c client.Client,
+	recorder record.EventRecorder,
+	interval time.Duration,
+	gatewayEvents, peerEvents chan<- event.GenericEvent,
+) *WireguardWatchdog {
+	return &WireguardWatchdog{
+		Client:        c,
+		Netlink:       netlinkwrapper.NewNetLink(),
+		NetNS:         netnswrapper.NewNetNS(),
+		Recorder:      recorder,
+		Interval:      interval,
+		GatewayEvents: gatewayEvents,
+		PeerEvents:    peerEvents,
+	}
+}
+
+// Start checks wireguard devices every interval until ctx is done.
+func (w *WireguardWatchdog) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := w.check(ctx); err != nil {
+			log.FromContext(ctx).Error(err, "failed to check wireguard devices")
+		}
+	}, w.Interval)
+	return nil
+}
+
+func (w *WireguardWatchdog) check(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("wireguard-watchdog")
+
+	gwConfigs, err := w.getConfiguredGateways(ctx)
+	if err != nil {
+		return err
+	}
+	for nsName, nsGwConfigs := range groupByNetns(gwConfigs, w.NetnsPerGateway) {
+		missing, err := w.getMissingDevices(nsName, nsGwConfigs)
+		if err != nil {
+			// do not block checking gateways in other network namespaces
+			log.Error(err, "failed to check wireguard devices in gateway network namespace", "netns", nsName)
+			continue
+		}
+		for _, gwConfig := range missing {
+			if err := w.recreate(ctx, gwConfig); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// getConfiguredGateways returns gateways recorded as configured in the gateway status of this node, gateways not
+// configured yet have no wireguard device to check
+func (w *WireguardWatchdog) getConfiguredGateways(ctx context.Context) ([]*egressgatewayv1alpha1.StaticGatewayConfiguration, error) {
+	gwStatus := &egressgatewayv1alpha1.GatewayStatus{}
+	if err := w.Get(ctx, types.NamespacedName{Namespace: os.Getenv(consts.PodNamespaceEnvKey), Name: os.Getenv(consts.NodeNameEnvKey)}, gwStatus); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get gateway status: %w", err)
+	}
+	configured := make(map[string]string)
+	for _, gwConf := range gwStatus.Spec.ReadyGatewayConfigurations {
+		configured[gwConf.StaticGatewayConfiguration] = gwConf.InterfaceName
+	}
+	if len(configured) == 0 {
+		return nil, nil
+	}
+
+	gwConfigList := &egressgatewayv1alpha1.StaticGatewayConfigurationList{}
+	if err := w.List(ctx, gwConfigList); err != nil {
+		return nil, fmt.Errorf("failed to list staticGatewayConfigurations: %w", err)
+	}
+	var gwConfigs []*egressgatewayv1alpha1.StaticGatewayConfiguration
+	for i := range gwConfigList.Items {
+		gwConfig := &gwConfigList.Items[i]
+		if !isReady(gwConfig) || !applyToNode(gwConfig) || !gwConfig.ObjectMeta.DeletionTimestamp.IsZero() {
+			continue
+		}
+		// a gateway whose port changed is reconfigured by its reconciler anyway
+		if configured[fmt.Sprintf("%s/%s", gwConfig.Namespace, gwConfig.Name)] == getWireguardInterfaceName(gwConfig) {
+			gwConfigs = append(gwConfigs, gwConfig)
+		}
+	}
+	return gwConfigs, nil
+}
+
+// getMissingDevices returns gateways whose wireguard device does not exist in the network namespace
+func (w *WireguardWatchdog) getMissingDevices(
+	nsName string,
+	gwConfigs []*egressgatewayv1alpha1.StaticGatewayConfiguration,
+) ([]*egressgatewayv1alpha1.StaticGatewayConfiguration, error) {
+	gwns, err := w.NetNS.GetNS(nsName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gateway network namespace %s: %w", nsName, err)
+	}
+	defer gwns.Close()
+
+	var missing []*egressgatewayv1alpha1.StaticGatewayConfiguration
+	if err := gwns.Do(func(nn ns.NetNS) error {
+		for _, gwConfig := range gwConfigs {
+			wglinkName := getWireguardInterfaceName(gwConfig)
+			if _, err := w.Netlink.LinkByName(wglinkName); err != nil {
+				if _, ok := err.(netlink.LinkNotFoundError); !ok {
+					return fmt.Errorf("failed to get wireguard link %s: %w", wglinkName, err)
+				}
+				missing = append(missing, gwConfig)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return missing, nil
+}
+
+// recreate enqueues the gateway to recreate its wireguard device and its PodEndpoints to re-apply the peers. Peers
+// failing to be applied before the device is recreated are retried by the PodEndpoint reconciler.
+func (w *WireguardWatchdog) recreate(ctx context.Context, gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) error {
+	wglinkName := getWireguardInterfaceName(gwConfig)
+	log.FromContext(ctx).Info("Wireguard device is missing, recreating it", "gateway", client.ObjectKeyFromObject(gwConfig), "wglink", wglinkName)
+	GatewayWireguardDeviceRecreateCount.WithLabelValues(gwConfig.Namespace, gwConfig.Name).Inc()
+	if w.Recorder != nil {
+		w.Recorder.Eventf(gwConfig, corev1.EventTypeWarning, "WireguardDeviceRecreated",
+			"Wireguard device %s is missing on node %s, recreating it and re-applying its peers", wglinkName, os.Getenv(consts.NodeNameEnvKey))
+	}
+	if err := sendGenericEvent(ctx, w.GatewayEvents, gwConfig); err != nil {
+		return err
+	}
+
+	podEndpointList := &egressgatewayv1alpha1.PodEndpointList{}
+	if err := w.List(ctx, podEndpointList); err != nil {
+		return fmt.Errorf("failed to list PodEndpoints: %w", err)
+	}
+	gwConfigKey := client.ObjectKeyFromObject(gwConfig)
+	for i := range podEndpointList.Items {
+		podEndpoint := &podEndpointList.Items[i]
+		if podEndpoint.GetStaticGatewayConfigurationKey() != gwConfigKey || !gwConfig.AllowsNamespace(podEndpoint.Namespace) {
+			continue
+		}
+		if err := sendGenericEvent(ctx, w.PeerEvents, podEndpoint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sendGenericEvent(ctx context.Context, events chan<- event.GenericEvent, obj client.Object) error {
+	select {
+	case events <- event.GenericEvent{Object: obj}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
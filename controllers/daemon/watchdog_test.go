@@ -0,0 +1,159 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/vishvananda/netlink"
+	"go.uber.org/mock/gomock"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/imds"
+	"github.com/Azure/kube-egress-gateway/pkg/netlinkwrapper/mocknetlinkwrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/netnswrapper/mocknetnswrapper"
+)
+
+var _ = Describe("Daemon wireguard watchdog unit tests", func() {
+	var (
+		w             *WireguardWatchdog
+		mnl           *mocknetlinkwrapper.MockInterface
+		mns           *mocknetnswrapper.MockInterface
+		recorder      *record.FakeRecorder
+		gatewayEvents chan event.GenericEvent
+		peerEvents    chan event.GenericEvent
+	)
+
+	getTestWatchdog := func(objects ...runtime.Object) {
+		mctrl := gomock.NewController(GinkgoT())
+		mnl = mocknetlinkwrapper.NewMockInterface(mctrl)
+		mns = mocknetnswrapper.NewMockInterface(mctrl)
+		recorder = record.NewFakeRecorder(10)
+		gatewayEvents = make(chan event.GenericEvent, 10)
+		peerEvents = make(chan event.GenericEvent, 10)
+		w = &WireguardWatchdog{
+			Client:        fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(objects...).Build(),
+			Netlink:       mnl,
+			NetNS:         mns,
+			Recorder:      recorder,
+			GatewayEvents: gatewayEvents,
+			PeerEvents:    peerEvents,
+		}
+	}
+
+	getTestGwConfig := func() *egressgatewayv1alpha1.StaticGatewayConfiguration {
+		return &egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: testName, Namespace: testNamespace},
+			Spec: egressgatewayv1alpha1.StaticGatewayConfigurationSpec{
+				GatewayVmssProfile: egressgatewayv1alpha1.GatewayVmssProfile{
+					VmssResourceGroup:  vmssRG,
+					VmssName:           vmssName,
+					PublicIpPrefixSize: 31,
+				},
+			},
+			Status: getTestGwConfigStatus(),
+		}
+	}
+
+	getTestGwStatus := func(interfaceName string) *egressgatewayv1alpha1.GatewayStatus {
+		return &egressgatewayv1alpha1.GatewayStatus{
+			ObjectMeta: metav1.ObjectMeta{Name: testNodeName, Namespace: testPodNamespace},
+			Spec: egressgatewayv1alpha1.GatewayStatusSpec{
+				ReadyGatewayConfigurations: []egressgatewayv1alpha1.GatewayConfiguration{{
+					StaticGatewayConfiguration: fmt.Sprintf("%s/%s", testNamespace, testName),
+					InterfaceName:              interfaceName,
+				}},
+			},
+		}
+	}
+
+	getTestPodEndpoint := func(name, gateway string) *egressgatewayv1alpha1.PodEndpoint {
+		return &egressgatewayv1alpha1.PodEndpoint{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+			Spec: egressgatewayv1alpha1.PodEndpointSpec{
+				StaticGatewayConfiguration: gateway,
+				PodIpAddress:               podIPAddrNet,
+				PodPublicKey:               pubK,
+			},
+		}
+	}
+
+	expectLink := func(link netlink.Link, err error) {
+		mns.EXPECT().GetNS(consts.GatewayNetnsName).Return(&mocknetnswrapper.MockNetNS{Name: consts.GatewayNetnsName}, nil)
+		mnl.EXPECT().LinkByName("wg-6000").Return(link, err)
+	}
+
+	BeforeEach(func() {
+		os.Setenv(consts.NodeNameEnvKey, testNodeName)
+		os.Setenv(consts.PodNamespaceEnvKey, testPodNamespace)
+		nodeMeta = &imds.InstanceMetadata{
+			Compute: &imds.ComputeMetadata{
+				VMScaleSetName:    vmssName,
+				ResourceGroupName: vmssRG,
+			},
+		}
+		GatewayWireguardDeviceRecreateCount.Reset()
+	})
+
+	AfterEach(func() {
+		os.Setenv(consts.NodeNameEnvKey, "")
+		os.Setenv(consts.PodNamespaceEnvKey, "")
+	})
+
+	It("should do nothing when the wireguard device exists", func() {
+		getTestWatchdog(getTestGwConfig(), getTestGwStatus("wg-6000"), getTestPodEndpoint("pod1", testName))
+		expectLink(&netlink.Wireguard{LinkAttrs: netlink.LinkAttrs{Name: "wg-6000"}}, nil)
+
+		Expect(w.check(context.TODO())).To(Succeed())
+		Expect(gatewayEvents).To(BeEmpty())
+		Expect(peerEvents).To(BeEmpty())
+		Expect(recorder.Events).To(BeEmpty())
+		Expect(testutil.CollectAndCount(GatewayWireguardDeviceRecreateCount)).To(BeZero())
+	})
+
+	It("should recreate the wireguard device and re-apply peers when it is removed", func() {
+		getTestWatchdog(getTestGwConfig(), getTestGwStatus("wg-6000"),
+			getTestPodEndpoint("pod1", testName), getTestPodEndpoint("pod2", testName), getTestPodEndpoint("pod3", "other"))
+		expectLink(nil, netlink.LinkNotFoundError{})
+
+		Expect(w.check(context.TODO())).To(Succeed())
+		Expect(gatewayEvents).To(HaveLen(1))
+		Expect(client.ObjectKeyFromObject((<-gatewayEvents).Object).Name).To(Equal(testName))
+		Expect(peerEvents).To(HaveLen(2))
+		Expect([]string{(<-peerEvents).Object.GetName(), (<-peerEvents).Object.GetName()}).To(ConsistOf("pod1", "pod2"))
+		Expect(recorder.Events).To(HaveLen(1))
+		Expect(<-recorder.Events).To(Equal(fmt.Sprintf("Warning WireguardDeviceRecreated Wireguard device wg-6000 is missing on node %s, recreating it and re-applying its peers", testNodeName)))
+		Expect(testutil.ToFloat64(GatewayWireguardDeviceRecreateCount.WithLabelValues(testNamespace, testName))).To(Equal(float64(1)))
+	})
+
+	It("should not check gateways not configured on the node", func() {
+		getTestWatchdog(getTestGwConfig(), getTestGwStatus("wg-6001"))
+
+		Expect(w.check(context.TODO())).To(Succeed())
+		Expect(gatewayEvents).To(BeEmpty())
+	})
+
+	It("should report error failing to get the wireguard device", func() {
+		getTestWatchdog(getTestGwConfig(), getTestGwStatus("wg-6000"))
+		expectLink(nil, fmt.Errorf("failed"))
+
+		// other network namespaces are still checked
+		Expect(w.check(context.TODO())).To(Succeed())
+		Expect(gatewayEvents).To(BeEmpty())
+		Expect(testutil.CollectAndCount(GatewayWireguardDeviceRecreateCount)).To(BeZero())
+	})
+})
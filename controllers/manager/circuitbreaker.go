@@ -0,0 +1,76 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package manager
+
+import (
+	"context"
+	"errors"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/azmanager"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+)
+
+// handleAzureCircuit reports on gwConfig status whether Azure calls of a reconcile, which returned reconcileErr,
+// were short-circuited by an open circuit breaker. It returns true with the result to requeue the reconcile once the
+// circuit half-opens if they were, instead of returning the error for backoff that would retry earlier and fill logs.
+// The condition is shared by gateway LB and VM configuration reconciles, so it is only removed after a successful
+// reconcile when no circuit is open anymore.
+func handleAzureCircuit(
+	ctx context.Context,
+	c client.Client,
+	recorder record.EventRecorder,
+	az *azmanager.AzureManager,
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+	reconcileErr error,
+) (bool, ctrl.Result, error) {
+	var circuitErr *azmanager.CircuitOpenError
+	if errors.As(reconcileErr, &circuitErr) {
+		recorder.Event(gwConfig, corev1.EventTypeWarning, consts.SGCAzureAvailableReasonCircuitOpen, circuitErr.Error())
+		return true, ctrl.Result{RequeueAfter: circuitErr.RetryAfter}, setAzureAvailableCondition(ctx, c, gwConfig, circuitErr)
+	}
+	if reconcileErr == nil && !az.CircuitOpen() {
+		return false, ctrl.Result{}, setAzureAvailableCondition(ctx, c, gwConfig, nil)
+	}
+	return false, ctrl.Result{}, nil
+}
+
+// setAzureAvailableCondition sets the Azure available condition of gwConfig to false with circuitErr, or removes
+// the condition when circuitErr is nil
+func setAzureAvailableCondition(
+	ctx context.Context,
+	c client.Client,
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+	circuitErr *azmanager.CircuitOpenError,
+) error {
+	patch := client.MergeFrom(gwConfig.DeepCopy())
+	var changed bool
+	if circuitErr == nil {
+		changed = meta.RemoveStatusCondition(&gwConfig.Status.Conditions, consts.SGCAzureAvailableConditionType)
+	} else {
+		changed = meta.SetStatusCondition(&gwConfig.Status.Conditions, metav1.Condition{
+			Type:               consts.SGCAzureAvailableConditionType,
+			Status:             metav1.ConditionFalse,
+			Reason:             consts.SGCAzureAvailableReasonCircuitOpen,
+			Message:            circuitErr.Error(),
+			ObservedGeneration: gwConfig.Generation,
+		})
+	}
+	if !changed {
+		return nil
+	}
+	if err := c.Status().Patch(ctx, gwConfig, patch); err != nil {
+		log.FromContext(ctx).Error(err, "failed to update Azure available condition of StaticGatewayConfiguration")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package manager
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/fqdn"
+	"github.com/Azure/kube-egress-gateway/pkg/logger"
+)
+
+var _ reconcile.Reconciler = &ExcludeFQDNReconciler{}
+
+// ExcludeFQDNReconciler resolves spec.excludeFqdns of StaticGatewayConfigurations and reports the resolved CIDRs in
+// status.resolvedExcludeCidrs. It is the only writer of that status field, the cni manager pushes changes to pods.
+type ExcludeFQDNReconciler struct {
+	client.Client
+	FQDNCache *fqdn.Cache
+}
+
+//+kubebuilder:rbac:groups=egressgateway.kubernetes.azure.com,resources=staticgatewayconfigurations,verbs=get;list;watch
+//+kubebuilder:rbac:groups=egressgateway.kubernetes.azure.com,resources=staticgatewayconfigurations/status,verbs=get;update;patch
+
+func (r *ExcludeFQDNReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	gwConfig := &egressgatewayv1alpha1.StaticGatewayConfiguration{}
+	if err := r.Get(ctx, req.NamespacedName, gwConfig); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "unable to fetch StaticGatewayConfiguration instance")
+		return ctrl.Result{}, err
+	}
+	if !gwConfig.ObjectMeta.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+	ctx = logger.WithGateway(ctx, gwConfig)
+
+	// Requeue before the resolved records expire
+	requeueAfter, err := r.reconcileExcludeFQDNs(ctx, gwConfig)
+	return ctrl.Result{RequeueAfter: requeueAfter}, err
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ExcludeFQDNReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.FQDNCache == nil {
+		resolver, err := fqdn.NewResolver()
+		if err != nil {
+			return err
+		}
+		r.FQDNCache = fqdn.NewCache(resolver)
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("excludefqdn").
+		// status updates, including the ones of this controller, don't change what to resolve
+		For(&egressgatewayv1alpha1.StaticGatewayConfiguration{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
+
+// reconcileExcludeFQDNs resolves spec.excludeFqdns and reports the resolved CIDRs in gwConfig status,
+// the returned duration is when the earliest resolved record expires
+func (r *ExcludeFQDNReconciler) reconcileExcludeFQDNs(
+	ctx context.Context,
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+) (time.Duration, error) {
+	log := log.FromContext(ctx)
+
+	var resolvedCidrs []string
+	var requeueAfter time.Duration
+	if len(gwConfig.Spec.ExcludeFQDNs) > 0 {
+		ips, nextRefresh, err := r.FQDNCache.Resolve(ctx, gwConfig.Spec.ExcludeFQDNs)
+		if err != nil {
+			// keep last known good CIDRs in status, retry later
+			log.Error(err, "failed to resolve excluded FQDNs")
+			return nextRefresh, nil
+		}
+		resolvedCidrs = fqdn.ToExcludeCidrs(ips, gwConfig.Spec.ExcludeCidrs)
+		requeueAfter = nextRefresh
+	}
+
+	if slices.Equal(resolvedCidrs, gwConfig.Status.ResolvedExcludeCidrs) {
+		return requeueAfter, nil
+	}
+
+	original := gwConfig.DeepCopy()
+	gwConfig.Status.ResolvedExcludeCidrs = resolvedCidrs
+	if err := r.Status().Patch(ctx, gwConfig, client.MergeFrom(original)); err != nil {
+		return 0, fmt.Errorf("failed to update resolved exclude CIDRs of StaticGatewayConfiguration %s/%s: %w", gwConfig.Namespace, gwConfig.Name, err)
+	}
+	log.Info("Updated resolved exclude CIDRs", "resolvedExcludeCidrs", resolvedCidrs)
+	return requeueAfter, nil
+}
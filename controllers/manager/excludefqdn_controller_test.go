@@ -0,0 +1,102 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/fqdn"
+)
+
+var _ = Describe("ExcludeFQDN controller unit tests", func() {
+	var (
+		r        *ExcludeFQDNReconciler
+		req      ctrl.Request
+		gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration
+		resolver *fakeResolver
+	)
+
+	BeforeEach(func() {
+		req = ctrl.Request{NamespacedName: types.NamespacedName{Name: testName, Namespace: testNamespace}}
+		gwConfig = &egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: testName, Namespace: testNamespace},
+			Spec: egressgatewayv1alpha1.StaticGatewayConfigurationSpec{
+				ExcludeCidrs: []string{"10.0.0.0/16"},
+				ExcludeFQDNs: []string{"a.example.com", "b.example.com"},
+			},
+		}
+		resolver = &fakeResolver{records: map[string][]net.IP{
+			"a.example.com": {net.ParseIP("1.2.3.4"), net.ParseIP("10.0.1.1")},
+			"b.example.com": {net.ParseIP("1.2.3.4"), net.ParseIP("5.6.7.8")},
+		}}
+		r = &ExcludeFQDNReconciler{
+			Client:    fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(gwConfig).WithStatusSubresource(gwConfig).Build(),
+			FQDNCache: fqdn.NewCache(resolver),
+		}
+	})
+
+	It("should report resolved CIDRs in status and requeue before they expire", func() {
+		res, err := r.Reconcile(context.TODO(), req)
+		Expect(err).To(BeNil())
+		Expect(res.RequeueAfter).To(Equal(fqdn.MinRefreshInterval))
+		existing := &egressgatewayv1alpha1.StaticGatewayConfiguration{}
+		Expect(r.Get(context.TODO(), req.NamespacedName, existing)).To(Succeed())
+		Expect(existing.Status.ResolvedExcludeCidrs).To(Equal([]string{"1.2.3.4/32", "5.6.7.8/32"}))
+	})
+
+	It("should keep last known good CIDRs when resolution fails", func() {
+		gwConfig.Status.ResolvedExcludeCidrs = []string{"1.2.3.4/32"}
+		Expect(r.Status().Update(context.TODO(), gwConfig)).To(Succeed())
+		resolver.err = errors.New("timeout")
+		_, err := r.Reconcile(context.TODO(), req)
+		Expect(err).To(BeNil())
+		existing := &egressgatewayv1alpha1.StaticGatewayConfiguration{}
+		Expect(r.Get(context.TODO(), req.NamespacedName, existing)).To(Succeed())
+		Expect(existing.Status.ResolvedExcludeCidrs).To(Equal([]string{"1.2.3.4/32"}))
+	})
+
+	It("should clear resolved CIDRs when no FQDN is excluded", func() {
+		gwConfig.Status.ResolvedExcludeCidrs = []string{"1.2.3.4/32"}
+		Expect(r.Status().Update(context.TODO(), gwConfig)).To(Succeed())
+		gwConfig.Spec.ExcludeFQDNs = nil
+		Expect(r.Update(context.TODO(), gwConfig)).To(Succeed())
+		res, err := r.Reconcile(context.TODO(), req)
+		Expect(err).To(BeNil())
+		Expect(res.RequeueAfter).To(BeZero())
+		existing := &egressgatewayv1alpha1.StaticGatewayConfiguration{}
+		Expect(r.Get(context.TODO(), req.NamespacedName, existing)).To(Succeed())
+		Expect(existing.Status.ResolvedExcludeCidrs).To(BeEmpty())
+	})
+
+	It("should ignore not found gateway", func() {
+		req.Name = "notfound"
+		res, err := r.Reconcile(context.TODO(), req)
+		Expect(err).To(BeNil())
+		Expect(res).To(Equal(ctrl.Result{}))
+	})
+})
+
+type fakeResolver struct {
+	records map[string][]net.IP
+	err     error
+}
+
+func (f *fakeResolver) LookupIPv4(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	if f.err != nil {
+		return nil, 0, f.err
+	}
+	return f.records[host], time.Second, nil
+}
@@ -7,11 +7,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
 	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
 	network "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
 	corev1 "k8s.io/api/core/v1"
@@ -20,13 +21,18 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
 	"github.com/Azure/kube-egress-gateway/pkg/azmanager"
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients"
 	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/logger"
 	"github.com/Azure/kube-egress-gateway/pkg/metrics"
 	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
 )
@@ -37,8 +43,24 @@ type GatewayLBConfigurationReconciler struct {
 	*azmanager.AzureManager
 	Recorder    record.EventRecorder
 	LBProbePort int
+	// MaxConcurrentReconciles is the maximum number of GatewayLBConfigurations reconciled at the same time,
+	// LB updates are serialized regardless
+	MaxConcurrentReconciles int
+	// GracefulShutdownTimeout is how long in-flight reconciles may run after the manager is stopped before their
+	// context is cancelled, 0 cancels them right away
+	GracefulShutdownTimeout time.Duration
+
+	// vnetAddressSpace caches the address space of the cluster virtual network, which is read again after
+	// vnetAddressSpaceRefreshInterval
+	vnetLock               sync.Mutex
+	vnetAddressSpace       []string
+	vnetAddressSpaceReadAt time.Time
 }
 
+// vnetAddressSpaceRefreshInterval is how long the address space of the cluster virtual network is cached, it
+// rarely changes and is read for every gateway otherwise
+const vnetAddressSpaceRefreshInterval = 10 * time.Minute
+
 type lbPropertyNames struct {
 	frontendName string
 	backendName  string
@@ -81,17 +103,36 @@ func (r *GatewayLBConfigurationReconciler) Reconcile(ctx context.Context, req ct
 		log.Error(err, "unable to fetch StaticGatewayConfiguration instance")
 		return ctrl.Result{}, err
 	}
+	ctx = logger.WithGateway(ctx, gwConfig)
+
+	// the gateway LoadBalancer is in the subscription of the gateway VMSSes
+	az, err := gatewayAzureManager(r.AzureManager, lbConfig.Spec.GatewayVmssProfile)
+	if err != nil {
+		log.Error(err, "failed to get Azure clients of gateway subscription")
+		r.Recorder.Event(gwConfig, corev1.EventTypeWarning, "ReconcileGatewayLBConfigurationError", err.Error())
+		return ctrl.Result{}, err
+	}
 
 	if !lbConfig.ObjectMeta.DeletionTimestamp.IsZero() {
 		// Clean up gatewayLBConfiguration
-		res, err := r.ensureDeleted(ctx, lbConfig)
+		res, err := r.ensureDeleted(ctx, az, lbConfig)
 		if err != nil {
 			r.Recorder.Event(gwConfig, corev1.EventTypeWarning, "EnsureDeleteGatewayLBConfigurationError", err.Error())
 		}
 		return res, err
 	}
 
-	res, err := r.reconcile(ctx, lbConfig)
+	if isReconcilePaused(gwConfig) {
+		log.Info("Reconciliation is paused, leaving Azure resources as they are")
+		return ctrl.Result{}, nil
+	}
+
+	res, err := r.reconcile(ctx, az, lbConfig)
+	if circuitOpen, circuitRes, circuitErr := handleAzureCircuit(ctx, r.Client, r.Recorder, az, gwConfig, err); circuitOpen {
+		return circuitRes, circuitErr
+	} else if circuitErr != nil && err == nil {
+		return ctrl.Result{}, circuitErr
+	}
 	if err != nil {
 		r.Recorder.Event(gwConfig, corev1.EventTypeWarning, "ReconcileGatewayLBConfigurationError", err.Error())
 	} else {
@@ -105,25 +146,32 @@ func (r *GatewayLBConfigurationReconciler) SetupWithManager(mgr ctrl.Manager) er
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&egressgatewayv1alpha1.GatewayLBConfiguration{}).
 		Owns(&egressgatewayv1alpha1.GatewayVMConfiguration{}).
-		Complete(r)
+		// gateway configurations share the namespaced name of their GatewayLBConfiguration
+		Watches(&egressgatewayv1alpha1.StaticGatewayConfiguration{}, &handler.EnqueueRequestForObject{}, builder.WithPredicates(reconcileUnpaused())).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Complete(withGracefulShutdown(r, r.GracefulShutdownTimeout))
 }
 
 func (r *GatewayLBConfigurationReconciler) reconcile(
 	ctx context.Context,
+	az *azmanager.AzureManager,
 	lbConfig *egressgatewayv1alpha1.GatewayLBConfiguration,
-) (ctrl.Result, error) {
+) (_ ctrl.Result, rerr error) {
 	log := log.FromContext(ctx)
 	log.Info(fmt.Sprintf("Reconciling GatewayLBConfiguration %s/%s", lbConfig.Namespace, lbConfig.Name))
 
 	mc := metrics.NewMetricsContext(
 		os.Getenv(consts.PodNamespaceEnvKey),
 		"reconcile_gateway_lb_configuration",
-		r.SubscriptionID(),
-		r.LoadBalancerResourceGroup,
+		az.SubscriptionID(),
+		az.LoadBalancerResourceGroup,
 		strings.ToLower(fmt.Sprintf("%s/%s", lbConfig.Namespace, lbConfig.Name)),
 	)
 	succeeded := false
-	defer func() { mc.ObserveControllerReconcileMetrics(succeeded) }()
+	defer func() {
+		mc.ObserveControllerReconcileMetrics(succeeded)
+		mc.ObserveControllerReconcileError(rerr)
+	}()
 
 	if !controllerutil.ContainsFinalizer(lbConfig, consts.LBConfigFinalizerName) {
 		log.Info("Adding finalizer")
@@ -139,7 +187,7 @@ func (r *GatewayLBConfigurationReconciler) reconcile(
 	lbConfig.DeepCopyInto(existing)
 
 	// reconcile LB rule
-	ip, port, err := r.reconcileLBRule(ctx, lbConfig, true)
+	ip, port, err := r.reconcileLBRule(ctx, az, lbConfig, true)
 	if err != nil {
 		log.Error(err, "failed to reconcile LB rules")
 		return ctrl.Result{}, err
@@ -156,6 +204,12 @@ func (r *GatewayLBConfigurationReconciler) reconcile(
 	}
 	lbConfig.Status.FrontendIp = ip
 	lbConfig.Status.ServerPort = port
+	// the reported address space is kept when the virtual network cannot be read, it only narrows sNAT
+	if vnetAddressSpace, err := r.getVnetAddressSpace(ctx); err != nil {
+		log.Error(err, "failed to get virtual network address space")
+	} else {
+		lbConfig.Status.VnetAddressSpace = vnetAddressSpace
+	}
 
 	if !equality.Semantic.DeepEqual(existing, lbConfig) {
 		log.Info(fmt.Sprintf("Updating GatewayLBConfiguration %s/%s", lbConfig.Namespace, lbConfig.Name))
@@ -171,8 +225,9 @@ func (r *GatewayLBConfigurationReconciler) reconcile(
 
 func (r *GatewayLBConfigurationReconciler) ensureDeleted(
 	ctx context.Context,
+	az *azmanager.AzureManager,
 	lbConfig *egressgatewayv1alpha1.GatewayLBConfiguration,
-) (ctrl.Result, error) {
+) (_ ctrl.Result, rerr error) {
 	log := log.FromContext(ctx)
 	log.Info(fmt.Sprintf("Reconciling gatewayLBConfiguration deletion %s/%s", lbConfig.Namespace, lbConfig.Name))
 
@@ -184,12 +239,15 @@ func (r *GatewayLBConfigurationReconciler) ensureDeleted(
 	mc := metrics.NewMetricsContext(
 		os.Getenv(consts.PodNamespaceEnvKey),
 		"delete_gateway_lb_configuration",
-		r.SubscriptionID(),
-		r.LoadBalancerResourceGroup,
+		az.SubscriptionID(),
+		az.LoadBalancerResourceGroup,
 		strings.ToLower(fmt.Sprintf("%s/%s", lbConfig.Namespace, lbConfig.Name)),
 	)
 	succeeded := false
-	defer func() { mc.ObserveControllerReconcileMetrics(succeeded) }()
+	defer func() {
+		mc.ObserveControllerReconcileMetrics(succeeded)
+		mc.ObserveControllerReconcileError(rerr)
+	}()
 
 	log.Info("Deleting VMConfig")
 	vmConfig := &egressgatewayv1alpha1.GatewayVMConfiguration{
@@ -209,7 +267,7 @@ func (r *GatewayLBConfigurationReconciler) ensureDeleted(
 	} // vmConfig is already deleted, continue to clean up lb
 
 	// delete LB rule
-	_, _, err := r.reconcileLBRule(ctx, lbConfig, false)
+	_, _, err := r.reconcileLBRule(ctx, az, lbConfig, false)
 	if err != nil {
 		log.Error(err, "failed to reconcile LB rules")
 		return ctrl.Result{}, err
@@ -243,13 +301,12 @@ func getLBPropertyName(
 	return names, nil
 }
 
-func (r *GatewayLBConfigurationReconciler) getGatewayLB(ctx context.Context) (*network.LoadBalancer, error) {
-	lb, err := r.GetLB(ctx)
+func (r *GatewayLBConfigurationReconciler) getGatewayLB(ctx context.Context, az *azmanager.AzureManager) (*network.LoadBalancer, error) {
+	lb, err := az.GetLB(ctx)
 	if err == nil {
 		return lb, nil
 	}
-	var respErr *azcore.ResponseError
-	if errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound {
+	if errors.As(err, new(*azureclients.ErrNotFound)) {
 		return nil, nil
 	}
 	return nil, err
@@ -257,10 +314,11 @@ func (r *GatewayLBConfigurationReconciler) getGatewayLB(ctx context.Context) (*n
 
 func (r *GatewayLBConfigurationReconciler) getGatewayVMSS(
 	ctx context.Context,
+	az *azmanager.AzureManager,
 	lbConfig *egressgatewayv1alpha1.GatewayLBConfiguration,
 ) (*compute.VirtualMachineScaleSet, error) {
 	if lbConfig.Spec.GatewayNodepoolName != "" {
-		vmssList, err := r.ListVMSS(ctx)
+		vmssList, err := az.ListVMSS(ctx, "")
 		if err != nil {
 			return nil, err
 		}
@@ -272,10 +330,12 @@ func (r *GatewayLBConfigurationReconciler) getGatewayVMSS(
 				}
 			}
 		}
-	} else {
-		vmss, err := r.GetVMSS(ctx, lbConfig.Spec.VmssResourceGroup, lbConfig.Spec.VmssName)
+	} else if vmssRefs := lbConfig.Spec.GatewayVmssProfile.VmssReferences(); len(vmssRefs) > 0 {
+		// LB frontend and backend pool of a gateway spanning multiple VMSSes are the ones of the first VMSS,
+		// instances of the other VMSSes join the same backend pool
+		vmss, err := az.GetVMSS(ctx, vmssRefs[0].VmssResourceGroup, vmssRefs[0].VmssName)
 		if err != nil {
-			return nil, err
+			return nil, checkSubscriptionAccess(lbConfig.Spec.GatewayVmssProfile, err)
 		}
 		return vmss, nil
 	}
@@ -284,29 +344,34 @@ func (r *GatewayLBConfigurationReconciler) getGatewayVMSS(
 
 func (r *GatewayLBConfigurationReconciler) reconcileLBRule(
 	ctx context.Context,
+	az *azmanager.AzureManager,
 	lbConfig *egressgatewayv1alpha1.GatewayLBConfiguration,
 	needLB bool,
 ) (string, int32, error) {
 	log := log.FromContext(ctx)
+	// rules of all gateways of the subscription live in the same LB, serialize updates from concurrent reconciles
+	defer az.LockLB()()
 	frontendIP := ""
 	var lbPort int32
 	updateLB := false
 	deleteFrontend := false
 
 	// get LoadBalancer
-	lb, err := r.getGatewayLB(ctx)
+	lb, err := r.getGatewayLB(ctx, az)
 	if err != nil {
 		log.Error(err, "failed to get LoadBalancer")
 		return "", 0, err
 	}
 	if lb == nil {
 		if !needLB {
-			log.Info(fmt.Sprintf("gateway lb(%s) not found, no more clean up needed", r.LoadBalancerName()))
+			log.Info(fmt.Sprintf("gateway lb(%s) not found, no more clean up needed", az.LoadBalancerName()))
 			return "", 0, nil
+		} else if az.UseExistingLB() {
+			return "", 0, fmt.Errorf("existing load balancer %s not found", az.ExistingLoadBalancerID)
 		} else {
 			lb = &network.LoadBalancer{
-				Name:     to.Ptr(r.LoadBalancerName()),
-				Location: to.Ptr(r.Location()),
+				Name:     to.Ptr(az.LoadBalancerName()),
+				Location: to.Ptr(az.Location()),
 				SKU: &network.LoadBalancerSKU{
 					Name: to.Ptr(network.LoadBalancerSKUNameStandard),
 					Tier: to.Ptr(network.LoadBalancerSKUTierRegional),
@@ -319,7 +384,7 @@ func (r *GatewayLBConfigurationReconciler) reconcileLBRule(
 
 	// get gateway VMSS
 	// we need this because each gateway vmss needs one frontendConfig and one backendpool
-	vmss, err := r.getGatewayVMSS(ctx, lbConfig)
+	vmss, err := r.getGatewayVMSS(ctx, az, lbConfig)
 	if err != nil {
 		log.Error(err, "failed to get vmss")
 		return "", 0, err
@@ -336,27 +401,27 @@ func (r *GatewayLBConfigurationReconciler) reconcileLBRule(
 		return "", 0, fmt.Errorf("lb property is empty")
 	}
 
-	frontendID := r.GetLBFrontendIPConfigurationID(names.frontendName)
+	frontendID := az.GetLBFrontendIPConfigurationID(names.frontendName)
 	frontendIP, err = findFrontendIP(lb, names.frontendName)
 	if err != nil {
 		return "", 0, err
 	}
 	if frontendIP == "" {
 		if needLB {
-			subnet, err := r.GetSubnet(ctx)
+			subnetID, err := r.getFrontendSubnetID(ctx, az, vmss)
 			if err != nil {
 				log.Error(err, "failed to get subnet")
 				return "", 0, err
 			}
 			lb.Properties.FrontendIPConfigurations =
-				append(lb.Properties.FrontendIPConfigurations, getExpectedFrontendConfig(to.Ptr(names.frontendName), subnet.ID))
+				append(lb.Properties.FrontendIPConfigurations, getExpectedFrontendConfig(to.Ptr(names.frontendName), subnetID))
 			updateLB = true
 		}
 	} else {
 		log.Info("Found LB frontendIPConfiguration", "frontendIP", frontendIP)
 	}
 
-	backendID := r.GetLBBackendAddressPoolID(names.backendName)
+	backendID := az.GetLBBackendAddressPoolID(names.backendName)
 	foundBackend := false
 	for _, backendPool := range lb.Properties.BackendAddressPools {
 		if strings.EqualFold(*backendPool.Name, names.backendName) &&
@@ -374,7 +439,7 @@ func (r *GatewayLBConfigurationReconciler) reconcileLBRule(
 		}
 	}
 
-	probeID := r.GetLBProbeID(names.probeName)
+	probeID := az.GetLBProbeID(names.probeName)
 	expectedLBRule := getExpectedLBRule(&names.lbRuleName, frontendID, backendID, probeID)
 	expectedProbe := getExpectedLBProbe(&names.probeName, r.LBProbePort, lbConfig)
 
@@ -390,6 +455,9 @@ func (r *GatewayLBConfigurationReconciler) reconcileLBRule(
 				} else if !sameLBRuleConfig(ctx, lbRule, expectedLBRule) {
 					log.Info("Found LB rule with different configuration, dropping")
 					lbRules = append(lbRules[:i], lbRules[i+1:]...)
+				} else if lbConfig.Spec.WireguardPort != 0 && to.Val(lbRule.Properties.FrontendPort) != lbConfig.Spec.WireguardPort {
+					log.Info("Found LB rule with different port, dropping", "port", to.Val(lbRule.Properties.FrontendPort))
+					lbRules = append(lbRules[:i], lbRules[i+1:]...)
 				} else {
 					log.Info("Found expected LB rule, keeping")
 					foundRule = true
@@ -399,7 +467,7 @@ func (r *GatewayLBConfigurationReconciler) reconcileLBRule(
 			}
 		}
 		if !foundRule {
-			port, err := selectPortForLBRule(expectedLBRule, lbRules)
+			port, err := selectPortForLBRule(expectedLBRule, lbRules, lbConfig.Spec.WireguardPort)
 			if err != nil {
 				return "", 0, err
 			}
@@ -491,9 +559,10 @@ func (r *GatewayLBConfigurationReconciler) reconcileLBRule(
 			}
 		}
 
-		if len(lb.Properties.FrontendIPConfigurations) == 0 {
+		// an existing load balancer may carry other services, only our own frontend, backend and rules are removed
+		if len(lb.Properties.FrontendIPConfigurations) == 0 && !az.UseExistingLB() {
 			log.Info("Deleting load balancer")
-			if err := r.DeleteLB(ctx); err != nil {
+			if err := az.DeleteLB(ctx); err != nil {
 				log.Error(err, "failed to delete LB")
 				return "", 0, err
 			}
@@ -503,7 +572,7 @@ func (r *GatewayLBConfigurationReconciler) reconcileLBRule(
 
 	if updateLB {
 		log.Info("Updating load balancer")
-		updatedLB, err := r.CreateOrUpdateLB(ctx, *lb)
+		updatedLB, err := az.CreateOrUpdateLB(ctx, *lb)
 		if err != nil {
 			log.Error(err, "failed to update LB")
 			return "", 0, err
@@ -514,6 +583,11 @@ func (r *GatewayLBConfigurationReconciler) reconcileLBRule(
 				log.Error(err, "failed to find frontend ip")
 				return "", 0, err
 			} else if frontendIP == "" {
+				if az.DryRun {
+					// frontend is not actually added in dry run mode
+					log.Info("Dry run, frontend ip not allocated")
+					return "", lbPort, nil
+				}
 				return "", 0, fmt.Errorf("frontend ip not found even after updating lb")
 			}
 		}
@@ -522,6 +596,67 @@ func (r *GatewayLBConfigurationReconciler) reconcileLBRule(
 	return frontendIP, lbPort, nil
 }
 
+// getFrontendSubnetID returns the subnet of the gateway LB frontend, which is the cluster subnet. VMSSes can only
+// join a LoadBalancer in their own virtual network, so the LoadBalancer of a gateway in another subscription is in
+// the virtual network of the gateway VMSS and its frontend takes the subnet of the VMSS. Pods reach it through the
+// peering of that virtual network with the cluster one, which is checked here.
+func (r *GatewayLBConfigurationReconciler) getFrontendSubnetID(
+	ctx context.Context,
+	az *azmanager.AzureManager,
+	vmss *compute.VirtualMachineScaleSet,
+) (*string, error) {
+	if az == r.AzureManager {
+		subnet, err := az.GetSubnet(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return subnet.ID, nil
+	}
+
+	subnetID := getVMSSPrimarySubnetID(vmss)
+	subnetResourceID, err := arm.ParseResourceID(subnetID)
+	if err != nil || subnetResourceID.Parent == nil {
+		return nil, fmt.Errorf("gateway vmss(%s) has no primary ipConfig subnet", to.Val(vmss.Name))
+	}
+	vnetID := subnetResourceID.Parent.String()
+	vnet, err := az.GetVirtualNetworkByID(ctx, vnetID)
+	if err != nil {
+		return nil, err
+	}
+	clusterVnetID := r.GetVirtualNetworkID()
+	if vnet.Properties != nil {
+		for _, peering := range vnet.Properties.VirtualNetworkPeerings {
+			if peering.Properties == nil || peering.Properties.RemoteVirtualNetwork == nil {
+				continue
+			}
+			if strings.EqualFold(to.Val(peering.Properties.RemoteVirtualNetwork.ID), clusterVnetID) &&
+				to.Val(peering.Properties.PeeringState) == network.VirtualNetworkPeeringStateConnected {
+				return to.Ptr(subnetID), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("gateway virtual network(%s) is not peered with the cluster virtual network(%s), "+
+		"pods could not reach the gateway LoadBalancer", vnetID, clusterVnetID)
+}
+
+// getVMSSPrimarySubnetID returns the subnet of the primary ipConfig of the vmss primary network interface
+func getVMSSPrimarySubnetID(vmss *compute.VirtualMachineScaleSet) string {
+	if vmss.Properties == nil || vmss.Properties.VirtualMachineProfile == nil || vmss.Properties.VirtualMachineProfile.NetworkProfile == nil {
+		return ""
+	}
+	for _, nic := range vmss.Properties.VirtualMachineProfile.NetworkProfile.NetworkInterfaceConfigurations {
+		if nic.Properties == nil || !to.Val(nic.Properties.Primary) {
+			continue
+		}
+		for _, ipConfig := range nic.Properties.IPConfigurations {
+			if ipConfig.Properties != nil && to.Val(ipConfig.Properties.Primary) && ipConfig.Properties.Subnet != nil {
+				return to.Val(ipConfig.Properties.Subnet.ID)
+			}
+		}
+	}
+	return ""
+}
+
 func findFrontendIP(
 	lb *network.LoadBalancer,
 	frontendName string,
@@ -652,7 +787,9 @@ func sameLBRuleConfig(ctx context.Context, lbRule1, lbRule2 *network.LoadBalanci
 	return true
 }
 
-func selectPortForLBRule(targetRule *network.LoadBalancingRule, lbRules []*network.LoadBalancingRule) (int32, error) {
+// selectPortForLBRule returns requestedPort if it is not zero and not used by other rules of the same backend pool,
+// otherwise the first free port in the wireguard port range
+func selectPortForLBRule(targetRule *network.LoadBalancingRule, lbRules []*network.LoadBalancingRule, requestedPort int32) (int32, error) {
 	ports := make([]bool, consts.WireguardPortEnd-consts.WireguardPortStart)
 	for _, rule := range lbRules {
 		if rule.Properties != nil && rule.Properties.BackendAddressPool != nil &&
@@ -664,6 +801,15 @@ func selectPortForLBRule(targetRule *network.LoadBalancingRule, lbRules []*netwo
 			ports[*rule.Properties.BackendPort-consts.WireguardPortStart] = true
 		}
 	}
+	if requestedPort != 0 {
+		if requestedPort < consts.WireguardPortStart || requestedPort >= consts.WireguardPortEnd {
+			return 0, fmt.Errorf("selectPortForLBRule: requested port %d is out of range", requestedPort)
+		}
+		if ports[requestedPort-consts.WireguardPortStart] {
+			return 0, fmt.Errorf("selectPortForLBRule: requested port %d is used by another gateway on the same nodepool", requestedPort)
+		}
+		return requestedPort, nil
+	}
 	for i, portInUse := range ports {
 		if !portInUse {
 			return int32(i) + consts.WireguardPortStart, nil
@@ -672,6 +818,36 @@ func selectPortForLBRule(targetRule *network.LoadBalancingRule, lbRules []*netwo
 	return 0, fmt.Errorf("selectPortForLBRule: No available ports")
 }
 
+// getVnetAddressSpace returns the address prefixes of the cluster virtual network, which gateways sNAT to their
+// private IPs. The prefixes are cached for vnetAddressSpaceRefreshInterval, and until the virtual network can be
+// read again when refreshing fails.
+func (r *GatewayLBConfigurationReconciler) getVnetAddressSpace(ctx context.Context) ([]string, error) {
+	r.vnetLock.Lock()
+	defer r.vnetLock.Unlock()
+	if !r.vnetAddressSpaceReadAt.IsZero() && time.Since(r.vnetAddressSpaceReadAt) < vnetAddressSpaceRefreshInterval {
+		return r.vnetAddressSpace, nil
+	}
+
+	vnet, err := r.GetVirtualNetwork(ctx)
+	if err != nil {
+		if !r.vnetAddressSpaceReadAt.IsZero() {
+			log.FromContext(ctx).Error(err, "failed to refresh virtual network address space, keeping the cached one")
+			return r.vnetAddressSpace, nil
+		}
+		return nil, err
+	}
+	var prefixes []string
+	if vnet.Properties != nil && vnet.Properties.AddressSpace != nil {
+		for _, prefix := range vnet.Properties.AddressSpace.AddressPrefixes {
+			if to.Val(prefix) != "" {
+				prefixes = append(prefixes, to.Val(prefix))
+			}
+		}
+	}
+	r.vnetAddressSpace, r.vnetAddressSpaceReadAt = prefixes, time.Now()
+	return prefixes, nil
+}
+
 func (r *GatewayLBConfigurationReconciler) reconcileGatewayVMConfig(
 	ctx context.Context,
 	lbConfig *egressgatewayv1alpha1.GatewayLBConfiguration,
@@ -689,6 +865,13 @@ func (r *GatewayLBConfigurationReconciler) reconcileGatewayVMConfig(
 		vmConfig.Spec.GatewayVmssProfile = lbConfig.Spec.GatewayVmssProfile
 		vmConfig.Spec.ProvisionPublicIps = lbConfig.Spec.ProvisionPublicIps
 		vmConfig.Spec.PublicIpPrefixId = lbConfig.Spec.PublicIpPrefixId
+		vmConfig.Spec.PublicIpPrefixCount = lbConfig.Spec.PublicIpPrefixCount
+		vmConfig.Spec.ReusePublicIpPrefix = lbConfig.Spec.ReusePublicIpPrefix
+		vmConfig.Spec.EnableIPv6 = lbConfig.Spec.EnableIPv6
+		vmConfig.Spec.NatGatewayId = lbConfig.Spec.NatGatewayId
+		vmConfig.Spec.PublicIpAddressId = lbConfig.Spec.PublicIpAddressId
+		vmConfig.Spec.OutboundIdleTimeoutMinutes = lbConfig.Spec.OutboundIdleTimeoutMinutes
+		vmConfig.Spec.Tags = lbConfig.Spec.Tags
 		return controllerutil.SetControllerReference(lbConfig, vmConfig, r.Client.Scheme())
 	}); err != nil {
 		log.Error(err, "failed to reconcile gateway vm configuration")
@@ -701,6 +884,12 @@ func (r *GatewayLBConfigurationReconciler) reconcileGatewayVMConfig(
 			lbConfig.Status = &egressgatewayv1alpha1.GatewayLBConfigurationStatus{}
 		}
 		lbConfig.Status.EgressIpPrefix = vmConfig.Status.EgressIpPrefix
+		lbConfig.Status.EgressIpv6Prefix = vmConfig.Status.EgressIpv6Prefix
+		lbConfig.Status.OutboundType = vmConfig.Status.OutboundType
+		lbConfig.Status.PublicIpPrefixReused = vmConfig.Status.PublicIpPrefixReused
+		lbConfig.Status.OutboundIdleTimeoutMinutes = vmConfig.Status.OutboundIdleTimeoutMinutes
+		lbConfig.Status.GatewayInstances = vmConfig.Status.GatewayInstances
+		lbConfig.Status.GatewayNodes = vmConfig.Status.GatewayNodes
 	}
 
 	return nil
@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
@@ -15,6 +16,7 @@ import (
 	"go.uber.org/mock/gomock"
 	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -23,10 +25,12 @@ import (
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/interfaceclient/mock_interfaceclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/loadbalancerclient/mock_loadbalancerclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/mock_azclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/publicipaddressclient/mock_publicipaddressclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/publicipprefixclient/mock_publicipprefixclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/subnetclient/mock_subnetclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetclient/mock_virtualmachinescalesetclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetvmclient/mock_virtualmachinescalesetvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualnetworkclient/mock_virtualnetworkclient"
 
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -125,6 +129,24 @@ var _ = Describe("GatewayLBConfiguration controller unit tests", func() {
 			})
 		})
 
+		When("gateway reconciliation is paused", func() {
+			It("should leave Azure resources and lbConfig as they are", func() {
+				gwConfig.Annotations = map[string]string{consts.SGCReconcilePausedAnnotation: "true"}
+				// no Azure call is expected
+				az = getMockAzureManager(gomock.NewController(GinkgoT()))
+				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(gwConfig, lbConfig).Build()
+				r = &GatewayLBConfigurationReconciler{Client: cl, AzureManager: az, Recorder: recorder, LBProbePort: lbProbePort}
+				res, reconcileErr = r.Reconcile(context.TODO(), req)
+
+				Expect(reconcileErr).To(BeNil())
+				Expect(res).To(Equal(ctrl.Result{}))
+				Expect(getResource(cl, foundLBConfig)).To(Succeed())
+				Expect(foundLBConfig.Finalizers).To(BeEmpty())
+				Expect(foundLBConfig.Status).To(BeNil())
+				Expect(apierrors.IsNotFound(getResource(cl, foundVMConfig))).To(BeTrue())
+			})
+		})
+
 		Context("TestGetGatewayVMSS", func() {
 			BeforeEach(func() {
 				az = getMockAzureManager(gomock.NewController(GinkgoT()))
@@ -134,7 +156,7 @@ var _ = Describe("GatewayLBConfiguration controller unit tests", func() {
 			It("should return error when listing vmss fails", func() {
 				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
 				mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return(nil, fmt.Errorf("failed to list vmss"))
-				vmss, err := r.getGatewayVMSS(context.Background(), lbConfig)
+				vmss, err := r.getGatewayVMSS(context.Background(), az, lbConfig)
 				Expect(vmss).To(BeNil())
 				Expect(err).To(Equal(fmt.Errorf("failed to list vmss")))
 			})
@@ -144,7 +166,7 @@ var _ = Describe("GatewayLBConfiguration controller unit tests", func() {
 				mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return([]*compute.VirtualMachineScaleSet{
 					{ID: to.Ptr("test")},
 				}, nil)
-				vmss, err := r.getGatewayVMSS(context.Background(), lbConfig)
+				vmss, err := r.getGatewayVMSS(context.Background(), az, lbConfig)
 				Expect(vmss).To(BeNil())
 				Expect(err).To(Equal(fmt.Errorf("gateway VMSS not found")))
 			})
@@ -156,7 +178,7 @@ var _ = Describe("GatewayLBConfiguration controller unit tests", func() {
 					{ID: to.Ptr("dummy")},
 					vmss,
 				}, nil)
-				foundVMSS, err := r.getGatewayVMSS(context.Background(), lbConfig)
+				foundVMSS, err := r.getGatewayVMSS(context.Background(), az, lbConfig)
 				Expect(err).To(BeNil())
 				Expect(to.Val(foundVMSS)).To(Equal(to.Val(vmss)))
 			})
@@ -165,7 +187,7 @@ var _ = Describe("GatewayLBConfiguration controller unit tests", func() {
 				lbConfig.Spec.GatewayNodepoolName = ""
 				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
 				mockVMSSClient.EXPECT().Get(gomock.Any(), "vmssRG", "vmss", gomock.Any()).Return(nil, fmt.Errorf("vmss not found"))
-				vmss, err := r.getGatewayVMSS(context.Background(), lbConfig)
+				vmss, err := r.getGatewayVMSS(context.Background(), az, lbConfig)
 				Expect(vmss).To(BeNil())
 				Expect(err).To(Equal(fmt.Errorf("vmss not found")))
 			})
@@ -175,7 +197,23 @@ var _ = Describe("GatewayLBConfiguration controller unit tests", func() {
 				vmss := &compute.VirtualMachineScaleSet{ID: to.Ptr("test")}
 				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
 				mockVMSSClient.EXPECT().Get(gomock.Any(), "vmssRG", "vmss", gomock.Any()).Return(vmss, nil)
-				foundVMSS, err := r.getGatewayVMSS(context.Background(), lbConfig)
+				foundVMSS, err := r.getGatewayVMSS(context.Background(), az, lbConfig)
+				Expect(err).To(BeNil())
+				Expect(to.Val(foundVMSS)).To(Equal(to.Val(vmss)))
+			})
+
+			It("should return the first vmss when gateway spans multiple vmsses", func() {
+				lbConfig.Spec.GatewayNodepoolName = ""
+				lbConfig.Spec.GatewayVmssProfile = egressgatewayv1alpha1.GatewayVmssProfile{
+					Vmsses: []egressgatewayv1alpha1.VmssReference{
+						{VmssResourceGroup: "vmssRG1", VmssName: "vmss1"},
+						{VmssResourceGroup: "vmssRG2", VmssName: "vmss2"},
+					},
+				}
+				vmss := &compute.VirtualMachineScaleSet{ID: to.Ptr("test")}
+				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+				mockVMSSClient.EXPECT().Get(gomock.Any(), "vmssRG1", "vmss1", gomock.Any()).Return(vmss, nil)
+				foundVMSS, err := r.getGatewayVMSS(context.Background(), az, lbConfig)
 				Expect(err).To(BeNil())
 				Expect(to.Val(foundVMSS)).To(Equal(to.Val(vmss)))
 			})
@@ -197,6 +235,31 @@ var _ = Describe("GatewayLBConfiguration controller unit tests", func() {
 				assertEqualEvents([]string{"Warning ReconcileGatewayLBConfigurationError lb not found"}, recorder.Events)
 			})
 
+			It("should report circuit breaker open on gateway and requeue after cooldown", func() {
+				az.CircuitBreakerThreshold = 1
+				az.CircuitBreakerCooldown = time.Minute
+				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(gwConfig, lbConfig).WithRuntimeObjects(gwConfig, lbConfig).Build()
+				r = &GatewayLBConfigurationReconciler{Client: cl, AzureManager: az, Recorder: recorder, LBProbePort: lbProbePort}
+				serverErr := &azcore.ResponseError{StatusCode: http.StatusServiceUnavailable}
+				mockLoadBalancerClient := az.LoadBalancerClient.(*mock_loadbalancerclient.MockInterface)
+				mockLoadBalancerClient.EXPECT().Get(gomock.Any(), testLBRG, testLBName, gomock.Any()).Return(nil, serverErr)
+				_, reconcileErr = r.Reconcile(context.TODO(), req)
+				Expect(reconcileErr).To(MatchError(serverErr))
+
+				res, reconcileErr = r.Reconcile(context.TODO(), req)
+				Expect(reconcileErr).NotTo(HaveOccurred())
+				Expect(res.RequeueAfter).To(BeNumerically("~", time.Minute, time.Second))
+				foundGWConfig := &egressgatewayv1alpha1.StaticGatewayConfiguration{}
+				Expect(getResource(cl, foundGWConfig)).To(Succeed())
+				condition := meta.FindStatusCondition(foundGWConfig.Status.Conditions, consts.SGCAzureAvailableConditionType)
+				Expect(condition).NotTo(BeNil())
+				Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+				Expect(condition.Reason).To(Equal(consts.SGCAzureAvailableReasonCircuitOpen))
+				Expect(condition.Message).To(ContainSubstring(fmt.Sprintf("Azure GetLB calls in resource group(%s) of subscription(%s) are suspended", testLBRG, az.SubscriptionID())))
+				Eventually(recorder.Events).Should(Receive(ContainSubstring("Warning ReconcileGatewayLBConfigurationError")))
+				Eventually(recorder.Events).Should(Receive(ContainSubstring("Warning AzureCircuitOpen")))
+			})
+
 			It("should report error if gateway VMSS is not found", func() {
 				mockLoadBalancerClient := az.LoadBalancerClient.(*mock_loadbalancerclient.MockInterface)
 				mockLoadBalancerClient.EXPECT().Get(gomock.Any(), testLBRG, testLBName, gomock.Any()).Return(&network.LoadBalancer{}, nil)
@@ -310,6 +373,8 @@ var _ = Describe("GatewayLBConfiguration controller unit tests", func() {
 				}, nil)
 				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
 				mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return([]*compute.VirtualMachineScaleSet{vmss}, nil)
+				mockVnetClient := az.VirtualNetworkClient.(*mock_virtualnetworkclient.MockInterface)
+				mockVnetClient.EXPECT().Get(gomock.Any(), testVnetRG, testVnetName, gomock.Any()).Return(getTestVnet(), nil)
 				_, reconcileErr = r.Reconcile(context.TODO(), req)
 				Expect(reconcileErr).To(BeNil())
 				assertEqualEvents([]string{"Normal ReconcileGatewayLBConfigurationSuccess GatewayLBConfiguration reconciled"}, recorder.Events)
@@ -318,6 +383,41 @@ var _ = Describe("GatewayLBConfiguration controller unit tests", func() {
 				Expect(controllerutil.ContainsFinalizer(foundLBConfig, consts.LBConfigFinalizerName)).To(BeTrue())
 			})
 
+			It("should not fail if virtual network is not found", func() {
+				vmss := &compute.VirtualMachineScaleSet{
+					Properties: &compute.VirtualMachineScaleSetProperties{UniqueID: to.Ptr(testVMSSUID)},
+					Tags:       map[string]*string{consts.AKSNodepoolTagKey: to.Ptr("testgw")},
+				}
+				mockLoadBalancerClient := az.LoadBalancerClient.(*mock_loadbalancerclient.MockInterface)
+				mockLoadBalancerClient.EXPECT().Get(gomock.Any(), testLBRG, testLBName, gomock.Any()).Return(getExpectedLB(), nil)
+				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+				mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return([]*compute.VirtualMachineScaleSet{vmss}, nil)
+				mockVnetClient := az.VirtualNetworkClient.(*mock_virtualnetworkclient.MockInterface)
+				mockVnetClient.EXPECT().Get(gomock.Any(), testVnetRG, testVnetName, gomock.Any()).Return(nil, fmt.Errorf("failed"))
+				_, reconcileErr = r.Reconcile(context.TODO(), req)
+				Expect(reconcileErr).To(BeNil())
+				foundLBConfig := &egressgatewayv1alpha1.GatewayLBConfiguration{}
+				Expect(getResource(cl, foundLBConfig)).To(Succeed())
+				Expect(foundLBConfig.Status.VnetAddressSpace).To(BeEmpty())
+				assertEqualEvents([]string{"Normal ReconcileGatewayLBConfigurationSuccess GatewayLBConfiguration reconciled"}, recorder.Events)
+			})
+
+			It("should cache virtual network address space and keep it when it cannot be refreshed", func() {
+				mockVnetClient := az.VirtualNetworkClient.(*mock_virtualnetworkclient.MockInterface)
+				mockVnetClient.EXPECT().Get(gomock.Any(), testVnetRG, testVnetName, gomock.Any()).Return(getTestVnet(), nil)
+				for i := 0; i < 2; i++ {
+					prefixes, err := r.getVnetAddressSpace(context.TODO())
+					Expect(err).To(BeNil())
+					Expect(prefixes).To(Equal([]string{"10.0.0.0/16", "fd00::/48"}))
+				}
+
+				r.vnetAddressSpaceReadAt = time.Now().Add(-vnetAddressSpaceRefreshInterval)
+				mockVnetClient.EXPECT().Get(gomock.Any(), testVnetRG, testVnetName, gomock.Any()).Return(nil, fmt.Errorf("failed"))
+				prefixes, err := r.getVnetAddressSpace(context.TODO())
+				Expect(err).To(BeNil())
+				Expect(prefixes).To(Equal([]string{"10.0.0.0/16", "fd00::/48"}))
+			})
+
 			Context("reconcile lbRule, lbProbe and vmConfig", func() {
 				BeforeEach(func() {
 					vmss := &compute.VirtualMachineScaleSet{
@@ -326,6 +426,8 @@ var _ = Describe("GatewayLBConfiguration controller unit tests", func() {
 					}
 					mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
 					mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return([]*compute.VirtualMachineScaleSet{vmss}, nil).AnyTimes()
+					mockVnetClient := az.VirtualNetworkClient.(*mock_virtualnetworkclient.MockInterface)
+					mockVnetClient.EXPECT().Get(gomock.Any(), testVnetRG, testVnetName, gomock.Any()).Return(getTestVnet(), nil).AnyTimes()
 				})
 
 				It("should create new lbRule and lbProbe", func() {
@@ -443,6 +545,30 @@ var _ = Describe("GatewayLBConfiguration controller unit tests", func() {
 					Expect(foundLBConfig.Status.ServerPort).To(Equal(int32(6001)))
 					assertEqualEvents([]string{"Normal ReconcileGatewayLBConfigurationSuccess GatewayLBConfiguration reconciled"}, recorder.Events)
 				})
+
+				It("should recreate lbRule with requested wireguard port", func() {
+					Expect(getResource(cl, foundLBConfig)).To(Succeed())
+					foundLBConfig.Spec.WireguardPort = 6500
+					Expect(cl.Update(context.TODO(), foundLBConfig)).To(Succeed())
+
+					existingLB, expectedLB := getExpectedLB(), getExpectedLB()
+					expectedLB.Properties.LoadBalancingRules[0].Properties.FrontendPort = to.Ptr(int32(6500))
+					expectedLB.Properties.LoadBalancingRules[0].Properties.BackendPort = to.Ptr(int32(6500))
+					mockLoadBalancerClient := az.LoadBalancerClient.(*mock_loadbalancerclient.MockInterface)
+					mockLoadBalancerClient.EXPECT().Get(gomock.Any(), testLBRG, testLBName, gomock.Any()).Return(existingLB, nil)
+					mockLoadBalancerClient.EXPECT().CreateOrUpdate(gomock.Any(), testLBRG, testLBName, gomock.Any()).DoAndReturn(func(ctx context.Context, resourceGroupName string, loadBalancerName string, loadBalancer network.LoadBalancer) (*network.LoadBalancer, error) {
+						Expect(equality.Semantic.DeepEqual(loadBalancer, *expectedLB)).To(BeTrue())
+						return expectedLB, nil
+					})
+					res, reconcileErr = r.Reconcile(context.TODO(), req)
+					Expect(reconcileErr).To(BeNil())
+					Expect(res).To(Equal(ctrl.Result{}))
+
+					getErr = getResource(cl, foundLBConfig)
+					Expect(getErr).To(BeNil())
+					Expect(foundLBConfig.Status.ServerPort).To(Equal(int32(6500)))
+					assertEqualEvents([]string{"Normal ReconcileGatewayLBConfigurationSuccess GatewayLBConfiguration reconciled"}, recorder.Events)
+				})
 			})
 		})
 
@@ -459,6 +585,8 @@ var _ = Describe("GatewayLBConfiguration controller unit tests", func() {
 				}
 				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
 				mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return([]*compute.VirtualMachineScaleSet{vmss}, nil).AnyTimes()
+				mockVnetClient := az.VirtualNetworkClient.(*mock_virtualnetworkclient.MockInterface)
+				mockVnetClient.EXPECT().Get(gomock.Any(), testVnetRG, testVnetName, gomock.Any()).Return(getTestVnet(), nil).AnyTimes()
 			})
 
 			It("should create a new vmConfig", func() {
@@ -516,6 +644,7 @@ var _ = Describe("GatewayLBConfiguration controller unit tests", func() {
 				getErr = getResource(cl, foundLBConfig)
 				Expect(getErr).To(BeNil())
 				Expect(foundLBConfig.Status.EgressIpPrefix).To(Equal("1.2.3.4/31"))
+				Expect(foundLBConfig.Status.VnetAddressSpace).To(Equal([]string{"10.0.0.0/16", "fd00::/48"}))
 				assertEqualEvents([]string{"Normal ReconcileGatewayLBConfigurationSuccess GatewayLBConfiguration reconciled"}, recorder.Events)
 			})
 
@@ -655,6 +784,227 @@ var _ = Describe("GatewayLBConfiguration controller unit tests", func() {
 			})
 		})
 
+		When("gateway rules are added to an existing lb", func() {
+			var (
+				lb                     *network.LoadBalancer
+				mockLoadBalancerClient *mock_loadbalancerclient.MockInterface
+			)
+
+			BeforeEach(func() {
+				az = getMockAzureManager(gomock.NewController(GinkgoT()))
+				az.ExistingLoadBalancerID = fmt.Sprintf(azmanager.LBIDTemplate, "testSub", testLBRG, testLBName)
+				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(lbConfig).WithRuntimeObjects(gwConfig, lbConfig).Build()
+				r = &GatewayLBConfigurationReconciler{Client: cl, AzureManager: az, Recorder: recorder, LBProbePort: lbProbePort}
+				vmss := &compute.VirtualMachineScaleSet{
+					Properties: &compute.VirtualMachineScaleSetProperties{UniqueID: to.Ptr(testVMSSUID)},
+					Tags:       map[string]*string{consts.AKSNodepoolTagKey: to.Ptr("testgw")},
+				}
+				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+				mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return([]*compute.VirtualMachineScaleSet{vmss}, nil).AnyTimes()
+				mockSubnetClient := az.SubnetClient.(*mock_subnetclient.MockInterface)
+				mockSubnetClient.EXPECT().Get(gomock.Any(), testVnetRG, testVnetName, testSubnetName, gomock.Any()).Return(&network.Subnet{
+					ID: to.Ptr("testSubnet"),
+				}, nil).AnyTimes()
+				// the fake lb keeps the last written state, allocating frontend ips and IDs like azure does
+				mockLoadBalancerClient = az.LoadBalancerClient.(*mock_loadbalancerclient.MockInterface)
+				mockLoadBalancerClient.EXPECT().Get(gomock.Any(), testLBRG, testLBName, gomock.Any()).DoAndReturn(
+					func(ctx context.Context, resourceGroupName string, loadBalancerName string, expand *string) (*network.LoadBalancer, error) {
+						if lb == nil {
+							return nil, &azcore.ResponseError{StatusCode: http.StatusNotFound}
+						}
+						return lb, nil
+					}).AnyTimes()
+			})
+
+			expectLBUpdate := func() {
+				mockLoadBalancerClient.EXPECT().CreateOrUpdate(gomock.Any(), testLBRG, testLBName, gomock.Any()).DoAndReturn(
+					func(ctx context.Context, resourceGroupName string, loadBalancerName string, loadBalancer network.LoadBalancer) (*network.LoadBalancer, error) {
+						for _, frontend := range loadBalancer.Properties.FrontendIPConfigurations {
+							if frontend.ID == nil {
+								frontend.ID = az.GetLBFrontendIPConfigurationID(to.Val(frontend.Name))
+								frontend.Properties.PrivateIPAddress = to.Ptr("10.0.0.4")
+							}
+						}
+						for _, backend := range loadBalancer.Properties.BackendAddressPools {
+							if backend.ID == nil {
+								backend.ID = az.GetLBBackendAddressPoolID(to.Val(backend.Name))
+							}
+						}
+						lb = &loadBalancer
+						return lb, nil
+					})
+			}
+
+			It("should report error and not create the lb when it is not found", func() {
+				lb = nil
+				_, _, err := r.reconcileLBRule(context.TODO(), az, lbConfig, true)
+				Expect(err).To(MatchError(ContainSubstring("existing load balancer")))
+			})
+
+			It("should add gateway rules once without touching unrelated ones", func() {
+				lb = getUnrelatedLB()
+				expectLBUpdate()
+				frontendIP, port, err := r.reconcileLBRule(context.TODO(), az, lbConfig, true)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(frontendIP).To(Equal("10.0.0.4"))
+				Expect(port).NotTo(BeZero())
+
+				unrelated := getUnrelatedLB()
+				Expect(lb.Properties.FrontendIPConfigurations).To(HaveLen(2))
+				Expect(lb.Properties.FrontendIPConfigurations[0]).To(Equal(unrelated.Properties.FrontendIPConfigurations[0]))
+				Expect(lb.Properties.BackendAddressPools).To(HaveLen(2))
+				Expect(lb.Properties.BackendAddressPools[0]).To(Equal(unrelated.Properties.BackendAddressPools[0]))
+				Expect(lb.Properties.LoadBalancingRules).To(HaveLen(2))
+				Expect(lb.Properties.LoadBalancingRules[0]).To(Equal(unrelated.Properties.LoadBalancingRules[0]))
+				Expect(lb.Properties.Probes).To(HaveLen(2))
+				Expect(lb.Properties.Probes[0]).To(Equal(unrelated.Properties.Probes[0]))
+
+				// no more updates once the rules are in place
+				frontendIP2, port2, err := r.reconcileLBRule(context.TODO(), az, lbConfig, true)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(frontendIP2).To(Equal(frontendIP))
+				Expect(port2).To(Equal(port))
+			})
+
+			It("should only remove gateway rules and keep the lb on deletion", func() {
+				lb = getExpectedLB()
+				unrelated := getUnrelatedLB()
+				lb.Properties.FrontendIPConfigurations = append(unrelated.Properties.FrontendIPConfigurations, lb.Properties.FrontendIPConfigurations...)
+				lb.Properties.BackendAddressPools = append(unrelated.Properties.BackendAddressPools, lb.Properties.BackendAddressPools...)
+				lb.Properties.LoadBalancingRules = append(unrelated.Properties.LoadBalancingRules, lb.Properties.LoadBalancingRules...)
+				lb.Properties.Probes = append(unrelated.Properties.Probes, lb.Properties.Probes...)
+				expectLBUpdate()
+				_, _, err := r.reconcileLBRule(context.TODO(), az, lbConfig, false)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(equality.Semantic.DeepEqual(lb, getUnrelatedLB())).To(BeTrue())
+
+				// nothing left to clean up, the lb is neither updated nor deleted
+				_, _, err = r.reconcileLBRule(context.TODO(), az, lbConfig, false)
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		When("gateway vmss is in another subscription", func() {
+			const gatewaySubnetID = "/subscriptions/gatewaySub/resourceGroups/gwVnetRG/providers/Microsoft.Network/virtualNetworks/gwVnet/subnets/gwSubnet"
+			var (
+				subAz      *azmanager.AzureManager
+				gatewayLB  *network.LoadBalancer
+				gatewayNet *network.VirtualNetwork
+			)
+
+			BeforeEach(func() {
+				lbConfig.Spec.GatewayNodepoolName = ""
+				lbConfig.Spec.GatewayVmssProfile.SubscriptionId = "gatewaySub"
+				az = getMockAzureManager(gomock.NewController(GinkgoT()))
+				az.NewSubscriptionClients = func(subscriptionID string) (*azmanager.SubscriptionClients, error) {
+					return &azmanager.SubscriptionClients{Factory: getMockClientFactory(gomock.NewController(GinkgoT()))}, nil
+				}
+				var err error
+				subAz, err = az.ForSubscription("gatewaySub", "vmssRG")
+				Expect(err).To(BeNil())
+				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(gwConfig, lbConfig).WithRuntimeObjects(gwConfig, lbConfig).Build()
+				r = &GatewayLBConfigurationReconciler{Client: cl, AzureManager: az, Recorder: recorder, LBProbePort: lbProbePort}
+
+				vmss := &compute.VirtualMachineScaleSet{
+					Name: to.Ptr("vmss"),
+					Properties: &compute.VirtualMachineScaleSetProperties{
+						UniqueID: to.Ptr(testVMSSUID),
+						VirtualMachineProfile: &compute.VirtualMachineScaleSetVMProfile{
+							NetworkProfile: &compute.VirtualMachineScaleSetNetworkProfile{
+								NetworkInterfaceConfigurations: []*compute.VirtualMachineScaleSetNetworkConfiguration{{
+									Properties: &compute.VirtualMachineScaleSetNetworkConfigurationProperties{
+										Primary: to.Ptr(true),
+										IPConfigurations: []*compute.VirtualMachineScaleSetIPConfiguration{{
+											Properties: &compute.VirtualMachineScaleSetIPConfigurationProperties{
+												Primary: to.Ptr(true),
+												Subnet:  &compute.APIEntityReference{ID: to.Ptr(gatewaySubnetID)},
+											},
+										}},
+									},
+								}},
+							},
+						},
+					},
+				}
+				mockVMSSClient := subAz.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+				mockVMSSClient.EXPECT().Get(gomock.Any(), "vmssRG", "vmss", gomock.Any()).Return(vmss, nil).AnyTimes()
+				gatewayNet = &network.VirtualNetwork{
+					Properties: &network.VirtualNetworkPropertiesFormat{
+						VirtualNetworkPeerings: []*network.VirtualNetworkPeering{{
+							Properties: &network.VirtualNetworkPeeringPropertiesFormat{
+								RemoteVirtualNetwork: &network.SubResource{ID: to.Ptr(az.GetVirtualNetworkID())},
+								PeeringState:         to.Ptr(network.VirtualNetworkPeeringStateConnected),
+							},
+						}},
+					},
+				}
+				mockVnetClient := subAz.VirtualNetworkClient.(*mock_virtualnetworkclient.MockInterface)
+				mockVnetClient.EXPECT().Get(gomock.Any(), "gwVnetRG", "gwVnet", gomock.Any()).DoAndReturn(
+					func(ctx context.Context, resourceGroupName string, vnetName string, expand *string) (*network.VirtualNetwork, error) {
+						return gatewayNet, nil
+					}).AnyTimes()
+				// the gateway lb is in the gateway subscription and vmss resource group
+				gatewayLB = nil
+				mockLoadBalancerClient := subAz.LoadBalancerClient.(*mock_loadbalancerclient.MockInterface)
+				mockLoadBalancerClient.EXPECT().Get(gomock.Any(), "vmssRG", testLBName, gomock.Any()).DoAndReturn(
+					func(ctx context.Context, resourceGroupName string, loadBalancerName string, expand *string) (*network.LoadBalancer, error) {
+						if gatewayLB == nil {
+							return nil, &azcore.ResponseError{StatusCode: http.StatusNotFound}
+						}
+						return gatewayLB, nil
+					}).AnyTimes()
+				mockLoadBalancerClient.EXPECT().CreateOrUpdate(gomock.Any(), "vmssRG", testLBName, gomock.Any()).DoAndReturn(
+					func(ctx context.Context, resourceGroupName string, loadBalancerName string, loadBalancer network.LoadBalancer) (*network.LoadBalancer, error) {
+						for _, frontend := range loadBalancer.Properties.FrontendIPConfigurations {
+							frontend.ID = subAz.GetLBFrontendIPConfigurationID(to.Val(frontend.Name))
+							frontend.Properties.PrivateIPAddress = to.Ptr("10.1.0.4")
+						}
+						gatewayLB = &loadBalancer
+						return gatewayLB, nil
+					}).AnyTimes()
+			})
+
+			It("should create the gateway lb in the gateway virtual network", func() {
+				frontendIP, _, err := r.reconcileLBRule(context.TODO(), subAz, lbConfig, true)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(frontendIP).To(Equal("10.1.0.4"))
+				Expect(gatewayLB.Properties.FrontendIPConfigurations).To(HaveLen(1))
+				Expect(to.Val(gatewayLB.Properties.FrontendIPConfigurations[0].Properties.Subnet.ID)).To(Equal(gatewaySubnetID))
+				Expect(to.Val(gatewayLB.Properties.LoadBalancingRules[0].Properties.BackendAddressPool.ID)).To(Equal(
+					fmt.Sprintf("/subscriptions/gatewaySub/resourceGroups/vmssRG/providers/Microsoft.Network/loadBalancers/%s/backendAddressPools/%s", testLBName, testVMSSUID)))
+			})
+
+			It("should report error when the gateway virtual network is not peered with the cluster one", func() {
+				gatewayNet.Properties.VirtualNetworkPeerings[0].Properties.PeeringState = to.Ptr(network.VirtualNetworkPeeringStateDisconnected)
+				_, _, err := r.reconcileLBRule(context.TODO(), subAz, lbConfig, true)
+				Expect(err).To(MatchError(fmt.Sprintf("gateway virtual network(/subscriptions/gatewaySub/resourceGroups/gwVnetRG/providers/Microsoft.Network/virtualNetworks/gwVnet) "+
+					"is not peered with the cluster virtual network(%s), pods could not reach the gateway LoadBalancer", az.GetVirtualNetworkID())))
+				Expect(gatewayLB).To(BeNil())
+			})
+
+			It("should report circuit breaker open in the gateway subscription on gateway", func() {
+				subAz.CircuitBreakerThreshold = 1
+				subAz.CircuitBreakerCooldown = time.Minute
+				// replaces the fake lb above
+				mockLoadBalancerClient := mock_loadbalancerclient.NewMockInterface(gomock.NewController(GinkgoT()))
+				subAz.LoadBalancerClient = mockLoadBalancerClient
+				mockLoadBalancerClient.EXPECT().Get(gomock.Any(), "vmssRG", testLBName, gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusServiceUnavailable})
+				_, reconcileErr = r.Reconcile(context.TODO(), req)
+				Expect(reconcileErr).To(HaveOccurred())
+
+				res, reconcileErr = r.Reconcile(context.TODO(), req)
+				Expect(reconcileErr).NotTo(HaveOccurred())
+				Expect(res.RequeueAfter).To(BeNumerically("~", time.Minute, time.Second))
+				foundGWConfig := &egressgatewayv1alpha1.StaticGatewayConfiguration{}
+				Expect(getResource(cl, foundGWConfig)).To(Succeed())
+				condition := meta.FindStatusCondition(foundGWConfig.Status.Conditions, consts.SGCAzureAvailableConditionType)
+				Expect(condition).NotTo(BeNil())
+				Expect(condition.Message).To(ContainSubstring("Azure GetLB calls in resource group(vmssRG) of subscription(gatewaySub) are suspended"))
+				Eventually(recorder.Events).Should(Receive(ContainSubstring("Warning ReconcileGatewayLBConfigurationError")))
+				Eventually(recorder.Events).Should(Receive(ContainSubstring("Warning AzureCircuitOpen")))
+			})
+		})
+
 		Context("TestSameLBRuleConfig", func() {
 			tests := []struct {
 				rule1   *network.LoadBalancingRule
@@ -740,7 +1090,7 @@ var _ = Describe("GatewayLBConfiguration controller unit tests", func() {
 						BackendAddressPool: &network.SubResource{ID: to.Ptr("123")},
 					},
 				})
-				_, err := selectPortForLBRule(targetRule, lbRules)
+				_, err := selectPortForLBRule(targetRule, lbRules, 0)
 				Expect(err).To(Equal(invalidErr))
 			})
 
@@ -752,7 +1102,7 @@ var _ = Describe("GatewayLBConfiguration controller unit tests", func() {
 						BackendPort:        to.Ptr(int32(100)),
 					},
 				})
-				_, err := selectPortForLBRule(targetRule, lbRules)
+				_, err := selectPortForLBRule(targetRule, lbRules, 0)
 				Expect(err).To(Equal(invalidErr))
 			})
 
@@ -766,9 +1116,52 @@ var _ = Describe("GatewayLBConfiguration controller unit tests", func() {
 						},
 					})
 				}
-				_, err := selectPortForLBRule(targetRule, lbRules)
+				_, err := selectPortForLBRule(targetRule, lbRules, 0)
 				Expect(err).To(Equal(fmt.Errorf("selectPortForLBRule: No available ports")))
 			})
+
+			It("should select requested port when it is free", func() {
+				lbRules = append(lbRules, &network.LoadBalancingRule{
+					Properties: &network.LoadBalancingRulePropertiesFormat{
+						BackendAddressPool: &network.SubResource{ID: to.Ptr("123")},
+						FrontendPort:       to.Ptr(int32(6000)),
+						BackendPort:        to.Ptr(int32(6000)),
+					},
+				})
+				port, err := selectPortForLBRule(targetRule, lbRules, 6500)
+				Expect(err).To(BeNil())
+				Expect(port).To(Equal(int32(6500)))
+			})
+
+			It("should report error when requested port is used by another rule of the same backend pool", func() {
+				lbRules = append(lbRules, &network.LoadBalancingRule{
+					Properties: &network.LoadBalancingRulePropertiesFormat{
+						BackendAddressPool: &network.SubResource{ID: to.Ptr("123")},
+						FrontendPort:       to.Ptr(int32(6500)),
+						BackendPort:        to.Ptr(int32(6500)),
+					},
+				})
+				_, err := selectPortForLBRule(targetRule, lbRules, 6500)
+				Expect(err).To(Equal(fmt.Errorf("selectPortForLBRule: requested port 6500 is used by another gateway on the same nodepool")))
+			})
+
+			It("should allow requested port used by another backend pool", func() {
+				lbRules = append(lbRules, &network.LoadBalancingRule{
+					Properties: &network.LoadBalancingRulePropertiesFormat{
+						BackendAddressPool: &network.SubResource{ID: to.Ptr("456")},
+						FrontendPort:       to.Ptr(int32(6500)),
+						BackendPort:        to.Ptr(int32(6500)),
+					},
+				})
+				port, err := selectPortForLBRule(targetRule, lbRules, 6500)
+				Expect(err).To(BeNil())
+				Expect(port).To(Equal(int32(6500)))
+			})
+
+			It("should report error when requested port is out of range", func() {
+				_, err := selectPortForLBRule(targetRule, lbRules, 7000)
+				Expect(err).To(Equal(fmt.Errorf("selectPortForLBRule: requested port 7000 is out of range")))
+			})
 		})
 	})
 })
@@ -788,15 +1181,32 @@ func getMockAzureManager(ctrl *gomock.Controller) *azmanager.AzureManager {
 		VnetResourceGroup:         testVnetRG,
 		SubnetName:                testSubnetName,
 	}
+	az, _ := azmanager.CreateAzureManager(conf, getMockClientFactory(ctrl))
+	return az
+}
+
+func getMockClientFactory(ctrl *gomock.Controller) azclient.ClientFactory {
 	factory := mock_azclient.NewMockClientFactory(ctrl)
 	factory.EXPECT().GetLoadBalancerClient().Return(mock_loadbalancerclient.NewMockInterface(ctrl))
 	factory.EXPECT().GetVirtualMachineScaleSetClient().Return(mock_virtualmachinescalesetclient.NewMockInterface(ctrl))
 	factory.EXPECT().GetVirtualMachineScaleSetVMClient().Return(mock_virtualmachinescalesetvmclient.NewMockInterface(ctrl))
 	factory.EXPECT().GetPublicIPPrefixClient().Return(mock_publicipprefixclient.NewMockInterface(ctrl))
+	factory.EXPECT().GetPublicIPAddressClient().Return(mock_publicipaddressclient.NewMockInterface(ctrl))
 	factory.EXPECT().GetInterfaceClient().Return(mock_interfaceclient.NewMockInterface(ctrl))
 	factory.EXPECT().GetSubnetClient().Return(mock_subnetclient.NewMockInterface(ctrl))
-	az, _ := azmanager.CreateAzureManager(conf, factory)
-	return az
+	factory.EXPECT().GetVirtualNetworkClient().Return(mock_virtualnetworkclient.NewMockInterface(ctrl))
+	return factory
+}
+
+func getTestVnet() *network.VirtualNetwork {
+	return &network.VirtualNetwork{
+		Name: to.Ptr(testVnetName),
+		Properties: &network.VirtualNetworkPropertiesFormat{
+			AddressSpace: &network.AddressSpace{
+				AddressPrefixes: []*string{to.Ptr("10.0.0.0/16"), to.Ptr("fd00::/48")},
+			},
+		},
+	}
 }
 
 func getEmptyLB() *network.LoadBalancer {
@@ -831,6 +1241,59 @@ func getEmptyLB() *network.LoadBalancer {
 	}
 }
 
+// getUnrelatedLB returns an lb with a frontend, backend, rule and probe owned by another service
+func getUnrelatedLB() *network.LoadBalancer {
+	frontendID := fmt.Sprintf("/subscriptions/testSub/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/frontendIPConfigurations/other", testLBRG, testLBName)
+	backendID := fmt.Sprintf("/subscriptions/testSub/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/backendAddressPools/other", testLBRG, testLBName)
+	return &network.LoadBalancer{
+		Name:     to.Ptr(testLBName),
+		Location: to.Ptr("location"),
+		SKU: &network.LoadBalancerSKU{
+			Name: to.Ptr(network.LoadBalancerSKUNameStandard),
+			Tier: to.Ptr(network.LoadBalancerSKUTierRegional),
+		},
+		Properties: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: []*network.FrontendIPConfiguration{
+				{
+					Name: to.Ptr("other"),
+					ID:   to.Ptr(frontendID),
+					Properties: &network.FrontendIPConfigurationPropertiesFormat{
+						PrivateIPAddressVersion: to.Ptr(network.IPVersionIPv4),
+						PrivateIPAddress:        to.Ptr("10.0.0.10"),
+					},
+				},
+			},
+			BackendAddressPools: []*network.BackendAddressPool{
+				{
+					Name: to.Ptr("other"),
+					ID:   to.Ptr(backendID),
+				},
+			},
+			LoadBalancingRules: []*network.LoadBalancingRule{
+				{
+					Name: to.Ptr("other"),
+					Properties: &network.LoadBalancingRulePropertiesFormat{
+						Protocol:                to.Ptr(network.TransportProtocolTCP),
+						FrontendIPConfiguration: &network.SubResource{ID: to.Ptr(frontendID)},
+						BackendAddressPool:      &network.SubResource{ID: to.Ptr(backendID)},
+						FrontendPort:            to.Ptr(int32(443)),
+						BackendPort:             to.Ptr(int32(443)),
+					},
+				},
+			},
+			Probes: []*network.Probe{
+				{
+					Name: to.Ptr("other"),
+					Properties: &network.ProbePropertiesFormat{
+						Protocol: to.Ptr(network.ProbeProtocolTCP),
+						Port:     to.Ptr(int32(443)),
+					},
+				},
+			},
+		},
+	}
+}
+
 func getExpectedLB() *network.LoadBalancer {
 	return &network.LoadBalancer{
 		Name:     to.Ptr(testLBName),
@@ -5,25 +5,32 @@ package manager
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"math"
-	"net/http"
+	"net/netip"
 	"os"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
 	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
 	network "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
@@ -32,7 +39,9 @@ import (
 
 	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
 	"github.com/Azure/kube-egress-gateway/pkg/azmanager"
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients"
 	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/logger"
 	"github.com/Azure/kube-egress-gateway/pkg/metrics"
 	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
 )
@@ -42,10 +51,30 @@ type GatewayVMConfigurationReconciler struct {
 	client.Client
 	*azmanager.AzureManager
 	Recorder record.EventRecorder
+	// ResyncInterval is how often Azure resources are compared against applied configurations to correct
+	// out-of-band changes, 0 to disable
+	ResyncInterval time.Duration
+	// MaxConcurrentReconciles is the maximum number of GatewayVMConfigurations reconciled at the same time,
+	// public ip prefixes of different gateways are provisioned in parallel while updates of a shared vmss are serialized
+	MaxConcurrentReconciles int
+	// GracefulShutdownTimeout is how long in-flight reconciles may run after the manager is stopped before their
+	// context is cancelled, 0 cancels them right away
+	GracefulShutdownTimeout time.Duration
+	// DefaultTags are azure tags applied to all managed public ip prefixes, tags in the gateway spec take precedence
+	DefaultTags map[string]string
 }
 
+const (
+	vmssProvisioningStateUpdating = "Updating"
+	// azureSyncTimeRefreshInterval is how often lastAzureSyncTime is refreshed while gateway Azure resources stay
+	// in sync
+	azureSyncTimeRefreshInterval = time.Minute
+)
+
 var (
-	publicIPPrefixRE = regexp.MustCompile(`(?i).*/subscriptions/(.+)/resourceGroups/(.+)/providers/Microsoft.Network/publicIPPrefixes/(.+)`)
+	publicIPPrefixRE  = regexp.MustCompile(`(?i).*/subscriptions/(.+)/resourceGroups/(.+)/providers/Microsoft.Network/publicIPPrefixes/(.+)`)
+	publicIPAddressRE = regexp.MustCompile(`(?i).*/subscriptions/(.+)/resourceGroups/(.+)/providers/Microsoft.Network/publicIPAddresses/(.+)`)
+	natGatewayRE      = regexp.MustCompile(`(?i).*/subscriptions/(.+)/resourceGroups/(.+)/providers/Microsoft.Network/natGateways/(.+)`)
 )
 
 //+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
@@ -97,9 +126,22 @@ func (r *GatewayVMConfigurationReconciler) Reconcile(ctx context.Context, req ct
 					continue
 				}
 			}
+			gwConfig := &egressgatewayv1alpha1.StaticGatewayConfiguration{}
+			if err := r.Get(ctx, client.ObjectKeyFromObject(&vmConfig), gwConfig); err == nil && isReconcilePaused(gwConfig) {
+				continue
+			}
 			log.Info(fmt.Sprintf("reconcile vmConfig (%s/%s) upon node (%s) event", vmConfig.GetNamespace(), vmConfig.GetName(), req.Name))
-			if _, err := r.reconcile(ctx, &vmConfig); err != nil {
+			gr, err := r.forGateway(&vmConfig)
+			if err == nil {
+				_, err = gr.reconcile(ctx, &vmConfig)
+			}
+			if err = checkSubscriptionAccess(vmConfig.Spec.GatewayVmssProfile, err); err != nil {
 				log.Error(err, "failed to reconcile GatewayVMConfiguration")
+				if errors.As(err, new(*prefixAllocationError)) || errors.As(err, new(*regionMismatchError)) ||
+					errors.As(err, new(*subscriptionAccessError)) {
+					// reported on the gateway by its own reconciliation, no point retrying for node events
+					continue
+				}
 				aggregateError = errors.Join(aggregateError, err)
 				continue // continue to reconcile other vmConfigs
 			}
@@ -122,25 +164,153 @@ func (r *GatewayVMConfigurationReconciler) Reconcile(ctx context.Context, req ct
 		log.Error(err, "failed to fetch StaticGatewayConfiguration instance")
 		return ctrl.Result{}, err
 	}
+	ctx = logger.WithGateway(ctx, gwConfig)
+
+	gr, err := r.forGateway(vmConfig)
+	if err != nil {
+		log.Error(err, "failed to get Azure clients of gateway subscription")
+		r.Recorder.Event(gwConfig, corev1.EventTypeWarning, "ReconcileGatewayVMConfigurationError", err.Error())
+		return ctrl.Result{}, err
+	}
 
 	if !vmConfig.ObjectMeta.DeletionTimestamp.IsZero() {
 		// Clean up gatewayVMConfiguration
-		res, err := r.ensureDeleted(ctx, vmConfig)
+		res, err := gr.ensureDeleted(ctx, vmConfig)
+		err = checkSubscriptionAccess(vmConfig.Spec.GatewayVmssProfile, err)
 		if err != nil {
 			r.Recorder.Event(gwConfig, corev1.EventTypeWarning, "EnsureDeleteGatewayVMConfigurationError", err.Error())
 		}
 		return res, err
 	}
 
-	res, err := r.reconcile(ctx, vmConfig)
-	if err != nil {
+	if isReconcilePaused(gwConfig) {
+		log.Info("Reconciliation is paused, leaving Azure resources as they are")
+		return ctrl.Result{}, nil
+	}
+
+	res, err := gr.reconcile(ctx, vmConfig)
+	err = checkSubscriptionAccess(vmConfig.Spec.GatewayVmssProfile, err)
+	if syncErr := r.setAzureSyncStatus(ctx, gwConfig, err); syncErr != nil && err == nil {
+		return ctrl.Result{}, syncErr
+	}
+	if circuitOpen, circuitRes, circuitErr := handleAzureCircuit(ctx, r.Client, r.Recorder, gr.AzureManager, gwConfig, err); circuitOpen {
+		return circuitRes, circuitErr
+	} else if circuitErr != nil && err == nil {
+		return ctrl.Result{}, circuitErr
+	}
+	var allocErr *prefixAllocationError
+	var notReadyErr *azmanager.VMSSNotGatewayReadyError
+	var regionErr *regionMismatchError
+	var accessErr *subscriptionAccessError
+	switch {
+	case errors.As(err, &allocErr):
+		// retrying right away fails the same way until capacity is freed in the region, wait for next resync
+		// or a new retry-provisioning annotation on the gateway instead of returning the error for backoff
+		r.Recorder.Event(gwConfig, corev1.EventTypeWarning, consts.SGCPublicIPPrefixReadyReasonAllocationFailed, allocErr.Error())
+		return ctrl.Result{RequeueAfter: r.ResyncInterval}, r.setFailureCondition(ctx, gwConfig,
+			consts.SGCPublicIPPrefixReadyConditionType, consts.SGCPublicIPPrefixReadyReasonAllocationFailed, allocErr)
+	case errors.As(err, &regionErr):
+		// the prefix or the vmss has to be moved by users, likewise wait for next resync or retry-provisioning annotation
+		r.Recorder.Event(gwConfig, corev1.EventTypeWarning, consts.SGCPublicIPPrefixReadyReasonRegionMismatch, regionErr.Error())
+		return ctrl.Result{RequeueAfter: r.ResyncInterval}, r.setFailureCondition(ctx, gwConfig,
+			consts.SGCPublicIPPrefixReadyConditionType, consts.SGCPublicIPPrefixReadyReasonRegionMismatch, regionErr)
+	case errors.As(err, &notReadyErr):
+		// the vmss has to be fixed by users, likewise wait for next resync or retry-provisioning annotation
+		r.Recorder.Event(gwConfig, corev1.EventTypeWarning, consts.SGCGatewayVMSSReadyReasonNotGatewayReady, notReadyErr.Error())
+		return ctrl.Result{RequeueAfter: r.ResyncInterval}, r.setFailureCondition(ctx, gwConfig,
+			consts.SGCGatewayVMSSReadyConditionType, consts.SGCGatewayVMSSReadyReasonNotGatewayReady, notReadyErr)
+	case errors.As(err, &accessErr):
+		// access has to be granted by users, likewise wait for next resync or retry-provisioning annotation
+		r.Recorder.Event(gwConfig, corev1.EventTypeWarning, consts.SGCGatewayVMSSReadyReasonSubscriptionAccessDenied, accessErr.Error())
+		return ctrl.Result{RequeueAfter: r.ResyncInterval}, r.setFailureCondition(ctx, gwConfig,
+			consts.SGCGatewayVMSSReadyConditionType, consts.SGCGatewayVMSSReadyReasonSubscriptionAccessDenied, accessErr)
+	case err != nil:
 		r.Recorder.Event(gwConfig, corev1.EventTypeWarning, "ReconcileGatewayVMConfigurationError", err.Error())
-	} else {
+	default:
 		r.Recorder.Event(gwConfig, corev1.EventTypeNormal, "ReconcileGatewayVMConfigurationSuccess", "GatewayVMConfiguration reconciled")
+		for _, conditionType := range []string{consts.SGCPublicIPPrefixReadyConditionType, consts.SGCGatewayVMSSReadyConditionType} {
+			if err := r.setFailureCondition(ctx, gwConfig, conditionType, "", nil); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
 	}
 	return res, err
 }
 
+// forGateway returns the reconciler calling Azure in the subscription of the vmConfig gateway VMSSes
+func (r *GatewayVMConfigurationReconciler) forGateway(vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration) (*GatewayVMConfigurationReconciler, error) {
+	az, err := gatewayAzureManager(r.AzureManager, vmConfig.Spec.GatewayVmssProfile)
+	if err != nil || az == r.AzureManager {
+		return r, err
+	}
+	gr := *r
+	gr.AzureManager = az
+	return &gr, nil
+}
+
+// setFailureCondition reports failure on gwConfig status as a false condition of conditionType, or removes the
+// condition once reconcile succeeds when failure is nil
+func (r *GatewayVMConfigurationReconciler) setFailureCondition(
+	ctx context.Context,
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+	conditionType string,
+	reason string,
+	failure error,
+) error {
+	patch := client.MergeFrom(gwConfig.DeepCopy())
+	var changed bool
+	if failure == nil {
+		changed = meta.RemoveStatusCondition(&gwConfig.Status.Conditions, conditionType)
+	} else {
+		changed = meta.SetStatusCondition(&gwConfig.Status.Conditions, metav1.Condition{
+			Type:               conditionType,
+			Status:             metav1.ConditionFalse,
+			Reason:             reason,
+			Message:            failure.Error(),
+			ObservedGeneration: gwConfig.Generation,
+		})
+	}
+	if !changed {
+		return nil
+	}
+	if err := r.Status().Patch(ctx, gwConfig, patch); err != nil {
+		log.FromContext(ctx).Error(err, "failed to update condition of StaticGatewayConfiguration", "conditionType", conditionType)
+		return err
+	}
+	return nil
+}
+
+// setAzureSyncStatus records on gwConfig status the time of the last successful reconcile of gateway Azure resources,
+// or the error of the last failed one. The status is patched so that it does not conflict with status updates of
+// the StaticGatewayConfiguration controller, and only when it changes. The sync time is refreshed at most every
+// azureSyncTimeRefreshInterval to not patch the status on every reconcile.
+func (r *GatewayVMConfigurationReconciler) setAzureSyncStatus(
+	ctx context.Context,
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+	syncErr error,
+) error {
+	patch := client.MergeFrom(gwConfig.DeepCopy())
+	if syncErr == nil {
+		if gwConfig.Status.LastAzureSyncError == "" && gwConfig.Status.LastAzureSyncTime != nil &&
+			time.Since(gwConfig.Status.LastAzureSyncTime.Time) < azureSyncTimeRefreshInterval {
+			return nil
+		}
+		now := metav1.Now()
+		gwConfig.Status.LastAzureSyncTime = &now
+		gwConfig.Status.LastAzureSyncError = ""
+	} else {
+		if gwConfig.Status.LastAzureSyncError == syncErr.Error() {
+			return nil
+		}
+		gwConfig.Status.LastAzureSyncError = syncErr.Error()
+	}
+	if err := r.Status().Patch(ctx, gwConfig, patch); err != nil {
+		log.FromContext(ctx).Error(err, "failed to update Azure sync status of StaticGatewayConfiguration")
+		return err
+	}
+	return nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *GatewayVMConfigurationReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
@@ -148,7 +318,40 @@ func (r *GatewayVMConfigurationReconciler) SetupWithManager(mgr ctrl.Manager) er
 		// allow for node events to trigger reconciliation when either node label matches
 		Watches(&corev1.Node{}, &handler.EnqueueRequestForObject{}, builder.WithPredicates(resourceHasFilterLabel(
 			map[string]string{consts.AKSNodepoolModeLabel: consts.AKSNodepoolModeValue, consts.UpstreamNodepoolModeLabel: "true"}))).
-		Complete(r)
+		// gateway configurations share the namespaced name of their GatewayVMConfiguration
+		Watches(&egressgatewayv1alpha1.StaticGatewayConfiguration{}, &handler.EnqueueRequestForObject{},
+			builder.WithPredicates(predicate.Or(retryProvisioningRequested(), reconcileUnpaused()))).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Complete(withGracefulShutdown(r, r.GracefulShutdownTimeout))
+}
+
+// retryProvisioningRequested returns a predicate that returns true only when the retry-provisioning annotation
+// of a StaticGatewayConfiguration is set to a new value
+func retryProvisioningRequested() predicate.Funcs {
+	return predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return false },
+		DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+		GenericFunc: func(e event.GenericEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			request := e.ObjectNew.GetAnnotations()[consts.SGCRetryProvisioningAnnotation]
+			return request != "" && request != e.ObjectOld.GetAnnotations()[consts.SGCRetryProvisioningAnnotation]
+		},
+	}
+}
+
+// reconcileUnpaused returns a predicate that returns true only when the reconcile-paused annotation of a
+// StaticGatewayConfiguration is removed or no longer true, so that Azure resources are reconciled right away
+func reconcileUnpaused() predicate.Funcs {
+	return predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return false },
+		DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+		GenericFunc: func(e event.GenericEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldGwConfig, okOld := e.ObjectOld.(*egressgatewayv1alpha1.StaticGatewayConfiguration)
+			newGwConfig, okNew := e.ObjectNew.(*egressgatewayv1alpha1.StaticGatewayConfiguration)
+			return okOld && okNew && isReconcilePaused(oldGwConfig) && !isReconcilePaused(newGwConfig)
+		},
+	}
 }
 
 // resourceHasFilterLabel returns a predicate that returns true only if the provided resource contains a label
@@ -199,7 +402,7 @@ func ifLabelMatch(obj client.Object, m map[string]string) bool {
 func (r *GatewayVMConfigurationReconciler) reconcile(
 	ctx context.Context,
 	vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration,
-) (ctrl.Result, error) {
+) (_ ctrl.Result, rerr error) {
 	log := log.FromContext(ctx)
 	log.Info(fmt.Sprintf("Reconciling GatewayVMConfiguration %s/%s", vmConfig.Namespace, vmConfig.Name))
 
@@ -211,7 +414,10 @@ func (r *GatewayVMConfigurationReconciler) reconcile(
 		strings.ToLower(fmt.Sprintf("%s/%s", vmConfig.Namespace, vmConfig.Name)),
 	)
 	succeeded := false
-	defer func() { mc.ObserveControllerReconcileMetrics(succeeded) }()
+	defer func() {
+		mc.ObserveControllerReconcileMetrics(succeeded)
+		mc.ObserveControllerReconcileError(rerr)
+	}()
 
 	if !controllerutil.ContainsFinalizer(vmConfig, consts.VMConfigFinalizerName) {
 		log.Info("Adding finalizer")
@@ -226,24 +432,82 @@ func (r *GatewayVMConfigurationReconciler) reconcile(
 	existing := &egressgatewayv1alpha1.GatewayVMConfiguration{}
 	vmConfig.DeepCopyInto(existing)
 
-	vmss, ipPrefixLength, err := r.getGatewayVMSS(ctx, vmConfig)
+	vmsses, ipPrefixLength, err := r.getGatewayVMSSes(ctx, vmConfig)
 	if err != nil {
 		log.Error(err, "failed to get vmss")
 		return ctrl.Result{}, err
 	}
 
-	ipPrefix, ipPrefixID, isManaged, err := r.ensurePublicIPPrefix(ctx, ipPrefixLength, vmConfig)
+	// nothing to apply for the spec, leave the vmss alone while an update, e.g. a node image upgrade, is in progress
+	// instead of racing with it, drift if any is corrected on next resync
+	if isSpecApplied(vmConfig) {
+		for _, vmss := range vmsses {
+			if vmss.vmss.Properties != nil && strings.EqualFold(to.Val(vmss.vmss.Properties.ProvisioningState), vmssProvisioningStateUpdating) {
+				log.Info("Skipping resync while vmss is updating", "vmssName", to.Val(vmss.vmss.Name))
+				succeeded = true
+				return ctrl.Result{RequeueAfter: r.ResyncInterval}, nil
+			}
+		}
+	}
+
+	ipPrefix, ipPrefixID, isManaged, err := r.ensurePublicIPPrefix(ctx, ipPrefixLength, vmConfig, vmsses)
 	if err != nil {
 		log.Error(err, "failed to ensure public ip prefix")
 		return ctrl.Result{}, err
 	}
+	if ipPrefixLength == 0 && ipPrefix != "" {
+		// BYO public ip prefix without PublicIpPrefixSize, managed IPv6 prefix follows the size of the provided one
+		if p, err := netip.ParsePrefix(ipPrefix); err == nil {
+			ipPrefixLength = int32(p.Bits())
+		}
+	}
+
+	additionalPrefixes, additionalPrefixIDs, err := r.ensureAdditionalPublicIPPrefixes(ctx, ipPrefixLength, vmConfig)
+	if err != nil {
+		log.Error(err, "failed to ensure additional public ip prefixes")
+		return ctrl.Result{}, err
+	}
+
+	ipv6Prefix, ipv6PrefixID, err := r.ensureIPv6PublicIPPrefix(ctx, ipPrefixLength, vmConfig)
+	if err != nil {
+		log.Error(err, "failed to ensure public ipv6 prefix")
+		return ctrl.Result{}, err
+	}
+
+	natGatewayID := ""
+	if vmConfig.Spec.ProvisionPublicIps {
+		natGatewayID = vmConfig.Spec.NatGatewayId
+	}
+
+	// a public ip prefix associated with a NAT gateway cannot be assigned to the gateway nodes,
+	// remove the stale association before the prefix is put back on the vmss
+	if vmConfig.Status != nil && vmConfig.Status.NatGatewayId != "" &&
+		(!strings.EqualFold(vmConfig.Status.NatGatewayId, natGatewayID) || !strings.EqualFold(natGatewayPublicIPID(vmConfig.Status), ipPrefixID)) {
+		if err := r.ensureNatGatewayPublicIP(ctx, vmConfig, vmConfig.Status.NatGatewayId, natGatewayPublicIPID(vmConfig.Status), false); err != nil {
+			log.Error(err, "failed to disassociate public ip from nat gateway")
+			return ctrl.Result{}, err
+		}
+	}
+
+	// with NAT gateway the ipConfigs carry no public ip, outbound traffic from the subnet uses the NAT gateway
+	vmssIPPrefixID := ipPrefixID
+	if natGatewayID != "" {
+		vmssIPPrefixID = ""
+	}
 
 	var privateIPs []string
-	if privateIPs, err = r.reconcileVMSS(ctx, vmConfig, vmss, ipPrefixID, true); err != nil {
+	if privateIPs, err = r.reconcileGatewayVMSSes(ctx, vmConfig, vmsses, vmssIPPrefixID, ipv6PrefixID, additionalPrefixIDs, true); err != nil {
 		log.Error(err, "failed to reconcile VMSS")
 		return ctrl.Result{}, err
 	}
 
+	if natGatewayID != "" {
+		if err := r.ensureNatGatewayPublicIP(ctx, vmConfig, natGatewayID, ipPrefixID, true); err != nil {
+			log.Error(err, "failed to associate public ip with nat gateway")
+			return ctrl.Result{}, err
+		}
+	}
+
 	if !isManaged {
 		if err := r.ensurePublicIPPrefixDeleted(ctx, vmConfig); err != nil {
 			log.Error(err, "failed to remove managed public ip prefix")
@@ -251,14 +515,60 @@ func (r *GatewayVMConfigurationReconciler) reconcile(
 		}
 	}
 
+	// additional prefixes beyond the requested count are no longer referenced by any ipConfig
+	if err := r.ensureAdditionalPublicIPPrefixesDeleted(ctx, vmConfig, 1+len(additionalPrefixIDs)); err != nil {
+		log.Error(err, "failed to remove additional managed public ip prefixes")
+		return ctrl.Result{}, err
+	}
+
 	if vmConfig.Status == nil {
 		vmConfig.Status = &egressgatewayv1alpha1.GatewayVMConfigurationStatus{}
 	}
+
+	if ipv6PrefixID == "" && vmConfig.Status.EgressIpv6Prefix != "" {
+		// ipv6 egress was disabled, the ipConfig referencing the prefix has been removed above
+		if err := r.ensureIPv6PublicIPPrefixDeleted(ctx, vmConfig); err != nil {
+			log.Error(err, "failed to remove managed public ipv6 prefix")
+			return ctrl.Result{}, err
+		}
+	}
+
+	if !isManaged {
+		vmConfig.Status.PublicIpPrefixReused = false
+	}
 	if vmConfig.Spec.ProvisionPublicIps {
-		vmConfig.Status.EgressIpPrefix = ipPrefix
+		vmConfig.Status.EgressIpPrefixes = append([]string{ipPrefix}, additionalPrefixes...)
+		vmConfig.Status.EgressIpPrefix = strings.Join(vmConfig.Status.EgressIpPrefixes, ",")
+		vmConfig.Status.PublicIpPrefixId = ipPrefixID
+		if publicIPAddressRE.MatchString(ipPrefixID) {
+			vmConfig.Status.PublicIpPrefixId = ""
+		}
 	} else {
+		vmConfig.Status.EgressIpPrefixes = nil
+		vmConfig.Status.PublicIpPrefixId = ""
 		vmConfig.Status.EgressIpPrefix = strings.Join(privateIPs, ",")
 	}
+	vmConfig.Status.EgressIpv6Prefix = ipv6Prefix
+
+	vmConfig.Status.NatGatewayId = natGatewayID
+	vmConfig.Status.NatGatewayPublicIpPrefixId = ""
+	vmConfig.Status.NatGatewayPublicIpAddressId = ""
+	vmConfig.Status.OutboundIdleTimeoutMinutes = 0
+	switch {
+	case !vmConfig.Spec.ProvisionPublicIps:
+		vmConfig.Status.OutboundType = egressgatewayv1alpha1.OutboundPrivateIP
+	case natGatewayID != "":
+		vmConfig.Status.OutboundType = egressgatewayv1alpha1.OutboundNatGateway
+		if publicIPAddressRE.MatchString(ipPrefixID) {
+			vmConfig.Status.NatGatewayPublicIpAddressId = ipPrefixID
+		} else {
+			vmConfig.Status.NatGatewayPublicIpPrefixId = ipPrefixID
+		}
+	default:
+		vmConfig.Status.OutboundType = egressgatewayv1alpha1.OutboundPublicIPPrefix
+		vmConfig.Status.OutboundIdleTimeoutMinutes = outboundIdleTimeoutMinutes(vmConfig.Spec.OutboundIdleTimeoutMinutes)
+	}
+	vmConfig.Status.ObservedGeneration = vmConfig.Generation
 
 	if !equality.Semantic.DeepEqual(existing, vmConfig) {
 		log.Info(fmt.Sprintf("Updating GatewayVMConfiguration %s/%s", vmConfig.Namespace, vmConfig.Name))
@@ -269,13 +579,13 @@ func (r *GatewayVMConfigurationReconciler) reconcile(
 
 	log.Info("GatewayVMConfiguration reconciled")
 	succeeded = true
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: r.ResyncInterval}, nil
 }
 
 func (r *GatewayVMConfigurationReconciler) ensureDeleted(
 	ctx context.Context,
 	vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration,
-) (ctrl.Result, error) {
+) (_ ctrl.Result, rerr error) {
 	log := log.FromContext(ctx)
 	log.Info(fmt.Sprintf("Reconciling gatewayVMConfiguration deletion %s/%s", vmConfig.Namespace, vmConfig.Name))
 
@@ -292,22 +602,53 @@ func (r *GatewayVMConfigurationReconciler) ensureDeleted(
 		strings.ToLower(fmt.Sprintf("%s/%s", vmConfig.Namespace, vmConfig.Name)),
 	)
 	succeeded := false
-	defer func() { mc.ObserveControllerReconcileMetrics(succeeded) }()
-
-	vmss, _, err := r.getGatewayVMSS(ctx, vmConfig)
-	if err != nil {
-		log.Error(err, "failed to get vmss")
-		return ctrl.Result{}, err
-	}
-
-	if _, err := r.reconcileVMSS(ctx, vmConfig, vmss, "", false); err != nil {
-		log.Error(err, "failed to reconcile VMSS")
-		return ctrl.Result{}, err
+	defer func() {
+		mc.ObserveControllerReconcileMetrics(succeeded)
+		mc.ObserveControllerReconcileError(rerr)
+	}()
+
+	// Azure resources are released in dependency order, as a public ip prefix cannot be deleted while a vmss
+	// ipConfig or a NAT gateway still references it. Every step is a no-op once done, so a deletion interrupted
+	// by an error or a controller restart resumes by running all steps again, and the finalizer is only removed
+	// after all of them succeed.
+	cleanupSteps := []struct {
+		name    string
+		cleanup func() error
+	}{
+		{"remove ipConfigs from gateway vmss", func() error {
+			vmsses, _, err := r.getGatewayVMSSes(ctx, vmConfig)
+			if err != nil {
+				return err
+			}
+			_, err = r.reconcileGatewayVMSSes(ctx, vmConfig, vmsses, "", "", nil, false)
+			return err
+		}},
+		{"disassociate public ip from nat gateway", func() error {
+			return r.ensureNatGatewayPublicIPPrefixesDisassociated(ctx, vmConfig)
+		}},
+		{"delete managed public ip prefixes", func() error {
+			if vmConfig.Spec.ReusePublicIpPrefix {
+				log.Info("Keeping managed public ip prefixes for a gateway recreated with the same name")
+				return nil
+			}
+			if err := r.ensurePublicIPPrefixDeleted(ctx, vmConfig); err != nil {
+				return err
+			}
+			if err := r.ensureAdditionalPublicIPPrefixesDeleted(ctx, vmConfig, 1); err != nil {
+				return err
+			}
+			if vmConfig.Spec.EnableIPv6 || (vmConfig.Status != nil && vmConfig.Status.EgressIpv6Prefix != "") {
+				return r.ensureIPv6PublicIPPrefixDeleted(ctx, vmConfig)
+			}
+			return nil
+		}},
 	}
-
-	if err := r.ensurePublicIPPrefixDeleted(ctx, vmConfig); err != nil {
-		log.Error(err, "failed to delete managed public ip prefix")
-		return ctrl.Result{}, err
+	for _, step := range cleanupSteps {
+		log.Info("Cleaning up gateway resources", "step", step.name)
+		if err := step.cleanup(); err != nil {
+			log.Error(err, "failed to clean up gateway resources", "step", step.name)
+			return ctrl.Result{}, err
+		}
 	}
 
 	log.Info("Removing finalizer")
@@ -322,54 +663,209 @@ func (r *GatewayVMConfigurationReconciler) ensureDeleted(
 	return ctrl.Result{}, nil
 }
 
-func (r *GatewayVMConfigurationReconciler) getGatewayVMSS(
+// gatewayVMSS is a gateway VMSS along with the reference it is found by
+type gatewayVMSS struct {
+	ref  egressgatewayv1alpha1.VmssReference
+	vmss *compute.VirtualMachineScaleSet
+}
+
+// getGatewayVMSSes returns the gateway VMSSes, the first one provides the LB backend pool of the gateway,
+// along with the public ip prefix size to provision for them
+func (r *GatewayVMConfigurationReconciler) getGatewayVMSSes(
 	ctx context.Context,
 	vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration,
-) (*compute.VirtualMachineScaleSet, int32, error) {
+) ([]gatewayVMSS, int32, error) {
 	if vmConfig.Spec.GatewayNodepoolName != "" {
-		vmssList, err := r.ListVMSS(ctx)
+		vmss, prefixLen, err := r.getGatewayNodepoolVMSS(ctx, vmConfig.Spec.GatewayNodepoolName)
+		if err != nil {
+			return nil, 0, err
+		}
+		ref := egressgatewayv1alpha1.VmssReference{VmssResourceGroup: r.ResourceGroup, VmssName: to.Val(vmss.Name)}
+		return []gatewayVMSS{{ref: ref, vmss: vmss}}, prefixLen, nil
+	}
+	vmssRefs := vmConfig.Spec.GatewayVmssProfile.VmssReferences()
+	if len(vmssRefs) == 0 {
+		return nil, 0, fmt.Errorf("gateway VMSS not found")
+	}
+	var vmsses []gatewayVMSS
+	for _, ref := range vmssRefs {
+		vmss, err := r.GetVMSS(ctx, ref.VmssResourceGroup, ref.VmssName)
 		if err != nil {
 			return nil, 0, err
 		}
-		for i := range vmssList {
-			vmss := vmssList[i]
-			if v, ok := vmss.Tags[consts.AKSNodepoolTagKey]; ok {
-				if strings.EqualFold(to.Val(v), vmConfig.Spec.GatewayNodepoolName) {
-					if prefixLenStr, ok := vmss.Tags[consts.AKSNodepoolIPPrefixSizeTagKey]; ok {
-						if prefixLen, err := strconv.Atoi(to.Val(prefixLenStr)); err == nil && prefixLen > 0 && prefixLen <= math.MaxInt32 {
-							return vmss, int32(prefixLen), nil
-						} else {
-							return nil, 0, fmt.Errorf("failed to parse nodepool IP prefix size: %s", to.Val(prefixLenStr))
-						}
+		vmsses = append(vmsses, gatewayVMSS{ref: ref, vmss: vmss})
+	}
+	return vmsses, vmConfig.Spec.PublicIpPrefixSize, nil
+}
+
+// getGatewayNodepoolVMSS finds the vmss of the gateway nodepool and its public ip prefix size from the vmss tags
+func (r *GatewayVMConfigurationReconciler) getGatewayNodepoolVMSS(
+	ctx context.Context,
+	nodepoolName string,
+) (*compute.VirtualMachineScaleSet, int32, error) {
+	vmssList, err := r.ListVMSS(ctx, "")
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range vmssList {
+		vmss := vmssList[i]
+		if v, ok := vmss.Tags[consts.AKSNodepoolTagKey]; ok {
+			if strings.EqualFold(to.Val(v), nodepoolName) {
+				if prefixLenStr, ok := vmss.Tags[consts.AKSNodepoolIPPrefixSizeTagKey]; ok {
+					if prefixLen, err := strconv.Atoi(to.Val(prefixLenStr)); err == nil && prefixLen > 0 && prefixLen <= math.MaxInt32 {
+						return vmss, int32(prefixLen), nil
 					} else {
-						return nil, 0, fmt.Errorf("nodepool does not have IP prefix size")
+						return nil, 0, fmt.Errorf("failed to parse nodepool IP prefix size: %s", to.Val(prefixLenStr))
 					}
+				} else {
+					return nil, 0, fmt.Errorf("nodepool does not have IP prefix size")
 				}
 			}
 		}
-	} else {
-		vmss, err := r.GetVMSS(ctx, vmConfig.Spec.VmssResourceGroup, vmConfig.Spec.VmssName)
-		if err != nil {
-			return nil, 0, err
-		}
-		return vmss, vmConfig.Spec.PublicIpPrefixSize, nil
 	}
 	return nil, 0, fmt.Errorf("gateway VMSS not found")
 }
 
+// recordGatewayEvent records an event on the StaticGatewayConfiguration owning vmConfig so that provisioning
+// progress shows up when describing the gateway, both objects share the same namespaced name
+func (r *GatewayVMConfigurationReconciler) recordGatewayEvent(
+	ctx context.Context,
+	vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration,
+	eventType, reason, messageFmt string,
+	args ...interface{},
+) {
+	gwConfig := &egressgatewayv1alpha1.StaticGatewayConfiguration{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(vmConfig), gwConfig); err != nil {
+		log.FromContext(ctx).Error(err, "failed to get StaticGatewayConfiguration to record event", "reason", reason)
+		return
+	}
+	r.Recorder.Eventf(gwConfig, eventType, reason, messageFmt, args...)
+}
+
+// isSpecApplied returns whether the current spec of vmConfig has been applied to Azure resources before,
+// Azure changes needed afterwards are made out-of-band
+func isSpecApplied(vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration) bool {
+	return vmConfig.DeletionTimestamp.IsZero() && vmConfig.Status != nil &&
+		vmConfig.Status.ObservedGeneration != 0 && vmConfig.Status.ObservedGeneration == vmConfig.Generation
+}
+
+// recordDrift records a warning event when an Azure resource has to be corrected although the spec has been applied
+func (r *GatewayVMConfigurationReconciler) recordDrift(
+	ctx context.Context,
+	vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration,
+	messageFmt string,
+	args ...interface{},
+) {
+	if !isSpecApplied(vmConfig) {
+		return
+	}
+	log.FromContext(ctx).Info("Drift detected: " + fmt.Sprintf(messageFmt, args...))
+	r.recordGatewayEvent(ctx, vmConfig, corev1.EventTypeWarning, "DriftDetected", messageFmt, args...)
+}
+
 func managedSubresourceName(vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration) string {
 	return consts.ManagedResourcePrefix + string(vmConfig.GetUID())
 }
 
+func managedIPv6SubresourceName(vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration) string {
+	return managedSubresourceName(vmConfig) + consts.ManagedIPv6ResourceSuffix
+}
+
+// managedAdditionalSubresourceName returns the name of the index-th additional ipConfig, index 0 is the first
+// ipConfig named by managedSubresourceName
+func managedAdditionalSubresourceName(vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration, index int) string {
+	return fmt.Sprintf("%s-%d", managedSubresourceName(vmConfig), index)
+}
+
+// managedPublicIPPrefixName returns the name of the first managed public ip prefix. It is the name of its ipConfig,
+// unless prefixes are reused, in which case it is derived from the gateway namespace and name instead of the UID
+// so that a gateway recreated with the same name finds the prefix again.
+func managedPublicIPPrefixName(vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration) string {
+	if !vmConfig.Spec.ReusePublicIpPrefix {
+		return managedSubresourceName(vmConfig)
+	}
+	sum := sha256.Sum256([]byte(vmConfig.Namespace + "/" + vmConfig.Name))
+	return consts.ManagedResourcePrefix + hex.EncodeToString(sum[:16])
+}
+
+func managedIPv6PublicIPPrefixName(vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration) string {
+	return managedPublicIPPrefixName(vmConfig) + consts.ManagedIPv6ResourceSuffix
+}
+
+// managedAdditionalPublicIPPrefixName returns the name of the index-th additional managed public ip prefix
+func managedAdditionalPublicIPPrefixName(vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration, index int) string {
+	return fmt.Sprintf("%s-%d", managedPublicIPPrefixName(vmConfig), index)
+}
+
 func isErrorNotFound(err error) bool {
-	var respErr *azcore.ResponseError
-	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+	return errors.As(err, new(*azureclients.ErrNotFound))
 }
 
+// prefixAllocationError is returned when Azure cannot allocate a public ip prefix for lack of capacity or quota
+type prefixAllocationError struct {
+	prefixName string
+	// message returned by Azure
+	message string
+	err     error
+}
+
+func (e *prefixAllocationError) Error() string {
+	return fmt.Sprintf("failed to allocate public ip prefix %s: %s", e.prefixName, e.message)
+}
+
+func (e *prefixAllocationError) Unwrap() error {
+	return e.err
+}
+
+// regionMismatchError is returned when the public ip prefix of the gateway is not in the region of a gateway vmss,
+// so that users know to move either of them instead of getting an obscure Azure error when the prefix is assigned
+type regionMismatchError struct {
+	prefix       string
+	prefixRegion string
+	vmssName     string
+	vmssRegion   string
+}
+
+func (e *regionMismatchError) Error() string {
+	return fmt.Sprintf("public ip prefix(%s) is in region %s but gateway vmss(%s) is in region %s, they must be in the same region",
+		e.prefix, e.prefixRegion, e.vmssName, e.vmssRegion)
+}
+
+// checkPublicIPPrefixRegion returns a regionMismatchError if a gateway vmss is not in prefixRegion, the region of
+// the public ip prefix. Regions are compared ignoring case and spaces, e.g. "East US" is the same as "eastus", and
+// not compared when either of them is unknown.
+func checkPublicIPPrefixRegion(vmsses []gatewayVMSS, prefix, prefixRegion string) error {
+	normalize := func(region string) string {
+		return strings.ToLower(strings.ReplaceAll(region, " ", ""))
+	}
+	for _, vmss := range vmsses {
+		vmssRegion := to.Val(vmss.vmss.Location)
+		if prefixRegion == "" || vmssRegion == "" || normalize(prefixRegion) == normalize(vmssRegion) {
+			continue
+		}
+		return &regionMismatchError{prefix: prefix, prefixRegion: prefixRegion, vmssName: to.Val(vmss.vmss.Name), vmssRegion: vmssRegion}
+	}
+	return nil
+}
+
+// newPrefixAllocationError returns a prefixAllocationError if err means the region has no capacity or the
+// subscription has no quota left for the public ip prefix, nil otherwise
+func newPrefixAllocationError(prefixName string, err error) *prefixAllocationError {
+	var quotaErr *azureclients.ErrQuotaExceeded
+	if !errors.As(err, &quotaErr) {
+		return nil
+	}
+	return &prefixAllocationError{prefixName: prefixName, message: quotaErr.Detail(), err: err}
+}
+
+// ensurePublicIPPrefix returns the public ip prefix of the gateway, its ID and whether it is managed. The prefix,
+// either provided or managed, must be in the region of the gateway vmsses. A provided public ip address of the
+// NAT gateway is returned as a /32 prefix along with the address ID.
 func (r *GatewayVMConfigurationReconciler) ensurePublicIPPrefix(
 	ctx context.Context,
 	ipPrefixLength int32,
 	vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration,
+	vmsses []gatewayVMSS,
 ) (string, string, bool, error) {
 	log := log.FromContext(ctx)
 
@@ -379,6 +875,11 @@ func (r *GatewayVMConfigurationReconciler) ensurePublicIPPrefix(
 		return "", "", false, nil
 	}
 
+	if vmConfig.Spec.NatGatewayId != "" && vmConfig.Spec.PublicIpAddressId != "" {
+		ipPrefix, err := r.getPublicIPAddressPrefix(ctx, vmConfig, vmsses)
+		return ipPrefix, vmConfig.Spec.PublicIpAddressId, false, err
+	}
+
 	if vmConfig.Spec.PublicIpPrefixId != "" {
 		// if there is public prefix ip specified, prioritize this one
 		matches := publicIPPrefixRE.FindStringSubmatch(vmConfig.Spec.PublicIpPrefixId)
@@ -389,63 +890,315 @@ func (r *GatewayVMConfigurationReconciler) ensurePublicIPPrefix(
 		if subscriptionID != r.SubscriptionID() {
 			return "", "", false, fmt.Errorf("public ip prefix subscription(%s) is not in the same subscription(%s)", subscriptionID, r.SubscriptionID())
 		}
+		// provided public ip prefix is only read, it is never created or updated
 		ipPrefix, err := r.GetPublicIPPrefix(ctx, resourceGroupName, publicIpPrefixName)
 		if err != nil {
+			if isErrorNotFound(err) {
+				return "", "", false, fmt.Errorf("public ip prefix(%s) is not found, it must be created before being referenced: %w", vmConfig.Spec.PublicIpPrefixId, err)
+			}
 			return "", "", false, fmt.Errorf("failed to get public ip prefix(%s): %w", vmConfig.Spec.PublicIpPrefixId, err)
 		}
 		if ipPrefix.Properties == nil {
 			return "", "", false, fmt.Errorf("public ip prefix(%s) has empty properties", vmConfig.Spec.PublicIpPrefixId)
 		}
-		if to.Val(ipPrefix.Properties.PrefixLength) != ipPrefixLength {
+		// the size is optional for a provided prefix on a gateway vmss, any size is accepted then
+		if ipPrefixLength != 0 && to.Val(ipPrefix.Properties.PrefixLength) != ipPrefixLength {
 			return "", "", false, fmt.Errorf("provided public ip prefix has invalid length(%d), required(%d)", to.Val(ipPrefix.Properties.PrefixLength), ipPrefixLength)
 		}
+		if err := checkPublicIPPrefixRegion(vmsses, vmConfig.Spec.PublicIpPrefixId, to.Val(ipPrefix.Location)); err != nil {
+			return "", "", false, err
+		}
 		log.Info("Found existing unmanaged public ip prefix", "public ip prefix", to.Val(ipPrefix.Properties.IPPrefix))
 		return to.Val(ipPrefix.Properties.IPPrefix), to.Val(ipPrefix.ID), false, nil
 	} else {
+		// managed public ip prefixes are created in the region of the cluster
+		if err := checkPublicIPPrefixRegion(vmsses, managedPublicIPPrefixName(vmConfig), r.Location()); err != nil {
+			return "", "", false, err
+		}
 		// check if there's managed public prefix ip
-		publicIpPrefixName := managedSubresourceName(vmConfig)
-		ipPrefix, err := r.GetPublicIPPrefix(ctx, "", publicIpPrefixName)
-		if err == nil {
-			if ipPrefix.Properties == nil {
-				return "", "", false, fmt.Errorf("managed public ip prefix has empty properties")
-			} else {
-				log.Info("Found existing managed public ip prefix", "public ip prefix", to.Val(ipPrefix.Properties.IPPrefix))
-				return to.Val(ipPrefix.Properties.IPPrefix), to.Val(ipPrefix.ID), true, nil
-			}
+		prefix, prefixID, reused, err := r.ensureManagedPublicIPPrefix(ctx, vmConfig, managedPublicIPPrefixName(vmConfig), ipPrefixLength, network.IPVersionIPv4)
+		if err != nil {
+			return "", "", false, err
+		}
+		if vmConfig.Status == nil {
+			vmConfig.Status = &egressgatewayv1alpha1.GatewayVMConfigurationStatus{}
+		}
+		vmConfig.Status.PublicIpPrefixReused = reused
+		return prefix, prefixID, true, nil
+	}
+}
+
+// getPublicIPAddressPrefix returns the provided public ip address as a /32 prefix. The address is only read, it must
+// be allocated, as a Standard static address is, and in the region of the gateway vmsses.
+func (r *GatewayVMConfigurationReconciler) getPublicIPAddressPrefix(
+	ctx context.Context,
+	vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration,
+	vmsses []gatewayVMSS,
+) (string, error) {
+	log := log.FromContext(ctx)
+	matches := publicIPAddressRE.FindStringSubmatch(vmConfig.Spec.PublicIpAddressId)
+	if len(matches) != 4 {
+		return "", fmt.Errorf("failed to parse public ip address id: %s", vmConfig.Spec.PublicIpAddressId)
+	}
+	subscriptionID, resourceGroupName, publicIPAddressName := matches[1], matches[2], matches[3]
+	if subscriptionID != r.SubscriptionID() {
+		return "", fmt.Errorf("public ip address subscription(%s) is not in the same subscription(%s)", subscriptionID, r.SubscriptionID())
+	}
+	ip, err := r.GetPublicIPAddress(ctx, resourceGroupName, publicIPAddressName)
+	if err != nil {
+		if isErrorNotFound(err) {
+			return "", fmt.Errorf("public ip address(%s) is not found, it must be created before being referenced: %w", vmConfig.Spec.PublicIpAddressId, err)
+		}
+		return "", fmt.Errorf("failed to get public ip address(%s): %w", vmConfig.Spec.PublicIpAddressId, err)
+	}
+	if ip.Properties == nil || to.Val(ip.Properties.IPAddress) == "" {
+		return "", fmt.Errorf("public ip address(%s) has no ip allocated", vmConfig.Spec.PublicIpAddressId)
+	}
+	if err := checkPublicIPPrefixRegion(vmsses, vmConfig.Spec.PublicIpAddressId, to.Val(ip.Location)); err != nil {
+		return "", err
+	}
+	log.Info("Found existing unmanaged public ip address", "public ip address", to.Val(ip.Properties.IPAddress))
+	return to.Val(ip.Properties.IPAddress) + "/32", nil
+}
+
+// ensureIPv6PublicIPPrefix ensures the managed IPv6 public ip prefix exists when IPv6 egress is enabled.
+// BYO prefix is not supported for IPv6, the managed prefix holds the same number of addresses as the IPv4 one.
+func (r *GatewayVMConfigurationReconciler) ensureIPv6PublicIPPrefix(
+	ctx context.Context,
+	ipPrefixLength int32,
+	vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration,
+) (string, string, error) {
+	if !vmConfig.Spec.ProvisionPublicIps || !vmConfig.Spec.EnableIPv6 {
+		return "", "", nil
+	}
+	ipv6PrefixLength := 128 - (32 - ipPrefixLength)
+	prefix, prefixID, _, err := r.ensureManagedPublicIPPrefix(ctx, vmConfig, managedIPv6PublicIPPrefixName(vmConfig), ipv6PrefixLength, network.IPVersionIPv6)
+	return prefix, prefixID, err
+}
+
+// ensureAdditionalPublicIPPrefixes ensures the managed public ip prefixes other than the first one exist when
+// more than one prefix is requested, returns the prefixes and their IDs ordered by index.
+func (r *GatewayVMConfigurationReconciler) ensureAdditionalPublicIPPrefixes(
+	ctx context.Context,
+	ipPrefixLength int32,
+	vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration,
+) ([]string, []string, error) {
+	if !vmConfig.Spec.ProvisionPublicIps || vmConfig.Spec.PublicIpPrefixId != "" || vmConfig.Spec.PublicIpAddressId != "" {
+		return nil, nil, nil
+	}
+	var prefixes, prefixIDs []string
+	for i := 1; i < int(vmConfig.Spec.PublicIpPrefixCount); i++ {
+		prefix, prefixID, _, err := r.ensureManagedPublicIPPrefix(ctx, vmConfig, managedAdditionalPublicIPPrefixName(vmConfig, i), ipPrefixLength, network.IPVersionIPv4)
+		if err != nil {
+			return nil, nil, err
+		}
+		prefixes = append(prefixes, prefix)
+		prefixIDs = append(prefixIDs, prefixID)
+	}
+	return prefixes, prefixIDs, nil
+}
+
+// ensureManagedPublicIPPrefix returns the managed public ip prefix, its ID and whether it was created for a
+// deleted gateway with the same namespace and name and is reused, creating the prefix if it does not exist
+func (r *GatewayVMConfigurationReconciler) ensureManagedPublicIPPrefix(
+	ctx context.Context,
+	vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration,
+	publicIpPrefixName string,
+	ipPrefixLength int32,
+	ipVersion network.IPVersion,
+) (string, string, bool, error) {
+	log := log.FromContext(ctx)
+	tags := r.publicIPPrefixTags(vmConfig)
+	ipPrefix, err := r.GetPublicIPPrefix(ctx, "", publicIpPrefixName)
+	if err == nil {
+		if ipPrefix.Properties == nil {
+			return "", "", false, fmt.Errorf("managed public ip prefix has empty properties")
 		} else {
-			if !isErrorNotFound(err) {
-				return "", "", false, fmt.Errorf("failed to get managed public ip prefix: %w", err)
-			}
-			// create new public ip prefix
-			newIPPrefix := network.PublicIPPrefix{
-				Name:     to.Ptr(publicIpPrefixName),
-				Location: to.Ptr(r.Location()),
-				Properties: &network.PublicIPPrefixPropertiesFormat{
-					PrefixLength:           to.Ptr(ipPrefixLength),
-					PublicIPAddressVersion: to.Ptr(network.IPVersionIPv4),
-				},
-				SKU: &network.PublicIPPrefixSKU{
-					Name: to.Ptr(network.PublicIPPrefixSKUNameStandard),
-					Tier: to.Ptr(network.PublicIPPrefixSKUTierRegional),
-				},
+			log.Info("Found existing managed public ip prefix", "public ip prefix", to.Val(ipPrefix.Properties.IPPrefix))
+			reused := false
+			if vmConfig.Spec.ReusePublicIpPrefix {
+				reclaimed, err := checkPublicIPPrefixReusable(vmConfig, ipPrefix)
+				if err != nil {
+					r.recordGatewayEvent(ctx, vmConfig, corev1.EventTypeWarning, "PublicIPPrefixReuseFailed", "Failed to reuse public ip prefix %s: %v", publicIpPrefixName, err)
+					return "", "", false, err
+				}
+				if reclaimed {
+					r.recordGatewayEvent(ctx, vmConfig, corev1.EventTypeNormal, "PublicIPPrefixReused", "Reusing public ip prefix %s: %s", publicIpPrefixName, to.Val(ipPrefix.Properties.IPPrefix))
+				}
+				// the creator tag is never updated, so that reuse is still reported after the owner tag is
+				// moved to this gateway
+				reused = getTagValue(ipPrefix.Tags, consts.PublicIPPrefixCreatorTagKey) != string(vmConfig.GetUID())
 			}
-			log.Info("Creating new managed public ip prefix")
-			ipPrefix, err := r.CreateOrUpdatePublicIPPrefix(ctx, "", publicIpPrefixName, newIPPrefix)
-			if err != nil {
-				return "", "", false, fmt.Errorf("failed to create managed public ip prefix: %w", err)
+			// the owner tag of a reclaimed prefix is updated here as well
+			if mergedTags, changed := mergeTags(ipPrefix.Tags, tags); changed {
+				log.Info("Updating tags of managed public ip prefix", "public ip prefix", publicIpPrefixName)
+				ipPrefix.Tags = mergedTags
+				if ipPrefix, err = r.CreateOrUpdatePublicIPPrefix(ctx, "", publicIpPrefixName, *ipPrefix); err != nil {
+					return "", "", false, fmt.Errorf("failed to update tags of managed public ip prefix: %w", err)
+				}
 			}
-			return to.Val(ipPrefix.Properties.IPPrefix), to.Val(ipPrefix.ID), true, nil
+			return to.Val(ipPrefix.Properties.IPPrefix), to.Val(ipPrefix.ID), reused, nil
+		}
+	} else {
+		if !isErrorNotFound(err) {
+			return "", "", false, fmt.Errorf("failed to get managed public ip prefix: %w", err)
+		}
+		if vmConfig.Spec.ReusePublicIpPrefix {
+			tags[consts.PublicIPPrefixCreatorTagKey] = to.Ptr(string(vmConfig.GetUID()))
+		}
+		// create new public ip prefix
+		newIPPrefix := network.PublicIPPrefix{
+			Name:     to.Ptr(publicIpPrefixName),
+			Location: to.Ptr(r.Location()),
+			Tags:     tags,
+			Properties: &network.PublicIPPrefixPropertiesFormat{
+				PrefixLength:           to.Ptr(ipPrefixLength),
+				PublicIPAddressVersion: to.Ptr(ipVersion),
+			},
+			SKU: &network.PublicIPPrefixSKU{
+				Name: to.Ptr(network.PublicIPPrefixSKUNameStandard),
+				Tier: to.Ptr(network.PublicIPPrefixSKUTierRegional),
+			},
+		}
+		log.Info("Creating new managed public ip prefix", "ip version", ipVersion)
+		r.recordDrift(ctx, vmConfig, "Managed public ip prefix %s is missing", publicIpPrefixName)
+		r.recordGatewayEvent(ctx, vmConfig, corev1.EventTypeNormal, "PublicIPPrefixProvisioning", "Creating %s public ip prefix %s", ipVersion, publicIpPrefixName)
+		ipPrefix, err := r.CreateOrUpdatePublicIPPrefix(ctx, "", publicIpPrefixName, newIPPrefix)
+		if err != nil {
+			if allocErr := newPrefixAllocationError(publicIpPrefixName, err); allocErr != nil {
+				return "", "", false, allocErr
+			}
+			r.recordGatewayEvent(ctx, vmConfig, corev1.EventTypeWarning, "PublicIPPrefixProvisionFailed", "Failed to create public ip prefix %s: %v", publicIpPrefixName, err)
+			return "", "", false, fmt.Errorf("failed to create managed public ip prefix: %w", err)
+		}
+		r.recordGatewayEvent(ctx, vmConfig, corev1.EventTypeNormal, "PublicIPPrefixProvisioned", "Created public ip prefix %s: %s", publicIpPrefixName, to.Val(ipPrefix.Properties.IPPrefix))
+		return to.Val(ipPrefix.Properties.IPPrefix), to.Val(ipPrefix.ID), false, nil
+	}
+}
+
+// checkPublicIPPrefixReusable checks a managed public ip prefix named after the gateway namespace and name, and
+// returns true when it is left by a deleted gateway and can be taken over. Prefixes named after another gateway,
+// which only happens on a name hash collision, and prefixes still used by a vmss ipConfig or a NAT gateway of
+// another gateway, e.g. of another cluster sharing the resource group, are refused.
+func checkPublicIPPrefixReusable(vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration, ipPrefix *network.PublicIPPrefix) (bool, error) {
+	gatewayName := vmConfig.Namespace + "/" + vmConfig.Name
+	if owner := getTagValue(ipPrefix.Tags, consts.PublicIPPrefixGatewayTagKey); owner != "" && owner != gatewayName {
+		return false, fmt.Errorf("public ip prefix %s is named after gateway %s", to.Val(ipPrefix.Name), owner)
+	}
+	if getTagValue(ipPrefix.Tags, consts.PublicIPPrefixOwnerTagKey) == string(vmConfig.GetUID()) {
+		return false, nil
+	}
+	if len(ipPrefix.Properties.PublicIPAddresses) > 0 || ipPrefix.Properties.NatGateway != nil {
+		return false, fmt.Errorf("public ip prefix %s is still in use by another gateway, it can only be reused once released", to.Val(ipPrefix.Name))
+	}
+	return true, nil
+}
+
+// getTagValue returns value of the tag, Azure tag names are case-insensitive
+func getTagValue(tags map[string]*string, key string) string {
+	for k, v := range tags {
+		if strings.EqualFold(k, key) {
+			return to.Val(v)
 		}
 	}
+	return ""
+}
+
+// publicIPPrefixTags returns the tags of managed public ip prefixes, nil if there's none. Reusable prefixes are
+// also tagged with the gateway they are named after and the gateway configuration currently using them.
+func (r *GatewayVMConfigurationReconciler) publicIPPrefixTags(vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration) map[string]*string {
+	if len(r.DefaultTags) == 0 && len(vmConfig.Spec.Tags) == 0 && !vmConfig.Spec.ReusePublicIpPrefix {
+		return nil
+	}
+	tags := make(map[string]*string)
+	for _, source := range []map[string]string{r.DefaultTags, vmConfig.Spec.Tags} {
+		for k, v := range source {
+			tags[k] = to.Ptr(v)
+		}
+	}
+	if vmConfig.Spec.ReusePublicIpPrefix {
+		tags[consts.PublicIPPrefixGatewayTagKey] = to.Ptr(vmConfig.Namespace + "/" + vmConfig.Name)
+		tags[consts.PublicIPPrefixOwnerTagKey] = to.Ptr(string(vmConfig.GetUID()))
+	}
+	return tags
+}
+
+// mergeTags adds desired tags to existing ones, tags not in desired are kept. Azure tag names are case-insensitive.
+func mergeTags(existing, desired map[string]*string) (map[string]*string, bool) {
+	merged := make(map[string]*string, len(existing)+len(desired))
+	for k, v := range existing {
+		merged[k] = v
+	}
+	changed := false
+	for k, v := range desired {
+		found := false
+		for existingKey, existingValue := range existing {
+			if strings.EqualFold(existingKey, k) {
+				found = true
+				if to.Val(existingValue) != to.Val(v) {
+					merged[existingKey] = v
+					changed = true
+				}
+				break
+			}
+		}
+		if !found {
+			merged[k] = v
+			changed = true
+		}
+	}
+	return merged, changed
 }
 
 func (r *GatewayVMConfigurationReconciler) ensurePublicIPPrefixDeleted(
 	ctx context.Context,
 	vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration,
 ) error {
-	log := log.FromContext(ctx)
 	// only ensure managed public prefix ip is deleted
-	publicIpPrefixName := managedSubresourceName(vmConfig)
+	return r.ensureManagedPublicIPPrefixDeleted(ctx, managedPublicIPPrefixName(vmConfig))
+}
+
+func (r *GatewayVMConfigurationReconciler) ensureIPv6PublicIPPrefixDeleted(
+	ctx context.Context,
+	vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration,
+) error {
+	return r.ensureManagedPublicIPPrefixDeleted(ctx, managedIPv6PublicIPPrefixName(vmConfig))
+}
+
+// ensureAdditionalPublicIPPrefixesDeleted deletes additional managed public ip prefixes whose index is not less than
+// count. Prefixes are found by their names rather than status, which misses prefixes created right before a
+// controller restart. They are created in ascending and deleted in descending index order, so existing indexes are
+// always contiguous and the first missing name ends the search.
+func (r *GatewayVMConfigurationReconciler) ensureAdditionalPublicIPPrefixesDeleted(
+	ctx context.Context,
+	vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration,
+	count int,
+) error {
+	last := max(count, 1) - 1
+	for i := max(count, 1); i < consts.MaxPublicIpPrefixCount; i++ {
+		if _, err := r.GetPublicIPPrefix(ctx, "", managedAdditionalPublicIPPrefixName(vmConfig, i)); err != nil {
+			if isErrorNotFound(err) {
+				break
+			}
+			return fmt.Errorf("failed to get public ip prefix(%s): %w", managedAdditionalPublicIPPrefixName(vmConfig, i), err)
+		}
+		last = i
+	}
+	for i := last; i >= max(count, 1); i-- {
+		publicIpPrefixName := managedAdditionalPublicIPPrefixName(vmConfig, i)
+		log.FromContext(ctx).Info("Deleting managed public ip prefix", "public ip prefix name", publicIpPrefixName)
+		if err := r.DeletePublicIPPrefix(ctx, "", publicIpPrefixName); err != nil {
+			return fmt.Errorf("failed to delete public ip prefix(%s): %w", publicIpPrefixName, err)
+		}
+	}
+	return nil
+}
+
+func (r *GatewayVMConfigurationReconciler) ensureManagedPublicIPPrefixDeleted(
+	ctx context.Context,
+	publicIpPrefixName string,
+) error {
+	log := log.FromContext(ctx)
 	_, err := r.GetPublicIPPrefix(ctx, "", publicIpPrefixName)
 	if err != nil {
 		if isErrorNotFound(err) {
@@ -463,31 +1216,304 @@ func (r *GatewayVMConfigurationReconciler) ensurePublicIPPrefixDeleted(
 	}
 }
 
+// ensureNatGatewayPublicIPPrefixesDisassociated removes the public ip prefix or address of vmConfig from NAT
+// gateways on deletion. Besides the association recorded in status, the one requested in spec is removed as well, in case
+// it was made right before a controller restart and never recorded.
+func (r *GatewayVMConfigurationReconciler) ensureNatGatewayPublicIPPrefixesDisassociated(
+	ctx context.Context,
+	vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration,
+) error {
+	var natGatewayID, ipPrefixID string
+	if vmConfig.Status != nil && vmConfig.Status.NatGatewayId != "" {
+		natGatewayID, ipPrefixID = vmConfig.Status.NatGatewayId, natGatewayPublicIPID(vmConfig.Status)
+		if err := r.ensureNatGatewayPublicIP(ctx, vmConfig, natGatewayID, ipPrefixID, false); err != nil {
+			return err
+		}
+	}
+	if !vmConfig.Spec.ProvisionPublicIps || vmConfig.Spec.NatGatewayId == "" {
+		return nil
+	}
+	specIPPrefixID := vmConfig.Spec.PublicIpAddressId
+	if specIPPrefixID == "" {
+		specIPPrefixID = vmConfig.Spec.PublicIpPrefixId
+	}
+	if specIPPrefixID == "" {
+		specIPPrefixID = fmt.Sprintf(azmanager.PublicIPPrefixIDTemplate, r.SubscriptionID(), r.ResourceGroup, managedPublicIPPrefixName(vmConfig))
+	}
+	if strings.EqualFold(natGatewayID, vmConfig.Spec.NatGatewayId) && strings.EqualFold(ipPrefixID, specIPPrefixID) {
+		return nil
+	}
+	return r.ensureNatGatewayPublicIP(ctx, vmConfig, vmConfig.Spec.NatGatewayId, specIPPrefixID, false)
+}
+
+// natGatewayPublicIPID returns the ID of the public ip prefix or address recorded as associated with the NAT gateway
+func natGatewayPublicIPID(status *egressgatewayv1alpha1.GatewayVMConfigurationStatus) string {
+	if status.NatGatewayPublicIpAddressId != "" {
+		return status.NatGatewayPublicIpAddressId
+	}
+	return status.NatGatewayPublicIpPrefixId
+}
+
+// ensureNatGatewayPublicIP adds the public ip prefix or address to, or removes it from, the public ip prefixes or
+// addresses of the NAT gateway, depending on the type of ipPrefixID. Other prefixes and addresses of the NAT gateway
+// are left untouched as they may be managed by the user.
+func (r *GatewayVMConfigurationReconciler) ensureNatGatewayPublicIP(
+	ctx context.Context,
+	vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration,
+	natGatewayID string,
+	ipPrefixID string,
+	associate bool,
+) error {
+	log := log.FromContext(ctx)
+	matches := natGatewayRE.FindStringSubmatch(natGatewayID)
+	if len(matches) != 4 {
+		return fmt.Errorf("failed to parse nat gateway id: %s", natGatewayID)
+	}
+	subscriptionID, resourceGroupName, natGatewayName := matches[1], matches[2], matches[3]
+	if subscriptionID != r.SubscriptionID() {
+		return fmt.Errorf("nat gateway subscription(%s) is not in the same subscription(%s)", subscriptionID, r.SubscriptionID())
+	}
+	// a BYO nat gateway may be shared by several gateways
+	defer r.LockResource(natGatewayID)()
+	natGateway, err := r.GetNatGateway(ctx, resourceGroupName, natGatewayName)
+	if err != nil {
+		if !associate && isErrorNotFound(err) {
+			// association is gone along with the NAT gateway
+			return nil
+		}
+		return fmt.Errorf("failed to get nat gateway(%s): %w", natGatewayID, err)
+	}
+	if natGateway.Properties == nil {
+		natGateway.Properties = &network.NatGatewayPropertiesFormat{}
+	}
+	kind, prefixes := "public ip prefix", &natGateway.Properties.PublicIPPrefixes
+	if publicIPAddressRE.MatchString(ipPrefixID) {
+		kind, prefixes = "public ip address", &natGateway.Properties.PublicIPAddresses
+	}
+	index := slices.IndexFunc(*prefixes, func(prefix *network.SubResource) bool {
+		return prefix != nil && strings.EqualFold(to.Val(prefix.ID), ipPrefixID)
+	})
+	if associate == (index >= 0) {
+		return nil
+	}
+	if associate {
+		log.Info("Associating "+kind+" with nat gateway", "nat gateway", natGatewayID, kind, ipPrefixID)
+		r.recordDrift(ctx, vmConfig, "Public ip %s is no longer associated with nat gateway %s", ipPrefixID, natGatewayID)
+		*prefixes = append(*prefixes, &network.SubResource{ID: to.Ptr(ipPrefixID)})
+	} else {
+		log.Info("Disassociating "+kind+" from nat gateway", "nat gateway", natGatewayID, kind, ipPrefixID)
+		*prefixes = slices.Delete(*prefixes, index, index+1)
+	}
+	if _, err := r.CreateOrUpdateNatGateway(ctx, resourceGroupName, natGatewayName, *natGateway); err != nil {
+		return fmt.Errorf("failed to update nat gateway(%s): %w", natGatewayID, err)
+	}
+	return nil
+}
+
+// reconcileGatewayVMSSes applies the gateway configuration to all gateway VMSSes, or removes it from them when
+// wantIPConfig is false. Instances of all VMSSes join the LB backend pool of the first one, so that peers are
+// served by any of them. VMSSes configured before but no longer referenced are cleaned up as well, their
+// instances then fail the gateway LB health probe and peers move to instances of the remaining VMSSes.
+func (r *GatewayVMConfigurationReconciler) reconcileGatewayVMSSes(
+	ctx context.Context,
+	vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration,
+	vmsses []gatewayVMSS,
+	ipPrefixID string,
+	ipv6PrefixID string,
+	additionalIPPrefixIDs []string,
+	wantIPConfig bool,
+) ([]string, error) {
+	log := log.FromContext(ctx)
+	if len(vmsses) == 0 || vmsses[0].vmss.Properties == nil {
+		return nil, fmt.Errorf("vmss has empty properties")
+	}
+	lbBackendpoolID := to.Val(r.GetLBBackendAddressPoolID(to.Val(vmsses[0].vmss.Properties.UniqueID)))
+
+	var privateIPs, nodeNames []string
+	var vmssRefs []egressgatewayv1alpha1.VmssReference
+	for _, vmss := range vmsses {
+		ips, names, err := r.reconcileLockedVMSS(ctx, vmConfig, vmss, lbBackendpoolID, ipPrefixID, ipv6PrefixID, additionalIPPrefixIDs, wantIPConfig)
+		if err != nil {
+			return nil, err
+		}
+		privateIPs = append(privateIPs, ips...)
+		nodeNames = append(nodeNames, names...)
+		vmssRefs = append(vmssRefs, vmss.ref)
+	}
+
+	if vmConfig.Status == nil {
+		vmConfig.Status = &egressgatewayv1alpha1.GatewayVMConfigurationStatus{}
+	}
+	for _, ref := range vmConfig.Status.Vmsses {
+		if slices.ContainsFunc(vmssRefs, func(current egressgatewayv1alpha1.VmssReference) bool { return sameVMSS(current, ref) }) {
+			continue
+		}
+		log.Info("Removing gateway configuration from vmss no longer referenced", "vmssResourceGroup", ref.VmssResourceGroup, "vmssName", ref.VmssName)
+		vmss, err := r.GetVMSS(ctx, ref.VmssResourceGroup, ref.VmssName)
+		if err != nil {
+			if isErrorNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get vmss(%s): %w", ref.VmssName, err)
+		}
+		backendpoolID := lbBackendpoolID
+		if sameVMSS(ref, vmConfig.Status.Vmsses[0]) && vmss.Properties != nil {
+			// the removed vmss was the first one, its instances were in its own backend pool
+			backendpoolID = to.Val(r.GetLBBackendAddressPoolID(to.Val(vmss.Properties.UniqueID)))
+		}
+		if _, _, err := r.reconcileLockedVMSS(ctx, vmConfig, gatewayVMSS{ref: ref, vmss: vmss}, backendpoolID, "", "", nil, false); err != nil {
+			return nil, err
+		}
+	}
+
+	// clean up VMProfiles for deleted nodes and nodes of removed VMSSes
+	var vmprofiles []egressgatewayv1alpha1.GatewayVMProfile
+	for _, profile := range vmConfig.Status.GatewayVMProfiles {
+		// profiles are keyed by computer name, whose case may differ from the node name
+		if slices.ContainsFunc(nodeNames, func(name string) bool { return strings.EqualFold(name, profile.NodeName) }) {
+			vmprofiles = append(vmprofiles, profile)
+		}
+	}
+	vmConfig.Status.GatewayVMProfiles = vmprofiles
+	if wantIPConfig {
+		vmConfig.Status.Vmsses = vmssRefs
+		vmConfig.Status.GatewayInstances = int32(len(nodeNames))
+		slices.Sort(nodeNames)
+		vmConfig.Status.GatewayNodes = nodeNames
+	} else {
+		vmConfig.Status.Vmsses = nil
+		vmConfig.Status.GatewayInstances = 0
+		vmConfig.Status.GatewayNodes = nil
+	}
+
+	if err := r.Status().Update(ctx, vmConfig); err != nil {
+		return nil, fmt.Errorf("failed to update vm config status: %w", err)
+	}
+	return privateIPs, nil
+}
+
+// reconcileLockedVMSS reconciles the vmss while holding its lock. The vmss is shared by all gateways on the
+// nodepool, so its latest model is fetched under the lock to not overwrite changes from concurrent reconciles.
+func (r *GatewayVMConfigurationReconciler) reconcileLockedVMSS(
+	ctx context.Context,
+	vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration,
+	vmss gatewayVMSS,
+	lbBackendpoolID string,
+	ipPrefixID string,
+	ipv6PrefixID string,
+	additionalIPPrefixIDs []string,
+	wantIPConfig bool,
+) ([]string, []string, error) {
+	defer r.LockResource(to.Val(vmss.vmss.ID))()
+	// fetch again with the lock held, the vmss may have been updated for another gateway meanwhile
+	latest, err := r.getVMSS(ctx, vmConfig, vmss.ref)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get vmss: %w", err)
+	}
+	return r.reconcileVMSS(ctx, vmConfig, latest, vmss.ref.VmssResourceGroup, lbBackendpoolID, ipPrefixID, ipv6PrefixID, additionalIPPrefixIDs, wantIPConfig)
+}
+
+// getVMSS gets the vmss referenced by ref, the vmss of a gateway nodepool is looked up from the vmss list
+func (r *GatewayVMConfigurationReconciler) getVMSS(
+	ctx context.Context,
+	vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration,
+	ref egressgatewayv1alpha1.VmssReference,
+) (*compute.VirtualMachineScaleSet, error) {
+	if vmConfig.Spec.GatewayNodepoolName != "" {
+		vmss, _, err := r.getGatewayNodepoolVMSS(ctx, vmConfig.Spec.GatewayNodepoolName)
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(to.Val(vmss.Name), ref.VmssName) {
+			return vmss, nil
+		}
+	}
+	return r.GetVMSS(ctx, ref.VmssResourceGroup, ref.VmssName)
+}
+
+// isBackendPoolShared returns whether another gateway spanning the vmss uses the same LB backend pool as vmConfig,
+// i.e. its first VMSS is the same
+func (r *GatewayVMConfigurationReconciler) isBackendPoolShared(
+	ctx context.Context,
+	vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration,
+	vmss *compute.VirtualMachineScaleSet,
+) (bool, error) {
+	if vmConfig.Status == nil || len(vmConfig.Status.Vmsses) == 0 {
+		return false, nil
+	}
+	owner := vmConfig.Status.Vmsses[0]
+	resourceID, err := arm.ParseResourceID(to.Val(vmss.ID))
+	if err != nil {
+		return false, fmt.Errorf("failed to parse vmss ID(%s): %w", to.Val(vmss.ID), err)
+	}
+	ref := egressgatewayv1alpha1.VmssReference{VmssResourceGroup: resourceID.ResourceGroupName, VmssName: resourceID.Name}
+	vmConfigList := &egressgatewayv1alpha1.GatewayVMConfigurationList{}
+	if err := r.List(ctx, vmConfigList); err != nil {
+		return false, fmt.Errorf("failed to list gateway vm configurations: %w", err)
+	}
+	for _, other := range vmConfigList.Items {
+		if other.UID == vmConfig.UID || !other.DeletionTimestamp.IsZero() || other.Status == nil || len(other.Status.Vmsses) == 0 {
+			continue
+		}
+		if sameVMSS(other.Status.Vmsses[0], owner) &&
+			slices.ContainsFunc(other.Status.Vmsses, func(current egressgatewayv1alpha1.VmssReference) bool { return sameVMSS(current, ref) }) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func sameVMSS(a, b egressgatewayv1alpha1.VmssReference) bool {
+	return strings.EqualFold(a.VmssResourceGroup, b.VmssResourceGroup) && strings.EqualFold(a.VmssName, b.VmssName)
+}
+
+// reconcileVMSS applies the gateway ipConfigs to the vmss in vmssResourceGroup and its instances, returns private
+// IPs of instances when the ipConfigs carry no public ip and names of all instances
 func (r *GatewayVMConfigurationReconciler) reconcileVMSS(
 	ctx context.Context,
 	vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration,
 	vmss *compute.VirtualMachineScaleSet,
+	vmssResourceGroup string,
+	lbBackendpoolID string,
 	ipPrefixID string,
+	ipv6PrefixID string,
+	additionalIPPrefixIDs []string,
 	wantIPConfig bool,
-) ([]string, error) {
+) ([]string, []string, error) {
 	log := log.FromContext(ctx)
 	ipConfigName := managedSubresourceName(vmConfig)
 	needUpdate := false
 
 	if vmss.Properties == nil || vmss.Properties.VirtualMachineProfile == nil ||
 		vmss.Properties.VirtualMachineProfile.NetworkProfile == nil {
-		return nil, fmt.Errorf("vmss has empty network profile")
+		return nil, nil, fmt.Errorf("vmss has empty network profile")
+	}
+	if wantIPConfig {
+		if err := azmanager.CheckVMSSGatewayReady(vmss); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// instances of a vmss whose own backend pool is not the gateway's only stay in the pool while some
+	// gateway spanning the vmss uses it, otherwise the pool could not be deleted along with its frontend
+	keepBackendPool := wantIPConfig || strings.EqualFold(lbBackendpoolID, to.Val(r.GetLBBackendAddressPoolID(to.Val(vmss.Properties.UniqueID))))
+	if !keepBackendPool {
+		shared, err := r.isBackendPoolShared(ctx, vmConfig, vmss)
+		if err != nil {
+			return nil, nil, err
+		}
+		keepBackendPool = shared
 	}
 
-	lbBackendpoolID := r.GetLBBackendAddressPoolID(to.Val(vmss.Properties.UniqueID))
 	interfaces := vmss.Properties.VirtualMachineProfile.NetworkProfile.NetworkInterfaceConfigurations
-	needUpdate, err := r.reconcileVMSSNetworkInterface(ctx, ipConfigName, ipPrefixID, to.Val(lbBackendpoolID), wantIPConfig, interfaces)
+	needUpdate, err := r.reconcileVMSSNetworkInterface(ctx, ipConfigName, ipPrefixID, ipv6PrefixID, additionalIPPrefixIDs, vmConfig.Spec.OutboundIdleTimeoutMinutes, lbBackendpoolID, keepBackendPool, wantIPConfig, interfaces)
 	if err != nil {
-		return nil, fmt.Errorf("failed to reconcile vmss interface(%s): %w", to.Val(vmss.Name), err)
+		return nil, nil, fmt.Errorf("failed to reconcile vmss interface(%s): %w", to.Val(vmss.Name), err)
 	}
 
 	if needUpdate {
 		log.Info("Updating vmss", "vmssName", to.Val(vmss.Name))
+		r.recordDrift(ctx, vmConfig, "Network configuration of vmss %s has been modified", to.Val(vmss.Name))
 		newVmss := compute.VirtualMachineScaleSet{
 			Location: vmss.Location,
 			Properties: &compute.VirtualMachineScaleSetProperties{
@@ -496,56 +1522,47 @@ func (r *GatewayVMConfigurationReconciler) reconcileVMSS(
 				},
 			},
 		}
-		if _, err := r.CreateOrUpdateVMSS(ctx, "", to.Val(vmss.Name), newVmss); err != nil {
-			return nil, fmt.Errorf("failed to update vmss(%s): %w", to.Val(vmss.Name), err)
+		if _, err := r.CreateOrUpdateVMSS(ctx, vmssResourceGroup, to.Val(vmss.Name), newVmss); err != nil {
+			r.recordGatewayEvent(ctx, vmConfig, corev1.EventTypeWarning, "VMSSConfigFailed", "Failed to update vmss %s: %v", to.Val(vmss.Name), err)
+			return nil, nil, fmt.Errorf("failed to update vmss(%s): %w", to.Val(vmss.Name), err)
 		}
+		r.recordGatewayEvent(ctx, vmConfig, corev1.EventTypeNormal, "VMSSConfigApplied", "Applied gateway configuration to vmss %s", to.Val(vmss.Name))
 	}
 
 	// check and update VMSS instances
-	var privateIPs []string
-	instances, err := r.ListVMSSInstances(ctx, "", to.Val(vmss.Name))
+	var privateIPs, nodeNames []string
+	instances, err := r.ListVMSSInstances(ctx, vmssResourceGroup, to.Val(vmss.Name))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get vm instances from vmss(%s): %w", to.Val(vmss.Name), err)
+		return nil, nil, fmt.Errorf("failed to get vm instances from vmss(%s): %w", to.Val(vmss.Name), err)
 	}
 	for _, instance := range instances {
-		privateIP, err := r.reconcileVMSSVM(ctx, vmConfig, to.Val(vmss.Name), instance, ipPrefixID, to.Val(lbBackendpoolID), wantIPConfig)
+		privateIP, err := r.reconcileVMSSVM(ctx, vmConfig, vmssResourceGroup, to.Val(vmss.Name), instance, ipPrefixID, ipv6PrefixID, additionalIPPrefixIDs, lbBackendpoolID, keepBackendPool, wantIPConfig)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		if wantIPConfig && ipPrefixID == "" {
+		if wantIPConfig && ipPrefixID == "" && privateIP != "" {
 			privateIPs = append(privateIPs, privateIP)
 		}
-	}
-	// clean up VMProfiles for deleted nodes
-	var vmprofiles []egressgatewayv1alpha1.GatewayVMProfile
-	if vmConfig.Status != nil {
-		for i := range vmConfig.Status.GatewayVMProfiles {
-			profile := vmConfig.Status.GatewayVMProfiles[i]
-			for _, instance := range instances {
-				if profile.NodeName == to.Val(instance.Properties.OSProfile.ComputerName) {
-					vmprofiles = append(vmprofiles, profile)
-					break
-				}
-			}
+		// instances without computer name are not registered as nodes yet
+		if nodeName := azmanager.GetVMSSInstanceNodeName(instance); nodeName != "" {
+			nodeNames = append(nodeNames, nodeName)
 		}
-		vmConfig.Status.GatewayVMProfiles = vmprofiles
-	}
-
-	err = r.Status().Update(ctx, vmConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed to update vm config status: %w", err)
 	}
 
-	return privateIPs, nil
+	return privateIPs, nodeNames, nil
 }
 
 func (r *GatewayVMConfigurationReconciler) reconcileVMSSVM(
 	ctx context.Context,
 	vmConfig *egressgatewayv1alpha1.GatewayVMConfiguration,
+	vmssResourceGroup string,
 	vmssName string,
 	vm *compute.VirtualMachineScaleSetVM,
 	ipPrefixID string,
+	ipv6PrefixID string,
+	additionalIPPrefixIDs []string,
 	lbBackendpoolID string,
+	keepBackendPool bool,
 	wantIPConfig bool,
 ) (string, error) {
 	log := log.FromContext(ctx)
@@ -559,12 +1576,13 @@ func (r *GatewayVMConfigurationReconciler) reconcileVMSSVM(
 	}
 
 	interfaces := vm.Properties.NetworkProfileConfiguration.NetworkInterfaceConfigurations
-	needUpdate, err := r.reconcileVMSSNetworkInterface(ctx, ipConfigName, ipPrefixID, lbBackendpoolID, wantIPConfig, interfaces)
+	needUpdate, err := r.reconcileVMSSNetworkInterface(ctx, ipConfigName, ipPrefixID, ipv6PrefixID, additionalIPPrefixIDs, vmConfig.Spec.OutboundIdleTimeoutMinutes, lbBackendpoolID, keepBackendPool, wantIPConfig, interfaces)
 	if err != nil {
 		return "", fmt.Errorf("failed to reconcile vm interface(%s): %w", to.Val(vm.InstanceID), err)
 	}
 	if needUpdate {
 		log.Info("Updating vmss instance", "vmInstanceID", to.Val(vm.InstanceID))
+		r.recordDrift(ctx, vmConfig, "Network configuration of vmss %s instance %s has been modified", vmssName, to.Val(vm.InstanceID))
 		newVM := compute.VirtualMachineScaleSetVM{
 			Properties: &compute.VirtualMachineScaleSetVMProperties{
 				NetworkProfileConfiguration: &compute.VirtualMachineScaleSetVMNetworkProfileConfiguration{
@@ -572,9 +1590,11 @@ func (r *GatewayVMConfigurationReconciler) reconcileVMSSVM(
 				},
 			},
 		}
-		if _, err := r.UpdateVMSSInstance(ctx, "", vmssName, to.Val(vm.InstanceID), newVM); err != nil {
+		if _, err := r.UpdateVMSSInstance(ctx, vmssResourceGroup, vmssName, to.Val(vm.InstanceID), newVM); err != nil {
+			r.recordGatewayEvent(ctx, vmConfig, corev1.EventTypeWarning, "VMSSConfigFailed", "Failed to update vmss %s instance %s: %v", vmssName, to.Val(vm.InstanceID), err)
 			return "", fmt.Errorf("failed to update vmss instance(%s): %w", to.Val(vm.InstanceID), err)
 		}
+		r.recordGatewayEvent(ctx, vmConfig, corev1.EventTypeNormal, "VMSSConfigApplied", "Applied gateway configuration to vmss %s instance %s", vmssName, to.Val(vm.InstanceID))
 	}
 
 	// return earlier if it's deleting event
@@ -582,10 +1602,12 @@ func (r *GatewayVMConfigurationReconciler) reconcileVMSSVM(
 		return "", nil
 	}
 
-	var primaryIP, secondaryIP string
+	ipv6ConfigName := managedIPv6SubresourceName(vmConfig)
+	var primaryIP, secondaryIP, secondaryIPv6 string
+	additionalIPs := make(map[string]string)
 	for _, nic := range interfaces {
 		if nic.Properties != nil && to.Val(nic.Properties.Primary) {
-			vmNic, err := r.GetVMSSInterface(ctx, "", vmssName, to.Val(vm.InstanceID), to.Val(nic.Name))
+			vmNic, err := r.GetVMSSInterface(ctx, vmssResourceGroup, vmssName, to.Val(vm.InstanceID), to.Val(nic.Name))
 			if err != nil {
 				return "", fmt.Errorf("failed to get vmss(%s) instance(%s) nic(%s): %w", vmssName, to.Val(vm.InstanceID), to.Val(nic.Name), err)
 			}
@@ -593,32 +1615,60 @@ func (r *GatewayVMConfigurationReconciler) reconcileVMSSVM(
 				return "", fmt.Errorf("vmss(%s) instance(%s) nic(%s) has empty ip configurations", vmssName, to.Val(vm.InstanceID), to.Val(nic.Name))
 			}
 			for _, ipConfig := range vmNic.Properties.IPConfigurations {
+				if ipConfig != nil && ipConfig.Properties != nil {
+					additionalIPs[strings.ToLower(to.Val(ipConfig.Name))] = to.Val(ipConfig.Properties.PrivateIPAddress)
+				}
 				if ipConfig != nil && ipConfig.Properties != nil && strings.EqualFold(to.Val(ipConfig.Name), ipConfigName) {
 					secondaryIP = to.Val(ipConfig.Properties.PrivateIPAddress)
+				} else if ipConfig != nil && ipConfig.Properties != nil && strings.EqualFold(to.Val(ipConfig.Name), ipv6ConfigName) {
+					secondaryIPv6 = to.Val(ipConfig.Properties.PrivateIPAddress)
 				} else if ipConfig != nil && ipConfig.Properties != nil && to.Val(ipConfig.Properties.Primary) {
 					primaryIP = to.Val(ipConfig.Properties.PrivateIPAddress)
 				}
 			}
 		}
 	}
+	if r.DryRun && (primaryIP == "" || secondaryIP == "" || (ipv6PrefixID != "" && secondaryIPv6 == "")) {
+		// ip configurations are not actually added in dry run mode
+		log.Info("Dry run, private IPs not allocated", "vmss", vmssName, "instance", to.Val(vm.InstanceID))
+		return "", nil
+	}
 	if primaryIP == "" || secondaryIP == "" {
 		return "", fmt.Errorf("failed to find private IP from vmss(%s), instance(%s), ipConfig(%s)", vmssName, to.Val(vm.InstanceID), ipConfigName)
 	}
+	if ipv6PrefixID != "" && secondaryIPv6 == "" {
+		return "", fmt.Errorf("failed to find private IPv6 from vmss(%s), instance(%s), ipConfig(%s)", vmssName, to.Val(vm.InstanceID), ipv6ConfigName)
+	}
+	var additionalSecondaryIPs []string
+	for i := range additionalIPPrefixIDs {
+		additionalConfigName := managedAdditionalSubresourceName(vmConfig, i+1)
+		ip := additionalIPs[strings.ToLower(additionalConfigName)]
+		if ip == "" {
+			return "", fmt.Errorf("failed to find private IP from vmss(%s), instance(%s), ipConfig(%s)", vmssName, to.Val(vm.InstanceID), additionalConfigName)
+		}
+		additionalSecondaryIPs = append(additionalSecondaryIPs, ip)
+	}
 
 	vmprofile := egressgatewayv1alpha1.GatewayVMProfile{
-		NodeName:    to.Val(vm.Properties.OSProfile.ComputerName),
-		PrimaryIP:   primaryIP,
-		SecondaryIP: secondaryIP,
+		NodeName:               to.Val(vm.Properties.OSProfile.ComputerName),
+		PrimaryIP:              primaryIP,
+		SecondaryIP:            secondaryIP,
+		SecondaryIPv6:          secondaryIPv6,
+		AdditionalSecondaryIPs: additionalSecondaryIPs,
 	}
 	if vmConfig.Status == nil {
 		vmConfig.Status = &egressgatewayv1alpha1.GatewayVMConfigurationStatus{}
 	}
 	for i, profile := range vmConfig.Status.GatewayVMProfiles {
 		if profile.NodeName == vmprofile.NodeName {
-			if profile.PrimaryIP != primaryIP || profile.SecondaryIP != secondaryIP {
+			if profile.PrimaryIP != primaryIP || profile.SecondaryIP != secondaryIP || profile.SecondaryIPv6 != secondaryIPv6 ||
+				!slices.Equal(profile.AdditionalSecondaryIPs, additionalSecondaryIPs) {
 				vmConfig.Status.GatewayVMProfiles[i].PrimaryIP = primaryIP
 				vmConfig.Status.GatewayVMProfiles[i].SecondaryIP = secondaryIP
-				log.Info("GatewayVMConfiguration status updated", "primaryIP", primaryIP, "secondaryIP", secondaryIP)
+				vmConfig.Status.GatewayVMProfiles[i].SecondaryIPv6 = secondaryIPv6
+				vmConfig.Status.GatewayVMProfiles[i].AdditionalSecondaryIPs = additionalSecondaryIPs
+				log.Info("GatewayVMConfiguration status updated", "primaryIP", primaryIP, "secondaryIP", secondaryIP, "secondaryIPv6", secondaryIPv6,
+					"additionalSecondaryIPs", additionalSecondaryIPs)
 				return secondaryIP, nil
 			}
 			log.Info("GatewayVMConfiguration status not changed", "primaryIP", primaryIP, "secondaryIP", secondaryIP)
@@ -636,50 +1686,46 @@ func (r *GatewayVMConfigurationReconciler) reconcileVMSSNetworkInterface(
 	ctx context.Context,
 	ipConfigName string,
 	ipPrefixID string,
+	ipv6PrefixID string,
+	additionalIPPrefixIDs []string,
+	idleTimeoutMinutes int32,
 	lbBackendpoolID string,
+	keepBackendPool bool,
 	wantIPConfig bool,
 	interfaces []*compute.VirtualMachineScaleSetNetworkConfiguration,
 ) (bool, error) {
-	log := log.FromContext(ctx)
-	expectedConfig := r.getExpectedIPConfig(ipConfigName, ipPrefixID, interfaces)
 	var primaryNic *compute.VirtualMachineScaleSetNetworkConfiguration
-	needUpdate := false
-	foundConfig := false
-
 	for _, nic := range interfaces {
 		if nic.Properties != nil && to.Val(nic.Properties.Primary) {
 			primaryNic = nic
-			for i, ipConfig := range nic.Properties.IPConfigurations {
-				if to.Val(ipConfig.Name) == ipConfigName {
-					if !wantIPConfig {
-						log.Info("Found unwanted ipConfig, dropping")
-						nic.Properties.IPConfigurations = append(nic.Properties.IPConfigurations[:i], nic.Properties.IPConfigurations[i+1:]...)
-						needUpdate = true
-					} else {
-						if different(ipConfig, expectedConfig) {
-							log.Info("Found target ipConfig with different configurations, dropping")
-							needUpdate = true
-							nic.Properties.IPConfigurations = append(nic.Properties.IPConfigurations[:i], nic.Properties.IPConfigurations[i+1:]...)
-						} else {
-							log.Info("Found expected ipConfig, keeping")
-							foundConfig = true
-						}
-					}
-					break
-				}
-			}
 		}
 	}
+	if primaryNic == nil {
+		return false, fmt.Errorf("vmss(vm) primary network interface not found")
+	}
 
-	if wantIPConfig && !foundConfig {
-		if primaryNic == nil {
-			return false, fmt.Errorf("vmss(vm) primary network interface not found")
-		}
-		primaryNic.Properties.IPConfigurations = append(primaryNic.Properties.IPConfigurations, expectedConfig)
+	expectedConfig := r.getExpectedIPConfig(ipConfigName, ipPrefixID, idleTimeoutMinutes, compute.IPVersionIPv4, interfaces)
+	needUpdate := reconcileIPConfig(ctx, primaryNic, expectedConfig, wantIPConfig)
+
+	// ipv6 ipConfig is only wanted when ipv6 public ip prefix is provisioned
+	expectedIPv6Config := r.getExpectedIPConfig(ipConfigName+consts.ManagedIPv6ResourceSuffix, ipv6PrefixID, idleTimeoutMinutes, compute.IPVersionIPv6, interfaces)
+	if reconcileIPConfig(ctx, primaryNic, expectedIPv6Config, wantIPConfig && ipv6PrefixID != "") {
 		needUpdate = true
 	}
 
-	changed, err := r.reconcileLbBackendPool(lbBackendpoolID, primaryNic)
+	// one ipConfig per additional public ip prefix, ipConfigs of existing prefixes are kept untouched when adding more
+	for i := 1; i < consts.MaxPublicIpPrefixCount; i++ {
+		var prefixID string
+		if i <= len(additionalIPPrefixIDs) {
+			prefixID = additionalIPPrefixIDs[i-1]
+		}
+		expectedAdditionalConfig := r.getExpectedIPConfig(fmt.Sprintf("%s-%d", ipConfigName, i), prefixID, idleTimeoutMinutes, compute.IPVersionIPv4, interfaces)
+		if reconcileIPConfig(ctx, primaryNic, expectedAdditionalConfig, wantIPConfig && prefixID != "") {
+			needUpdate = true
+		}
+	}
+
+	changed, err := r.reconcileLbBackendPool(lbBackendpoolID, keepBackendPool, primaryNic)
 	if err != nil {
 		return false, err
 	}
@@ -688,8 +1734,47 @@ func (r *GatewayVMConfigurationReconciler) reconcileVMSSNetworkInterface(
 	return needUpdate, nil
 }
 
+// reconcileIPConfig adds, updates or drops the expected ipConfig on the primary nic, returns whether the nic is changed
+func reconcileIPConfig(
+	ctx context.Context,
+	primaryNic *compute.VirtualMachineScaleSetNetworkConfiguration,
+	expectedConfig *compute.VirtualMachineScaleSetIPConfiguration,
+	wantIPConfig bool,
+) bool {
+	log := log.FromContext(ctx)
+	needUpdate := false
+	foundConfig := false
+
+	for i, ipConfig := range primaryNic.Properties.IPConfigurations {
+		if to.Val(ipConfig.Name) == to.Val(expectedConfig.Name) {
+			if !wantIPConfig {
+				log.Info("Found unwanted ipConfig, dropping", "ipConfig", to.Val(ipConfig.Name))
+				primaryNic.Properties.IPConfigurations = append(primaryNic.Properties.IPConfigurations[:i], primaryNic.Properties.IPConfigurations[i+1:]...)
+				needUpdate = true
+			} else {
+				if different(ipConfig, expectedConfig) {
+					log.Info("Found target ipConfig with different configurations, dropping", "ipConfig", to.Val(ipConfig.Name))
+					needUpdate = true
+					primaryNic.Properties.IPConfigurations = append(primaryNic.Properties.IPConfigurations[:i], primaryNic.Properties.IPConfigurations[i+1:]...)
+				} else {
+					log.Info("Found expected ipConfig, keeping", "ipConfig", to.Val(ipConfig.Name))
+					foundConfig = true
+				}
+			}
+			break
+		}
+	}
+
+	if wantIPConfig && !foundConfig {
+		primaryNic.Properties.IPConfigurations = append(primaryNic.Properties.IPConfigurations, expectedConfig)
+		needUpdate = true
+	}
+	return needUpdate
+}
+
 func (r *GatewayVMConfigurationReconciler) reconcileLbBackendPool(
 	lbBackendpoolID string,
+	keepBackendPool bool,
 	primaryNic *compute.VirtualMachineScaleSetNetworkConfiguration,
 ) (needUpdate bool, err error) {
 	if primaryNic == nil {
@@ -698,7 +1783,7 @@ func (r *GatewayVMConfigurationReconciler) reconcileLbBackendPool(
 
 	needBackendPool := false
 	for _, ipConfig := range primaryNic.Properties.IPConfigurations {
-		if strings.HasPrefix(to.Val(ipConfig.Name), consts.ManagedResourcePrefix) {
+		if keepBackendPool && strings.HasPrefix(to.Val(ipConfig.Name), consts.ManagedResourcePrefix) {
 			needBackendPool = true
 			break
 		}
@@ -732,13 +1817,15 @@ func (r *GatewayVMConfigurationReconciler) reconcileLbBackendPool(
 func (r *GatewayVMConfigurationReconciler) getExpectedIPConfig(
 	ipConfigName,
 	ipPrefixID string,
+	idleTimeoutMinutes int32,
+	ipVersion compute.IPVersion,
 	interfaces []*compute.VirtualMachineScaleSetNetworkConfiguration,
 ) *compute.VirtualMachineScaleSetIPConfiguration {
 	var subnetID *string
 	for _, nic := range interfaces {
 		if nic.Properties != nil && to.Val(nic.Properties.Primary) {
 			for _, ipConfig := range nic.Properties.IPConfigurations {
-				if ipConfig.Properties != nil && to.Val(ipConfig.Properties.Primary) {
+				if ipConfig.Properties != nil && to.Val(ipConfig.Properties.Primary) && ipConfig.Properties.Subnet != nil {
 					subnetID = ipConfig.Properties.Subnet.ID
 				}
 			}
@@ -755,12 +1842,18 @@ func (r *GatewayVMConfigurationReconciler) getExpectedIPConfig(
 				},
 			},
 		}
+		if ipVersion == compute.IPVersionIPv6 {
+			pipConfig.Properties.PublicIPAddressVersion = to.Ptr(compute.IPVersionIPv6)
+		}
+		if idleTimeoutMinutes != 0 {
+			pipConfig.Properties.IdleTimeoutInMinutes = to.Ptr(idleTimeoutMinutes)
+		}
 	}
 	return &compute.VirtualMachineScaleSetIPConfiguration{
 		Name: to.Ptr(ipConfigName),
 		Properties: &compute.VirtualMachineScaleSetIPConfigurationProperties{
 			Primary:                      to.Ptr(false),
-			PrivateIPAddressVersion:      to.Ptr(compute.IPVersionIPv4),
+			PrivateIPAddressVersion:      to.Ptr(ipVersion),
 			PublicIPAddressConfiguration: pipConfig,
 			Subnet: &compute.APIEntityReference{
 				ID: subnetID,
@@ -803,7 +1896,19 @@ func different(ipConfig1, ipConfig2 *compute.VirtualMachineScaleSetIPConfigurati
 			} else if prefix1 != nil && prefix2 != nil && !strings.EqualFold(to.Val(prefix1.ID), to.Val(prefix2.ID)) {
 				return true
 			}
+			// Azure reports the default idle timeout on public ip configs created without one
+			if outboundIdleTimeoutMinutes(to.Val(pip1.Properties.IdleTimeoutInMinutes)) != outboundIdleTimeoutMinutes(to.Val(pip2.Properties.IdleTimeoutInMinutes)) {
+				return true
+			}
 		}
 	}
 	return false
 }
+
+// outboundIdleTimeoutMinutes returns the effective idle timeout of gateway public IPs, Azure default if not specified
+func outboundIdleTimeoutMinutes(idleTimeoutMinutes int32) int32 {
+	if idleTimeoutMinutes == 0 {
+		return consts.DefaultOutboundIdleTimeoutMinutes
+	}
+	return idleTimeoutMinutes
+}
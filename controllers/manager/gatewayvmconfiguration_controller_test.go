@@ -6,7 +6,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
@@ -17,11 +20,13 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/interfaceclient/mock_interfaceclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/publicipaddressclient/mock_publicipaddressclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/publicipprefixclient/mock_publicipprefixclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetclient/mock_virtualmachinescalesetclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetvmclient/mock_virtualmachinescalesetvmclient"
@@ -29,26 +34,33 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
 	"github.com/Azure/kube-egress-gateway/pkg/azmanager"
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients/natgatewayclient/mocknatgatewayclient"
 	"github.com/Azure/kube-egress-gateway/pkg/consts"
 	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
 )
 
 const (
-	vmssName = "vmss"
-	vmssRG   = "vmssRG"
+	vmssName         = "vmss"
+	vmssRG           = "vmssRG"
+	testNatGatewayID = "/subscriptions/testSub/resourceGroups/natRG/providers/Microsoft.Network/natGateways/natgw"
 )
 
 var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 	var (
 		r        *GatewayVMConfigurationReconciler
 		az       *azmanager.AzureManager
-		recorder = record.NewFakeRecorder(10)
+		recorder *record.FakeRecorder
 	)
 
+	BeforeEach(func() {
+		recorder = record.NewFakeRecorder(100)
+	})
+
 	Context("Reconcile", func() {
 		var (
 			req           reconcile.Request
@@ -106,6 +118,64 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 			})
 		})
 
+		It("should only patch Azure sync status when it changes", func() {
+			cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(gwConfig).WithRuntimeObjects(gwConfig).Build()
+			r = &GatewayVMConfigurationReconciler{Client: cl, Recorder: recorder}
+			Expect(getResource(cl, gwConfig)).To(Succeed())
+			Expect(r.setAzureSyncStatus(context.TODO(), gwConfig, nil)).To(Succeed())
+			Expect(getResource(cl, gwConfig)).To(Succeed())
+			Expect(gwConfig.Status.LastAzureSyncTime).NotTo(BeNil())
+			resourceVersion := gwConfig.ResourceVersion
+
+			// a recent sync time is not refreshed
+			Expect(r.setAzureSyncStatus(context.TODO(), gwConfig, nil)).To(Succeed())
+			Expect(getResource(cl, gwConfig)).To(Succeed())
+			Expect(gwConfig.ResourceVersion).To(Equal(resourceVersion))
+
+			Expect(r.setAzureSyncStatus(context.TODO(), gwConfig, fmt.Errorf("failed"))).To(Succeed())
+			Expect(getResource(cl, gwConfig)).To(Succeed())
+			Expect(gwConfig.Status.LastAzureSyncError).To(Equal("failed"))
+			resourceVersion = gwConfig.ResourceVersion
+			Expect(r.setAzureSyncStatus(context.TODO(), gwConfig, fmt.Errorf("failed"))).To(Succeed())
+			Expect(getResource(cl, gwConfig)).To(Succeed())
+			Expect(gwConfig.ResourceVersion).To(Equal(resourceVersion))
+
+			// the sync time is refreshed once the error is resolved
+			Expect(r.setAzureSyncStatus(context.TODO(), gwConfig, nil)).To(Succeed())
+			Expect(getResource(cl, gwConfig)).To(Succeed())
+			Expect(gwConfig.Status.LastAzureSyncError).To(BeEmpty())
+			Expect(gwConfig.ResourceVersion).NotTo(Equal(resourceVersion))
+		})
+
+		When("gateway reconciliation is paused", func() {
+			It("should leave Azure resources and vmConfig as they are", func() {
+				gwConfig.Annotations = map[string]string{consts.SGCReconcilePausedAnnotation: "true"}
+				// no Azure call is expected
+				az = getMockAzureManager(gomock.NewController(GinkgoT()))
+				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig, gwConfig).WithRuntimeObjects(gwConfig, vmConfig).Build()
+				r = &GatewayVMConfigurationReconciler{Client: cl, AzureManager: az, Recorder: recorder}
+				res, reconcileErr = r.Reconcile(context.TODO(), req)
+
+				Expect(reconcileErr).To(BeNil())
+				Expect(res).To(Equal(ctrl.Result{}))
+				Expect(getResource(cl, foundVMConfig)).To(Succeed())
+				Expect(foundVMConfig.Finalizers).To(BeEmpty())
+				Expect(foundVMConfig.Status).To(BeNil())
+				Expect(getResource(cl, gwConfig)).To(Succeed())
+				Expect(gwConfig.Status.LastAzureSyncTime).To(BeNil())
+			})
+
+			It("should only reconcile after unpaused", func() {
+				predicate := reconcileUnpaused()
+				paused := gwConfig.DeepCopy()
+				paused.Annotations = map[string]string{consts.SGCReconcilePausedAnnotation: "true"}
+				Expect(predicate.Update(event.UpdateEvent{ObjectOld: paused, ObjectNew: gwConfig})).To(BeTrue())
+				Expect(predicate.Update(event.UpdateEvent{ObjectOld: gwConfig, ObjectNew: paused})).To(BeFalse())
+				Expect(predicate.Update(event.UpdateEvent{ObjectOld: paused, ObjectNew: paused})).To(BeFalse())
+				Expect(predicate.Update(event.UpdateEvent{ObjectOld: gwConfig, ObjectNew: gwConfig})).To(BeFalse())
+			})
+		})
+
 		Context("TestGetGatewayVMSS", func() {
 			It("should return vmss or error as expected", func() {
 				tests := []struct {
@@ -174,11 +244,12 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 							c.vmss,
 						}, c.returnedErr)
 					}
-					foundVmss, len, err := r.getGatewayVMSS(context.Background(), vmConfig)
+					foundVmsses, len, err := r.getGatewayVMSSes(context.Background(), vmConfig)
 					if c.expectedErr != nil {
 						Expect(err).To(Equal(c.expectedErr), "TestCase[%d]: %s", i, c.desc)
 					} else {
-						Expect(to.Val(foundVmss)).To(Equal(to.Val(c.vmss)), "TestCase[%d]: %s", i, c.desc)
+						Expect(foundVmsses).To(HaveLen(1), "TestCase[%d]: %s", i, c.desc)
+						Expect(to.Val(foundVmsses[0].vmss)).To(Equal(to.Val(c.vmss)), "TestCase[%d]: %s", i, c.desc)
 						Expect(len).To(Equal(int32(31)), "TestCase[%d]: %s", i, c.desc)
 						Expect(err).To(BeNil(), "TestCase[%d]: %s", i, c.desc)
 					}
@@ -189,13 +260,14 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 		Context("TestEnsurePublicIPPrefix", func() {
 			BeforeEach(func() {
 				az = getMockAzureManager(gomock.NewController(GinkgoT()))
-				r = &GatewayVMConfigurationReconciler{AzureManager: az, Recorder: recorder}
+				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(gwConfig).Build()
+				r = &GatewayVMConfigurationReconciler{Client: cl, AzureManager: az, Recorder: recorder}
 				vmConfig.Spec.PublicIpPrefixId = ""
 			})
 
 			It("should return nil if public ip prefix is not required", func() {
 				vmConfig.Spec.ProvisionPublicIps = false
-				prefix, prefixID, isManaged, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig)
+				prefix, prefixID, isManaged, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, nil)
 				Expect(prefix).To(BeEmpty())
 				Expect(prefixID).To(BeEmpty())
 				Expect(isManaged).To(BeFalse())
@@ -204,13 +276,13 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 
 			It("should return error if prefix ID provided is not valid", func() {
 				vmConfig.Spec.PublicIpPrefixId = "/subscriptions/sub1"
-				_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig)
+				_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, nil)
 				Expect(err).To(Equal(fmt.Errorf("failed to parse public ip prefix id: /subscriptions/sub1")))
 			})
 
 			It("should return error if prefix ID provided is not in the same subscription", func() {
 				vmConfig.Spec.PublicIpPrefixId = "/subscriptions/sub1/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix"
-				_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig)
+				_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, nil)
 				Expect(err).To(Equal(fmt.Errorf("public ip prefix subscription(sub1) is not in the same subscription(testSub)")))
 			})
 
@@ -218,16 +290,25 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 				vmConfig.Spec.PublicIpPrefixId = "/subscriptions/testSub/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix"
 				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
 				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), "rg", "prefix", gomock.Any()).Return(nil, fmt.Errorf("prefix not found"))
-				_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig)
+				_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, nil)
 				Expect(errors.Unwrap(err)).To(Equal(fmt.Errorf("prefix not found")))
 			})
 
+			It("should return error if provided prefix is not found", func() {
+				vmConfig.Spec.PublicIpPrefixId = "/subscriptions/testSub/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix"
+				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), "rg", "prefix", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
+				_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, nil)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(HavePrefix("public ip prefix(/subscriptions/testSub/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix) is not found"))
+			})
+
 			It("should return error if prefix returned does not have properties", func() {
 				prefix := &network.PublicIPPrefix{Name: to.Ptr("prefix")}
 				vmConfig.Spec.PublicIpPrefixId = "/subscriptions/testSub/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix"
 				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
 				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), "rg", "prefix", gomock.Any()).Return(prefix, nil)
-				_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig)
+				_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, nil)
 				Expect(err).To(Equal(fmt.Errorf("public ip prefix(/subscriptions/testSub/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix) has empty properties")))
 			})
 
@@ -239,7 +320,7 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 				vmConfig.Spec.PublicIpPrefixId = "/subscriptions/testSub/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix"
 				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
 				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), "rg", "prefix", gomock.Any()).Return(prefix, nil)
-				_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig)
+				_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, nil)
 				Expect(err).To(Equal(fmt.Errorf("provided public ip prefix has invalid length(30), required(31)")))
 			})
 
@@ -255,17 +336,72 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 				vmConfig.Spec.PublicIpPrefixId = "/subscriptions/testSub/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix"
 				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
 				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), "rg", "prefix", gomock.Any()).Return(prefix, nil)
-				foundPrefix, prefixID, isManaged, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig)
+				foundPrefix, prefixID, isManaged, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, nil)
 				Expect(foundPrefix).To(Equal("1.2.3.4/31"))
 				Expect(prefixID).To(Equal(to.Val(prefix.ID)))
 				Expect(isManaged).NotTo(BeTrue())
 				Expect(err).To(BeNil())
 			})
 
+			It("should return provided public ip prefix of any length when length is not specified", func() {
+				prefix := &network.PublicIPPrefix{
+					Name: to.Ptr("prefix"),
+					ID:   to.Ptr("prefix"),
+					Properties: &network.PublicIPPrefixPropertiesFormat{
+						PrefixLength: to.Ptr(int32(30)),
+						IPPrefix:     to.Ptr("1.2.3.4/30"),
+					},
+				}
+				vmConfig.Spec.PublicIpPrefixId = "/subscriptions/testSub/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix"
+				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+				// provided prefix is never created or updated
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), "rg", "prefix", gomock.Any()).Return(prefix, nil)
+				foundPrefix, prefixID, isManaged, err := r.ensurePublicIPPrefix(context.TODO(), 0, vmConfig, nil)
+				Expect(foundPrefix).To(Equal("1.2.3.4/30"))
+				Expect(prefixID).To(Equal(to.Val(prefix.ID)))
+				Expect(isManaged).To(BeFalse())
+				Expect(err).To(BeNil())
+			})
+
+			It("should return error when provided public ip prefix is in another region than the gateway vmss", func() {
+				prefix := &network.PublicIPPrefix{
+					Name:     to.Ptr("prefix"),
+					ID:       to.Ptr("prefix"),
+					Location: to.Ptr("westus"),
+					Properties: &network.PublicIPPrefixPropertiesFormat{
+						PrefixLength: to.Ptr(int32(31)),
+						IPPrefix:     to.Ptr("1.2.3.4/31"),
+					},
+				}
+				vmConfig.Spec.PublicIpPrefixId = "/subscriptions/testSub/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix"
+				vmss := getEmptyVMSS()
+				vmss.Location = to.Ptr("East US")
+				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), "rg", "prefix", gomock.Any()).Return(prefix, nil)
+				_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, []gatewayVMSS{{vmss: vmss}})
+				var regionErr *regionMismatchError
+				Expect(errors.As(err, &regionErr)).To(BeTrue())
+				Expect(err.Error()).To(Equal("public ip prefix(" + vmConfig.Spec.PublicIpPrefixId + ") is in region westus but gateway vmss(vmss) is in region East US, they must be in the same region"))
+
+				// region names are compared ignoring case and spaces
+				prefix.Location = to.Ptr("eastus")
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), "rg", "prefix", gomock.Any()).Return(prefix, nil)
+				foundPrefix, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, []gatewayVMSS{{vmss: vmss}})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(foundPrefix).To(Equal("1.2.3.4/31"))
+			})
+
+			It("should return error without creating managed public ip prefix when gateway vmss is in another region", func() {
+				vmss := getEmptyVMSS()
+				vmss.Location = to.Ptr("westus")
+				_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, []gatewayVMSS{{vmss: vmss}})
+				Expect(err).To(MatchError("public ip prefix(egressgateway-testUID) is in region location but gateway vmss(vmss) is in region westus, they must be in the same region"))
+			})
+
 			It("should return error when getting managed ip prefix returns error", func() {
 				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
 				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).Return(nil, fmt.Errorf("failed"))
-				_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig)
+				_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, nil)
 				Expect(errors.Unwrap(err)).To(Equal(fmt.Errorf("failed")))
 			})
 
@@ -273,7 +409,7 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 				prefix := &network.PublicIPPrefix{Name: to.Ptr("prefix")}
 				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
 				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).Return(prefix, nil)
-				_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig)
+				_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, nil)
 				Expect(err).To(Equal(fmt.Errorf("managed public ip prefix has empty properties")))
 			})
 
@@ -288,7 +424,7 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 				}
 				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
 				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).Return(prefix, nil)
-				foundPrefix, prefixID, isManaged, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig)
+				foundPrefix, prefixID, isManaged, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, nil)
 				Expect(foundPrefix).To(Equal("1.2.3.4/31"))
 				Expect(prefixID).To(Equal("managed"))
 				Expect(isManaged).To(BeTrue())
@@ -317,18 +453,371 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 						expectedPrefix.Properties.IPPrefix = to.Ptr("1.2.3.4/31")
 						return expectedPrefix, nil
 					})
-				foundPrefix, prefixID, isManaged, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig)
+				foundPrefix, prefixID, isManaged, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, nil)
 				Expect(foundPrefix).To(Equal("1.2.3.4/31"))
 				Expect(prefixID).To(Equal("managed"))
 				Expect(isManaged).To(BeTrue())
 				Expect(err).To(BeNil())
+				assertEqualEvents([]string{
+					"Normal PublicIPPrefixProvisioning Creating IPv4 public ip prefix egressgateway-testUID",
+					"Normal PublicIPPrefixProvisioned Created public ip prefix egressgateway-testUID: 1.2.3.4/31",
+				}, recorder.Events)
+			})
+
+			Context("when public ip prefixes are reused", func() {
+				var (
+					prefixName               string
+					mockPublicIPPrefixClient *mock_publicipprefixclient.MockInterface
+				)
+				getReusablePrefix := func(owner, creator string) *network.PublicIPPrefix {
+					return &network.PublicIPPrefix{
+						Name: to.Ptr(prefixName),
+						ID:   to.Ptr("managed"),
+						Tags: map[string]*string{
+							consts.PublicIPPrefixGatewayTagKey: to.Ptr(testNamespace + "/" + testName),
+							consts.PublicIPPrefixOwnerTagKey:   to.Ptr(owner),
+							consts.PublicIPPrefixCreatorTagKey: to.Ptr(creator),
+						},
+						Properties: &network.PublicIPPrefixPropertiesFormat{
+							PrefixLength: to.Ptr(int32(31)),
+							IPPrefix:     to.Ptr("1.2.3.4/31"),
+						},
+					}
+				}
+
+				BeforeEach(func() {
+					vmConfig.Spec.ReusePublicIpPrefix = true
+					prefixName = managedPublicIPPrefixName(vmConfig)
+					mockPublicIPPrefixClient = az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+				})
+
+				It("should name prefixes after gateway namespace and name", func() {
+					recreated := vmConfig.DeepCopy()
+					recreated.UID = "newUID"
+					Expect(prefixName).To(HavePrefix(consts.ManagedResourcePrefix))
+					Expect(prefixName).NotTo(ContainSubstring("testUID"))
+					Expect(managedPublicIPPrefixName(recreated)).To(Equal(prefixName))
+					Expect(managedIPv6PublicIPPrefixName(recreated)).To(Equal(prefixName + "-ipv6"))
+					Expect(managedAdditionalPublicIPPrefixName(recreated, 1)).To(Equal(prefixName + "-1"))
+					// ipConfigs are still named after the UID
+					Expect(managedSubresourceName(recreated)).To(Equal("egressgateway-newUID"))
+				})
+
+				It("should create a tagged prefix when there's none to reuse", func() {
+					mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, prefixName, gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
+					mockPublicIPPrefixClient.EXPECT().CreateOrUpdate(gomock.Any(), testRG, prefixName, gomock.Any()).DoAndReturn(
+						func(ctx context.Context, resourceGroupName string, publicIPPrefixName string, ipPrefix network.PublicIPPrefix) (*network.PublicIPPrefix, error) {
+							Expect(ipPrefix.Tags).To(Equal(map[string]*string{
+								consts.PublicIPPrefixGatewayTagKey: to.Ptr(testNamespace + "/" + testName),
+								consts.PublicIPPrefixOwnerTagKey:   to.Ptr("testUID"),
+								consts.PublicIPPrefixCreatorTagKey: to.Ptr("testUID"),
+							}))
+							ipPrefix.ID = to.Ptr("managed")
+							ipPrefix.Properties.IPPrefix = to.Ptr("1.2.3.4/31")
+							return &ipPrefix, nil
+						})
+					foundPrefix, _, isManaged, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, nil)
+					Expect(err).To(BeNil())
+					Expect(foundPrefix).To(Equal("1.2.3.4/31"))
+					Expect(isManaged).To(BeTrue())
+					Expect(vmConfig.Status.PublicIpPrefixReused).To(BeFalse())
+				})
+
+				It("should reclaim prefix left by a deleted gateway with the same name", func() {
+					mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, prefixName, gomock.Any()).Return(getReusablePrefix("oldUID", "oldUID"), nil)
+					mockPublicIPPrefixClient.EXPECT().CreateOrUpdate(gomock.Any(), testRG, prefixName, gomock.Any()).DoAndReturn(
+						func(ctx context.Context, resourceGroupName string, publicIPPrefixName string, ipPrefix network.PublicIPPrefix) (*network.PublicIPPrefix, error) {
+							Expect(ipPrefix.Tags[consts.PublicIPPrefixOwnerTagKey]).To(Equal(to.Ptr("testUID")))
+							Expect(ipPrefix.Tags[consts.PublicIPPrefixCreatorTagKey]).To(Equal(to.Ptr("oldUID")))
+							return &ipPrefix, nil
+						})
+					foundPrefix, prefixID, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, nil)
+					Expect(err).To(BeNil())
+					Expect(foundPrefix).To(Equal("1.2.3.4/31"))
+					Expect(prefixID).To(Equal("managed"))
+					Expect(vmConfig.Status.PublicIpPrefixReused).To(BeTrue())
+					assertEqualEvents([]string{
+						fmt.Sprintf("Normal PublicIPPrefixReused Reusing public ip prefix %s: 1.2.3.4/31", prefixName),
+					}, recorder.Events)
+				})
+
+				It("should keep reporting reused prefix after it is reclaimed", func() {
+					mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, prefixName, gomock.Any()).Return(getReusablePrefix("testUID", "oldUID"), nil)
+					_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, nil)
+					Expect(err).To(BeNil())
+					Expect(vmConfig.Status.PublicIpPrefixReused).To(BeTrue())
+				})
+
+				It("should not reuse prefix still in use by another gateway", func() {
+					prefix := getReusablePrefix("otherUID", "otherUID")
+					prefix.Properties.PublicIPAddresses = []*network.ReferencedPublicIPAddress{{ID: to.Ptr("vmss-ip")}}
+					mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, prefixName, gomock.Any()).Return(prefix, nil)
+					_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, nil)
+					Expect(err).To(MatchError(fmt.Sprintf("public ip prefix %s is still in use by another gateway, it can only be reused once released", prefixName)))
+				})
+
+				It("should not reuse prefix associated with a NAT gateway of another gateway", func() {
+					prefix := getReusablePrefix("otherUID", "otherUID")
+					prefix.Properties.NatGateway = &network.NatGateway{ID: to.Ptr("natgw")}
+					mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, prefixName, gomock.Any()).Return(prefix, nil)
+					_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, nil)
+					Expect(err).To(HaveOccurred())
+				})
+
+				It("should not reuse prefix named after another gateway", func() {
+					prefix := getReusablePrefix("otherUID", "otherUID")
+					prefix.Tags[consts.PublicIPPrefixGatewayTagKey] = to.Ptr("other/gateway")
+					mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, prefixName, gomock.Any()).Return(prefix, nil)
+					_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, nil)
+					Expect(err).To(MatchError(fmt.Sprintf("public ip prefix %s is named after gateway other/gateway", prefixName)))
+				})
+			})
+
+			It("should create a managed public ip prefix with default and gateway tags", func() {
+				r.DefaultTags = map[string]string{"costCenter": "default", "team": "network"}
+				vmConfig.Spec.Tags = map[string]string{"costCenter": "gateway"}
+				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
+				mockPublicIPPrefixClient.EXPECT().CreateOrUpdate(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).DoAndReturn(
+					func(ctx context.Context, resourceGroupName string, publicIPPrefixName string, ipPrefix network.PublicIPPrefix) (*network.PublicIPPrefix, error) {
+						Expect(ipPrefix.Tags).To(Equal(map[string]*string{"costCenter": to.Ptr("gateway"), "team": to.Ptr("network")}))
+						ipPrefix.ID = to.Ptr("managed")
+						ipPrefix.Properties.IPPrefix = to.Ptr("1.2.3.4/31")
+						return &ipPrefix, nil
+					})
+				_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, nil)
+				Expect(err).To(BeNil())
+				assertEqualEvents([]string{
+					"Normal PublicIPPrefixProvisioning Creating IPv4 public ip prefix egressgateway-testUID",
+					"Normal PublicIPPrefixProvisioned Created public ip prefix egressgateway-testUID: 1.2.3.4/31",
+				}, recorder.Events)
+			})
+
+			It("should merge tags into existing managed public ip prefix", func() {
+				vmConfig.Spec.Tags = map[string]string{"costCenter": "gateway", "team": "network"}
+				prefix := &network.PublicIPPrefix{
+					Name: to.Ptr("egressgateway-testUID"),
+					ID:   to.Ptr("managed"),
+					Tags: map[string]*string{"CostCenter": to.Ptr("old"), "manual": to.Ptr("kept")},
+					Properties: &network.PublicIPPrefixPropertiesFormat{
+						PrefixLength: to.Ptr(int32(31)),
+						IPPrefix:     to.Ptr("1.2.3.4/31"),
+					},
+				}
+				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).Return(prefix, nil)
+				mockPublicIPPrefixClient.EXPECT().CreateOrUpdate(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).DoAndReturn(
+					func(ctx context.Context, resourceGroupName string, publicIPPrefixName string, ipPrefix network.PublicIPPrefix) (*network.PublicIPPrefix, error) {
+						Expect(ipPrefix.Tags).To(Equal(map[string]*string{"CostCenter": to.Ptr("gateway"), "team": to.Ptr("network"), "manual": to.Ptr("kept")}))
+						return &ipPrefix, nil
+					})
+				foundPrefix, prefixID, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, nil)
+				Expect(err).To(BeNil())
+				Expect(foundPrefix).To(Equal("1.2.3.4/31"))
+				Expect(prefixID).To(Equal("managed"))
+			})
+
+			It("should not update existing managed public ip prefix with expected tags", func() {
+				vmConfig.Spec.Tags = map[string]string{"team": "network"}
+				prefix := &network.PublicIPPrefix{
+					Name: to.Ptr("egressgateway-testUID"),
+					ID:   to.Ptr("managed"),
+					Tags: map[string]*string{"team": to.Ptr("network"), "manual": to.Ptr("kept")},
+					Properties: &network.PublicIPPrefixPropertiesFormat{
+						PrefixLength: to.Ptr(int32(31)),
+						IPPrefix:     to.Ptr("1.2.3.4/31"),
+					},
+				}
+				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).Return(prefix, nil)
+				_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, nil)
+				Expect(err).To(BeNil())
 			})
 
 			It("should return error when creating failed", func() {
 				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
 				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
 				mockPublicIPPrefixClient.EXPECT().CreateOrUpdate(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).Return(nil, fmt.Errorf("failed"))
-				_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig)
+				_, _, _, err := r.ensurePublicIPPrefix(context.TODO(), 31, vmConfig, nil)
+				Expect(errors.Unwrap(err)).To(Equal(fmt.Errorf("failed")))
+				assertEqualEvents([]string{
+					"Normal PublicIPPrefixProvisioning Creating IPv4 public ip prefix egressgateway-testUID",
+					"Warning PublicIPPrefixProvisionFailed Failed to create public ip prefix egressgateway-testUID: failed",
+				}, recorder.Events)
+			})
+		})
+
+		Context("TestEnsureIPv6PublicIPPrefix", func() {
+			BeforeEach(func() {
+				az = getMockAzureManager(gomock.NewController(GinkgoT()))
+				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(gwConfig).Build()
+				r = &GatewayVMConfigurationReconciler{Client: cl, AzureManager: az, Recorder: recorder}
+				vmConfig.Spec.EnableIPv6 = true
+			})
+
+			It("should return nil if ipv6 is not enabled", func() {
+				vmConfig.Spec.EnableIPv6 = false
+				prefix, prefixID, err := r.ensureIPv6PublicIPPrefix(context.TODO(), 31, vmConfig)
+				Expect(prefix).To(BeEmpty())
+				Expect(prefixID).To(BeEmpty())
+				Expect(err).To(BeNil())
+			})
+
+			It("should return nil if public ip prefix is not required", func() {
+				vmConfig.Spec.ProvisionPublicIps = false
+				prefix, prefixID, err := r.ensureIPv6PublicIPPrefix(context.TODO(), 31, vmConfig)
+				Expect(prefix).To(BeEmpty())
+				Expect(prefixID).To(BeEmpty())
+				Expect(err).To(BeNil())
+			})
+
+			It("should return valid managed public ipv6 prefix", func() {
+				prefix := &network.PublicIPPrefix{
+					Name: to.Ptr("prefix"),
+					ID:   to.Ptr("managed-ipv6"),
+					Properties: &network.PublicIPPrefixPropertiesFormat{
+						PrefixLength: to.Ptr(int32(127)),
+						IPPrefix:     to.Ptr("2001:db8::/127"),
+					},
+				}
+				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID-ipv6", gomock.Any()).Return(prefix, nil)
+				foundPrefix, prefixID, err := r.ensureIPv6PublicIPPrefix(context.TODO(), 31, vmConfig)
+				Expect(foundPrefix).To(Equal("2001:db8::/127"))
+				Expect(prefixID).To(Equal("managed-ipv6"))
+				Expect(err).To(BeNil())
+			})
+
+			It("should create a managed public ipv6 prefix with the same number of addresses", func() {
+				expectedPrefix := &network.PublicIPPrefix{
+					Name:     to.Ptr("egressgateway-testUID-ipv6"),
+					Location: to.Ptr("location"),
+					Properties: &network.PublicIPPrefixPropertiesFormat{
+						PrefixLength:           to.Ptr(int32(126)),
+						PublicIPAddressVersion: to.Ptr(network.IPVersionIPv6),
+					},
+					SKU: &network.PublicIPPrefixSKU{
+						Name: to.Ptr(network.PublicIPPrefixSKUNameStandard),
+						Tier: to.Ptr(network.PublicIPPrefixSKUTierRegional),
+					},
+				}
+				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID-ipv6", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
+				mockPublicIPPrefixClient.EXPECT().CreateOrUpdate(gomock.Any(), testRG, "egressgateway-testUID-ipv6", gomock.Any()).DoAndReturn(
+					func(ctx context.Context, resourceGroupName string, publicIPPrefixName string, ipPrefix network.PublicIPPrefix) (*network.PublicIPPrefix, error) {
+						Expect(equality.Semantic.DeepEqual(ipPrefix, *expectedPrefix)).To(BeTrue())
+						expectedPrefix.ID = to.Ptr("managed-ipv6")
+						expectedPrefix.Properties.IPPrefix = to.Ptr("2001:db8::/126")
+						return expectedPrefix, nil
+					})
+				foundPrefix, prefixID, err := r.ensureIPv6PublicIPPrefix(context.TODO(), 30, vmConfig)
+				Expect(foundPrefix).To(Equal("2001:db8::/126"))
+				Expect(prefixID).To(Equal("managed-ipv6"))
+				Expect(err).To(BeNil())
+			})
+		})
+
+		Context("TestEnsureIPv6PublicIPPrefixDeleted", func() {
+			It("should delete managed ipv6 prefix", func() {
+				az = getMockAzureManager(gomock.NewController(GinkgoT()))
+				r = &GatewayVMConfigurationReconciler{AzureManager: az, Recorder: recorder}
+				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID-ipv6", gomock.Any()).Return(&network.PublicIPPrefix{}, nil)
+				mockPublicIPPrefixClient.EXPECT().Delete(gomock.Any(), testRG, "egressgateway-testUID-ipv6").Return(nil)
+				err := r.ensureIPv6PublicIPPrefixDeleted(context.TODO(), vmConfig)
+				Expect(err).To(BeNil())
+			})
+		})
+
+		Context("TestEnsureAdditionalPublicIPPrefixes", func() {
+			BeforeEach(func() {
+				az = getMockAzureManager(gomock.NewController(GinkgoT()))
+				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(gwConfig).Build()
+				r = &GatewayVMConfigurationReconciler{Client: cl, AzureManager: az, Recorder: recorder}
+				vmConfig.Spec.PublicIpPrefixCount = 3
+			})
+
+			It("should return nil if only one public ip prefix is required", func() {
+				vmConfig.Spec.PublicIpPrefixCount = 1
+				prefixes, prefixIDs, err := r.ensureAdditionalPublicIPPrefixes(context.TODO(), 31, vmConfig)
+				Expect(prefixes).To(BeEmpty())
+				Expect(prefixIDs).To(BeEmpty())
+				Expect(err).To(BeNil())
+			})
+
+			It("should return nil if public ip prefix is provided", func() {
+				vmConfig.Spec.PublicIpPrefixId = "/subscriptions/testSub/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix"
+				prefixes, prefixIDs, err := r.ensureAdditionalPublicIPPrefixes(context.TODO(), 31, vmConfig)
+				Expect(prefixes).To(BeEmpty())
+				Expect(prefixIDs).To(BeEmpty())
+				Expect(err).To(BeNil())
+			})
+
+			It("should return additional managed public ip prefixes in order", func() {
+				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+				for i, ipPrefix := range []string{"1.2.3.6/31", "1.2.3.8/31"} {
+					name := fmt.Sprintf("egressgateway-testUID-%d", i+1)
+					mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, name, gomock.Any()).Return(&network.PublicIPPrefix{
+						Name: to.Ptr(name),
+						ID:   to.Ptr(name + "-id"),
+						Properties: &network.PublicIPPrefixPropertiesFormat{
+							PrefixLength: to.Ptr(int32(31)),
+							IPPrefix:     to.Ptr(ipPrefix),
+						},
+					}, nil)
+				}
+				prefixes, prefixIDs, err := r.ensureAdditionalPublicIPPrefixes(context.TODO(), 31, vmConfig)
+				Expect(prefixes).To(Equal([]string{"1.2.3.6/31", "1.2.3.8/31"}))
+				Expect(prefixIDs).To(Equal([]string{"egressgateway-testUID-1-id", "egressgateway-testUID-2-id"}))
+				Expect(err).To(BeNil())
+			})
+
+			It("should return error when creating additional prefix fails", func() {
+				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID-1", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
+				mockPublicIPPrefixClient.EXPECT().CreateOrUpdate(gomock.Any(), testRG, "egressgateway-testUID-1", gomock.Any()).Return(nil, fmt.Errorf("failed"))
+				_, _, err := r.ensureAdditionalPublicIPPrefixes(context.TODO(), 31, vmConfig)
+				Expect(errors.Unwrap(err)).To(Equal(fmt.Errorf("failed")))
+			})
+		})
+
+		Context("TestEnsureAdditionalPublicIPPrefixesDeleted", func() {
+			It("should only delete prefixes beyond the requested count, highest index first", func() {
+				az = getMockAzureManager(gomock.NewController(GinkgoT()))
+				r = &GatewayVMConfigurationReconciler{AzureManager: az, Recorder: recorder}
+				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+				gomock.InOrder(
+					mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID-2", gomock.Any()).Return(&network.PublicIPPrefix{}, nil),
+					mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID-3", gomock.Any()).Return(&network.PublicIPPrefix{}, nil),
+					mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID-4", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound}),
+					mockPublicIPPrefixClient.EXPECT().Delete(gomock.Any(), testRG, "egressgateway-testUID-3").Return(nil),
+					mockPublicIPPrefixClient.EXPECT().Delete(gomock.Any(), testRG, "egressgateway-testUID-2").Return(nil),
+				)
+				err := r.ensureAdditionalPublicIPPrefixesDeleted(context.TODO(), vmConfig, 2)
+				Expect(err).To(BeNil())
+			})
+
+			It("should delete prefixes neither requested in spec nor recorded in status", func() {
+				az = getMockAzureManager(gomock.NewController(GinkgoT()))
+				r = &GatewayVMConfigurationReconciler{AzureManager: az, Recorder: recorder}
+				vmConfig.Spec.PublicIpPrefixCount = 0
+				vmConfig.Status = nil
+				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+				gomock.InOrder(
+					mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID-1", gomock.Any()).Return(&network.PublicIPPrefix{}, nil),
+					mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID-2", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound}),
+					mockPublicIPPrefixClient.EXPECT().Delete(gomock.Any(), testRG, "egressgateway-testUID-1").Return(nil),
+				)
+				err := r.ensureAdditionalPublicIPPrefixesDeleted(context.TODO(), vmConfig, 1)
+				Expect(err).To(BeNil())
+			})
+
+			It("should return error when getting additional prefix fails", func() {
+				az = getMockAzureManager(gomock.NewController(GinkgoT()))
+				r = &GatewayVMConfigurationReconciler{AzureManager: az, Recorder: recorder}
+				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID-1", gomock.Any()).Return(nil, fmt.Errorf("failed"))
+				err := r.ensureAdditionalPublicIPPrefixesDeleted(context.TODO(), vmConfig, 1)
 				Expect(errors.Unwrap(err)).To(Equal(fmt.Errorf("failed")))
 			})
 		})
@@ -370,6 +859,68 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 			})
 		})
 
+		Context("TestEnsureNatGatewayPublicIPPrefix", func() {
+			var mockNatGatewayClient *mocknatgatewayclient.MockInterface
+			BeforeEach(func() {
+				mctrl := gomock.NewController(GinkgoT())
+				az = getMockAzureManager(mctrl)
+				mockNatGatewayClient = mocknatgatewayclient.NewMockInterface(mctrl)
+				az.NatGatewayClient = mockNatGatewayClient
+				r = &GatewayVMConfigurationReconciler{AzureManager: az, Recorder: recorder}
+			})
+
+			getNatGateway := func(prefixIDs ...string) *network.NatGateway {
+				natGateway := &network.NatGateway{Name: to.Ptr("natgw"), Properties: &network.NatGatewayPropertiesFormat{}}
+				for _, prefixID := range prefixIDs {
+					natGateway.Properties.PublicIPPrefixes = append(natGateway.Properties.PublicIPPrefixes, &network.SubResource{ID: to.Ptr(prefixID)})
+				}
+				return natGateway
+			}
+
+			It("should return error if nat gateway is in another subscription", func() {
+				err := r.ensureNatGatewayPublicIP(context.TODO(), vmConfig, "/subscriptions/otherSub/resourceGroups/natRG/providers/Microsoft.Network/natGateways/natgw", "prefix", true)
+				Expect(err).To(Equal(fmt.Errorf("nat gateway subscription(otherSub) is not in the same subscription(testSub)")))
+			})
+
+			It("should not update nat gateway already associated with the prefix", func() {
+				mockNatGatewayClient.EXPECT().Get(gomock.Any(), "natRG", "natgw", gomock.Any()).Return(getNatGateway("other", "PREFIX"), nil)
+				err := r.ensureNatGatewayPublicIP(context.TODO(), vmConfig, testNatGatewayID, "prefix", true)
+				Expect(err).To(BeNil())
+			})
+
+			It("should only remove the prefix from nat gateway when disassociating", func() {
+				mockNatGatewayClient.EXPECT().Get(gomock.Any(), "natRG", "natgw", gomock.Any()).Return(getNatGateway("other", "prefix"), nil)
+				mockNatGatewayClient.EXPECT().CreateOrUpdate(gomock.Any(), "natRG", "natgw", to.Val(getNatGateway("other"))).Return(&network.NatGateway{}, nil)
+				err := r.ensureNatGatewayPublicIP(context.TODO(), vmConfig, testNatGatewayID, "prefix", false)
+				Expect(err).To(BeNil())
+			})
+
+			It("should only remove the public ip address from nat gateway when disassociating an address", func() {
+				ipAddressID := "/subscriptions/testSub/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/ip"
+				natGateway := getNatGateway("other")
+				natGateway.Properties.PublicIPAddresses = []*network.SubResource{{ID: to.Ptr(ipAddressID)}}
+				mockNatGatewayClient.EXPECT().Get(gomock.Any(), "natRG", "natgw", gomock.Any()).Return(natGateway, nil)
+				expected := getNatGateway("other")
+				expected.Properties.PublicIPAddresses = []*network.SubResource{}
+				mockNatGatewayClient.EXPECT().CreateOrUpdate(gomock.Any(), "natRG", "natgw", to.Val(expected)).Return(&network.NatGateway{}, nil)
+				err := r.ensureNatGatewayPublicIP(context.TODO(), vmConfig, testNatGatewayID, ipAddressID, false)
+				Expect(err).To(BeNil())
+			})
+
+			It("should ignore nat gateway not found when disassociating", func() {
+				mockNatGatewayClient.EXPECT().Get(gomock.Any(), "natRG", "natgw", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
+				err := r.ensureNatGatewayPublicIP(context.TODO(), vmConfig, testNatGatewayID, "prefix", false)
+				Expect(err).To(BeNil())
+			})
+
+			It("should return error when updating nat gateway fails", func() {
+				mockNatGatewayClient.EXPECT().Get(gomock.Any(), "natRG", "natgw", gomock.Any()).Return(getNatGateway(), nil)
+				mockNatGatewayClient.EXPECT().CreateOrUpdate(gomock.Any(), "natRG", "natgw", gomock.Any()).Return(nil, fmt.Errorf("failed"))
+				err := r.ensureNatGatewayPublicIP(context.TODO(), vmConfig, testNatGatewayID, "prefix", true)
+				Expect(errors.Unwrap(err)).To(Equal(fmt.Errorf("failed")))
+			})
+		})
+
 		Context("TestDifferent", func() {
 			It("should detect differences between two ipConfigs properly", func() {
 				tests := []struct {
@@ -493,6 +1044,45 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 							},
 						},
 					},
+					{
+						desc: "should return false if one ipConfig has default public ip idle timeout and the other has none",
+						ipConfig1: &compute.VirtualMachineScaleSetIPConfiguration{
+							Properties: &compute.VirtualMachineScaleSetIPConfigurationProperties{
+								PublicIPAddressConfiguration: &compute.VirtualMachineScaleSetPublicIPAddressConfiguration{
+									Properties: &compute.VirtualMachineScaleSetPublicIPAddressConfigurationProperties{
+										IdleTimeoutInMinutes: to.Ptr(int32(4)),
+									},
+								},
+							},
+						},
+						ipConfig2: &compute.VirtualMachineScaleSetIPConfiguration{
+							Properties: &compute.VirtualMachineScaleSetIPConfigurationProperties{
+								PublicIPAddressConfiguration: &compute.VirtualMachineScaleSetPublicIPAddressConfiguration{
+									Properties: &compute.VirtualMachineScaleSetPublicIPAddressConfigurationProperties{},
+								},
+							},
+						},
+						same: true,
+					},
+					{
+						desc: "should return true if ipConfigs have different public ip idle timeouts",
+						ipConfig1: &compute.VirtualMachineScaleSetIPConfiguration{
+							Properties: &compute.VirtualMachineScaleSetIPConfigurationProperties{
+								PublicIPAddressConfiguration: &compute.VirtualMachineScaleSetPublicIPAddressConfiguration{
+									Properties: &compute.VirtualMachineScaleSetPublicIPAddressConfigurationProperties{
+										IdleTimeoutInMinutes: to.Ptr(int32(30)),
+									},
+								},
+							},
+						},
+						ipConfig2: &compute.VirtualMachineScaleSetIPConfiguration{
+							Properties: &compute.VirtualMachineScaleSetIPConfigurationProperties{
+								PublicIPAddressConfiguration: &compute.VirtualMachineScaleSetPublicIPAddressConfiguration{
+									Properties: &compute.VirtualMachineScaleSetPublicIPAddressConfigurationProperties{},
+								},
+							},
+						},
+					},
 				}
 				for i, c := range tests {
 					diff := different(c.ipConfig1, c.ipConfig2)
@@ -501,16 +1091,36 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 			})
 		})
 
+		Context("TestReconcileIPv6IPConfig", func() {
+			It("should add, keep and drop ipv6 ipConfig as expected", func() {
+				r = &GatewayVMConfigurationReconciler{}
+				interfaces := getEmptyVMSS().Properties.VirtualMachineProfile.NetworkProfile.NetworkInterfaceConfigurations
+				primaryNic := interfaces[0]
+				expected := r.getExpectedIPConfig("egressgateway-testUID-ipv6", "prefix-ipv6", 0, compute.IPVersionIPv6, interfaces)
+				Expect(to.Val(expected.Properties.PrivateIPAddressVersion)).To(Equal(compute.IPVersionIPv6))
+				Expect(to.Val(expected.Properties.PublicIPAddressConfiguration.Properties.PublicIPAddressVersion)).To(Equal(compute.IPVersionIPv6))
+
+				Expect(reconcileIPConfig(context.TODO(), primaryNic, expected, true)).To(BeTrue())
+				Expect(primaryNic.Properties.IPConfigurations).To(HaveLen(2))
+				Expect(reconcileIPConfig(context.TODO(), primaryNic, expected, true)).To(BeFalse())
+				Expect(reconcileIPConfig(context.TODO(), primaryNic, expected, false)).To(BeTrue())
+				Expect(primaryNic.Properties.IPConfigurations).To(HaveLen(1))
+			})
+		})
+
 		Context("TestReconcileVMSS", func() {
+			var lbBackendpoolID string
+
 			BeforeEach(func() {
 				az = getMockAzureManager(gomock.NewController(GinkgoT()))
-				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig).WithRuntimeObjects(gwConfig, vmConfig).Build()
+				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig, gwConfig).WithRuntimeObjects(gwConfig, vmConfig).Build()
 				r = &GatewayVMConfigurationReconciler{Client: cl, AzureManager: az, Recorder: recorder}
+				lbBackendpoolID = to.Val(az.GetLBBackendAddressPoolID(testVMSSUID))
 			})
 
 			It("should return error if vmss does not have properties", func() {
 				existingVMSS := &compute.VirtualMachineScaleSet{}
-				_, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, "prefix", true)
+				_, _, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, testRG, lbBackendpoolID, "prefix", "", nil, true)
 				Expect(err).To(Equal(fmt.Errorf("vmss has empty network profile")))
 			})
 
@@ -524,16 +1134,36 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 						},
 					},
 				}
-				_, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, "prefix", true)
-				Expect(errors.Unwrap(err)).To(Equal(fmt.Errorf("vmss(vm) primary network interface not found")))
+				_, _, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, testRG, lbBackendpoolID, "prefix", "", nil, true)
+				Expect(err).To(Equal(&azmanager.VMSSNotGatewayReadyError{Missing: "primary network interface not found"}))
+			})
+
+			It("should return not gateway ready error if vmss primary ipConfig has no subnet", func() {
+				existingVMSS := getEmptyVMSS()
+				nic := existingVMSS.Properties.VirtualMachineProfile.NetworkProfile.NetworkInterfaceConfigurations[0]
+				nic.Name = to.Ptr("nic")
+				nic.Properties.IPConfigurations[0].Properties.Subnet = nil
+				_, _, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, testRG, lbBackendpoolID, "prefix", "", nil, true)
+				Expect(err).To(MatchError("vmss(vmss) is not ready for egress gateway: primary ip configuration of network interface nic has no subnet, " +
+					"the vmss needs a primary network interface with a primary ip configuration in a subnet"))
+			})
+
+			It("should return not gateway ready error if vmss primary nic has no primary ipConfig", func() {
+				existingVMSS := getEmptyVMSS()
+				nic := existingVMSS.Properties.VirtualMachineProfile.NetworkProfile.NetworkInterfaceConfigurations[0]
+				nic.Name = to.Ptr("nic")
+				nic.Properties.IPConfigurations[0].Properties.Primary = to.Ptr(false)
+				_, _, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, testRG, lbBackendpoolID, "prefix", "", nil, true)
+				Expect(err).To(Equal(&azmanager.VMSSNotGatewayReadyError{VMSSName: vmssName, Missing: "network interface nic has no primary ip configuration"}))
 			})
 
 			It("should return error if updating vmss fails", func() {
 				existingVMSS := getEmptyVMSS()
 				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
 				mockVMSSClient.EXPECT().CreateOrUpdate(gomock.Any(), testRG, vmssName, gomock.Any()).Return(nil, fmt.Errorf("failed"))
-				_, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, "prefix", true)
+				_, _, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, testRG, lbBackendpoolID, "prefix", "", nil, true)
 				Expect(errors.Unwrap(err)).To(Equal(fmt.Errorf("failed")))
+				assertEqualEvents([]string{"Warning VMSSConfigFailed Failed to update vmss vmss: failed"}, recorder.Events)
 			})
 
 			It("should return error if listing vmss instances fails", func() {
@@ -543,8 +1173,9 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 				mockVMSSClient.EXPECT().CreateOrUpdate(gomock.Any(), testRG, vmssName, gomock.Any()).Return(expectedVMSS, nil)
 				mockVMSSVMClient := az.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface)
 				mockVMSSVMClient.EXPECT().List(gomock.Any(), testRG, vmssName).Return(nil, fmt.Errorf("failed"))
-				_, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, "prefix", true)
+				_, _, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, testRG, lbBackendpoolID, "prefix", "", nil, true)
 				Expect(errors.Unwrap(err)).To(Equal(fmt.Errorf("failed")))
+				assertEqualEvents([]string{"Normal VMSSConfigApplied Applied gateway configuration to vmss vmss"}, recorder.Events)
 			})
 
 			It("should return error if vmss instance has empty properties", func() {
@@ -555,7 +1186,7 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 				mockVMSSVMClient := az.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface)
 				vms := []*compute.VirtualMachineScaleSetVM{{InstanceID: to.Ptr("0")}}
 				mockVMSSVMClient.EXPECT().List(gomock.Any(), testRG, vmssName).Return(vms, nil)
-				_, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, "prefix", true)
+				_, _, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, testRG, lbBackendpoolID, "prefix", "", nil, true)
 				Expect(err).To(Equal(fmt.Errorf("vmss vm(0) has empty network profile")))
 			})
 
@@ -574,7 +1205,7 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 					},
 				}}
 				mockVMSSVMClient.EXPECT().List(gomock.Any(), testRG, vmssName).Return(vms, nil)
-				_, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, "prefix", true)
+				_, _, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, testRG, lbBackendpoolID, "prefix", "", nil, true)
 				Expect(err).To(Equal(fmt.Errorf("vmss vm(0) has empty os profile")))
 			})
 
@@ -596,7 +1227,7 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 					},
 				}}
 				mockVMSSVMClient.EXPECT().List(gomock.Any(), testRG, vmssName).Return(vms, nil)
-				_, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, "prefix", true)
+				_, _, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, testRG, lbBackendpoolID, "prefix", "", nil, true)
 				Expect(err.Error()).To(ContainSubstring("vmss(vm) primary network interface not found"))
 			})
 
@@ -609,7 +1240,7 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 				vms := []*compute.VirtualMachineScaleSetVM{getEmptyVMSSVM()}
 				mockVMSSVMClient.EXPECT().List(gomock.Any(), testRG, vmssName).Return(vms, nil)
 				mockVMSSVMClient.EXPECT().Update(gomock.Any(), testRG, vmssName, "0", gomock.Any()).Return(nil, fmt.Errorf("failed"))
-				_, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, "prefix", true)
+				_, _, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, testRG, lbBackendpoolID, "prefix", "", nil, true)
 				Expect(errors.Unwrap(err)).To(Equal(fmt.Errorf("failed")))
 			})
 
@@ -640,7 +1271,7 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 				mockInterfaceClient := az.InterfaceClient.(*mock_interfaceclient.MockInterface)
 				mockInterfaceClient.EXPECT().GetVirtualMachineScaleSetNetworkInterface(gomock.Any(), testRG, vmssName, "0", "nic").Return(
 					getConfiguredVMSSVMInterface(), nil)
-				_, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, "prefix", true)
+				_, _, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, testRG, lbBackendpoolID, "prefix", "", nil, true)
 				Expect(err).To(BeNil())
 			})
 
@@ -654,10 +1285,52 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 				mockInterfaceClient := az.InterfaceClient.(*mock_interfaceclient.MockInterface)
 				mockInterfaceClient.EXPECT().GetVirtualMachineScaleSetNetworkInterface(gomock.Any(), testRG, vmssName, "0", "nic").Return(
 					getConfiguredVMSSVMInterface(), nil)
-				_, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, "prefix", true)
+				_, _, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, testRG, lbBackendpoolID, "prefix", "", nil, true)
 				Expect(err).To(BeNil())
 			})
 
+			It("should only add ipConfig for vmss and vms when additional public ip prefix is added", func() {
+				existingVMSS, expectedVMSS := getConfiguredVMSSWithNameAndUID(), getConfiguredVMSS()
+				existingVM, expectedVM := getConfiguredVMSSVM(), getConfiguredVMSSVM()
+				existingVM.InstanceID = to.Ptr("0")
+				additionalIPConfig := r.getExpectedIPConfig("egressgateway-testUID-1", "prefix-1", 0, compute.IPVersionIPv4,
+					expectedVMSS.Properties.VirtualMachineProfile.NetworkProfile.NetworkInterfaceConfigurations)
+				expectedVMSS.Properties.VirtualMachineProfile.NetworkProfile.NetworkInterfaceConfigurations[0].Properties.IPConfigurations = append(
+					expectedVMSS.Properties.VirtualMachineProfile.NetworkProfile.NetworkInterfaceConfigurations[0].Properties.IPConfigurations, additionalIPConfig)
+				expectedVM.Properties.NetworkProfileConfiguration.NetworkInterfaceConfigurations[0].Properties.IPConfigurations = append(
+					expectedVM.Properties.NetworkProfileConfiguration.NetworkInterfaceConfigurations[0].Properties.IPConfigurations, additionalIPConfig)
+				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+				mockVMSSClient.EXPECT().CreateOrUpdate(gomock.Any(), testRG, vmssName, gomock.Any()).
+					DoAndReturn(func(ctx context.Context, rg, vmssName string, vmss compute.VirtualMachineScaleSet) (*compute.VirtualMachineScaleSet, error) {
+						Expect(vmss.Properties.VirtualMachineProfile.NetworkProfile).To(Equal(expectedVMSS.Properties.VirtualMachineProfile.NetworkProfile))
+						return expectedVMSS, nil
+					})
+				mockVMSSVMClient := az.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface)
+				mockVMSSVMClient.EXPECT().List(gomock.Any(), testRG, vmssName).Return([]*compute.VirtualMachineScaleSetVM{existingVM}, nil)
+				mockVMSSVMClient.EXPECT().Update(gomock.Any(), testRG, vmssName, "0", gomock.Any()).
+					DoAndReturn(func(ctx context.Context, rg, vmssName, instanceID string, vm compute.VirtualMachineScaleSetVM) (*compute.VirtualMachineScaleSetVM, error) {
+						Expect(vm.Properties.NetworkProfileConfiguration).To(Equal(expectedVM.Properties.NetworkProfileConfiguration))
+						return expectedVM, nil
+					})
+				vmInterface := getConfiguredVMSSVMInterface()
+				vmInterface.Properties.IPConfigurations = append(vmInterface.Properties.IPConfigurations, &network.InterfaceIPConfiguration{
+					Name: to.Ptr("egressgateway-testUID-1"),
+					Properties: &network.InterfaceIPConfigurationPropertiesFormat{
+						PrivateIPAddress: to.Ptr("10.0.0.7"),
+					},
+				})
+				mockInterfaceClient := az.InterfaceClient.(*mock_interfaceclient.MockInterface)
+				mockInterfaceClient.EXPECT().GetVirtualMachineScaleSetNetworkInterface(gomock.Any(), testRG, vmssName, "0", "nic").Return(vmInterface, nil)
+				_, _, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, testRG, lbBackendpoolID, "prefix", "", []string{"prefix-1"}, true)
+				Expect(err).To(BeNil())
+				Expect(vmConfig.Status.GatewayVMProfiles).To(Equal([]egressgatewayv1alpha1.GatewayVMProfile{{
+					NodeName:               "test",
+					PrimaryIP:              "10.0.0.5",
+					SecondaryIP:            "10.0.0.6",
+					AdditionalSecondaryIPs: []string{"10.0.0.7"},
+				}}))
+			})
+
 			It("should update ipConfigs for vmss and vms when they have unexpected setup", func() {
 				existingVMSS, expectedVMSS := getConfiguredVMSSWithNameAndUID(), getConfiguredVMSS()
 				existingVMSS.Properties.VirtualMachineProfile.NetworkProfile.NetworkInterfaceConfigurations[0].
@@ -689,7 +1362,7 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 				mockInterfaceClient := az.InterfaceClient.(*mock_interfaceclient.MockInterface)
 				mockInterfaceClient.EXPECT().GetVirtualMachineScaleSetNetworkInterface(gomock.Any(), testRG, vmssName, "0", "nic").Return(
 					getConfiguredVMSSVMInterface(), nil)
-				_, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, "prefix", true)
+				_, _, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, testRG, lbBackendpoolID, "prefix", "", nil, true)
 				Expect(err).To(BeNil())
 			})
 
@@ -717,7 +1390,7 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 						Expect(vm).To(Equal(to.Val(expectedVM)))
 						return expectedVM, nil
 					})
-				_, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, "prefix", false)
+				_, _, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, testRG, lbBackendpoolID, "prefix", "", nil, false)
 				Expect(err).To(BeNil())
 			})
 
@@ -727,7 +1400,7 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 				vms := []*compute.VirtualMachineScaleSetVM{existingVM}
 				mockVMSSVMClient := az.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface)
 				mockVMSSVMClient.EXPECT().List(gomock.Any(), testRG, vmssName).Return(vms, nil)
-				_, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, "prefix", false)
+				_, _, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, testRG, lbBackendpoolID, "prefix", "", nil, false)
 				Expect(err).To(BeNil())
 			})
 
@@ -757,7 +1430,7 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 				mockInterfaceClient := az.InterfaceClient.(*mock_interfaceclient.MockInterface)
 				mockInterfaceClient.EXPECT().GetVirtualMachineScaleSetNetworkInterface(gomock.Any(), testRG, vmssName, "0", "nic").Return(
 					getConfiguredVMSSVMInterface(), nil)
-				privateIPs, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, "", true)
+				privateIPs, _, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, testRG, lbBackendpoolID, "", "", nil, true)
 				Expect(len(privateIPs)).To(Equal(1))
 				Expect(privateIPs[0]).To(Equal("10.0.0.6"))
 				Expect(err).To(BeNil())
@@ -791,7 +1464,7 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 				mockInterfaceClient := az.InterfaceClient.(*mock_interfaceclient.MockInterface)
 				mockInterfaceClient.EXPECT().GetVirtualMachineScaleSetNetworkInterface(gomock.Any(), testRG, vmssName, "0", "nic").Return(
 					getConfiguredVMSSVMInterface(), nil)
-				privateIPs, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, "", true)
+				privateIPs, _, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, testRG, lbBackendpoolID, "", "", nil, true)
 				Expect(len(privateIPs)).To(Equal(1))
 				Expect(privateIPs[0]).To(Equal("10.0.0.6"))
 				Expect(err).To(BeNil())
@@ -823,17 +1496,150 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 						Expect(vm).To(Equal(to.Val(expectedVM)))
 						return expectedVM, nil
 					})
-				_, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, "", false)
+				_, _, err := r.reconcileVMSS(context.TODO(), vmConfig, existingVMSS, testRG, lbBackendpoolID, "", "", nil, false)
 				Expect(err).To(BeNil())
 			})
 		})
 
+		Context("TestReconcileGatewayVMSSes", func() {
+			var vmss1, vmss2 *compute.VirtualMachineScaleSet
+
+			BeforeEach(func() {
+				az = getMockAzureManager(gomock.NewController(GinkgoT()))
+				vmConfig.Spec.GatewayNodepoolName = ""
+				vmConfig.Spec.GatewayVmssProfile = egressgatewayv1alpha1.GatewayVmssProfile{
+					Vmsses: []egressgatewayv1alpha1.VmssReference{
+						{VmssResourceGroup: vmssRG, VmssName: vmssName},
+						{VmssResourceGroup: "vmss2RG", VmssName: "vmss2"},
+					},
+				}
+				vmss1 = getConfiguredVMSSWithNameAndUID()
+				// instances of all vmsses join the backend pool of the first vmss
+				vmss2 = getConfiguredVMSSWithNameAndUID()
+				vmss2.Name = to.Ptr("vmss2")
+				vmss2.ID = to.Ptr("/subscriptions/testSub/resourceGroups/vmss2RG/providers/Microsoft.Compute/virtualMachineScaleSets/vmss2")
+				vmss2.Properties.UniqueID = to.Ptr("vmss2UID")
+			})
+
+			It("should configure instances of all vmsses and report aggregate instance count", func() {
+				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig, gwConfig).WithRuntimeObjects(gwConfig, vmConfig).Build()
+				r = &GatewayVMConfigurationReconciler{Client: cl, AzureManager: az, Recorder: recorder}
+				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+				mockVMSSClient.EXPECT().Get(gomock.Any(), vmssRG, vmssName, gomock.Any()).Return(vmss1, nil)
+				mockVMSSClient.EXPECT().Get(gomock.Any(), "vmss2RG", "vmss2", gomock.Any()).Return(vmss2, nil)
+				mockVMSSVMClient := az.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface)
+				mockInterfaceClient := az.InterfaceClient.(*mock_interfaceclient.MockInterface)
+				for i, ref := range vmConfig.Spec.GatewayVmssProfile.Vmsses {
+					vm := getConfiguredVMSSVM()
+					vm.InstanceID = to.Ptr("0")
+					vm.Properties.OSProfile.ComputerName = to.Ptr(fmt.Sprintf("node%d", i))
+					// instances are looked up in the resource group of their vmss
+					mockVMSSVMClient.EXPECT().List(gomock.Any(), ref.VmssResourceGroup, ref.VmssName).Return([]*compute.VirtualMachineScaleSetVM{vm}, nil)
+					mockInterfaceClient.EXPECT().GetVirtualMachineScaleSetNetworkInterface(gomock.Any(), ref.VmssResourceGroup, ref.VmssName, "0", "nic").Return(
+						getConfiguredVMSSVMInterface(), nil)
+				}
+
+				vmsses, _, err := r.getGatewayVMSSes(context.TODO(), vmConfig)
+				Expect(err).To(BeNil())
+				Expect(vmsses).To(HaveLen(2))
+				_, err = r.reconcileGatewayVMSSes(context.TODO(), vmConfig, vmsses, "prefix", "", nil, true)
+				Expect(err).To(BeNil())
+
+				foundVMConfig := &egressgatewayv1alpha1.GatewayVMConfiguration{}
+				Expect(getResource(cl, foundVMConfig)).To(Succeed())
+				Expect(foundVMConfig.Status.Vmsses).To(Equal(vmConfig.Spec.GatewayVmssProfile.Vmsses))
+				Expect(foundVMConfig.Status.GatewayInstances).To(Equal(int32(2)))
+				Expect(foundVMConfig.Status.GatewayNodes).To(Equal([]string{"node0", "node1"}))
+			})
+
+			It("should not report instances without computer name as gateway nodes", func() {
+				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig, gwConfig).WithRuntimeObjects(gwConfig, vmConfig).Build()
+				r = &GatewayVMConfigurationReconciler{Client: cl, AzureManager: az, Recorder: recorder}
+				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+				mockVMSSClient.EXPECT().Get(gomock.Any(), vmssRG, vmssName, gomock.Any()).Return(vmss1, nil)
+				mockVMSSClient.EXPECT().Get(gomock.Any(), "vmss2RG", "vmss2", gomock.Any()).Return(vmss2, nil)
+				mockVMSSVMClient := az.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface)
+				mockInterfaceClient := az.InterfaceClient.(*mock_interfaceclient.MockInterface)
+				for i, ref := range vmConfig.Spec.GatewayVmssProfile.Vmsses {
+					vm := getConfiguredVMSSVM()
+					vm.InstanceID = to.Ptr("0")
+					vm.Properties.OSProfile.ComputerName = nil
+					if i == 0 {
+						vm.Properties.OSProfile.ComputerName = to.Ptr("Node0")
+					}
+					mockVMSSVMClient.EXPECT().List(gomock.Any(), ref.VmssResourceGroup, ref.VmssName).Return([]*compute.VirtualMachineScaleSetVM{vm}, nil)
+					mockInterfaceClient.EXPECT().GetVirtualMachineScaleSetNetworkInterface(gomock.Any(), ref.VmssResourceGroup, ref.VmssName, "0", "nic").Return(
+						getConfiguredVMSSVMInterface(), nil)
+				}
+
+				vmsses, _, err := r.getGatewayVMSSes(context.TODO(), vmConfig)
+				Expect(err).To(BeNil())
+				_, err = r.reconcileGatewayVMSSes(context.TODO(), vmConfig, vmsses, "prefix", "", nil, true)
+				Expect(err).To(BeNil())
+
+				foundVMConfig := &egressgatewayv1alpha1.GatewayVMConfiguration{}
+				Expect(getResource(cl, foundVMConfig)).To(Succeed())
+				Expect(foundVMConfig.Status.GatewayInstances).To(Equal(int32(1)))
+				Expect(foundVMConfig.Status.GatewayNodes).To(Equal([]string{"node0"}))
+			})
+
+			It("should remove gateway configuration from vmss no longer referenced", func() {
+				vmConfig.Status = &egressgatewayv1alpha1.GatewayVMConfigurationStatus{
+					Vmsses: vmConfig.Spec.GatewayVmssProfile.Vmsses,
+					GatewayVMProfiles: []egressgatewayv1alpha1.GatewayVMProfile{
+						{NodeName: "node0", PrimaryIP: "10.0.0.5", SecondaryIP: "10.0.0.6"},
+						{NodeName: "node1", PrimaryIP: "10.0.0.5", SecondaryIP: "10.0.0.6"},
+					},
+					GatewayInstances: 2,
+				}
+				vmConfig.Spec.GatewayVmssProfile.Vmsses = vmConfig.Spec.GatewayVmssProfile.Vmsses[:1]
+				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig, gwConfig).WithRuntimeObjects(gwConfig, vmConfig).Build()
+				r = &GatewayVMConfigurationReconciler{Client: cl, AzureManager: az, Recorder: recorder}
+				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+				mockVMSSClient.EXPECT().Get(gomock.Any(), vmssRG, vmssName, gomock.Any()).Return(vmss1, nil)
+				mockVMSSClient.EXPECT().Get(gomock.Any(), "vmss2RG", "vmss2", gomock.Any()).Return(vmss2, nil)
+				mockVMSSClient.EXPECT().CreateOrUpdate(gomock.Any(), "vmss2RG", "vmss2", gomock.Any()).
+					DoAndReturn(func(ctx context.Context, rg, vmssName string, vmss compute.VirtualMachineScaleSet) (*compute.VirtualMachineScaleSet, error) {
+						// both the ipConfig and the backend pool of the first vmss are removed
+						Expect(vmss.Properties.VirtualMachineProfile.NetworkProfile).To(Equal(getEmptyVMSS().Properties.VirtualMachineProfile.NetworkProfile))
+						return &vmss, nil
+					})
+				mockVMSSVMClient := az.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface)
+				mockInterfaceClient := az.InterfaceClient.(*mock_interfaceclient.MockInterface)
+				vm1, vm2 := getConfiguredVMSSVM(), getConfiguredVMSSVM()
+				vm1.InstanceID, vm1.Properties.OSProfile.ComputerName = to.Ptr("0"), to.Ptr("node0")
+				vm2.InstanceID, vm2.Properties.OSProfile.ComputerName = to.Ptr("0"), to.Ptr("node1")
+				mockVMSSVMClient.EXPECT().List(gomock.Any(), vmssRG, vmssName).Return([]*compute.VirtualMachineScaleSetVM{vm1}, nil)
+				mockInterfaceClient.EXPECT().GetVirtualMachineScaleSetNetworkInterface(gomock.Any(), vmssRG, vmssName, "0", "nic").Return(
+					getConfiguredVMSSVMInterface(), nil)
+				mockVMSSVMClient.EXPECT().List(gomock.Any(), "vmss2RG", "vmss2").Return([]*compute.VirtualMachineScaleSetVM{vm2}, nil)
+				mockVMSSVMClient.EXPECT().Update(gomock.Any(), "vmss2RG", "vmss2", "0", gomock.Any()).
+					DoAndReturn(func(ctx context.Context, rg, vmssName, instanceID string, vm compute.VirtualMachineScaleSetVM) (*compute.VirtualMachineScaleSetVM, error) {
+						Expect(vm.Properties.NetworkProfileConfiguration).To(Equal(getEmptyVMSSVM().Properties.NetworkProfileConfiguration))
+						return &vm, nil
+					})
+
+				vmsses, _, err := r.getGatewayVMSSes(context.TODO(), vmConfig)
+				Expect(err).To(BeNil())
+				_, err = r.reconcileGatewayVMSSes(context.TODO(), vmConfig, vmsses, "prefix", "", nil, true)
+				Expect(err).To(BeNil())
+
+				foundVMConfig := &egressgatewayv1alpha1.GatewayVMConfiguration{}
+				Expect(getResource(cl, foundVMConfig)).To(Succeed())
+				Expect(foundVMConfig.Status.Vmsses).To(Equal(vmConfig.Spec.GatewayVmssProfile.Vmsses))
+				Expect(foundVMConfig.Status.GatewayInstances).To(Equal(int32(1)))
+				Expect(foundVMConfig.Status.GatewayNodes).To(Equal([]string{"node0"}))
+				Expect(foundVMConfig.Status.GatewayVMProfiles).To(HaveLen(1))
+				Expect(foundVMConfig.Status.GatewayVMProfiles[0].NodeName).To(Equal("node0"))
+			})
+		})
+
 		When("reconciling vmConfig", func() {
 			BeforeEach(func() {
 				az = getMockAzureManager(gomock.NewController(GinkgoT()))
 				vmConfig.Spec.PublicIpPrefixId = "/subscriptions/testSub/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix"
 				vmConfig.Spec.ProvisionPublicIps = true
-				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig).WithRuntimeObjects(gwConfig, vmConfig).Build()
+				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig, gwConfig).WithRuntimeObjects(gwConfig, vmConfig).Build()
 				r = &GatewayVMConfigurationReconciler{Client: cl, AzureManager: az, Recorder: recorder}
 			})
 
@@ -929,6 +1735,7 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
 				mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return([]*compute.VirtualMachineScaleSet{vmss}, nil)
 				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID-1", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
 				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), "rg", "prefix", gomock.Any()).Return(ipPrefix, nil)
 				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
 				mockVMSSVMClient := az.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface)
@@ -939,8 +1746,378 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 				Expect(getErr).To(BeNil())
 				Expect(controllerutil.ContainsFinalizer(foundVMConfig, consts.VMConfigFinalizerName)).To(BeTrue())
 				Expect(foundVMConfig.Status.EgressIpPrefix).To(Equal("1.2.3.4/31"))
+				Expect(foundVMConfig.Status.PublicIpPrefixId).To(Equal("prefix"))
+				Expect(foundVMConfig.Status.OutboundType).To(Equal(egressgatewayv1alpha1.OutboundPublicIPPrefix))
 				assertEqualEvents([]string{"Normal ReconcileGatewayVMConfigurationSuccess GatewayVMConfiguration reconciled"}, recorder.Events)
 			})
+
+			When("public ip prefix cannot be allocated", func() {
+				var vmss *compute.VirtualMachineScaleSet
+
+				BeforeEach(func() {
+					r.ResyncInterval = 10 * time.Minute
+					vmConfig.Spec.PublicIpPrefixId = ""
+					cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig, gwConfig).WithRuntimeObjects(gwConfig, vmConfig).Build()
+					r.Client = cl
+					vmss = getConfiguredVMSSWithNameAndUID()
+					vmss.Tags = map[string]*string{
+						consts.AKSNodepoolTagKey:             to.Ptr("testgw"),
+						consts.AKSNodepoolIPPrefixSizeTagKey: to.Ptr("31"),
+					}
+				})
+
+				It("should report allocation failure on gateway and wait for resync", func() {
+					quotaErr := &azcore.ResponseError{
+						ErrorCode:  "PublicIPCountLimitReached",
+						StatusCode: http.StatusBadRequest,
+						RawResponse: &http.Response{
+							StatusCode: http.StatusBadRequest,
+							Body:       io.NopCloser(strings.NewReader(`{"error":{"code":"PublicIPCountLimitReached","message":"Cannot create more than 10 public IP addresses for this subscription in this region."}}`)),
+						},
+					}
+					mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+					mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return([]*compute.VirtualMachineScaleSet{vmss}, nil)
+					mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+					mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
+					mockPublicIPPrefixClient.EXPECT().CreateOrUpdate(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).Return(nil, quotaErr)
+					res, reconcileErr = r.Reconcile(context.TODO(), req)
+					Expect(reconcileErr).To(BeNil())
+					Expect(res).To(Equal(ctrl.Result{RequeueAfter: 10 * time.Minute}))
+					expectedMessage := "failed to allocate public ip prefix egressgateway-testUID: PublicIPCountLimitReached: Cannot create more than 10 public IP addresses for this subscription in this region."
+					Expect(getResource(cl, gwConfig)).To(Succeed())
+					cond := meta.FindStatusCondition(gwConfig.Status.Conditions, consts.SGCPublicIPPrefixReadyConditionType)
+					Expect(cond).NotTo(BeNil())
+					Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+					Expect(cond.Reason).To(Equal(consts.SGCPublicIPPrefixReadyReasonAllocationFailed))
+					Expect(cond.Message).To(Equal(expectedMessage))
+					Expect(gwConfig.Status.LastAzureSyncError).To(Equal(expectedMessage))
+					Expect(gwConfig.Status.LastAzureSyncTime).To(BeNil())
+					assertEqualEvents([]string{
+						"Normal PublicIPPrefixProvisioning Creating IPv4 public ip prefix egressgateway-testUID",
+						"Warning PrefixAllocationFailed " + expectedMessage,
+					}, recorder.Events)
+				})
+
+				It("should remove allocation failure condition once public ip prefix is provisioned", func() {
+					Expect(getResource(cl, gwConfig)).To(Succeed())
+					meta.SetStatusCondition(&gwConfig.Status.Conditions, metav1.Condition{
+						Type:    consts.SGCPublicIPPrefixReadyConditionType,
+						Status:  metav1.ConditionFalse,
+						Reason:  consts.SGCPublicIPPrefixReadyReasonAllocationFailed,
+						Message: "failed",
+					})
+					gwConfig.Status.LastAzureSyncError = "failed"
+					Expect(cl.Status().Update(context.TODO(), gwConfig)).To(Succeed())
+					mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+					mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return([]*compute.VirtualMachineScaleSet{vmss}, nil)
+					mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+					mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID-1", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
+					mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).Return(&network.PublicIPPrefix{
+						ID: to.Ptr("prefix"),
+						Properties: &network.PublicIPPrefixPropertiesFormat{
+							PrefixLength: to.Ptr(int32(31)),
+							IPPrefix:     to.Ptr("1.2.3.4/31"),
+						},
+					}, nil)
+					mockVMSSVMClient := az.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface)
+					mockVMSSVMClient.EXPECT().List(gomock.Any(), testRG, vmssName).Return([]*compute.VirtualMachineScaleSetVM{}, nil)
+					_, reconcileErr = r.Reconcile(context.TODO(), req)
+					Expect(reconcileErr).To(BeNil())
+					Expect(getResource(cl, gwConfig)).To(Succeed())
+					Expect(meta.FindStatusCondition(gwConfig.Status.Conditions, consts.SGCPublicIPPrefixReadyConditionType)).To(BeNil())
+					Expect(gwConfig.Status.LastAzureSyncError).To(BeEmpty())
+					Expect(gwConfig.Status.LastAzureSyncTime).NotTo(BeNil())
+					assertEqualEvents([]string{"Normal ReconcileGatewayVMConfigurationSuccess GatewayVMConfiguration reconciled"}, recorder.Events)
+				})
+			})
+
+			When("public ip prefix is in another region than the gateway vmss", func() {
+				It("should report region mismatch on gateway and wait for resync", func() {
+					r.ResyncInterval = 10 * time.Minute
+					cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig, gwConfig).WithRuntimeObjects(gwConfig, vmConfig).Build()
+					r.Client = cl
+					vmss := getConfiguredVMSSWithNameAndUID()
+					vmss.Tags = map[string]*string{
+						consts.AKSNodepoolTagKey:             to.Ptr("testgw"),
+						consts.AKSNodepoolIPPrefixSizeTagKey: to.Ptr("31"),
+					}
+					mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+					mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return([]*compute.VirtualMachineScaleSet{vmss}, nil)
+					mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+					mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), "rg", "prefix", gomock.Any()).Return(&network.PublicIPPrefix{
+						ID:       to.Ptr("prefix"),
+						Location: to.Ptr("westus"),
+						Properties: &network.PublicIPPrefixPropertiesFormat{
+							PrefixLength: to.Ptr(int32(31)),
+							IPPrefix:     to.Ptr("1.2.3.4/31"),
+						},
+					}, nil)
+					res, reconcileErr = r.Reconcile(context.TODO(), req)
+					Expect(reconcileErr).To(BeNil())
+					Expect(res).To(Equal(ctrl.Result{RequeueAfter: 10 * time.Minute}))
+					expectedMessage := fmt.Sprintf("public ip prefix(%s) is in region westus but gateway vmss(vmss) is in region location, they must be in the same region", vmConfig.Spec.PublicIpPrefixId)
+					Expect(getResource(cl, gwConfig)).To(Succeed())
+					cond := meta.FindStatusCondition(gwConfig.Status.Conditions, consts.SGCPublicIPPrefixReadyConditionType)
+					Expect(cond).NotTo(BeNil())
+					Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+					Expect(cond.Reason).To(Equal(consts.SGCPublicIPPrefixReadyReasonRegionMismatch))
+					Expect(cond.Message).To(Equal(expectedMessage))
+					assertEqualEvents([]string{"Warning RegionMismatch " + expectedMessage}, recorder.Events)
+				})
+			})
+
+			When("gateway vmss lacks the network configuration for gateway", func() {
+				It("should report vmss not gateway ready on gateway and wait for resync", func() {
+					r.ResyncInterval = 10 * time.Minute
+					vmConfig.Spec.PublicIpPrefixId = ""
+					cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig, gwConfig).WithRuntimeObjects(gwConfig, vmConfig).Build()
+					r.Client = cl
+					vmss := getEmptyVMSS()
+					vmss.Tags = map[string]*string{
+						consts.AKSNodepoolTagKey:             to.Ptr("testgw"),
+						consts.AKSNodepoolIPPrefixSizeTagKey: to.Ptr("31"),
+					}
+					nic := vmss.Properties.VirtualMachineProfile.NetworkProfile.NetworkInterfaceConfigurations[0]
+					nic.Name = to.Ptr("nic")
+					nic.Properties.IPConfigurations[0].Properties.Subnet = nil
+					mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+					mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return([]*compute.VirtualMachineScaleSet{vmss}, nil)
+					mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+					mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).Return(&network.PublicIPPrefix{
+						ID: to.Ptr("prefix"),
+						Properties: &network.PublicIPPrefixPropertiesFormat{
+							PrefixLength: to.Ptr(int32(31)),
+							IPPrefix:     to.Ptr("1.2.3.4/31"),
+						},
+					}, nil)
+					res, reconcileErr = r.Reconcile(context.TODO(), req)
+					Expect(reconcileErr).To(BeNil())
+					Expect(res).To(Equal(ctrl.Result{RequeueAfter: 10 * time.Minute}))
+					expectedMessage := "vmss(vmss) is not ready for egress gateway: primary ip configuration of network interface nic has no subnet, " +
+						"the vmss needs a primary network interface with a primary ip configuration in a subnet"
+					Expect(getResource(cl, gwConfig)).To(Succeed())
+					cond := meta.FindStatusCondition(gwConfig.Status.Conditions, consts.SGCGatewayVMSSReadyConditionType)
+					Expect(cond).NotTo(BeNil())
+					Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+					Expect(cond.Reason).To(Equal(consts.SGCGatewayVMSSReadyReasonNotGatewayReady))
+					Expect(cond.Message).To(Equal(expectedMessage))
+					assertEqualEvents([]string{"Warning VMSSNotGatewayReady " + expectedMessage}, recorder.Events)
+				})
+			})
+
+			When("gateway vmss is in another subscription", func() {
+				var (
+					subAz    *azmanager.AzureManager
+					builtFor []string
+				)
+
+				BeforeEach(func() {
+					r.ResyncInterval = 10 * time.Minute
+					vmConfig.Spec.GatewayNodepoolName = ""
+					vmConfig.Spec.GatewayVmssProfile.SubscriptionId = "gatewaySub"
+					vmConfig.Spec.PublicIpPrefixId = ""
+					cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig, gwConfig).WithRuntimeObjects(gwConfig, vmConfig).Build()
+					r.Client = cl
+					builtFor = nil
+					az.NewSubscriptionClients = func(subscriptionID string) (*azmanager.SubscriptionClients, error) {
+						builtFor = append(builtFor, subscriptionID)
+						return &azmanager.SubscriptionClients{Factory: getMockClientFactory(gomock.NewController(GinkgoT()))}, nil
+					}
+					var err error
+					subAz, err = az.ForSubscription("gatewaySub", vmssRG)
+					Expect(err).To(BeNil())
+				})
+
+				It("should call Azure with clients of the gateway subscription", func() {
+					vmConfig.Status = &egressgatewayv1alpha1.GatewayVMConfigurationStatus{}
+					mockVMSSClient := subAz.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+					mockVMSSClient.EXPECT().Get(gomock.Any(), vmssRG, vmssName, gomock.Any()).Return(getConfiguredVMSSWithNameAndUID(), nil)
+					gr, err := r.forGateway(vmConfig)
+					Expect(err).To(BeNil())
+					Expect(gr.SubscriptionID()).To(Equal("gatewaySub"))
+					Expect(r.SubscriptionID()).To(Equal("testSub"))
+					vmsses, _, err := gr.getGatewayVMSSes(context.TODO(), vmConfig)
+					Expect(err).To(BeNil())
+					Expect(vmsses).To(HaveLen(1))
+					Expect(builtFor).To(Equal([]string{"gatewaySub"}))
+				})
+
+				It("should report no access to the subscription on gateway and wait for resync", func() {
+					mockVMSSClient := subAz.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+					mockVMSSClient.EXPECT().Get(gomock.Any(), vmssRG, vmssName, gomock.Any()).Return(nil, &azcore.ResponseError{ErrorCode: "AuthorizationFailed", StatusCode: http.StatusForbidden})
+					res, reconcileErr = r.Reconcile(context.TODO(), req)
+					Expect(reconcileErr).To(BeNil())
+					Expect(res).To(Equal(ctrl.Result{RequeueAfter: 10 * time.Minute}))
+					Expect(getResource(cl, gwConfig)).To(Succeed())
+					cond := meta.FindStatusCondition(gwConfig.Status.Conditions, consts.SGCGatewayVMSSReadyConditionType)
+					Expect(cond).NotTo(BeNil())
+					Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+					Expect(cond.Reason).To(Equal(consts.SGCGatewayVMSSReadyReasonSubscriptionAccessDenied))
+					Expect(cond.Message).To(HavePrefix("controller credential has no access to gateway subscription(gatewaySub)"))
+					Expect(recorder.Events).To(Receive(HavePrefix("Warning SubscriptionAccessDenied controller credential has no access to gateway subscription(gatewaySub)")))
+				})
+
+				It("should report error when clients of the subscription cannot be created", func() {
+					vmConfig.Spec.GatewayVmssProfile.SubscriptionId = "otherSub"
+					Expect(cl.Update(context.TODO(), vmConfig)).To(Succeed())
+					az.NewSubscriptionClients = nil
+					_, reconcileErr = r.Reconcile(context.TODO(), req)
+					Expect(reconcileErr).To(MatchError("azure clients of subscription(otherSub) are not supported, gateways must be in the cluster subscription(testSub)"))
+				})
+			})
+
+			It("should associate public ip prefix with nat gateway instead of gateway nodes", func() {
+				Expect(getResource(cl, vmConfig)).To(Succeed())
+				vmConfig.Spec.NatGatewayId = testNatGatewayID
+				Expect(cl.Update(context.TODO(), vmConfig)).To(Succeed())
+				mockNatGatewayClient := mocknatgatewayclient.NewMockInterface(gomock.NewController(GinkgoT()))
+				az.NatGatewayClient = mockNatGatewayClient
+				vmss := getConfiguredVMSSWithoutPublicIPConfig()
+				vmss.Name = to.Ptr(vmssName)
+				vmss.Properties.UniqueID = to.Ptr(testVMSSUID)
+				vmss.Tags = map[string]*string{
+					consts.AKSNodepoolTagKey:             to.Ptr("testgw"),
+					consts.AKSNodepoolIPPrefixSizeTagKey: to.Ptr("31"),
+				}
+				ipPrefix := &network.PublicIPPrefix{
+					Name: to.Ptr("prefix"),
+					ID:   to.Ptr("prefix"),
+					Properties: &network.PublicIPPrefixPropertiesFormat{
+						PrefixLength: to.Ptr(int32(31)),
+						IPPrefix:     to.Ptr("1.2.3.4/31"),
+					},
+				}
+				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+				mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return([]*compute.VirtualMachineScaleSet{vmss}, nil)
+				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID-1", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), "rg", "prefix", gomock.Any()).Return(ipPrefix, nil)
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
+				mockVMSSVMClient := az.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface)
+				mockVMSSVMClient.EXPECT().List(gomock.Any(), testRG, vmssName).Return([]*compute.VirtualMachineScaleSetVM{}, nil)
+				mockNatGatewayClient.EXPECT().Get(gomock.Any(), "natRG", "natgw", gomock.Any()).Return(&network.NatGateway{Name: to.Ptr("natgw")}, nil)
+				mockNatGatewayClient.EXPECT().CreateOrUpdate(gomock.Any(), "natRG", "natgw", network.NatGateway{
+					Name: to.Ptr("natgw"),
+					Properties: &network.NatGatewayPropertiesFormat{
+						PublicIPPrefixes: []*network.SubResource{{ID: to.Ptr("prefix")}},
+					},
+				}).Return(&network.NatGateway{}, nil)
+				_, reconcileErr = r.Reconcile(context.TODO(), req)
+				Expect(reconcileErr).To(BeNil())
+				getErr = getResource(cl, foundVMConfig)
+				Expect(getErr).To(BeNil())
+				Expect(foundVMConfig.Status.EgressIpPrefix).To(Equal("1.2.3.4/31"))
+				Expect(foundVMConfig.Status.OutboundType).To(Equal(egressgatewayv1alpha1.OutboundNatGateway))
+				Expect(foundVMConfig.Status.NatGatewayId).To(Equal(testNatGatewayID))
+				Expect(foundVMConfig.Status.NatGatewayPublicIpPrefixId).To(Equal("prefix"))
+			})
+
+			It("should associate public ip address with nat gateway and report it as a /32 prefix", func() {
+				ipAddressID := "/subscriptions/testSub/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/ip"
+				Expect(getResource(cl, vmConfig)).To(Succeed())
+				vmConfig.Spec.NatGatewayId = testNatGatewayID
+				vmConfig.Spec.PublicIpPrefixId = ""
+				vmConfig.Spec.PublicIpAddressId = ipAddressID
+				Expect(cl.Update(context.TODO(), vmConfig)).To(Succeed())
+				mockNatGatewayClient := mocknatgatewayclient.NewMockInterface(gomock.NewController(GinkgoT()))
+				az.NatGatewayClient = mockNatGatewayClient
+				vmss := getConfiguredVMSSWithoutPublicIPConfig()
+				vmss.Name = to.Ptr(vmssName)
+				vmss.Properties.UniqueID = to.Ptr(testVMSSUID)
+				vmss.Tags = map[string]*string{
+					consts.AKSNodepoolTagKey:             to.Ptr("testgw"),
+					consts.AKSNodepoolIPPrefixSizeTagKey: to.Ptr("31"),
+				}
+				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+				mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return([]*compute.VirtualMachineScaleSet{vmss}, nil)
+				mockPublicIPAddressClient := az.PublicIPAddressClient.(*mock_publicipaddressclient.MockInterface)
+				mockPublicIPAddressClient.EXPECT().Get(gomock.Any(), "rg", "ip", gomock.Any()).Return(&network.PublicIPAddress{
+					Name:       to.Ptr("ip"),
+					ID:         to.Ptr(ipAddressID),
+					Properties: &network.PublicIPAddressPropertiesFormat{IPAddress: to.Ptr("1.2.3.4")},
+				}, nil)
+				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID-1", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
+				mockVMSSVMClient := az.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface)
+				mockVMSSVMClient.EXPECT().List(gomock.Any(), testRG, vmssName).Return([]*compute.VirtualMachineScaleSetVM{}, nil)
+				mockNatGatewayClient.EXPECT().Get(gomock.Any(), "natRG", "natgw", gomock.Any()).Return(&network.NatGateway{Name: to.Ptr("natgw")}, nil)
+				mockNatGatewayClient.EXPECT().CreateOrUpdate(gomock.Any(), "natRG", "natgw", network.NatGateway{
+					Name: to.Ptr("natgw"),
+					Properties: &network.NatGatewayPropertiesFormat{
+						PublicIPAddresses: []*network.SubResource{{ID: to.Ptr(ipAddressID)}},
+					},
+				}).Return(&network.NatGateway{}, nil)
+				_, reconcileErr = r.Reconcile(context.TODO(), req)
+				Expect(reconcileErr).To(BeNil())
+				getErr = getResource(cl, foundVMConfig)
+				Expect(getErr).To(BeNil())
+				Expect(foundVMConfig.Status.EgressIpPrefixes).To(Equal([]string{"1.2.3.4/32"}))
+				Expect(foundVMConfig.Status.EgressIpPrefix).To(Equal("1.2.3.4/32"))
+				Expect(foundVMConfig.Status.PublicIpPrefixId).To(BeEmpty())
+				Expect(foundVMConfig.Status.OutboundType).To(Equal(egressgatewayv1alpha1.OutboundNatGateway))
+				Expect(foundVMConfig.Status.NatGatewayId).To(Equal(testNatGatewayID))
+				Expect(foundVMConfig.Status.NatGatewayPublicIpAddressId).To(Equal(ipAddressID))
+				Expect(foundVMConfig.Status.NatGatewayPublicIpPrefixId).To(BeEmpty())
+			})
+
+			When("spec has been applied", func() {
+				var vmss *compute.VirtualMachineScaleSet
+
+				BeforeEach(func() {
+					r.ResyncInterval = 10 * time.Minute
+					Expect(getResource(cl, vmConfig)).To(Succeed())
+					controllerutil.AddFinalizer(vmConfig, consts.VMConfigFinalizerName)
+					vmConfig.Generation = 2
+					Expect(cl.Update(context.TODO(), vmConfig)).To(Succeed())
+					vmConfig.Status = &egressgatewayv1alpha1.GatewayVMConfigurationStatus{ObservedGeneration: 2}
+					Expect(cl.Status().Update(context.TODO(), vmConfig)).To(Succeed())
+					vmss = getConfiguredVMSSWithoutPublicIPConfig()
+					vmss.Name = to.Ptr(vmssName)
+					vmss.Properties.UniqueID = to.Ptr(testVMSSUID)
+					vmss.Tags = map[string]*string{
+						consts.AKSNodepoolTagKey:             to.Ptr("testgw"),
+						consts.AKSNodepoolIPPrefixSizeTagKey: to.Ptr("31"),
+					}
+				})
+
+				It("should correct vmss modified out-of-band and record drift", func() {
+					ipPrefix := &network.PublicIPPrefix{
+						Name: to.Ptr("prefix"),
+						ID:   to.Ptr("prefix"),
+						Properties: &network.PublicIPPrefixPropertiesFormat{
+							PrefixLength: to.Ptr(int32(31)),
+							IPPrefix:     to.Ptr("1.2.3.4/31"),
+						},
+					}
+					mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+					mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return([]*compute.VirtualMachineScaleSet{vmss}, nil)
+					mockVMSSClient.EXPECT().CreateOrUpdate(gomock.Any(), testRG, vmssName, gomock.Any()).Return(getConfiguredVMSS(), nil)
+					mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+					mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID-1", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
+					mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), "rg", "prefix", gomock.Any()).Return(ipPrefix, nil)
+					mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
+					mockVMSSVMClient := az.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface)
+					mockVMSSVMClient.EXPECT().List(gomock.Any(), testRG, vmssName).Return([]*compute.VirtualMachineScaleSetVM{}, nil)
+					res, reconcileErr = r.Reconcile(context.TODO(), req)
+					Expect(reconcileErr).To(BeNil())
+					Expect(res).To(Equal(ctrl.Result{RequeueAfter: 10 * time.Minute}))
+					assertEqualEvents([]string{
+						"Warning DriftDetected Network configuration of vmss vmss has been modified",
+						"Normal VMSSConfigApplied Applied gateway configuration to vmss vmss",
+						"Normal ReconcileGatewayVMConfigurationSuccess GatewayVMConfiguration reconciled",
+					}, recorder.Events)
+				})
+
+				It("should skip resync while vmss is updating", func() {
+					vmss.Properties.ProvisioningState = to.Ptr("Updating")
+					mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+					mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return([]*compute.VirtualMachineScaleSet{vmss}, nil)
+					res, reconcileErr = r.Reconcile(context.TODO(), req)
+					Expect(reconcileErr).To(BeNil())
+					Expect(res).To(Equal(ctrl.Result{RequeueAfter: 10 * time.Minute}))
+				})
+			})
 		})
 
 		When("deleting vmConfig with finalizer", func() {
@@ -949,7 +2126,7 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 				vmConfig.Spec.PublicIpPrefixId = "/subscriptions/testSub/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix"
 				vmConfig.ObjectMeta.DeletionTimestamp = to.Ptr(metav1.Now())
 				controllerutil.AddFinalizer(vmConfig, consts.VMConfigFinalizerName)
-				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig).WithRuntimeObjects(gwConfig, vmConfig).Build()
+				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig, gwConfig).WithRuntimeObjects(gwConfig, vmConfig).Build()
 				r = &GatewayVMConfigurationReconciler{Client: cl, AzureManager: az, Recorder: recorder}
 			})
 
@@ -992,6 +2169,132 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 				Expect(errors.Unwrap(reconcileErr)).To(Equal(fmt.Errorf("failed")))
 			})
 
+			It("should disassociate public ip prefix from nat gateway before deleting vmConfig", func() {
+				Expect(getResource(cl, vmConfig)).To(Succeed())
+				vmConfig.Status = &egressgatewayv1alpha1.GatewayVMConfigurationStatus{
+					NatGatewayId:               testNatGatewayID,
+					NatGatewayPublicIpPrefixId: "prefix",
+				}
+				Expect(cl.Status().Update(context.TODO(), vmConfig)).To(Succeed())
+				mockNatGatewayClient := mocknatgatewayclient.NewMockInterface(gomock.NewController(GinkgoT()))
+				az.NatGatewayClient = mockNatGatewayClient
+				vmss := getEmptyVMSS()
+				vmss.Tags = map[string]*string{
+					consts.AKSNodepoolTagKey:             to.Ptr("testgw"),
+					consts.AKSNodepoolIPPrefixSizeTagKey: to.Ptr("31"),
+				}
+				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+				mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return([]*compute.VirtualMachineScaleSet{vmss}, nil)
+				mockVMSSVMClient := az.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface)
+				mockVMSSVMClient.EXPECT().List(gomock.Any(), testRG, vmssName).Return([]*compute.VirtualMachineScaleSetVM{}, nil)
+				natGateway := &network.NatGateway{
+					Name:       to.Ptr("natgw"),
+					Properties: &network.NatGatewayPropertiesFormat{PublicIPPrefixes: []*network.SubResource{{ID: to.Ptr("prefix")}}},
+				}
+				mockNatGatewayClient.EXPECT().Get(gomock.Any(), "natRG", "natgw", gomock.Any()).Return(natGateway, nil)
+				mockNatGatewayClient.EXPECT().CreateOrUpdate(gomock.Any(), "natRG", "natgw", gomock.Any()).
+					DoAndReturn(func(ctx context.Context, rg, name string, natGateway network.NatGateway) (*network.NatGateway, error) {
+						Expect(natGateway.Properties.PublicIPPrefixes).To(BeEmpty())
+						return &natGateway, nil
+					})
+				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID-1", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
+				_, reconcileErr = r.Reconcile(context.TODO(), req)
+				Expect(reconcileErr).To(BeNil())
+				getErr = getResource(cl, foundVMConfig)
+				Expect(apierrors.IsNotFound(getErr)).To(BeTrue())
+			})
+
+			It("should disassociate public ip prefix from nat gateway requested in spec but not recorded in status", func() {
+				Expect(getResource(cl, vmConfig)).To(Succeed())
+				vmConfig.Spec.NatGatewayId = testNatGatewayID
+				Expect(cl.Update(context.TODO(), vmConfig)).To(Succeed())
+				mockNatGatewayClient := mocknatgatewayclient.NewMockInterface(gomock.NewController(GinkgoT()))
+				az.NatGatewayClient = mockNatGatewayClient
+				vmss := getEmptyVMSS()
+				vmss.Tags = map[string]*string{
+					consts.AKSNodepoolTagKey:             to.Ptr("testgw"),
+					consts.AKSNodepoolIPPrefixSizeTagKey: to.Ptr("31"),
+				}
+				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+				mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return([]*compute.VirtualMachineScaleSet{vmss}, nil)
+				mockVMSSVMClient := az.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface)
+				mockVMSSVMClient.EXPECT().List(gomock.Any(), testRG, vmssName).Return([]*compute.VirtualMachineScaleSetVM{}, nil)
+				natGateway := &network.NatGateway{
+					Name:       to.Ptr("natgw"),
+					Properties: &network.NatGatewayPropertiesFormat{PublicIPPrefixes: []*network.SubResource{{ID: to.Ptr(vmConfig.Spec.PublicIpPrefixId)}}},
+				}
+				mockNatGatewayClient.EXPECT().Get(gomock.Any(), "natRG", "natgw", gomock.Any()).Return(natGateway, nil)
+				mockNatGatewayClient.EXPECT().CreateOrUpdate(gomock.Any(), "natRG", "natgw", gomock.Any()).
+					DoAndReturn(func(ctx context.Context, rg, name string, natGateway network.NatGateway) (*network.NatGateway, error) {
+						Expect(natGateway.Properties.PublicIPPrefixes).To(BeEmpty())
+						return &natGateway, nil
+					})
+				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID-1", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
+				_, reconcileErr = r.Reconcile(context.TODO(), req)
+				Expect(reconcileErr).To(BeNil())
+				getErr = getResource(cl, foundVMConfig)
+				Expect(apierrors.IsNotFound(getErr)).To(BeTrue())
+			})
+
+			It("should resume deletion after a controller restart between cleanup steps", func() {
+				Expect(getResource(cl, vmConfig)).To(Succeed())
+				vmConfig.Status = &egressgatewayv1alpha1.GatewayVMConfigurationStatus{
+					NatGatewayId:               testNatGatewayID,
+					NatGatewayPublicIpPrefixId: "prefix",
+				}
+				Expect(cl.Status().Update(context.TODO(), vmConfig)).To(Succeed())
+				mockNatGatewayClient := mocknatgatewayclient.NewMockInterface(gomock.NewController(GinkgoT()))
+				az.NatGatewayClient = mockNatGatewayClient
+				vmss := getEmptyVMSS()
+				vmss.Tags = map[string]*string{
+					consts.AKSNodepoolTagKey:             to.Ptr("testgw"),
+					consts.AKSNodepoolIPPrefixSizeTagKey: to.Ptr("31"),
+				}
+				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+				// vmss and its instances are cached by the azure manager
+				mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return([]*compute.VirtualMachineScaleSet{vmss}, nil)
+				mockVMSSVMClient := az.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface)
+				mockVMSSVMClient.EXPECT().List(gomock.Any(), testRG, vmssName).Return([]*compute.VirtualMachineScaleSetVM{}, nil)
+				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID-1", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
+
+				// first run: nat gateway is disassociated, then the controller fails before the prefix is deleted
+				natGateway := &network.NatGateway{
+					Name:       to.Ptr("natgw"),
+					Properties: &network.NatGatewayPropertiesFormat{PublicIPPrefixes: []*network.SubResource{{ID: to.Ptr("prefix")}}},
+				}
+				gomock.InOrder(
+					mockNatGatewayClient.EXPECT().Get(gomock.Any(), "natRG", "natgw", gomock.Any()).Return(natGateway, nil),
+					mockNatGatewayClient.EXPECT().CreateOrUpdate(gomock.Any(), "natRG", "natgw", gomock.Any()).
+						DoAndReturn(func(ctx context.Context, rg, name string, natGateway network.NatGateway) (*network.NatGateway, error) {
+							return &natGateway, nil
+						}),
+					mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).Return(&network.PublicIPPrefix{}, nil),
+					mockPublicIPPrefixClient.EXPECT().Delete(gomock.Any(), testRG, "egressgateway-testUID").Return(fmt.Errorf("failed")),
+				)
+				_, reconcileErr = r.Reconcile(context.TODO(), req)
+				Expect(reconcileErr).To(HaveOccurred())
+				Expect(getResource(cl, foundVMConfig)).To(Succeed())
+				Expect(foundVMConfig.Finalizers).To(ContainElement(consts.VMConfigFinalizerName))
+
+				// second run by a new controller: completed steps are no-ops, the prefix is deleted and the finalizer removed
+				gomock.InOrder(
+					mockNatGatewayClient.EXPECT().Get(gomock.Any(), "natRG", "natgw", gomock.Any()).
+						Return(&network.NatGateway{Name: to.Ptr("natgw"), Properties: &network.NatGatewayPropertiesFormat{}}, nil),
+					mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).Return(&network.PublicIPPrefix{}, nil),
+					mockPublicIPPrefixClient.EXPECT().Delete(gomock.Any(), testRG, "egressgateway-testUID").Return(nil),
+				)
+				r = &GatewayVMConfigurationReconciler{Client: cl, AzureManager: az, Recorder: recorder}
+				_, reconcileErr = r.Reconcile(context.TODO(), req)
+				Expect(reconcileErr).To(BeNil())
+				getErr = getResource(cl, foundVMConfig)
+				Expect(apierrors.IsNotFound(getErr)).To(BeTrue())
+			})
+
 			It("should delete vmConfig", func() {
 				vmss := getEmptyVMSS()
 				vmss.Tags = map[string]*string{
@@ -1001,6 +2304,7 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
 				mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return([]*compute.VirtualMachineScaleSet{vmss}, nil)
 				mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID-1", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
 				mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), testRG, "egressgateway-testUID", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound})
 				mockVMSSVMClient := az.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface)
 				mockVMSSVMClient.EXPECT().List(gomock.Any(), testRG, vmssName).Return([]*compute.VirtualMachineScaleSetVM{}, nil)
@@ -1009,6 +2313,27 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 				getErr = getResource(cl, foundVMConfig)
 				Expect(apierrors.IsNotFound(getErr)).To(BeTrue())
 			})
+
+			It("should keep managed public ip prefixes to be reused", func() {
+				vmConfig.Spec.PublicIpPrefixId = ""
+				vmConfig.Spec.ReusePublicIpPrefix = true
+				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig, gwConfig).WithRuntimeObjects(gwConfig, vmConfig).Build()
+				r = &GatewayVMConfigurationReconciler{Client: cl, AzureManager: az, Recorder: recorder}
+				vmss := getEmptyVMSS()
+				vmss.Tags = map[string]*string{
+					consts.AKSNodepoolTagKey:             to.Ptr("testgw"),
+					consts.AKSNodepoolIPPrefixSizeTagKey: to.Ptr("31"),
+				}
+				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+				mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return([]*compute.VirtualMachineScaleSet{vmss}, nil)
+				mockVMSSVMClient := az.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface)
+				mockVMSSVMClient.EXPECT().List(gomock.Any(), testRG, vmssName).Return([]*compute.VirtualMachineScaleSetVM{}, nil)
+				// no public ip prefix is read or deleted
+				_, reconcileErr = r.Reconcile(context.TODO(), req)
+				Expect(reconcileErr).To(BeNil())
+				getErr = getResource(cl, foundVMConfig)
+				Expect(apierrors.IsNotFound(getErr)).To(BeTrue())
+			})
 		})
 
 		Context("Test node event reconciler", func() {
@@ -1024,14 +2349,14 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 			})
 
 			It("should return nil when node not found", func() {
-				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig).WithRuntimeObjects(gwConfig, vmConfig).Build()
+				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig, gwConfig).WithRuntimeObjects(gwConfig, vmConfig).Build()
 				r = &GatewayVMConfigurationReconciler{Client: cl, AzureManager: az, Recorder: recorder}
 				_, err := r.Reconcile(context.TODO(), req)
 				Expect(err).NotTo(HaveOccurred())
 			})
 
 			It("should reconcile vmConfig when node does not have agentpool name label", func() {
-				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig).WithRuntimeObjects(node, gwConfig, vmConfig).Build()
+				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig, gwConfig).WithRuntimeObjects(node, gwConfig, vmConfig).Build()
 				r = &GatewayVMConfigurationReconciler{Client: cl, AzureManager: az, Recorder: recorder}
 				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
 				mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return(nil, errors.New("failed"))
@@ -1042,7 +2367,7 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 			It("should not reconcile vmConfig when vmConfig is deleting", func() {
 				vmConfig.ObjectMeta.DeletionTimestamp = to.Ptr(metav1.Now())
 				controllerutil.AddFinalizer(vmConfig, consts.VMConfigFinalizerName)
-				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig).WithRuntimeObjects(node, gwConfig, vmConfig).Build()
+				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig, gwConfig).WithRuntimeObjects(node, gwConfig, vmConfig).Build()
 				r = &GatewayVMConfigurationReconciler{Client: cl, AzureManager: az, Recorder: recorder}
 				_, err := r.Reconcile(context.TODO(), req)
 				Expect(err).NotTo(HaveOccurred())
@@ -1051,7 +2376,7 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 			It("should reconcile vmConfig if node has label but vmConfig does not have GatewayNodepoolName", func() {
 				node.Labels = map[string]string{"kubernetes.azure.com/agentpool": "testgw"}
 				vmConfig.Spec.GatewayNodepoolName = ""
-				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig).WithRuntimeObjects(node, gwConfig, vmConfig).Build()
+				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig, gwConfig).WithRuntimeObjects(node, gwConfig, vmConfig).Build()
 				r = &GatewayVMConfigurationReconciler{Client: cl, AzureManager: az, Recorder: recorder}
 				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
 				mockVMSSClient.EXPECT().Get(gomock.Any(), vmssRG, vmssName, gomock.Any()).Return(nil, errors.New("failed"))
@@ -1061,7 +2386,7 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 
 			It("should reconcile vmConfig if node has label and vmConfig has the same GatewayNodepoolName", func() {
 				node.Labels = map[string]string{"kubernetes.azure.com/agentpool": "testgw"}
-				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig).WithRuntimeObjects(node, gwConfig, vmConfig).Build()
+				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig, gwConfig).WithRuntimeObjects(node, gwConfig, vmConfig).Build()
 				r = &GatewayVMConfigurationReconciler{Client: cl, AzureManager: az, Recorder: recorder}
 				mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
 				mockVMSSClient.EXPECT().List(gomock.Any(), testRG).Return(nil, errors.New("failed"))
@@ -1071,7 +2396,7 @@ var _ = Describe("GatewayVMConfiguration controller unit tests", func() {
 
 			It("should not reconcile vmConfig is node has label but vmConfig has different GatewayNodepoolName", func() {
 				node.Labels = map[string]string{"kubernetes.azure.com/agentpool": "testgw1"}
-				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig).WithRuntimeObjects(node, gwConfig, vmConfig).Build()
+				cl = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithStatusSubresource(vmConfig, gwConfig).WithRuntimeObjects(node, gwConfig, vmConfig).Build()
 				r = &GatewayVMConfigurationReconciler{Client: cl, AzureManager: az, Recorder: recorder}
 				_, err := r.Reconcile(context.TODO(), req)
 				Expect(err).NotTo(HaveOccurred())
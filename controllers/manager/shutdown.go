@@ -0,0 +1,44 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// gracefulReconciler lets an in-flight reconcile complete for up to timeout once the manager is stopped. Controllers
+// cancel the reconcile context right away on shutdown, which would abort Azure operations half-applied, so the
+// wrapped reconciler gets a context cancelled only when the timeout expires after shutdown.
+type gracefulReconciler struct {
+	reconcile.Reconciler
+	timeout time.Duration
+}
+
+// withGracefulShutdown wraps r to drain on shutdown, it is returned as is when timeout is not positive
+func withGracefulShutdown(r reconcile.Reconciler, timeout time.Duration) reconcile.Reconciler {
+	if timeout <= 0 {
+		return r
+	}
+	return &gracefulReconciler{Reconciler: r, timeout: timeout}
+}
+
+func (r *gracefulReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	reconcileCtx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	defer cancel(nil)
+	stop := context.AfterFunc(ctx, func() {
+		log.FromContext(ctx).Info("Shutting down, waiting for in-flight reconcile to complete", "timeout", r.timeout)
+		timer := time.AfterFunc(r.timeout, func() {
+			cancel(fmt.Errorf("graceful shutdown timeout %s exceeded", r.timeout))
+		})
+		context.AfterFunc(reconcileCtx, func() { timer.Stop() })
+	})
+	defer stop()
+	return r.Reconciler.Reconcile(reconcileCtx, req)
+}
@@ -0,0 +1,45 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package manager
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("test graceful shutdown", func() {
+	It("should not wrap reconciler when timeout is not set", func() {
+		r := reconcile.Func(func(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+			return ctrl.Result{}, nil
+		})
+		Expect(withGracefulShutdown(r, 0)).To(BeAssignableToTypeOf(r))
+	})
+
+	It("should let in-flight reconcile complete after shutdown", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		r := withGracefulShutdown(reconcile.Func(func(reconcileCtx context.Context, req ctrl.Request) (ctrl.Result, error) {
+			cancel()
+			time.Sleep(50 * time.Millisecond)
+			return ctrl.Result{}, reconcileCtx.Err()
+		}), time.Minute)
+		_, err := r.Reconcile(ctx, ctrl.Request{})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should cancel in-flight reconcile when timeout expires after shutdown", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		r := withGracefulShutdown(reconcile.Func(func(reconcileCtx context.Context, req ctrl.Request) (ctrl.Result, error) {
+			Expect(reconcileCtx.Err()).NotTo(HaveOccurred())
+			cancel()
+			<-reconcileCtx.Done()
+			return ctrl.Result{}, context.Cause(reconcileCtx)
+		}), 10*time.Millisecond)
+		_, err := r.Reconcile(ctx, ctrl.Request{})
+		Expect(err).To(MatchError("graceful shutdown timeout 10ms exceeded"))
+	})
+})
@@ -6,19 +6,31 @@ package manager
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	coordinationv1 "k8s.io/api/coordination/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
@@ -28,16 +40,48 @@ import (
 
 	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
 	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/logger"
 	"github.com/Azure/kube-egress-gateway/pkg/metrics"
+	"github.com/Azure/kube-egress-gateway/pkg/tunnel"
+	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
 )
 
 var _ reconcile.Reconciler = &StaticGatewayConfigurationReconciler{}
 
+const (
+	publicIPPrefixResourceType  = "Microsoft.Network/publicIPPrefixes"
+	publicIPAddressResourceType = "Microsoft.Network/publicIPAddresses"
+	natGatewayResourceType      = "Microsoft.Network/natGateways"
+	// podEndpointGatewayIndex indexes PodEndpoints by <namespace>/<name> of the StaticGatewayConfiguration they use
+	podEndpointGatewayIndex = "spec.staticGatewayConfiguration"
+	// excludeCidrsConfigMapIndex indexes StaticGatewayConfigurations by <namespace>/<name> of their exclude CIDRs ConfigMap
+	excludeCidrsConfigMapIndex = "spec.excludeCidrsConfigMap"
+
+	// limits of azure resource tags
+	maxAzureTags           = 50
+	maxAzureTagNameLength  = 512
+	maxAzureTagValueLength = 256
+)
+
 // StaticGatewayConfigurationReconciler reconciles gateway loadBalancer according to a StaticGatewayConfiguration object
 type StaticGatewayConfigurationReconciler struct {
 	client.Client
 	SecretNamespace string
 	Recorder        record.EventRecorder
+	// WireguardKeyRotationInterval is the maximum age of gateway wireguard key pairs, 0 disables scheduled rotation
+	WireguardKeyRotationInterval time.Duration
+	// DryRun marks gateway configurations as evaluated only, Azure writes are skipped by the azure manager
+	DryRun bool
+	// MaxConcurrentReconciles is the maximum number of StaticGatewayConfigurations reconciled at the same time
+	MaxConcurrentReconciles int
+	// GracefulShutdownTimeout is how long in-flight reconciles may run after the manager is stopped before their
+	// context is cancelled, 0 cancels them right away
+	GracefulShutdownTimeout time.Duration
+	// TunnelCidr is the subnet addressing the gateway side of pod tunnels, gateways are marked with a conflict
+	// condition when PodCidrs overlap it, nil skips the check
+	TunnelCidr *net.IPNet
+	// PodCidrs are the cluster pod CIDRs
+	PodCidrs []*net.IPNet
 }
 
 //+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
@@ -46,6 +90,11 @@ type StaticGatewayConfigurationReconciler struct {
 //+kubebuilder:rbac:groups=egressgateway.kubernetes.azure.com,resources=staticgatewayconfigurations/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=egressgateway.kubernetes.azure.com,resources=gatewaylbconfigurations,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=egressgateway.kubernetes.azure.com,resources=gatewaylbconfigurations/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=egressgateway.kubernetes.azure.com,resources=podendpoints,verbs=get;list;watch
+//+kubebuilder:rbac:groups=egressgateway.kubernetes.azure.com,resources=gatewaystatuses,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups=coordination.k8s.io,namespace=kube-egress-gateway-system,resources=leases,verbs=deletecollection
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -62,13 +111,14 @@ func (r *StaticGatewayConfigurationReconciler) Reconcile(ctx context.Context, re
 		log.Error(err, "unable to fetch StaticGatewayConfiguration instance")
 		return ctrl.Result{}, err
 	}
+	ctx = logger.WithGateway(ctx, gwConfig)
 
 	if !gwConfig.ObjectMeta.DeletionTimestamp.IsZero() {
 		// Clean up staticGatewayConfiguration
 		return ctrl.Result{}, r.ensureDeleted(ctx, gwConfig)
 	}
 
-	return ctrl.Result{}, r.reconcile(ctx, gwConfig)
+	return r.reconcile(ctx, gwConfig)
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -88,12 +138,114 @@ func (r *StaticGatewayConfigurationReconciler) SetupWithManager(mgr ctrl.Manager
 			return false
 		},
 	}
+	podEndpointPredicate := predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			// connected pods only change when PodEndpoint switches gateway
+			oldPodEndpoint, ok1 := e.ObjectOld.(*egressgatewayv1alpha1.PodEndpoint)
+			newPodEndpoint, ok2 := e.ObjectNew.(*egressgatewayv1alpha1.PodEndpoint)
+			return ok1 && ok2 && oldPodEndpoint.GetStaticGatewayConfigurationKey() != newPodEndpoint.GetStaticGatewayConfigurationKey()
+		},
+	}
+	gatewayStatusPredicate := predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			// gateway endpoints only change when gateways are configured on the node or the node is taken out
+			oldGwStatus, ok1 := e.ObjectOld.(*egressgatewayv1alpha1.GatewayStatus)
+			newGwStatus, ok2 := e.ObjectNew.(*egressgatewayv1alpha1.GatewayStatus)
+			return ok1 && ok2 && (oldGwStatus.Spec.Draining != newGwStatus.Spec.Draining ||
+				oldGwStatus.Spec.Quarantined != newGwStatus.Spec.Quarantined ||
+				!slices.EqualFunc(oldGwStatus.Spec.ReadyGatewayConfigurations, newGwStatus.Spec.ReadyGatewayConfigurations, func(a, b egressgatewayv1alpha1.GatewayConfiguration) bool {
+					return a.StaticGatewayConfiguration == b.StaticGatewayConfiguration
+				}))
+		},
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.TODO(), &egressgatewayv1alpha1.PodEndpoint{}, podEndpointGatewayIndex, podEndpointGatewayIndexFunc); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.TODO(), &egressgatewayv1alpha1.StaticGatewayConfiguration{}, excludeCidrsConfigMapIndex, excludeCidrsConfigMapIndexFunc); err != nil {
+		return err
+	}
+	// pods connecting and disconnecting only change connected pods in status, which is updated by a separate
+	// controller without reconciling the gateway resources in Azure
+	if err := ctrl.NewControllerManagedBy(mgr).
+		Named("staticgatewayconfiguration-connectedpods").
+		Watches(&egressgatewayv1alpha1.PodEndpoint{}, enqueueSGCFromPodEndpoint(), builder.WithPredicates(podEndpointPredicate)).
+		Complete(reconcile.Func(r.reconcileConnectedPodsStatus)); err != nil {
+		return err
+	}
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&egressgatewayv1alpha1.StaticGatewayConfiguration{}).
+		// status is written by other controllers too, e.g. the Azure sync status by the GatewayVMConfiguration
+		// controller, only spec and annotation changes need the gateway to be reconciled
+		For(&egressgatewayv1alpha1.StaticGatewayConfiguration{}, builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}))).
 		Owns(&egressgatewayv1alpha1.GatewayLBConfiguration{}).
 		// generated secrets created in the dedicated namespace
 		Watches(&corev1.Secret{}, enqueueOwningSGCFromLabels(), builder.WithPredicates(secretPredicate)).
-		Complete(r)
+		Watches(&egressgatewayv1alpha1.GatewayStatus{}, enqueueSGCsFromGatewayStatus(), builder.WithPredicates(gatewayStatusPredicate)).
+		// the manager cache only holds ConfigMaps labeled for exclude CIDRs
+		Watches(&corev1.ConfigMap{}, r.enqueueSGCsFromExcludeCidrsConfigMap(), builder.WithPredicates(excludeCidrsConfigMapPredicate)).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Complete(withGracefulShutdown(r, r.GracefulShutdownTimeout))
+}
+
+func podEndpointGatewayIndexFunc(o client.Object) []string {
+	podEndpoint, ok := o.(*egressgatewayv1alpha1.PodEndpoint)
+	if !ok || podEndpoint.Spec.StaticGatewayConfiguration == "" {
+		return nil
+	}
+	return []string{podEndpoint.GetStaticGatewayConfigurationKey().String()}
+}
+
+var excludeCidrsConfigMapPredicate = predicate.NewPredicateFuncs(func(o client.Object) bool {
+	return o.GetLabels()[consts.ExcludeCidrsConfigMapLabel] == "true"
+})
+
+func excludeCidrsConfigMapIndexFunc(o client.Object) []string {
+	gwConfig, ok := o.(*egressgatewayv1alpha1.StaticGatewayConfiguration)
+	if !ok || gwConfig.Spec.ExcludeCidrsConfigMap == nil {
+		return nil
+	}
+	return []string{types.NamespacedName{Namespace: gwConfig.Namespace, Name: gwConfig.Spec.ExcludeCidrsConfigMap.Name}.String()}
+}
+
+func (r *StaticGatewayConfigurationReconciler) enqueueSGCsFromExcludeCidrsConfigMap() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, o client.Object) []reconcile.Request {
+		gwConfigList := &egressgatewayv1alpha1.StaticGatewayConfigurationList{}
+		configMapKey := types.NamespacedName{Namespace: o.GetNamespace(), Name: o.GetName()}
+		if err := r.List(ctx, gwConfigList, client.MatchingFields{excludeCidrsConfigMapIndex: configMapKey.String()}); err != nil {
+			log.FromContext(ctx).Error(err, "failed to list StaticGatewayConfigurations referencing ConfigMap", "configMap", configMapKey)
+			return nil
+		}
+		var requests []reconcile.Request
+		for _, gwConfig := range gwConfigList.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&gwConfig)})
+		}
+		return requests
+	})
+}
+
+func enqueueSGCFromPodEndpoint() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(_ context.Context, o client.Object) []reconcile.Request {
+		podEndpoint, ok := o.(*egressgatewayv1alpha1.PodEndpoint)
+		if !ok || podEndpoint.Spec.StaticGatewayConfiguration == "" {
+			return nil
+		}
+		return []reconcile.Request{{NamespacedName: podEndpoint.GetStaticGatewayConfigurationKey()}}
+	})
+}
+
+func enqueueSGCsFromGatewayStatus() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(_ context.Context, o client.Object) []reconcile.Request {
+		gwStatus, ok := o.(*egressgatewayv1alpha1.GatewayStatus)
+		if !ok {
+			return nil
+		}
+		var requests []reconcile.Request
+		for _, config := range gwStatus.Spec.ReadyGatewayConfigurations {
+			if namespace, name, found := strings.Cut(config.StaticGatewayConfiguration, "/"); found {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKey{Namespace: namespace, Name: name}})
+			}
+		}
+		return requests
+	})
 }
 
 func enqueueOwningSGCFromLabels() handler.EventHandler {
@@ -124,7 +276,7 @@ func enqueueOwningSGCFromLabels() handler.EventHandler {
 func (r *StaticGatewayConfigurationReconciler) reconcile(
 	ctx context.Context,
 	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
-) error {
+) (_ ctrl.Result, rerr error) {
 	log := log.FromContext(ctx)
 	log.Info(fmt.Sprintf("Reconciling staticGatewayConfiguration %s/%s", gwConfig.Namespace, gwConfig.Name))
 
@@ -136,10 +288,13 @@ func (r *StaticGatewayConfigurationReconciler) reconcile(
 		strings.ToLower(fmt.Sprintf("%s/%s", gwConfig.Namespace, gwConfig.Name)),
 	) // no subscription_id/resource_group for SGC reconciler
 	succeeded := false
-	defer func() { mc.ObserveControllerReconcileMetrics(succeeded) }()
+	defer func() {
+		mc.ObserveControllerReconcileMetrics(succeeded)
+		mc.ObserveControllerReconcileError(rerr)
+	}()
 
 	if err := validate(gwConfig); err != nil {
-		return err
+		return ctrl.Result{}, err
 	}
 
 	if !controllerutil.ContainsFinalizer(gwConfig, consts.SGCFinalizerName) {
@@ -148,13 +303,41 @@ func (r *StaticGatewayConfigurationReconciler) reconcile(
 		err := r.Update(ctx, gwConfig)
 		if err != nil {
 			log.Error(err, "failed to add finalizer")
-			return err
+			return ctrl.Result{}, err
+		}
+	}
+
+	if isReconcilePaused(gwConfig) {
+		// leave the gateway LB configuration, and so Azure resources, as they are until unpaused
+		log.Info("Reconciliation is paused")
+		_, err := controllerutil.CreateOrPatch(ctx, r, gwConfig, func() error {
+			reconcilePausedCondition(gwConfig)
+			return nil
+		})
+		succeeded = err == nil
+		return ctrl.Result{}, err
+	}
+
+	if request := gwConfig.Annotations[consts.SGCForceReprovisionAnnotation]; request != "" &&
+		request != gwConfig.Annotations[consts.SGCForceReprovisionHandledAnnotation] {
+		tornDown, err := r.tearDownForReprovision(ctx, gwConfig, request)
+		if err != nil {
+			log.Error(err, "failed to tear down gateway for reprovision")
+			r.Recorder.Event(gwConfig, corev1.EventTypeWarning, "ReprovisionError", err.Error())
+			return ctrl.Result{}, err
+		}
+		if !tornDown {
+			// requeued when the gateway LB configuration is gone
+			succeeded = true
+			return ctrl.Result{}, nil
 		}
 	}
 
+	var nextKeyRotation time.Duration
 	_, err := controllerutil.CreateOrPatch(ctx, r, gwConfig, func() error {
 		// reconcile wireguard keypair
-		if err := r.reconcileWireguardKey(ctx, gwConfig); err != nil {
+		var err error
+		if nextKeyRotation, err = r.reconcileWireguardKey(ctx, gwConfig); err != nil {
 			log.Error(err, "failed to reconcile wireguard key")
 			r.Recorder.Event(gwConfig, corev1.EventTypeWarning, "ReconcileError", err.Error())
 			return err
@@ -167,6 +350,26 @@ func (r *StaticGatewayConfigurationReconciler) reconcile(
 			return err
 		}
 
+		// reconcile connected pods count in status
+		if err := r.reconcileConnectedPods(ctx, gwConfig); err != nil {
+			log.Error(err, "failed to reconcile connected pods")
+			return err
+		}
+
+		if err := r.reconcileGatewayEndpoints(ctx, gwConfig); err != nil {
+			log.Error(err, "failed to reconcile gateway endpoints")
+			return err
+		}
+
+		if err := r.reconcileExcludeCidrsConfigMap(ctx, gwConfig); err != nil {
+			log.Error(err, "failed to reconcile exclude CIDRs ConfigMap")
+			return err
+		}
+		reconcileFullCondition(gwConfig)
+		r.reconcileTunnelCidrConflictCondition(gwConfig)
+
+		r.reconcileDryRunCondition(gwConfig)
+		reconcilePausedCondition(gwConfig)
 		return nil
 	})
 
@@ -177,13 +380,56 @@ func (r *StaticGatewayConfigurationReconciler) reconcile(
 	r.Recorder.Eventf(gwConfig, corev1.EventTypeNormal, reconcileStatus, "StaticGatewayConfiguration provisioned with egress prefix %s", prefix)
 	log.Info("staticGatewayConfiguration reconciled")
 	succeeded = true
-	return err
+	return ctrl.Result{RequeueAfter: nextKeyRotation}, err
+}
+
+// tearDownForReprovision deletes the gateway LB configuration, whose finalizers remove lb rules, vmss ip
+// configurations and managed public ip prefixes of the gateway in Azure, and waits until it is gone. The handled
+// request is then recorded so that the gateway is rebuilt from scratch by the rest of the reconcile, and only once
+// per request. Returns whether the gateway is torn down.
+func (r *StaticGatewayConfigurationReconciler) tearDownForReprovision(
+	ctx context.Context,
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+	request string,
+) (bool, error) {
+	log := log.FromContext(ctx)
+	lbConfig := &egressgatewayv1alpha1.GatewayLBConfiguration{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(gwConfig), lbConfig); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return false, err
+		}
+		log.Info("Gateway is torn down, rebuilding", "request", request)
+		// status of removed resources is not reported by the new gateway LB configuration until provisioned
+		gwConfig.Status.Ip, gwConfig.Status.Port, gwConfig.Status.Endpoint = "", 0, ""
+		gwConfig.Status.GatewayEndpoints = nil
+		gwConfig.Status.EgressIpPrefix, gwConfig.Status.EgressIpv6Prefix = "", ""
+		gwConfig.Status.PublicIpPrefixReused = false
+		gwConfig.Status.GatewayInstances = 0
+		gwConfig.Status.GatewayNodes = nil
+		if err := r.Status().Update(ctx, gwConfig); err != nil {
+			return false, err
+		}
+		gwConfig.Annotations[consts.SGCForceReprovisionHandledAnnotation] = request
+		if err := r.Update(ctx, gwConfig); err != nil {
+			return false, err
+		}
+		r.Recorder.Eventf(gwConfig, corev1.EventTypeNormal, "Reprovisioning", "Azure resources are removed, rebuilding for request %s", request)
+		return true, nil
+	}
+	if lbConfig.DeletionTimestamp.IsZero() {
+		log.Info("Tearing down gateway for reprovision", "request", request)
+		r.Recorder.Eventf(gwConfig, corev1.EventTypeNormal, "Reprovisioning", "Removing Azure resources for request %s", request)
+		if err := r.Delete(ctx, lbConfig); err != nil {
+			return false, client.IgnoreNotFound(err)
+		}
+	}
+	return false, nil
 }
 
 func (r *StaticGatewayConfigurationReconciler) ensureDeleted(
 	ctx context.Context,
 	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
-) error {
+) (rerr error) {
 	log := log.FromContext(ctx)
 	log.Info(fmt.Sprintf("Reconciling staticGatewayConfiguration deletion %s/%s", gwConfig.Namespace, gwConfig.Name))
 
@@ -200,7 +446,10 @@ func (r *StaticGatewayConfigurationReconciler) ensureDeleted(
 		strings.ToLower(fmt.Sprintf("%s/%s", gwConfig.Namespace, gwConfig.Name)),
 	) // no subscription_id/resource_group for SGC reconciler
 	succeeded := false
-	defer func() { mc.ObserveControllerReconcileMetrics(succeeded) }()
+	defer func() {
+		mc.ObserveControllerReconcileMetrics(succeeded)
+		mc.ObserveControllerReconcileError(rerr)
+	}()
 
 	secretDeleted := false
 	log.Info("Deleting wireguard key")
@@ -236,6 +485,17 @@ func (r *StaticGatewayConfigurationReconciler) ensureDeleted(
 		}
 	}
 
+	log.Info("Deleting egress source IP leases")
+	if err := r.DeleteAllOf(
+		ctx,
+		&coordinationv1.Lease{},
+		client.InNamespace(os.Getenv(consts.PodNamespaceEnvKey)),
+		client.MatchingLabels{consts.OwningSGCUIDLabel: string(gwConfig.UID)},
+	); err != nil {
+		log.Error(err, "failed to delete egress source IP leases")
+		return err
+	}
+
 	if secretDeleted && lbConfigDeleted {
 		log.Info("Secret and LBConfig are deleted, removing finalizer")
 		controllerutil.RemoveFinalizer(gwConfig, consts.SGCFinalizerName)
@@ -251,6 +511,10 @@ func (r *StaticGatewayConfigurationReconciler) ensureDeleted(
 }
 
 func validate(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) error {
+	return toInvalidError(gwConfig, validateSpec(gwConfig))
+}
+
+func validateSpec(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) field.ErrorList {
 	// need to validate either GatewayNodepoolName or GatewayVmssProfile is provided, but not both
 	var allErrs field.ErrorList
 
@@ -267,20 +531,28 @@ func validate(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) error
 	}
 
 	if !vmssProfileIsEmpty(gwConfig) {
-		if gwConfig.Spec.GatewayVmssProfile.VmssResourceGroup == "" {
-			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("gatewayvmssprofile").Child("vmssresourcegroup"),
-				gwConfig.Spec.GatewayVmssProfile.VmssResourceGroup,
-				"Gateway vmss resource group is empty"))
-		}
-		if gwConfig.Spec.GatewayVmssProfile.VmssName == "" {
-			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("gatewayvmssprofile").Child("vmssname"),
-				gwConfig.Spec.GatewayVmssProfile.VmssName,
-				"Gateway vmss name is empty"))
+		if len(gwConfig.Spec.GatewayVmssProfile.Vmsses) > 0 {
+			allErrs = append(allErrs, validateVmssReferences(gwConfig.Spec.GatewayVmssProfile)...)
+		} else {
+			if gwConfig.Spec.GatewayVmssProfile.VmssResourceGroup == "" {
+				allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("gatewayvmssprofile").Child("vmssresourcegroup"),
+					gwConfig.Spec.GatewayVmssProfile.VmssResourceGroup,
+					"Gateway vmss resource group is empty"))
+			}
+			if gwConfig.Spec.GatewayVmssProfile.VmssName == "" {
+				allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("gatewayvmssprofile").Child("vmssname"),
+					gwConfig.Spec.GatewayVmssProfile.VmssName,
+					"Gateway vmss name is empty"))
+			}
 		}
-		if gwConfig.Spec.GatewayVmssProfile.PublicIpPrefixSize < 0 || gwConfig.Spec.GatewayVmssProfile.PublicIpPrefixSize > 31 {
+		allErrs = append(allErrs, validateGatewaySubscription(gwConfig.Spec.GatewayVmssProfile)...)
+		// size of a provided public ip prefix is read from Azure when not specified, a provided public ip address
+		// has none
+		prefixSizeOptional := (gwConfig.Spec.PublicIpPrefixId != "" || gwConfig.Spec.PublicIpAddressId != "") && gwConfig.Spec.GatewayVmssProfile.PublicIpPrefixSize == 0
+		if !prefixSizeOptional && (gwConfig.Spec.GatewayVmssProfile.PublicIpPrefixSize < consts.MinPublicIpPrefixSize || gwConfig.Spec.GatewayVmssProfile.PublicIpPrefixSize > consts.MaxPublicIpPrefixSize) {
 			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("gatewayvmssprofile").Child("publicipprefixsize"),
 				gwConfig.Spec.GatewayVmssProfile.PublicIpPrefixSize,
-				"Gateway vmss public ip prefix size should be between 0 and 31 inclusively"))
+				fmt.Sprintf("Gateway vmss public ip prefix size should be between %d and %d inclusively", consts.MinPublicIpPrefixSize, consts.MaxPublicIpPrefixSize)))
 		}
 	}
 
@@ -290,6 +562,501 @@ func validate(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) error
 			"PublicIpPrefixId should be empty when ProvisionPublicIps is false"))
 	}
 
+	if gwConfig.Spec.PublicIpPrefixId != "" {
+		if resourceID, err := arm.ParseResourceID(gwConfig.Spec.PublicIpPrefixId); err != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("publicipprefixid"),
+				gwConfig.Spec.PublicIpPrefixId,
+				fmt.Sprintf("PublicIpPrefixId is not a valid Azure resource ID: %v", err)))
+		} else if !strings.EqualFold(resourceID.ResourceType.String(), publicIPPrefixResourceType) {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("publicipprefixid"),
+				gwConfig.Spec.PublicIpPrefixId,
+				fmt.Sprintf("PublicIpPrefixId should be the resource ID of a %s, got %s", publicIPPrefixResourceType, resourceID.ResourceType.String())))
+		}
+	}
+
+	if gwConfig.Spec.PublicIpPrefixCount < 0 || gwConfig.Spec.PublicIpPrefixCount > consts.MaxPublicIpPrefixCount {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("publicipprefixcount"),
+			gwConfig.Spec.PublicIpPrefixCount,
+			fmt.Sprintf("PublicIpPrefixCount should be between 0 and %d inclusively, 0 provisions a single prefix like 1", consts.MaxPublicIpPrefixCount)))
+	} else if gwConfig.Spec.PublicIpPrefixCount > 1 && (!gwConfig.Spec.ProvisionPublicIps || gwConfig.Spec.PublicIpPrefixId != "") {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("publicipprefixcount"),
+			gwConfig.Spec.PublicIpPrefixCount,
+			"PublicIpPrefixCount can only be larger than 1 when ProvisionPublicIps is true and PublicIpPrefixId is empty"))
+	}
+
+	if gwConfig.Spec.ReusePublicIpPrefix && (!gwConfig.Spec.ProvisionPublicIps || gwConfig.Spec.PublicIpPrefixId != "") {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("reusepublicipprefix"),
+			gwConfig.Spec.ReusePublicIpPrefix,
+			"ReusePublicIpPrefix can only be set when ProvisionPublicIps is true and PublicIpPrefixId is empty"))
+	}
+
+	if gwConfig.Spec.NatGatewayId != "" {
+		if resourceID, err := arm.ParseResourceID(gwConfig.Spec.NatGatewayId); err != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("natgatewayid"),
+				gwConfig.Spec.NatGatewayId,
+				fmt.Sprintf("NatGatewayId is not a valid Azure resource ID: %v", err)))
+		} else if !strings.EqualFold(resourceID.ResourceType.String(), natGatewayResourceType) {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("natgatewayid"),
+				gwConfig.Spec.NatGatewayId,
+				fmt.Sprintf("NatGatewayId should be the resource ID of a %s, got %s", natGatewayResourceType, resourceID.ResourceType.String())))
+		}
+		if !gwConfig.Spec.ProvisionPublicIps {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("natgatewayid"),
+				gwConfig.Spec.NatGatewayId,
+				"NatGatewayId should be empty when ProvisionPublicIps is false"))
+		}
+		if gwConfig.Spec.PublicIpPrefixCount > 1 {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("natgatewayid"),
+				gwConfig.Spec.NatGatewayId,
+				"NatGatewayId cannot be combined with PublicIpPrefixCount larger than 1"))
+		}
+		// NAT gateway only supports IPv4 public IPs
+		if gwConfig.Spec.EnableIPv6 {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("natgatewayid"),
+				gwConfig.Spec.NatGatewayId,
+				"NatGatewayId cannot be combined with EnableIPv6"))
+		}
+	}
+
+	if gwConfig.Spec.PublicIpAddressId != "" {
+		if resourceID, err := arm.ParseResourceID(gwConfig.Spec.PublicIpAddressId); err != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("publicipaddressid"),
+				gwConfig.Spec.PublicIpAddressId,
+				fmt.Sprintf("PublicIpAddressId is not a valid Azure resource ID: %v", err)))
+		} else if !strings.EqualFold(resourceID.ResourceType.String(), publicIPAddressResourceType) {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("publicipaddressid"),
+				gwConfig.Spec.PublicIpAddressId,
+				fmt.Sprintf("PublicIpAddressId should be the resource ID of a %s, got %s", publicIPAddressResourceType, resourceID.ResourceType.String())))
+		}
+		// only a NAT gateway egresses with a single public ip address for all gateway nodes
+		if gwConfig.Spec.NatGatewayId == "" {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("publicipaddressid"),
+				gwConfig.Spec.PublicIpAddressId,
+				"PublicIpAddressId can only be set when NatGatewayId is set"))
+		}
+		if gwConfig.Spec.PublicIpPrefixId != "" || gwConfig.Spec.ReusePublicIpPrefix {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("publicipaddressid"),
+				gwConfig.Spec.PublicIpAddressId,
+				"PublicIpAddressId cannot be combined with PublicIpPrefixId or ReusePublicIpPrefix"))
+		}
+	}
+
+	if gwConfig.Spec.OutboundIdleTimeoutMinutes != 0 {
+		if gwConfig.Spec.OutboundIdleTimeoutMinutes < consts.DefaultOutboundIdleTimeoutMinutes || gwConfig.Spec.OutboundIdleTimeoutMinutes > consts.MaxOutboundIdleTimeoutMinutes {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("outboundidletimeoutminutes"),
+				gwConfig.Spec.OutboundIdleTimeoutMinutes,
+				fmt.Sprintf("OutboundIdleTimeoutMinutes should be between %d and %d inclusively", consts.DefaultOutboundIdleTimeoutMinutes, consts.MaxOutboundIdleTimeoutMinutes)))
+		}
+		// idle timeout of a BYO NAT gateway is managed by its owner
+		if !gwConfig.Spec.ProvisionPublicIps || gwConfig.Spec.NatGatewayId != "" {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("outboundidletimeoutminutes"),
+				gwConfig.Spec.OutboundIdleTimeoutMinutes,
+				"OutboundIdleTimeoutMinutes can only be set when ProvisionPublicIps is true and NatGatewayId is empty"))
+		}
+	}
+
+	if gwConfig.Spec.Mtu != 0 && (gwConfig.Spec.Mtu < consts.MinWireguardMtu || gwConfig.Spec.Mtu > consts.DefaultWireguardMtu) {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("mtu"),
+			gwConfig.Spec.Mtu,
+			fmt.Sprintf("Mtu should be between %d and %d inclusively", consts.MinWireguardMtu, consts.DefaultWireguardMtu)))
+	}
+
+	if gwConfig.Spec.WireguardPort != 0 && (gwConfig.Spec.WireguardPort < consts.WireguardPortStart || gwConfig.Spec.WireguardPort >= consts.WireguardPortEnd) {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("wireguardport"),
+			gwConfig.Spec.WireguardPort,
+			fmt.Sprintf("WireguardPort should be between %d and %d inclusively", consts.WireguardPortStart, consts.WireguardPortEnd-1)))
+	}
+
+	if seconds := to.Val(gwConfig.Spec.PersistentKeepaliveSeconds); seconds < 0 || seconds > consts.MaxPersistentKeepaliveSeconds {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("persistentkeepaliveseconds"),
+			seconds,
+			fmt.Sprintf("PersistentKeepaliveSeconds should be between 0 and %d inclusively", consts.MaxPersistentKeepaliveSeconds)))
+	}
+
+	if gwConfig.Spec.RoutePriority != 0 && (gwConfig.Spec.RoutePriority < consts.MinGatewayRoutePriority || gwConfig.Spec.RoutePriority > consts.MaxGatewayRoutePriority) {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("routepriority"),
+			gwConfig.Spec.RoutePriority,
+			fmt.Sprintf("RoutePriority should be between %d and %d inclusively", consts.MinGatewayRoutePriority, consts.MaxGatewayRoutePriority)))
+	}
+
+	if !gwConfig.Spec.ProvisionPublicIps && gwConfig.Spec.EnableIPv6 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("enableipv6"),
+			gwConfig.Spec.EnableIPv6,
+			"EnableIPv6 should be false when ProvisionPublicIps is false"))
+	}
+
+	allErrs = append(allErrs, validateTags(field.NewPath("spec").Child("tags"), gwConfig.Spec.Tags)...)
+	allErrs = append(allErrs, validateCidrs(field.NewPath("spec").Child("excludecidrs"), "ExcludeCidrs", gwConfig.Spec.ExcludeCidrs)...)
+	allErrs = append(allErrs, validateCidrs(field.NewPath("spec").Child("includecidrs"), "IncludeCidrs", gwConfig.Spec.IncludeCidrs)...)
+	if len(gwConfig.Spec.IncludeCidrs) > 0 && gwConfig.Spec.DefaultRoute != egressgatewayv1alpha1.RouteAzureNetworking {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("includecidrs"),
+			gwConfig.Spec.IncludeCidrs,
+			"IncludeCidrs can only be set when DefaultRoute is azureNetworking, all traffic is routed to the gateway otherwise"))
+	}
+	allErrs = append(allErrs, validateIncludeNotExcluded(gwConfig)...)
+	allErrs = append(allErrs, validateGatewayDNS(gwConfig)...)
+	allErrs = append(allErrs, validatePeerEndpointIP(gwConfig)...)
+	allErrs = append(allErrs, validateTrafficMirror(gwConfig)...)
+	allErrs = append(allErrs, validateWireguardFwMark(gwConfig)...)
+	allErrs = append(allErrs, validateTunnelIPVersions(gwConfig)...)
+	allErrs = append(allErrs, validateCidrs(field.NewPath("spec").Child("preservesourceipcidrs"), "PreserveSourceIpCidrs", gwConfig.Spec.PreserveSourceIpCidrs)...)
+	allErrs = append(allErrs, validatePreserveSourceIPCidrs(gwConfig)...)
+	allErrs = append(allErrs, validateCidrs(field.NewPath("spec").Child("privatecidrs"), "PrivateCidrs", gwConfig.Spec.PrivateCidrs)...)
+	allErrs = append(allErrs, validatePrivateCidrs(gwConfig)...)
+	if !gwConfig.Spec.EnableIPv6 {
+		for i, cidr := range gwConfig.Spec.IncludeCidrs {
+			if _, ipNet, err := net.ParseCIDR(cidr); err == nil && ipNet.IP.To4() == nil {
+				allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("includecidrs").Index(i),
+					cidr,
+					"IncludeCidrs should not contain IPv6 CIDRs when EnableIPv6 is false"))
+			}
+		}
+	}
+
+	allErrs = append(allErrs, validateDestinationPorts(field.NewPath("spec").Child("alloweddestinationports"), "AllowedDestinationPorts", gwConfig.Spec.AllowedDestinationPorts)...)
+	allErrs = append(allErrs, validateDestinationPorts(field.NewPath("spec").Child("denieddestinationports"), "DeniedDestinationPorts", gwConfig.Spec.DeniedDestinationPorts)...)
+	if len(gwConfig.Spec.AllowedDestinationPorts) > 0 && len(gwConfig.Spec.DeniedDestinationPorts) > 0 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("denieddestinationports"),
+			gwConfig.Spec.DeniedDestinationPorts,
+			"DeniedDestinationPorts cannot be combined with AllowedDestinationPorts"))
+	}
+
+	for i, fqdn := range gwConfig.Spec.ExcludeFQDNs {
+		if errs := validation.IsDNS1123Subdomain(fqdn); len(errs) > 0 {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("excludefqdns").Index(i),
+				fqdn,
+				strings.Join(errs, ", ")))
+		}
+	}
+
+	for i, namespace := range gwConfig.Spec.AllowedNamespaces {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("allowednamespaces").Index(i),
+				namespace,
+				strings.Join(errs, ", ")))
+		}
+	}
+
+	return allErrs
+}
+
+// validateTunnelIPVersions checks that tunneled IP versions are provisioned by the gateway, and that settings routing
+// traffic to the gateway only use tunneled IP versions
+func validateTunnelIPVersions(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if len(gwConfig.Spec.TunnelIPVersions) == 0 {
+		return allErrs
+	}
+	path := field.NewPath("spec").Child("tunnelipversions")
+	if slices.Contains(gwConfig.Spec.TunnelIPVersions, egressgatewayv1alpha1.IPv6) && !gwConfig.Spec.EnableIPv6 {
+		allErrs = append(allErrs, field.Invalid(path, gwConfig.Spec.TunnelIPVersions,
+			"TunnelIPVersions should not contain IPv6 when EnableIPv6 is false"))
+	}
+	if gwConfig.BypassesIPVersion(egressgatewayv1alpha1.IPv4) && gwConfig.Spec.GatewayDNS != "" {
+		allErrs = append(allErrs, field.Invalid(path, gwConfig.Spec.TunnelIPVersions,
+			"TunnelIPVersions should contain IPv4 when GatewayDNS is set"))
+	}
+	for i, cidr := range slices.Concat(gwConfig.Spec.IncludeCidrs, gwConfig.Spec.PrivateCidrs) {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		version := egressgatewayv1alpha1.IPv4
+		if ipNet.IP.To4() == nil {
+			version = egressgatewayv1alpha1.IPv6
+		}
+		if gwConfig.BypassesIPVersion(version) {
+			fieldPath := field.NewPath("spec").Child("includecidrs").Index(i)
+			if i >= len(gwConfig.Spec.IncludeCidrs) {
+				fieldPath = field.NewPath("spec").Child("privatecidrs").Index(i - len(gwConfig.Spec.IncludeCidrs))
+			}
+			allErrs = append(allErrs, field.Invalid(fieldPath, cidr,
+				fmt.Sprintf("CIDRs routed to the gateway should not be %s when TunnelIPVersions does not contain it", version)))
+		}
+	}
+	return allErrs
+}
+
+// validateDestinationPorts checks that each entry is a port or a "<from>-<to>" port range
+func validateDestinationPorts(path *field.Path, fieldName string, ports []string) field.ErrorList {
+	allErrs := field.ErrorList{}
+	seen := make(map[string]bool)
+	for i, port := range ports {
+		from, to, isRange := strings.Cut(port, "-")
+		if !isRange {
+			to = from
+		}
+		fromPort, fromErr := strconv.ParseUint(from, 10, 16)
+		toPort, toErr := strconv.ParseUint(to, 10, 16)
+		if fromErr != nil || toErr != nil || fromPort == 0 || fromPort > toPort {
+			allErrs = append(allErrs, field.Invalid(path.Index(i), port,
+				fmt.Sprintf("%s should contain ports or port ranges like 8000-8080 between 1 and 65535", fieldName)))
+			continue
+		}
+		if seen[port] {
+			allErrs = append(allErrs, field.Duplicate(path.Index(i), port))
+		}
+		seen[port] = true
+	}
+	return allErrs
+}
+
+// validateGatewayDNS checks that the gateway DNS resolver is an IPv4 address, pods route it to the gateway even when
+// it is in ExcludeCidrs
+func validateGatewayDNS(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) field.ErrorList {
+	var allErrs field.ErrorList
+	if gwConfig.Spec.GatewayDNS == "" {
+		return allErrs
+	}
+	path := field.NewPath("spec").Child("gatewaydns")
+	ip := net.ParseIP(gwConfig.Spec.GatewayDNS)
+	if ip == nil || ip.To4() == nil {
+		return append(allErrs, field.Invalid(path, gwConfig.Spec.GatewayDNS, "GatewayDNS should be a valid IPv4 address"))
+	}
+	return allErrs
+}
+
+// validateTrafficMirror checks that traffic mirroring has exactly one target and a sample rate the daemon can match
+func validateTrafficMirror(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) field.ErrorList {
+	var allErrs field.ErrorList
+	mirror := gwConfig.Spec.TrafficMirror
+	if mirror == nil {
+		return allErrs
+	}
+	path := field.NewPath("spec").Child("trafficmirror")
+	if (mirror.TargetInterface == "") == (mirror.Vxlan == nil) {
+		allErrs = append(allErrs, field.Invalid(path, mirror,
+			"exactly one of TrafficMirror.TargetInterface and TrafficMirror.Vxlan should be specified"))
+	}
+	if mirror.Vxlan != nil {
+		if ip := net.ParseIP(mirror.Vxlan.CollectorIp); ip == nil || ip.To4() == nil {
+			allErrs = append(allErrs, field.Invalid(path.Child("vxlan").Child("collectorip"), mirror.Vxlan.CollectorIp,
+				"TrafficMirror.Vxlan.CollectorIp should be a valid IPv4 address"))
+		}
+	}
+	// packets are sampled by masking the low bits of the IPv4 identification field
+	if mirror.SampleRate&(mirror.SampleRate-1) != 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("samplerate"), mirror.SampleRate,
+			"TrafficMirror.SampleRate should be a power of 2"))
+	}
+	return allErrs
+}
+
+// validateWireguardFwMark checks that the wireguard fwmark does not collide with packet marks set by the daemon, and
+// that its route table is neither the gateway route table nor a reserved one
+func validateWireguardFwMark(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) field.ErrorList {
+	var allErrs field.ErrorList
+	fwMark := gwConfig.Spec.WireguardFwMark
+	if fwMark == nil {
+		return allErrs
+	}
+	path := field.NewPath("spec").Child("wireguardfwmark")
+	// connections of each gateway are marked with its wireguard port, pod traffic from eth0 with Eth0Mark
+	if fwMark.Mark >= consts.WireguardPortStart && fwMark.Mark < consts.WireguardPortEnd {
+		allErrs = append(allErrs, field.Invalid(path.Child("mark"), fwMark.Mark,
+			fmt.Sprintf("WireguardFwMark.Mark should not be between %d and %d, which are used by the daemon as gateway connection marks",
+				consts.WireguardPortStart, consts.WireguardPortEnd-1)))
+	}
+	if fwMark.Mark == int32(consts.Eth0Mark) {
+		allErrs = append(allErrs, field.Invalid(path.Child("mark"), fwMark.Mark,
+			fmt.Sprintf("WireguardFwMark.Mark should not be %d, which is used by the CNI plugin to mark pod traffic from eth0", consts.Eth0Mark)))
+	}
+	// kube-proxy masquerades or drops packets carrying its mark bits
+	if int(fwMark.Mark)&(consts.KubeProxyMasqueradeMark|consts.KubeProxyDropMark) != 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("mark"), fwMark.Mark,
+			fmt.Sprintf("WireguardFwMark.Mark should not have bits %#x or %#x set, which are used by kube-proxy to mark traffic to masquerade or drop",
+				consts.KubeProxyMasqueradeMark, consts.KubeProxyDropMark)))
+	}
+	// 253-255 are the default, main and local tables
+	if fwMark.RouteTable == consts.GatewayRouteTable || (fwMark.RouteTable >= 253 && fwMark.RouteTable <= 255) {
+		allErrs = append(allErrs, field.Invalid(path.Child("routetable"), fwMark.RouteTable,
+			fmt.Sprintf("WireguardFwMark.RouteTable should not be %d or a reserved route table between 253 and 255", consts.GatewayRouteTable)))
+	}
+	return allErrs
+}
+
+// validatePeerEndpointIP checks that the peer endpoint IP is a unicast IPv4 address pods can route outside the tunnel
+func validatePeerEndpointIP(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) field.ErrorList {
+	var allErrs field.ErrorList
+	if gwConfig.Spec.PeerEndpointIp == "" {
+		return allErrs
+	}
+	path := field.NewPath("spec").Child("peerendpointip")
+	ip := net.ParseIP(gwConfig.Spec.PeerEndpointIp)
+	if ip == nil || ip.To4() == nil {
+		return append(allErrs, field.Invalid(path, gwConfig.Spec.PeerEndpointIp, "PeerEndpointIp should be a valid IPv4 address"))
+	}
+	if !ip.IsGlobalUnicast() {
+		return append(allErrs, field.Invalid(path, gwConfig.Spec.PeerEndpointIp,
+			"PeerEndpointIp should be a routable unicast address, not a loopback, link-local, multicast or broadcast address"))
+	}
+	tunneled := gwConfig.Spec.PrivateCidrs
+	if gwConfig.Spec.DefaultRoute == egressgatewayv1alpha1.RouteAzureNetworking && len(gwConfig.Spec.IncludeCidrs) == 0 {
+		// excludeCidrs are routed to the gateway in this case
+		tunneled = slices.Concat(gwConfig.Spec.ExcludeCidrs, tunneled)
+	}
+	for _, cidr := range tunneled {
+		if _, ipNet, err := net.ParseCIDR(cidr); err == nil && ipNet.Contains(ip) {
+			allErrs = append(allErrs, field.Invalid(path, gwConfig.Spec.PeerEndpointIp,
+				fmt.Sprintf("PeerEndpointIp should not be in %s, which is routed to the gateway", cidr)))
+		}
+	}
+	return allErrs
+}
+
+// validateCidrs checks that cidrs are valid and unique
+func validateCidrs(path *field.Path, fieldName string, cidrs []string) field.ErrorList {
+	var allErrs field.ErrorList
+	seen := make(map[string]bool)
+	for i, cidr := range cidrs {
+		if net.ParseIP(cidr) != nil {
+			allErrs = append(allErrs, field.Invalid(path.Index(i), cidr,
+				fmt.Sprintf("%s should contain CIDRs with prefix length, e.g. use /32 or /128 for a single IP address", fieldName)))
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Index(i), cidr, fmt.Sprintf("%s should contain valid CIDRs", fieldName)))
+			continue
+		}
+		if seen[ipNet.String()] {
+			allErrs = append(allErrs, field.Duplicate(path.Index(i), cidr))
+			continue
+		}
+		seen[ipNet.String()] = true
+	}
+	return allErrs
+}
+
+// validateTags checks tags against Azure tag limits, names are at most 512 characters without <>%&\?/ and values are
+// at most 256 characters
+func validateTags(path *field.Path, tags map[string]string) field.ErrorList {
+	var allErrs field.ErrorList
+	if len(tags) > maxAzureTags {
+		allErrs = append(allErrs, field.TooMany(path, len(tags), maxAzureTags))
+	}
+	for name, value := range tags {
+		if name == "" || len(name) > maxAzureTagNameLength || strings.ContainsAny(name, "<>%&\\?/") {
+			allErrs = append(allErrs, field.Invalid(path.Key(name), name,
+				fmt.Sprintf("Tag name should have 1 to %d characters and not contain any of <>%%&\\?/", maxAzureTagNameLength)))
+		}
+		if len(value) > maxAzureTagValueLength {
+			allErrs = append(allErrs, field.TooLong(path.Key(name), value, maxAzureTagValueLength))
+		}
+	}
+	return allErrs
+}
+
+// validateIncludeNotExcluded checks that no includeCidrs is entirely covered by an excludeCidrs, which would
+// never route any traffic to the gateway. ExcludeCidrs within includeCidrs are allowed to carve out destinations.
+func validateIncludeNotExcluded(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, include := range gwConfig.Spec.IncludeCidrs {
+		_, includeNet, err := net.ParseCIDR(include)
+		if err != nil {
+			continue
+		}
+		for _, exclude := range gwConfig.Spec.ExcludeCidrs {
+			_, excludeNet, err := net.ParseCIDR(exclude)
+			if err != nil {
+				continue
+			}
+			if cidrContains(excludeNet, includeNet) {
+				allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("includecidrs").Index(i),
+					include,
+					fmt.Sprintf("IncludeCidrs should not be entirely excluded by ExcludeCidrs %s", exclude)))
+				break
+			}
+		}
+	}
+	return allErrs
+}
+
+// validatePreserveSourceIPCidrs checks that traffic to preserveSourceIpCidrs is routed to the gateway
+func validatePreserveSourceIPCidrs(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, cidr := range gwConfig.Spec.PreserveSourceIpCidrs {
+		path := field.NewPath("spec").Child("preservesourceipcidrs").Index(i)
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			// already reported by validateCidrs
+			continue
+		}
+		if ipNet.IP.To4() == nil && !gwConfig.Spec.EnableIPv6 {
+			allErrs = append(allErrs, field.Invalid(path, cidr, "PreserveSourceIpCidrs should not contain IPv6 CIDRs when EnableIPv6 is false"))
+		}
+		for _, exclude := range gwConfig.Spec.ExcludeCidrs {
+			_, excludeNet, err := net.ParseCIDR(exclude)
+			if err != nil {
+				continue
+			}
+			if excludeNet.Contains(ipNet.IP) || ipNet.Contains(excludeNet.IP) {
+				allErrs = append(allErrs, field.Invalid(path, cidr,
+					fmt.Sprintf("PreserveSourceIpCidrs should not overlap with ExcludeCidrs %s, excluded traffic does not reach the gateway", exclude)))
+				break
+			}
+		}
+		if len(gwConfig.Spec.IncludeCidrs) == 0 {
+			continue
+		}
+		included := false
+		for _, include := range gwConfig.Spec.IncludeCidrs {
+			if _, includeNet, err := net.ParseCIDR(include); err == nil && cidrContains(includeNet, ipNet) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			allErrs = append(allErrs, field.Invalid(path, cidr,
+				"PreserveSourceIpCidrs should be within IncludeCidrs, only included traffic reaches the gateway"))
+		}
+	}
+	return allErrs
+}
+
+// validatePrivateCidrs checks that traffic to privateCidrs reaches the gateway and is sNATed there
+func validatePrivateCidrs(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, cidr := range gwConfig.Spec.PrivateCidrs {
+		path := field.NewPath("spec").Child("privatecidrs").Index(i)
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			// already reported by validateCidrs
+			continue
+		}
+		if ipNet.IP.To4() == nil && !gwConfig.Spec.EnableIPv6 {
+			allErrs = append(allErrs, field.Invalid(path, cidr, "PrivateCidrs should not contain IPv6 CIDRs when EnableIPv6 is false"))
+		}
+		if exclude := findOverlappingCidr(ipNet, gwConfig.Spec.ExcludeCidrs); exclude != "" {
+			allErrs = append(allErrs, field.Invalid(path, cidr,
+				fmt.Sprintf("PrivateCidrs should not overlap with ExcludeCidrs %s, excluded traffic does not reach the gateway", exclude)))
+		}
+		if preserve := findOverlappingCidr(ipNet, gwConfig.Spec.PreserveSourceIpCidrs); preserve != "" {
+			allErrs = append(allErrs, field.Invalid(path, cidr,
+				fmt.Sprintf("PrivateCidrs should not overlap with PreserveSourceIpCidrs %s, traffic to them is not sNATed", preserve)))
+		}
+	}
+	return allErrs
+}
+
+// findOverlappingCidr returns the first of cidrs overlapping ipNet, or empty string if there is none
+func findOverlappingCidr(ipNet *net.IPNet, cidrs []string) string {
+	for _, cidr := range cidrs {
+		if _, other, err := net.ParseCIDR(cidr); err == nil && (other.Contains(ipNet.IP) || ipNet.Contains(other.IP)) {
+			return cidr
+		}
+	}
+	return ""
+}
+
+// cidrContains returns whether cidr a contains all addresses of cidr b
+func cidrContains(a, b *net.IPNet) bool {
+	aOnes, aBits := a.Mask.Size()
+	bOnes, bBits := b.Mask.Size()
+	return aBits == bBits && aOnes <= bOnes && a.Contains(b.IP)
+}
+
+func toInvalidError(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration, allErrs field.ErrorList) error {
 	if len(allErrs) == 0 {
 		return nil
 	}
@@ -299,15 +1066,267 @@ func validate(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) error
 }
 
 func vmssProfileIsEmpty(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) bool {
-	return gwConfig.Spec.GatewayVmssProfile.VmssResourceGroup == "" &&
+	return gwConfig.Spec.GatewayVmssProfile.SubscriptionId == "" &&
+		gwConfig.Spec.GatewayVmssProfile.VmssResourceGroup == "" &&
 		gwConfig.Spec.GatewayVmssProfile.VmssName == "" &&
+		len(gwConfig.Spec.GatewayVmssProfile.Vmsses) == 0 &&
 		gwConfig.Spec.GatewayVmssProfile.PublicIpPrefixSize == 0
 }
 
-func (r *StaticGatewayConfigurationReconciler) reconcileWireguardKey(
+// validateGatewaySubscription validates the subscription of the gateway VMSSes, whose managed resources are created
+// in the resource group of the VMSSes when it is not the cluster subscription
+func validateGatewaySubscription(profile egressgatewayv1alpha1.GatewayVmssProfile) field.ErrorList {
+	if profile.SubscriptionId == "" {
+		return nil
+	}
+	var allErrs field.ErrorList
+	path := field.NewPath("spec").Child("gatewayvmssprofile")
+	if !subscriptionIDRE.MatchString(profile.SubscriptionId) {
+		allErrs = append(allErrs, field.Invalid(path.Child("subscriptionid"), profile.SubscriptionId,
+			"SubscriptionId should be a subscription ID in the form of a GUID"))
+	}
+	for i, vmss := range profile.Vmsses {
+		if !strings.EqualFold(vmss.VmssResourceGroup, profile.Vmsses[0].VmssResourceGroup) {
+			allErrs = append(allErrs, field.Invalid(path.Child("vmsses").Index(i).Child("vmssresourcegroup"), vmss.VmssResourceGroup,
+				"Gateway vmsses should be in the same resource group when SubscriptionId is specified"))
+		}
+	}
+	return allErrs
+}
+
+// validateVmssReferences validates the list of gateway VMSSes, which replaces the single VMSS of the profile
+func validateVmssReferences(profile egressgatewayv1alpha1.GatewayVmssProfile) field.ErrorList {
+	var allErrs field.ErrorList
+	path := field.NewPath("spec").Child("gatewayvmssprofile").Child("vmsses")
+	if profile.VmssResourceGroup != "" || profile.VmssName != "" {
+		allErrs = append(allErrs, field.Invalid(path,
+			fmt.Sprintf("VmssResourceGroup: %s, VmssName: %s", profile.VmssResourceGroup, profile.VmssName),
+			"Only one of Vmsses and VmssResourceGroup/VmssName should be provided"))
+	}
+	seen := make(map[string]bool)
+	for i, vmss := range profile.Vmsses {
+		if vmss.VmssResourceGroup == "" {
+			allErrs = append(allErrs, field.Invalid(path.Index(i).Child("vmssresourcegroup"), vmss.VmssResourceGroup, "Gateway vmss resource group is empty"))
+		}
+		if vmss.VmssName == "" {
+			allErrs = append(allErrs, field.Invalid(path.Index(i).Child("vmssname"), vmss.VmssName, "Gateway vmss name is empty"))
+		}
+		key := strings.ToLower(vmss.VmssResourceGroup + "/" + vmss.VmssName)
+		if seen[key] {
+			allErrs = append(allErrs, field.Duplicate(path.Index(i), fmt.Sprintf("%s/%s", vmss.VmssResourceGroup, vmss.VmssName)))
+		}
+		seen[key] = true
+	}
+	return allErrs
+}
+
+// reconcileConnectedPodsStatus updates connected pods and the full condition in status when PodEndpoints of the
+// gateway change, status is only patched when it changes
+func (r *StaticGatewayConfigurationReconciler) reconcileConnectedPodsStatus(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	gwConfig := &egressgatewayv1alpha1.StaticGatewayConfiguration{}
+	if err := r.Get(ctx, req.NamespacedName, gwConfig); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !gwConfig.ObjectMeta.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+	ctx = logger.WithGateway(ctx, gwConfig)
+
+	original := gwConfig.DeepCopy()
+	if err := r.reconcileConnectedPods(ctx, gwConfig); err != nil {
+		log.FromContext(ctx).Error(err, "failed to reconcile connected pods")
+		return ctrl.Result{}, err
+	}
+	reconcileFullCondition(gwConfig)
+	if equality.Semantic.DeepEqual(original.Status, gwConfig.Status) {
+		return ctrl.Result{}, nil
+	}
+	if err := r.Status().Patch(ctx, gwConfig, client.MergeFrom(original)); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to update connected pods of StaticGatewayConfiguration %s/%s: %w", gwConfig.Namespace, gwConfig.Name, err)
+	}
+	return ctrl.Result{}, nil
+}
+
+// reconcileConnectedPods counts PodEndpoints using the gateway into status
+func (r *StaticGatewayConfigurationReconciler) reconcileConnectedPods(
 	ctx context.Context,
 	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
 ) error {
+	podEndpointList := &egressgatewayv1alpha1.PodEndpointList{}
+	gwConfigKey := types.NamespacedName{Namespace: gwConfig.Namespace, Name: gwConfig.Name}
+	if err := r.List(ctx, podEndpointList, client.MatchingFields{podEndpointGatewayIndex: gwConfigKey.String()}); err != nil {
+		return fmt.Errorf("failed to list PodEndpoints: %w", err)
+	}
+	var connectedPods int32
+	for _, podEndpoint := range podEndpointList.Items {
+		// PodEndpoints in namespaces no longer allowed are not configured on gateway
+		if gwConfig.AllowsNamespace(podEndpoint.Namespace) {
+			connectedPods++
+		}
+	}
+	if connectedPods != gwConfig.Status.ConnectedPods {
+		gwConfig.Status.ConnectedPods = connectedPods
+		now := metav1.Now()
+		gwConfig.Status.LastPeerChangeTime = &now
+	}
+	return nil
+}
+
+// reconcileGatewayEndpoints reports the wireguard endpoints of gateway nodes serving the gateway into status.
+// Node readiness is not watched, the CNI manager checks it before connecting pods to a gateway node.
+func (r *StaticGatewayConfigurationReconciler) reconcileGatewayEndpoints(
+	ctx context.Context,
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+) error {
+	if gwConfig.Status.Port == 0 {
+		gwConfig.Status.GatewayEndpoints = nil
+		return nil
+	}
+	gwStatusList := &egressgatewayv1alpha1.GatewayStatusList{}
+	if err := r.List(ctx, gwStatusList); err != nil {
+		return fmt.Errorf("failed to list GatewayStatuses: %w", err)
+	}
+	gwConfigKey := fmt.Sprintf("%s/%s", gwConfig.Namespace, gwConfig.Name)
+	var endpoints []string
+	for _, gwStatus := range gwStatusList.Items {
+		if gwStatus.Spec.Draining || gwStatus.Spec.Quarantined || !slices.ContainsFunc(gwStatus.Spec.ReadyGatewayConfigurations, func(config egressgatewayv1alpha1.GatewayConfiguration) bool {
+			return config.StaticGatewayConfiguration == gwConfigKey
+		}) {
+			continue
+		}
+		// GatewayStatus is named after the gateway node
+		node := &corev1.Node{}
+		if err := r.Get(ctx, client.ObjectKey{Name: gwStatus.Name}, node); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("failed to retrieve gateway node %s: %w", gwStatus.Name, err)
+		}
+		if ip := getNodeInternalIP(node); ip != "" {
+			endpoints = append(endpoints, getGatewayEndpoint(ip, gwConfig.Status.Port))
+		}
+	}
+	slices.Sort(endpoints)
+	gwConfig.Status.GatewayEndpoints = endpoints
+	return nil
+}
+
+// reconcileExcludeCidrsConfigMap reads the CIDRs of the referenced ConfigMap into status, from where cni managers
+// exclude them along with excludeCidrs. The last known good CIDRs are kept while the ConfigMap is missing or invalid.
+func (r *StaticGatewayConfigurationReconciler) reconcileExcludeCidrsConfigMap(
+	ctx context.Context,
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+) error {
+	ref := gwConfig.Spec.ExcludeCidrsConfigMap
+	if ref == nil {
+		gwConfig.Status.ConfigMapExcludeCidrs = nil
+		meta.RemoveStatusCondition(&gwConfig.Status.Conditions, consts.SGCExcludeCidrsConfigMapReadyConditionType)
+		return nil
+	}
+	condition := metav1.Condition{
+		Type:               consts.SGCExcludeCidrsConfigMapReadyConditionType,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: gwConfig.Generation,
+	}
+	defer func() {
+		if condition.Reason != "" {
+			meta.SetStatusCondition(&gwConfig.Status.Conditions, condition)
+		}
+	}()
+
+	configMap := &corev1.ConfigMap{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: gwConfig.Namespace, Name: ref.Name}, configMap); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to retrieve ConfigMap %s/%s: %w", gwConfig.Namespace, ref.Name, err)
+		}
+		condition.Reason = consts.SGCExcludeCidrsConfigMapReasonNotFound
+		condition.Message = fmt.Sprintf("ConfigMap %s is not found", ref.Name)
+		return nil
+	}
+	if configMap.Labels[consts.ExcludeCidrsConfigMapLabel] != "true" {
+		// only labeled ConfigMaps are watched, changes of others would go unnoticed
+		condition.Reason = consts.SGCExcludeCidrsConfigMapReasonNotFound
+		condition.Message = fmt.Sprintf("ConfigMap %s is not labeled %s=true", ref.Name, consts.ExcludeCidrsConfigMapLabel)
+		return nil
+	}
+	data, ok := configMap.Data[ref.Key]
+	if !ok {
+		condition.Reason = consts.SGCExcludeCidrsConfigMapReasonKeyNotFound
+		condition.Message = fmt.Sprintf("ConfigMap %s has no key %s", ref.Name, ref.Key)
+		return nil
+	}
+	cidrs := parseExcludeCidrs(data)
+	if allErrs := validateCidrs(field.NewPath("data").Key(ref.Key), "ExcludeCidrs", cidrs); len(allErrs) > 0 {
+		condition.Reason = consts.SGCExcludeCidrsConfigMapReasonInvalidCidrs
+		condition.Message = fmt.Sprintf("ConfigMap %s has invalid CIDRs: %s", ref.Name, allErrs.ToAggregate().Error())
+		return nil
+	}
+	if allErrs := validateConfigMapExcludeCidrs(gwConfig, cidrs); len(allErrs) > 0 {
+		condition.Reason = consts.SGCExcludeCidrsConfigMapReasonInvalidCidrs
+		condition.Message = fmt.Sprintf("ConfigMap %s has CIDRs conflicting with the gateway: %s", ref.Name, allErrs.ToAggregate().Error())
+		return nil
+	}
+	gwConfig.Status.ConfigMapExcludeCidrs = cidrs
+	condition.Status = metav1.ConditionTrue
+	condition.Reason = consts.SGCExcludeCidrsConfigMapReasonLoaded
+	condition.Message = fmt.Sprintf("Loaded %d CIDRs from ConfigMap %s", len(cidrs), ref.Name)
+	return nil
+}
+
+// validateConfigMapExcludeCidrs checks CIDRs read from the exclude CIDRs ConfigMap against the gateway like
+// excludeCidrs: they must not entirely exclude includeCidrs, nor overlap privateCidrs or preserveSourceIpCidrs.
+// Like with excludeCidrs, the gateway DNS resolver may be excluded, pods route it to the gateway regardless.
+func validateConfigMapExcludeCidrs(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration, cidrs []string) field.ErrorList {
+	// the spec itself is already validated, only check the ConfigMap CIDRs in place of excludeCidrs
+	withConfigMap := gwConfig.DeepCopy()
+	withConfigMap.Spec.ExcludeCidrs = cidrs
+	allErrs := validateIncludeNotExcluded(withConfigMap)
+	allErrs = append(allErrs, validatePrivateCidrs(withConfigMap)...)
+	return append(allErrs, validatePreserveSourceIPCidrs(withConfigMap)...)
+}
+
+// parseExcludeCidrs splits ConfigMap data into CIDRs separated by commas, spaces or newlines, lines starting with #
+// are comments
+func parseExcludeCidrs(data string) []string {
+	var cidrs []string
+	for _, line := range strings.Split(data, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		cidrs = append(cidrs, strings.FieldsFunc(line, func(c rune) bool {
+			return c == ',' || unicode.IsSpace(c)
+		})...)
+	}
+	return cidrs
+}
+
+// getNodeInternalIP returns the IPv4 internal IP of the node, which pods use to reach the gateway node
+func getNodeInternalIP(node *corev1.Node) string {
+	for _, addr := range node.Status.Addresses {
+		if ip := net.ParseIP(addr.Address); addr.Type == corev1.NodeInternalIP && ip != nil && ip.To4() != nil {
+			return addr.Address
+		}
+	}
+	return ""
+}
+
+// getGatewayEndpoint returns the wireguard endpoint of the gateway, or empty string if it is not provisioned yet
+func getGatewayEndpoint(ip string, port int32) string {
+	if ip == "" || port == 0 {
+		return ""
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(int(port)))
+}
+
+// reconcileWireguardKey ensures the wireguard key pair secret of the gateway, rotating the key pair when it is
+// requested by annotation or older than the rotation interval. A rotation first stages the new key pair and publishes
+// its public key in status, gateway nodes switch to it after WireguardKeyActivationDelay and cni managers then move pod
+// peers to it in place. The replaced public key is retired once no PodEndpoint of the gateway uses it. It returns the
+// time until the next rotation step.
+func (r *StaticGatewayConfigurationReconciler) reconcileWireguardKey(
+	ctx context.Context,
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+) (time.Duration, error) {
 	log := log.FromContext(ctx)
 
 	secret := &corev1.Secret{
@@ -316,6 +1335,7 @@ func (r *StaticGatewayConfigurationReconciler) reconcileWireguardKey(
 			Namespace: r.SecretNamespace,
 		},
 	}
+	keyGenerated, rotateReason, activated, retired := false, "", false, false
 	if _, err := controllerutil.CreateOrUpdate(ctx, r, secret, func() error {
 		if secret.Labels == nil {
 			secret.Labels = make(map[string]string)
@@ -327,25 +1347,72 @@ func (r *StaticGatewayConfigurationReconciler) reconcileWireguardKey(
 			secret.Labels[consts.OwningSGCNameLabel] = gwConfig.Name
 		}
 
+		if secret.Annotations == nil {
+			secret.Annotations = make(map[string]string)
+		}
 		if secret.Data == nil {
 			secret.Data = make(map[string][]byte)
 		}
-		if _, ok := secret.Data[consts.WireguardPrivateKeyName]; !ok {
-			// create new private key
-			wgPrivateKey, err := wgtypes.GeneratePrivateKey()
-			if err != nil {
-				log.Error(err, "failed to generate wireguard private key")
-				return err
+		if _, ok := secret.Data[consts.WireguardPrivateKeyName]; ok {
+			if previous, ok := secret.Data[consts.WireguardPreviousPublicKeyName]; ok {
+				pending, err := r.hasPodEndpointsOnOtherWireguardKey(ctx, gwConfig, string(secret.Data[consts.WireguardPublicKeyName]))
+				if err != nil {
+					return err
+				}
+				if !pending {
+					log.Info("Retired replaced wireguard public key", "publicKey", string(previous))
+					delete(secret.Data, consts.WireguardPreviousPublicKeyName)
+					retired = true
+				}
+			}
+			if _, ok := secret.Data[consts.WireguardNextPrivateKeyName]; ok {
+				activated = activateWireguardKey(secret)
+				return nil
 			}
+			rotateReason = r.getWireguardKeyRotationReason(gwConfig, secret)
+			if rotateReason == "" {
+				return nil
+			}
+		}
+
+		// create new private key, the new key pair and the handled rotation request are persisted in a single
+		// secret update, so that a controller restart never rotates the key twice for the same request
+		wgPrivateKey, err := wgtypes.GeneratePrivateKey()
+		if err != nil {
+			log.Error(err, "failed to generate wireguard private key")
+			return err
+		}
 
+		now := time.Now().UTC().Format(time.RFC3339)
+		if rotateReason == "" {
 			secret.Data[consts.WireguardPrivateKeyName] = []byte(wgPrivateKey.String())
 			secret.Data[consts.WireguardPublicKeyName] = []byte(wgPrivateKey.PublicKey().String())
+			secret.Annotations[consts.WireguardKeyGeneratedAtAnnotation] = now
+		} else {
+			// gateway nodes keep using the current key pair until the staged one is activated
+			secret.Data[consts.WireguardNextPrivateKeyName] = []byte(wgPrivateKey.String())
+			secret.Data[consts.WireguardNextPublicKeyName] = []byte(wgPrivateKey.PublicKey().String())
+			secret.Annotations[consts.WireguardKeyStagedAtAnnotation] = now
 		}
-
+		secret.Annotations[consts.WireguardKeyRotationRequestAnnotation] = gwConfig.Annotations[consts.SGCRotateWireguardKeyAnnotation]
+		keyGenerated = true
 		return nil
 	}); err != nil {
 		log.Error(err, "failed to reconcile wireguard keypair secret")
-		return err
+		return 0, err
+	}
+	switch {
+	case keyGenerated && rotateReason != "":
+		log.Info("Staged wireguard key pair", "reason", rotateReason)
+		r.Recorder.Eventf(gwConfig, corev1.EventTypeNormal, "WireguardKeyStaged", "Staged new wireguard key pair in secret %s/%s: %s", secret.Namespace, secret.Name, rotateReason)
+	case keyGenerated:
+		r.Recorder.Eventf(gwConfig, corev1.EventTypeNormal, "WireguardKeyGenerated", "Generated wireguard key pair in secret %s/%s", secret.Namespace, secret.Name)
+	case activated:
+		log.Info("Rotated wireguard key pair")
+		r.Recorder.Eventf(gwConfig, corev1.EventTypeNormal, "WireguardKeyRotated", "Rotated wireguard key pair in secret %s/%s, pods are moved to the new key", secret.Namespace, secret.Name)
+	}
+	if retired {
+		r.Recorder.Eventf(gwConfig, corev1.EventTypeNormal, "WireguardKeyRetired", "Retired replaced wireguard public key, no pod uses it anymore")
 	}
 	if secret.DeletionTimestamp.IsZero() {
 		// Update secret reference
@@ -356,11 +1423,185 @@ func (r *StaticGatewayConfigurationReconciler) reconcileWireguardKey(
 			Namespace:  secret.Namespace,
 		}
 
-		// Update public key
+		// Update public keys
 		gwConfig.Status.PublicKey = string(secret.Data[consts.WireguardPublicKeyName])
+		gwConfig.Status.NextPublicKey = string(secret.Data[consts.WireguardNextPublicKeyName])
+		gwConfig.Status.PreviousPublicKey = string(secret.Data[consts.WireguardPreviousPublicKeyName])
 	}
 
-	return nil
+	return r.getNextWireguardKeyRotationStep(secret), nil
+}
+
+// activateWireguardKey makes the staged key pair in secret the current one once it has been published for
+// WireguardKeyActivationDelay, keeping the replaced public key until it is retired. It reports whether it did.
+func activateWireguardKey(secret *corev1.Secret) bool {
+	if stagedAt, err := time.Parse(time.RFC3339, secret.Annotations[consts.WireguardKeyStagedAtAnnotation]); err == nil &&
+		time.Since(stagedAt) < consts.WireguardKeyActivationDelay {
+		return false
+	}
+	secret.Data[consts.WireguardPreviousPublicKeyName] = secret.Data[consts.WireguardPublicKeyName]
+	secret.Data[consts.WireguardPrivateKeyName] = secret.Data[consts.WireguardNextPrivateKeyName]
+	secret.Data[consts.WireguardPublicKeyName] = secret.Data[consts.WireguardNextPublicKeyName]
+	delete(secret.Data, consts.WireguardNextPrivateKeyName)
+	delete(secret.Data, consts.WireguardNextPublicKeyName)
+	delete(secret.Annotations, consts.WireguardKeyStagedAtAnnotation)
+	secret.Annotations[consts.WireguardKeyGeneratedAtAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	return true
+}
+
+// hasPodEndpointsOnOtherWireguardKey reports whether any PodEndpoint of the gateway still has its gateway peer on
+// another key than publicKey, including PodEndpoints created before the gateway key was recorded
+func (r *StaticGatewayConfigurationReconciler) hasPodEndpointsOnOtherWireguardKey(
+	ctx context.Context,
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+	publicKey string,
+) (bool, error) {
+	podEndpointList := &egressgatewayv1alpha1.PodEndpointList{}
+	if err := r.List(ctx, podEndpointList, client.MatchingFields{podEndpointGatewayIndex: client.ObjectKeyFromObject(gwConfig).String()}); err != nil {
+		return false, fmt.Errorf("failed to list PodEndpoints: %w", err)
+	}
+	for _, podEndpoint := range podEndpointList.Items {
+		if podEndpoint.Spec.GatewayPublicKey != publicKey {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// getWireguardKeyRotationReason returns why the key pair in secret should be rotated, or empty string if it should not
+func (r *StaticGatewayConfigurationReconciler) getWireguardKeyRotationReason(
+	gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+	secret *corev1.Secret,
+) string {
+	if request := gwConfig.Annotations[consts.SGCRotateWireguardKeyAnnotation]; request != "" &&
+		request != secret.Annotations[consts.WireguardKeyRotationRequestAnnotation] {
+		return fmt.Sprintf("requested by annotation %s=%s", consts.SGCRotateWireguardKeyAnnotation, request)
+	}
+	if r.WireguardKeyRotationInterval <= 0 {
+		return ""
+	}
+	generatedAt, err := time.Parse(time.RFC3339, secret.Annotations[consts.WireguardKeyGeneratedAtAnnotation])
+	if err != nil {
+		// key pair generated before rotation is supported, start counting its age from now
+		secret.Annotations[consts.WireguardKeyGeneratedAtAnnotation] = time.Now().UTC().Format(time.RFC3339)
+		return ""
+	}
+	if time.Since(generatedAt) >= r.WireguardKeyRotationInterval {
+		return fmt.Sprintf("key pair is older than %s", r.WireguardKeyRotationInterval)
+	}
+	return ""
+}
+
+// getNextWireguardKeyRotationStep returns time until the staged key pair in secret is activated, the replaced public
+// key is checked for retirement, or the key pair is due for scheduled rotation, whichever comes first
+func (r *StaticGatewayConfigurationReconciler) getNextWireguardKeyRotationStep(secret *corev1.Secret) time.Duration {
+	if _, ok := secret.Data[consts.WireguardNextPrivateKeyName]; ok {
+		stagedAt, err := time.Parse(time.RFC3339, secret.Annotations[consts.WireguardKeyStagedAtAnnotation])
+		if err != nil {
+			return time.Second
+		}
+		return max(time.Until(stagedAt.Add(consts.WireguardKeyActivationDelay)), time.Second)
+	}
+	next := r.getNextWireguardKeyRotation(secret)
+	if _, ok := secret.Data[consts.WireguardPreviousPublicKeyName]; ok && (next == 0 || next > consts.WireguardKeyActivationDelay) {
+		return consts.WireguardKeyActivationDelay
+	}
+	return next
+}
+
+// getNextWireguardKeyRotation returns time until the key pair in secret is due for scheduled rotation
+func (r *StaticGatewayConfigurationReconciler) getNextWireguardKeyRotation(secret *corev1.Secret) time.Duration {
+	if r.WireguardKeyRotationInterval <= 0 {
+		return 0
+	}
+	generatedAt, err := time.Parse(time.RFC3339, secret.Annotations[consts.WireguardKeyGeneratedAtAnnotation])
+	if err != nil {
+		return 0
+	}
+	// requeue at least one second later, as generated time is truncated to seconds
+	return max(time.Until(generatedAt.Add(r.WireguardKeyRotationInterval)), time.Second)
+}
+
+// reconcileFullCondition reports whether connected pods reached maxPods, in which case new pods are rejected by
+// cni managers until pods using the gateway are deleted
+func reconcileFullCondition(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) {
+	if gwConfig.Spec.MaxPods <= 0 {
+		meta.RemoveStatusCondition(&gwConfig.Status.Conditions, consts.SGCFullConditionType)
+		return
+	}
+	condition := metav1.Condition{
+		Type:               consts.SGCFullConditionType,
+		Status:             metav1.ConditionFalse,
+		Reason:             consts.SGCFullReasonBelowMaxPods,
+		Message:            fmt.Sprintf("Gateway serves %d of at most %d pods", gwConfig.Status.ConnectedPods, gwConfig.Spec.MaxPods),
+		ObservedGeneration: gwConfig.Generation,
+	}
+	if gwConfig.Status.ConnectedPods >= gwConfig.Spec.MaxPods {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = consts.SGCFullReasonMaxPodsReached
+		condition.Message = fmt.Sprintf("Gateway serves %d of at most %d pods, new pods are rejected", gwConfig.Status.ConnectedPods, gwConfig.Spec.MaxPods)
+	}
+	meta.SetStatusCondition(&gwConfig.Status.Conditions, condition)
+}
+
+// reconcileTunnelCidrConflictCondition reports cluster pod CIDRs overlapping the tunnel CIDR, which is shared by all
+// gateways, pods assigned the gateway address in it fail to start
+func (r *StaticGatewayConfigurationReconciler) reconcileTunnelCidrConflictCondition(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) {
+	var overlapping []*net.IPNet
+	if r.TunnelCidr != nil {
+		overlapping = tunnel.OverlappingCIDRs(r.TunnelCidr, r.PodCidrs)
+	}
+	if len(overlapping) == 0 {
+		meta.RemoveStatusCondition(&gwConfig.Status.Conditions, consts.SGCTunnelCidrConflictConditionType)
+		return
+	}
+	cidrs := make([]string, 0, len(overlapping))
+	for _, cidr := range overlapping {
+		cidrs = append(cidrs, cidr.String())
+	}
+	meta.SetStatusCondition(&gwConfig.Status.Conditions, metav1.Condition{
+		Type:   consts.SGCTunnelCidrConflictConditionType,
+		Status: metav1.ConditionTrue,
+		Reason: consts.SGCTunnelCidrConflictReasonPodCidrOverlap,
+		Message: fmt.Sprintf("Pod CIDRs %s overlap tunnel CIDR %s, pods assigned gateway address %s fail to start, "+
+			"move the tunnel CIDR of gateway daemons and CNI managers", strings.Join(cidrs, ","), r.TunnelCidr, tunnel.GatewayIP(r.TunnelCidr).IP),
+		ObservedGeneration: gwConfig.Generation,
+	})
+}
+
+func (r *StaticGatewayConfigurationReconciler) reconcileDryRunCondition(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) {
+	if !r.DryRun {
+		meta.RemoveStatusCondition(&gwConfig.Status.Conditions, consts.SGCDryRunConditionType)
+		return
+	}
+	meta.SetStatusCondition(&gwConfig.Status.Conditions, metav1.Condition{
+		Type:               consts.SGCDryRunConditionType,
+		Status:             metav1.ConditionTrue,
+		Reason:             consts.SGCDryRunReasonEvaluation,
+		Message:            "Manager runs in dry run mode, Azure resources are not modified",
+		ObservedGeneration: gwConfig.Generation,
+	})
+}
+
+// isReconcilePaused returns whether reconciliation of the gateway is paused by annotation, during which the manager
+// does not write Azure resources of the gateway. Reconciles in progress complete, so that the gateway is consistent.
+func isReconcilePaused(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) bool {
+	paused, _ := strconv.ParseBool(gwConfig.Annotations[consts.SGCReconcilePausedAnnotation])
+	return paused
+}
+
+func reconcilePausedCondition(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) {
+	if !isReconcilePaused(gwConfig) {
+		meta.RemoveStatusCondition(&gwConfig.Status.Conditions, consts.SGCPausedConditionType)
+		return
+	}
+	meta.SetStatusCondition(&gwConfig.Status.Conditions, metav1.Condition{
+		Type:               consts.SGCPausedConditionType,
+		Status:             metav1.ConditionTrue,
+		Reason:             consts.SGCPausedReasonAnnotation,
+		Message:            fmt.Sprintf("Reconciliation is paused by annotation %s, Azure resources are not modified", consts.SGCReconcilePausedAnnotation),
+		ObservedGeneration: gwConfig.Generation,
+	})
 }
 
 func (r *StaticGatewayConfigurationReconciler) reconcileGatewayLBConfig(
@@ -381,6 +1622,14 @@ func (r *StaticGatewayConfigurationReconciler) reconcileGatewayLBConfig(
 		lbConfig.Spec.GatewayVmssProfile = gwConfig.Spec.GatewayVmssProfile
 		lbConfig.Spec.ProvisionPublicIps = gwConfig.Spec.ProvisionPublicIps
 		lbConfig.Spec.PublicIpPrefixId = gwConfig.Spec.PublicIpPrefixId
+		lbConfig.Spec.PublicIpPrefixCount = gwConfig.Spec.PublicIpPrefixCount
+		lbConfig.Spec.ReusePublicIpPrefix = gwConfig.Spec.ReusePublicIpPrefix
+		lbConfig.Spec.EnableIPv6 = gwConfig.Spec.EnableIPv6
+		lbConfig.Spec.NatGatewayId = gwConfig.Spec.NatGatewayId
+		lbConfig.Spec.PublicIpAddressId = gwConfig.Spec.PublicIpAddressId
+		lbConfig.Spec.OutboundIdleTimeoutMinutes = gwConfig.Spec.OutboundIdleTimeoutMinutes
+		lbConfig.Spec.WireguardPort = gwConfig.Spec.WireguardPort
+		lbConfig.Spec.Tags = gwConfig.Spec.Tags
 		return controllerutil.SetControllerReference(gwConfig, lbConfig, r.Client.Scheme())
 	}); err != nil {
 		log.Error(err, "failed to reconcile gateway lb configuration")
@@ -389,7 +1638,15 @@ func (r *StaticGatewayConfigurationReconciler) reconcileGatewayLBConfig(
 	if lbConfig.DeletionTimestamp.IsZero() && lbConfig.Status != nil {
 		gwConfig.Status.Ip = lbConfig.Status.FrontendIp
 		gwConfig.Status.Port = lbConfig.Status.ServerPort
+		gwConfig.Status.Endpoint = getGatewayEndpoint(lbConfig.Status.FrontendIp, lbConfig.Status.ServerPort)
 		gwConfig.Status.EgressIpPrefix = lbConfig.Status.EgressIpPrefix
+		gwConfig.Status.EgressIpv6Prefix = lbConfig.Status.EgressIpv6Prefix
+		gwConfig.Status.OutboundType = lbConfig.Status.OutboundType
+		gwConfig.Status.PublicIpPrefixReused = lbConfig.Status.PublicIpPrefixReused
+		gwConfig.Status.OutboundIdleTimeoutMinutes = lbConfig.Status.OutboundIdleTimeoutMinutes
+		gwConfig.Status.GatewayInstances = lbConfig.Status.GatewayInstances
+		gwConfig.Status.GatewayNodes = lbConfig.Status.GatewayNodes
+		gwConfig.Status.VnetAddressSpace = lbConfig.Status.VnetAddressSpace
 	}
 
 	return nil
@@ -6,29 +6,38 @@ package manager
 import (
 	"context"
 	"errors"
+	"net"
+	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	coordinationv1 "k8s.io/api/coordination/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 
 	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
 	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
 )
 
 const (
-	testName      = "test"
-	testNamespace = "testns"
-	privK         = "GHuMwljFfqd2a7cs6BaUOmHflK23zME8VNvC5B37S3k="
-	pubK          = "aPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10="
+	testName        = "test"
+	testNamespace   = "testns"
+	privK           = "GHuMwljFfqd2a7cs6BaUOmHflK23zME8VNvC5B37S3k="
+	pubK            = "aPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10="
+	testPipPrefixID = "/subscriptions/testSub/resourceGroups/testRG/providers/Microsoft.Network/publicIPPrefixes/testPipPrefix"
 )
 
 var _ = Describe("StaticGatewayConfiguration controller in testenv", Ordered, func() {
@@ -79,7 +88,7 @@ var _ = Describe("StaticGatewayConfiguration controller in testenv", Ordered, fu
 					VmssName:           "vmss",
 					PublicIpPrefixSize: 31,
 				},
-				PublicIpPrefixId:   "testPipPrefix",
+				PublicIpPrefixId:   testPipPrefixID,
 				ProvisionPublicIps: true,
 			},
 		}
@@ -217,9 +226,10 @@ var _ = Describe("StaticGatewayConfiguration controller in testenv", Ordered, fu
 			lbConfig := &egressgatewayv1alpha1.GatewayLBConfiguration{}
 			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(gwConfig), lbConfig)).ToNot(HaveOccurred())
 			lbConfig.Status = &egressgatewayv1alpha1.GatewayLBConfigurationStatus{
-				FrontendIp:     "1.1.1.1",
-				ServerPort:     6000,
-				EgressIpPrefix: "1.2.3.4/31",
+				FrontendIp:       "1.1.1.1",
+				ServerPort:       6000,
+				EgressIpPrefix:   "1.2.3.4/31",
+				VnetAddressSpace: []string{"10.0.0.0/16"},
 			}
 			Expect(k8sClient.Status().Update(ctx, lbConfig)).ToNot(HaveOccurred())
 		})
@@ -231,14 +241,18 @@ var _ = Describe("StaticGatewayConfiguration controller in testenv", Ordered, fu
 					return nil, err
 				}
 				return map[string]interface{}{
-					"ip":     updatedGWConfig.Status.Ip,
-					"port":   updatedGWConfig.Status.Port,
-					"prefix": updatedGWConfig.Status.EgressIpPrefix,
+					"ip":       updatedGWConfig.Status.Ip,
+					"port":     updatedGWConfig.Status.Port,
+					"endpoint": updatedGWConfig.Status.Endpoint,
+					"prefix":   updatedGWConfig.Status.EgressIpPrefix,
+					"vnet":     updatedGWConfig.Status.VnetAddressSpace,
 				}, nil
 			}, timeout, interval).Should(BeEquivalentTo(map[string]interface{}{
-				"ip":     "1.1.1.1",
-				"port":   int32(6000),
-				"prefix": "1.2.3.4/31",
+				"ip":       "1.1.1.1",
+				"port":     int32(6000),
+				"endpoint": "1.1.1.1:6000",
+				"prefix":   "1.2.3.4/31",
+				"vnet":     []string{"10.0.0.0/16"},
 			}))
 		})
 	})
@@ -325,7 +339,7 @@ var _ = Describe("test staticGatewayConfiguration validation", func() {
 					VmssName:           "vmss",
 					PublicIpPrefixSize: 31,
 				},
-				PublicIpPrefixId:   "testPipPrefix",
+				PublicIpPrefixId:   testPipPrefixID,
 				ProvisionPublicIps: true,
 			},
 		}
@@ -370,8 +384,76 @@ var _ = Describe("test staticGatewayConfiguration validation", func() {
 			Expect(err).Should(HaveOccurred())
 		})
 
-		It("should fail when PublicIpPrefixSize < 0", func() {
-			gwConfig.Spec.GatewayVmssProfile.PublicIpPrefixSize = -1
+		It("should pass when multiple vmsses are provided", func() {
+			gwConfig.Spec.GatewayVmssProfile.VmssResourceGroup = ""
+			gwConfig.Spec.GatewayVmssProfile.VmssName = ""
+			gwConfig.Spec.GatewayVmssProfile.Vmsses = []egressgatewayv1alpha1.VmssReference{
+				{VmssResourceGroup: "vmssRG", VmssName: "vmss1"},
+				{VmssResourceGroup: "vmssRG2", VmssName: "vmss2"},
+			}
+			err := validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when both Vmsses and VmssName are provided", func() {
+			gwConfig.Spec.GatewayVmssProfile.Vmsses = []egressgatewayv1alpha1.VmssReference{
+				{VmssResourceGroup: "vmssRG", VmssName: "vmss1"},
+			}
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should fail when both GatewayNodepoolName and Vmsses are provided", func() {
+			gwConfig.Spec.GatewayNodepoolName = "testgw"
+			gwConfig.Spec.GatewayVmssProfile = egressgatewayv1alpha1.GatewayVmssProfile{
+				Vmsses: []egressgatewayv1alpha1.VmssReference{{VmssResourceGroup: "vmssRG", VmssName: "vmss1"}},
+			}
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should fail when SubscriptionId is not a subscription ID", func() {
+			gwConfig.Spec.GatewayVmssProfile.SubscriptionId = "gatewaySub"
+			Expect(validate(gwConfig)).To(MatchError(ContainSubstring("SubscriptionId should be a subscription ID in the form of a GUID")))
+			gwConfig.Spec.GatewayVmssProfile.SubscriptionId = "00000000-0000-0000-0000-000000000001"
+			Expect(validate(gwConfig)).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when vmsses in another subscription are in different resource groups", func() {
+			gwConfig.Spec.GatewayVmssProfile.SubscriptionId = "00000000-0000-0000-0000-000000000001"
+			gwConfig.Spec.GatewayVmssProfile.VmssResourceGroup = ""
+			gwConfig.Spec.GatewayVmssProfile.VmssName = ""
+			gwConfig.Spec.GatewayVmssProfile.Vmsses = []egressgatewayv1alpha1.VmssReference{
+				{VmssResourceGroup: "vmssRG", VmssName: "vmss1"},
+				{VmssResourceGroup: "vmssRG2", VmssName: "vmss2"},
+			}
+			Expect(validate(gwConfig)).To(MatchError(ContainSubstring("Gateway vmsses should be in the same resource group when SubscriptionId is specified")))
+			gwConfig.Spec.GatewayVmssProfile.Vmsses[1].VmssResourceGroup = "VMSSRG"
+			Expect(validate(gwConfig)).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when both GatewayNodepoolName and SubscriptionId are provided", func() {
+			gwConfig.Spec.GatewayNodepoolName = "testgw"
+			gwConfig.Spec.GatewayVmssProfile = egressgatewayv1alpha1.GatewayVmssProfile{SubscriptionId: "00000000-0000-0000-0000-000000000001"}
+			Expect(validate(gwConfig)).To(MatchError(ContainSubstring("Only one of GatewayNodepoolName and GatewayVmssProfile should be provided")))
+		})
+
+		It("should fail when a vmss in Vmsses is incomplete or duplicated", func() {
+			gwConfig.Spec.GatewayVmssProfile.VmssResourceGroup = ""
+			gwConfig.Spec.GatewayVmssProfile.VmssName = ""
+			gwConfig.Spec.GatewayVmssProfile.Vmsses = []egressgatewayv1alpha1.VmssReference{
+				{VmssResourceGroup: "vmssRG", VmssName: "vmss1"},
+				{VmssName: "vmss2"},
+			}
+			Expect(validate(gwConfig)).Should(HaveOccurred())
+			gwConfig.Spec.GatewayVmssProfile.Vmsses[1] = egressgatewayv1alpha1.VmssReference{VmssResourceGroup: "VMSSRG", VmssName: "VMSS1"}
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Duplicate value"))
+		})
+
+		It("should fail when PublicIpPrefixSize < 28", func() {
+			gwConfig.Spec.GatewayVmssProfile.PublicIpPrefixSize = 27
 			err := validate(gwConfig)
 			Expect(err).Should(HaveOccurred())
 		})
@@ -381,6 +463,19 @@ var _ = Describe("test staticGatewayConfiguration validation", func() {
 			err := validate(gwConfig)
 			Expect(err).Should(HaveOccurred())
 		})
+
+		It("should pass when PublicIpPrefixSize is not provided with PublicIpPrefixId", func() {
+			gwConfig.Spec.GatewayVmssProfile.PublicIpPrefixSize = 0
+			err := validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when PublicIpPrefixSize is not provided without PublicIpPrefixId", func() {
+			gwConfig.Spec.GatewayVmssProfile.PublicIpPrefixSize = 0
+			gwConfig.Spec.PublicIpPrefixId = ""
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+		})
 	})
 
 	Context("validate publicIpPrefix provision", func() {
@@ -389,6 +484,483 @@ var _ = Describe("test staticGatewayConfiguration validation", func() {
 			err := validate(gwConfig)
 			Expect(err).Should(HaveOccurred())
 		})
+
+		It("should pass when multiple managed public ip prefixes are requested", func() {
+			gwConfig.Spec.PublicIpPrefixId = ""
+			gwConfig.Spec.PublicIpPrefixCount = 3
+			err := validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when multiple public ip prefixes are requested with PublicIpPrefixId", func() {
+			gwConfig.Spec.PublicIpPrefixCount = 3
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should fail when PublicIpPrefixCount exceeds the maximum", func() {
+			gwConfig.Spec.PublicIpPrefixId = ""
+			gwConfig.Spec.PublicIpPrefixCount = 9
+			err := validate(gwConfig)
+			Expect(err).To(MatchError(ContainSubstring("PublicIpPrefixCount should be between 0 and 8 inclusively")))
+		})
+
+		It("should pass when PublicIpPrefixCount is unset", func() {
+			gwConfig.Spec.PublicIpPrefixId = ""
+			gwConfig.Spec.PublicIpPrefixCount = 0
+			err := validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should pass when managed public ip prefixes are reused", func() {
+			gwConfig.Spec.PublicIpPrefixId = ""
+			gwConfig.Spec.ReusePublicIpPrefix = true
+			err := validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when ReusePublicIpPrefix is set with PublicIpPrefixId", func() {
+			gwConfig.Spec.ReusePublicIpPrefix = true
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should pass when Mtu is within range", func() {
+			gwConfig.Spec.Mtu = 1380
+			err := validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when Mtu is out of range", func() {
+			gwConfig.Spec.Mtu = 1500
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			gwConfig.Spec.Mtu = 1000
+			err = validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should pass with valid tags", func() {
+			gwConfig.Spec.Tags = map[string]string{"costCenter": "1234", "env": ""}
+			err := validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail with invalid tags", func() {
+			gwConfig.Spec.Tags = map[string]string{"cost/center": "1234"}
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			gwConfig.Spec.Tags = map[string]string{"costCenter": strings.Repeat("a", 257)}
+			err = validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should pass when WireguardPort is within range", func() {
+			gwConfig.Spec.WireguardPort = 6999
+			err := validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when WireguardPort is out of range", func() {
+			gwConfig.Spec.WireguardPort = 7000
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			gwConfig.Spec.WireguardPort = 5999
+			err = validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should fail when PersistentKeepaliveSeconds is out of range", func() {
+			gwConfig.Spec.PersistentKeepaliveSeconds = to.Ptr(int32(65536))
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			gwConfig.Spec.PersistentKeepaliveSeconds = to.Ptr(int32(-1))
+			err = validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			gwConfig.Spec.PersistentKeepaliveSeconds = to.Ptr(int32(25))
+			err = validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when OutboundIdleTimeoutMinutes is out of range", func() {
+			gwConfig.Spec.OutboundIdleTimeoutMinutes = 3
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			gwConfig.Spec.OutboundIdleTimeoutMinutes = 31
+			err = validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			gwConfig.Spec.OutboundIdleTimeoutMinutes = 30
+			err = validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when OutboundIdleTimeoutMinutes is set without gateway public IPs", func() {
+			gwConfig.Spec.OutboundIdleTimeoutMinutes = 30
+			gwConfig.Spec.PublicIpPrefixId = ""
+			gwConfig.Spec.ProvisionPublicIps = false
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			gwConfig.Spec.ProvisionPublicIps = true
+			gwConfig.Spec.NatGatewayId = testNatGatewayID
+			err = validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should pass with valid destination ports", func() {
+			gwConfig.Spec.AllowedDestinationPorts = []string{"443", "8000-8080", "65535"}
+			err := validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+			gwConfig.Spec.AllowedDestinationPorts = nil
+			gwConfig.Spec.DeniedDestinationPorts = []string{"25", "6660-6669"}
+			err = validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail with invalid destination ports", func() {
+			for _, port := range []string{"0", "65536", "8080-8000", "-1", "+443", "443-", "https", "443,8443", "1-2-3"} {
+				gwConfig.Spec.DeniedDestinationPorts = []string{port}
+				err := validate(gwConfig)
+				Expect(err).Should(HaveOccurred(), "port %s", port)
+			}
+			gwConfig.Spec.DeniedDestinationPorts = []string{"443", "443"}
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should fail when both allowed and denied destination ports are set", func() {
+			gwConfig.Spec.AllowedDestinationPorts = []string{"443"}
+			gwConfig.Spec.DeniedDestinationPorts = []string{"25"}
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should fail when RoutePriority is out of range", func() {
+			gwConfig.Spec.RoutePriority = 32766
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			gwConfig.Spec.RoutePriority = -1
+			err = validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			gwConfig.Spec.RoutePriority = 100
+			err = validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when PreserveSourceIpCidrs is not routed to the gateway", func() {
+			gwConfig.Spec.ExcludeCidrs = []string{"10.1.0.0/16"}
+			gwConfig.Spec.PreserveSourceIpCidrs = []string{"10.1.2.0/24"}
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			gwConfig.Spec.PreserveSourceIpCidrs = []string{"fd00::/64"}
+			err = validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			gwConfig.Spec.DefaultRoute = egressgatewayv1alpha1.RouteAzureNetworking
+			gwConfig.Spec.IncludeCidrs = []string{"192.168.0.0/16"}
+			gwConfig.Spec.PreserveSourceIpCidrs = []string{"172.16.0.0/24"}
+			err = validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			gwConfig.Spec.PreserveSourceIpCidrs = []string{"192.168.1.0/24"}
+			err = validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when PrivateCidrs overlap excluded or preserved source ip cidrs", func() {
+			gwConfig.Spec.PrivateCidrs = []string{"10.2.0.0/24"}
+			err := validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+			gwConfig.Spec.ExcludeCidrs = []string{"10.2.0.0/16"}
+			err = validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			gwConfig.Spec.ExcludeCidrs = nil
+			gwConfig.Spec.PreserveSourceIpCidrs = []string{"10.2.0.128/25"}
+			err = validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			gwConfig.Spec.PreserveSourceIpCidrs = nil
+			gwConfig.Spec.PrivateCidrs = []string{"fd00::/64"}
+			err = validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			gwConfig.Spec.PrivateCidrs = []string{"10.2.0.0"}
+			err = validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should fail when GatewayDNS is invalid", func() {
+			gwConfig.Spec.GatewayDNS = "dns.example.com"
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			gwConfig.Spec.GatewayDNS = "fd00::53"
+			err = validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			gwConfig.Spec.GatewayDNS = "10.2.0.53"
+			err = validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+			// an excluded resolver is still routed to the gateway
+			gwConfig.Spec.ExcludeCidrs = []string{"10.1.0.0/16"}
+			gwConfig.Spec.GatewayDNS = "10.1.0.53"
+			err = validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when PeerEndpointIp is invalid or routed to the gateway", func() {
+			for _, ip := range []string{"gw.example.com", "fd00::4", "127.0.0.1", "169.254.0.1", "224.0.0.1", "255.255.255.255", "0.0.0.0"} {
+				gwConfig.Spec.PeerEndpointIp = ip
+				Expect(validate(gwConfig)).Should(HaveOccurred(), ip)
+			}
+			gwConfig.Spec.PeerEndpointIp = "10.100.0.4"
+			Expect(validate(gwConfig)).ShouldNot(HaveOccurred())
+			gwConfig.Spec.PrivateCidrs = []string{"10.100.0.0/24"}
+			Expect(validate(gwConfig)).To(MatchError(ContainSubstring("PeerEndpointIp should not be in 10.100.0.0/24")))
+			gwConfig.Spec.PrivateCidrs = nil
+			gwConfig.Spec.ExcludeCidrs = []string{"10.100.0.0/16"}
+			Expect(validate(gwConfig)).ShouldNot(HaveOccurred())
+			gwConfig.Spec.DefaultRoute = egressgatewayv1alpha1.RouteAzureNetworking
+			Expect(validate(gwConfig)).To(MatchError(ContainSubstring("PeerEndpointIp should not be in 10.100.0.0/16")))
+		})
+
+		It("should fail when TrafficMirror is invalid", func() {
+			gwConfig.Spec.TrafficMirror = &egressgatewayv1alpha1.TrafficMirror{}
+			Expect(validate(gwConfig)).To(MatchError(ContainSubstring("exactly one of TrafficMirror.TargetInterface and TrafficMirror.Vxlan")))
+			gwConfig.Spec.TrafficMirror.TargetInterface = "eth1"
+			gwConfig.Spec.TrafficMirror.Vxlan = &egressgatewayv1alpha1.TrafficMirrorVxlan{CollectorIp: "10.1.0.100", Vni: 100}
+			Expect(validate(gwConfig)).To(MatchError(ContainSubstring("exactly one of TrafficMirror.TargetInterface and TrafficMirror.Vxlan")))
+			gwConfig.Spec.TrafficMirror.TargetInterface = ""
+			Expect(validate(gwConfig)).ShouldNot(HaveOccurred())
+			gwConfig.Spec.TrafficMirror.Vxlan.CollectorIp = "fd00::100"
+			Expect(validate(gwConfig)).To(MatchError(ContainSubstring("TrafficMirror.Vxlan.CollectorIp should be a valid IPv4 address")))
+			gwConfig.Spec.TrafficMirror.Vxlan.CollectorIp = "10.1.0.100"
+			gwConfig.Spec.TrafficMirror.SampleRate = 100
+			Expect(validate(gwConfig)).To(MatchError(ContainSubstring("TrafficMirror.SampleRate should be a power of 2")))
+			gwConfig.Spec.TrafficMirror.SampleRate = 128
+			Expect(validate(gwConfig)).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when WireguardFwMark collides with daemon marks or route tables", func() {
+			gwConfig.Spec.WireguardFwMark = &egressgatewayv1alpha1.WireguardFwMark{Mark: 6100}
+			Expect(validate(gwConfig)).To(MatchError(ContainSubstring("WireguardFwMark.Mark should not be between 6000 and 6999")))
+			gwConfig.Spec.WireguardFwMark.Mark = 8738
+			Expect(validate(gwConfig)).To(MatchError(ContainSubstring("WireguardFwMark.Mark should not be 8738")))
+			gwConfig.Spec.WireguardFwMark.Mark = 0x4000
+			Expect(validate(gwConfig)).To(MatchError(ContainSubstring("WireguardFwMark.Mark should not have bits 0x4000 or 0x8000 set")))
+			gwConfig.Spec.WireguardFwMark.Mark = 0x8001
+			Expect(validate(gwConfig)).To(MatchError(ContainSubstring("WireguardFwMark.Mark should not have bits 0x4000 or 0x8000 set")))
+			gwConfig.Spec.WireguardFwMark.Mark = 7000
+			Expect(validate(gwConfig)).ShouldNot(HaveOccurred())
+			gwConfig.Spec.WireguardFwMark.RouteTable = 1000
+			Expect(validate(gwConfig)).To(MatchError(ContainSubstring("WireguardFwMark.RouteTable should not be 1000")))
+			gwConfig.Spec.WireguardFwMark.RouteTable = 254
+			Expect(validate(gwConfig)).To(MatchError(ContainSubstring("WireguardFwMark.RouteTable should not be 1000")))
+			gwConfig.Spec.WireguardFwMark.RouteTable = 100
+			Expect(validate(gwConfig)).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when TunnelIPVersions does not match the gateway IP versions", func() {
+			gwConfig.Spec.ProvisionPublicIps = true
+			gwConfig.Spec.TunnelIPVersions = []egressgatewayv1alpha1.IPVersion{egressgatewayv1alpha1.IPv6}
+			Expect(validate(gwConfig)).To(MatchError(ContainSubstring("TunnelIPVersions should not contain IPv6 when EnableIPv6 is false")))
+			gwConfig.Spec.EnableIPv6 = true
+			Expect(validate(gwConfig)).ShouldNot(HaveOccurred())
+			gwConfig.Spec.GatewayDNS = "10.0.0.10"
+			Expect(validate(gwConfig)).To(MatchError(ContainSubstring("TunnelIPVersions should contain IPv4 when GatewayDNS is set")))
+			gwConfig.Spec.GatewayDNS = ""
+			gwConfig.Spec.DefaultRoute = egressgatewayv1alpha1.RouteAzureNetworking
+			gwConfig.Spec.IncludeCidrs = []string{"fd00::/64", "10.1.0.0/16"}
+			Expect(validate(gwConfig)).To(MatchError(ContainSubstring("CIDRs routed to the gateway should not be IPv4 when TunnelIPVersions does not contain it")))
+			gwConfig.Spec.TunnelIPVersions = append(gwConfig.Spec.TunnelIPVersions, egressgatewayv1alpha1.IPv4)
+			Expect(validate(gwConfig)).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when PublicIpPrefixId is not an Azure resource ID", func() {
+			gwConfig.Spec.PublicIpPrefixId = "testPipPrefix"
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should fail when PublicIpPrefixId is not a public ip prefix", func() {
+			gwConfig.Spec.PublicIpPrefixId = "/subscriptions/testSub/resourceGroups/testRG/providers/Microsoft.Network/publicIPAddresses/testPip"
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("validate natGatewayId", func() {
+		BeforeEach(func() {
+			gwConfig.Spec.NatGatewayId = "/subscriptions/testSub/resourceGroups/testRG/providers/Microsoft.Network/natGateways/testNatGateway"
+		})
+
+		It("should pass when NatGatewayId is a NAT gateway", func() {
+			err := validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when NatGatewayId is not a NAT gateway", func() {
+			gwConfig.Spec.NatGatewayId = "/subscriptions/testSub/resourceGroups/testRG/providers/Microsoft.Network/loadBalancers/testLB"
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("spec.natgatewayid"))
+		})
+
+		It("should fail when NatGatewayId is provided but ProvisionPublicIps is false", func() {
+			gwConfig.Spec.ProvisionPublicIps = false
+			gwConfig.Spec.PublicIpPrefixId = ""
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should fail when NatGatewayId is combined with multiple public ip prefixes or IPv6", func() {
+			gwConfig.Spec.PublicIpPrefixId = ""
+			gwConfig.Spec.PublicIpPrefixCount = 2
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			gwConfig.Spec.PublicIpPrefixCount = 1
+			gwConfig.Spec.EnableIPv6 = true
+			err = validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should pass when PublicIpAddressId is a public ip address", func() {
+			gwConfig.Spec.PublicIpPrefixId = ""
+			gwConfig.Spec.PublicIpAddressId = "/subscriptions/testSub/resourceGroups/testRG/providers/Microsoft.Network/publicIPAddresses/testPip"
+			gwConfig.Spec.GatewayVmssProfile.PublicIpPrefixSize = 0
+			err := validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when PublicIpAddressId is not a public ip address", func() {
+			gwConfig.Spec.PublicIpPrefixId = ""
+			gwConfig.Spec.PublicIpAddressId = "/subscriptions/testSub/resourceGroups/testRG/providers/Microsoft.Network/publicIPPrefixes/testPipPrefix"
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("spec.publicipaddressid"))
+		})
+
+		It("should fail when PublicIpAddressId is combined with PublicIpPrefixId or ReusePublicIpPrefix", func() {
+			gwConfig.Spec.PublicIpPrefixId = "/subscriptions/testSub/resourceGroups/testRG/providers/Microsoft.Network/publicIPPrefixes/testPipPrefix"
+			gwConfig.Spec.PublicIpAddressId = "/subscriptions/testSub/resourceGroups/testRG/providers/Microsoft.Network/publicIPAddresses/testPip"
+			err := validate(gwConfig)
+			Expect(err).To(MatchError(ContainSubstring("PublicIpAddressId cannot be combined with PublicIpPrefixId or ReusePublicIpPrefix")))
+			gwConfig.Spec.PublicIpPrefixId = ""
+			gwConfig.Spec.ReusePublicIpPrefix = true
+			err = validate(gwConfig)
+			Expect(err).To(MatchError(ContainSubstring("PublicIpAddressId cannot be combined with PublicIpPrefixId or ReusePublicIpPrefix")))
+		})
+
+		It("should fail when PublicIpAddressId is provided without NatGatewayId", func() {
+			gwConfig.Spec.NatGatewayId = ""
+			gwConfig.Spec.PublicIpPrefixId = ""
+			gwConfig.Spec.PublicIpAddressId = "/subscriptions/testSub/resourceGroups/testRG/providers/Microsoft.Network/publicIPAddresses/testPip"
+			err := validate(gwConfig)
+			Expect(err).To(MatchError(ContainSubstring("PublicIpAddressId can only be set when NatGatewayId is set")))
+		})
+	})
+
+	Context("validate ExcludeCidrs", func() {
+		It("should pass when ExcludeCidrs are valid CIDRs", func() {
+			gwConfig.Spec.ExcludeCidrs = []string{"10.0.0.0/16", "1.2.3.4/32", "fd00::/64"}
+			err := validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when ExcludeCidrs contains a bare IP address", func() {
+			gwConfig.Spec.ExcludeCidrs = []string{"10.0.0.0/16", "1.2.3.4"}
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("spec.excludecidrs[1]"))
+		})
+
+		It("should fail when ExcludeCidrs contains an invalid CIDR", func() {
+			gwConfig.Spec.ExcludeCidrs = []string{"10.0.0.0/33"}
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("spec.excludecidrs[0]"))
+		})
+
+		It("should fail when ExcludeCidrs contains duplicate CIDRs", func() {
+			gwConfig.Spec.ExcludeCidrs = []string{"10.0.0.0/16", "1.2.3.4/32", "10.0.1.0/16"}
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("spec.excludecidrs[2]: Duplicate value"))
+		})
+	})
+
+	Context("validate IncludeCidrs", func() {
+		It("should pass when IncludeCidrs are set with azureNetworking default route", func() {
+			gwConfig.Spec.DefaultRoute = egressgatewayv1alpha1.RouteAzureNetworking
+			gwConfig.Spec.IncludeCidrs = []string{"20.0.0.0/8", "1.2.3.4/32"}
+			err := validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when IncludeCidrs are set with staticEgressGateway default route", func() {
+			gwConfig.Spec.DefaultRoute = egressgatewayv1alpha1.RouteStaticEgressGateway
+			gwConfig.Spec.IncludeCidrs = []string{"20.0.0.0/8"}
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should fail when IncludeCidrs contains invalid or duplicate CIDRs", func() {
+			gwConfig.Spec.DefaultRoute = egressgatewayv1alpha1.RouteAzureNetworking
+			gwConfig.Spec.IncludeCidrs = []string{"20.0.0.0/8", "1.2.3.4", "20.0.0.0/8"}
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("spec.includecidrs[1]"))
+			Expect(err.Error()).To(ContainSubstring("spec.includecidrs[2]: Duplicate value"))
+		})
+
+		It("should pass when ExcludeCidrs carve out destinations from IncludeCidrs", func() {
+			gwConfig.Spec.DefaultRoute = egressgatewayv1alpha1.RouteAzureNetworking
+			gwConfig.Spec.IncludeCidrs = []string{"20.0.0.0/8"}
+			gwConfig.Spec.ExcludeCidrs = []string{"20.1.0.0/16", "10.0.0.0/8"}
+			err := validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when IncludeCidrs is entirely excluded by ExcludeCidrs", func() {
+			gwConfig.Spec.DefaultRoute = egressgatewayv1alpha1.RouteAzureNetworking
+			gwConfig.Spec.IncludeCidrs = []string{"20.0.0.0/8", "20.1.0.0/16", "30.0.0.0/8"}
+			gwConfig.Spec.ExcludeCidrs = []string{"20.1.0.0/16", "30.0.0.0/7"}
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).NotTo(ContainSubstring("spec.includecidrs[0]"))
+			Expect(err.Error()).To(ContainSubstring("spec.includecidrs[1]"))
+			Expect(err.Error()).To(ContainSubstring("spec.includecidrs[2]"))
+		})
+
+		It("should fail when IncludeCidrs contains IPv6 CIDR without EnableIPv6", func() {
+			gwConfig.Spec.DefaultRoute = egressgatewayv1alpha1.RouteAzureNetworking
+			gwConfig.Spec.IncludeCidrs = []string{"fd00::/64"}
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+			gwConfig.Spec.EnableIPv6 = true
+			Expect(validate(gwConfig)).To(Succeed())
+		})
+	})
+
+	Context("validate ExcludeFQDNs", func() {
+		It("should pass when ExcludeFQDNs are valid domain names", func() {
+			gwConfig.Spec.ExcludeFQDNs = []string{"storage.googleapis.com", "example.com"}
+			err := validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when ExcludeFQDNs contains invalid domain name", func() {
+			gwConfig.Spec.ExcludeFQDNs = []string{"example.com", "https://example.com"}
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("validate AllowedNamespaces", func() {
+		It("should pass when AllowedNamespaces are valid namespace names", func() {
+			gwConfig.Spec.AllowedNamespaces = []string{"app1", "app2"}
+			err := validate(gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail when AllowedNamespaces contains invalid namespace name", func() {
+			gwConfig.Spec.AllowedNamespaces = []string{"app1", "app/2"}
+			err := validate(gwConfig)
+			Expect(err).Should(HaveOccurred())
+		})
 	})
 })
 
@@ -400,3 +972,780 @@ func getResource(cl client.Client, object client.Object) error {
 	err := cl.Get(context.TODO(), key, object)
 	return err
 }
+
+var _ = Describe("test staticGatewayConfiguration wireguard key rotation", func() {
+	var (
+		r        *StaticGatewayConfigurationReconciler
+		gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration
+		recorder *record.FakeRecorder
+		secret   *corev1.Secret
+	)
+
+	getTestReconciler := func(objects ...runtime.Object) {
+		recorder = record.NewFakeRecorder(10)
+		cl := fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithRuntimeObjects(objects...).
+			WithIndex(&egressgatewayv1alpha1.PodEndpoint{}, podEndpointGatewayIndex, podEndpointGatewayIndexFunc).
+			Build()
+		r = &StaticGatewayConfigurationReconciler{Client: cl, SecretNamespace: testNamespace, Recorder: recorder}
+	}
+
+	getSecret := func() *corev1.Secret {
+		secret := &corev1.Secret{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Namespace: testNamespace, Name: "sgw-" + string(gwConfig.UID)}, secret)).To(Succeed())
+		return secret
+	}
+
+	BeforeEach(func() {
+		gwConfig = &egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      testName,
+				Namespace: testNamespace,
+				UID:       "1234567890",
+			},
+		}
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "sgw-1234567890",
+				Namespace: testNamespace,
+				Annotations: map[string]string{
+					consts.WireguardKeyGeneratedAtAnnotation: time.Now().UTC().Format(time.RFC3339),
+				},
+			},
+			Data: map[string][]byte{
+				consts.WireguardPrivateKeyName: []byte(privK),
+				consts.WireguardPublicKeyName:  []byte(pubK),
+			},
+		}
+	})
+
+	It("should generate key pair with generation time and handled rotation request", func() {
+		gwConfig.Annotations = map[string]string{consts.SGCRotateWireguardKeyAnnotation: "1"}
+		getTestReconciler()
+		next, err := r.reconcileWireguardKey(context.TODO(), gwConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next).To(BeZero())
+
+		secret := getSecret()
+		Expect(gwConfig.Status.PublicKey).To(Equal(string(secret.Data[consts.WireguardPublicKeyName])))
+		Expect(secret.Annotations[consts.WireguardKeyRotationRequestAnnotation]).To(Equal("1"))
+		Expect(secret.Annotations[consts.WireguardKeyGeneratedAtAnnotation]).NotTo(BeEmpty())
+		Expect(recorder.Events).To(Receive(ContainSubstring("WireguardKeyGenerated")))
+	})
+
+	It("should not rotate key pair when rotation request is already handled", func() {
+		gwConfig.Annotations = map[string]string{consts.SGCRotateWireguardKeyAnnotation: "1"}
+		secret.Annotations[consts.WireguardKeyRotationRequestAnnotation] = "1"
+		getTestReconciler(secret)
+		_, err := r.reconcileWireguardKey(context.TODO(), gwConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gwConfig.Status.PublicKey).To(Equal(pubK))
+		Expect(recorder.Events).To(BeEmpty())
+	})
+
+	It("should stage key pair once when requested by annotation", func() {
+		gwConfig.Annotations = map[string]string{consts.SGCRotateWireguardKeyAnnotation: "2"}
+		secret.Annotations[consts.WireguardKeyRotationRequestAnnotation] = "1"
+		getTestReconciler(secret)
+		next, err := r.reconcileWireguardKey(context.TODO(), gwConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next).To(BeNumerically("~", consts.WireguardKeyActivationDelay, time.Second))
+
+		// gateway nodes keep the current key pair while the next one is published
+		staged := getSecret()
+		Expect(staged.Data[consts.WireguardPrivateKeyName]).To(Equal([]byte(privK)))
+		Expect(staged.Data[consts.WireguardPublicKeyName]).To(Equal([]byte(pubK)))
+		privateKey, err := wgtypes.ParseKey(string(staged.Data[consts.WireguardNextPrivateKeyName]))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(staged.Data[consts.WireguardNextPublicKeyName])).To(Equal(privateKey.PublicKey().String()))
+		Expect(staged.Annotations[consts.WireguardKeyRotationRequestAnnotation]).To(Equal("2"))
+		Expect(gwConfig.Status.PublicKey).To(Equal(pubK))
+		Expect(gwConfig.Status.NextPublicKey).To(Equal(privateKey.PublicKey().String()))
+		Expect(recorder.Events).To(Receive(ContainSubstring("WireguardKeyStaged")))
+
+		// reconciling again, e.g. after controller restart, should not stage another key pair
+		_, err = r.reconcileWireguardKey(context.TODO(), gwConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getSecret().Data).To(Equal(staged.Data))
+		Expect(recorder.Events).To(BeEmpty())
+	})
+
+	It("should activate staged key pair once it has been published for the activation delay", func() {
+		nextKey, err := wgtypes.GeneratePrivateKey()
+		Expect(err).NotTo(HaveOccurred())
+		secret.Data[consts.WireguardNextPrivateKeyName] = []byte(nextKey.String())
+		secret.Data[consts.WireguardNextPublicKeyName] = []byte(nextKey.PublicKey().String())
+		secret.Annotations[consts.WireguardKeyStagedAtAnnotation] = time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+		podEndpoint := &egressgatewayv1alpha1.PodEndpoint{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: testNamespace},
+			Spec:       egressgatewayv1alpha1.PodEndpointSpec{StaticGatewayConfiguration: testName, GatewayPublicKey: pubK},
+		}
+		getTestReconciler(secret, podEndpoint)
+		next, err := r.reconcileWireguardKey(context.TODO(), gwConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next).To(Equal(consts.WireguardKeyActivationDelay))
+
+		rotated := getSecret()
+		Expect(rotated.Data[consts.WireguardPrivateKeyName]).To(Equal([]byte(nextKey.String())))
+		Expect(rotated.Data[consts.WireguardPreviousPublicKeyName]).To(Equal([]byte(pubK)))
+		Expect(rotated.Data).NotTo(HaveKey(consts.WireguardNextPrivateKeyName))
+		Expect(rotated.Annotations).NotTo(HaveKey(consts.WireguardKeyStagedAtAnnotation))
+		Expect(gwConfig.Status.PublicKey).To(Equal(nextKey.PublicKey().String()))
+		Expect(gwConfig.Status.NextPublicKey).To(BeEmpty())
+		Expect(gwConfig.Status.PreviousPublicKey).To(Equal(pubK))
+		Expect(recorder.Events).To(Receive(ContainSubstring("WireguardKeyRotated")))
+
+		// the replaced key is kept while the pod peer is on it
+		_, err = r.reconcileWireguardKey(context.TODO(), gwConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gwConfig.Status.PreviousPublicKey).To(Equal(pubK))
+		Expect(recorder.Events).To(BeEmpty())
+
+		// and retired once the cni manager moved the pod peer to the new key
+		podEndpoint.Spec.GatewayPublicKey = nextKey.PublicKey().String()
+		Expect(r.Update(context.TODO(), podEndpoint)).To(Succeed())
+		next, err = r.reconcileWireguardKey(context.TODO(), gwConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next).To(BeZero())
+		Expect(getSecret().Data).NotTo(HaveKey(consts.WireguardPreviousPublicKeyName))
+		Expect(gwConfig.Status.PreviousPublicKey).To(BeEmpty())
+		Expect(recorder.Events).To(Receive(ContainSubstring("WireguardKeyRetired")))
+	})
+
+	It("should not activate staged key pair before the activation delay", func() {
+		nextKey, err := wgtypes.GeneratePrivateKey()
+		Expect(err).NotTo(HaveOccurred())
+		secret.Data[consts.WireguardNextPrivateKeyName] = []byte(nextKey.String())
+		secret.Data[consts.WireguardNextPublicKeyName] = []byte(nextKey.PublicKey().String())
+		secret.Annotations[consts.WireguardKeyStagedAtAnnotation] = time.Now().UTC().Format(time.RFC3339)
+		getTestReconciler(secret)
+		next, err := r.reconcileWireguardKey(context.TODO(), gwConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next).To(BeNumerically("~", consts.WireguardKeyActivationDelay, time.Second))
+		Expect(getSecret().Data[consts.WireguardPrivateKeyName]).To(Equal([]byte(privK)))
+		Expect(gwConfig.Status.PublicKey).To(Equal(pubK))
+		Expect(gwConfig.Status.NextPublicKey).To(Equal(nextKey.PublicKey().String()))
+		Expect(recorder.Events).To(BeEmpty())
+	})
+
+	It("should stage key pair older than rotation interval", func() {
+		secret.Annotations[consts.WireguardKeyGeneratedAtAnnotation] = time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+		getTestReconciler(secret)
+		r.WireguardKeyRotationInterval = time.Hour
+		next, err := r.reconcileWireguardKey(context.TODO(), gwConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next).To(BeNumerically("~", consts.WireguardKeyActivationDelay, time.Second))
+		Expect(gwConfig.Status.PublicKey).To(Equal(pubK))
+		Expect(gwConfig.Status.NextPublicKey).NotTo(BeEmpty())
+		Expect(recorder.Events).To(Receive(ContainSubstring("key pair is older than 1h0m0s")))
+	})
+
+	It("should requeue until key pair is due for rotation", func() {
+		secret.Annotations[consts.WireguardKeyGeneratedAtAnnotation] = time.Now().Add(-30 * time.Minute).UTC().Format(time.RFC3339)
+		getTestReconciler(secret)
+		r.WireguardKeyRotationInterval = time.Hour
+		next, err := r.reconcileWireguardKey(context.TODO(), gwConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next).To(BeNumerically("~", 30*time.Minute, time.Minute))
+		Expect(gwConfig.Status.PublicKey).To(Equal(pubK))
+		Expect(recorder.Events).To(BeEmpty())
+	})
+
+	It("should start counting age of key pair without generation time", func() {
+		delete(secret.Annotations, consts.WireguardKeyGeneratedAtAnnotation)
+		getTestReconciler(secret)
+		r.WireguardKeyRotationInterval = time.Hour
+		next, err := r.reconcileWireguardKey(context.TODO(), gwConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next).To(BeNumerically("~", time.Hour, time.Minute))
+		Expect(gwConfig.Status.PublicKey).To(Equal(pubK))
+		Expect(getSecret().Annotations[consts.WireguardKeyGeneratedAtAnnotation]).NotTo(BeEmpty())
+	})
+})
+
+var _ = Describe("test staticGatewayConfiguration gateway server profile", func() {
+	var (
+		r        *StaticGatewayConfigurationReconciler
+		gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration
+	)
+
+	getTestReconciler := func(lbStatus *egressgatewayv1alpha1.GatewayLBConfigurationStatus) {
+		lbConfig := &egressgatewayv1alpha1.GatewayLBConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: testName, Namespace: testNamespace},
+			Status:     lbStatus,
+		}
+		cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(lbConfig).Build()
+		r = &StaticGatewayConfigurationReconciler{Client: cl, SecretNamespace: testNamespace, Recorder: record.NewFakeRecorder(10)}
+	}
+
+	BeforeEach(func() {
+		gwConfig = &egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: testName, Namespace: testNamespace, UID: "1234567890"},
+			Spec:       egressgatewayv1alpha1.StaticGatewayConfigurationSpec{GatewayNodepoolName: "testgw"},
+		}
+	})
+
+	It("should report the gateway endpoint once provisioned", func() {
+		getTestReconciler(&egressgatewayv1alpha1.GatewayLBConfigurationStatus{FrontendIp: "10.0.0.4", ServerPort: 6000})
+		Expect(r.reconcileGatewayLBConfig(context.TODO(), gwConfig)).To(Succeed())
+		Expect(gwConfig.Status.Endpoint).To(Equal("10.0.0.4:6000"))
+	})
+
+	It("should report ipv6 gateway endpoint in brackets", func() {
+		getTestReconciler(&egressgatewayv1alpha1.GatewayLBConfigurationStatus{FrontendIp: "fd00::4", ServerPort: 6000})
+		Expect(r.reconcileGatewayLBConfig(context.TODO(), gwConfig)).To(Succeed())
+		Expect(gwConfig.Status.Endpoint).To(Equal("[fd00::4]:6000"))
+	})
+
+	It("should not report the gateway endpoint before the port is allocated", func() {
+		getTestReconciler(&egressgatewayv1alpha1.GatewayLBConfigurationStatus{FrontendIp: "10.0.0.4"})
+		Expect(r.reconcileGatewayLBConfig(context.TODO(), gwConfig)).To(Succeed())
+		Expect(gwConfig.Status.Ip).To(Equal("10.0.0.4"))
+		Expect(gwConfig.Status.Endpoint).To(BeEmpty())
+	})
+})
+
+var _ = Describe("test staticGatewayConfiguration connected pods", func() {
+	var (
+		r        *StaticGatewayConfigurationReconciler
+		gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration
+	)
+
+	getTestReconciler := func(objects ...runtime.Object) {
+		cl := fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithRuntimeObjects(objects...).
+			WithIndex(&egressgatewayv1alpha1.PodEndpoint{}, podEndpointGatewayIndex, podEndpointGatewayIndexFunc).
+			Build()
+		r = &StaticGatewayConfigurationReconciler{Client: cl, SecretNamespace: testNamespace, Recorder: record.NewFakeRecorder(10)}
+	}
+
+	getPodEndpoint := func(namespace, name, gateway string) *egressgatewayv1alpha1.PodEndpoint {
+		return &egressgatewayv1alpha1.PodEndpoint{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       egressgatewayv1alpha1.PodEndpointSpec{StaticGatewayConfiguration: gateway},
+		}
+	}
+
+	BeforeEach(func() {
+		gwConfig = &egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      testName,
+				Namespace: testNamespace,
+			},
+			Spec: egressgatewayv1alpha1.StaticGatewayConfigurationSpec{
+				AllowedNamespaces: []string{"app1"},
+			},
+		}
+	})
+
+	It("should count PodEndpoints using the gateway", func() {
+		getTestReconciler(
+			getPodEndpoint(testNamespace, "pod1", testName),
+			getPodEndpoint("app1", "pod2", testNamespace+"/"+testName),
+			// namespace not allowed
+			getPodEndpoint("app2", "pod3", testNamespace+"/"+testName),
+			// other gateways
+			getPodEndpoint(testNamespace, "pod4", "other"),
+			getPodEndpoint("app1", "pod5", testName),
+		)
+		Expect(r.reconcileConnectedPods(context.TODO(), gwConfig)).To(Succeed())
+		Expect(gwConfig.Status.ConnectedPods).To(Equal(int32(2)))
+		Expect(gwConfig.Status.LastPeerChangeTime).NotTo(BeNil())
+	})
+
+	It("should not update last peer change time when connected pods do not change", func() {
+		lastChange := metav1.NewTime(time.Now().Add(-time.Hour))
+		gwConfig.Status.ConnectedPods = 1
+		gwConfig.Status.LastPeerChangeTime = &lastChange
+		getTestReconciler(getPodEndpoint(testNamespace, "pod1", testName))
+		Expect(r.reconcileConnectedPods(context.TODO(), gwConfig)).To(Succeed())
+		Expect(gwConfig.Status.ConnectedPods).To(Equal(int32(1)))
+		Expect(gwConfig.Status.LastPeerChangeTime).To(Equal(&lastChange))
+	})
+
+	It("should reset connected pods when all PodEndpoints are deleted", func() {
+		lastChange := metav1.NewTime(time.Now().Add(-time.Hour))
+		gwConfig.Status.ConnectedPods = 3
+		gwConfig.Status.LastPeerChangeTime = &lastChange
+		getTestReconciler()
+		Expect(r.reconcileConnectedPods(context.TODO(), gwConfig)).To(Succeed())
+		Expect(gwConfig.Status.ConnectedPods).To(BeZero())
+		Expect(gwConfig.Status.LastPeerChangeTime.After(lastChange.Time)).To(BeTrue())
+	})
+
+	It("should report gateway full when connected pods reach maxPods", func() {
+		gwConfig.Spec.MaxPods = 2
+		getTestReconciler(getPodEndpoint(testNamespace, "pod1", testName))
+		Expect(r.reconcileConnectedPods(context.TODO(), gwConfig)).To(Succeed())
+		reconcileFullCondition(gwConfig)
+		Expect(meta.IsStatusConditionFalse(gwConfig.Status.Conditions, consts.SGCFullConditionType)).To(BeTrue())
+
+		getTestReconciler(getPodEndpoint(testNamespace, "pod1", testName), getPodEndpoint("app1", "pod2", testNamespace+"/"+testName))
+		Expect(r.reconcileConnectedPods(context.TODO(), gwConfig)).To(Succeed())
+		reconcileFullCondition(gwConfig)
+		condition := meta.FindStatusCondition(gwConfig.Status.Conditions, consts.SGCFullConditionType)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition.Reason).To(Equal(consts.SGCFullReasonMaxPodsReached))
+
+		gwConfig.Spec.MaxPods = 0
+		reconcileFullCondition(gwConfig)
+		Expect(meta.FindStatusCondition(gwConfig.Status.Conditions, consts.SGCFullConditionType)).To(BeNil())
+	})
+
+	It("should only patch connected pods status when PodEndpoints change", func() {
+		gwConfig.Spec.MaxPods = 1
+		cl := fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithRuntimeObjects(gwConfig, getPodEndpoint(testNamespace, "pod1", testName)).
+			WithStatusSubresource(gwConfig).
+			WithIndex(&egressgatewayv1alpha1.PodEndpoint{}, podEndpointGatewayIndex, podEndpointGatewayIndexFunc).
+			Build()
+		r = &StaticGatewayConfigurationReconciler{Client: cl, SecretNamespace: testNamespace, Recorder: record.NewFakeRecorder(10)}
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Name: testName, Namespace: testNamespace}}
+		_, err := r.reconcileConnectedPodsStatus(context.TODO(), req)
+		Expect(err).To(BeNil())
+		existing := &egressgatewayv1alpha1.StaticGatewayConfiguration{}
+		Expect(cl.Get(context.TODO(), req.NamespacedName, existing)).To(Succeed())
+		Expect(existing.Status.ConnectedPods).To(Equal(int32(1)))
+		Expect(meta.IsStatusConditionTrue(existing.Status.Conditions, consts.SGCFullConditionType)).To(BeTrue())
+
+		// unchanged status is not patched again
+		_, err = r.reconcileConnectedPodsStatus(context.TODO(), req)
+		Expect(err).To(BeNil())
+		unchanged := &egressgatewayv1alpha1.StaticGatewayConfiguration{}
+		Expect(cl.Get(context.TODO(), req.NamespacedName, unchanged)).To(Succeed())
+		Expect(unchanged.ResourceVersion).To(Equal(existing.ResourceVersion))
+
+		// deleted gateways are ignored
+		req.Name = "notfound"
+		_, err = r.reconcileConnectedPodsStatus(context.TODO(), req)
+		Expect(err).To(BeNil())
+	})
+
+	It("should index PodEndpoint by gateway", func() {
+		Expect(podEndpointGatewayIndexFunc(getPodEndpoint("app1", "pod1", testNamespace+"/"+testName))).To(Equal([]string{testNamespace + "/" + testName}))
+		Expect(podEndpointGatewayIndexFunc(getPodEndpoint("app1", "pod1", testName))).To(Equal([]string{"app1/" + testName}))
+		Expect(podEndpointGatewayIndexFunc(getPodEndpoint("app1", "pod1", ""))).To(BeEmpty())
+	})
+})
+
+var _ = Describe("test staticGatewayConfiguration dry run condition", func() {
+	var gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration
+
+	BeforeEach(func() {
+		gwConfig = &egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: testName, Namespace: testNamespace, Generation: 2},
+		}
+	})
+
+	It("should set dry run condition in dry run mode", func() {
+		r := &StaticGatewayConfigurationReconciler{DryRun: true}
+		r.reconcileDryRunCondition(gwConfig)
+		condition := meta.FindStatusCondition(gwConfig.Status.Conditions, consts.SGCDryRunConditionType)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition.Reason).To(Equal(consts.SGCDryRunReasonEvaluation))
+		Expect(condition.ObservedGeneration).To(Equal(int64(2)))
+	})
+
+	It("should remove dry run condition when dry run mode is disabled", func() {
+		(&StaticGatewayConfigurationReconciler{DryRun: true}).reconcileDryRunCondition(gwConfig)
+		(&StaticGatewayConfigurationReconciler{}).reconcileDryRunCondition(gwConfig)
+		Expect(gwConfig.Status.Conditions).To(BeEmpty())
+	})
+})
+
+var _ = Describe("test staticGatewayConfiguration tunnel CIDR conflict condition", func() {
+	var (
+		gwConfig   *egressgatewayv1alpha1.StaticGatewayConfiguration
+		tunnelCidr *net.IPNet
+	)
+
+	parseCIDR := func(cidr string) *net.IPNet {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		Expect(err).NotTo(HaveOccurred())
+		return ipNet
+	}
+
+	BeforeEach(func() {
+		gwConfig = &egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: testName, Namespace: testNamespace, Generation: 2},
+		}
+		tunnelCidr = parseCIDR(consts.DefaultTunnelCidr)
+	})
+
+	It("should set conflict condition when pod CIDRs overlap tunnel CIDR", func() {
+		r := &StaticGatewayConfigurationReconciler{
+			TunnelCidr: tunnelCidr,
+			PodCidrs:   []*net.IPNet{parseCIDR("10.244.0.0/16"), parseCIDR("fe80::/112")},
+		}
+		r.reconcileTunnelCidrConflictCondition(gwConfig)
+		condition := meta.FindStatusCondition(gwConfig.Status.Conditions, consts.SGCTunnelCidrConflictConditionType)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition.Reason).To(Equal(consts.SGCTunnelCidrConflictReasonPodCidrOverlap))
+		Expect(condition.Message).To(ContainSubstring("Pod CIDRs fe80::/112 overlap tunnel CIDR fe80::/64"))
+		Expect(condition.ObservedGeneration).To(Equal(int64(2)))
+	})
+
+	It("should remove conflict condition when pod CIDRs no longer overlap tunnel CIDR", func() {
+		r := &StaticGatewayConfigurationReconciler{TunnelCidr: tunnelCidr, PodCidrs: []*net.IPNet{parseCIDR("fe80::/112")}}
+		r.reconcileTunnelCidrConflictCondition(gwConfig)
+		r.TunnelCidr = parseCIDR("fe80:0:0:ffff::/64")
+		r.reconcileTunnelCidrConflictCondition(gwConfig)
+		Expect(gwConfig.Status.Conditions).To(BeEmpty())
+	})
+
+	It("should skip check without tunnel CIDR", func() {
+		(&StaticGatewayConfigurationReconciler{PodCidrs: []*net.IPNet{parseCIDR("fe80::/112")}}).reconcileTunnelCidrConflictCondition(gwConfig)
+		Expect(gwConfig.Status.Conditions).To(BeEmpty())
+	})
+})
+
+var _ = Describe("test staticGatewayConfiguration exclude CIDRs ConfigMap", func() {
+	var (
+		r        *StaticGatewayConfigurationReconciler
+		gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration
+	)
+
+	getTestReconciler := func(objects ...runtime.Object) {
+		cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(objects...).Build()
+		r = &StaticGatewayConfigurationReconciler{Client: cl, SecretNamespace: testNamespace, Recorder: record.NewFakeRecorder(10)}
+	}
+
+	getConfigMap := func(data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "excludes",
+				Namespace: testNamespace,
+				Labels:    map[string]string{consts.ExcludeCidrsConfigMapLabel: "true"},
+			},
+			Data: data,
+		}
+	}
+
+	getCondition := func() *metav1.Condition {
+		return meta.FindStatusCondition(gwConfig.Status.Conditions, consts.SGCExcludeCidrsConfigMapReadyConditionType)
+	}
+
+	BeforeEach(func() {
+		gwConfig = &egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: testName, Namespace: testNamespace, Generation: 2},
+			Spec: egressgatewayv1alpha1.StaticGatewayConfigurationSpec{
+				ExcludeCidrsConfigMap: &egressgatewayv1alpha1.ExcludeCidrsConfigMapReference{Name: "excludes", Key: "cidrs"},
+			},
+		}
+	})
+
+	It("should load CIDRs from the ConfigMap", func() {
+		getTestReconciler(getConfigMap(map[string]string{"cidrs": "# corp networks\n10.0.0.0/8, 172.16.0.0/12\n192.168.0.0/16 1.2.3.4/32\n"}))
+		Expect(r.reconcileExcludeCidrsConfigMap(context.TODO(), gwConfig)).To(Succeed())
+		Expect(gwConfig.Status.ConfigMapExcludeCidrs).To(Equal([]string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "1.2.3.4/32"}))
+		condition := getCondition()
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition.Reason).To(Equal(consts.SGCExcludeCidrsConfigMapReasonLoaded))
+		Expect(condition.ObservedGeneration).To(Equal(int64(2)))
+	})
+
+	It("should report missing ConfigMap and keep last known good CIDRs", func() {
+		gwConfig.Status.ConfigMapExcludeCidrs = []string{"10.0.0.0/8"}
+		getTestReconciler()
+		Expect(r.reconcileExcludeCidrsConfigMap(context.TODO(), gwConfig)).To(Succeed())
+		Expect(gwConfig.Status.ConfigMapExcludeCidrs).To(Equal([]string{"10.0.0.0/8"}))
+		condition := getCondition()
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(consts.SGCExcludeCidrsConfigMapReasonNotFound))
+	})
+
+	It("should report missing key", func() {
+		getTestReconciler(getConfigMap(map[string]string{"other": "10.0.0.0/8"}))
+		Expect(r.reconcileExcludeCidrsConfigMap(context.TODO(), gwConfig)).To(Succeed())
+		Expect(gwConfig.Status.ConfigMapExcludeCidrs).To(BeEmpty())
+		Expect(getCondition().Reason).To(Equal(consts.SGCExcludeCidrsConfigMapReasonKeyNotFound))
+	})
+
+	It("should report invalid CIDRs and keep last known good CIDRs", func() {
+		gwConfig.Status.ConfigMapExcludeCidrs = []string{"10.0.0.0/8"}
+		getTestReconciler(getConfigMap(map[string]string{"cidrs": "10.0.0.0/8\n1.2.3.4\n10.0.0.0/8"}))
+		Expect(r.reconcileExcludeCidrsConfigMap(context.TODO(), gwConfig)).To(Succeed())
+		Expect(gwConfig.Status.ConfigMapExcludeCidrs).To(Equal([]string{"10.0.0.0/8"}))
+		condition := getCondition()
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(consts.SGCExcludeCidrsConfigMapReasonInvalidCidrs))
+		Expect(condition.Message).To(ContainSubstring("1.2.3.4"))
+		Expect(condition.Message).To(ContainSubstring("Duplicate value"))
+	})
+
+	It("should report unlabeled ConfigMap as not found", func() {
+		configMap := getConfigMap(map[string]string{"cidrs": "10.0.0.0/8"})
+		configMap.Labels = nil
+		getTestReconciler(configMap)
+		Expect(r.reconcileExcludeCidrsConfigMap(context.TODO(), gwConfig)).To(Succeed())
+		Expect(gwConfig.Status.ConfigMapExcludeCidrs).To(BeEmpty())
+		condition := getCondition()
+		Expect(condition.Reason).To(Equal(consts.SGCExcludeCidrsConfigMapReasonNotFound))
+		Expect(condition.Message).To(ContainSubstring(consts.ExcludeCidrsConfigMapLabel))
+	})
+
+	It("should report CIDRs conflicting with the gateway and keep last known good CIDRs", func() {
+		gwConfig.Spec.DefaultRoute = egressgatewayv1alpha1.RouteAzureNetworking
+		gwConfig.Spec.IncludeCidrs = []string{"20.1.0.0/16"}
+		gwConfig.Spec.PrivateCidrs = []string{"10.2.0.0/24"}
+		gwConfig.Status.ConfigMapExcludeCidrs = []string{"20.1.2.0/24"}
+		getTestReconciler(getConfigMap(map[string]string{"cidrs": "20.0.0.0/8\n10.0.0.0/8"}))
+		Expect(r.reconcileExcludeCidrsConfigMap(context.TODO(), gwConfig)).To(Succeed())
+		Expect(gwConfig.Status.ConfigMapExcludeCidrs).To(Equal([]string{"20.1.2.0/24"}))
+		condition := getCondition()
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(consts.SGCExcludeCidrsConfigMapReasonInvalidCidrs))
+		Expect(condition.Message).To(ContainSubstring("IncludeCidrs should not be entirely excluded by ExcludeCidrs 20.0.0.0/8"))
+		Expect(condition.Message).To(ContainSubstring("PrivateCidrs should not overlap with ExcludeCidrs 10.0.0.0/8"))
+	})
+
+	It("should only watch labeled ConfigMaps", func() {
+		configMap := getConfigMap(nil)
+		Expect(excludeCidrsConfigMapPredicate.Generic(event.GenericEvent{Object: configMap})).To(BeTrue())
+		configMap.Labels = nil
+		Expect(excludeCidrsConfigMapPredicate.Generic(event.GenericEvent{Object: configMap})).To(BeFalse())
+	})
+
+	It("should clear CIDRs and condition when the ConfigMap is no longer referenced", func() {
+		getTestReconciler(getConfigMap(map[string]string{"cidrs": "10.0.0.0/8"}))
+		Expect(r.reconcileExcludeCidrsConfigMap(context.TODO(), gwConfig)).To(Succeed())
+		gwConfig.Spec.ExcludeCidrsConfigMap = nil
+		Expect(r.reconcileExcludeCidrsConfigMap(context.TODO(), gwConfig)).To(Succeed())
+		Expect(gwConfig.Status.ConfigMapExcludeCidrs).To(BeNil())
+		Expect(gwConfig.Status.Conditions).To(BeEmpty())
+	})
+
+	It("should index gateway by referenced ConfigMap", func() {
+		Expect(excludeCidrsConfigMapIndexFunc(gwConfig)).To(Equal([]string{testNamespace + "/excludes"}))
+		gwConfig.Spec.ExcludeCidrsConfigMap = nil
+		Expect(excludeCidrsConfigMapIndexFunc(gwConfig)).To(BeEmpty())
+	})
+})
+
+var _ = Describe("test staticGatewayConfiguration reconcile pause", func() {
+	var (
+		r        *StaticGatewayConfigurationReconciler
+		gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration
+	)
+
+	getGwConfig := func() *egressgatewayv1alpha1.StaticGatewayConfiguration {
+		got := &egressgatewayv1alpha1.StaticGatewayConfiguration{}
+		Expect(r.Get(context.TODO(), client.ObjectKeyFromObject(gwConfig), got)).To(Succeed())
+		return got
+	}
+
+	BeforeEach(func() {
+		gwConfig = &egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        testName,
+				Namespace:   testNamespace,
+				UID:         "1234567890",
+				Finalizers:  []string{consts.SGCFinalizerName},
+				Annotations: map[string]string{consts.SGCReconcilePausedAnnotation: "true", consts.SGCForceReprovisionAnnotation: "1"},
+			},
+			Spec: egressgatewayv1alpha1.StaticGatewayConfigurationSpec{
+				GatewayNodepoolName: "testgw",
+				ProvisionPublicIps:  true,
+			},
+		}
+		cl := fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithObjects(gwConfig).
+			WithStatusSubresource(&egressgatewayv1alpha1.StaticGatewayConfiguration{}).
+			WithIndex(&egressgatewayv1alpha1.PodEndpoint{}, podEndpointGatewayIndex, podEndpointGatewayIndexFunc).
+			Build()
+		r = &StaticGatewayConfigurationReconciler{Client: cl, SecretNamespace: testNamespace, Recorder: record.NewFakeRecorder(10)}
+	})
+
+	It("should only report paused condition while paused and resume once unpaused", func() {
+		_, err := r.reconcile(context.TODO(), getGwConfig())
+		Expect(err).NotTo(HaveOccurred())
+		got := getGwConfig()
+		condition := meta.FindStatusCondition(got.Status.Conditions, consts.SGCPausedConditionType)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition.Reason).To(Equal(consts.SGCPausedReasonAnnotation))
+		Expect(got.Annotations).NotTo(HaveKey(consts.SGCForceReprovisionHandledAnnotation))
+		Expect(got.Status.PublicKey).To(BeEmpty())
+		err = r.Get(context.TODO(), client.ObjectKeyFromObject(gwConfig), &egressgatewayv1alpha1.GatewayLBConfiguration{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		got.Annotations[consts.SGCReconcilePausedAnnotation] = "false"
+		Expect(r.Update(context.TODO(), got)).To(Succeed())
+		_, err = r.reconcile(context.TODO(), getGwConfig())
+		Expect(err).NotTo(HaveOccurred())
+		got = getGwConfig()
+		Expect(meta.FindStatusCondition(got.Status.Conditions, consts.SGCPausedConditionType)).To(BeNil())
+		Expect(got.Annotations[consts.SGCForceReprovisionHandledAnnotation]).To(Equal("1"))
+		Expect(got.Status.PublicKey).NotTo(BeEmpty())
+		Expect(r.Get(context.TODO(), client.ObjectKeyFromObject(gwConfig), &egressgatewayv1alpha1.GatewayLBConfiguration{})).To(Succeed())
+	})
+})
+
+var _ = Describe("test staticGatewayConfiguration force reprovision", func() {
+	var (
+		r        *StaticGatewayConfigurationReconciler
+		gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration
+		lbConfig *egressgatewayv1alpha1.GatewayLBConfiguration
+	)
+
+	getTestReconciler := func(objects ...client.Object) {
+		cl := fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithObjects(objects...).
+			WithStatusSubresource(&egressgatewayv1alpha1.StaticGatewayConfiguration{}).
+			WithIndex(&egressgatewayv1alpha1.PodEndpoint{}, podEndpointGatewayIndex, podEndpointGatewayIndexFunc).
+			Build()
+		r = &StaticGatewayConfigurationReconciler{Client: cl, SecretNamespace: testNamespace, Recorder: record.NewFakeRecorder(10)}
+	}
+
+	getGwConfig := func() *egressgatewayv1alpha1.StaticGatewayConfiguration {
+		got := &egressgatewayv1alpha1.StaticGatewayConfiguration{}
+		Expect(r.Get(context.TODO(), client.ObjectKeyFromObject(gwConfig), got)).To(Succeed())
+		return got
+	}
+
+	getLBConfig := func() (*egressgatewayv1alpha1.GatewayLBConfiguration, error) {
+		got := &egressgatewayv1alpha1.GatewayLBConfiguration{}
+		err := r.Get(context.TODO(), client.ObjectKeyFromObject(gwConfig), got)
+		return got, err
+	}
+
+	BeforeEach(func() {
+		gwConfig = &egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        testName,
+				Namespace:   testNamespace,
+				UID:         "1234567890",
+				Finalizers:  []string{consts.SGCFinalizerName},
+				Annotations: map[string]string{consts.SGCForceReprovisionAnnotation: "1"},
+			},
+			Spec: egressgatewayv1alpha1.StaticGatewayConfigurationSpec{
+				GatewayNodepoolName: "testgw",
+				ProvisionPublicIps:  true,
+			},
+			Status: egressgatewayv1alpha1.StaticGatewayConfigurationStatus{
+				EgressIpPrefix:   "1.2.3.4/31",
+				GatewayInstances: 2,
+				GatewayNodes:     []string{"node0", "node1"},
+				GatewayServerProfile: egressgatewayv1alpha1.GatewayServerProfile{
+					Ip:   "10.0.0.4",
+					Port: 6000,
+				},
+			},
+		}
+		lbConfig = &egressgatewayv1alpha1.GatewayLBConfiguration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      testName,
+				Namespace: testNamespace,
+				// removed by the lb configuration controller once Azure resources are cleaned up
+				Finalizers: []string{consts.LBConfigFinalizerName},
+			},
+		}
+	})
+
+	It("should tear down gateway LB configuration and wait until it is gone", func() {
+		getTestReconciler(gwConfig, lbConfig)
+		_, err := r.reconcile(context.TODO(), getGwConfig())
+		Expect(err).NotTo(HaveOccurred())
+		got, err := getLBConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got.DeletionTimestamp.IsZero()).To(BeFalse())
+		Expect(getGwConfig().Annotations).NotTo(HaveKey(consts.SGCForceReprovisionHandledAnnotation))
+
+		// still being deleted
+		_, err = r.reconcile(context.TODO(), getGwConfig())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getGwConfig().Annotations).NotTo(HaveKey(consts.SGCForceReprovisionHandledAnnotation))
+	})
+
+	It("should record handled request and rebuild gateway once torn down", func() {
+		getTestReconciler(gwConfig)
+		_, err := r.reconcile(context.TODO(), getGwConfig())
+		Expect(err).NotTo(HaveOccurred())
+		got := getGwConfig()
+		Expect(got.Annotations[consts.SGCForceReprovisionHandledAnnotation]).To(Equal("1"))
+		Expect(got.Status.EgressIpPrefix).To(BeEmpty())
+		Expect(got.Status.Ip).To(BeEmpty())
+		Expect(got.Status.Endpoint).To(BeEmpty())
+		Expect(got.Status.GatewayInstances).To(BeZero())
+		Expect(got.Status.GatewayNodes).To(BeEmpty())
+		newLBConfig, err := getLBConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(newLBConfig.DeletionTimestamp.IsZero()).To(BeTrue())
+
+		// handled only once
+		_, err = r.reconcile(context.TODO(), getGwConfig())
+		Expect(err).NotTo(HaveOccurred())
+		newLBConfig, err = getLBConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(newLBConfig.DeletionTimestamp.IsZero()).To(BeTrue())
+	})
+
+	It("should not tear down gateway when request is already handled", func() {
+		gwConfig.Annotations[consts.SGCForceReprovisionHandledAnnotation] = "1"
+		getTestReconciler(gwConfig, lbConfig)
+		_, err := r.reconcile(context.TODO(), getGwConfig())
+		Expect(err).NotTo(HaveOccurred())
+		got, err := getLBConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got.DeletionTimestamp.IsZero()).To(BeTrue())
+	})
+})
+
+var _ = Describe("test staticGatewayConfiguration deletion", func() {
+	var (
+		r        *StaticGatewayConfigurationReconciler
+		gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration
+	)
+
+	getLease := func(name, uid string) *coordinationv1.Lease {
+		return &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: testNamespace,
+				Labels:    map[string]string{consts.OwningSGCUIDLabel: uid},
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		GinkgoT().Setenv(consts.PodNamespaceEnvKey, testNamespace)
+		gwConfig = &egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       testName,
+				Namespace:  testNamespace,
+				UID:        "1234567890",
+				Finalizers: []string{consts.SGCFinalizerName},
+			},
+		}
+		cl := fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithObjects(
+				gwConfig,
+				getLease("egress-source-ip.testns.test.1.2.3.4", "1234567890"),
+				getLease("egress-source-ip.testns.test.1.2.3.5", "1234567890"),
+				// left by another gateway
+				getLease("egress-source-ip.testns.other.1.2.3.4", "0987654321"),
+			).
+			Build()
+		r = &StaticGatewayConfigurationReconciler{Client: cl, SecretNamespace: testNamespace, Recorder: record.NewFakeRecorder(10)}
+	})
+
+	It("should delete egress source IP leases of the gateway and remove finalizer", func() {
+		Expect(r.ensureDeleted(context.TODO(), gwConfig)).To(Succeed())
+		leases := &coordinationv1.LeaseList{}
+		Expect(r.List(context.TODO(), leases, client.InNamespace(testNamespace))).To(Succeed())
+		Expect(leases.Items).To(HaveLen(1))
+		Expect(leases.Items[0].Name).To(Equal("egress-source-ip.testns.other.1.2.3.4"))
+		Expect(gwConfig.Finalizers).To(BeEmpty())
+	})
+})
@@ -0,0 +1,293 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/azmanager"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+)
+
+//+kubebuilder:webhook:path=/mutate-egressgateway-kubernetes-azure-com-v1alpha1-staticgatewayconfiguration,mutating=true,failurePolicy=fail,sideEffects=None,groups=egressgateway.kubernetes.azure.com,resources=staticgatewayconfigurations,verbs=create;update,versions=v1alpha1,name=mstaticgatewayconfiguration.kb.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-egressgateway-kubernetes-azure-com-v1alpha1-staticgatewayconfiguration,mutating=false,failurePolicy=fail,sideEffects=None,groups=egressgateway.kubernetes.azure.com,resources=staticgatewayconfigurations,verbs=create;update,versions=v1alpha1,name=vstaticgatewayconfiguration.kb.io,admissionReviewVersions=v1
+
+var _ webhook.CustomDefaulter = &StaticGatewayConfigurationDefaulter{}
+var _ webhook.CustomValidator = &StaticGatewayConfigurationValidator{}
+
+// StaticGatewayConfigurationDefaulter sets defaults of StaticGatewayConfiguration on admission
+type StaticGatewayConfigurationDefaulter struct {
+	// DefaultPublicIpPrefixSize is applied to gateway vmss profiles without public ip prefix size
+	DefaultPublicIpPrefixSize int32
+}
+
+// SetupWebhookWithManager registers the mutating webhook with the Manager.
+func (d *StaticGatewayConfigurationDefaulter) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&egressgatewayv1alpha1.StaticGatewayConfiguration{}).
+		WithDefaulter(d).
+		Complete()
+}
+
+// Default implements webhook.CustomDefaulter
+func (d *StaticGatewayConfigurationDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	gwConfig, ok := obj.(*egressgatewayv1alpha1.StaticGatewayConfiguration)
+	if !ok {
+		return fmt.Errorf("expected a StaticGatewayConfiguration but got %T", obj)
+	}
+	// the size comes from nodepool tags for gateway nodepools, and from Azure for a provided public ip prefix, it
+	// does not apply to a provided public ip address
+	profile := &gwConfig.Spec.GatewayVmssProfile
+	if gwConfig.Spec.GatewayNodepoolName == "" && gwConfig.Spec.PublicIpPrefixId == "" && gwConfig.Spec.PublicIpAddressId == "" &&
+		len(profile.VmssReferences()) > 0 && profile.PublicIpPrefixSize == 0 {
+		profile.PublicIpPrefixSize = d.DefaultPublicIpPrefixSize
+	}
+	return nil
+}
+
+// StaticGatewayConfigurationValidator rejects invalid StaticGatewayConfiguration on admission, so that
+// users get field level errors immediately instead of finding them in controller events
+type StaticGatewayConfigurationValidator struct {
+	// PodCidrs are CIDRs of the cluster pod network, which should be neither excluded from nor included in the gateway
+	PodCidrs []*net.IPNet
+	// AzureManager reads provided public ip prefixes to check their size, nil to skip the check
+	AzureManager *azmanager.AzureManager
+	// Client lists other gateways to check that traffic mirror VXLAN tunnels are unique on gateway nodes, nil to
+	// skip the check
+	Client client.Reader
+}
+
+// SetupWebhookWithManager registers the validating webhook with the Manager.
+func (v *StaticGatewayConfigurationValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&egressgatewayv1alpha1.StaticGatewayConfiguration{}).
+		WithValidator(v).
+		Complete()
+}
+
+// ValidateCreate implements webhook.CustomValidator
+func (v *StaticGatewayConfigurationValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	gwConfig, ok := obj.(*egressgatewayv1alpha1.StaticGatewayConfiguration)
+	if !ok {
+		return nil, fmt.Errorf("expected a StaticGatewayConfiguration but got %T", obj)
+	}
+	return v.validate(ctx, gwConfig, nil)
+}
+
+// ValidateUpdate implements webhook.CustomValidator
+func (v *StaticGatewayConfigurationValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldGwConfig, ok := oldObj.(*egressgatewayv1alpha1.StaticGatewayConfiguration)
+	if !ok {
+		return nil, fmt.Errorf("expected a StaticGatewayConfiguration but got %T", oldObj)
+	}
+	gwConfig, ok := newObj.(*egressgatewayv1alpha1.StaticGatewayConfiguration)
+	if !ok {
+		return nil, fmt.Errorf("expected a StaticGatewayConfiguration but got %T", newObj)
+	}
+	// objects created before the webhook is enabled may be invalid, do not block metadata updates
+	// like finalizer removal on them
+	if !gwConfig.DeletionTimestamp.IsZero() || equality.Semantic.DeepEqual(oldGwConfig.Spec, gwConfig.Spec) {
+		return nil, nil
+	}
+	// managed public ip prefixes are named differently when reused, changing it would replace the egress IPs
+	if oldGwConfig.Spec.ReusePublicIpPrefix != gwConfig.Spec.ReusePublicIpPrefix {
+		return nil, toInvalidError(gwConfig, field.ErrorList{field.Forbidden(field.NewPath("spec").Child("reusepublicipprefix"),
+			"ReusePublicIpPrefix cannot be changed after the gateway is created")})
+	}
+	// gateway Azure resources are created in the gateway subscription, changing it would orphan them
+	if oldGwConfig.Spec.GatewayVmssProfile.SubscriptionId != gwConfig.Spec.GatewayVmssProfile.SubscriptionId {
+		return nil, toInvalidError(gwConfig, field.ErrorList{field.Forbidden(field.NewPath("spec").Child("gatewayvmssprofile").Child("subscriptionid"),
+			"SubscriptionId cannot be changed after the gateway is created")})
+	}
+	return v.validate(ctx, gwConfig, oldGwConfig)
+}
+
+// ValidateDelete implements webhook.CustomValidator
+func (v *StaticGatewayConfigurationValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validate checks gwConfig, and on update against oldGwConfig, only warns about invalid values the gateway already
+// had, e.g. ones accepted before a check was added, so that they do not block unrelated changes
+func (v *StaticGatewayConfigurationValidator) validate(ctx context.Context, gwConfig, oldGwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) (admission.Warnings, error) {
+	allErrs := v.validateFields(gwConfig)
+	var warnings admission.Warnings
+	if oldGwConfig != nil {
+		allErrs, warnings = grandfatherErrors(allErrs, v.validateFields(oldGwConfig))
+	}
+	if len(allErrs) > 0 {
+		return warnings, toInvalidError(gwConfig, allErrs)
+	}
+	warnings = append(warnings, v.validateSubscriptionAccess(ctx, gwConfig)...)
+	prefixWarnings, allErrs := v.validatePublicIPPrefixSize(ctx, gwConfig)
+	warnings = append(warnings, prefixWarnings...)
+	vxlanWarnings, vxlanErrs := v.validateTrafficMirrorVxlan(ctx, gwConfig, oldGwConfig)
+	return append(warnings, vxlanWarnings...), toInvalidError(gwConfig, append(allErrs, vxlanErrs...))
+}
+
+func (v *StaticGatewayConfigurationValidator) validateFields(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) field.ErrorList {
+	allErrs := validateSpec(gwConfig)
+	allErrs = append(allErrs, v.validatePodCidrOverlap(field.NewPath("spec").Child("excludecidrs"), "ExcludeCidrs", gwConfig.Spec.ExcludeCidrs)...)
+	allErrs = append(allErrs, v.validatePodCidrOverlap(field.NewPath("spec").Child("includecidrs"), "IncludeCidrs", gwConfig.Spec.IncludeCidrs)...)
+	allErrs = append(allErrs, v.validatePodCidrOverlap(field.NewPath("spec").Child("privatecidrs"), "PrivateCidrs", gwConfig.Spec.PrivateCidrs)...)
+	return allErrs
+}
+
+// grandfatherErrors returns errors of allErrs not reported in oldErrs, and the others as warnings. Errors are matched
+// by type, detail and value regardless of list indexes, so that adding an entry before an invalid one keeps it
+// grandfathered.
+func grandfatherErrors(allErrs, oldErrs field.ErrorList) (field.ErrorList, admission.Warnings) {
+	var newErrs field.ErrorList
+	var warnings admission.Warnings
+	for _, err := range allErrs {
+		if slices.ContainsFunc(oldErrs, func(oldErr *field.Error) bool {
+			return oldErr.Type == err.Type && oldErr.Detail == err.Detail && equality.Semantic.DeepEqual(oldErr.BadValue, err.BadValue)
+		}) {
+			warnings = append(warnings, fmt.Sprintf("%s, kept as the gateway already had it", err.Error()))
+			continue
+		}
+		newErrs = append(newErrs, err)
+	}
+	return newErrs, warnings
+}
+
+// validateSubscriptionAccess warns when the controller credential cannot read the gateway VMSS in the subscription
+// specified by the gateway, access may still be granted after the gateway is created
+func (v *StaticGatewayConfigurationValidator) validateSubscriptionAccess(ctx context.Context, gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) admission.Warnings {
+	profile := gwConfig.Spec.GatewayVmssProfile
+	refs := profile.VmssReferences()
+	if v.AzureManager == nil || profile.SubscriptionId == "" || len(refs) == 0 {
+		return nil
+	}
+	az, err := gatewayAzureManager(v.AzureManager, profile)
+	if err != nil {
+		return admission.Warnings{err.Error()}
+	}
+	if _, err := az.GetVMSS(ctx, refs[0].VmssResourceGroup, refs[0].VmssName); err != nil {
+		var accessErr *subscriptionAccessError
+		if errors.As(checkSubscriptionAccess(profile, err), &accessErr) {
+			return admission.Warnings{accessErr.Error()}
+		}
+	}
+	return nil
+}
+
+// validatePublicIPPrefixSize checks that PublicIpPrefixSize matches the length of the provided public ip prefix,
+// failing to read the prefix is only a warning, the controller reports it if it persists
+func (v *StaticGatewayConfigurationValidator) validatePublicIPPrefixSize(ctx context.Context, gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) (admission.Warnings, field.ErrorList) {
+	size := gwConfig.Spec.GatewayVmssProfile.PublicIpPrefixSize
+	if v.AzureManager == nil || gwConfig.Spec.PublicIpPrefixId == "" || size == 0 {
+		return nil, nil
+	}
+	// PublicIpPrefixId is validated by validateSpec
+	resourceID, _ := arm.ParseResourceID(gwConfig.Spec.PublicIpPrefixId)
+	az, err := gatewayAzureManager(v.AzureManager, gwConfig.Spec.GatewayVmssProfile)
+	if err != nil {
+		return admission.Warnings{fmt.Sprintf("unable to check size of public ip prefix %s: %v", gwConfig.Spec.PublicIpPrefixId, err)}, nil
+	}
+	ipPrefix, err := az.GetPublicIPPrefix(ctx, resourceID.ResourceGroupName, resourceID.Name)
+	if err != nil {
+		return admission.Warnings{fmt.Sprintf("unable to check size of public ip prefix %s: %v", gwConfig.Spec.PublicIpPrefixId, err)}, nil
+	}
+	if ipPrefix.Properties == nil || ipPrefix.Properties.PrefixLength == nil || *ipPrefix.Properties.PrefixLength == size {
+		return nil, nil
+	}
+	return nil, field.ErrorList{field.Invalid(field.NewPath("spec").Child("gatewayvmssprofile").Child("publicipprefixsize"), size,
+		fmt.Sprintf("PublicIpPrefixSize should match the length(%d) of the provided public ip prefix, or be left empty", *ipPrefix.Properties.PrefixLength))}
+}
+
+// validateTrafficMirrorVxlan checks that no other gateway on the same gateway nodes mirrors to a VXLAN tunnel with
+// the same VNI and port, the daemon could not create both tunnels. Unchanged tunnels are not checked again.
+func (v *StaticGatewayConfigurationValidator) validateTrafficMirrorVxlan(
+	ctx context.Context,
+	gwConfig, oldGwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration,
+) (admission.Warnings, field.ErrorList) {
+	vxlan := getTrafficMirrorVxlan(gwConfig)
+	if v.Client == nil || vxlan == nil {
+		return nil, nil
+	}
+	if oldGwConfig != nil && equality.Semantic.DeepEqual(getTrafficMirrorVxlan(oldGwConfig), vxlan) &&
+		equality.Semantic.DeepEqual(oldGwConfig.Spec.GatewayVmssProfile, gwConfig.Spec.GatewayVmssProfile) &&
+		oldGwConfig.Spec.GatewayNodepoolName == gwConfig.Spec.GatewayNodepoolName {
+		return nil, nil
+	}
+	gwConfigList := &egressgatewayv1alpha1.StaticGatewayConfigurationList{}
+	if err := v.Client.List(ctx, gwConfigList); err != nil {
+		return admission.Warnings{fmt.Sprintf("unable to check uniqueness of traffic mirror vxlan vni %d: %v", vxlan.Vni, err)}, nil
+	}
+	for i := range gwConfigList.Items {
+		other := &gwConfigList.Items[i]
+		if other.Namespace == gwConfig.Namespace && other.Name == gwConfig.Name || !other.DeletionTimestamp.IsZero() {
+			continue
+		}
+		otherVxlan := getTrafficMirrorVxlan(other)
+		if otherVxlan == nil || otherVxlan.Vni != vxlan.Vni || otherVxlan.Port != vxlan.Port || !shareGatewayNodes(gwConfig, other) {
+			continue
+		}
+		return nil, field.ErrorList{field.Invalid(field.NewPath("spec").Child("trafficmirror").Child("vxlan").Child("vni"), vxlan.Vni,
+			fmt.Sprintf("Vni is already used with port %d by StaticGatewayConfiguration %s/%s on the same gateway nodes", vxlan.Port, other.Namespace, other.Name))}
+	}
+	return nil, nil
+}
+
+// getTrafficMirrorVxlan returns the traffic mirror VXLAN tunnel of gwConfig with the default port applied, or nil
+func getTrafficMirrorVxlan(gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration) *egressgatewayv1alpha1.TrafficMirrorVxlan {
+	if gwConfig.Spec.TrafficMirror == nil || gwConfig.Spec.TrafficMirror.Vxlan == nil {
+		return nil
+	}
+	vxlan := gwConfig.Spec.TrafficMirror.Vxlan.DeepCopy()
+	if vxlan.Port == 0 {
+		vxlan.Port = consts.DefaultTrafficMirrorVxlanPort
+	}
+	return vxlan
+}
+
+// shareGatewayNodes returns whether gateways a and b are deployed on the same gateway nodepool or VMSS
+func shareGatewayNodes(a, b *egressgatewayv1alpha1.StaticGatewayConfiguration) bool {
+	if a.Spec.GatewayNodepoolName != "" {
+		return a.Spec.GatewayNodepoolName == b.Spec.GatewayNodepoolName
+	}
+	if !strings.EqualFold(a.Spec.GatewayVmssProfile.SubscriptionId, b.Spec.GatewayVmssProfile.SubscriptionId) {
+		return false
+	}
+	for _, ref := range a.Spec.GatewayVmssProfile.VmssReferences() {
+		if slices.ContainsFunc(b.Spec.GatewayVmssProfile.VmssReferences(), func(other egressgatewayv1alpha1.VmssReference) bool { return sameVMSS(other, ref) }) {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *StaticGatewayConfigurationValidator) validatePodCidrOverlap(path *field.Path, fieldName string, cidrs []string) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			// already reported by validateSpec
+			continue
+		}
+		for _, podCidr := range v.PodCidrs {
+			if podCidr.Contains(ipNet.IP) || ipNet.Contains(podCidr.IP) {
+				allErrs = append(allErrs, field.Invalid(path.Index(i), cidr,
+					fmt.Sprintf("%s should not overlap with pod CIDR %s", fieldName, podCidr.String())))
+			}
+		}
+	}
+	return allErrs
+}
@@ -0,0 +1,270 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package manager
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	network "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/publicipprefixclient/mock_publicipprefixclient"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
+)
+
+var _ = Describe("test staticGatewayConfiguration defaulting webhook", func() {
+	var (
+		d        *StaticGatewayConfigurationDefaulter
+		gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration
+	)
+
+	BeforeEach(func() {
+		d = &StaticGatewayConfigurationDefaulter{DefaultPublicIpPrefixSize: 30}
+		gwConfig = &egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      testName,
+				Namespace: testNamespace,
+			},
+			Spec: egressgatewayv1alpha1.StaticGatewayConfigurationSpec{
+				GatewayVmssProfile: egressgatewayv1alpha1.GatewayVmssProfile{
+					VmssResourceGroup: "vmssRG",
+					VmssName:          "vmss",
+				},
+				ProvisionPublicIps: true,
+			},
+		}
+	})
+
+	It("should default PublicIpPrefixSize of gateway vmss profile", func() {
+		Expect(d.Default(context.TODO(), gwConfig)).To(Succeed())
+		Expect(gwConfig.Spec.GatewayVmssProfile.PublicIpPrefixSize).To(Equal(int32(30)))
+	})
+
+	It("should keep specified PublicIpPrefixSize", func() {
+		gwConfig.Spec.GatewayVmssProfile.PublicIpPrefixSize = 28
+		Expect(d.Default(context.TODO(), gwConfig)).To(Succeed())
+		Expect(gwConfig.Spec.GatewayVmssProfile.PublicIpPrefixSize).To(Equal(int32(28)))
+	})
+
+	It("should not default PublicIpPrefixSize when PublicIpPrefixId is provided", func() {
+		gwConfig.Spec.PublicIpPrefixId = "/subscriptions/testSub/resourceGroups/testRG/providers/Microsoft.Network/publicIPPrefixes/prefix"
+		Expect(d.Default(context.TODO(), gwConfig)).To(Succeed())
+		Expect(gwConfig.Spec.GatewayVmssProfile.PublicIpPrefixSize).To(BeZero())
+	})
+
+	It("should not default PublicIpPrefixSize when PublicIpAddressId is provided", func() {
+		gwConfig.Spec.PublicIpAddressId = "/subscriptions/testSub/resourceGroups/testRG/providers/Microsoft.Network/publicIPAddresses/ip"
+		Expect(d.Default(context.TODO(), gwConfig)).To(Succeed())
+		Expect(gwConfig.Spec.GatewayVmssProfile.PublicIpPrefixSize).To(BeZero())
+	})
+
+	It("should not default PublicIpPrefixSize of gateway nodepool", func() {
+		gwConfig.Spec.GatewayVmssProfile = egressgatewayv1alpha1.GatewayVmssProfile{}
+		gwConfig.Spec.GatewayNodepoolName = "gwnodepool"
+		Expect(d.Default(context.TODO(), gwConfig)).To(Succeed())
+		Expect(gwConfig.Spec.GatewayVmssProfile.PublicIpPrefixSize).To(BeZero())
+	})
+})
+
+var _ = Describe("test staticGatewayConfiguration validating webhook", func() {
+	var (
+		v        *StaticGatewayConfigurationValidator
+		gwConfig *egressgatewayv1alpha1.StaticGatewayConfiguration
+	)
+
+	BeforeEach(func() {
+		_, podCidr, _ := net.ParseCIDR("10.244.0.0/16")
+		v = &StaticGatewayConfigurationValidator{PodCidrs: []*net.IPNet{podCidr}}
+		gwConfig = &egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      testName,
+				Namespace: testNamespace,
+			},
+			Spec: egressgatewayv1alpha1.StaticGatewayConfigurationSpec{
+				GatewayVmssProfile: egressgatewayv1alpha1.GatewayVmssProfile{
+					VmssResourceGroup:  "vmssRG",
+					VmssName:           "vmss",
+					PublicIpPrefixSize: 31,
+				},
+				ProvisionPublicIps: true,
+				ExcludeCidrs:       []string{"10.0.0.0/16"},
+			},
+		}
+	})
+
+	It("should allow valid StaticGatewayConfiguration", func() {
+		_, err := v.ValidateCreate(context.TODO(), gwConfig)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	It("should reject StaticGatewayConfiguration failing spec validation", func() {
+		gwConfig.Spec.ExcludeCidrs = []string{"10.0.0.1"}
+		_, err := v.ValidateCreate(context.TODO(), gwConfig)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+	})
+
+	It("should reject ExcludeCidrs overlapping with pod CIDR", func() {
+		gwConfig.Spec.ExcludeCidrs = []string{"10.0.0.0/16", "10.244.1.0/24", "10.0.0.0/8"}
+		_, err := v.ValidateCreate(context.TODO(), gwConfig)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.excludecidrs[1]"))
+		Expect(err.Error()).To(ContainSubstring("spec.excludecidrs[2]"))
+		Expect(err.Error()).NotTo(ContainSubstring("spec.excludecidrs[0]"))
+	})
+
+	It("should reject IncludeCidrs overlapping with pod CIDR", func() {
+		gwConfig.Spec.DefaultRoute = egressgatewayv1alpha1.RouteAzureNetworking
+		gwConfig.Spec.IncludeCidrs = []string{"10.0.0.0/8"}
+		_, err := v.ValidateCreate(context.TODO(), gwConfig)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.includecidrs[0]"))
+	})
+
+	It("should reject update introducing invalid spec", func() {
+		newGwConfig := gwConfig.DeepCopy()
+		newGwConfig.Spec.ExcludeCidrs = append(newGwConfig.Spec.ExcludeCidrs, "10.0.0.0/16")
+		_, err := v.ValidateUpdate(context.TODO(), gwConfig, newGwConfig)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+	})
+
+	It("should only warn about invalid values the gateway already had on update", func() {
+		gwConfig.Spec.ExcludeCidrs = []string{"10.0.0.1", "10.244.1.0/24"}
+		newGwConfig := gwConfig.DeepCopy()
+		newGwConfig.Spec.ExcludeCidrs = []string{"192.168.0.0/16", "10.0.0.1", "10.244.1.0/24"}
+		warnings, err := v.ValidateUpdate(context.TODO(), gwConfig, newGwConfig)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(warnings).To(HaveLen(2))
+		Expect(warnings[0]).To(ContainSubstring("spec.excludecidrs[1]"))
+		Expect(warnings[0]).To(ContainSubstring("kept as the gateway already had it"))
+
+		// new invalid values are still rejected
+		newGwConfig.Spec.ExcludeCidrs = append(newGwConfig.Spec.ExcludeCidrs, "10.0.0.2")
+		_, err = v.ValidateUpdate(context.TODO(), gwConfig, newGwConfig)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.excludecidrs[3]"))
+		Expect(err.Error()).NotTo(ContainSubstring("spec.excludecidrs[1]"))
+	})
+
+	It("should reject update changing ReusePublicIpPrefix", func() {
+		newGwConfig := gwConfig.DeepCopy()
+		newGwConfig.Spec.ReusePublicIpPrefix = true
+		_, err := v.ValidateUpdate(context.TODO(), gwConfig, newGwConfig)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("ReusePublicIpPrefix cannot be changed"))
+	})
+
+	It("should reject update changing SubscriptionId", func() {
+		newGwConfig := gwConfig.DeepCopy()
+		newGwConfig.Spec.GatewayVmssProfile.SubscriptionId = "gatewaySub"
+		_, err := v.ValidateUpdate(context.TODO(), gwConfig, newGwConfig)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.gatewayvmssprofile.subscriptionid"))
+		Expect(err.Error()).To(ContainSubstring("SubscriptionId cannot be changed"))
+	})
+
+	It("should allow update not changing spec of invalid StaticGatewayConfiguration", func() {
+		gwConfig.Spec.ExcludeCidrs = []string{"10.244.0.0/16"}
+		newGwConfig := gwConfig.DeepCopy()
+		newGwConfig.Finalizers = []string{"test-finalizer"}
+		_, err := v.ValidateUpdate(context.TODO(), gwConfig, newGwConfig)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	It("should allow update of deleting StaticGatewayConfiguration", func() {
+		newGwConfig := gwConfig.DeepCopy()
+		newGwConfig.Spec.ExcludeCidrs = []string{"10.244.0.0/16"}
+		newGwConfig.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		_, err := v.ValidateUpdate(context.TODO(), gwConfig, newGwConfig)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	Context("with provided public ip prefix", func() {
+		var mockPublicIPPrefixClient *mock_publicipprefixclient.MockInterface
+
+		BeforeEach(func() {
+			mctrl := gomock.NewController(GinkgoT())
+			v.AzureManager = getMockAzureManager(mctrl)
+			mockPublicIPPrefixClient = v.AzureManager.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+			gwConfig.Spec.PublicIpPrefixId = "/subscriptions/testSub/resourceGroups/prefixRG/providers/Microsoft.Network/publicIPPrefixes/prefix"
+		})
+
+		It("should allow PublicIpPrefixSize matching the prefix", func() {
+			mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), "prefixRG", "prefix", gomock.Any()).
+				Return(&network.PublicIPPrefix{Properties: &network.PublicIPPrefixPropertiesFormat{PrefixLength: to.Ptr(int32(31))}}, nil)
+			warnings, err := v.ValidateCreate(context.TODO(), gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(warnings).To(BeEmpty())
+		})
+
+		It("should reject PublicIpPrefixSize not matching the prefix", func() {
+			mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), "prefixRG", "prefix", gomock.Any()).
+				Return(&network.PublicIPPrefix{Properties: &network.PublicIPPrefixPropertiesFormat{PrefixLength: to.Ptr(int32(30))}}, nil)
+			_, err := v.ValidateCreate(context.TODO(), gwConfig)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.gatewayvmssprofile.publicipprefixsize"))
+		})
+
+		It("should warn when the prefix cannot be read", func() {
+			mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), "prefixRG", "prefix", gomock.Any()).Return(nil, fmt.Errorf("forbidden"))
+			warnings, err := v.ValidateCreate(context.TODO(), gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(warnings).To(HaveLen(1))
+		})
+
+		It("should skip the check without PublicIpPrefixSize", func() {
+			gwConfig.Spec.GatewayVmssProfile.PublicIpPrefixSize = 0
+			_, err := v.ValidateCreate(context.TODO(), gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("traffic mirror vxlan", func() {
+		var other *egressgatewayv1alpha1.StaticGatewayConfiguration
+
+		BeforeEach(func() {
+			gwConfig.Spec.TrafficMirror = &egressgatewayv1alpha1.TrafficMirror{
+				Vxlan: &egressgatewayv1alpha1.TrafficMirrorVxlan{CollectorIp: "10.1.0.100", Vni: 100},
+			}
+			other = gwConfig.DeepCopy()
+			other.Name = "other"
+			other.Spec.TrafficMirror.Vxlan.Port = 4789
+			v.Client = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(other).Build()
+		})
+
+		It("should reject VNI and port used by another gateway on the same nodes", func() {
+			_, err := v.ValidateCreate(context.TODO(), gwConfig)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.trafficmirror.vxlan.vni"))
+			Expect(err.Error()).To(ContainSubstring("StaticGatewayConfiguration testns/other"))
+		})
+
+		It("should allow VNI used with another port or on other nodes", func() {
+			gwConfig.Spec.TrafficMirror.Vxlan.Port = 4790
+			_, err := v.ValidateCreate(context.TODO(), gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			gwConfig.Spec.TrafficMirror.Vxlan.Port = 0
+			gwConfig.Spec.GatewayVmssProfile.VmssName = "vmss2"
+			_, err = v.ValidateCreate(context.TODO(), gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should not check unchanged tunnels again", func() {
+			oldGwConfig := gwConfig.DeepCopy()
+			gwConfig.Spec.ExcludeCidrs = append(gwConfig.Spec.ExcludeCidrs, "10.1.0.0/16")
+			_, err := v.ValidateUpdate(context.TODO(), oldGwConfig, gwConfig)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,55 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/azmanager"
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients"
+)
+
+var subscriptionIDRE = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// subscriptionAccessError is returned when the controller credential is not authorized in the subscription of the
+// gateway VMSSes, so that users know to grant access instead of getting an opaque Azure error
+type subscriptionAccessError struct {
+	subscriptionID string
+	err            error
+}
+
+func (e *subscriptionAccessError) Error() string {
+	return fmt.Sprintf("controller credential has no access to gateway subscription(%s), grant it access to the gateway "+
+		"vmss and public ip prefix resource groups in the subscription: %v", e.subscriptionID, e.err)
+}
+
+func (e *subscriptionAccessError) Unwrap() error {
+	return e.err
+}
+
+// gatewayAzureManager returns the AzureManager calling Azure in the subscription of the gateway VMSSes of profile,
+// which is az unless the profile specifies another subscription. VMSSes and managed public ip prefixes of such
+// gateways default to the resource group of the first VMSS.
+func gatewayAzureManager(az *azmanager.AzureManager, profile egressgatewayv1alpha1.GatewayVmssProfile) (*azmanager.AzureManager, error) {
+	if profile.SubscriptionId == "" {
+		return az, nil
+	}
+	var resourceGroup string
+	if refs := profile.VmssReferences(); len(refs) > 0 {
+		resourceGroup = refs[0].VmssResourceGroup
+	}
+	return az.ForSubscription(profile.SubscriptionId, resourceGroup)
+}
+
+// checkSubscriptionAccess returns a subscriptionAccessError when err is an authorization failure of an Azure call
+// in the gateway subscription of profile, err otherwise
+func checkSubscriptionAccess(profile egressgatewayv1alpha1.GatewayVmssProfile, err error) error {
+	if profile.SubscriptionId != "" && errors.As(azureclients.ConvertError(err), new(*azureclients.ErrForbidden)) {
+		return &subscriptionAccessError{subscriptionID: profile.SubscriptionId, err: err}
+	}
+	return err
+}
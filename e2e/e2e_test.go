@@ -93,8 +93,7 @@ var _ = Describe("Test staticGatewayConfiguration deployment", func() {
 		utils.Logf("Get pod egress IP: %s", podEgressIP)
 
 		By("Checking pod egress IP belongs to egress gateway outbound IP range")
-		_, ipNet, _ := net.ParseCIDR(pipPrefix)
-		Expect(ipNet.Contains(net.ParseIP(podEgressIP))).To(BeTrue())
+		Expect(utils.EgressIPPrefixContains(pipPrefix, podEgressIP)).To(BeTrue())
 
 		By("Creating a test pod NOT using egress gateway")
 		pod2 := utils.CreateCurlPodManifest(testns, "", "ifconfig.me")
@@ -105,7 +104,7 @@ var _ = Describe("Test staticGatewayConfiguration deployment", func() {
 		utils.Logf("Get pod egress IP: %s", podEgressIP2)
 
 		By("Checking pod egress IP DOES NOT belong to egress gateway outbound IP range")
-		Expect(ipNet.Contains(net.ParseIP(podEgressIP2))).To(BeFalse())
+		Expect(utils.EgressIPPrefixContains(pipPrefix, podEgressIP2)).To(BeFalse())
 	})
 
 	It("should support BYO public ip prefix as gateway configuration", func() {
@@ -247,8 +246,7 @@ var _ = Describe("Test staticGatewayConfiguration deployment", func() {
 		utils.Logf("Get pod egress IP: %s", podEgressIP)
 
 		By("Checking pod egress IP DOES NOT belong to egress gateway outbound IP range")
-		_, ipNet, _ := net.ParseCIDR(pipPrefix)
-		Expect(ipNet.Contains(net.ParseIP(podEgressIP))).To(BeFalse())
+		Expect(utils.EgressIPPrefixContains(pipPrefix, podEgressIP)).To(BeFalse())
 	})
 
 	It("should support multiple gateways and pods", func() {
@@ -291,11 +289,100 @@ var _ = Describe("Test staticGatewayConfiguration deployment", func() {
 			utils.Logf("Get pod egress IP: %s", podEgressIP)
 
 			By("Checking pod egress IP belongs to egress gateway outbound IP range")
-			_, ipNet, _ := net.ParseCIDR(prefixes[name])
-			Expect(ipNet.Contains(net.ParseIP(podEgressIP))).To(BeTrue())
+			Expect(utils.EgressIPPrefixContains(prefixes[name], podEgressIP)).To(BeTrue())
 		}
 	})
 
+	It("should remove gateway peer after pod deletion", func() {
+		rg, vmss, _, prefixLen, err := utils.GetGatewayVmssProfile(k8sClient)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("Creating a StaticGatewayConfiguration")
+		sgw := &v1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "sgw1",
+				Namespace: testns,
+			},
+			Spec: v1alpha1.StaticGatewayConfigurationSpec{
+				GatewayVmssProfile: v1alpha1.GatewayVmssProfile{
+					VmssResourceGroup:  rg,
+					VmssName:           vmss,
+					PublicIpPrefixSize: prefixLen,
+				},
+				ProvisionPublicIps: true,
+			},
+		}
+		err = utils.CreateK8sObject(sgw, k8sClient)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = utils.WaitStaticGatewayProvision(sgw, k8sClient)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("Creating a test pod using the gateway")
+		pod := utils.CreateCurlPodManifest(testns, "sgw1", "ifconfig.me")
+		err = utils.CreateK8sObject(pod, k8sClient)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = utils.GetExpectedPodLog(pod, podLogClient, podIPRE)
+		Expect(err).NotTo(HaveOccurred())
+		peerCount, err := utils.GetGatewayPeerCount(sgw, k8sClient)
+		Expect(err).NotTo(HaveOccurred())
+		utils.Logf("Gateway has %d peers", peerCount)
+		Expect(peerCount).To(BeNumerically(">", 0))
+
+		By("Deleting the test pod")
+		err = k8sClient.Delete(context.Background(), pod)
+		Expect(err).NotTo(HaveOccurred())
+		err = utils.WaitPodEndpointDeletion(pod, k8sClient)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("Checking gateway peer count drops")
+		newPeerCount, err := utils.GetGatewayPeerCount(sgw, k8sClient)
+		Expect(err).NotTo(HaveOccurred())
+		utils.Logf("Gateway has %d peers", newPeerCount)
+		Expect(newPeerCount).To(BeNumerically("<", peerCount))
+	})
+
+	It("should keep pod source ports when egressing from the gateway", func() {
+		rg, vmss, _, prefixLen, err := utils.GetGatewayVmssProfile(k8sClient)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("Creating a StaticGatewayConfiguration")
+		sgw := &v1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "sgw1",
+				Namespace: testns,
+			},
+			Spec: v1alpha1.StaticGatewayConfigurationSpec{
+				GatewayVmssProfile: v1alpha1.GatewayVmssProfile{
+					VmssResourceGroup:  rg,
+					VmssName:           vmss,
+					PublicIpPrefixSize: prefixLen,
+				},
+				ProvisionPublicIps: true,
+			},
+		}
+		err = utils.CreateK8sObject(sgw, k8sClient)
+		Expect(err).NotTo(HaveOccurred())
+		pipPrefix, err := utils.WaitStaticGatewayProvision(sgw, k8sClient)
+		Expect(err).NotTo(HaveOccurred())
+		utils.Logf("Got egress gateway prefix: %s", pipPrefix)
+
+		By("Creating a test pod with a custom local port range")
+		minPort, maxPort := 40000, 40099
+		pod := utils.CreateSourcePortPodManifest(testns, "sgw1", minPort, maxPort)
+		err = utils.CreateK8sObject(pod, k8sClient)
+		Expect(err).NotTo(HaveOccurred())
+		podEgressIP, podSourcePort, err := utils.GetPodEgressSourcePort(pod, podLogClient)
+		Expect(err).NotTo(HaveOccurred())
+		utils.Logf("Get pod egress IP: %s, source port: %d", podEgressIP, podSourcePort)
+
+		By("Checking pod egress IP belongs to egress gateway outbound IP range")
+		Expect(utils.EgressIPPrefixContains(pipPrefix, podEgressIP)).To(BeTrue())
+
+		By("Checking pod source port is not translated by the gateway")
+		Expect(podSourcePort).To(BeNumerically(">=", minPort))
+		Expect(podSourcePort).To(BeNumerically("<=", maxPort))
+	})
+
 	It("should allow default route as AzureNetworking and disabling public egress", func() {
 		rg, vmss, _, prefixLen, err := utils.GetGatewayVmssProfile(k8sClient)
 		Expect(err).NotTo(HaveOccurred())
@@ -335,6 +422,75 @@ var _ = Describe("Test staticGatewayConfiguration deployment", func() {
 		By("Checking pod egress IP DOES NOT belong to egress gateway outbound IP range")
 		Expect(egressIPs).ShouldNot(ContainElement(podEgressIP))
 	})
+
+	It("should keep existing pods egressing when a gateway node fails", func() {
+		gatewayNodes, err := utils.GetGatewayNodes(k8sClient)
+		Expect(err).NotTo(HaveOccurred())
+		if len(gatewayNodes) < 2 {
+			Skip("at least 2 gateway nodes are required to fail over")
+		}
+		rg, vmss, _, prefixLen, err := utils.GetGatewayVmssProfile(k8sClient)
+		Expect(err).NotTo(HaveOccurred())
+		vmClient, err := utils.CreateVmssVMClient()
+		Expect(err).NotTo(HaveOccurred())
+
+		By("Creating a StaticGatewayConfiguration")
+		sgw := &v1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "sgw1",
+				Namespace: testns,
+			},
+			Spec: v1alpha1.StaticGatewayConfigurationSpec{
+				GatewayVmssProfile: v1alpha1.GatewayVmssProfile{
+					VmssResourceGroup:  rg,
+					VmssName:           vmss,
+					PublicIpPrefixSize: prefixLen,
+				},
+				ProvisionPublicIps: true,
+			},
+		}
+		err = utils.CreateK8sObject(sgw, k8sClient)
+		Expect(err).NotTo(HaveOccurred())
+		pipPrefix, err := utils.WaitStaticGatewayProvision(sgw, k8sClient)
+		Expect(err).NotTo(HaveOccurred())
+		utils.Logf("Got egress gateway prefix: %s", pipPrefix)
+
+		By("Creating a test pod egressing continuously")
+		pod := utils.CreateCurlLoopPodManifest(testns, "sgw1", "ifconfig.me")
+		err = utils.CreateK8sObject(pod, k8sClient)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = utils.WaitGetPodIP(pod, podLogClient)
+		Expect(err).NotTo(HaveOccurred())
+		podEgressIP, err := utils.GetExpectedPodLogSince(pod, podLogClient, metav1.Now(), podIPRE)
+		Expect(err).NotTo(HaveOccurred())
+		utils.Logf("Get pod egress IP: %s", podEgressIP)
+		Expect(utils.EgressIPPrefixContains(pipPrefix, podEgressIP)).To(BeTrue())
+
+		By("Failing the gateway node serving the pod")
+		failedNode := &gatewayNodes[0]
+		podEndpoint := &v1alpha1.PodEndpoint{}
+		err = k8sClient.Get(context.Background(), client.ObjectKeyFromObject(pod), podEndpoint)
+		Expect(err).NotTo(HaveOccurred())
+		for i := range gatewayNodes {
+			if gatewayNodes[i].Name == podEndpoint.Status.GatewayNode {
+				failedNode = &gatewayNodes[i]
+			}
+		}
+		restore, err := utils.SimulateGatewayNodeFailure(failedNode, vmClient, k8sClient)
+		if restore != nil {
+			DeferCleanup(func() {
+				Expect(restore()).To(Succeed())
+			})
+		}
+		Expect(err).NotTo(HaveOccurred())
+		failedAt := metav1.Now()
+
+		By("Checking the pod keeps egressing from the gateway")
+		podEgressIP, err = utils.GetExpectedPodLogSince(pod, podLogClient, failedAt, podIPRE)
+		Expect(err).NotTo(HaveOccurred())
+		utils.Logf("Get pod egress IP after gateway node %s failed: %s", failedNode.Name, podEgressIP)
+		Expect(utils.EgressIPPrefixContains(pipPrefix, podEgressIP)).To(BeTrue())
+	})
 })
 
 func genTestNamespace() string {
@@ -0,0 +1,86 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
+)
+
+// GetGatewayNodes returns the nodes of the gateway nodepool
+func GetGatewayNodes(c client.Client) ([]corev1.Node, error) {
+	nodes := &corev1.NodeList{}
+	if err := c.List(context.Background(), nodes, client.MatchingLabels{"kubeegressgateway.azure.com/mode": "true"}); err != nil {
+		return nil, err
+	}
+	return nodes.Items, nil
+}
+
+// SimulateGatewayNodeFailure powers off the VMSS instance of the gateway node without graceful shutdown, so
+// that the gateway daemon cannot drain it, and waits until the node turns not ready. The returned function starts
+// the instance again and waits until the node is ready, it should be called in cleanup even if the test fails.
+func SimulateGatewayNodeFailure(node *corev1.Node, vmClient *armcompute.VirtualMachineScaleSetVMsClient, c client.Client) (func() error, error) {
+	matches := vmssVMProviderIDRE.FindStringSubmatch(node.Spec.ProviderID)
+	if len(matches) != 4 {
+		return nil, fmt.Errorf("gateway node providerID (%s) is not valid", node.Spec.ProviderID)
+	}
+	resourceGroup, vmssName, instanceID := matches[1], matches[2], matches[3]
+
+	restore := func() error {
+		Logf("Starting gateway node %s", node.Name)
+		poller, err := vmClient.BeginStart(context.Background(), resourceGroup, vmssName, instanceID, nil)
+		if err != nil {
+			return fmt.Errorf("failed to start vmss instance %s/%s: %w", vmssName, instanceID, err)
+		}
+		if _, err := poller.PollUntilDone(context.Background(), nil); err != nil {
+			return fmt.Errorf("failed to start vmss instance %s/%s: %w", vmssName, instanceID, err)
+		}
+		return waitNodeReady(node.Name, true, c)
+	}
+
+	Logf("Powering off gateway node %s", node.Name)
+	poller, err := vmClient.BeginPowerOff(context.Background(), resourceGroup, vmssName, instanceID, &armcompute.VirtualMachineScaleSetVMsClientBeginPowerOffOptions{
+		SkipShutdown: to.Ptr(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to power off vmss instance %s/%s: %w", vmssName, instanceID, err)
+	}
+	if _, err := poller.PollUntilDone(context.Background(), nil); err != nil {
+		// the instance may be stopped partially, let the caller start it again
+		return restore, fmt.Errorf("failed to power off vmss instance %s/%s: %w", vmssName, instanceID, err)
+	}
+	if err := waitNodeReady(node.Name, false, c); err != nil {
+		return restore, err
+	}
+	return restore, nil
+}
+
+// waitNodeReady waits until the Ready condition of the node is the expected one
+func waitNodeReady(name string, ready bool, c client.Client) error {
+	if err := wait.PollUntilContextTimeout(context.Background(), poll, pollTimeoutForProvision, true, func(ctx context.Context) (bool, error) {
+		node := &corev1.Node{}
+		if err := c.Get(ctx, client.ObjectKey{Name: name}, node); err != nil {
+			if retriable(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		for _, cond := range node.Status.Conditions {
+			if cond.Type == corev1.NodeReady {
+				return (cond.Status == corev1.ConditionTrue) == ready, nil
+			}
+		}
+		return !ready, nil
+	}); err != nil {
+		return fmt.Errorf("node %s does not become ready=%t: %w", name, ready, err)
+	}
+	return nil
+}
@@ -5,8 +5,10 @@ package utils
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"regexp"
+	"strconv"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -42,6 +44,52 @@ func CreateCurlPodManifest(nsName, gwName, curlTarget string) *corev1.Pod {
 	}
 }
 
+// CreateCurlLoopPodManifest returns a pod requesting curlTarget every 5 seconds until it is deleted, printing each
+// response on its own line, to check that egress of a running pod survives gateway changes
+func CreateCurlLoopPodManifest(nsName, gwName, curlTarget string) *corev1.Pod {
+	pod := CreateCurlPodManifest(nsName, gwName, curlTarget)
+	pod.Spec.Containers[0].Command = []string{
+		"/bin/sh", "-c", "while true; do curl -s -m 5 " + curlTarget + "; echo; sleep 5; done",
+	}
+	return pod
+}
+
+// SourcePortEchoTarget echoes the source IP and port a request is received from as JSON
+const SourcePortEchoTarget = "ifconfig.me/all.json"
+
+var echoRespRE = regexp.MustCompile(`(?s)\{.*\}`)
+
+// CreateSourcePortPodManifest returns a pod requesting SourcePortEchoTarget with local ports limited to
+// [minPort, maxPort], so that the source port seen by the echo endpoint tells whether it was translated
+func CreateSourcePortPodManifest(nsName, gwName string, minPort, maxPort int) *corev1.Pod {
+	pod := CreateCurlPodManifest(nsName, gwName, SourcePortEchoTarget)
+	pod.Spec.SecurityContext = &corev1.PodSecurityContext{
+		Sysctls: []corev1.Sysctl{{Name: "net.ipv4.ip_local_port_range", Value: fmt.Sprintf("%d %d", minPort, maxPort)}},
+	}
+	return pod
+}
+
+// GetPodEgressSourcePort returns the source IP and port SourcePortEchoTarget received the request of a pod
+// created by CreateSourcePortPodManifest from
+func GetPodEgressSourcePort(pod *corev1.Pod, c clientset.Interface) (string, int, error) {
+	resp, err := GetExpectedPodLog(pod, c, echoRespRE)
+	if err != nil {
+		return "", 0, err
+	}
+	echo := struct {
+		IP   string      `json:"ip_addr"`
+		Port json.Number `json:"port"`
+	}{}
+	if err := json.Unmarshal([]byte(resp), &echo); err != nil {
+		return "", 0, fmt.Errorf("failed to parse echo response %q: %w", resp, err)
+	}
+	port, err := strconv.Atoi(echo.Port.String())
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to parse source port in echo response %q: %w", resp, err)
+	}
+	return echo.IP, port, nil
+}
+
 func CreateNginxPodManifest(nsName, gwName string) *corev1.Pod {
 	annotations := make(map[string]string)
 	if gwName != "" {
@@ -114,6 +162,25 @@ func GetExpectedPodLog(pod *corev1.Pod, c clientset.Interface, expectLogRegex *r
 	return found, nil
 }
 
+// GetExpectedPodLogSince waits until the log of the running pod written after since matches expectLogRegex, and
+// returns the first match
+func GetExpectedPodLogSince(pod *corev1.Pod, c clientset.Interface, since metav1.Time, expectLogRegex *regexp.Regexp) (string, error) {
+	var log []byte
+	err := wait.PollUntilContextTimeout(context.Background(), poll, pollTimeoutForProvision, true, func(ctx context.Context) (bool, error) {
+		var err error
+		log, err = getPodLog(c, pod.Name, pod.Namespace, &corev1.PodLogOptions{SinceTime: &since})
+		if err != nil {
+			Logf("Got %v when retrieving test pod log, retrying", err)
+			return false, nil
+		}
+		return expectLogRegex.Match(log), nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return expectLogRegex.FindString(string(log)), nil
+}
+
 func WaitGetPodIP(pod *corev1.Pod, c clientset.Interface) (string, error) {
 	var podIP string
 	err := wait.PollUntilContextTimeout(context.Background(), poll, pollTimeout, true, func(ctx context.Context) (bool, error) {
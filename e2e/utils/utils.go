@@ -6,12 +6,14 @@ package utils
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"regexp"
 	"strings"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
 	corev1 "k8s.io/api/core/v1"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -44,7 +46,7 @@ const (
 )
 
 var (
-	vmssVMProviderIDRE = regexp.MustCompile(`azure:///subscriptions/(?:.*)/resourceGroups/(.+)/providers/Microsoft.Compute/virtualMachineScaleSets/(.+)/virtualMachines/(?:\d+)`)
+	vmssVMProviderIDRE = regexp.MustCompile(`azure:///subscriptions/(?:.*)/resourceGroups/(.+)/providers/Microsoft.Compute/virtualMachineScaleSets/(.+)/virtualMachines/(\d+)`)
 )
 
 func CreateK8sClient() (k8sClient client.Client, podLogClient clientset.Interface, err error) {
@@ -61,13 +63,31 @@ func CreateK8sClient() (k8sClient client.Client, podLogClient clientset.Interfac
 }
 
 func CreateAzureClients() (azclient.ClientFactory, error) {
+	subscriptionID, armConfig, cred, err := createAzureCredential()
+	if err != nil {
+		return nil, err
+	}
+	return azclient.NewClientFactory(&azclient.ClientFactoryConfig{SubscriptionID: subscriptionID}, armConfig, cred)
+}
+
+// CreateVmssVMClient returns an Azure SDK client of VMSS instances, which supports power operations the
+// azclient factory does not
+func CreateVmssVMClient() (*armcompute.VirtualMachineScaleSetVMsClient, error) {
+	subscriptionID, _, cred, err := createAzureCredential()
+	if err != nil {
+		return nil, err
+	}
+	return armcompute.NewVirtualMachineScaleSetVMsClient(subscriptionID, cred, nil)
+}
+
+func createAzureCredential() (string, *azclient.ARMClientConfig, azcore.TokenCredential, error) {
 	var subscriptionID, tenantID, clientID, clientSecret, managedIdentityClientID string
 	var cred azcore.TokenCredential
 	if subscriptionID = os.Getenv(SubscriptionIDEnv); subscriptionID == "" {
-		return nil, fmt.Errorf(SubscriptionIDEnv + " is not set")
+		return "", nil, nil, fmt.Errorf(SubscriptionIDEnv + " is not set")
 	}
 	if tenantID = os.Getenv(TenantIDEnv); tenantID == "" {
-		return nil, fmt.Errorf(TenantIDEnv + " is not set")
+		return "", nil, nil, fmt.Errorf(TenantIDEnv + " is not set")
 	}
 
 	armConfig := &azclient.ARMClientConfig{
@@ -89,14 +109,14 @@ func CreateAzureClients() (azclient.ClientFactory, error) {
 	}
 	authProvider, err := azclient.NewAuthProvider(armConfig, authConfig)
 	if err != nil {
-		return nil, err
+		return "", nil, nil, err
 	}
 	if authConfig.UseManagedIdentityExtension {
 		cred = authProvider.ManagedIdentityCredential
 	} else {
 		cred = authProvider.ClientSecretCredential
 	}
-	return azclient.NewClientFactory(&azclient.ClientFactoryConfig{SubscriptionID: subscriptionID}, armConfig, cred)
+	return subscriptionID, armConfig, cred, nil
 }
 
 func CreateNamespace(namespaceName string, c client.Client) error {
@@ -172,6 +192,26 @@ func WaitStaticGatewayProvision(sgw *v1alpha1.StaticGatewayConfiguration, c clie
 	return pipPrefix, nil
 }
 
+// EgressIPPrefixContains returns whether ip is in the egress ip prefix of a gateway, which is a comma separated list of
+// CIDRs, e.g. a /32 for a single public ip address of a NAT gateway, or of private IPs when there is no public IP.
+// A bare IP is taken as a /32.
+func EgressIPPrefixContains(egressIPPrefix, ip string) bool {
+	parsedIP := net.ParseIP(ip)
+	for _, prefix := range strings.Split(egressIPPrefix, ",") {
+		prefix = strings.TrimSpace(prefix)
+		if !strings.Contains(prefix, "/") {
+			if egressIP := net.ParseIP(prefix); egressIP != nil && egressIP.Equal(parsedIP) {
+				return true
+			}
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(prefix); err == nil && ipNet.Contains(parsedIP) {
+			return true
+		}
+	}
+	return false
+}
+
 func WaitStaticGatewayDeletion(sgw *v1alpha1.StaticGatewayConfiguration, c client.Client) error {
 	key := types.NamespacedName{
 		Name:      sgw.Name,
@@ -209,6 +249,81 @@ func WaitStaticGatewayDeletion(sgw *v1alpha1.StaticGatewayConfiguration, c clien
 	return nil
 }
 
+// GetGatewayPeerCount returns the number of wireguard peers configured for the gateway on all gateway nodes
+func GetGatewayPeerCount(sgw *v1alpha1.StaticGatewayConfiguration, c client.Client) (int, error) {
+	gwStatusList := &v1alpha1.GatewayStatusList{}
+	if err := c.List(context.Background(), gwStatusList); err != nil {
+		return 0, err
+	}
+	sgwKey := fmt.Sprintf("%s/%s", sgw.Namespace, sgw.Name)
+	count := 0
+	for _, gwStatus := range gwStatusList.Items {
+		interfaceName := ""
+		for _, gwConfig := range gwStatus.Spec.ReadyGatewayConfigurations {
+			if gwConfig.StaticGatewayConfiguration == sgwKey {
+				interfaceName = gwConfig.InterfaceName
+				break
+			}
+		}
+		if interfaceName == "" {
+			continue
+		}
+		for _, peerConfig := range gwStatus.Spec.ReadyPeerConfigurations {
+			if peerConfig.InterfaceName == interfaceName {
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+// WaitPodEndpointDeletion waits until the PodEndpoint of the deleted pod is removed and
+// its wireguard peer disappears from all gateway nodes
+func WaitPodEndpointDeletion(pod *corev1.Pod, c client.Client) error {
+	key := types.NamespacedName{
+		Name:      pod.Name,
+		Namespace: pod.Namespace,
+	}
+	podEndpoint := &v1alpha1.PodEndpoint{}
+	if err := wait.PollUntilContextTimeout(context.Background(), poll, pollTimeout, true, func(ctx context.Context) (bool, error) {
+		err := c.Get(ctx, key, podEndpoint)
+		if err != nil {
+			if retriable(err) {
+				return false, nil
+			}
+			if apierrs.IsNotFound(err) {
+				return true, nil
+			}
+			return false, err
+		}
+		return false, nil
+	}); err != nil {
+		return fmt.Errorf("podEndpoint %s is not deleted: %w", key, err)
+	}
+	// gateway nodes remove peers of deleted podEndpoints periodically
+	if err := wait.PollUntilContextTimeout(context.Background(), poll, pollTimeout, true, func(ctx context.Context) (bool, error) {
+		gwStatusList := &v1alpha1.GatewayStatusList{}
+		if err := c.List(ctx, gwStatusList); err != nil {
+			if retriable(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		for _, gwStatus := range gwStatusList.Items {
+			for _, peerConfig := range gwStatus.Spec.ReadyPeerConfigurations {
+				if peerConfig.PodEndpoint == key.String() {
+					Logf("Peer of podEndpoint %s still exists on gateway node %s", key, gwStatus.Name)
+					return false, nil
+				}
+			}
+		}
+		return true, nil
+	}); err != nil {
+		return fmt.Errorf("peer of podEndpoint %s is not removed from gateway nodes: %w", key, err)
+	}
+	return nil
+}
+
 func WaitPipPrefixDeletion(resourceGroup, pipName string, c publicipprefixclient.Interface) error {
 	if err := wait.PollUntilContextTimeout(context.Background(), poll, pollTimeoutForProvision, true, func(ctx context.Context) (bool, error) {
 		err := c.Delete(ctx, resourceGroup, pipName)
@@ -239,7 +354,7 @@ func GetGatewayVmssProfile(c client.Client) (resourceGroup, vmssName, location s
 
 	// At this moment, we only test one gateway nodepool
 	matches := vmssVMProviderIDRE.FindStringSubmatch(nodes.Items[0].Spec.ProviderID)
-	if len(matches) != 3 {
+	if len(matches) != 4 {
 		err = fmt.Errorf("gateway node providerID (%s) is not valid", nodes.Items[0].Spec.ProviderID)
 		return
 	}
@@ -5,41 +5,88 @@ package azmanager
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
 	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
 	network "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/interfaceclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/loadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/publicipaddressclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/publicipprefixclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/subnetclient"
 	_ "sigs.k8s.io/cloud-provider-azure/pkg/azclient/trace"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualnetworkclient"
 
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients"
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients/natgatewayclient"
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients/permissionclient"
 	"github.com/Azure/kube-egress-gateway/pkg/config"
 	"github.com/Azure/kube-egress-gateway/pkg/consts"
 	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
 )
 
 const (
+	// LB ID template
+	LBIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s"
 	// LB frontendIPConfiguration ID template
 	LBFrontendIPConfigTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/frontendIPConfigurations/%s"
 	// LB backendAddressPool ID template
 	LBBackendPoolIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/backendAddressPools/%s"
+	// VMSS ID template
+	VMSSIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachineScaleSets/%s"
 	// LB probe ID template
 	LBProbeIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/probes/%s"
+	// Virtual network ID template
+	VirtualNetworkIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/virtualNetworks/%s"
 )
 
 type AzureManager struct {
 	*config.CloudConfig
 
-	LoadBalancerClient   loadbalancerclient.Interface
-	VmssClient           virtualmachinescalesetclient.Interface
-	VmssVMClient         virtualmachinescalesetvmclient.Interface
-	PublicIPPrefixClient publicipprefixclient.Interface
-	InterfaceClient      interfaceclient.Interface
-	SubnetClient         subnetclient.Interface
+	LoadBalancerClient    loadbalancerclient.Interface
+	VmssClient            virtualmachinescalesetclient.Interface
+	VmssVMClient          virtualmachinescalesetvmclient.Interface
+	PublicIPPrefixClient  publicipprefixclient.Interface
+	PublicIPAddressClient publicipaddressclient.Interface
+	InterfaceClient       interfaceclient.Interface
+	SubnetClient          subnetclient.Interface
+	VirtualNetworkClient  virtualnetworkclient.Interface
+	// NatGatewayClient is not provided by azclient factory and must be set by the caller
+	NatGatewayClient natgatewayclient.Interface
+	// PermissionClient is only used to check prerequisites and must be set by the caller
+	PermissionClient permissionclient.Interface
+
+	// DryRun logs intended writes to Azure resources instead of making them
+	DryRun bool
+
+	// CircuitBreakerThreshold is the number of consecutive failures of an Azure operation after which its calls are
+	// short-circuited for CircuitBreakerCooldown, 0 disables circuit breakers
+	CircuitBreakerThreshold int
+	CircuitBreakerCooldown  time.Duration
+
+	// NewSubscriptionClients builds the Azure clients of another subscription, for gateways whose VMSSes are not in
+	// the cluster subscription. Gateways can only be in the cluster subscription when it is nil.
+	NewSubscriptionClients func(subscriptionID string) (*SubscriptionClients, error)
+
+	// vmssCache caches vmss and vmss instances, entries are invalidated on writes
+	vmssCache *resourceCache
+
+	// resourceLocks serializes concurrent updates of the same azure resource
+	resourceLocks resourceLocks
+
+	// circuitBreakers short-circuits calls of Azure operations failing repeatedly
+	circuitBreakers circuitBreakers
+
+	// subscriptionManagers caches the AzureManagers of other subscriptions
+	subscriptionManagers subscriptionManagers
+
+	// parent is the AzureManager of the cluster subscription when this one is for another subscription
+	parent *AzureManager
 }
 
 func CreateAzureManager(cloud *config.CloudConfig, factory azclient.ClientFactory) (*AzureManager, error) {
@@ -47,6 +94,15 @@ func CreateAzureManager(cloud *config.CloudConfig, factory azclient.ClientFactor
 		CloudConfig: cloud,
 	}
 
+	if az.ExistingLoadBalancerID != "" {
+		lbID, err := arm.ParseResourceID(az.ExistingLoadBalancerID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse existing load balancer ID %s: %w", az.ExistingLoadBalancerID, err)
+		}
+		az.CloudConfig.LoadBalancerName = lbID.Name
+		az.LoadBalancerResourceGroup = lbID.ResourceGroupName
+	}
+
 	if az.LoadBalancerResourceGroup == "" {
 		az.LoadBalancerResourceGroup = az.ResourceGroup
 	}
@@ -58,9 +114,17 @@ func CreateAzureManager(cloud *config.CloudConfig, factory azclient.ClientFactor
 	az.LoadBalancerClient = factory.GetLoadBalancerClient()
 	az.VmssClient = factory.GetVirtualMachineScaleSetClient()
 	az.PublicIPPrefixClient = factory.GetPublicIPPrefixClient()
+	az.PublicIPAddressClient = factory.GetPublicIPAddressClient()
 	az.VmssVMClient = factory.GetVirtualMachineScaleSetVMClient()
 	az.InterfaceClient = factory.GetInterfaceClient()
 	az.SubnetClient = factory.GetSubnetClient()
+	az.VirtualNetworkClient = factory.GetVirtualNetworkClient()
+
+	ttl := time.Duration(az.VmssCacheTTLInSeconds) * time.Second
+	if az.VmssCacheTTLInSeconds == 0 {
+		ttl = consts.DefaultVmssCacheTTLInSeconds * time.Second
+	}
+	az.vmssCache = newResourceCache(ttl)
 
 	return &az, nil
 }
@@ -80,6 +144,12 @@ func (az *AzureManager) LoadBalancerName() string {
 	return az.CloudConfig.LoadBalancerName
 }
 
+// UseExistingLB returns whether gateway rules are added to a load balancer not owned by the controller, which
+// must then never be created or deleted as a whole
+func (az *AzureManager) UseExistingLB() bool {
+	return az.ExistingLoadBalancerID != ""
+}
+
 func (az *AzureManager) GetLBFrontendIPConfigurationID(name string) *string {
 	return to.Ptr(fmt.Sprintf(LBFrontendIPConfigTemplate, az.SubscriptionID(), az.LoadBalancerResourceGroup, az.LoadBalancerName(), name))
 }
@@ -92,33 +162,72 @@ func (az *AzureManager) GetLBProbeID(name string) *string {
 	return to.Ptr(fmt.Sprintf(LBProbeIDTemplate, az.SubscriptionID(), az.LoadBalancerResourceGroup, az.LoadBalancerName(), name))
 }
 
+// LockLB blocks until no other caller is updating the gateway LoadBalancer, which is shared by all gateways of
+// the subscription. The returned function releases the lock.
+func (az *AzureManager) LockLB() (unlock func()) {
+	return az.LockResource(fmt.Sprintf(LBIDTemplate, az.SubscriptionID(), az.LoadBalancerResourceGroup, az.LoadBalancerName()))
+}
+
+// LockResource blocks until no other caller is updating the azure resource of the given ID. Locks of
+// different resources are independent. The returned function releases the lock.
+func (az *AzureManager) LockResource(resourceID string) (unlock func()) {
+	if az.parent != nil {
+		// locks are shared with the cluster subscription, resource IDs tell resources of subscriptions apart
+		return az.parent.LockResource(resourceID)
+	}
+	return az.resourceLocks.acquire(resourceID)
+}
+
 func (az *AzureManager) GetLB(ctx context.Context) (*network.LoadBalancer, error) {
-	lb, err := az.LoadBalancerClient.Get(ctx, az.LoadBalancerResourceGroup, az.LoadBalancerName(), nil)
+	lb, err := callAzure(ctx, az, "GetLB", az.LoadBalancerResourceGroup, func() (*network.LoadBalancer, error) {
+		return az.LoadBalancerClient.Get(ctx, az.LoadBalancerResourceGroup, az.LoadBalancerName(), nil)
+	})
 	if err != nil {
-		return nil, err
+		return nil, azureclients.ConvertError(err)
 	}
 	return lb, nil
 }
 
 func (az *AzureManager) CreateOrUpdateLB(ctx context.Context, lb network.LoadBalancer) (*network.LoadBalancer, error) {
-	ret, err := az.LoadBalancerClient.CreateOrUpdate(ctx, az.LoadBalancerResourceGroup, to.Val(lb.Name), lb)
+	if az.DryRun {
+		current, _ := az.LoadBalancerClient.Get(ctx, az.LoadBalancerResourceGroup, to.Val(lb.Name), nil)
+		logDryRunWrite(ctx, "CreateOrUpdate", "LoadBalancer", az.LoadBalancerResourceGroup, to.Val(lb.Name), current, &lb)
+		return &lb, nil
+	}
+	ret, err := callAzure(ctx, az, "CreateOrUpdateLB", az.LoadBalancerResourceGroup, func() (*network.LoadBalancer, error) {
+		return az.LoadBalancerClient.CreateOrUpdate(ctx, az.LoadBalancerResourceGroup, to.Val(lb.Name), lb)
+	})
 	if err != nil {
-		return nil, err
+		return nil, azureclients.ConvertError(err)
 	}
 	return ret, nil
 }
 
 func (az *AzureManager) DeleteLB(ctx context.Context) error {
-	if err := az.LoadBalancerClient.Delete(ctx, az.LoadBalancerResourceGroup, az.LoadBalancerName()); err != nil {
-		return err
+	if az.DryRun {
+		current, _ := az.LoadBalancerClient.Get(ctx, az.LoadBalancerResourceGroup, az.LoadBalancerName(), nil)
+		logDryRunWrite(ctx, "Delete", "LoadBalancer", az.LoadBalancerResourceGroup, az.LoadBalancerName(), current, nil)
+		return nil
+	}
+	if err := az.withCircuitBreaker(ctx, "DeleteLB", az.LoadBalancerResourceGroup, func() error {
+		return az.LoadBalancerClient.Delete(ctx, az.LoadBalancerResourceGroup, az.LoadBalancerName())
+	}); err != nil {
+		return azureclients.ConvertError(err)
 	}
 	return nil
 }
 
-func (az *AzureManager) ListVMSS(ctx context.Context) ([]*compute.VirtualMachineScaleSet, error) {
-	vmssList, err := az.VmssClient.List(ctx, az.ResourceGroup)
+func (az *AzureManager) ListVMSS(ctx context.Context, resourceGroup string) ([]*compute.VirtualMachineScaleSet, error) {
+	if resourceGroup == "" {
+		resourceGroup = az.ResourceGroup
+	}
+	vmssList, err := getOrLoad(az.vmssCache, vmssListCacheKey(resourceGroup), func() ([]*compute.VirtualMachineScaleSet, error) {
+		return callAzure(ctx, az, "ListVMSS", resourceGroup, func() ([]*compute.VirtualMachineScaleSet, error) {
+			return az.VmssClient.List(ctx, resourceGroup)
+		})
+	})
 	if err != nil {
-		return nil, err
+		return nil, azureclients.ConvertError(err)
 	}
 	return vmssList, nil
 }
@@ -130,9 +239,13 @@ func (az *AzureManager) GetVMSS(ctx context.Context, resourceGroup, vmssName str
 	if vmssName == "" {
 		return nil, fmt.Errorf("vmss name is empty")
 	}
-	vmss, err := az.VmssClient.Get(ctx, resourceGroup, vmssName, nil)
+	vmss, err := getOrLoad(az.vmssCache, vmssCacheKey(resourceGroup, vmssName), func() (*compute.VirtualMachineScaleSet, error) {
+		return callAzure(ctx, az, "GetVMSS", resourceGroup, func() (*compute.VirtualMachineScaleSet, error) {
+			return az.VmssClient.Get(ctx, resourceGroup, vmssName, nil)
+		})
+	})
 	if err != nil {
-		return nil, err
+		return nil, azureclients.ConvertError(err)
 	}
 	return vmss, nil
 }
@@ -144,9 +257,19 @@ func (az *AzureManager) CreateOrUpdateVMSS(ctx context.Context, resourceGroup, v
 	if vmssName == "" {
 		return nil, fmt.Errorf("vmss name is empty")
 	}
-	retVmss, err := az.VmssClient.CreateOrUpdate(ctx, resourceGroup, vmssName, vmss)
+	if az.DryRun {
+		// bypass the cache, cached vmss may have been modified by the caller
+		current, _ := az.VmssClient.Get(ctx, resourceGroup, vmssName, nil)
+		logDryRunWrite(ctx, "CreateOrUpdate", "VirtualMachineScaleSetNetworkProfile", resourceGroup, vmssName, vmssNetworkProfile(current), vmssNetworkProfile(&vmss))
+		return &vmss, nil
+	}
+	// vmss model change also applies to its instances, invalidate all of them
+	defer az.invalidateVMSS(resourceGroup, vmssName)
+	retVmss, err := callAzure(ctx, az, "CreateOrUpdateVMSS", resourceGroup, func() (*compute.VirtualMachineScaleSet, error) {
+		return az.VmssClient.CreateOrUpdate(ctx, resourceGroup, vmssName, vmss)
+	})
 	if err != nil {
-		return nil, err
+		return nil, azureclients.ConvertError(err)
 	}
 	return retVmss, nil
 }
@@ -158,9 +281,13 @@ func (az *AzureManager) ListVMSSInstances(ctx context.Context, resourceGroup, vm
 	if vmssName == "" {
 		return nil, fmt.Errorf("vmss name is empty")
 	}
-	vms, err := az.VmssVMClient.List(ctx, resourceGroup, vmssName)
+	vms, err := getOrLoad(az.vmssCache, vmssInstancesCacheKey(resourceGroup, vmssName), func() ([]*compute.VirtualMachineScaleSetVM, error) {
+		return callAzure(ctx, az, "ListVMSSInstances", resourceGroup, func() ([]*compute.VirtualMachineScaleSetVM, error) {
+			return az.VmssVMClient.List(ctx, resourceGroup, vmssName)
+		})
+	})
 	if err != nil {
-		return nil, err
+		return nil, azureclients.ConvertError(err)
 	}
 	return vms, nil
 }
@@ -175,13 +302,26 @@ func (az *AzureManager) GetVMSSInstance(ctx context.Context, resourceGroup, vmss
 	if instanceID == "" {
 		return nil, fmt.Errorf("vmss instanceID is empty")
 	}
-	vm, err := az.VmssVMClient.Get(ctx, resourceGroup, vmssName, instanceID)
+	vm, err := getOrLoad(az.vmssCache, vmssInstanceCacheKey(resourceGroup, vmssName, instanceID), func() (*compute.VirtualMachineScaleSetVM, error) {
+		return callAzure(ctx, az, "GetVMSSInstance", resourceGroup, func() (*compute.VirtualMachineScaleSetVM, error) {
+			return az.VmssVMClient.Get(ctx, resourceGroup, vmssName, instanceID)
+		})
+	})
 	if err != nil {
-		return nil, err
+		return nil, azureclients.ConvertError(err)
 	}
 	return vm, nil
 }
 
+// GetVMSSInstanceNodeName returns the Kubernetes node name of the vmss instance, which is its computer name in lower
+// case, or empty string if the instance has no OS profile yet
+func GetVMSSInstanceNodeName(vm *compute.VirtualMachineScaleSetVM) string {
+	if vm == nil || vm.Properties == nil || vm.Properties.OSProfile == nil {
+		return ""
+	}
+	return strings.ToLower(to.Val(vm.Properties.OSProfile.ComputerName))
+}
+
 func (az *AzureManager) UpdateVMSSInstance(ctx context.Context, resourceGroup, vmssName, instanceID string, vm compute.VirtualMachineScaleSetVM) (*compute.VirtualMachineScaleSetVM, error) {
 	if resourceGroup == "" {
 		resourceGroup = az.ResourceGroup
@@ -192,9 +332,17 @@ func (az *AzureManager) UpdateVMSSInstance(ctx context.Context, resourceGroup, v
 	if instanceID == "" {
 		return nil, fmt.Errorf("vmss instanceID is empty")
 	}
-	retVM, err := az.VmssVMClient.Update(ctx, resourceGroup, vmssName, instanceID, vm)
+	if az.DryRun {
+		current, _ := az.VmssVMClient.Get(ctx, resourceGroup, vmssName, instanceID)
+		logDryRunWrite(ctx, "Update", "VirtualMachineScaleSetVMNetworkProfile", resourceGroup, vmssName+"/"+instanceID, vmssVMNetworkProfile(current), vmssVMNetworkProfile(&vm))
+		return &vm, nil
+	}
+	defer az.vmssCache.delete(vmssInstanceCacheKey(resourceGroup, vmssName, instanceID), vmssInstancesCacheKey(resourceGroup, vmssName))
+	retVM, err := callAzure(ctx, az, "UpdateVMSSInstance", resourceGroup, func() (*compute.VirtualMachineScaleSetVM, error) {
+		return az.VmssVMClient.Update(ctx, resourceGroup, vmssName, instanceID, vm)
+	})
 	if err != nil {
-		return nil, err
+		return nil, azureclients.ConvertError(err)
 	}
 	return retVM, nil
 }
@@ -206,13 +354,44 @@ func (az *AzureManager) GetPublicIPPrefix(ctx context.Context, resourceGroup, pr
 	if prefixName == "" {
 		return nil, fmt.Errorf("public ip prefix name is empty")
 	}
-	prefix, err := az.PublicIPPrefixClient.Get(ctx, resourceGroup, prefixName, nil)
+	prefix, err := callAzure(ctx, az, "GetPublicIPPrefix", resourceGroup, func() (*network.PublicIPPrefix, error) {
+		return az.PublicIPPrefixClient.Get(ctx, resourceGroup, prefixName, nil)
+	})
 	if err != nil {
-		return nil, err
+		return nil, azureclients.ConvertError(err)
 	}
 	return prefix, nil
 }
 
+func (az *AzureManager) GetPublicIPAddress(ctx context.Context, resourceGroup, ipName string) (*network.PublicIPAddress, error) {
+	if resourceGroup == "" {
+		resourceGroup = az.ResourceGroup
+	}
+	if ipName == "" {
+		return nil, fmt.Errorf("public ip address name is empty")
+	}
+	ip, err := callAzure(ctx, az, "GetPublicIPAddress", resourceGroup, func() (*network.PublicIPAddress, error) {
+		return az.PublicIPAddressClient.Get(ctx, resourceGroup, ipName, nil)
+	})
+	if err != nil {
+		return nil, azureclients.ConvertError(err)
+	}
+	return ip, nil
+}
+
+func (az *AzureManager) ListPublicIPPrefixes(ctx context.Context, resourceGroup string) ([]*network.PublicIPPrefix, error) {
+	if resourceGroup == "" {
+		resourceGroup = az.ResourceGroup
+	}
+	prefixes, err := callAzure(ctx, az, "ListPublicIPPrefixes", resourceGroup, func() ([]*network.PublicIPPrefix, error) {
+		return az.PublicIPPrefixClient.List(ctx, resourceGroup)
+	})
+	if err != nil {
+		return nil, azureclients.ConvertError(err)
+	}
+	return prefixes, nil
+}
+
 func (az *AzureManager) CreateOrUpdatePublicIPPrefix(ctx context.Context, resourceGroup, prefixName string, ipPrefix network.PublicIPPrefix) (*network.PublicIPPrefix, error) {
 	if resourceGroup == "" {
 		resourceGroup = az.ResourceGroup
@@ -220,9 +399,20 @@ func (az *AzureManager) CreateOrUpdatePublicIPPrefix(ctx context.Context, resour
 	if prefixName == "" {
 		return nil, fmt.Errorf("public ip prefix name is empty")
 	}
-	prefix, err := az.PublicIPPrefixClient.CreateOrUpdate(ctx, resourceGroup, prefixName, ipPrefix)
+	if az.DryRun {
+		current, _ := az.PublicIPPrefixClient.Get(ctx, resourceGroup, prefixName, nil)
+		logDryRunWrite(ctx, "CreateOrUpdate", "PublicIPPrefix", resourceGroup, prefixName, current, &ipPrefix)
+		if ipPrefix.ID == nil {
+			// let callers reference the prefix as if it was created, its address is only known after creation
+			ipPrefix.ID = to.Ptr(fmt.Sprintf(PublicIPPrefixIDTemplate, az.SubscriptionID(), resourceGroup, prefixName))
+		}
+		return &ipPrefix, nil
+	}
+	prefix, err := callAzure(ctx, az, "CreateOrUpdatePublicIPPrefix", resourceGroup, func() (*network.PublicIPPrefix, error) {
+		return az.PublicIPPrefixClient.CreateOrUpdate(ctx, resourceGroup, prefixName, ipPrefix)
+	})
 	if err != nil {
-		return nil, err
+		return nil, azureclients.ConvertError(err)
 	}
 	return prefix, nil
 }
@@ -234,7 +424,14 @@ func (az *AzureManager) DeletePublicIPPrefix(ctx context.Context, resourceGroup,
 	if prefixName == "" {
 		return fmt.Errorf("public ip prefix name is empty")
 	}
-	return az.PublicIPPrefixClient.Delete(ctx, resourceGroup, prefixName)
+	if az.DryRun {
+		current, _ := az.PublicIPPrefixClient.Get(ctx, resourceGroup, prefixName, nil)
+		logDryRunWrite(ctx, "Delete", "PublicIPPrefix", resourceGroup, prefixName, current, nil)
+		return nil
+	}
+	return azureclients.ConvertError(az.withCircuitBreaker(ctx, "DeletePublicIPPrefix", resourceGroup, func() error {
+		return az.PublicIPPrefixClient.Delete(ctx, resourceGroup, prefixName)
+	}))
 }
 
 func (az *AzureManager) GetVMSSInterface(ctx context.Context, resourceGroup, vmssName, instanceID, interfaceName string) (*network.Interface, error) {
@@ -250,17 +447,173 @@ func (az *AzureManager) GetVMSSInterface(ctx context.Context, resourceGroup, vms
 	if interfaceName == "" {
 		return nil, fmt.Errorf("interface name is empty")
 	}
-	nicResp, err := az.InterfaceClient.GetVirtualMachineScaleSetNetworkInterface(ctx, resourceGroup, vmssName, instanceID, interfaceName)
+	nicResp, err := callAzure(ctx, az, "GetVMSSInterface", resourceGroup, func() (*network.Interface, error) {
+		return az.InterfaceClient.GetVirtualMachineScaleSetNetworkInterface(ctx, resourceGroup, vmssName, instanceID, interfaceName)
+	})
 	if err != nil {
-		return nil, err
+		return nil, azureclients.ConvertError(err)
 	}
 	return nicResp, nil
 }
 
 func (az *AzureManager) GetSubnet(ctx context.Context) (*network.Subnet, error) {
-	subnet, err := az.SubnetClient.Get(ctx, az.VnetResourceGroup, az.VnetName, az.SubnetName, nil)
+	subnet, err := callAzure(ctx, az, "GetSubnet", az.VnetResourceGroup, func() (*network.Subnet, error) {
+		return az.SubnetClient.Get(ctx, az.VnetResourceGroup, az.VnetName, az.SubnetName, nil)
+	})
+	if err != nil {
+		return nil, azureclients.ConvertError(err)
+	}
+	return subnet, nil
+}
+
+// GetVirtualNetwork gets the virtual network of the cluster subnet
+func (az *AzureManager) GetVirtualNetwork(ctx context.Context) (*network.VirtualNetwork, error) {
+	vnet, err := callAzure(ctx, az, "GetVirtualNetwork", az.VnetResourceGroup, func() (*network.VirtualNetwork, error) {
+		return az.VirtualNetworkClient.Get(ctx, az.VnetResourceGroup, az.VnetName, nil)
+	})
+	if err != nil {
+		return nil, azureclients.ConvertError(err)
+	}
+	return vnet, nil
+}
+
+// GetVirtualNetworkID returns the resource ID of the cluster virtual network
+func (az *AzureManager) GetVirtualNetworkID() string {
+	return fmt.Sprintf(VirtualNetworkIDTemplate, az.SubscriptionID(), az.VnetResourceGroup, az.VnetName)
+}
+
+// GetVirtualNetworkByID gets the virtual network with the resource ID, e.g. the one of a vmss ipConfig subnet
+func (az *AzureManager) GetVirtualNetworkByID(ctx context.Context, vnetID string) (*network.VirtualNetwork, error) {
+	id, err := arm.ParseResourceID(vnetID)
 	if err != nil {
 		return nil, err
 	}
+	if !strings.EqualFold(id.ResourceType.String(), "Microsoft.Network/virtualNetworks") {
+		return nil, fmt.Errorf("%s is not a virtual network resource ID", vnetID)
+	}
+	vnet, err := callAzure(ctx, az, "GetVirtualNetworkByID", id.ResourceGroupName, func() (*network.VirtualNetwork, error) {
+		return az.VirtualNetworkClient.Get(ctx, id.ResourceGroupName, id.Name, nil)
+	})
+	if err != nil {
+		return nil, azureclients.ConvertError(err)
+	}
+	return vnet, nil
+}
+
+// GetSubnetByID gets the subnet with the resource ID, e.g. the subnet of a vmss ipConfig
+func (az *AzureManager) GetSubnetByID(ctx context.Context, subnetID string) (*network.Subnet, error) {
+	id, err := arm.ParseResourceID(subnetID)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(id.ResourceType.String(), "Microsoft.Network/virtualNetworks/subnets") || id.Parent == nil {
+		return nil, fmt.Errorf("%s is not a subnet resource ID", subnetID)
+	}
+	subnet, err := callAzure(ctx, az, "GetSubnetByID", id.ResourceGroupName, func() (*network.Subnet, error) {
+		return az.SubnetClient.Get(ctx, id.ResourceGroupName, id.Parent.Name, id.Name, nil)
+	})
+	if err != nil {
+		return nil, azureclients.ConvertError(err)
+	}
 	return subnet, nil
 }
+
+func (az *AzureManager) GetNatGateway(ctx context.Context, resourceGroup, natGatewayName string) (*network.NatGateway, error) {
+	if resourceGroup == "" {
+		resourceGroup = az.ResourceGroup
+	}
+	if natGatewayName == "" {
+		return nil, fmt.Errorf("nat gateway name is empty")
+	}
+	if az.NatGatewayClient == nil {
+		return nil, fmt.Errorf("nat gateway client is not configured")
+	}
+	natGateway, err := callAzure(ctx, az, "GetNatGateway", resourceGroup, func() (*network.NatGateway, error) {
+		return az.NatGatewayClient.Get(ctx, resourceGroup, natGatewayName, nil)
+	})
+	if err != nil {
+		return nil, azureclients.ConvertError(err)
+	}
+	return natGateway, nil
+}
+
+func (az *AzureManager) CreateOrUpdateNatGateway(ctx context.Context, resourceGroup, natGatewayName string, natGateway network.NatGateway) (*network.NatGateway, error) {
+	if resourceGroup == "" {
+		resourceGroup = az.ResourceGroup
+	}
+	if natGatewayName == "" {
+		return nil, fmt.Errorf("nat gateway name is empty")
+	}
+	if az.NatGatewayClient == nil {
+		return nil, fmt.Errorf("nat gateway client is not configured")
+	}
+	if az.DryRun {
+		current, _ := az.NatGatewayClient.Get(ctx, resourceGroup, natGatewayName, nil)
+		logDryRunWrite(ctx, "CreateOrUpdate", "NatGateway", resourceGroup, natGatewayName, current, &natGateway)
+		return &natGateway, nil
+	}
+	ret, err := callAzure(ctx, az, "CreateOrUpdateNatGateway", resourceGroup, func() (*network.NatGateway, error) {
+		return az.NatGatewayClient.CreateOrUpdate(ctx, resourceGroup, natGatewayName, natGateway)
+	})
+	if err != nil {
+		return nil, azureclients.ConvertError(err)
+	}
+	return ret, nil
+}
+
+// invalidateVMSS removes cached vmss, vmss list and instances of the vmss
+func (az *AzureManager) invalidateVMSS(resourceGroup, vmssName string) {
+	az.vmssCache.delete(vmssCacheKey(resourceGroup, vmssName), vmssListCacheKey(resourceGroup), vmssInstancesCacheKey(resourceGroup, vmssName))
+	az.vmssCache.deletePrefix(vmssInstanceCacheKey(resourceGroup, vmssName, ""))
+}
+
+func vmssListCacheKey(resourceGroup string) string {
+	return fmt.Sprintf("vmsslist/%s", resourceGroup)
+}
+
+func vmssCacheKey(resourceGroup, vmssName string) string {
+	return fmt.Sprintf("vmss/%s/%s", resourceGroup, vmssName)
+}
+
+func vmssInstancesCacheKey(resourceGroup, vmssName string) string {
+	return fmt.Sprintf("vmssinstances/%s/%s", resourceGroup, vmssName)
+}
+
+func vmssInstanceCacheKey(resourceGroup, vmssName, instanceID string) string {
+	return fmt.Sprintf("vmssinstance/%s/%s/%s", resourceGroup, vmssName, instanceID)
+}
+
+// ListPermissions lists the Azure RBAC permissions of the manager identity on the resource group
+func (az *AzureManager) ListPermissions(ctx context.Context, resourceGroup string) ([]permissionclient.Permission, error) {
+	if resourceGroup == "" {
+		resourceGroup = az.ResourceGroup
+	}
+	if az.PermissionClient == nil {
+		return nil, fmt.Errorf("permission client is not configured")
+	}
+	permissions, err := callAzure(ctx, az, "ListPermissions", resourceGroup, func() ([]permissionclient.Permission, error) {
+		return az.PermissionClient.ListForResourceGroup(ctx, resourceGroup)
+	})
+	if err != nil {
+		return nil, azureclients.ConvertError(err)
+	}
+	return permissions, nil
+}
+
+// ListVMSSPermissions lists the Azure RBAC permissions of the manager identity on the vmss, which include roles
+// assigned on the vmss only
+func (az *AzureManager) ListVMSSPermissions(ctx context.Context, resourceGroup, vmssName string) ([]permissionclient.Permission, error) {
+	if resourceGroup == "" {
+		resourceGroup = az.ResourceGroup
+	}
+	if az.PermissionClient == nil {
+		return nil, fmt.Errorf("permission client is not configured")
+	}
+	permissions, err := callAzure(ctx, az, "ListVMSSPermissions", resourceGroup, func() ([]permissionclient.Permission, error) {
+		return az.PermissionClient.ListForResource(ctx, fmt.Sprintf(VMSSIDTemplate, az.SubscriptionID(), resourceGroup, vmssName))
+	})
+	if err != nil {
+		return nil, azureclients.ConvertError(err)
+	}
+	return permissions, nil
+}
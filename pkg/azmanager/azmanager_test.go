@@ -4,9 +4,12 @@ package azmanager
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"testing"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
 	network "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
 	"github.com/stretchr/testify/assert"
@@ -15,11 +18,17 @@ import (
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/interfaceclient/mock_interfaceclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/loadbalancerclient/mock_loadbalancerclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/mock_azclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/publicipaddressclient/mock_publicipaddressclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/publicipprefixclient/mock_publicipprefixclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/subnetclient/mock_subnetclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetclient/mock_virtualmachinescalesetclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetvmclient/mock_virtualmachinescalesetvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualnetworkclient/mock_virtualnetworkclient"
 
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients"
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients/natgatewayclient/mocknatgatewayclient"
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients/permissionclient"
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients/permissionclient/mockpermissionclient"
 	"github.com/Azure/kube-egress-gateway/pkg/config"
 	"github.com/Azure/kube-egress-gateway/pkg/consts"
 	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
@@ -58,9 +67,28 @@ func TestCreateAzureManager(t *testing.T) {
 		assert.Equal(t, az.VnetResourceGroup, test.expectedVnetResourceGroup, "TestCase[%d]: %s", i, test.desc)
 		assert.Equal(t, az.SubscriptionID(), config.SubscriptionID, "TestCase[%d]: %s", i, test.desc)
 		assert.Equal(t, az.Location(), config.Location, "TestCase[%d]: %s", i, test.desc)
+		assert.False(t, az.UseExistingLB(), "TestCase[%d]: %s", i, test.desc)
 	}
 }
 
+func TestCreateAzureManagerWithExistingLB(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	config := getTestCloudConfig("", "")
+	config.ExistingLoadBalancerID = "/subscriptions/testSub/resourceGroups/existingLBRG/providers/Microsoft.Network/loadBalancers/existingLB"
+	az, err := CreateAzureManager(config, getMockFactory(ctrl))
+	assert.Nil(t, err)
+	assert.True(t, az.UseExistingLB())
+	assert.Equal(t, "existingLB", az.LoadBalancerName())
+	assert.Equal(t, "existingLBRG", az.LoadBalancerResourceGroup)
+	assert.Equal(t, "/subscriptions/testSub/resourceGroups/existingLBRG/providers/Microsoft.Network/loadBalancers/existingLB/probes/probe", to.Val(az.GetLBProbeID("probe")))
+
+	config = getTestCloudConfig("", "")
+	config.ExistingLoadBalancerID = "existingLB"
+	_, err = CreateAzureManager(config, mock_azclient.NewMockClientFactory(ctrl))
+	assert.NotNil(t, err)
+}
+
 func TestGets(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -112,6 +140,21 @@ func TestGetLB(t *testing.T) {
 	}
 }
 
+func TestGetLBNotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	config := getTestCloudConfig("", "")
+	factory := getMockFactory(ctrl)
+	az, _ := CreateAzureManager(config, factory)
+	respErr := &azcore.ResponseError{StatusCode: http.StatusNotFound, ErrorCode: "ResourceNotFound"}
+	mockLoadBalancerClient := az.LoadBalancerClient.(*mock_loadbalancerclient.MockInterface)
+	mockLoadBalancerClient.EXPECT().Get(gomock.Any(), "testRG", "testLB", gomock.Any()).Return(nil, respErr)
+	_, err := az.GetLB(context.Background())
+	var notFoundErr *azureclients.ErrNotFound
+	assert.True(t, errors.As(err, &notFoundErr))
+	assert.ErrorIs(t, err, respErr)
+}
+
 func TestCreateOrUpdateLB(t *testing.T) {
 	tests := []struct {
 		desc    string
@@ -193,7 +236,7 @@ func TestListVMSS(t *testing.T) {
 		az, _ := CreateAzureManager(config, factory)
 		mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
 		mockVMSSClient.EXPECT().List(gomock.Any(), "testRG").Return(test.vmssList, test.testErr)
-		vmssList, err := az.ListVMSS(context.Background())
+		vmssList, err := az.ListVMSS(context.Background(), "")
 		assert.Equal(t, err, test.testErr, "TestCase[%d]: %s", i, test.desc)
 		assert.Equal(t, len(vmssList), len(test.vmssList), "TestCase[%d]: %s", i, test.desc)
 		for j, vmss := range vmssList {
@@ -431,6 +474,34 @@ func TestGetVMSSInstance(t *testing.T) {
 	}
 }
 
+func TestGetVMSSInstanceNodeName(t *testing.T) {
+	tests := []struct {
+		desc     string
+		vm       *compute.VirtualMachineScaleSetVM
+		expected string
+	}{
+		{
+			desc: "node name is the lower case computer name",
+			vm: &compute.VirtualMachineScaleSetVM{Properties: &compute.VirtualMachineScaleSetVMProperties{
+				OSProfile: &compute.OSProfile{ComputerName: to.Ptr("AKS-GATEWAY-12345678-VMSS000001")},
+			}},
+			expected: "aks-gateway-12345678-vmss000001",
+		},
+		{
+			desc:     "instance without OS profile",
+			vm:       &compute.VirtualMachineScaleSetVM{Properties: &compute.VirtualMachineScaleSetVMProperties{}},
+			expected: "",
+		},
+		{
+			desc:     "nil instance",
+			expected: "",
+		},
+	}
+	for i, test := range tests {
+		assert.Equal(t, test.expected, GetVMSSInstanceNodeName(test.vm), "TestCase[%d]: %s", i, test.desc)
+	}
+}
+
 func TestUpdateVMSSInstance(t *testing.T) {
 	tests := []struct {
 		desc         string
@@ -549,6 +620,99 @@ func TestGetPublicIPPrefix(t *testing.T) {
 	}
 }
 
+func TestGetPublicIPAddress(t *testing.T) {
+	tests := []struct {
+		desc         string
+		rg           string
+		expectedRG   string
+		ipName       string
+		ip           *network.PublicIPAddress
+		expectedCall bool
+		testErr      error
+	}{
+		{
+			desc:         "GetPublicIPAddress() should return expected ip address",
+			expectedRG:   "testRG",
+			ipName:       "ip",
+			ip:           &network.PublicIPAddress{Name: to.Ptr("ip")},
+			expectedCall: true,
+		},
+		{
+			desc:         "GetPublicIPAddress() should return ip address with specified resource group",
+			rg:           "customRG",
+			expectedRG:   "customRG",
+			ipName:       "ip",
+			ip:           &network.PublicIPAddress{Name: to.Ptr("ip")},
+			expectedCall: true,
+		},
+		{
+			desc:         "GetPublicIPAddress() should return error when ip name is empty",
+			expectedCall: false,
+			testErr:      fmt.Errorf("public ip address name is empty"),
+		},
+		{
+			desc:         "GetPublicIPAddress() should return expected error",
+			expectedRG:   "testRG",
+			ipName:       "ip",
+			expectedCall: true,
+			testErr:      fmt.Errorf("public ip address not found"),
+		},
+	}
+	for i, test := range tests {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		config := getTestCloudConfig("", "")
+		factory := getMockFactory(ctrl)
+		az, _ := CreateAzureManager(config, factory)
+		if test.expectedCall {
+			mockPublicIPAddressClient := az.PublicIPAddressClient.(*mock_publicipaddressclient.MockInterface)
+			mockPublicIPAddressClient.EXPECT().Get(gomock.Any(), test.expectedRG, test.ipName, gomock.Any()).Return(test.ip, test.testErr)
+		}
+		ip, err := az.GetPublicIPAddress(context.Background(), test.rg, test.ipName)
+		assert.Equal(t, err, test.testErr, "TestCase[%d]: %s", i, test.desc)
+		assert.Equal(t, to.Val(ip), to.Val(test.ip), "TestCase[%d]: %s", i, test.desc)
+	}
+}
+
+func TestListPublicIPPrefixes(t *testing.T) {
+	tests := []struct {
+		desc       string
+		rg         string
+		expectedRG string
+		prefixes   []*network.PublicIPPrefix
+		testErr    error
+	}{
+		{
+			desc:       "ListPublicIPPrefixes() should return expected ip prefixes",
+			expectedRG: "testRG",
+			prefixes:   []*network.PublicIPPrefix{{Name: to.Ptr("prefix")}},
+		},
+		{
+			desc:       "ListPublicIPPrefixes() should list ip prefixes in specified resource group",
+			rg:         "customRG",
+			expectedRG: "customRG",
+			prefixes:   []*network.PublicIPPrefix{{Name: to.Ptr("prefix")}},
+		},
+		{
+			desc:       "ListPublicIPPrefixes() should return expected error",
+			expectedRG: "testRG",
+			testErr:    fmt.Errorf("failed to list public ip prefixes"),
+		},
+	}
+	for i, test := range tests {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		config := getTestCloudConfig("", "")
+		factory := getMockFactory(ctrl)
+		az, _ := CreateAzureManager(config, factory)
+		mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+		mockPublicIPPrefixClient.EXPECT().List(gomock.Any(), test.expectedRG).Return(test.prefixes, test.testErr)
+		prefixes, err := az.ListPublicIPPrefixes(context.Background(), test.rg)
+		assert.Equal(t, err, test.testErr, "TestCase[%d]: %s", i, test.desc)
+		assert.Equal(t, prefixes, test.prefixes, "TestCase[%d]: %s", i, test.desc)
+	}
+}
+
 func TestCreateOrUpdatePublicIPPrefix(t *testing.T) {
 	tests := []struct {
 		desc         string
@@ -762,14 +926,252 @@ func TestGetSubnet(t *testing.T) {
 	}
 }
 
+func TestGetVirtualNetwork(t *testing.T) {
+	tests := []struct {
+		desc    string
+		vnet    *network.VirtualNetwork
+		testErr error
+	}{
+		{
+			desc: "GetVirtualNetwork() should return expected virtual network",
+			vnet: &network.VirtualNetwork{
+				Name: to.Ptr("testVnet"),
+				Properties: &network.VirtualNetworkPropertiesFormat{
+					AddressSpace: &network.AddressSpace{AddressPrefixes: []*string{to.Ptr("10.0.0.0/16")}},
+				},
+			},
+		},
+		{
+			desc:    "GetVirtualNetwork() should return expected error",
+			testErr: fmt.Errorf("Virtual network not found"),
+		},
+	}
+	for i, test := range tests {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		az, _ := CreateAzureManager(getTestCloudConfig("", ""), getMockFactory(ctrl))
+		mockVnetClient := az.VirtualNetworkClient.(*mock_virtualnetworkclient.MockInterface)
+		mockVnetClient.EXPECT().Get(gomock.Any(), "testRG", "testVnet", gomock.Any()).Return(test.vnet, test.testErr)
+		vnet, err := az.GetVirtualNetwork(context.Background())
+		assert.Equal(t, to.Val(vnet), to.Val(test.vnet), "TestCase[%d]: %s", i, test.desc)
+		assert.Equal(t, err, test.testErr, "TestCase[%d]: %s", i, test.desc)
+	}
+}
+
+func TestGetSubnetByID(t *testing.T) {
+	tests := []struct {
+		desc         string
+		subnetID     string
+		subnet       *network.Subnet
+		expectedCall bool
+		testErr      error
+	}{
+		{
+			desc:         "GetSubnetByID() should return expected subnet",
+			subnetID:     "/subscriptions/testSub/resourceGroups/vnetRG/providers/Microsoft.Network/virtualNetworks/vnet/subnets/subnet",
+			subnet:       &network.Subnet{Name: to.Ptr("subnet")},
+			expectedCall: true,
+		},
+		{
+			desc:     "GetSubnetByID() should return error for non-subnet resource ID",
+			subnetID: "/subscriptions/testSub/resourceGroups/vnetRG/providers/Microsoft.Network/virtualNetworks/vnet",
+			testErr:  fmt.Errorf("/subscriptions/testSub/resourceGroups/vnetRG/providers/Microsoft.Network/virtualNetworks/vnet is not a subnet resource ID"),
+		},
+		{
+			desc:         "GetSubnetByID() should return expected error",
+			subnetID:     "/subscriptions/testSub/resourceGroups/vnetRG/providers/Microsoft.Network/virtualNetworks/vnet/subnets/subnet",
+			expectedCall: true,
+			testErr:      fmt.Errorf("Subnet not found"),
+		},
+	}
+	for i, test := range tests {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		az, _ := CreateAzureManager(getTestCloudConfig("", ""), getMockFactory(ctrl))
+		if test.expectedCall {
+			mockSubnetClient := az.SubnetClient.(*mock_subnetclient.MockInterface)
+			mockSubnetClient.EXPECT().Get(gomock.Any(), "vnetRG", "vnet", "subnet", gomock.Any()).Return(test.subnet, test.testErr)
+		}
+		subnet, err := az.GetSubnetByID(context.Background(), test.subnetID)
+		assert.Equal(t, to.Val(subnet), to.Val(test.subnet), "TestCase[%d]: %s", i, test.desc)
+		assert.Equal(t, err, test.testErr, "TestCase[%d]: %s", i, test.desc)
+	}
+}
+
+func TestGetNatGateway(t *testing.T) {
+	tests := []struct {
+		desc           string
+		rg             string
+		expectedRG     string
+		natGatewayName string
+		natGateway     *network.NatGateway
+		expectedCall   bool
+		testErr        error
+	}{
+		{
+			desc:           "GetNatGateway() should return expected nat gateway",
+			expectedRG:     "testRG",
+			natGatewayName: "natgw",
+			natGateway:     &network.NatGateway{Name: to.Ptr("natgw")},
+			expectedCall:   true,
+		},
+		{
+			desc:           "GetNatGateway() should return nat gateway with specified resource group",
+			rg:             "customRG",
+			expectedRG:     "customRG",
+			natGatewayName: "natgw",
+			natGateway:     &network.NatGateway{Name: to.Ptr("natgw")},
+			expectedCall:   true,
+		},
+		{
+			desc:         "GetNatGateway() should return error when nat gateway name is empty",
+			expectedCall: false,
+			testErr:      fmt.Errorf("nat gateway name is empty"),
+		},
+		{
+			desc:           "GetNatGateway() should return expected error",
+			expectedRG:     "testRG",
+			natGatewayName: "natgw",
+			expectedCall:   true,
+			testErr:        fmt.Errorf("nat gateway not found"),
+		},
+	}
+	for i, test := range tests {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		config := getTestCloudConfig("", "")
+		factory := getMockFactory(ctrl)
+		az, _ := CreateAzureManager(config, factory)
+		mockNatGatewayClient := mocknatgatewayclient.NewMockInterface(ctrl)
+		az.NatGatewayClient = mockNatGatewayClient
+		if test.expectedCall {
+			mockNatGatewayClient.EXPECT().Get(gomock.Any(), test.expectedRG, test.natGatewayName, gomock.Any()).Return(test.natGateway, test.testErr)
+		}
+		natGateway, err := az.GetNatGateway(context.Background(), test.rg, test.natGatewayName)
+		assert.Equal(t, err, test.testErr, "TestCase[%d]: %s", i, test.desc)
+		assert.Equal(t, to.Val(natGateway), to.Val(test.natGateway), "TestCase[%d]: %s", i, test.desc)
+	}
+}
+
+func TestCreateOrUpdateNatGateway(t *testing.T) {
+	tests := []struct {
+		desc           string
+		natGatewayName string
+		natGateway     *network.NatGateway
+		noClient       bool
+		expectedCall   bool
+		testErr        error
+	}{
+		{
+			desc:           "CreateOrUpdateNatGateway() should run as expected",
+			natGatewayName: "natgw",
+			natGateway:     &network.NatGateway{Name: to.Ptr("natgw")},
+			expectedCall:   true,
+		},
+		{
+			desc:           "CreateOrUpdateNatGateway() should return error when nat gateway client is not configured",
+			natGatewayName: "natgw",
+			noClient:       true,
+			testErr:        fmt.Errorf("nat gateway client is not configured"),
+		},
+		{
+			desc:           "CreateOrUpdateNatGateway() should return expected error",
+			natGatewayName: "natgw",
+			expectedCall:   true,
+			testErr:        fmt.Errorf("failed to update nat gateway"),
+		},
+	}
+	for i, test := range tests {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		config := getTestCloudConfig("", "")
+		factory := getMockFactory(ctrl)
+		az, _ := CreateAzureManager(config, factory)
+		if !test.noClient {
+			mockNatGatewayClient := mocknatgatewayclient.NewMockInterface(ctrl)
+			az.NatGatewayClient = mockNatGatewayClient
+			if test.expectedCall {
+				mockNatGatewayClient.EXPECT().CreateOrUpdate(gomock.Any(), "testRG", test.natGatewayName, to.Val(test.natGateway)).Return(test.natGateway, test.testErr)
+			}
+		}
+		natGateway, err := az.CreateOrUpdateNatGateway(context.Background(), "", test.natGatewayName, to.Val(test.natGateway))
+		assert.Equal(t, err, test.testErr, "TestCase[%d]: %s", i, test.desc)
+		assert.Equal(t, to.Val(natGateway), to.Val(test.natGateway), "TestCase[%d]: %s", i, test.desc)
+	}
+}
+
+func TestListPermissions(t *testing.T) {
+	tests := []struct {
+		desc         string
+		rg           string
+		expectedRG   string
+		noClient     bool
+		permissions  []permissionclient.Permission
+		expectedCall bool
+		testErr      error
+	}{
+		{
+			desc:         "ListPermissions() should return permissions in default resource group",
+			expectedRG:   "testRG",
+			permissions:  []permissionclient.Permission{{Actions: []string{"*"}}},
+			expectedCall: true,
+		},
+		{
+			desc:         "ListPermissions() should return permissions in specified resource group",
+			rg:           "customRG",
+			expectedRG:   "customRG",
+			permissions:  []permissionclient.Permission{{Actions: []string{"*"}}},
+			expectedCall: true,
+		},
+		{
+			desc:     "ListPermissions() should return error when permission client is not configured",
+			noClient: true,
+			testErr:  fmt.Errorf("permission client is not configured"),
+		},
+	}
+	for i, test := range tests {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		az, _ := CreateAzureManager(getTestCloudConfig("", ""), getMockFactory(ctrl))
+		if !test.noClient {
+			mockPermissionClient := mockpermissionclient.NewMockInterface(ctrl)
+			az.PermissionClient = mockPermissionClient
+			if test.expectedCall {
+				mockPermissionClient.EXPECT().ListForResourceGroup(gomock.Any(), test.expectedRG).Return(test.permissions, test.testErr)
+			}
+		}
+		permissions, err := az.ListPermissions(context.Background(), test.rg)
+		assert.Equal(t, err, test.testErr, "TestCase[%d]: %s", i, test.desc)
+		assert.Equal(t, permissions, test.permissions, "TestCase[%d]: %s", i, test.desc)
+	}
+}
+
+func TestListVMSSPermissions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az, _ := CreateAzureManager(getTestCloudConfig("", ""), getMockFactory(ctrl))
+	_, err := az.ListVMSSPermissions(context.Background(), "", "vmss")
+	assert.Equal(t, fmt.Errorf("permission client is not configured"), err)
+
+	mockPermissionClient := mockpermissionclient.NewMockInterface(ctrl)
+	az.PermissionClient = mockPermissionClient
+	expected := []permissionclient.Permission{{Actions: []string{"*"}}}
+	mockPermissionClient.EXPECT().ListForResource(gomock.Any(), "/subscriptions/testSub/resourceGroups/testRG/providers/Microsoft.Compute/virtualMachineScaleSets/vmss").Return(expected, nil)
+	permissions, err := az.ListVMSSPermissions(context.Background(), "", "vmss")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, permissions)
+}
+
 func getMockFactory(ctrl *gomock.Controller) azclient.ClientFactory {
 	factory := mock_azclient.NewMockClientFactory(ctrl)
 	factory.EXPECT().GetLoadBalancerClient().Return(mock_loadbalancerclient.NewMockInterface(ctrl))
 	factory.EXPECT().GetVirtualMachineScaleSetClient().Return(mock_virtualmachinescalesetclient.NewMockInterface(ctrl))
 	factory.EXPECT().GetVirtualMachineScaleSetVMClient().Return(mock_virtualmachinescalesetvmclient.NewMockInterface(ctrl))
 	factory.EXPECT().GetPublicIPPrefixClient().Return(mock_publicipprefixclient.NewMockInterface(ctrl))
+	factory.EXPECT().GetPublicIPAddressClient().Return(mock_publicipaddressclient.NewMockInterface(ctrl))
 	factory.EXPECT().GetInterfaceClient().Return(mock_interfaceclient.NewMockInterface(ctrl))
 	factory.EXPECT().GetSubnetClient().Return(mock_subnetclient.NewMockInterface(ctrl))
+	factory.EXPECT().GetVirtualNetworkClient().Return(mock_virtualnetworkclient.NewMockInterface(ctrl))
 	return factory
 }
 
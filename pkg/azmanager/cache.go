@@ -0,0 +1,122 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package azmanager
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resourceCache is a concurrency-safe in-memory cache of azure resources with a ttl.
+// Entries are stored serialized so that callers always get their own copy and can
+// modify returned resources freely.
+type resourceCache struct {
+	ttl     time.Duration
+	now     func() time.Time
+	lock    sync.Mutex
+	entries map[string]cacheEntry
+	// loadLock serializes loads with invalidations, so that a load racing with a write cannot cache the resource
+	// from before the write once the write has invalidated it
+	loadLock sync.Mutex
+}
+
+type cacheEntry struct {
+	data      []byte
+	expiresOn time.Time
+}
+
+func newResourceCache(ttl time.Duration) *resourceCache {
+	return &resourceCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// get unmarshals cached entry of key into obj, returns false if there's no valid entry
+func (c *resourceCache) get(key string, obj interface{}) bool {
+	if c == nil || c.ttl <= 0 {
+		return false
+	}
+	key = strings.ToLower(key)
+	c.lock.Lock()
+	entry, ok := c.entries[key]
+	if ok && !c.now().Before(entry.expiresOn) {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.lock.Unlock()
+	if !ok {
+		return false
+	}
+	return json.Unmarshal(entry.data, obj) == nil
+}
+
+// getOrLoad returns the cached entry of key, or calls load and caches its result on a miss. The entry is looked up
+// again and set under loadLock, which invalidations hold as well.
+func getOrLoad[T any](c *resourceCache, key string, load func() (T, error)) (T, error) {
+	var obj T
+	if c.get(key, &obj) {
+		return obj, nil
+	}
+	if c == nil || c.ttl <= 0 {
+		return load()
+	}
+	c.loadLock.Lock()
+	defer c.loadLock.Unlock()
+	if c.get(key, &obj) {
+		return obj, nil
+	}
+	obj, err := load()
+	if err != nil {
+		return obj, err
+	}
+	c.set(key, obj)
+	return obj, nil
+}
+
+func (c *resourceCache) set(key string, obj interface{}) {
+	if c == nil || c.ttl <= 0 {
+		return
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries[strings.ToLower(key)] = cacheEntry{data: data, expiresOn: c.now().Add(c.ttl)}
+}
+
+// delete removes entries of the given keys
+func (c *resourceCache) delete(keys ...string) {
+	if c == nil {
+		return
+	}
+	c.loadLock.Lock()
+	defer c.loadLock.Unlock()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, key := range keys {
+		delete(c.entries, strings.ToLower(key))
+	}
+}
+
+// deletePrefix removes all entries whose key starts with prefix
+func (c *resourceCache) deletePrefix(prefix string) {
+	if c == nil {
+		return
+	}
+	prefix = strings.ToLower(prefix)
+	c.loadLock.Lock()
+	defer c.loadLock.Unlock()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package azmanager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetclient/mock_virtualmachinescalesetclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetvmclient/mock_virtualmachinescalesetvmclient"
+
+	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
+)
+
+func TestResourceCache(t *testing.T) {
+	now := time.Now()
+	c := newResourceCache(time.Minute)
+	c.now = func() time.Time { return now }
+
+	vmss := &compute.VirtualMachineScaleSet{Name: to.Ptr("vmss")}
+	c.set("VMSS/RG/Name", vmss)
+
+	cached := &compute.VirtualMachineScaleSet{}
+	assert.True(t, c.get("vmss/rg/name", cached), "cache key should be case insensitive")
+	assert.Equal(t, to.Val(vmss), to.Val(cached))
+
+	// modifying returned object should not affect cached entry
+	cached.Name = to.Ptr("modified")
+	cached = &compute.VirtualMachineScaleSet{}
+	assert.True(t, c.get("vmss/rg/name", cached))
+	assert.Equal(t, "vmss", to.Val(cached.Name))
+
+	now = now.Add(time.Minute)
+	assert.False(t, c.get("vmss/rg/name", cached), "expired entry should not be returned")
+
+	c.set("vmssinstance/rg/name/0", vmss)
+	c.set("vmssinstance/rg/name/1", vmss)
+	c.set("vmssinstance/rg/name2/0", vmss)
+	c.deletePrefix("vmssinstance/rg/name/")
+	assert.False(t, c.get("vmssinstance/rg/name/0", cached))
+	assert.False(t, c.get("vmssinstance/rg/name/1", cached))
+	assert.True(t, c.get("vmssinstance/rg/name2/0", cached))
+	c.delete("vmssinstance/rg/name2/0")
+	assert.False(t, c.get("vmssinstance/rg/name2/0", cached))
+
+	disabled := newResourceCache(-time.Second)
+	disabled.set("vmss/rg/name", vmss)
+	assert.False(t, disabled.get("vmss/rg/name", cached), "cache with non-positive ttl should be disabled")
+}
+
+func TestResourceCacheConcurrency(t *testing.T) {
+	c := newResourceCache(time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("vmss/rg/vmss%d", i%3)
+			for j := 0; j < 100; j++ {
+				c.set(key, &compute.VirtualMachineScaleSet{Name: to.Ptr(key)})
+				vmss := &compute.VirtualMachineScaleSet{}
+				if c.get(key, vmss) {
+					assert.Equal(t, key, to.Val(vmss.Name))
+				}
+				if j%10 == 0 {
+					c.deletePrefix("vmss/rg/")
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestResourceCacheLoadRacingInvalidation(t *testing.T) {
+	c := newResourceCache(time.Minute)
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	loaded := make(chan struct{})
+	go func() {
+		defer close(loaded)
+		vmss, err := getOrLoad(c, "vmss/rg/name", func() (*compute.VirtualMachineScaleSet, error) {
+			close(loading)
+			<-release
+			return &compute.VirtualMachineScaleSet{Name: to.Ptr("stale")}, nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "stale", to.Val(vmss.Name))
+	}()
+
+	// a write completes while the load is in flight and invalidates the entry
+	<-loading
+	invalidated := make(chan struct{})
+	go func() {
+		defer close(invalidated)
+		c.delete("vmss/rg/name")
+	}()
+	select {
+	case <-invalidated:
+		t.Fatal("invalidation should wait for the in-flight load")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-loaded
+	<-invalidated
+
+	// the stale resource loaded before the write is not served
+	vmss, err := getOrLoad(c, "vmss/rg/name", func() (*compute.VirtualMachineScaleSet, error) {
+		return &compute.VirtualMachineScaleSet{Name: to.Ptr("fresh")}, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "fresh", to.Val(vmss.Name))
+
+	// cached entry is served without loading
+	vmss, err = getOrLoad(c, "vmss/rg/name", func() (*compute.VirtualMachineScaleSet, error) {
+		return nil, fmt.Errorf("should not load")
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "fresh", to.Val(vmss.Name))
+}
+
+func TestVMSSCacheInvalidation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az, _ := CreateAzureManager(getTestCloudConfig("", ""), getMockFactory(ctrl))
+	mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+	mockVMSSVMClient := az.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface)
+	vmss := &compute.VirtualMachineScaleSet{Name: to.Ptr("vmss"), Location: to.Ptr("old")}
+	updatedVMSS := &compute.VirtualMachineScaleSet{Name: to.Ptr("vmss"), Location: to.Ptr("new")}
+	vm := &compute.VirtualMachineScaleSetVM{InstanceID: to.Ptr("0"), Location: to.Ptr("old")}
+	updatedVM := &compute.VirtualMachineScaleSetVM{InstanceID: to.Ptr("0"), Location: to.Ptr("new")}
+
+	gomock.InOrder(
+		mockVMSSClient.EXPECT().Get(gomock.Any(), "testRG", "vmss", gomock.Any()).Return(vmss, nil).Times(1),
+		mockVMSSVMClient.EXPECT().List(gomock.Any(), "testRG", "vmss").Return([]*compute.VirtualMachineScaleSetVM{vm}, nil).Times(1),
+		mockVMSSVMClient.EXPECT().Get(gomock.Any(), "testRG", "vmss", "0").Return(vm, nil).Times(1),
+		mockVMSSClient.EXPECT().CreateOrUpdate(gomock.Any(), "testRG", "vmss", gomock.Any()).Return(updatedVMSS, nil),
+		mockVMSSClient.EXPECT().Get(gomock.Any(), "testRG", "vmss", gomock.Any()).Return(updatedVMSS, nil).Times(1),
+		mockVMSSVMClient.EXPECT().List(gomock.Any(), "testRG", "vmss").Return([]*compute.VirtualMachineScaleSetVM{vm}, nil).Times(1),
+		mockVMSSVMClient.EXPECT().Get(gomock.Any(), "testRG", "vmss", "0").Return(vm, nil).Times(1),
+		mockVMSSVMClient.EXPECT().Update(gomock.Any(), "testRG", "vmss", "0", gomock.Any()).Return(updatedVM, nil),
+		mockVMSSVMClient.EXPECT().List(gomock.Any(), "testRG", "vmss").Return([]*compute.VirtualMachineScaleSetVM{updatedVM}, nil).Times(1),
+		mockVMSSVMClient.EXPECT().Get(gomock.Any(), "testRG", "vmss", "0").Return(updatedVM, nil).Times(1),
+	)
+
+	// reads before any write are served from cache after the first call
+	for i := 0; i < 2; i++ {
+		ret, err := az.GetVMSS(context.Background(), "", "vmss")
+		assert.Nil(t, err)
+		assert.Equal(t, "old", to.Val(ret.Location))
+		vms, err := az.ListVMSSInstances(context.Background(), "", "vmss")
+		assert.Nil(t, err)
+		assert.Equal(t, "old", to.Val(vms[0].Location))
+		retVM, err := az.GetVMSSInstance(context.Background(), "", "vmss", "0")
+		assert.Nil(t, err)
+		assert.Equal(t, "old", to.Val(retVM.Location))
+	}
+
+	// vmss update invalidates vmss and all its instances
+	_, err := az.CreateOrUpdateVMSS(context.Background(), "", "vmss", *updatedVMSS)
+	assert.Nil(t, err)
+	for i := 0; i < 2; i++ {
+		ret, err := az.GetVMSS(context.Background(), "", "vmss")
+		assert.Nil(t, err)
+		assert.Equal(t, "new", to.Val(ret.Location))
+		_, err = az.ListVMSSInstances(context.Background(), "", "vmss")
+		assert.Nil(t, err)
+		_, err = az.GetVMSSInstance(context.Background(), "", "vmss", "0")
+		assert.Nil(t, err)
+	}
+
+	// instance update invalidates the instance and instance list
+	_, err = az.UpdateVMSSInstance(context.Background(), "", "vmss", "0", *updatedVM)
+	assert.Nil(t, err)
+	for i := 0; i < 2; i++ {
+		vms, err := az.ListVMSSInstances(context.Background(), "", "vmss")
+		assert.Nil(t, err)
+		assert.Equal(t, "new", to.Val(vms[0].Location))
+		retVM, err := az.GetVMSSInstance(context.Background(), "", "vmss", "0")
+		assert.Nil(t, err)
+		assert.Equal(t, "new", to.Val(retVM.Location))
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package azmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients"
+	"github.com/Azure/kube-egress-gateway/pkg/metrics"
+)
+
+const (
+	// circuit breaker states, also reported in metrics
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+
+	// circuitProbeRetryAfter is how long callers wait while the probe of a half-open circuit is in flight
+	circuitProbeRetryAfter = 5 * time.Second
+)
+
+// CircuitOpenError is returned without calling Azure while the circuit breaker of the operation is open after
+// repeated Azure failures
+type CircuitOpenError struct {
+	// Operation is the AzureManager operation whose calls are short-circuited, e.g. CreateOrUpdateVMSS
+	Operation string
+	// SubscriptionID and ResourceGroup are where calls of the operation are short-circuited, calls of the same
+	// operation in other resource groups are not affected
+	SubscriptionID string
+	ResourceGroup  string
+	// RetryAfter is how long until the circuit half-opens and lets a call through to probe Azure
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("Azure %s calls in resource group(%s) of subscription(%s) are suspended after repeated failures, retrying in %s",
+		e.Operation, e.ResourceGroup, e.SubscriptionID, e.RetryAfter.Round(time.Second))
+}
+
+// circuit identifies the calls of an Azure operation in a resource group, which share a circuit breaker
+type circuit struct {
+	operation      string
+	subscriptionID string
+	resourceGroup  string
+}
+
+func (c circuit) key() string {
+	return strings.ToLower(c.subscriptionID + "/" + c.resourceGroup + "/" + c.operation)
+}
+
+// callResult is how a call counts for its circuit breaker
+type callResult int
+
+const (
+	callSucceeded callResult = iota
+	callFailed
+	// callCanceled calls were abandoned by the caller before Azure answered and tell nothing about Azure
+	callCanceled
+)
+
+// circuitBreakers holds one circuit breaker per Azure operation and resource group, so that a failing resource
+// group or subscription does not suspend calls of other gateways. After threshold consecutive failures its circuit
+// opens and calls fail fast with CircuitOpenError for cooldown, then the circuit half-opens and lets one call
+// through: the circuit closes if it succeeds and opens again otherwise.
+// The zero value is ready to use.
+type circuitBreakers struct {
+	lock     sync.Mutex
+	breakers map[string]*circuitBreaker
+	// now returns the current time, replaced in tests
+	now func() time.Time
+}
+
+type circuitBreaker struct {
+	state string
+	// consecutive failures while closed
+	failures int
+	openedAt time.Time
+}
+
+// withCircuitBreaker calls Azure with call unless the circuit breaker of operation in resourceGroup is open.
+// Circuit breakers are disabled when CircuitBreakerThreshold is 0.
+func (az *AzureManager) withCircuitBreaker(ctx context.Context, operation, resourceGroup string, call func() error) error {
+	if az.CircuitBreakerThreshold <= 0 {
+		return call()
+	}
+	c := circuit{operation: operation, subscriptionID: az.SubscriptionID(), resourceGroup: resourceGroup}
+	if err := az.circuitBreakers.allow(ctx, c, az.CircuitBreakerCooldown); err != nil {
+		return err
+	}
+	err := call()
+	az.circuitBreakers.record(ctx, c, az.CircuitBreakerThreshold, getCallResult(err))
+	return err
+}
+
+// callAzure is withCircuitBreaker for calls returning a result
+func callAzure[T any](ctx context.Context, az *AzureManager, operation, resourceGroup string, call func() (T, error)) (T, error) {
+	var ret T
+	err := az.withCircuitBreaker(ctx, operation, resourceGroup, func() error {
+		var err error
+		ret, err = call()
+		return err
+	})
+	return ret, err
+}
+
+// CircuitOpen returns whether the circuit breaker of any Azure operation of the manager is not closed
+func (az *AzureManager) CircuitOpen() bool {
+	b := &az.circuitBreakers
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, cb := range b.breakers {
+		if cb.state != CircuitClosed {
+			return true
+		}
+	}
+	return false
+}
+
+// allow returns CircuitOpenError if calls of c are short-circuited. Once cooldown has passed since the circuit
+// opened, the caller is let through as the probe of the half-open circuit.
+func (b *circuitBreakers) allow(ctx context.Context, c circuit, cooldown time.Duration) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	cb := b.get(c)
+	switch cb.state {
+	case CircuitOpen:
+		if elapsed := b.since(cb.openedAt); elapsed < cooldown {
+			return c.openError(cooldown - elapsed)
+		}
+		b.transition(ctx, c, cb, CircuitHalfOpen)
+	case CircuitHalfOpen:
+		return c.openError(circuitProbeRetryAfter)
+	}
+	return nil
+}
+
+// record updates the circuit of c with the result of a call
+func (b *circuitBreakers) record(ctx context.Context, c circuit, threshold int, result callResult) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	cb := b.get(c)
+	switch result {
+	case callSucceeded:
+		cb.failures = 0
+		if cb.state != CircuitClosed {
+			b.transition(ctx, c, cb, CircuitClosed)
+		}
+	case callFailed:
+		cb.failures++
+		if cb.state == CircuitHalfOpen || (cb.state == CircuitClosed && cb.failures >= threshold) {
+			cb.openedAt = b.currentTime()
+			b.transition(ctx, c, cb, CircuitOpen)
+		}
+	case callCanceled:
+		if cb.state == CircuitHalfOpen {
+			// the probe did not reach Azure, reopen the circuit as it was so that the next call probes again
+			b.transition(ctx, c, cb, CircuitOpen)
+		}
+	}
+}
+
+func (b *circuitBreakers) get(c circuit) *circuitBreaker {
+	if b.breakers == nil {
+		b.breakers = make(map[string]*circuitBreaker)
+	}
+	cb, ok := b.breakers[c.key()]
+	if !ok {
+		cb = &circuitBreaker{state: CircuitClosed}
+		b.breakers[c.key()] = cb
+	}
+	return cb
+}
+
+func (b *circuitBreakers) transition(ctx context.Context, c circuit, cb *circuitBreaker, state string) {
+	log.FromContext(ctx).Info("Azure circuit breaker state changed", "operation", c.operation, "subscriptionID", c.subscriptionID,
+		"resourceGroup", c.resourceGroup, "from", cb.state, "to", state, "failures", cb.failures)
+	cb.state = state
+	if state == CircuitClosed {
+		cb.failures = 0
+	}
+	metrics.AzureCircuitBreakerTransitionCount.WithLabelValues(c.operation, c.subscriptionID, c.resourceGroup, state).Inc()
+	for _, s := range []string{CircuitClosed, CircuitOpen, CircuitHalfOpen} {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		metrics.AzureCircuitBreakerState.WithLabelValues(c.operation, c.subscriptionID, c.resourceGroup, s).Set(value)
+	}
+}
+
+func (c circuit) openError(retryAfter time.Duration) *CircuitOpenError {
+	return &CircuitOpenError{Operation: c.operation, SubscriptionID: c.subscriptionID, ResourceGroup: c.resourceGroup, RetryAfter: retryAfter}
+}
+
+func (b *circuitBreakers) currentTime() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+	return time.Now()
+}
+
+func (b *circuitBreakers) since(t time.Time) time.Duration {
+	return b.currentTime().Sub(t)
+}
+
+// getCallResult returns how a call returning err counts for its circuit breaker
+func getCallResult(err error) callResult {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return callCanceled
+	case isAzureOutageError(err):
+		return callFailed
+	default:
+		return callSucceeded
+	}
+}
+
+// isAzureOutageError returns whether err means Azure is unavailable: throttling, server errors or no response at
+// all. Other errors, e.g. not found, are Azure answering the request and do not trip the circuit.
+func isAzureOutageError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		err = azureclients.ConvertError(err)
+		return errors.As(err, new(*azureclients.ErrThrottled)) || errors.As(err, new(*azureclients.ErrServerError))
+	}
+	return true
+}
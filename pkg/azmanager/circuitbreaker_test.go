@@ -0,0 +1,177 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package azmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+	network "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/loadbalancerclient/mock_loadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetclient/mock_virtualmachinescalesetclient"
+
+	"github.com/Azure/kube-egress-gateway/pkg/metrics"
+	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az, _ := CreateAzureManager(getTestCloudConfig("", ""), getMockFactory(ctrl))
+	az.CircuitBreakerThreshold = 2
+	az.CircuitBreakerCooldown = time.Minute
+	now := time.Now()
+	az.circuitBreakers.now = func() time.Time { return now }
+	mockLoadBalancerClient := az.LoadBalancerClient.(*mock_loadbalancerclient.MockInterface)
+	serverErr := &azcore.ResponseError{StatusCode: http.StatusServiceUnavailable}
+
+	// circuit opens after consecutive failures
+	mockLoadBalancerClient.EXPECT().Get(gomock.Any(), "testRG", "testLB", gomock.Any()).Return(nil, serverErr).Times(2)
+	for i := 0; i < 2; i++ {
+		_, err := az.GetLB(context.Background())
+		assert.ErrorIs(t, err, serverErr)
+	}
+	assert.True(t, az.CircuitOpen())
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.AzureCircuitBreakerState.WithLabelValues("GetLB", "testSub", "testRG", CircuitOpen)))
+
+	// calls are short-circuited until cooldown has passed, other operations are not affected
+	now = now.Add(40 * time.Second)
+	_, err := az.GetLB(context.Background())
+	var circuitErr *CircuitOpenError
+	assert.True(t, errors.As(err, &circuitErr))
+	assert.Equal(t, &CircuitOpenError{Operation: "GetLB", SubscriptionID: "testSub", ResourceGroup: "testRG", RetryAfter: 20 * time.Second}, circuitErr)
+	assert.EqualError(t, circuitErr, "Azure GetLB calls in resource group(testRG) of subscription(testSub) are suspended after repeated failures, retrying in 20s")
+	mockLoadBalancerClient.EXPECT().Delete(gomock.Any(), "testRG", "testLB").Return(nil)
+	assert.Nil(t, az.DeleteLB(context.Background()))
+
+	// failed probe opens the circuit again
+	now = now.Add(20 * time.Second)
+	mockLoadBalancerClient.EXPECT().Get(gomock.Any(), "testRG", "testLB", gomock.Any()).Return(nil, serverErr)
+	_, err = az.GetLB(context.Background())
+	assert.ErrorIs(t, err, serverErr)
+	_, err = az.GetLB(context.Background())
+	assert.True(t, errors.As(err, &circuitErr))
+	assert.Equal(t, time.Minute, circuitErr.RetryAfter)
+
+	// successful probe closes the circuit
+	now = now.Add(time.Minute)
+	mockLoadBalancerClient.EXPECT().Get(gomock.Any(), "testRG", "testLB", gomock.Any()).Return(&network.LoadBalancer{Name: to.Ptr("testLB")}, nil)
+	lb, err := az.GetLB(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "testLB", to.Val(lb.Name))
+	assert.False(t, az.CircuitOpen())
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.AzureCircuitBreakerState.WithLabelValues("GetLB", "testSub", "testRG", CircuitClosed)))
+}
+
+func TestCircuitBreakerByResourceGroup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az, _ := CreateAzureManager(getTestCloudConfig("", ""), getMockFactory(ctrl))
+	az.CircuitBreakerThreshold = 1
+	az.CircuitBreakerCooldown = time.Minute
+	mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+	serverErr := &azcore.ResponseError{StatusCode: http.StatusServiceUnavailable}
+
+	mockVMSSClient.EXPECT().Get(gomock.Any(), "badRG", "vmss", gomock.Any()).Return(nil, serverErr)
+	_, err := az.GetVMSS(context.Background(), "badRG", "vmss")
+	assert.ErrorIs(t, err, serverErr)
+	_, err = az.GetVMSS(context.Background(), "BADRG", "vmss")
+	assert.True(t, errors.As(err, new(*CircuitOpenError)))
+
+	// calls of the operation in other resource groups are not short-circuited
+	mockVMSSClient.EXPECT().Get(gomock.Any(), "testRG", "vmss", gomock.Any()).Return(&compute.VirtualMachineScaleSet{Name: to.Ptr("vmss")}, nil)
+	vmss, err := az.GetVMSS(context.Background(), "", "vmss")
+	assert.Nil(t, err)
+	assert.Equal(t, "vmss", to.Val(vmss.Name))
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	b := &circuitBreakers{}
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	c := circuit{operation: "op", subscriptionID: "sub", resourceGroup: "rg"}
+	b.record(context.Background(), c, 1, callFailed)
+	now = now.Add(time.Minute)
+	assert.Nil(t, b.allow(context.Background(), c, time.Minute))
+	// only one probe is let through while half-open
+	assert.Equal(t, &CircuitOpenError{Operation: "op", SubscriptionID: "sub", ResourceGroup: "rg", RetryAfter: circuitProbeRetryAfter}, b.allow(context.Background(), c, time.Minute))
+
+	// a canceled probe does not close the circuit, the next call probes again
+	b.record(context.Background(), c, 1, callCanceled)
+	assert.Equal(t, CircuitOpen, b.get(c).state)
+	assert.Nil(t, b.allow(context.Background(), c, time.Minute))
+	assert.Equal(t, CircuitHalfOpen, b.get(c).state)
+	b.record(context.Background(), c, 1, callSucceeded)
+	assert.Equal(t, CircuitClosed, b.get(c).state)
+
+	// canceled calls do not count as failures nor reset them
+	b.record(context.Background(), c, 2, callFailed)
+	b.record(context.Background(), c, 2, callCanceled)
+	assert.Equal(t, 1, b.get(c).failures)
+	b.record(context.Background(), c, 2, callFailed)
+	assert.Equal(t, CircuitOpen, b.get(c).state)
+}
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az, _ := CreateAzureManager(getTestCloudConfig("", ""), getMockFactory(ctrl))
+	az.CircuitBreakerThreshold = 1
+	az.CircuitBreakerCooldown = time.Minute
+	mockLoadBalancerClient := az.LoadBalancerClient.(*mock_loadbalancerclient.MockInterface)
+	mockLoadBalancerClient.EXPECT().Get(gomock.Any(), "testRG", "testLB", gomock.Any()).Return(nil, &azcore.ResponseError{StatusCode: http.StatusNotFound}).Times(2)
+	for i := 0; i < 2; i++ {
+		_, err := az.GetLB(context.Background())
+		assert.NotNil(t, err)
+		assert.False(t, errors.As(err, new(*CircuitOpenError)))
+	}
+	assert.False(t, az.CircuitOpen())
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az, _ := CreateAzureManager(getTestCloudConfig("", ""), getMockFactory(ctrl))
+	mockLoadBalancerClient := az.LoadBalancerClient.(*mock_loadbalancerclient.MockInterface)
+	mockLoadBalancerClient.EXPECT().Get(gomock.Any(), "testRG", "testLB", gomock.Any()).Return(nil, fmt.Errorf("connection refused")).Times(10)
+	for i := 0; i < 10; i++ {
+		_, err := az.GetLB(context.Background())
+		assert.EqualError(t, err, "connection refused")
+	}
+	assert.False(t, az.CircuitOpen())
+}
+
+func TestGetCallResult(t *testing.T) {
+	assert.Equal(t, callSucceeded, getCallResult(nil))
+	assert.Equal(t, callSucceeded, getCallResult(&azcore.ResponseError{StatusCode: http.StatusNotFound}))
+	assert.Equal(t, callFailed, getCallResult(&azcore.ResponseError{StatusCode: http.StatusTooManyRequests}))
+	assert.Equal(t, callCanceled, getCallResult(fmt.Errorf("failed to get vmss: %w", context.Canceled)))
+}
+
+func TestIsAzureOutageError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{err: nil, expected: false},
+		{err: context.Canceled, expected: false},
+		{err: context.DeadlineExceeded, expected: true},
+		{err: fmt.Errorf("dial tcp: connection refused"), expected: true},
+		{err: &azcore.ResponseError{StatusCode: http.StatusTooManyRequests}, expected: true},
+		{err: &azcore.ResponseError{StatusCode: http.StatusInternalServerError}, expected: true},
+		{err: &azcore.ResponseError{StatusCode: http.StatusConflict}, expected: false},
+		{err: &azcore.ResponseError{StatusCode: http.StatusNotFound}, expected: false},
+	}
+	for i, test := range tests {
+		assert.Equal(t, test.expected, isAzureOutageError(test.err), "TestCase[%d]: %v", i, test.err)
+	}
+}
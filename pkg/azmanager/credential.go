@@ -0,0 +1,35 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package azmanager
+
+import (
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient"
+
+	"github.com/Azure/kube-egress-gateway/pkg/config"
+)
+
+// NewTokenCredential returns the credential azure clients authenticate with, selected by cloud config in this order:
+// workload identity, managed identity, then client secret. The workload identity credential re-reads the federated
+// token file before the projected service account token expires, so rotated tokens are picked up without restart.
+func NewTokenCredential(cloud *config.CloudConfig) (azcore.TokenCredential, error) {
+	authProvider, err := azclient.NewAuthProvider(&cloud.ARMClientConfig, &cloud.AzureAuthConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create auth provider: %w", err)
+	}
+	var cred azcore.TokenCredential
+	switch {
+	case cloud.UseFederatedWorkloadIdentityExtension:
+		cred = authProvider.FederatedIdentityCredential
+	case cloud.UseManagedIdentityExtension:
+		cred = authProvider.ManagedIdentityCredential
+	default:
+		cred = authProvider.ClientSecretCredential
+	}
+	if cred == nil {
+		return nil, fmt.Errorf("no azure credential is configured")
+	}
+	return cred, nil
+}
@@ -0,0 +1,67 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package azmanager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient"
+
+	"github.com/Azure/kube-egress-gateway/pkg/config"
+)
+
+func TestNewTokenCredential(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.Nil(t, os.WriteFile(tokenFile, []byte("token"), 0600))
+
+	tests := map[string]struct {
+		authConfig azclient.AzureAuthConfig
+		expected   interface{}
+		expectErr  bool
+	}{
+		"workload identity": {
+			authConfig: azclient.AzureAuthConfig{
+				UseFederatedWorkloadIdentityExtension: true,
+				AADClientID:                           "client",
+				AADFederatedTokenFile:                 tokenFile,
+			},
+			expected: &azidentity.WorkloadIdentityCredential{},
+		},
+		"managed identity": {
+			authConfig: azclient.AzureAuthConfig{
+				UseManagedIdentityExtension: true,
+				UserAssignedIdentityID:      "client",
+			},
+			expected: &azidentity.ManagedIdentityCredential{},
+		},
+		"client secret": {
+			authConfig: azclient.AzureAuthConfig{
+				AADClientID:     "client",
+				AADClientSecret: "secret",
+			},
+			expected: &azidentity.ClientSecretCredential{},
+		},
+		"no credential": {
+			authConfig: azclient.AzureAuthConfig{AADClientID: "client"},
+			expectErr:  true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cred, err := NewTokenCredential(&config.CloudConfig{
+				ARMClientConfig: azclient.ARMClientConfig{Cloud: "AzurePublicCloud", TenantID: "tenant"},
+				AzureAuthConfig: test.authConfig,
+			})
+			if test.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.IsType(t, test.expected, cred)
+		})
+	}
+}
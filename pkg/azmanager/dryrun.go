@@ -0,0 +1,43 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package azmanager
+
+import (
+	"context"
+
+	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// public IP prefix ID template, used to fake the ID of a prefix that would be created in dry run mode
+	PublicIPPrefixIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/publicIPPrefixes/%s"
+)
+
+// logDryRunWrite logs the change a skipped write would make to an Azure resource, as a diff from current to desired.
+// current is nil when the resource does not exist and desired is nil for deletion.
+func logDryRunWrite[T any](ctx context.Context, operation, resourceType, resourceGroup, name string, current, desired *T) {
+	log.FromContext(ctx).Info("Dry run, skipping Azure write",
+		"operation", operation,
+		"resourceType", resourceType,
+		"resourceGroup", resourceGroup,
+		"name", name,
+		"diff", cmp.Diff(current, desired))
+}
+
+// vmssNetworkProfile returns the part of vmss that the controller updates
+func vmssNetworkProfile(vmss *compute.VirtualMachineScaleSet) *compute.VirtualMachineScaleSetNetworkProfile {
+	if vmss == nil || vmss.Properties == nil || vmss.Properties.VirtualMachineProfile == nil {
+		return nil
+	}
+	return vmss.Properties.VirtualMachineProfile.NetworkProfile
+}
+
+// vmssVMNetworkProfile returns the part of vmss instance that the controller updates
+func vmssVMNetworkProfile(vm *compute.VirtualMachineScaleSetVM) *compute.VirtualMachineScaleSetVMNetworkProfileConfiguration {
+	if vm == nil || vm.Properties == nil {
+		return nil
+	}
+	return vm.Properties.NetworkProfileConfiguration
+}
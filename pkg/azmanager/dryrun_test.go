@@ -0,0 +1,92 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package azmanager
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+	network "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/loadbalancerclient/mock_loadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/publicipprefixclient/mock_publicipprefixclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetclient/mock_virtualmachinescalesetclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetvmclient/mock_virtualmachinescalesetvmclient"
+
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients/natgatewayclient/mocknatgatewayclient"
+	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
+)
+
+func getTestDryRunAzureManager(t *testing.T) *AzureManager {
+	ctrl := gomock.NewController(t)
+	az, _ := CreateAzureManager(getTestCloudConfig("", ""), getMockFactory(ctrl))
+	az.NatGatewayClient = mocknatgatewayclient.NewMockInterface(ctrl)
+	az.DryRun = true
+	return az
+}
+
+func TestDryRunLB(t *testing.T) {
+	az := getTestDryRunAzureManager(t)
+	mockLoadBalancerClient := az.LoadBalancerClient.(*mock_loadbalancerclient.MockInterface)
+	lb := network.LoadBalancer{Name: to.Ptr("testLB"), Location: to.Ptr("location")}
+	mockLoadBalancerClient.EXPECT().Get(gomock.Any(), "testRG", "testLB", nil).Return(nil, fmt.Errorf("not found")).Times(2)
+
+	ret, err := az.CreateOrUpdateLB(context.Background(), lb)
+	assert.Nil(t, err)
+	assert.Equal(t, lb, to.Val(ret))
+	assert.Nil(t, az.DeleteLB(context.Background()))
+}
+
+func TestDryRunVMSS(t *testing.T) {
+	az := getTestDryRunAzureManager(t)
+	mockVMSSClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+	mockVMSSVMClient := az.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface)
+	vmss := compute.VirtualMachineScaleSet{
+		Name: to.Ptr("vmss"),
+		Properties: &compute.VirtualMachineScaleSetProperties{
+			VirtualMachineProfile: &compute.VirtualMachineScaleSetVMProfile{
+				NetworkProfile: &compute.VirtualMachineScaleSetNetworkProfile{},
+			},
+		},
+	}
+	vm := compute.VirtualMachineScaleSetVM{
+		InstanceID: to.Ptr("0"),
+		Properties: &compute.VirtualMachineScaleSetVMProperties{
+			NetworkProfileConfiguration: &compute.VirtualMachineScaleSetVMNetworkProfileConfiguration{},
+		},
+	}
+	mockVMSSClient.EXPECT().Get(gomock.Any(), "testRG", "vmss", nil).Return(&compute.VirtualMachineScaleSet{Name: to.Ptr("vmss")}, nil)
+	mockVMSSVMClient.EXPECT().Get(gomock.Any(), "testRG", "vmss", "0").Return(&compute.VirtualMachineScaleSetVM{InstanceID: to.Ptr("0")}, nil)
+
+	retVMSS, err := az.CreateOrUpdateVMSS(context.Background(), "", "vmss", vmss)
+	assert.Nil(t, err)
+	assert.Equal(t, vmss, to.Val(retVMSS))
+	retVM, err := az.UpdateVMSSInstance(context.Background(), "", "vmss", "0", vm)
+	assert.Nil(t, err)
+	assert.Equal(t, vm, to.Val(retVM))
+}
+
+func TestDryRunPublicIPPrefix(t *testing.T) {
+	az := getTestDryRunAzureManager(t)
+	mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+	mockPublicIPPrefixClient.EXPECT().Get(gomock.Any(), "testRG", "prefix", nil).Return(nil, fmt.Errorf("not found")).Times(2)
+
+	prefix, err := az.CreateOrUpdatePublicIPPrefix(context.Background(), "", "prefix", network.PublicIPPrefix{Name: to.Ptr("prefix")})
+	assert.Nil(t, err)
+	assert.Equal(t, "/subscriptions/testSub/resourceGroups/testRG/providers/Microsoft.Network/publicIPPrefixes/prefix", to.Val(prefix.ID))
+	assert.Nil(t, az.DeletePublicIPPrefix(context.Background(), "", "prefix"))
+}
+
+func TestDryRunNatGateway(t *testing.T) {
+	az := getTestDryRunAzureManager(t)
+	mockNatGatewayClient := az.NatGatewayClient.(*mocknatgatewayclient.MockInterface)
+	natGateway := network.NatGateway{Name: to.Ptr("natgw"), Properties: &network.NatGatewayPropertiesFormat{}}
+	mockNatGatewayClient.EXPECT().Get(gomock.Any(), "testRG", "natgw", nil).Return(&network.NatGateway{Name: to.Ptr("natgw")}, nil)
+
+	ret, err := az.CreateOrUpdateNatGateway(context.Background(), "", "natgw", natGateway)
+	assert.Nil(t, err)
+	assert.Equal(t, natGateway, to.Val(ret))
+}
@@ -0,0 +1,49 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package azmanager
+
+import (
+	"strings"
+	"sync"
+)
+
+// resourceLocks holds one mutex per azure resource, so that concurrent read-modify-write of
+// the same resource is serialized while operations on different resources run in parallel.
+// The zero value is ready to use.
+type resourceLocks struct {
+	lock  sync.Mutex
+	locks map[string]*resourceLock
+}
+
+type resourceLock struct {
+	sync.Mutex
+	// number of callers holding or waiting for the lock
+	refs int
+}
+
+// acquire blocks until the lock of key is held and returns the function to release it
+func (l *resourceLocks) acquire(key string) func() {
+	key = strings.ToLower(key)
+	l.lock.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*resourceLock)
+	}
+	rl, ok := l.locks[key]
+	if !ok {
+		rl = &resourceLock{}
+		l.locks[key] = rl
+	}
+	rl.refs++
+	l.lock.Unlock()
+
+	rl.Lock()
+	return func() {
+		rl.Unlock()
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		rl.refs--
+		if rl.refs == 0 {
+			delete(l.locks, key)
+		}
+	}
+}
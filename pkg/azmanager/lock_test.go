@@ -0,0 +1,104 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package azmanager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	network "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/publicipprefixclient/mock_publicipprefixclient"
+)
+
+func TestResourceLocks(t *testing.T) {
+	locks := &resourceLocks{}
+
+	t.Run("same resource is serialized", func(t *testing.T) {
+		var holders, maxHolders int32
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// resource IDs are case insensitive
+				key := "resource"
+				if i%2 == 0 {
+					key = "RESOURCE"
+				}
+				defer locks.acquire(key)()
+				cur := atomic.AddInt32(&holders, 1)
+				for {
+					prev := atomic.LoadInt32(&maxHolders)
+					if cur <= prev || atomic.CompareAndSwapInt32(&maxHolders, prev, cur) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				atomic.AddInt32(&holders, -1)
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(1), maxHolders)
+	})
+
+	t.Run("different resources are not blocked", func(t *testing.T) {
+		unlock := locks.acquire("resource1")
+		done := make(chan struct{})
+		go func() {
+			defer locks.acquire("resource2")()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("lock of resource2 is blocked by resource1")
+		}
+		unlock()
+	})
+
+	assert.Empty(t, locks.locks, "released locks should be removed")
+}
+
+// TestConcurrentPublicIPPrefixProvisioning verifies that prefixes of different gateways are provisioned at the same
+// time, every call is blocked in Azure until all of them are in flight
+func TestConcurrentPublicIPPrefixProvisioning(t *testing.T) {
+	const gateways = 10
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az, _ := CreateAzureManager(getTestCloudConfig("", ""), getMockFactory(ctrl))
+	mockPublicIPPrefixClient := az.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	mockPublicIPPrefixClient.EXPECT().CreateOrUpdate(gomock.Any(), "testRG", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, resourceGroupName, publicIPPrefixName string, parameters network.PublicIPPrefix) (*network.PublicIPPrefix, error) {
+			entered <- struct{}{}
+			<-release
+			return &parameters, nil
+		}).Times(gateways)
+
+	var wg sync.WaitGroup
+	for i := 0; i < gateways; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := az.CreateOrUpdatePublicIPPrefix(context.Background(), "", fmt.Sprintf("prefix%d", i), network.PublicIPPrefix{})
+			assert.NoError(t, err)
+		}()
+	}
+	for i := 0; i < gateways; i++ {
+		select {
+		case <-entered:
+		case <-time.After(10 * time.Second):
+			close(release)
+			t.Fatalf("only %d of %d prefixes are provisioned at the same time", i, gateways)
+		}
+	}
+	close(release)
+	wg.Wait()
+}
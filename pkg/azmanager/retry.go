@@ -0,0 +1,74 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package azmanager
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/policy/retryrepectthrottled"
+
+	"github.com/Azure/kube-egress-gateway/pkg/config"
+	"github.com/Azure/kube-egress-gateway/pkg/metrics"
+)
+
+// WithRetryOptions returns an azure client option mutation function applying the backoff settings in cloud config.
+// The sdk retry policy backs off exponentially with jitter, honors Retry-After header and stops retrying once the
+// request context is done. Throttled (429) requests are retried as well and counted in metrics, and so are the
+// count and latency of all requests.
+func WithRetryOptions(cloud *config.CloudConfig) func(*arm.ClientOptions) {
+	return func(options *arm.ClientOptions) {
+		// zero values keep the defaults of azclient
+		if cloud.CloudProviderBackoffRetries != 0 {
+			options.Retry.MaxRetries = cloud.CloudProviderBackoffRetries
+		}
+		if cloud.CloudProviderBackoffDuration > 0 {
+			options.Retry.RetryDelay = time.Duration(cloud.CloudProviderBackoffDuration) * time.Second
+		}
+		if cloud.CloudProviderBackoffMaxDuration > 0 {
+			options.Retry.MaxRetryDelay = time.Duration(cloud.CloudProviderBackoffMaxDuration) * time.Second
+		}
+		options.Retry.StatusCodes = append(retryrepectthrottled.GetRetriableStatusCode(), http.StatusTooManyRequests)
+		// appended as the innermost per-retry policy so that it sees every response from azure resource manager
+		options.PerRetryPolicies = append(options.PerRetryPolicies, &throttlingMetricsPolicy{})
+		// per-call policies run before the retry policy, so that a request is observed once with all its retries
+		options.PerCallPolicies = append(options.PerCallPolicies, &requestMetricsPolicy{})
+	}
+}
+
+// requestMetricsPolicy reports count and latency of requests to azure resource manager
+type requestMetricsPolicy struct{}
+
+func (p *requestMetricsPolicy) Do(req *policy.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := req.Next()
+	result := metrics.AzureRequestResultSucceeded
+	if err != nil || resp.StatusCode >= http.StatusBadRequest {
+		result = metrics.AzureRequestResultFailed
+	}
+	labels := []string{req.Raw().Method, getResourceType(req.Raw().URL.Path), result}
+	metrics.AzureRequestCount.WithLabelValues(labels...).Inc()
+	metrics.AzureRequestLatency.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// throttlingMetricsPolicy counts requests throttled by azure resource manager
+type throttlingMetricsPolicy struct{}
+
+func (p *throttlingMetricsPolicy) Do(req *policy.Request) (*http.Response, error) {
+	resp, err := req.Next()
+	if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+		metrics.AzureRequestThrottledCount.WithLabelValues(req.Raw().Method, getResourceType(req.Raw().URL.Path)).Inc()
+	}
+	return resp, err
+}
+
+func getResourceType(path string) string {
+	resourceID, err := arm.ParseResourceID(path)
+	if err != nil {
+		return "unknown"
+	}
+	return resourceID.ResourceType.String()
+}
@@ -0,0 +1,177 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package azmanager
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient"
+
+	"github.com/Azure/kube-egress-gateway/pkg/config"
+	"github.com/Azure/kube-egress-gateway/pkg/metrics"
+)
+
+const testPrefixURL = "https://management.azure.com/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix"
+
+type fakeTransport struct {
+	statusCodes []int
+	calls       int
+}
+
+func (f *fakeTransport) Do(req *http.Request) (*http.Response, error) {
+	statusCode := f.statusCodes[len(f.statusCodes)-1]
+	if f.calls < len(f.statusCodes) {
+		statusCode = f.statusCodes[f.calls]
+	}
+	f.calls++
+	return &http.Response{
+		StatusCode: statusCode,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("{}")),
+		Request:    req,
+	}, nil
+}
+
+func getTestPipeline(t *testing.T, cloud *config.CloudConfig, transport *fakeTransport, retryDelay time.Duration) runtime.Pipeline {
+	options, err := azclient.GetDefaultResourceClientOption(nil, nil)
+	assert.Nil(t, err)
+	WithRetryOptions(cloud)(options)
+	// use short delay to keep the test fast
+	options.Retry.RetryDelay = retryDelay
+	options.Transport = transport
+	return runtime.NewPipeline("test", "v0.0.1", runtime.PipelineOptions{}, &options.ClientOptions)
+}
+
+func TestWithRetryOptions(t *testing.T) {
+	options := &arm.ClientOptions{}
+	WithRetryOptions(&config.CloudConfig{
+		CloudProviderBackoffRetries:     5,
+		CloudProviderBackoffDuration:    2,
+		CloudProviderBackoffMaxDuration: 30,
+	})(options)
+	assert.Equal(t, int32(5), options.Retry.MaxRetries)
+	assert.Equal(t, 2*time.Second, options.Retry.RetryDelay)
+	assert.Equal(t, 30*time.Second, options.Retry.MaxRetryDelay)
+	assert.Contains(t, options.Retry.StatusCodes, http.StatusTooManyRequests)
+	assert.Contains(t, options.Retry.StatusCodes, http.StatusServiceUnavailable)
+	assert.Len(t, options.PerRetryPolicies, 1)
+	assert.Len(t, options.PerCallPolicies, 1)
+
+	defaults, err := azclient.GetDefaultResourceClientOption(nil, nil)
+	assert.Nil(t, err)
+	retryOptions := defaults.Retry
+	WithRetryOptions(&config.CloudConfig{})(defaults)
+	assert.Equal(t, retryOptions.MaxRetries, defaults.Retry.MaxRetries)
+	assert.Equal(t, retryOptions.RetryDelay, defaults.Retry.RetryDelay)
+	assert.Equal(t, retryOptions.MaxRetryDelay, defaults.Retry.MaxRetryDelay)
+}
+
+func TestRetryOnThrottling(t *testing.T) {
+	tests := []struct {
+		desc                  string
+		statusCodes           []int
+		maxRetries            int32
+		expectedCalls         int
+		expectedStatusCode    int
+		expectErr             bool
+		expectedThrottleCount float64
+	}{
+		{
+			desc:                  "should retry throttled request until it succeeds",
+			statusCodes:           []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusOK},
+			maxRetries:            3,
+			expectedCalls:         3,
+			expectedStatusCode:    http.StatusOK,
+			expectedThrottleCount: 2,
+		},
+		{
+			desc:                  "should stop retrying throttled request after max retries",
+			statusCodes:           []int{http.StatusTooManyRequests},
+			maxRetries:            2,
+			expectedCalls:         3,
+			expectErr:             true,
+			expectedThrottleCount: 3,
+		},
+		{
+			desc:               "should retry server error without counting throttling",
+			statusCodes:        []int{http.StatusInternalServerError, http.StatusOK},
+			maxRetries:         3,
+			expectedCalls:      2,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			desc:               "should not retry when retries are disabled",
+			statusCodes:        []int{http.StatusInternalServerError, http.StatusOK},
+			maxRetries:         -1,
+			expectedCalls:      1,
+			expectedStatusCode: http.StatusInternalServerError,
+		},
+	}
+	for i, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			defer metrics.AzureRequestThrottledCount.Reset()
+			transport := &fakeTransport{statusCodes: test.statusCodes}
+			pipeline := getTestPipeline(t, &config.CloudConfig{CloudProviderBackoffRetries: test.maxRetries}, transport, time.Millisecond)
+			req, err := runtime.NewRequest(context.Background(), http.MethodGet, testPrefixURL)
+			assert.Nil(t, err)
+			resp, err := pipeline.Do(req)
+			assert.Equal(t, test.expectedCalls, transport.calls, "TestCase[%d]: %s", i, test.desc)
+			if test.expectErr {
+				assert.NotNil(t, err, "TestCase[%d]: %s", i, test.desc)
+			} else {
+				assert.Nil(t, err, "TestCase[%d]: %s", i, test.desc)
+				assert.Equal(t, test.expectedStatusCode, resp.StatusCode, "TestCase[%d]: %s", i, test.desc)
+			}
+			assert.Equal(t, test.expectedThrottleCount,
+				testutil.ToFloat64(metrics.AzureRequestThrottledCount.WithLabelValues(http.MethodGet, "Microsoft.Network/publicIPPrefixes")),
+				"TestCase[%d]: %s", i, test.desc)
+		})
+	}
+}
+
+func TestRetryAbortsOnContextCancellation(t *testing.T) {
+	defer metrics.AzureRequestThrottledCount.Reset()
+	transport := &fakeTransport{statusCodes: []int{http.StatusTooManyRequests}}
+	pipeline := getTestPipeline(t, &config.CloudConfig{CloudProviderBackoffRetries: 3}, transport, time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, err := runtime.NewRequest(ctx, http.MethodPut, testPrefixURL)
+	assert.Nil(t, err)
+	start := time.Now()
+	_, err = pipeline.Do(req)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 10*time.Second)
+	assert.Equal(t, 1, transport.calls)
+}
+
+func TestRequestMetrics(t *testing.T) {
+	// other tests send requests through the same pipeline
+	metrics.AzureRequestCount.Reset()
+	metrics.AzureRequestLatency.Reset()
+	for _, statusCodes := range [][]int{
+		{http.StatusTooManyRequests, http.StatusOK},
+		{http.StatusOK},
+		{http.StatusNotFound},
+	} {
+		transport := &fakeTransport{statusCodes: statusCodes}
+		pipeline := getTestPipeline(t, &config.CloudConfig{CloudProviderBackoffRetries: 3}, transport, time.Millisecond)
+		req, err := runtime.NewRequest(context.Background(), http.MethodGet, testPrefixURL)
+		assert.Nil(t, err)
+		_, _ = pipeline.Do(req)
+	}
+
+	resourceType := "Microsoft.Network/publicIPPrefixes"
+	// retries of a request are not counted as separate requests
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.AzureRequestCount.WithLabelValues(http.MethodGet, resourceType, metrics.AzureRequestResultSucceeded)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.AzureRequestCount.WithLabelValues(http.MethodGet, resourceType, metrics.AzureRequestResultFailed)))
+	assert.Equal(t, 2, testutil.CollectAndCount(metrics.AzureRequestLatency))
+}
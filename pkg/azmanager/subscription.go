@@ -0,0 +1,83 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package azmanager
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient"
+
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients/natgatewayclient"
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients/permissionclient"
+)
+
+// SubscriptionClients are the Azure clients of one subscription
+type SubscriptionClients struct {
+	Factory          azclient.ClientFactory
+	NatGatewayClient natgatewayclient.Interface
+	PermissionClient permissionclient.Interface
+}
+
+// subscriptionManagers caches the AzureManagers of gateways in other subscriptions than the cluster's.
+// The zero value is ready to use.
+type subscriptionManagers struct {
+	lock     sync.Mutex
+	managers map[string]*AzureManager
+}
+
+// ForSubscription returns the AzureManager calling Azure in subscriptionID, with resourceGroup as the default
+// resource group of VMSSes and managed public IP prefixes, for gateways whose VMSSes are in another subscription than
+// the cluster. It returns az itself when subscriptionID is empty or the cluster subscription. VMSSes can only join a
+// LoadBalancer in their own virtual network, which is in their subscription, so the gateway LoadBalancer of the
+// returned manager is a LoadBalancer of the same name in resourceGroup, an existing cluster LoadBalancer is not used.
+func (az *AzureManager) ForSubscription(subscriptionID, resourceGroup string) (*AzureManager, error) {
+	if subscriptionID == "" || strings.EqualFold(subscriptionID, az.SubscriptionID()) {
+		return az, nil
+	}
+	if az.parent != nil {
+		return az.parent.ForSubscription(subscriptionID, resourceGroup)
+	}
+
+	m := &az.subscriptionManagers
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	key := strings.ToLower(subscriptionID + "/" + resourceGroup)
+	if sub, ok := m.managers[key]; ok {
+		return sub, nil
+	}
+	if az.NewSubscriptionClients == nil {
+		return nil, fmt.Errorf("azure clients of subscription(%s) are not supported, gateways must be in the cluster subscription(%s)", subscriptionID, az.SubscriptionID())
+	}
+	clients, err := az.NewSubscriptionClients(subscriptionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create azure clients of subscription(%s): %w", subscriptionID, err)
+	}
+
+	cloud := *az.CloudConfig
+	cloud.SubscriptionID = subscriptionID
+	cloud.ResourceGroup = resourceGroup
+	cloud.LoadBalancerResourceGroup = resourceGroup
+	if az.UseExistingLB() {
+		// the existing LoadBalancer is in the cluster virtual network, gateways of the subscription get their own
+		cloud.ExistingLoadBalancerID = ""
+		cloud.LoadBalancerName = ""
+	}
+	sub, err := CreateAzureManager(&cloud, clients.Factory)
+	if err != nil {
+		return nil, err
+	}
+	sub.NatGatewayClient = clients.NatGatewayClient
+	sub.PermissionClient = clients.PermissionClient
+	sub.DryRun = az.DryRun
+	sub.CircuitBreakerThreshold = az.CircuitBreakerThreshold
+	sub.CircuitBreakerCooldown = az.CircuitBreakerCooldown
+	sub.parent = az
+
+	if m.managers == nil {
+		m.managers = make(map[string]*AzureManager)
+	}
+	m.managers[key] = sub
+	return sub, nil
+}
@@ -0,0 +1,145 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package azmanager
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetclient/mock_virtualmachinescalesetclient"
+
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients/natgatewayclient/mocknatgatewayclient"
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients/permissionclient/mockpermissionclient"
+	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
+)
+
+func TestForSubscription(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az, _ := CreateAzureManager(getTestCloudConfig("testLBRG", ""), getMockFactory(ctrl))
+	az.DryRun = true
+	az.CircuitBreakerThreshold = 3
+	az.CircuitBreakerCooldown = time.Minute
+	natGatewayClient := mocknatgatewayclient.NewMockInterface(ctrl)
+	permissionClient := mockpermissionclient.NewMockInterface(ctrl)
+	var builtFor []string
+	az.NewSubscriptionClients = func(subscriptionID string) (*SubscriptionClients, error) {
+		builtFor = append(builtFor, subscriptionID)
+		return &SubscriptionClients{Factory: getMockFactory(ctrl), NatGatewayClient: natGatewayClient, PermissionClient: permissionClient}, nil
+	}
+
+	// the cluster subscription uses the cluster clients
+	for _, subscriptionID := range []string{"", "testSub", "TESTSUB"} {
+		cur, err := az.ForSubscription(subscriptionID, "gatewayRG")
+		assert.Nil(t, err)
+		assert.Same(t, az, cur)
+	}
+	assert.Empty(t, builtFor)
+
+	sub, err := az.ForSubscription("gatewaySub", "gatewayRG")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"gatewaySub"}, builtFor)
+	assert.Equal(t, "gatewaySub", sub.SubscriptionID())
+	assert.Equal(t, "gatewayRG", sub.ResourceGroup)
+	assert.Equal(t, "testSub", az.SubscriptionID())
+	assert.Equal(t, "testRG", az.ResourceGroup)
+	assert.NotSame(t, az.VmssClient, sub.VmssClient)
+	assert.Same(t, natGatewayClient, sub.NatGatewayClient)
+	assert.Same(t, permissionClient, sub.PermissionClient)
+	assert.True(t, sub.DryRun)
+	assert.Equal(t, 3, sub.CircuitBreakerThreshold)
+	assert.Equal(t, time.Minute, sub.CircuitBreakerCooldown)
+
+	// vmss calls go to the gateway subscription clients, defaulting to the gateway resource group
+	mockVMSSClient := sub.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+	mockVMSSClient.EXPECT().Get(gomock.Any(), "gatewayRG", "vmss", gomock.Any()).Return(&compute.VirtualMachineScaleSet{Name: to.Ptr("vmss")}, nil)
+	vmss, err := sub.GetVMSS(context.Background(), "", "vmss")
+	assert.Nil(t, err)
+	assert.Equal(t, "vmss", to.Val(vmss.Name))
+
+	// the gateway LoadBalancer is in the gateway subscription and resource group, in the virtual network of the vmss
+	assert.Equal(t, "/subscriptions/gatewaySub/resourceGroups/gatewayRG/providers/Microsoft.Network/loadBalancers/testLB/backendAddressPools/pool",
+		to.Val(sub.GetLBBackendAddressPoolID("pool")))
+	assert.Equal(t, "/subscriptions/testSub/resourceGroups/testLBRG/providers/Microsoft.Network/loadBalancers/testLB/backendAddressPools/pool",
+		to.Val(az.GetLBBackendAddressPoolID("pool")))
+
+	// clients are built once per subscription and resource group
+	cached, err := az.ForSubscription("GATEWAYSUB", "gatewayrg")
+	assert.Nil(t, err)
+	assert.Same(t, sub, cached)
+	cached, err = sub.ForSubscription("gatewaySub", "gatewayRG")
+	assert.Nil(t, err)
+	assert.Same(t, sub, cached)
+	other, err := az.ForSubscription("otherSub", "gatewayRG")
+	assert.Nil(t, err)
+	assert.Equal(t, "otherSub", other.SubscriptionID())
+	assert.Equal(t, []string{"gatewaySub", "otherSub"}, builtFor)
+}
+
+func TestForSubscriptionDoesNotUseExistingLB(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cloud := getTestCloudConfig("", "")
+	cloud.ExistingLoadBalancerID = "/subscriptions/testSub/resourceGroups/existingRG/providers/Microsoft.Network/loadBalancers/existingLB"
+	az, _ := CreateAzureManager(cloud, getMockFactory(ctrl))
+	az.NewSubscriptionClients = func(subscriptionID string) (*SubscriptionClients, error) {
+		return &SubscriptionClients{Factory: getMockFactory(ctrl)}, nil
+	}
+	sub, err := az.ForSubscription("gatewaySub", "gatewayRG")
+	assert.Nil(t, err)
+	assert.True(t, az.UseExistingLB())
+	assert.False(t, sub.UseExistingLB())
+	assert.Equal(t, "/subscriptions/gatewaySub/resourceGroups/gatewayRG/providers/Microsoft.Network/loadBalancers/kubeegressgateway-ilb/probes/probe",
+		to.Val(sub.GetLBProbeID("probe")))
+}
+
+func TestForSubscriptionErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az, _ := CreateAzureManager(getTestCloudConfig("", ""), getMockFactory(ctrl))
+
+	_, err := az.ForSubscription("gatewaySub", "gatewayRG")
+	assert.EqualError(t, err, "azure clients of subscription(gatewaySub) are not supported, gateways must be in the cluster subscription(testSub)")
+
+	az.NewSubscriptionClients = func(subscriptionID string) (*SubscriptionClients, error) {
+		return nil, fmt.Errorf("failed")
+	}
+	_, err = az.ForSubscription("gatewaySub", "gatewayRG")
+	assert.EqualError(t, err, "failed to create azure clients of subscription(gatewaySub): failed")
+}
+
+func TestForSubscriptionSharesLocks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az, _ := CreateAzureManager(getTestCloudConfig("", ""), getMockFactory(ctrl))
+	az.NewSubscriptionClients = func(subscriptionID string) (*SubscriptionClients, error) {
+		return &SubscriptionClients{Factory: getMockFactory(ctrl)}, nil
+	}
+	sub, err := az.ForSubscription("gatewaySub", "gatewayRG")
+	assert.Nil(t, err)
+
+	// gateway LoadBalancers of the subscriptions are different resources
+	unlockLB := az.LockLB()
+	sub.LockLB()()
+	unlockLB()
+
+	const resourceID = "/subscriptions/gatewaySub/resourceGroups/gatewayRG/providers/Microsoft.Network/natGateways/natgw"
+	unlock := az.LockResource(resourceID)
+	locked := make(chan struct{})
+	go func() {
+		defer sub.LockResource(resourceID)()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("resource locked by both subscriptions at the same time")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	<-locked
+}
@@ -0,0 +1,54 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package azmanager
+
+import (
+	"fmt"
+
+	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+
+	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
+)
+
+// VMSSNotGatewayReadyError is returned when the gateway vmss lacks the network configuration the gateway ipConfigs
+// are added to, so that users know to fix the vmss instead of getting an opaque Azure error
+type VMSSNotGatewayReadyError struct {
+	VMSSName string
+	// what is missing
+	Missing string
+}
+
+func (e *VMSSNotGatewayReadyError) Error() string {
+	return fmt.Sprintf("vmss(%s) is not ready for egress gateway: %s, the vmss needs a primary network interface "+
+		"with a primary ip configuration in a subnet", e.VMSSName, e.Missing)
+}
+
+// CheckVMSSGatewayReady returns a VMSSNotGatewayReadyError if the vmss network profile has no primary network
+// interface, or the primary network interface has no primary ipConfig in a subnet
+func CheckVMSSGatewayReady(vmss *compute.VirtualMachineScaleSet) error {
+	notReady := func(missing string) error {
+		return &VMSSNotGatewayReadyError{VMSSName: to.Val(vmss.Name), Missing: missing}
+	}
+	if vmss.Properties == nil || vmss.Properties.VirtualMachineProfile == nil ||
+		vmss.Properties.VirtualMachineProfile.NetworkProfile == nil {
+		return notReady("network profile not found")
+	}
+	var primaryNic *compute.VirtualMachineScaleSetNetworkConfiguration
+	for _, nic := range vmss.Properties.VirtualMachineProfile.NetworkProfile.NetworkInterfaceConfigurations {
+		if nic.Properties != nil && to.Val(nic.Properties.Primary) {
+			primaryNic = nic
+		}
+	}
+	if primaryNic == nil {
+		return notReady("primary network interface not found")
+	}
+	for _, ipConfig := range primaryNic.Properties.IPConfigurations {
+		if ipConfig.Properties != nil && to.Val(ipConfig.Properties.Primary) {
+			if ipConfig.Properties.Subnet == nil || to.Val(ipConfig.Properties.Subnet.ID) == "" {
+				return notReady(fmt.Sprintf("primary ip configuration of network interface %s has no subnet", to.Val(primaryNic.Name)))
+			}
+			return nil
+		}
+	}
+	return notReady(fmt.Sprintf("network interface %s has no primary ip configuration", to.Val(primaryNic.Name)))
+}
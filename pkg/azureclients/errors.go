@@ -0,0 +1,125 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package azureclients
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+// ErrNotFound is returned when the requested Azure resource, or its resource group, does not exist
+type ErrNotFound struct {
+	azureError
+}
+
+// ErrThrottled is returned when Azure resource manager throttles the request
+type ErrThrottled struct {
+	azureError
+}
+
+// ErrQuotaExceeded is returned when the subscription has no quota left or the region has no capacity for the
+// resource, retrying does not help until quota or capacity is freed
+type ErrQuotaExceeded struct {
+	azureError
+}
+
+// ErrForbidden is returned when the credential is not authenticated or not authorized to call the operation
+type ErrForbidden struct {
+	azureError
+}
+
+// ErrConflict is returned when the request conflicts with the current state of the resource, e.g. another operation
+// is in progress or the etag does not match
+type ErrConflict struct {
+	azureError
+}
+
+// ErrServerError is returned when Azure fails to serve the request with a server error
+type ErrServerError struct {
+	azureError
+}
+
+// azureError wraps the error returned by Azure with its error code and message
+type azureError struct {
+	// Code is the error code returned by Azure, e.g. PublicIPCountLimitReached
+	Code string
+	// Message is the error message returned by Azure, empty if the response has none
+	Message string
+	err     error
+}
+
+func (e *azureError) Error() string {
+	return e.err.Error()
+}
+
+func (e *azureError) Unwrap() error {
+	return e.err
+}
+
+// Detail returns the Azure error code and message in short, e.g. "Code: message", for events and conditions
+func (e *azureError) Detail() string {
+	if e.Message == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Message
+}
+
+// ConvertError wraps err in ErrNotFound, ErrThrottled, ErrQuotaExceeded, ErrForbidden, ErrConflict or
+// ErrServerError according to the Azure response, so that callers can tell them apart with errors.As. Other errors
+// are returned as is.
+func ConvertError(err error) error {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return err
+	}
+	var converted interface{ Detail() string }
+	if errors.As(err, &converted) {
+		return err
+	}
+	azErr := azureError{Code: respErr.ErrorCode, Message: responseErrorMessage(respErr), err: err}
+	code := strings.ToLower(respErr.ErrorCode)
+	switch {
+	case respErr.StatusCode == http.StatusTooManyRequests || strings.Contains(code, "throttl") || code == "toomanyrequests":
+		return &ErrThrottled{azErr}
+	case strings.Contains(code, "quota") || strings.Contains(code, "capacity") ||
+		strings.HasSuffix(code, "limitreached") || strings.HasSuffix(code, "allocationfailed"):
+		return &ErrQuotaExceeded{azErr}
+	case respErr.StatusCode == http.StatusNotFound || strings.HasSuffix(code, "notfound"):
+		return &ErrNotFound{azErr}
+	case respErr.StatusCode == http.StatusForbidden || respErr.StatusCode == http.StatusUnauthorized ||
+		strings.Contains(code, "authorizationfailed"):
+		return &ErrForbidden{azErr}
+	case respErr.StatusCode == http.StatusConflict || respErr.StatusCode == http.StatusPreconditionFailed:
+		return &ErrConflict{azErr}
+	case respErr.StatusCode >= http.StatusInternalServerError:
+		return &ErrServerError{azErr}
+	}
+	return err
+}
+
+// responseErrorMessage returns the message in the body of the Azure error response, e.g.
+// {"error":{"code":"PublicIPCountLimitReached","message":"Cannot create more than 10 public IP addresses"}}
+func responseErrorMessage(respErr *azcore.ResponseError) string {
+	if respErr.RawResponse == nil {
+		return ""
+	}
+	body, err := runtime.Payload(respErr.RawResponse)
+	if err != nil {
+		return ""
+	}
+	azureErr := struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}{}
+	if json.Unmarshal(body, &azureErr) != nil {
+		return ""
+	}
+	return azureErr.Error.Message
+}
@@ -0,0 +1,170 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package azureclients
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/stretchr/testify/assert"
+)
+
+func newResponseError(statusCode int, code, body string) *azcore.ResponseError {
+	respErr := &azcore.ResponseError{StatusCode: statusCode, ErrorCode: code}
+	if body != "" {
+		respErr.RawResponse = &http.Response{StatusCode: statusCode, Body: io.NopCloser(strings.NewReader(body))}
+	}
+	return respErr
+}
+
+func TestConvertError(t *testing.T) {
+	tests := []struct {
+		desc            string
+		err             error
+		notFound        bool
+		throttled       bool
+		quotaExceeded   bool
+		forbidden       bool
+		conflict        bool
+		serverError     bool
+		expectedDetail  string
+		expectUnchanged bool
+	}{
+		{
+			desc:            "nil error",
+			err:             nil,
+			expectUnchanged: true,
+		},
+		{
+			desc:            "non Azure error",
+			err:             fmt.Errorf("failed"),
+			expectUnchanged: true,
+		},
+		{
+			desc:           "404 status code",
+			err:            newResponseError(http.StatusNotFound, "", ""),
+			notFound:       true,
+			expectedDetail: "",
+		},
+		{
+			desc:           "resource group not found",
+			err:            newResponseError(http.StatusNotFound, "ResourceGroupNotFound", `{"error":{"code":"ResourceGroupNotFound","message":"Resource group 'rg' could not be found."}}`),
+			notFound:       true,
+			expectedDetail: "ResourceGroupNotFound: Resource group 'rg' could not be found.",
+		},
+		{
+			desc:           "not found error code",
+			err:            newResponseError(http.StatusBadRequest, "NotFound", ""),
+			notFound:       true,
+			expectedDetail: "NotFound",
+		},
+		{
+			desc:           "429 status code",
+			err:            newResponseError(http.StatusTooManyRequests, "", ""),
+			throttled:      true,
+			expectedDetail: "",
+		},
+		{
+			desc:           "throttled error code",
+			err:            newResponseError(http.StatusConflict, "SubscriptionRequestsThrottled", ""),
+			throttled:      true,
+			expectedDetail: "SubscriptionRequestsThrottled",
+		},
+		{
+			desc:           "public ip count limit reached",
+			err:            newResponseError(http.StatusBadRequest, "PublicIPCountLimitReached", `{"error":{"code":"PublicIPCountLimitReached","message":"Cannot create more than 10 public IP addresses."}}`),
+			quotaExceeded:  true,
+			expectedDetail: "PublicIPCountLimitReached: Cannot create more than 10 public IP addresses.",
+		},
+		{
+			desc:           "quota exceeded",
+			err:            newResponseError(http.StatusConflict, "QuotaExceeded", ""),
+			quotaExceeded:  true,
+			expectedDetail: "QuotaExceeded",
+		},
+		{
+			desc:           "allocation failed",
+			err:            newResponseError(http.StatusConflict, "AllocationFailed", `{"error":{}}`),
+			quotaExceeded:  true,
+			expectedDetail: "AllocationFailed",
+		},
+		{
+			desc:           "insufficient capacity",
+			err:            newResponseError(http.StatusConflict, "InsufficientCapacity", "not json"),
+			quotaExceeded:  true,
+			expectedDetail: "InsufficientCapacity",
+		},
+		{
+			desc:           "wrapped Azure error",
+			err:            fmt.Errorf("failed to get lb: %w", newResponseError(http.StatusNotFound, "ResourceNotFound", "")),
+			notFound:       true,
+			expectedDetail: "ResourceNotFound",
+		},
+		{
+			desc:           "authorization failed",
+			err:            newResponseError(http.StatusForbidden, "AuthorizationFailed", ""),
+			forbidden:      true,
+			expectedDetail: "AuthorizationFailed",
+		},
+		{
+			desc:           "401 status code",
+			err:            newResponseError(http.StatusUnauthorized, "InvalidAuthenticationToken", ""),
+			forbidden:      true,
+			expectedDetail: "InvalidAuthenticationToken",
+		},
+		{
+			desc:           "another operation in progress",
+			err:            newResponseError(http.StatusConflict, "AnotherOperationInProgress", ""),
+			conflict:       true,
+			expectedDetail: "AnotherOperationInProgress",
+		},
+		{
+			desc:           "etag mismatch",
+			err:            newResponseError(http.StatusPreconditionFailed, "PreconditionFailed", ""),
+			conflict:       true,
+			expectedDetail: "PreconditionFailed",
+		},
+		{
+			desc:           "server error",
+			err:            newResponseError(http.StatusServiceUnavailable, "ServiceUnavailable", ""),
+			serverError:    true,
+			expectedDetail: "ServiceUnavailable",
+		},
+		{
+			desc:            "other Azure error",
+			err:             newResponseError(http.StatusBadRequest, "InvalidParameter", ""),
+			expectUnchanged: true,
+		},
+	}
+	for i, test := range tests {
+		err := ConvertError(test.err)
+		if test.expectUnchanged {
+			assert.Equal(t, test.err, err, "TestCase[%d]: %s", i, test.desc)
+			continue
+		}
+		var notFoundErr *ErrNotFound
+		var throttledErr *ErrThrottled
+		var quotaErr *ErrQuotaExceeded
+		assert.Equal(t, test.notFound, errors.As(err, &notFoundErr), "TestCase[%d]: %s", i, test.desc)
+		assert.Equal(t, test.throttled, errors.As(err, &throttledErr), "TestCase[%d]: %s", i, test.desc)
+		assert.Equal(t, test.quotaExceeded, errors.As(err, &quotaErr), "TestCase[%d]: %s", i, test.desc)
+		assert.Equal(t, test.forbidden, errors.As(err, new(*ErrForbidden)), "TestCase[%d]: %s", i, test.desc)
+		assert.Equal(t, test.conflict, errors.As(err, new(*ErrConflict)), "TestCase[%d]: %s", i, test.desc)
+		assert.Equal(t, test.serverError, errors.As(err, new(*ErrServerError)), "TestCase[%d]: %s", i, test.desc)
+		var azErr interface{ Detail() string }
+		if assert.True(t, errors.As(err, &azErr), "TestCase[%d]: %s", i, test.desc) {
+			assert.Equal(t, test.expectedDetail, azErr.Detail(), "TestCase[%d]: %s", i, test.desc)
+		}
+		// the original error is kept in the chain
+		assert.ErrorIs(t, err, test.err, "TestCase[%d]: %s", i, test.desc)
+		assert.Equal(t, test.err.Error(), err.Error(), "TestCase[%d]: %s", i, test.desc)
+		// converting again does not wrap twice
+		assert.Equal(t, err, ConvertError(err), "TestCase[%d]: %s", i, test.desc)
+	}
+}
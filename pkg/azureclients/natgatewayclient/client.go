@@ -0,0 +1,83 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package natgatewayclient
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/tracing"
+	network "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/utils"
+)
+
+const (
+	clientName                  = "NatGatewaysClient"
+	GetOperationName            = "NatGatewaysClient.Get"
+	CreateOrUpdateOperationName = "NatGatewaysClient.Create"
+)
+
+type Client struct {
+	*network.NatGatewaysClient
+	subscriptionID string
+	tracer         tracing.Tracer
+}
+
+func New(subscriptionID string, credential azcore.TokenCredential, options *arm.ClientOptions) (Interface, error) {
+	if options == nil {
+		options = utils.GetDefaultOption()
+	}
+	tr := options.TracingProvider.NewTracer(utils.ModuleName, utils.ModuleVersion)
+
+	client, err := network.NewNatGatewaysClient(subscriptionID, credential, options)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		NatGatewaysClient: client,
+		subscriptionID:    subscriptionID,
+		tracer:            tr,
+	}, nil
+}
+
+// Get gets the NatGateway
+func (client *Client) Get(ctx context.Context, resourceGroupName string, resourceName string, expand *string) (result *network.NatGateway, rerr error) {
+	var ops *network.NatGatewaysClientGetOptions
+	if expand != nil {
+		ops = &network.NatGatewaysClientGetOptions{Expand: expand}
+	}
+	ctx = client.withRequestContext(ctx, "Get", resourceGroupName)
+	ctx, endSpan := runtime.StartSpan(ctx, GetOperationName, client.tracer, nil)
+	defer endSpan(rerr)
+	resp, err := client.NatGatewaysClient.Get(ctx, resourceGroupName, resourceName, ops)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.NatGateway, nil
+}
+
+// CreateOrUpdate creates or updates a NatGateway.
+func (client *Client) CreateOrUpdate(ctx context.Context, resourceGroupName string, resourceName string, resource network.NatGateway) (result *network.NatGateway, err error) {
+	ctx = client.withRequestContext(ctx, "CreateOrUpdate", resourceGroupName)
+	ctx, endSpan := runtime.StartSpan(ctx, CreateOrUpdateOperationName, client.tracer, nil)
+	defer endSpan(err)
+	resp, err := utils.NewPollerWrapper(client.NatGatewaysClient.BeginCreateOrUpdate(ctx, resourceGroupName, resourceName, resource, nil)).WaitforPollerResp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if resp != nil {
+		return &resp.NatGateway, nil
+	}
+	return nil, nil
+}
+
+// withRequestContext attaches the request metadata consumed by azclient metrics and tracing policies
+func (client *Client) withRequestContext(ctx context.Context, method, resourceGroupName string) context.Context {
+	ctx = utils.ContextWithClientName(ctx, clientName)
+	ctx = utils.ContextWithRequestMethod(ctx, method)
+	ctx = utils.ContextWithResourceGroupName(ctx, resourceGroupName)
+	return utils.ContextWithSubscriptionID(ctx, client.subscriptionID)
+}
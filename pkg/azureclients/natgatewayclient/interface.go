@@ -0,0 +1,17 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+// Package natgatewayclient provides a NAT gateway client in the same shape as the
+// clients generated by sigs.k8s.io/cloud-provider-azure/pkg/azclient, which does
+// not ship one yet.
+package natgatewayclient
+
+import (
+	network "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/utils"
+)
+
+type Interface interface {
+	utils.GetWithExpandFunc[network.NatGateway]
+	utils.CreateOrUpdateFunc[network.NatGateway]
+}
@@ -0,0 +1,112 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package permissionclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/tracing"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/utils"
+)
+
+const (
+	clientName                        = "PermissionsClient"
+	ListForResourceGroupOperationName = "PermissionsClient.ListForResourceGroup"
+	ListForResourceOperationName      = "PermissionsClient.ListForResource"
+
+	apiVersion = "2022-04-01"
+)
+
+type Client struct {
+	*arm.Client
+	subscriptionID string
+	tracer         tracing.Tracer
+}
+
+type permissionListResult struct {
+	Value    []Permission `json:"value,omitempty"`
+	NextLink *string      `json:"nextLink,omitempty"`
+}
+
+func New(subscriptionID string, credential azcore.TokenCredential, options *arm.ClientOptions) (Interface, error) {
+	if options == nil {
+		options = utils.GetDefaultOption()
+	}
+	tr := options.TracingProvider.NewTracer(utils.ModuleName, utils.ModuleVersion)
+
+	client, err := arm.NewClient(utils.ModuleName, utils.ModuleVersion, credential, options)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		Client:         client,
+		subscriptionID: subscriptionID,
+		tracer:         tr,
+	}, nil
+}
+
+// ListForResourceGroup lists the permissions the caller has on the resource group
+func (client *Client) ListForResourceGroup(ctx context.Context, resourceGroupName string) (result []Permission, rerr error) {
+	ctx = client.withRequestContext(ctx, "ListForResourceGroup", resourceGroupName)
+	ctx, endSpan := runtime.StartSpan(ctx, ListForResourceGroupOperationName, client.tracer, nil)
+	defer endSpan(rerr)
+	scope := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s", url.PathEscape(client.subscriptionID), url.PathEscape(resourceGroupName))
+	return client.list(ctx, scope)
+}
+
+// ListForResource lists the permissions the caller has on the resource
+func (client *Client) ListForResource(ctx context.Context, resourceID string) (result []Permission, rerr error) {
+	id, err := arm.ParseResourceID(resourceID)
+	if err != nil {
+		return nil, err
+	}
+	ctx = client.withRequestContext(ctx, "ListForResource", id.ResourceGroupName)
+	ctx, endSpan := runtime.StartSpan(ctx, ListForResourceOperationName, client.tracer, nil)
+	defer endSpan(rerr)
+	return client.list(ctx, strings.TrimSuffix(resourceID, "/"))
+}
+
+// list lists the permissions on the scope following nextLink of each page
+func (client *Client) list(ctx context.Context, scope string) (result []Permission, err error) {
+	nextLink := fmt.Sprintf("%s%s/providers/Microsoft.Authorization/permissions?api-version=%s", client.Endpoint(), scope, apiVersion)
+	for nextLink != "" {
+		req, err := runtime.NewRequest(ctx, http.MethodGet, nextLink)
+		if err != nil {
+			return nil, err
+		}
+		req.Raw().Header["Accept"] = []string{"application/json"}
+		resp, err := client.Pipeline().Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if !runtime.HasStatusCode(resp, http.StatusOK) {
+			return nil, runtime.NewResponseError(resp)
+		}
+		var page permissionListResult
+		if err := runtime.UnmarshalAsJSON(resp, &page); err != nil {
+			return nil, err
+		}
+		result = append(result, page.Value...)
+		nextLink = ""
+		if page.NextLink != nil {
+			nextLink = *page.NextLink
+		}
+	}
+	return result, nil
+}
+
+// withRequestContext attaches the request metadata consumed by azclient metrics and tracing policies
+func (client *Client) withRequestContext(ctx context.Context, method, resourceGroupName string) context.Context {
+	ctx = utils.ContextWithClientName(ctx, clientName)
+	ctx = utils.ContextWithRequestMethod(ctx, method)
+	ctx = utils.ContextWithResourceGroupName(ctx, resourceGroupName)
+	return utils.ContextWithSubscriptionID(ctx, client.subscriptionID)
+}
@@ -0,0 +1,19 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+// Package permissionclient provides a client listing the Azure RBAC permissions the caller has on
+// a resource group. The authorization SDK is not a dependency of this repo, so the client calls the
+// ARM API directly with an azcore pipeline.
+package permissionclient
+
+import (
+	"context"
+)
+
+type Interface interface {
+	// ListForResourceGroup lists the permissions the caller has on the resource group
+	ListForResourceGroup(ctx context.Context, resourceGroupName string) ([]Permission, error)
+	// ListForResource lists the permissions the caller has on the resource, including the ones assigned
+	// on the resource itself
+	ListForResource(ctx context.Context, resourceID string) ([]Permission, error)
+}
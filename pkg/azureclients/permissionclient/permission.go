@@ -0,0 +1,56 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package permissionclient
+
+import (
+	"strings"
+)
+
+// Permission is a set of allowed and denied management plane actions from one role assignment
+type Permission struct {
+	Actions    []string `json:"actions,omitempty"`
+	NotActions []string `json:"notActions,omitempty"`
+}
+
+// IsAllowed returns true if any of the permissions allows action. An action is allowed by a
+// permission when it matches one of its actions and none of its notActions.
+func IsAllowed(permissions []Permission, action string) bool {
+	for _, permission := range permissions {
+		if matchesAny(permission.Actions, action) && !matchesAny(permission.NotActions, action) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(patterns []string, action string) bool {
+	for _, pattern := range patterns {
+		if matches(pattern, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether action matches pattern, actions are case insensitive and '*' in pattern
+// matches any sequence of characters, e.g. "Microsoft.Network/*/write"
+func matches(pattern, action string) bool {
+	pattern, action = strings.ToLower(pattern), strings.ToLower(action)
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == action
+	}
+	if !strings.HasPrefix(action, parts[0]) {
+		return false
+	}
+	action = action[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(action, part)
+		if i < 0 {
+			return false
+		}
+		action = action[i+len(part):]
+	}
+	return strings.HasSuffix(action, parts[len(parts)-1])
+}
@@ -0,0 +1,70 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package permissionclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsAllowed(t *testing.T) {
+	tests := []struct {
+		desc        string
+		permissions []Permission
+		action      string
+		expected    bool
+	}{
+		{
+			desc:        "exact action is allowed",
+			permissions: []Permission{{Actions: []string{"Microsoft.Network/publicIPPrefixes/write"}}},
+			action:      "Microsoft.Network/publicIPPrefixes/write",
+			expected:    true,
+		},
+		{
+			desc:        "actions are case insensitive",
+			permissions: []Permission{{Actions: []string{"microsoft.network/publicipprefixes/write"}}},
+			action:      "Microsoft.Network/publicIPPrefixes/write",
+			expected:    true,
+		},
+		{
+			desc:        "owner wildcard allows any action",
+			permissions: []Permission{{Actions: []string{"*"}}},
+			action:      "Microsoft.Network/loadBalancers/write",
+			expected:    true,
+		},
+		{
+			desc:        "wildcard in the middle",
+			permissions: []Permission{{Actions: []string{"Microsoft.Network/*/write"}}},
+			action:      "Microsoft.Network/loadBalancers/write",
+			expected:    true,
+		},
+		{
+			desc:        "wildcard does not match other actions",
+			permissions: []Permission{{Actions: []string{"Microsoft.Network/*/read"}}},
+			action:      "Microsoft.Network/loadBalancers/write",
+		},
+		{
+			desc:        "notActions exclude matched actions",
+			permissions: []Permission{{Actions: []string{"*"}, NotActions: []string{"Microsoft.Network/*"}}},
+			action:      "Microsoft.Network/loadBalancers/write",
+		},
+		{
+			desc: "notActions of one permission does not exclude another",
+			permissions: []Permission{
+				{Actions: []string{"*"}, NotActions: []string{"Microsoft.Network/*"}},
+				{Actions: []string{"Microsoft.Network/loadBalancers/*"}},
+			},
+			action:   "Microsoft.Network/loadBalancers/write",
+			expected: true,
+		},
+		{
+			desc:   "no permission",
+			action: "Microsoft.Network/loadBalancers/write",
+		},
+	}
+	for i, test := range tests {
+		assert.Equal(t, test.expected, IsAllowed(test.permissions, test.action), "TestCase[%d]: %s", i, test.desc)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/Azure/kube-egress-gateway/pkg/consts"
 	"github.com/Azure/kube-egress-gateway/pkg/iptableswrapper"
 	"github.com/Azure/kube-egress-gateway/pkg/netlinkwrapper"
+	"github.com/Azure/kube-egress-gateway/pkg/tunnel"
 )
 
 type runner struct {
@@ -35,7 +36,30 @@ func init() {
 	}
 }
 
-func SetPodRoutes(ifName string, exceptionCidrs []string, defaultToGateway bool, sysctlDir string, result *current.Result) error {
+// ParseGatewayIP returns the next hop of pod routes, the address of the gateway wireguard interface, which is the
+// first address of the default tunnel cidr when gatewayIP is empty. It fails when an address of the pod in result is
+// the gateway IP, as pod traffic routed to it would not leave the pod.
+func ParseGatewayIP(gatewayIP string, result *current.Result) (net.IP, error) {
+	var ip net.IP
+	if gatewayIP == "" {
+		tunnelCidr, _ := tunnel.ParseCIDR(consts.DefaultTunnelCidr)
+		ip = tunnel.GatewayIP(tunnelCidr).IP
+	} else if ip = net.ParseIP(gatewayIP); ip == nil || ip.To4() != nil {
+		return nil, fmt.Errorf("gateway ip %s should be an IPv6 address", gatewayIP)
+	}
+	for _, ipConfig := range result.IPs {
+		if ipConfig.Address.IP.Equal(ip) {
+			return nil, fmt.Errorf("pod address %s conflicts with the gateway tunnel address, move the tunnel cidr of gateway daemons and cni managers out of the way", ipConfig.Address.String())
+		}
+	}
+	return ip, nil
+}
+
+// SetPodRoutes routes pod traffic to the wireguard interface, with gatewayIP as next hop. When defaultToGateway is true, all traffic except
+// exceptionCidrs goes to the gateway, otherwise only includeCidrs go to the gateway and all other traffic,
+// including exceptionCidrs within includeCidrs, stays on eth0. Routes of IP versions kept on the node path by
+// ipv4ViaNode and ipv6ViaNode are left untouched.
+func SetPodRoutes(ifName string, gatewayIP net.IP, exceptionCidrs, includeCidrs []string, defaultToGateway, enableIPv6, ipv4ViaNode, ipv6ViaNode bool, sysctlDir string, result *current.Result) error {
 	eth0Link, err := routesRunner.netlink.LinkByName("eth0")
 	if err != nil {
 		return fmt.Errorf("failed to retrieve eth0 interface: %w", err)
@@ -51,12 +75,15 @@ func SetPodRoutes(ifName string, exceptionCidrs []string, defaultToGateway bool,
 		return fmt.Errorf("failed to list all routes on eth0: %w", err)
 	}
 
-	var defaultRoute *netlink.Route
+	var defaultRoute, defaultIPv6Route *netlink.Route
 	for _, route := range routes {
 		route := route
 		if route.Dst == nil && route.Family == nl.FAMILY_V4 {
 			defaultRoute = &route
 		}
+		if route.Dst == nil && route.Family == nl.FAMILY_V6 {
+			defaultIPv6Route = &route
+		}
 	}
 	if defaultRoute == nil {
 		return errors.New("failed to find default route")
@@ -71,7 +98,7 @@ func SetPodRoutes(ifName string, exceptionCidrs []string, defaultToGateway bool,
 	wgRouteTmpl := netlink.Route{
 		Gw: nil,
 		Via: &netlink.Via{
-			Addr:       net.ParseIP("fe80::1"),
+			Addr:       gatewayIP,
 			AddrFamily: nl.FAMILY_V6,
 		},
 		LinkIndex: wgLink.Attrs().Index,
@@ -80,59 +107,126 @@ func SetPodRoutes(ifName string, exceptionCidrs []string, defaultToGateway bool,
 	}
 
 	if defaultToGateway {
-		// 1. removes existing routes
+		// 1. removes existing routes, except those of IP versions kept on the node path
 		// 2. add original default route gateway to eth0
 		// 3. routes exceptional cidrs (traffic avoiding gateway) to base interface (eth0)
 		// 4. add default route to wireguard interface
+		viaNode := func(isIPv4 bool) bool {
+			return (isIPv4 && ipv4ViaNode) || (!isIPv4 && ipv6ViaNode)
+		}
 		for _, route := range routes {
+			if viaNode(route.Family == nl.FAMILY_V4) {
+				continue
+			}
 			if err := routesRunner.netlink.RouteDel(&route); err != nil {
 				return fmt.Errorf("failed to delete route (%s): %w", route, err)
 			}
 		}
-		result.Routes = nil
-
-		gatewayDestination := net.IPNet{IP: defaultRoute.Gw, Mask: net.CIDRMask(32, 32)}
-		err = routesRunner.netlink.RouteReplace(&netlink.Route{
-			Dst:       &gatewayDestination,
-			LinkIndex: eth0Link.Attrs().Index,
-			Scope:     netlink.SCOPE_LINK,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to add original gateway route: %w", err)
+		var keptRoutes []*types.Route
+		for _, route := range result.Routes {
+			if viaNode(route.Dst.IP.To4() != nil) {
+				keptRoutes = append(keptRoutes, route)
+			}
+		}
+		result.Routes = keptRoutes
+
+		if !ipv4ViaNode {
+			gatewayDestination := net.IPNet{IP: defaultRoute.Gw, Mask: net.CIDRMask(32, 32)}
+			err = routesRunner.netlink.RouteReplace(&netlink.Route{
+				Dst:       &gatewayDestination,
+				LinkIndex: eth0Link.Attrs().Index,
+				Scope:     netlink.SCOPE_LINK,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to add original gateway route: %w", err)
+			}
+			result.Routes = append(result.Routes, &types.Route{Dst: gatewayDestination})
+
+			_, defaultRouteCidr, _ := net.ParseCIDR("0.0.0.0/0")
+			wgDefaultRoute := wgRouteTmpl
+			wgDefaultRoute.Dst = defaultRouteCidr
+			result.Routes = append(result.Routes, &types.Route{Dst: *defaultRouteCidr, GW: gatewayIP})
+
+			err = routesRunner.netlink.RouteReplace(&wgDefaultRoute)
+			if err != nil {
+				return fmt.Errorf("failed to add default wireguard route (%s): %w", wgDefaultRoute, err)
+			}
 		}
-		result.Routes = append(result.Routes, &types.Route{Dst: gatewayDestination})
 
-		_, defaultRouteCidr, _ := net.ParseCIDR("0.0.0.0/0")
-		wgDefaultRoute := wgRouteTmpl
-		wgDefaultRoute.Dst = defaultRouteCidr
-		result.Routes = append(result.Routes, &types.Route{Dst: *defaultRouteCidr, GW: net.ParseIP("fe80::1")})
+		// 5. add ipv6 default route to wireguard interface if gateway supports ipv6 egress
+		if enableIPv6 {
+			_, defaultIPv6RouteCidr, _ := net.ParseCIDR("::/0")
+			wgDefaultIPv6Route := netlink.Route{
+				Dst:       defaultIPv6RouteCidr,
+				Gw:        gatewayIP,
+				LinkIndex: wgLink.Attrs().Index,
+				Scope:     netlink.SCOPE_UNIVERSE,
+				Family:    nl.FAMILY_V6,
+			}
+			result.Routes = append(result.Routes, &types.Route{Dst: *defaultIPv6RouteCidr, GW: gatewayIP})
 
-		err = routesRunner.netlink.RouteReplace(&wgDefaultRoute)
-		if err != nil {
-			return fmt.Errorf("failed to add default wireguard route (%s): %w", wgDefaultRoute, err)
+			err = routesRunner.netlink.RouteReplace(&wgDefaultIPv6Route)
+			if err != nil {
+				return fmt.Errorf("failed to add default ipv6 wireguard route (%s): %w", wgDefaultIPv6Route, err)
+			}
+		}
+	}
+
+	if !defaultToGateway {
+		// routes included cidrs (traffic using gateway) to wireguard interface
+		for _, include := range includeCidrs {
+			_, cidr, err := net.ParseCIDR(include)
+			if err != nil {
+				return fmt.Errorf("failed to parse cidr (%s): %w", include, err)
+			}
+			if cidr.IP.To4() != nil && ipv4ViaNode {
+				// ipv4 traffic is not tunneled to gateway
+				continue
+			}
+			gatewayRoute := wgRouteTmpl
+			if cidr.IP.To4() == nil {
+				if !enableIPv6 {
+					// gateway does not provide ipv6 egress
+					continue
+				}
+				gatewayRoute = netlink.Route{
+					Gw:        gatewayIP,
+					LinkIndex: wgLink.Attrs().Index,
+					Scope:     netlink.SCOPE_UNIVERSE,
+					Family:    nl.FAMILY_V6,
+				}
+			}
+			gatewayRoute.Dst = cidr
+			err = routesRunner.netlink.RouteReplace(&gatewayRoute)
+			if err != nil {
+				return fmt.Errorf("failed to add route (%s): %w", gatewayRoute, err)
+			}
+			result.Routes = append(result.Routes, &types.Route{Dst: *cidr, GW: gatewayIP})
 		}
 	}
 
+	// routes exceptional cidrs (traffic avoiding gateway) to base interface (eth0), which takes precedence
+	// over routes to wireguard interface as long as they are more specific
 	for _, exception := range exceptionCidrs {
 		_, cidr, err := net.ParseCIDR(exception)
 		if err != nil {
 			return fmt.Errorf("failed to parse cidr (%s): %w", exception, err)
 		}
-		var gatewayRoute netlink.Route
-		var gwIP net.IP
-		if defaultToGateway {
-			gatewayRoute = eth0RouteTmpl
-			gwIP = defaultRoute.Gw
-		} else {
-			gatewayRoute = wgRouteTmpl
-			gwIP = net.ParseIP("fe80::1")
+		eth0Route := eth0RouteTmpl
+		if cidr.IP.To4() == nil {
+			if defaultIPv6Route == nil {
+				// pod has no ipv6 connectivity on eth0 to exclude the cidr to
+				continue
+			}
+			eth0Route.Gw = defaultIPv6Route.Gw
+			eth0Route.Family = nl.FAMILY_V6
 		}
-		gatewayRoute.Dst = cidr
-		err = routesRunner.netlink.RouteReplace(&gatewayRoute)
+		eth0Route.Dst = cidr
+		err = routesRunner.netlink.RouteReplace(&eth0Route)
 		if err != nil {
-			return fmt.Errorf("failed to add route (%s): %w", gatewayRoute, err)
+			return fmt.Errorf("failed to add route (%s): %w", eth0Route, err)
 		}
-		result.Routes = append(result.Routes, &types.Route{Dst: *cidr, GW: gwIP})
+		result.Routes = append(result.Routes, &types.Route{Dst: *cidr, GW: eth0Route.Gw})
 	}
 
 	err = addRoutingForIngress(eth0Link, *defaultRoute, sysctlDir)
@@ -142,6 +236,37 @@ func SetPodRoutes(ifName string, exceptionCidrs []string, defaultToGateway bool,
 	return nil
 }
 
+// SetPodDNSRoute routes dnsServer through the wireguard interface, even when it falls into excluded cidrs of the
+// gateway or the node, as it is only reachable through the gateway. Other DNS traffic is left untouched, pods send
+// queries to dnsServer by listing it in their dnsConfig, as kubelet writes the pod resolv.conf from the pod spec.
+func SetPodDNSRoute(ifName string, gatewayIP net.IP, dnsServer string, result *current.Result) error {
+	dnsIP := net.ParseIP(dnsServer)
+	if dnsIP == nil || dnsIP.To4() == nil {
+		return fmt.Errorf("invalid gateway dns server %q", dnsServer)
+	}
+	wgLink, err := routesRunner.netlink.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve wireguard interface: %w", err)
+	}
+
+	dnsDestination := net.IPNet{IP: dnsIP.To4(), Mask: net.CIDRMask(32, 32)}
+	dnsRoute := netlink.Route{
+		Dst: &dnsDestination,
+		Via: &netlink.Via{
+			Addr:       gatewayIP,
+			AddrFamily: nl.FAMILY_V6,
+		},
+		LinkIndex: wgLink.Attrs().Index,
+		Scope:     netlink.SCOPE_UNIVERSE,
+		Family:    nl.FAMILY_V4,
+	}
+	if err := routesRunner.netlink.RouteReplace(&dnsRoute); err != nil {
+		return fmt.Errorf("failed to add dns server route (%s): %w", dnsRoute, err)
+	}
+	result.Routes = append(result.Routes, &types.Route{Dst: dnsDestination, GW: gatewayIP})
+	return nil
+}
+
 func addRoutingForIngress(eth0Link netlink.Link, defaultRoute netlink.Route, sysctlDir string) error {
 	// add iptables rule to mark traffic from eth0
 	ipt, err := routesRunner.iptables.New()
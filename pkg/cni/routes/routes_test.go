@@ -27,6 +27,9 @@ const (
 	eth0File = eth0Dir + "/rp_filter"
 )
 
+// gateway wireguard interface address in a tunnel cidr moved away from the default one
+var testGatewayIP = net.ParseIP("fe80:0:0:ffff::1")
+
 func TestSetPodRoutes(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -55,7 +58,10 @@ func TestSetPodRoutes(t *testing.T) {
 	}
 	_, net1, _ := net.ParseCIDR("1.2.3.4/32")
 	_, net2, _ := net.ParseCIDR("172.17.0.4/16")
+	_, includeNet, _ := net.ParseCIDR("172.16.0.0/12")
+	_, includeNet6, _ := net.ParseCIDR("fd00::/64")
 	_, dnet, _ := net.ParseCIDR("0.0.0.0/0")
+	_, dnet6, _ := net.ParseCIDR("::/0")
 	rule := netlink.NewRule()
 	rule.Mark = 8738
 	rule.Table = 8738
@@ -66,87 +72,119 @@ func TestSetPodRoutes(t *testing.T) {
 		Table:     8738,
 	}
 
-	defaultGatewayRouteSetupProcess := func() {
-		gomock.InOrder(
-			// retrieve eth0 link
-			mnl.EXPECT().LinkByName("eth0").Return(eth0, nil),
-			// retrieve wg0 link
-			mnl.EXPECT().LinkByName("wg0").Return(wg0, nil),
-			// get existing routes
-			mnl.EXPECT().RouteList(eth0, netlink.FAMILY_ALL).Return(existingRoutes, nil),
-			// delete existing routes
-			mnl.EXPECT().RouteDel(&existingRoutes[0]).Return(nil),
-			mnl.EXPECT().RouteDel(&existingRoutes[1]).Return(nil),
-			// add route to default gateway via eth0
-			mnl.EXPECT().RouteReplace(&netlink.Route{
-				Dst:       &net.IPNet{IP: defaultGw, Mask: net.CIDRMask(32, 32)},
-				LinkIndex: 1,
-				Scope:     netlink.SCOPE_LINK,
-			}).Return(nil),
-			// add default route via wg0
-			mnl.EXPECT().RouteReplace(&netlink.Route{
-				Dst: dnet,
-				Gw:  nil,
-				Via: &netlink.Via{
-					Addr:       net.ParseIP("fe80::1"),
-					AddrFamily: nl.FAMILY_V6,
-				},
-				LinkIndex: 2,
-				Scope:     netlink.SCOPE_UNIVERSE,
-				Family:    nl.FAMILY_V4,
-			}),
-			// add routes to exceptional CIDRs via eth0
-			mnl.EXPECT().RouteReplace(&netlink.Route{
-				Dst:       net1,
-				Gw:        defaultGw,
-				LinkIndex: 1,
-				Protocol:  unix.RTPROT_STATIC,
-			}).Return(nil),
-			mnl.EXPECT().RouteReplace(&netlink.Route{
-				Dst:       net2,
-				Gw:        defaultGw,
-				LinkIndex: 1,
-				Protocol:  unix.RTPROT_STATIC,
-			}).Return(nil),
-		)
+	defaultGatewayRouteSetupProcess := func(enableIPv6 bool) func() {
+		return func() {
+			calls := []any{
+				// retrieve eth0 link
+				mnl.EXPECT().LinkByName("eth0").Return(eth0, nil),
+				// retrieve wg0 link
+				mnl.EXPECT().LinkByName("wg0").Return(wg0, nil),
+				// get existing routes
+				mnl.EXPECT().RouteList(eth0, netlink.FAMILY_ALL).Return(existingRoutes, nil),
+				// delete existing routes
+				mnl.EXPECT().RouteDel(&existingRoutes[0]).Return(nil),
+				mnl.EXPECT().RouteDel(&existingRoutes[1]).Return(nil),
+				// add route to default gateway via eth0
+				mnl.EXPECT().RouteReplace(&netlink.Route{
+					Dst:       &net.IPNet{IP: defaultGw, Mask: net.CIDRMask(32, 32)},
+					LinkIndex: 1,
+					Scope:     netlink.SCOPE_LINK,
+				}).Return(nil),
+				// add default route via wg0
+				mnl.EXPECT().RouteReplace(&netlink.Route{
+					Dst: dnet,
+					Gw:  nil,
+					Via: &netlink.Via{
+						Addr:       testGatewayIP,
+						AddrFamily: nl.FAMILY_V6,
+					},
+					LinkIndex: 2,
+					Scope:     netlink.SCOPE_UNIVERSE,
+					Family:    nl.FAMILY_V4,
+				}),
+			}
+			if enableIPv6 {
+				// add ipv6 default route via wg0
+				calls = append(calls, mnl.EXPECT().RouteReplace(&netlink.Route{
+					Dst:       dnet6,
+					Gw:        testGatewayIP,
+					LinkIndex: 2,
+					Scope:     netlink.SCOPE_UNIVERSE,
+					Family:    nl.FAMILY_V6,
+				}).Return(nil))
+			}
+			calls = append(calls,
+				// add routes to exceptional CIDRs via eth0
+				mnl.EXPECT().RouteReplace(&netlink.Route{
+					Dst:       net1,
+					Gw:        defaultGw,
+					LinkIndex: 1,
+					Protocol:  unix.RTPROT_STATIC,
+				}).Return(nil),
+				mnl.EXPECT().RouteReplace(&netlink.Route{
+					Dst:       net2,
+					Gw:        defaultGw,
+					LinkIndex: 1,
+					Protocol:  unix.RTPROT_STATIC,
+				}).Return(nil),
+			)
+			gomock.InOrder(calls...)
+		}
 	}
-	defaultAzureNetworkingRouteSetupProcess := func() {
-		gomock.InOrder(
-			// retrieve eth0 link
-			mnl.EXPECT().LinkByName("eth0").Return(eth0, nil),
-			// retrieve wg0 link
-			mnl.EXPECT().LinkByName("wg0").Return(wg0, nil),
-			// get existing routes
-			mnl.EXPECT().RouteList(eth0, netlink.FAMILY_ALL).Return(existingRoutes, nil),
-			// add routes to exceptional CIDRs via wg0
-			mnl.EXPECT().RouteReplace(&netlink.Route{
-				Dst: net1,
-				Gw:  nil,
-				Via: &netlink.Via{
-					Addr:       net.ParseIP("fe80::1"),
-					AddrFamily: nl.FAMILY_V6,
-				},
-				LinkIndex: 2,
-				Scope:     netlink.SCOPE_UNIVERSE,
-				Family:    nl.FAMILY_V4,
-			}).Return(nil),
-			mnl.EXPECT().RouteReplace(&netlink.Route{
-				Dst: net2,
-				Gw:  nil,
-				Via: &netlink.Via{
-					Addr:       net.ParseIP("fe80::1"),
-					AddrFamily: nl.FAMILY_V6,
-				},
-				LinkIndex: 2,
-				Scope:     netlink.SCOPE_UNIVERSE,
-				Family:    nl.FAMILY_V4,
-			}).Return(nil),
-		)
+	defaultAzureNetworkingRouteSetupProcess := func(enableIPv6 bool) func() {
+		return func() {
+			calls := []any{
+				// retrieve eth0 link
+				mnl.EXPECT().LinkByName("eth0").Return(eth0, nil),
+				// retrieve wg0 link
+				mnl.EXPECT().LinkByName("wg0").Return(wg0, nil),
+				// get existing routes
+				mnl.EXPECT().RouteList(eth0, netlink.FAMILY_ALL).Return(existingRoutes, nil),
+				// add routes to included CIDRs via wg0
+				mnl.EXPECT().RouteReplace(&netlink.Route{
+					Dst: includeNet,
+					Gw:  nil,
+					Via: &netlink.Via{
+						Addr:       testGatewayIP,
+						AddrFamily: nl.FAMILY_V6,
+					},
+					LinkIndex: 2,
+					Scope:     netlink.SCOPE_UNIVERSE,
+					Family:    nl.FAMILY_V4,
+				}).Return(nil),
+			}
+			if enableIPv6 {
+				calls = append(calls, mnl.EXPECT().RouteReplace(&netlink.Route{
+					Dst:       includeNet6,
+					Gw:        testGatewayIP,
+					LinkIndex: 2,
+					Scope:     netlink.SCOPE_UNIVERSE,
+					Family:    nl.FAMILY_V6,
+				}).Return(nil))
+			}
+			calls = append(calls,
+				// add routes to exceptional CIDRs via eth0
+				mnl.EXPECT().RouteReplace(&netlink.Route{
+					Dst:       net1,
+					Gw:        defaultGw,
+					LinkIndex: 1,
+					Protocol:  unix.RTPROT_STATIC,
+				}).Return(nil),
+				mnl.EXPECT().RouteReplace(&netlink.Route{
+					Dst:       net2,
+					Gw:        defaultGw,
+					LinkIndex: 1,
+					Protocol:  unix.RTPROT_STATIC,
+				}).Return(nil),
+			)
+			gomock.InOrder(calls...)
+		}
 	}
 
 	tests := []struct {
 		desc                string
 		defaultToGateway    bool
+		enableIPv6          bool
 		expectedRouteResult []*types.Route
 		routeSetupProcess   func()
 	}{
@@ -155,20 +193,46 @@ func TestSetPodRoutes(t *testing.T) {
 			defaultToGateway: true,
 			expectedRouteResult: []*types.Route{
 				{Dst: net.IPNet{IP: defaultGw, Mask: net.CIDRMask(32, 32)}},
-				{Dst: *dnet, GW: net.ParseIP("fe80::1")},
+				{Dst: *dnet, GW: testGatewayIP},
+				{Dst: *net1, GW: defaultGw},
+				{Dst: *net2, GW: defaultGw},
+			},
+			routeSetupProcess: defaultGatewayRouteSetupProcess(false),
+		},
+		{
+			desc:             "default to gateway with ipv6",
+			defaultToGateway: true,
+			enableIPv6:       true,
+			expectedRouteResult: []*types.Route{
+				{Dst: net.IPNet{IP: defaultGw, Mask: net.CIDRMask(32, 32)}},
+				{Dst: *dnet, GW: testGatewayIP},
+				{Dst: *dnet6, GW: testGatewayIP},
 				{Dst: *net1, GW: defaultGw},
 				{Dst: *net2, GW: defaultGw},
 			},
-			routeSetupProcess: defaultGatewayRouteSetupProcess,
+			routeSetupProcess: defaultGatewayRouteSetupProcess(true),
 		},
 		{
 			desc:             "default to azure network",
 			defaultToGateway: false,
 			expectedRouteResult: []*types.Route{
-				{Dst: *net1, GW: net.ParseIP("fe80::1")},
-				{Dst: *net2, GW: net.ParseIP("fe80::1")},
+				{Dst: *includeNet, GW: testGatewayIP},
+				{Dst: *net1, GW: defaultGw},
+				{Dst: *net2, GW: defaultGw},
 			},
-			routeSetupProcess: defaultAzureNetworkingRouteSetupProcess,
+			routeSetupProcess: defaultAzureNetworkingRouteSetupProcess(false),
+		},
+		{
+			desc:             "default to azure network with ipv6",
+			defaultToGateway: false,
+			enableIPv6:       true,
+			expectedRouteResult: []*types.Route{
+				{Dst: *includeNet, GW: testGatewayIP},
+				{Dst: *includeNet6, GW: testGatewayIP},
+				{Dst: *net1, GW: defaultGw},
+				{Dst: *net2, GW: defaultGw},
+			},
+			routeSetupProcess: defaultAzureNetworkingRouteSetupProcess(true),
 		},
 	}
 	for _, test := range tests {
@@ -201,7 +265,7 @@ func TestSetPodRoutes(t *testing.T) {
 		}
 
 		result := &current.Result{}
-		err := SetPodRoutes("wg0", []string{"1.2.3.4/32", "172.17.0.4/16"}, test.defaultToGateway, testDir, result)
+		err := SetPodRoutes("wg0", testGatewayIP, []string{"1.2.3.4/32", "172.17.0.4/16"}, []string{"172.16.0.0/12", "fd00::/64"}, test.defaultToGateway, test.enableIPv6, false, false, testDir, result)
 		if err != nil {
 			t.Fatalf("SetPodRoutes returns unexpected error: %v", err)
 		}
@@ -226,3 +290,258 @@ func TestSetPodRoutes(t *testing.T) {
 		}
 	}
 }
+
+func TestSetPodRoutesWithIPv6Exceptions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mnl := mocknetlinkwrapper.NewMockInterface(ctrl)
+	mipt := mockiptableswrapper.NewMockInterface(ctrl)
+	mtable := mockiptableswrapper.NewMockIpTables(ctrl)
+	routesRunner = runner{
+		netlink:  mnl,
+		iptables: mipt,
+	}
+
+	eth0 := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth0", Index: 1}}
+	wg0 := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "wg0", Index: 2}}
+	defaultGw := net.IPv4(10, 244, 0, 1)
+	defaultIPv6Gw := net.ParseIP("fe80::1234:5678:9abc")
+	_, net1, _ := net.ParseCIDR("1.2.3.4/32")
+	_, net6, _ := net.ParseCIDR("fd00:10::/64")
+	_, includeNet, _ := net.ParseCIDR("172.16.0.0/12")
+	defaultRoute := netlink.Route{Family: nl.FAMILY_V4, Gw: defaultGw, LinkIndex: 1}
+
+	tests := []struct {
+		desc                string
+		existingRoutes      []netlink.Route
+		expectedRouteResult []*types.Route
+	}{
+		{
+			desc: "pod has ipv6 default route on eth0",
+			existingRoutes: []netlink.Route{
+				defaultRoute,
+				{Family: nl.FAMILY_V6, Gw: defaultIPv6Gw, LinkIndex: 1},
+			},
+			expectedRouteResult: []*types.Route{
+				{Dst: *includeNet, GW: testGatewayIP},
+				{Dst: *net1, GW: defaultGw},
+				{Dst: *net6, GW: defaultIPv6Gw},
+			},
+		},
+		{
+			desc:           "pod has no ipv6 default route on eth0",
+			existingRoutes: []netlink.Route{defaultRoute},
+			expectedRouteResult: []*types.Route{
+				{Dst: *includeNet, GW: testGatewayIP},
+				{Dst: *net1, GW: defaultGw},
+			},
+		},
+	}
+
+	if err := os.MkdirAll(allDir, os.ModePerm); err != nil {
+		t.Fatalf("Failed to mkdir %s: %v", allDir, err)
+	}
+	defer func() {
+		_ = os.RemoveAll(testDir)
+	}()
+	if err := os.MkdirAll(eth0Dir, os.ModePerm); err != nil {
+		t.Fatalf("Failed to mkdir %s: %v", eth0Dir, err)
+	}
+	for _, test := range tests {
+		calls := []any{
+			mnl.EXPECT().LinkByName("eth0").Return(eth0, nil),
+			mnl.EXPECT().LinkByName("wg0").Return(wg0, nil),
+			mnl.EXPECT().RouteList(eth0, netlink.FAMILY_ALL).Return(test.existingRoutes, nil),
+			mnl.EXPECT().RouteReplace(&netlink.Route{
+				Dst:       includeNet,
+				Via:       &netlink.Via{Addr: testGatewayIP, AddrFamily: nl.FAMILY_V6},
+				LinkIndex: 2,
+				Scope:     netlink.SCOPE_UNIVERSE,
+				Family:    nl.FAMILY_V4,
+			}).Return(nil),
+			mnl.EXPECT().RouteReplace(&netlink.Route{Dst: net1, Gw: defaultGw, LinkIndex: 1, Protocol: unix.RTPROT_STATIC}).Return(nil),
+		}
+		if len(test.existingRoutes) > 1 {
+			// ipv6 cidr is excluded via the eth0 ipv6 gateway instead of the ipv4 one
+			calls = append(calls, mnl.EXPECT().RouteReplace(&netlink.Route{
+				Dst:       net6,
+				Gw:        defaultIPv6Gw,
+				LinkIndex: 1,
+				Protocol:  unix.RTPROT_STATIC,
+				Family:    nl.FAMILY_V6,
+			}).Return(nil))
+		}
+		calls = append(calls, mipt.EXPECT().New().Return(mtable, nil))
+		gomock.InOrder(calls...)
+		mtable.EXPECT().AppendUnique(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(3)
+		mnl.EXPECT().RuleAdd(gomock.Any()).Return(nil)
+		mnl.EXPECT().RouteReplace(&netlink.Route{Family: nl.FAMILY_V4, Gw: defaultGw, LinkIndex: 1, Table: 8738}).Return(nil)
+
+		result := &current.Result{}
+		err := SetPodRoutes("wg0", testGatewayIP, []string{"1.2.3.4/32", "fd00:10::/64"}, []string{"172.16.0.0/12"}, false, true, false, false, testDir, result)
+		if err != nil {
+			t.Fatalf("%s: SetPodRoutes returns unexpected error: %v", test.desc, err)
+		}
+		if !reflect.DeepEqual(result.Routes, test.expectedRouteResult) {
+			t.Fatalf("%s: Got unexpected routes in result: %v, expected: %v", test.desc, result.Routes, test.expectedRouteResult)
+		}
+	}
+}
+
+func TestSetPodRoutesWithIPv4ViaNode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mnl := mocknetlinkwrapper.NewMockInterface(ctrl)
+	mipt := mockiptableswrapper.NewMockInterface(ctrl)
+	mtable := mockiptableswrapper.NewMockIpTables(ctrl)
+	routesRunner = runner{
+		netlink:  mnl,
+		iptables: mipt,
+	}
+
+	eth0 := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth0", Index: 1}}
+	wg0 := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "wg0", Index: 2}}
+	defaultGw := net.IPv4(10, 244, 0, 1)
+	defaultIPv6Gw := net.ParseIP("fe80::1234:5678:9abc")
+	_, podNet, _ := net.ParseCIDR("10.244.0.0/24")
+	_, podNet6, _ := net.ParseCIDR("fd00:10::/64")
+	_, net1, _ := net.ParseCIDR("1.2.3.4/32")
+	_, dnet6, _ := net.ParseCIDR("::/0")
+	existingRoutes := []netlink.Route{
+		{Family: nl.FAMILY_V4, Gw: defaultGw, LinkIndex: 1},
+		{Family: nl.FAMILY_V6, Gw: defaultIPv6Gw, LinkIndex: 1},
+	}
+
+	if err := os.MkdirAll(allDir, os.ModePerm); err != nil {
+		t.Fatalf("Failed to mkdir %s: %v", allDir, err)
+	}
+	defer func() {
+		_ = os.RemoveAll(testDir)
+	}()
+	if err := os.MkdirAll(eth0Dir, os.ModePerm); err != nil {
+		t.Fatalf("Failed to mkdir %s: %v", eth0Dir, err)
+	}
+	gomock.InOrder(
+		mnl.EXPECT().LinkByName("eth0").Return(eth0, nil),
+		mnl.EXPECT().LinkByName("wg0").Return(wg0, nil),
+		mnl.EXPECT().RouteList(eth0, netlink.FAMILY_ALL).Return(existingRoutes, nil),
+		// only ipv6 routes are replaced, ipv4 traffic stays on eth0
+		mnl.EXPECT().RouteDel(&existingRoutes[1]).Return(nil),
+		mnl.EXPECT().RouteReplace(&netlink.Route{
+			Dst:       dnet6,
+			Gw:        testGatewayIP,
+			LinkIndex: 2,
+			Scope:     netlink.SCOPE_UNIVERSE,
+			Family:    nl.FAMILY_V6,
+		}).Return(nil),
+		mnl.EXPECT().RouteReplace(&netlink.Route{Dst: net1, Gw: defaultGw, LinkIndex: 1, Protocol: unix.RTPROT_STATIC}).Return(nil),
+		mipt.EXPECT().New().Return(mtable, nil),
+	)
+	mtable.EXPECT().AppendUnique(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(3)
+	mnl.EXPECT().RuleAdd(gomock.Any()).Return(nil)
+	mnl.EXPECT().RouteReplace(&netlink.Route{Family: nl.FAMILY_V4, Gw: defaultGw, LinkIndex: 1, Table: 8738}).Return(nil)
+
+	result := &current.Result{Routes: []*types.Route{{Dst: *podNet}, {Dst: *podNet6}}}
+	err := SetPodRoutes("wg0", testGatewayIP, []string{"1.2.3.4/32"}, nil, true, true, true, false, testDir, result)
+	if err != nil {
+		t.Fatalf("SetPodRoutes returns unexpected error: %v", err)
+	}
+	expectedRouteResult := []*types.Route{
+		{Dst: *podNet},
+		{Dst: *dnet6, GW: testGatewayIP},
+		{Dst: *net1, GW: defaultGw},
+	}
+	if !reflect.DeepEqual(result.Routes, expectedRouteResult) {
+		t.Fatalf("Got unexpected routes in result: %v, expected: %v", result.Routes, expectedRouteResult)
+	}
+}
+
+func TestSetPodDNSRoute(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mnl := mocknetlinkwrapper.NewMockInterface(ctrl)
+	// DNS traffic to other resolvers is not redirected, iptables is left untouched
+	mipt := mockiptableswrapper.NewMockInterface(ctrl)
+	routesRunner = runner{
+		netlink:  mnl,
+		iptables: mipt,
+	}
+
+	wg0 := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "wg0", Index: 2}}
+	dnsDestination := net.IPNet{IP: net.IPv4(10, 1, 0, 53).To4(), Mask: net.CIDRMask(32, 32)}
+	dnsRoute := &netlink.Route{
+		Dst: &dnsDestination,
+		Via: &netlink.Via{
+			Addr:       testGatewayIP,
+			AddrFamily: nl.FAMILY_V6,
+		},
+		LinkIndex: 2,
+		Scope:     netlink.SCOPE_UNIVERSE,
+		Family:    nl.FAMILY_V4,
+	}
+	gomock.InOrder(
+		mnl.EXPECT().LinkByName("wg0").Return(wg0, nil),
+		mnl.EXPECT().RouteReplace(dnsRoute).Return(nil),
+	)
+
+	result := &current.Result{}
+	if err := SetPodDNSRoute("wg0", testGatewayIP, "10.1.0.53", result); err != nil {
+		t.Fatalf("SetPodDNSRoute returns unexpected error: %v", err)
+	}
+	expectedRoutes := []*types.Route{{Dst: dnsDestination, GW: testGatewayIP}}
+	if !reflect.DeepEqual(result.Routes, expectedRoutes) {
+		t.Fatalf("Got unexpected routes in result: %v, expected: %v", result.Routes, expectedRoutes)
+	}
+	if len(result.DNS.Nameservers) != 0 {
+		t.Fatalf("Got unexpected nameservers in result: %v", result.DNS.Nameservers)
+	}
+
+	if err := SetPodDNSRoute("wg0", testGatewayIP, "fd00::53", &current.Result{}); err == nil {
+		t.Fatalf("SetPodDNSRoute should fail with ipv6 dns server")
+	}
+}
+
+func TestParseGatewayIP(t *testing.T) {
+	result := &current.Result{IPs: []*current.IPConfig{
+		{Address: net.IPNet{IP: net.ParseIP("10.244.0.10"), Mask: net.CIDRMask(32, 32)}},
+		{Address: net.IPNet{IP: net.ParseIP("fe80:0:0:ffff::1"), Mask: net.CIDRMask(64, 128)}},
+	}}
+	tests := map[string]struct {
+		gatewayIP string
+		expected  string
+		err       string
+	}{
+		"defaults to the first address of the default tunnel cidr": {
+			expected: "fe80::1",
+		},
+		"moved tunnel cidr": {
+			gatewayIP: "fe80:0:0:eeee::1",
+			expected:  "fe80:0:0:eeee::1",
+		},
+		"pod address conflict": {
+			gatewayIP: "fe80:0:0:ffff::1",
+			err:       "pod address fe80:0:0:ffff::1/64 conflicts with the gateway tunnel address, move the tunnel cidr of gateway daemons and cni managers out of the way",
+		},
+		"ipv4": {
+			gatewayIP: "169.254.0.1",
+			err:       "gateway ip 169.254.0.1 should be an IPv6 address",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ip, err := ParseGatewayIP(test.gatewayIP, result)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("ParseGatewayIP returns unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseGatewayIP returns unexpected error: %v", err)
+			}
+			if ip.String() != test.expected {
+				t.Fatalf("Got unexpected gateway ip: %s", ip)
+			}
+		})
+	}
+}
@@ -32,7 +32,7 @@ func init() {
 	}
 }
 
-func WithWireGuardNic(containerID string, podNSPath string, ifName string, ipWrapper ipam.IPProvider, exludedRoute []string, result *current.Result, configFunc func(podNs ns.NetNS, allowedIPNet string) error) (err error) {
+func WithWireGuardNic(containerID string, podNSPath string, ifName string, ipWrapper ipam.IPProvider, exludedRoute []string, result *current.Result, configFunc func(podNs ns.NetNS, allowedIPNet, allowedIPv6Net string) error) (err error) {
 	podNetNS, err := nicRunner.netns.GetNSByPath(podNSPath)
 	if err != nil {
 		return err
@@ -144,7 +144,7 @@ func WithWireGuardNic(containerID string, podNSPath string, ifName string, ipWra
 			return errors.New("ipam result is empty")
 		}
 
-		allowedIPNet := ""
+		allowedIPNet, allowedIPv6Net := "", ""
 		err = podNetNS.Do(func(nn ns.NetNS) error {
 			// Retrieve link again to get up-to-date name and attributes
 			wgLink, err = nicRunner.netlink.LinkByName(ifName)
@@ -161,8 +161,11 @@ func WithWireGuardNic(containerID string, podNSPath string, ifName string, ipWra
 			}
 			result.Interfaces = append(result.Interfaces, ipamResult.Interfaces[0])
 			for _, item := range ipamResult.IPs {
-				if item.Address.IP.To4() == nil {
-					// add ipv6 ip to result
+				if item.Address.IP.To4() == nil && !item.Address.IP.IsLinkLocalUnicast() {
+					// pod global ipv6 ip should be added in wireguard configuration as allowed ip
+					allowedIPv6Net = fmt.Sprintf("%s/128", item.Address.IP.String())
+				} else if item.Address.IP.To4() == nil {
+					// add ipv6 link-local ip to result
 					item.Interface = current.Int(0)
 					result.IPs = append(result.IPs, &current.IPConfig{
 						Interface: current.Int(len(result.Interfaces) - 1),
@@ -188,7 +191,7 @@ func WithWireGuardNic(containerID string, podNSPath string, ifName string, ipWra
 		}
 
 		if configFunc != nil {
-			return configFunc(podNetNS, allowedIPNet)
+			return configFunc(podNetNS, allowedIPNet, allowedIPv6Net)
 		}
 		return nil
 	})
@@ -27,7 +27,7 @@ const (
 	ifNameInMain = "wg12345678"
 )
 
-func fakeConfigFunc(podNs ns.NetNS, allowedIPNet string) error {
+func fakeConfigFunc(podNs ns.NetNS, allowedIPNet, allowedIPv6Net string) error {
 	return nil
 }
 
@@ -144,6 +144,35 @@ var _ = Describe("test WithWireGuardNic", func() {
 		Expect(err).NotTo(HaveOccurred())
 	})
 
+	It("should pass pod global ipv6 ip as allowed ip for dual-stack pod", func() {
+		ipamResult.IPs = append(ipamResult.IPs, &current.IPConfig{Address: net.IPNet{IP: net.ParseIP("2001:db8::4"), Mask: net.CIDRMask(64, 128)}})
+		mns := nicRunner.netns.(*mocknetnswrapper.MockInterface)
+		mlink := nicRunner.netlink.(*mocknetlinkwrapper.MockInterface)
+		gwns := &mocknetnswrapper.MockNetNS{Name: nsName}
+		wg0 := &netlink.Wireguard{LinkAttrs: netlink.LinkAttrs{Name: ifName}}
+		gomock.InOrder(
+			mns.EXPECT().GetNSByPath(podNSPath).Return(gwns, nil),
+			mlink.EXPECT().LinkByName(ifName).Return(wg0, nil),
+			mlink.EXPECT().LinkByName(ifName).Return(wg0, nil),
+		)
+		result := &current.Result{}
+		var allowedIP, allowedIPv6 string
+		err := WithWireGuardNic(containerID, podNSPath, ifName, ipam.NewFakeIPProvider(&ipamResult), []string{}, result, func(podNs ns.NetNS, allowedIPNet, allowedIPv6Net string) error {
+			allowedIP, allowedIPv6 = allowedIPNet, allowedIPv6Net
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(allowedIP).To(Equal("10.0.0.4/32"))
+		Expect(allowedIPv6).To(Equal("2001:db8::4/128"))
+		// global ipv6 ip is not configured on wireguard interface
+		Expect(result.IPs).To(Equal([]*current.IPConfig{
+			{
+				Interface: current.Int(0),
+				Address:   net.IPNet{IP: net.ParseIP("fe80::1234"), Mask: net.CIDRMask(128, 128)},
+			},
+		}))
+	})
+
 	It("should recover changes when encountering any error", func() {
 		mns := nicRunner.netns.(*mocknetnswrapper.MockInterface)
 		mlink := nicRunner.netlink.(*mocknetlinkwrapper.MockInterface)
@@ -4,9 +4,13 @@ package config
 
 import (
 	"fmt"
+	"os"
 	"strings"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient"
+
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
 )
 
 type CloudConfig struct {
@@ -22,12 +26,23 @@ type CloudConfig struct {
 	LoadBalancerName string `json:"gatewayLoadBalancerName,omitempty" mapstructure:"gatewayLoadBalancerName,omitempty"`
 	// resource group where the gateway ILB belongs
 	LoadBalancerResourceGroup string `json:"loadBalancerResourceGroup,omitempty" mapstructure:"loadBalancerResourceGroup,omitempty"`
+	// resource ID of an existing load balancer to add gateway rules to, overrides gatewayLoadBalancerName and
+	// loadBalancerResourceGroup. The load balancer is neither created nor deleted by the controller.
+	ExistingLoadBalancerID string `json:"existingLoadBalancerID,omitempty" mapstructure:"existingLoadBalancerID,omitempty"`
 	// name of the virtual network where the gateway ILB is deployed
 	VnetName string `json:"vnetName,omitempty" mapstructure:"vnetName,omitempty"`
 	// name of the resource group where the virtual network is deployed
 	VnetResourceGroup string `json:"vnetResourceGroup,omitempty" mapstructure:"vnetResourceGroup,omitempty"`
 	// name of the subnet in the vnet where the gateway ILB is deployed
 	SubnetName string `json:"subnetName,omitempty" mapstructure:"subnetName,omitempty"`
+	// maximum number of retries of a throttled or failed azure request, 0 uses the default, negative disables retries
+	CloudProviderBackoffRetries int32 `json:"cloudProviderBackoffRetries,omitempty" mapstructure:"cloudProviderBackoffRetries,omitempty"`
+	// initial backoff duration in seconds before retrying an azure request, 0 uses the default
+	CloudProviderBackoffDuration int32 `json:"cloudProviderBackoffDuration,omitempty" mapstructure:"cloudProviderBackoffDuration,omitempty"`
+	// maximum backoff duration in seconds between retries, requests with a longer Retry-After are not retried, 0 uses the default
+	CloudProviderBackoffMaxDuration int32 `json:"cloudProviderBackoffMaxDuration,omitempty" mapstructure:"cloudProviderBackoffMaxDuration,omitempty"`
+	// ttl in seconds of cached vmss and vmss instances, 0 uses the default, negative disables the cache
+	VmssCacheTTLInSeconds int32 `json:"vmssCacheTTLInSeconds,omitempty" mapstructure:"vmssCacheTTLInSeconds,omitempty"`
 }
 
 func (cfg *CloudConfig) TrimSpace() {
@@ -38,15 +53,34 @@ func (cfg *CloudConfig) TrimSpace() {
 	cfg.UserAssignedIdentityID = strings.TrimSpace(cfg.UserAssignedIdentityID)
 	cfg.AADClientID = strings.TrimSpace(cfg.AADClientID)
 	cfg.AADClientSecret = strings.TrimSpace(cfg.AADClientSecret)
+	cfg.AADFederatedTokenFile = strings.TrimSpace(cfg.AADFederatedTokenFile)
 	cfg.UserAgent = strings.TrimSpace(cfg.UserAgent)
 	cfg.ResourceGroup = strings.TrimSpace(cfg.ResourceGroup)
 	cfg.LoadBalancerName = strings.TrimSpace(cfg.LoadBalancerName)
 	cfg.LoadBalancerResourceGroup = strings.TrimSpace(cfg.LoadBalancerResourceGroup)
+	cfg.ExistingLoadBalancerID = strings.TrimSpace(cfg.ExistingLoadBalancerID)
 	cfg.VnetName = strings.TrimSpace(cfg.VnetName)
 	cfg.VnetResourceGroup = strings.TrimSpace(cfg.VnetResourceGroup)
 	cfg.SubnetName = strings.TrimSpace(cfg.SubnetName)
 }
 
+// DefaultWorkloadIdentity fills tenant ID, client ID and federated token file missing in config from the environment
+// variables injected by the Azure Workload Identity webhook, when workload identity is used.
+func (cfg *CloudConfig) DefaultWorkloadIdentity() {
+	if !cfg.UseFederatedWorkloadIdentityExtension {
+		return
+	}
+	if cfg.TenantID == "" {
+		cfg.TenantID = os.Getenv(consts.AzureTenantIDEnvKey)
+	}
+	if cfg.AADClientID == "" {
+		cfg.AADClientID = os.Getenv(consts.AzureClientIDEnvKey)
+	}
+	if cfg.AADFederatedTokenFile == "" {
+		cfg.AADFederatedTokenFile = os.Getenv(consts.AzureFederatedTokenFileEnvKey)
+	}
+}
+
 func (cfg *CloudConfig) Validate() error {
 	if cfg.Cloud == "" {
 		return fmt.Errorf("cloud is empty")
@@ -60,7 +94,14 @@ func (cfg *CloudConfig) Validate() error {
 		return fmt.Errorf("subscription ID is empty")
 	}
 
-	if !cfg.UseManagedIdentityExtension {
+	if cfg.UseFederatedWorkloadIdentityExtension {
+		if cfg.UseManagedIdentityExtension {
+			return fmt.Errorf("useManagedIdentityExtension and useFederatedWorkloadIdentityExtension cannot be both true")
+		}
+		if cfg.TenantID == "" || cfg.AADClientID == "" || cfg.AADFederatedTokenFile == "" {
+			return fmt.Errorf("tenant ID, AAD client ID or AAD federated token file is empty")
+		}
+	} else if !cfg.UseManagedIdentityExtension {
 		if cfg.UserAssignedIdentityID != "" {
 			return fmt.Errorf("useManagedIdentityExtension needs to be true when userAssignedIdentityID is provided")
 		}
@@ -81,5 +122,27 @@ func (cfg *CloudConfig) Validate() error {
 		return fmt.Errorf("virtual network subnet name is empty")
 	}
 
+	if cfg.ExistingLoadBalancerID != "" {
+		lbID, err := arm.ParseResourceID(cfg.ExistingLoadBalancerID)
+		if err != nil {
+			return fmt.Errorf("existing load balancer ID is invalid: %w", err)
+		}
+		if !strings.EqualFold(lbID.ResourceType.String(), "Microsoft.Network/loadBalancers") {
+			return fmt.Errorf("existing load balancer ID %s is not a load balancer", cfg.ExistingLoadBalancerID)
+		}
+		if !strings.EqualFold(lbID.SubscriptionID, cfg.SubscriptionID) {
+			return fmt.Errorf("existing load balancer %s is not in subscription %s", cfg.ExistingLoadBalancerID, cfg.SubscriptionID)
+		}
+	}
+
+	if cfg.CloudProviderBackoffDuration < 0 || cfg.CloudProviderBackoffMaxDuration < 0 {
+		return fmt.Errorf("cloud provider backoff duration is negative")
+	}
+
+	if cfg.CloudProviderBackoffDuration > 0 && cfg.CloudProviderBackoffMaxDuration > 0 &&
+		cfg.CloudProviderBackoffDuration > cfg.CloudProviderBackoffMaxDuration {
+		return fmt.Errorf("cloud provider backoff duration (%d) is larger than max duration (%d)", cfg.CloudProviderBackoffDuration, cfg.CloudProviderBackoffMaxDuration)
+	}
+
 	return nil
 }
@@ -27,6 +27,7 @@ func TestTrimSpace(t *testing.T) {
 			ResourceGroup:             "\r\n  test  \n",
 			LoadBalancerName:          "  test  \r\n",
 			LoadBalancerResourceGroup: "  test  \n",
+			ExistingLoadBalancerID:    "  test  \n",
 			VnetName:                  "  test   ",
 			VnetResourceGroup:         " \t  test   ",
 			SubnetName:                "  test  ",
@@ -43,6 +44,7 @@ func TestTrimSpace(t *testing.T) {
 			ResourceGroup:             "test",
 			LoadBalancerName:          "test",
 			LoadBalancerResourceGroup: "test",
+			ExistingLoadBalancerID:    "test",
 			AzureAuthConfig: azclient.AzureAuthConfig{
 				UseManagedIdentityExtension: true,
 				UserAssignedIdentityID:      "test",
@@ -72,6 +74,12 @@ func TestValidate(t *testing.T) {
 		UserAssignedIdentityID      string
 		AADClientID                 string
 		AADClientSecret             string
+		BackoffDuration             int32
+		BackoffMaxDuration          int32
+		ExistingLoadBalancerID      string
+		TenantID                    string
+		UseWorkloadIdentity         bool
+		AADFederatedTokenFile       string
 		expectPass                  bool
 	}{
 		"Cloud empty": {
@@ -195,25 +203,157 @@ func TestValidate(t *testing.T) {
 			UserAssignedIdentityID:      "u",
 			expectPass:                  true,
 		},
+		"negative backoff duration": {
+			Cloud:           "c",
+			Location:        "l",
+			SubscriptionID:  "s",
+			ResourceGroup:   "v",
+			VnetName:        "v",
+			SubnetName:      "s",
+			AADClientID:     "1",
+			AADClientSecret: "2",
+			BackoffDuration: -1,
+			expectPass:      false,
+		},
+		"backoff duration larger than max duration": {
+			Cloud:              "c",
+			Location:           "l",
+			SubscriptionID:     "s",
+			ResourceGroup:      "v",
+			VnetName:           "v",
+			SubnetName:         "s",
+			AADClientID:        "1",
+			AADClientSecret:    "2",
+			BackoffDuration:    10,
+			BackoffMaxDuration: 5,
+			expectPass:         false,
+		},
+		"has valid backoff durations": {
+			Cloud:              "c",
+			Location:           "l",
+			SubscriptionID:     "s",
+			ResourceGroup:      "v",
+			VnetName:           "v",
+			SubnetName:         "s",
+			AADClientID:        "1",
+			AADClientSecret:    "2",
+			BackoffDuration:    5,
+			BackoffMaxDuration: 60,
+			expectPass:         true,
+		},
+		"invalid existing load balancer ID": {
+			Cloud:                  "c",
+			Location:               "l",
+			SubscriptionID:         "s",
+			ResourceGroup:          "v",
+			VnetName:               "v",
+			SubnetName:             "s",
+			AADClientID:            "1",
+			AADClientSecret:        "2",
+			ExistingLoadBalancerID: "lb",
+			expectPass:             false,
+		},
+		"existing load balancer ID of another resource type": {
+			Cloud:                  "c",
+			Location:               "l",
+			SubscriptionID:         "s",
+			ResourceGroup:          "v",
+			VnetName:               "v",
+			SubnetName:             "s",
+			AADClientID:            "1",
+			AADClientSecret:        "2",
+			ExistingLoadBalancerID: "/subscriptions/s/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/lb",
+			expectPass:             false,
+		},
+		"existing load balancer in another subscription": {
+			Cloud:                  "c",
+			Location:               "l",
+			SubscriptionID:         "s",
+			ResourceGroup:          "v",
+			VnetName:               "v",
+			SubnetName:             "s",
+			AADClientID:            "1",
+			AADClientSecret:        "2",
+			ExistingLoadBalancerID: "/subscriptions/other/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb",
+			expectPass:             false,
+		},
+		"has valid existing load balancer ID": {
+			Cloud:                  "c",
+			Location:               "l",
+			SubscriptionID:         "s",
+			ResourceGroup:          "v",
+			VnetName:               "v",
+			SubnetName:             "s",
+			AADClientID:            "1",
+			AADClientSecret:        "2",
+			ExistingLoadBalancerID: "/subscriptions/s/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb",
+			expectPass:             true,
+		},
+		"workload identity without federated token file": {
+			Cloud:               "c",
+			Location:            "l",
+			SubscriptionID:      "s",
+			ResourceGroup:       "v",
+			VnetName:            "v",
+			SubnetName:          "s",
+			TenantID:            "t",
+			AADClientID:         "1",
+			UseWorkloadIdentity: true,
+			expectPass:          false,
+		},
+		"workload identity with managed identity": {
+			Cloud:                       "c",
+			Location:                    "l",
+			SubscriptionID:              "s",
+			ResourceGroup:               "v",
+			VnetName:                    "v",
+			SubnetName:                  "s",
+			TenantID:                    "t",
+			AADClientID:                 "1",
+			AADFederatedTokenFile:       "/var/run/token",
+			UseWorkloadIdentity:         true,
+			UseManagedIdentityExtension: true,
+			expectPass:                  false,
+		},
+		"has valid workload identity": {
+			Cloud:                 "c",
+			Location:              "l",
+			SubscriptionID:        "s",
+			ResourceGroup:         "v",
+			VnetName:              "v",
+			SubnetName:            "s",
+			TenantID:              "t",
+			AADClientID:           "1",
+			AADFederatedTokenFile: "/var/run/token",
+			UseWorkloadIdentity:   true,
+			expectPass:            true,
+		},
 	}
 
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
 			config := CloudConfig{
 				ARMClientConfig: azclient.ARMClientConfig{
-					Cloud: test.Cloud,
+					Cloud:    test.Cloud,
+					TenantID: test.TenantID,
 				},
 				AzureAuthConfig: azclient.AzureAuthConfig{
-					UseManagedIdentityExtension: test.UseManagedIdentityExtension,
-					UserAssignedIdentityID:      test.UserAssignedIdentityID,
-					AADClientID:                 test.AADClientID,
-					AADClientSecret:             test.AADClientSecret,
+					UseManagedIdentityExtension:           test.UseManagedIdentityExtension,
+					UserAssignedIdentityID:                test.UserAssignedIdentityID,
+					AADClientID:                           test.AADClientID,
+					AADClientSecret:                       test.AADClientSecret,
+					UseFederatedWorkloadIdentityExtension: test.UseWorkloadIdentity,
+					AADFederatedTokenFile:                 test.AADFederatedTokenFile,
 				},
 				Location:       test.Location,
 				SubscriptionID: test.SubscriptionID,
 				ResourceGroup:  test.ResourceGroup,
 				VnetName:       test.VnetName,
 				SubnetName:     test.SubnetName,
+
+				CloudProviderBackoffDuration:    test.BackoffDuration,
+				CloudProviderBackoffMaxDuration: test.BackoffMaxDuration,
+				ExistingLoadBalancerID:          test.ExistingLoadBalancerID,
 			}
 
 			err := config.Validate()
@@ -228,3 +368,24 @@ func TestValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestDefaultWorkloadIdentity(t *testing.T) {
+	t.Setenv("AZURE_TENANT_ID", "env-tenant")
+	t.Setenv("AZURE_CLIENT_ID", "env-client")
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", "/var/run/token")
+
+	config := CloudConfig{}
+	config.DefaultWorkloadIdentity()
+	if config.TenantID != "" || config.AADClientID != "" || config.AADFederatedTokenFile != "" {
+		t.Fatalf("expected config unchanged without workload identity, got %+v", config)
+	}
+
+	config = CloudConfig{
+		ARMClientConfig: azclient.ARMClientConfig{TenantID: "tenant"},
+		AzureAuthConfig: azclient.AzureAuthConfig{UseFederatedWorkloadIdentityExtension: true},
+	}
+	config.DefaultWorkloadIdentity()
+	if config.TenantID != "tenant" || config.AADClientID != "env-client" || config.AADFederatedTokenFile != "/var/run/token" {
+		t.Fatalf("expected missing workload identity config from environment, got %+v", config)
+	}
+}
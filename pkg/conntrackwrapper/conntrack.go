@@ -0,0 +1,26 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package conntrackwrapper
+
+import "github.com/vishvananda/netlink"
+
+type Interface interface {
+	// ConntrackTableList returns entries of the conntrack table
+	ConntrackTableList(table netlink.ConntrackTableType, family netlink.InetFamily) ([]*netlink.ConntrackFlow, error)
+	// ConntrackDeleteFilter deletes entries matching the filter from the conntrack table, returns number of deleted entries
+	ConntrackDeleteFilter(table netlink.ConntrackTableType, family netlink.InetFamily, filter netlink.CustomConntrackFilter) (uint, error)
+}
+
+type ct struct{}
+
+func NewConntrack() Interface {
+	return &ct{}
+}
+
+func (*ct) ConntrackDeleteFilter(table netlink.ConntrackTableType, family netlink.InetFamily, filter netlink.CustomConntrackFilter) (uint, error) {
+	return netlink.ConntrackDeleteFilter(table, family, filter)
+}
+
+func (*ct) ConntrackTableList(table netlink.ConntrackTableType, family netlink.InetFamily) ([]*netlink.ConntrackFlow, error) {
+	return netlink.ConntrackTableList(table, family)
+}
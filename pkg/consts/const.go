@@ -2,6 +2,8 @@
 // Licensed under the MIT license.
 package consts
 
+import "time"
+
 const (
 	// StaticGatewayConfiguration finalizer name
 	SGCFinalizerName = "static-gateway-configuration-controller.microsoft.com"
@@ -18,12 +20,42 @@ const (
 	// Prefix for managed Azure resources (public IPPrefix, VMSS ipConfig, etc)
 	ManagedResourcePrefix = "egressgateway-"
 
+	// Suffix for managed Azure resources dedicated to IPv6 egress
+	ManagedIPv6ResourceSuffix = "-ipv6"
+
+	// Tag key on reusable managed public IP prefixes recording namespace/name of the gateway they are named after
+	PublicIPPrefixGatewayTagKey = "kube-egress-gateway-name"
+
+	// Tag key on reusable managed public IP prefixes recording the UID of the gateway configuration using them
+	PublicIPPrefixOwnerTagKey = "kube-egress-gateway-owner"
+
+	// Tag key on reusable managed public IP prefixes recording the UID of the gateway configuration creating them
+	PublicIPPrefixCreatorTagKey = "kube-egress-gateway-creator"
+
+	// Maximum number of public IP prefixes of a gateway, each one takes an ipConfig on the gateway nic
+	MaxPublicIpPrefixCount = 8
+
+	// Range of public IPv4 prefix length supported by Azure, inclusive
+	MinPublicIpPrefixSize int32 = 28
+	MaxPublicIpPrefixSize int32 = 31
+
 	// Key name in the wireugard private key secret
 	WireguardPrivateKeyName = "PrivateKey"
 
 	// Key name in the wireugard private key secret
 	WireguardPublicKeyName = "PublicKey"
 
+	// Key names in the wireguard private key secret of the key pair staged by an ongoing key rotation
+	WireguardNextPrivateKeyName = "NextPrivateKey"
+	WireguardNextPublicKeyName  = "NextPublicKey"
+
+	// Key name in the wireguard private key secret of the public key replaced by the last key rotation
+	WireguardPreviousPublicKeyName = "PreviousPublicKey"
+
+	// How long a staged wireguard key pair is published in gateway status before gateway nodes switch to it, and how
+	// often pods still using the replaced key are checked before it is retired
+	WireguardKeyActivationDelay = 30 * time.Second
+
 	// Wireguard listening port range start, inclusive
 	WireguardPortStart int32 = 6000
 
@@ -57,28 +89,111 @@ const (
 	// Owning StaticGatewayConfiguration name key on secret label
 	OwningSGCNameLabel = "egressgateway.kubernetes.azure.com/owning-gateway-config-name"
 
+	// Owning StaticGatewayConfiguration UID key on egress source IP lease label, the controller manager deletes the
+	// leases of a StaticGatewayConfiguration when it is deleted
+	OwningSGCUIDLabel = "egressgateway.kubernetes.azure.com/owning-gateway-config-uid"
+
+	// Label ConfigMaps referenced by excludeCidrsConfigMap must carry with value "true", the controller manager
+	// only watches ConfigMaps with this label
+	ExcludeCidrsConfigMapLabel = "egressgateway.kubernetes.azure.com/exclude-cidrs"
+
+	// StaticGatewayConfiguration annotation requesting wireguard key rotation, any new value triggers a rotation
+	SGCRotateWireguardKeyAnnotation = "egressgateway.kubernetes.azure.com/rotate-wireguard-key"
+
+	// StaticGatewayConfiguration annotation requesting to retry provisioning after public ip prefix allocation failed,
+	// any new value triggers a retry
+	SGCRetryProvisioningAnnotation = "egressgateway.kubernetes.azure.com/retry-provisioning"
+
+	// StaticGatewayConfiguration annotation requesting to tear down and rebuild all Azure resources of the gateway,
+	// any new value triggers a reprovision
+	SGCForceReprovisionAnnotation = "egressgateway.kubernetes.azure.com/force-reprovision"
+
+	// StaticGatewayConfiguration annotation recording the last handled force reprovision request
+	SGCForceReprovisionHandledAnnotation = "egressgateway.kubernetes.azure.com/force-reprovision-handled"
+
+	// StaticGatewayConfiguration annotation pausing reconciliation, e.g. during Azure maintenance. While "true", the
+	// manager leaves Azure resources of the gateway as they are and only reports the paused condition
+	SGCReconcilePausedAnnotation = "kubernetes.azure.com/reconcile-paused"
+
+	// Secret annotation recording the last handled wireguard key rotation request
+	WireguardKeyRotationRequestAnnotation = "egressgateway.kubernetes.azure.com/wireguard-key-rotation-request"
+
+	// Secret annotation recording when the current wireguard key pair was generated, in RFC3339 format
+	WireguardKeyGeneratedAtAnnotation = "egressgateway.kubernetes.azure.com/wireguard-key-generated-at"
+
+	// Secret annotation recording when the next wireguard key pair was staged, in RFC3339 format
+	WireguardKeyStagedAtAnnotation = "egressgateway.kubernetes.azure.com/wireguard-key-staged-at"
+
 	// Default user agent for Azure SDK
 	DefaultUserAgent = "kube-egress-gateway-controller"
+
+	// Default ttl of cached vmss and vmss instances
+	DefaultVmssCacheTTLInSeconds = 60
 )
 
 const (
 	// gateway network namespace name
 	GatewayNetnsName = "ns-static-egress-gateway"
 
+	// gateway network namespace name prefix when each gateway is configured in its own namespace
+	GatewayNetnsNamePrefix = GatewayNetnsName + "-"
+
 	// wireguard link name in gateway namespace
 	WireguardLinkName = "wg0"
 
 	// wireguard link name prefix in gateway namespace
 	WiregaurdLinkNamePrefix = "wg-"
 
+	// Range of wireguard link MTU, the default leaves room for wireguard overhead on a 1500 bytes network,
+	// and IPv6 requires at least 1280
+	DefaultWireguardMtu int32 = 1420
+	MinWireguardMtu     int32 = 1280
+
+	// Size of IP and TCP headers without options, subtracted from the wireguard MTU to get the clamped TCP MSS
+	IPv4TCPHeaderSize = 40
+	IPv6TCPHeaderSize = 60
+
+	// Range of TCP idle timeout in minutes of gateway public IPs supported by Azure, the default is applied when
+	// not specified
+	DefaultOutboundIdleTimeoutMinutes int32 = 4
+	MaxOutboundIdleTimeoutMinutes     int32 = 30
+
+	// Maximum wireguard persistent keepalive interval, it is a 16-bit number of seconds
+	MaxPersistentKeepaliveSeconds int32 = 65535
+	// Wireguard persistent keepalive interval of pods whose tunnel traffic is sNATed to the node IP, when the gateway
+	// does not set one
+	DefaultNATPersistentKeepaliveSeconds int32 = 25
+
 	// host veth pair link name in host namespace
 	HostVethLinkName = "host-gateway"
 
+	// host veth pair link name prefix in host namespace when each gateway is configured in its own namespace,
+	// followed by the gateway port to stay within the 15 characters limit of link names
+	HostVethLinkNamePrefix = "host-gw-"
+
 	// host link name in gateway namespace
 	HostLinkName = "host0"
 
-	// gateway IP
-	GatewayIP = "fe80::1/64"
+	// traffic mirror vxlan link name prefix in host namespace, followed by the gateway port
+	TrafficMirrorLinkNamePrefix = "egmir-"
+
+	// default destination UDP port of traffic mirror vxlan tunnels, the IANA assigned VXLAN port
+	DefaultTrafficMirrorVxlanPort int32 = 4789
+
+	// route table in host namespace looked up by gateway egress route rules, holding the default route of eth0
+	GatewayRouteTable = 1000
+
+	// Range of gateway egress route rule priority, rules of the main table have priority 32766
+	MinGatewayRoutePriority int32 = 1
+	MaxGatewayRoutePriority int32 = 32765
+
+	// priority of the policy routing rules in host namespace sending wireguard packets with the fwmark of a gateway
+	// to its route table, evaluated before the main table
+	WireguardFwMarkRulePriority = 32000
+
+	// default IPv6 link local subnet addressing the gateway side of pod tunnels, gateway wireguard interfaces get
+	// its first address, fe80::1, and host veth links its second address, fe80::2
+	DefaultTunnelCidr = "fe80::/64"
 
 	// post routing chain name
 	PostRoutingChain = "POSTROUTING"
@@ -101,9 +216,18 @@ const (
 	// environment variable name for nodeName
 	NodeNameEnvKey = "MY_NODE_NAME"
 
+	// environment variable names injected by the Azure Workload Identity webhook
+	AzureTenantIDEnvKey           = "AZURE_TENANT_ID"
+	AzureClientIDEnvKey           = "AZURE_CLIENT_ID"
+	AzureFederatedTokenFileEnvKey = "AZURE_FEDERATED_TOKEN_FILE"
+
 	// mark for traffic from eth0 in pod namespace - 0x2222
 	Eth0Mark int = 8738
 
+	// mark bits kube-proxy sets on packets to masquerade and to drop
+	KubeProxyMasqueradeMark int = 0x4000
+	KubeProxyDropMark       int = 0x8000
+
 	// ilb ip address label
 	ILBIPLabel = "eth0:egress"
 )
@@ -112,9 +236,167 @@ const (
 	CNIConfDir = "/etc/cni/net.d"
 
 	CNIGatewayAnnotationKey = "kubernetes.azure.com/static-gateway-configuration"
+
+	// label selector of StaticGatewayConfiguration in pod namespace, used when CNIGatewayAnnotationKey is not set
+	CNIGatewaySelectorAnnotationKey = "kubernetes.azure.com/egress-gateway-selector"
+
+	// StaticGatewayConfiguration used by pods in the annotated namespace that have neither CNIGatewayAnnotationKey
+	// nor CNIGatewaySelectorAnnotationKey, pods opt out with an empty CNIGatewayAnnotationKey
+	NamespaceDefaultGatewayAnnotationKey = "kubernetes.azure.com/default-egress-gateway"
+
+	// pods with this annotation set to true are not configured with any gateway, regardless of their gateway
+	// annotations, ServiceAccount or namespace default
+	CNIGatewayDisabledAnnotationKey = "kubernetes.azure.com/egress-gateway-disabled"
+
+	// StaticGatewayConfiguration used by pods running as the annotated ServiceAccount that have neither
+	// CNIGatewayAnnotationKey nor CNIGatewaySelectorAnnotationKey, taking precedence over the namespace default.
+	// An empty value opts pods of the ServiceAccount out of the namespace default.
+	ServiceAccountGatewayAnnotationKey = "kubernetes.azure.com/static-gateway-configuration"
+
+	// egress bandwidth limit of the pod in Mbps
+	CNIEgressRateLimitAnnotationKey = "kubernetes.azure.com/static-gateway-egress-rate-limit-mbps"
+
+	// maximum egress bandwidth limit in Mbps, police rate is in bytes per second of uint32
+	MaxEgressRateLimitMbps = 32000
+
+	// egress burst size of the pod in KB
+	CNIEgressBurstAnnotationKey = "kubernetes.azure.com/static-gateway-egress-burst-kb"
+
+	// DSCP value the gateway node sets on egress packets of the pod
+	CNIEgressDSCPAnnotationKey = "kubernetes.azure.com/static-gateway-egress-dscp"
+
+	// maximum DSCP value, DSCP is the upper 6 bits of the IP TOS field
+	MaxEgressDSCP = 63
+
+	// public IP in the gateway egress prefix the pod always egresses with
+	CNIEgressSourceIPAnnotationKey = "kubernetes.azure.com/egress-source-ip"
+
+	// comma separated IP versions of pod traffic routed through the gateway, a subset of the gateway tunnelIPVersions
+	CNITunnelIPVersionsAnnotationKey = "kubernetes.azure.com/static-gateway-tunnel-ip-versions"
+
+	// whether the pod moves back to a higher priority gateway listed in CNIGatewayAnnotationKey once it recovers
+	CNIGatewayFailbackAnnotationKey = "kubernetes.azure.com/static-gateway-failback"
+
+	// gateway nodes with this annotation, whose value is the reason, stop accepting new pod traffic until it is removed
+	GatewayNodeQuarantineAnnotationKey = "kubernetes.azure.com/egress-gateway-quarantine"
+)
+
+const (
+	// pod readiness gate condition type, true when the pod wireguard peer is configured on gateway node
+	PodTunnelReadyConditionType = "egress.kubernetes.azure.com/tunnel-ready"
+
+	// reasons of pod tunnel ready condition
+	PodTunnelReadyReasonPeerConfigured      = "PeerConfigured"
+	PodTunnelReadyReasonGatewayNotFound     = "GatewayNotFound"
+	PodTunnelReadyReasonGatewayDeleting     = "GatewayDeleting"
+	PodTunnelReadyReasonNamespaceNotAllowed = "NamespaceNotAllowed"
+)
+
+const (
+	// PodEndpoint condition type, false when the wireguard handshake with the pod is older than the daemon threshold
+	PodEndpointTunnelHealthyConditionType = "TunnelHealthy"
+
+	// reasons of PodEndpoint tunnel healthy condition
+	PodEndpointTunnelHealthyReasonHandshakeRecent = "HandshakeRecent"
+	PodEndpointTunnelHealthyReasonHandshakeStale  = "HandshakeStale"
+
+	// PodEndpoint condition type, false when all source port ranges of the gateway are taken by other pods
+	PodEndpointSNATPortRangeAssignedConditionType = "SNATPortRangeAssigned"
+
+	// reasons of PodEndpoint sNAT port range assigned condition
+	PodEndpointSNATPortRangeAssignedReasonAssigned  = "Assigned"
+	PodEndpointSNATPortRangeAssignedReasonExhausted = "PortRangesExhausted"
+)
+
+const (
+	// StaticGatewayConfiguration condition type, true when the manager only evaluates the configuration without writing Azure resources
+	SGCDryRunConditionType = "DryRun"
+
+	// reason of StaticGatewayConfiguration dry run condition
+	SGCDryRunReasonEvaluation = "DryRunEvaluation"
+)
+
+const (
+	// StaticGatewayConfiguration condition type, true while reconciliation is paused by annotation
+	SGCPausedConditionType = "Paused"
+
+	// reason of StaticGatewayConfiguration paused condition
+	SGCPausedReasonAnnotation = "ReconcilePaused"
+)
+
+const (
+	// StaticGatewayConfiguration condition type, false when Azure cannot allocate the managed public ip prefix or the prefix is not in the gateway VMSS region
+	SGCPublicIPPrefixReadyConditionType = "PublicIPPrefixReady"
+
+	// reason of StaticGatewayConfiguration public ip prefix ready condition
+	SGCPublicIPPrefixReadyReasonAllocationFailed = "PrefixAllocationFailed"
+
+	// reason of StaticGatewayConfiguration public ip prefix ready condition when the prefix and the gateway VMSS are in different regions
+	SGCPublicIPPrefixReadyReasonRegionMismatch = "RegionMismatch"
+)
+
+const (
+	// StaticGatewayConfiguration condition type, false when the gateway VMSS lacks the network configuration the gateway builds on
+	SGCGatewayVMSSReadyConditionType = "GatewayVMSSReady"
+
+	// reason of StaticGatewayConfiguration gateway VMSS ready condition
+	SGCGatewayVMSSReadyReasonNotGatewayReady = "VMSSNotGatewayReady"
+
+	// reason of StaticGatewayConfiguration gateway VMSS ready condition when the controller credential has no
+	// access to the subscription of the gateway VMSS
+	SGCGatewayVMSSReadyReasonSubscriptionAccessDenied = "SubscriptionAccessDenied"
+)
+
+const (
+	// StaticGatewayConfiguration condition type, true when the gateway serves maxPods pods and rejects new ones
+	SGCFullConditionType = "Full"
+
+	// reasons of StaticGatewayConfiguration full condition
+	SGCFullReasonMaxPodsReached = "MaxPodsReached"
+	SGCFullReasonBelowMaxPods   = "BelowMaxPods"
+)
+
+const (
+	// StaticGatewayConfiguration condition type, false when the ConfigMap referenced by excludeCidrsConfigMap cannot
+	// be read, the last CIDRs read from it are kept meanwhile
+	SGCExcludeCidrsConfigMapReadyConditionType = "ExcludeCidrsConfigMapReady"
+
+	// reasons of StaticGatewayConfiguration exclude CIDRs ConfigMap ready condition
+	SGCExcludeCidrsConfigMapReasonLoaded       = "Loaded"
+	SGCExcludeCidrsConfigMapReasonNotFound     = "ConfigMapNotFound"
+	SGCExcludeCidrsConfigMapReasonKeyNotFound  = "KeyNotFound"
+	SGCExcludeCidrsConfigMapReasonInvalidCidrs = "InvalidCidrs"
+)
+
+const (
+	// StaticGatewayConfiguration condition type, true when cluster pod CIDRs overlap the tunnel CIDR addressing the
+	// gateway side of pod tunnels, pods assigned the gateway address cannot egress through the gateway
+	SGCTunnelCidrConflictConditionType = "TunnelCidrConflict"
+
+	// reason of StaticGatewayConfiguration tunnel CIDR conflict condition
+	SGCTunnelCidrConflictReasonPodCidrOverlap = "PodCidrOverlap"
+)
+
+const (
+	// StaticGatewayConfiguration condition type, false while Azure calls of the gateway are short-circuited by the
+	// circuit breaker of an Azure operation failing repeatedly
+	SGCAzureAvailableConditionType = "AzureAvailable"
+
+	// reason of StaticGatewayConfiguration Azure available condition
+	SGCAzureAvailableReasonCircuitOpen = "AzureCircuitOpen"
 )
 
 const (
 	KubeEgressCNIName     = "kube-egress-cni"
 	KubeEgressIPAMCNIName = "kube-egress-cni-ipam"
 )
+
+const (
+	// Default interval at which the manager and daemon resync all watched objects, re-reconciling every gateway and
+	// PodEndpoint so that drift from the applied configuration is corrected. It matches the controller-runtime default.
+	DefaultResyncPeriod = 10 * time.Hour
+
+	// Minimum resync interval, a shorter one re-reconciles all gateways faster than reconciles of large clusters
+	// complete and multiplies Azure requests of the manager
+	MinResyncPeriod = time.Minute
+)
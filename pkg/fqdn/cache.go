@@ -0,0 +1,128 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package fqdn
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+const (
+	// MinRefreshInterval is the lower bound of record TTL, to avoid hammering nameservers with short-lived records.
+	MinRefreshInterval = 30 * time.Second
+	// MaxRefreshInterval is the upper bound of record TTL, so that changes are picked up in time.
+	MaxRefreshInterval = 10 * time.Minute
+	// retryInterval is how long to wait before resolving a name again after failure.
+	retryInterval = 30 * time.Second
+)
+
+type entry struct {
+	ips    []net.IP
+	expiry time.Time
+}
+
+// Cache resolves FQDNs and keeps the results until their TTL expires.
+// When resolution fails, the last known good addresses are kept.
+type Cache struct {
+	lock     sync.Mutex
+	resolver Resolver
+	entries  map[string]*entry
+	now      func() time.Time
+}
+
+func NewCache(resolver Resolver) *Cache {
+	return &Cache{
+		resolver: resolver,
+		entries:  make(map[string]*entry),
+		now:      time.Now,
+	}
+}
+
+// Resolve returns the IPv4 addresses of the given FQDNs, and the duration after which
+// the earliest cached entry expires. Resolution errors are returned along with the
+// last known good addresses.
+func (c *Cache) Resolve(ctx context.Context, fqdns []string) ([]net.IP, time.Duration, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := c.now()
+	var ips []net.IP
+	var errs error
+	nextRefresh := MaxRefreshInterval
+	for _, fqdn := range fqdns {
+		e, ok := c.entries[fqdn]
+		if !ok || !now.Before(e.expiry) {
+			resolved, ttl, err := c.resolver.LookupIPv4(ctx, fqdn)
+			if err != nil {
+				errs = multierr.Append(errs, fmt.Errorf("failed to resolve %s: %w", fqdn, err))
+				if !ok {
+					e = &entry{}
+					c.entries[fqdn] = e
+				}
+				e.expiry = now.Add(retryInterval)
+			} else {
+				e = &entry{ips: resolved, expiry: now.Add(clampTTL(ttl))}
+				c.entries[fqdn] = e
+			}
+		}
+		ips = append(ips, e.ips...)
+		if d := e.expiry.Sub(now); d < nextRefresh {
+			nextRefresh = d
+		}
+	}
+	return ips, nextRefresh, errs
+}
+
+func clampTTL(ttl time.Duration) time.Duration {
+	if ttl < MinRefreshInterval {
+		return MinRefreshInterval
+	}
+	if ttl > MaxRefreshInterval {
+		return MaxRefreshInterval
+	}
+	return ttl
+}
+
+// ToExcludeCidrs converts resolved addresses to sorted and de-duplicated /32 CIDRs,
+// skipping those already covered by staticCidrs.
+func ToExcludeCidrs(ips []net.IP, staticCidrs []string) []string {
+	var staticNets []*net.IPNet
+	for _, cidr := range staticCidrs {
+		if _, ipNet, err := net.ParseCIDR(cidr); err == nil {
+			staticNets = append(staticNets, ipNet)
+		}
+	}
+
+	sorted := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		if ip = ip.To4(); ip != nil {
+			sorted = append(sorted, ip)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+
+	var cidrs []string
+	for i, ip := range sorted {
+		if i > 0 && ip.Equal(sorted[i-1]) {
+			continue
+		}
+		covered := false
+		for _, ipNet := range staticNets {
+			if ipNet.Contains(ip) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			cidrs = append(cidrs, ip.String()+"/32")
+		}
+	}
+	return cidrs
+}
@@ -0,0 +1,179 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package fqdn
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type fakeRecord struct {
+	ips []net.IP
+	ttl time.Duration
+	err error
+}
+
+type fakeResolver struct {
+	records map[string]fakeRecord
+	lookups map[string]int
+}
+
+func (r *fakeResolver) LookupIPv4(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	r.lookups[host]++
+	record := r.records[host]
+	return record.ips, record.ttl, record.err
+}
+
+func TestCacheResolve(t *testing.T) {
+	resolver := &fakeResolver{
+		records: map[string]fakeRecord{
+			"a.example.com": {ips: []net.IP{net.ParseIP("1.1.1.1")}, ttl: time.Minute},
+			"b.example.com": {ips: []net.IP{net.ParseIP("2.2.2.2"), net.ParseIP("3.3.3.3")}, ttl: 5 * time.Second},
+		},
+		lookups: make(map[string]int),
+	}
+	now := time.Now()
+	cache := NewCache(resolver)
+	cache.now = func() time.Time { return now }
+
+	ips, nextRefresh, err := cache.Resolve(context.Background(), []string{"a.example.com", "b.example.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, []net.IP{net.ParseIP("1.1.1.1"), net.ParseIP("2.2.2.2"), net.ParseIP("3.3.3.3")}, ips)
+	assert.Equal(t, MinRefreshInterval, nextRefresh, "short ttl should be clamped to MinRefreshInterval")
+
+	// cached entries are not resolved again before expiry
+	now = now.Add(10 * time.Second)
+	_, nextRefresh, err = cache.Resolve(context.Background(), []string{"a.example.com", "b.example.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, 20*time.Second, nextRefresh)
+	assert.Equal(t, 1, resolver.lookups["a.example.com"])
+	assert.Equal(t, 1, resolver.lookups["b.example.com"])
+
+	// expired entry is resolved again and keeps last known good addresses on failure
+	now = now.Add(20 * time.Second)
+	resolver.records["b.example.com"] = fakeRecord{err: errors.New("timeout")}
+	ips, nextRefresh, err = cache.Resolve(context.Background(), []string{"a.example.com", "b.example.com"})
+	assert.NotNil(t, err)
+	assert.Equal(t, []net.IP{net.ParseIP("1.1.1.1"), net.ParseIP("2.2.2.2"), net.ParseIP("3.3.3.3")}, ips)
+	assert.Equal(t, retryInterval, nextRefresh)
+	assert.Equal(t, 1, resolver.lookups["a.example.com"])
+	assert.Equal(t, 2, resolver.lookups["b.example.com"])
+
+	// name that never resolved returns no address
+	resolver.records["c.example.com"] = fakeRecord{err: errors.New("NXDOMAIN")}
+	ips, _, err = cache.Resolve(context.Background(), []string{"c.example.com"})
+	assert.NotNil(t, err)
+	assert.Empty(t, ips)
+}
+
+func TestToExcludeCidrs(t *testing.T) {
+	ips := []net.IP{
+		net.ParseIP("10.0.0.5"),
+		net.ParseIP("1.2.3.4"),
+		net.ParseIP("1.2.3.4"),
+		net.ParseIP("8.8.8.8"),
+		net.ParseIP("2001:db8::1"),
+	}
+	cidrs := ToExcludeCidrs(ips, []string{"10.0.0.0/16", "invalid"})
+	assert.Equal(t, []string{"1.2.3.4/32", "8.8.8.8/32"}, cidrs)
+	assert.Empty(t, ToExcludeCidrs(nil, nil))
+}
+
+func TestParseResponse(t *testing.T) {
+	name := dnsmessage.MustNewName("a.example.com.")
+	cname := dnsmessage.MustNewName("b.example.com.")
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 1234, Response: true})
+	assert.Nil(t, builder.StartQuestions())
+	assert.Nil(t, builder.Question(dnsmessage.Question{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}))
+	assert.Nil(t, builder.StartAnswers())
+	assert.Nil(t, builder.CNAMEResource(dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET, TTL: 300}, dnsmessage.CNAMEResource{CNAME: cname}))
+	assert.Nil(t, builder.AResource(dnsmessage.ResourceHeader{Name: cname, Class: dnsmessage.ClassINET, TTL: 60}, dnsmessage.AResource{A: [4]byte{1, 2, 3, 4}}))
+	resp, err := builder.Finish()
+	assert.Nil(t, err)
+
+	ips, ttl, err := parseResponse(resp, 1234, "a.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []net.IP{net.IPv4(1, 2, 3, 4)}, ips)
+	assert.Equal(t, time.Minute, ttl)
+
+	_, _, err = parseResponse(resp, 4321, "a.example.com")
+	assert.NotNil(t, err, "response with mismatched id should be rejected")
+}
+
+func TestLookupIPv4TCPFallback(t *testing.T) {
+	// listen on the same port over UDP and TCP, like a nameserver
+	var udpConn net.PacketConn
+	var tcpListener net.Listener
+	for i := 0; i < 10 && tcpListener == nil; i++ {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		listener, err := net.Listen("tcp", conn.LocalAddr().String())
+		if err != nil {
+			conn.Close()
+			continue
+		}
+		udpConn, tcpListener = conn, listener
+	}
+	if tcpListener == nil {
+		t.Skip("no port free for both UDP and TCP")
+	}
+	defer udpConn.Close()
+	defer tcpListener.Close()
+
+	answer := func(req []byte, truncated bool) []byte {
+		var parser dnsmessage.Parser
+		header, err := parser.Start(req)
+		assert.Nil(t, err)
+		question, err := parser.Question()
+		assert.Nil(t, err)
+		builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true, Truncated: truncated})
+		assert.Nil(t, builder.StartQuestions())
+		assert.Nil(t, builder.Question(question))
+		if !truncated {
+			assert.Nil(t, builder.StartAnswers())
+			assert.Nil(t, builder.AResource(dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: 60}, dnsmessage.AResource{A: [4]byte{1, 2, 3, 4}}))
+		}
+		resp, err := builder.Finish()
+		assert.Nil(t, err)
+		return resp
+	}
+	go func() {
+		buf := make([]byte, 512)
+		n, addr, err := udpConn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		_, _ = udpConn.WriteTo(answer(buf[:n], true), addr)
+	}()
+	go func() {
+		conn, err := tcpListener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		length := make([]byte, 2)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint16(length))
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+		resp := answer(req, false)
+		_, _ = conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...))
+	}()
+
+	r := &dnsResolver{nameservers: []string{udpConn.LocalAddr().String()}}
+	ips, ttl, err := r.LookupIPv4(context.Background(), "a.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []net.IP{net.IPv4(1, 2, 3, 4)}, ips)
+	assert.Equal(t, time.Minute, ttl)
+}
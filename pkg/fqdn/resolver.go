@@ -0,0 +1,214 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package fqdn
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/multierr"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	defaultResolvConf = "/etc/resolv.conf"
+	dnsPort           = "53"
+	queryTimeout      = 5 * time.Second
+)
+
+// errTruncated is returned when the nameserver sets the TC flag because the answer does not fit in a UDP message
+var errTruncated = errors.New("dns response truncated")
+
+// Resolver looks up IPv4 addresses of a domain name together with the record TTL.
+type Resolver interface {
+	LookupIPv4(ctx context.Context, host string) ([]net.IP, time.Duration, error)
+}
+
+type dnsResolver struct {
+	nameservers []string
+}
+
+// NewResolver creates a Resolver querying nameservers configured in /etc/resolv.conf.
+func NewResolver() (Resolver, error) {
+	nameservers, err := parseNameservers(defaultResolvConf)
+	if err != nil {
+		return nil, err
+	}
+	return &dnsResolver{nameservers: nameservers}, nil
+}
+
+func parseNameservers(resolvConf string) ([]string, error) {
+	file, err := os.Open(resolvConf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", resolvConf, err)
+	}
+	defer file.Close()
+
+	var nameservers []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" && net.ParseIP(fields[1]) != nil {
+			nameservers = append(nameservers, net.JoinHostPort(fields[1], dnsPort))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", resolvConf, err)
+	}
+	if len(nameservers) == 0 {
+		return nil, fmt.Errorf("no nameserver found in %s", resolvConf)
+	}
+	return nameservers, nil
+}
+
+func (r *dnsResolver) LookupIPv4(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	var errs error
+	for _, server := range r.nameservers {
+		ips, ttl, err := r.query(ctx, server, host)
+		if err == nil {
+			return ips, ttl, nil
+		}
+		errs = multierr.Append(errs, err)
+	}
+	return nil, 0, errs
+}
+
+func (r *dnsResolver) query(ctx context.Context, server, host string) ([]net.IP, time.Duration, error) {
+	name, err := dnsmessage.NewName(dnsName(host))
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid domain name %s: %w", host, err)
+	}
+	id := uint16(rand.Intn(1 << 16)) //nolint:gosec
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return nil, 0, err
+	}
+	if err := builder.Question(dnsmessage.Question{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, 0, err
+	}
+	req, err := builder.Finish()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	resp, err := exchange(ctx, "udp", server, req)
+	if err != nil {
+		return nil, 0, err
+	}
+	ips, ttl, err := parseResponse(resp, id, host)
+	if errors.Is(err, errTruncated) {
+		// the answer does not fit in a UDP message, retry over TCP like the system resolver
+		if resp, err = exchange(ctx, "tcp", server, req); err != nil {
+			return nil, 0, err
+		}
+		return parseResponse(resp, id, host)
+	}
+	return ips, ttl, err
+}
+
+// exchange sends req to the nameserver over network and returns the response, TCP messages are prefixed with their
+// two bytes length
+func exchange(ctx context.Context, network, server string, req []byte) ([]byte, error) {
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to contact nameserver %s: %w", server, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if network == "tcp" {
+		req = append(binary.BigEndian.AppendUint16(nil, uint16(len(req))), req...)
+	}
+	if _, err := conn.Write(req); err != nil {
+		return nil, fmt.Errorf("failed to send query to nameserver %s: %w", server, err)
+	}
+	if network == "tcp" {
+		length := make([]byte, 2)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return nil, fmt.Errorf("failed to read response from nameserver %s: %w", server, err)
+		}
+		resp := make([]byte, binary.BigEndian.Uint16(length))
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return nil, fmt.Errorf("failed to read response from nameserver %s: %w", server, err)
+		}
+		return resp, nil
+	}
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response from nameserver %s: %w", server, err)
+	}
+	return buf[:n], nil
+}
+
+// parseResponse returns A records in the response and the minimum TTL of the answer section
+func parseResponse(resp []byte, id uint16, host string) ([]net.IP, time.Duration, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(resp)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to parse dns response for %s: %w", host, err)
+	}
+	if header.ID != id || !header.Response {
+		return nil, 0, fmt.Errorf("unexpected dns response for %s", host)
+	}
+	if header.Truncated {
+		return nil, 0, fmt.Errorf("failed to resolve %s: %w", host, errTruncated)
+	}
+	if header.RCode != dnsmessage.RCodeSuccess {
+		return nil, 0, fmt.Errorf("failed to resolve %s: %s", host, header.RCode)
+	}
+	if err := parser.SkipAllQuestions(); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse dns response for %s: %w", host, err)
+	}
+
+	var ips []net.IP
+	var ttl uint32
+	for {
+		h, err := parser.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to parse dns response for %s: %w", host, err)
+		}
+		if ttl == 0 || h.TTL < ttl {
+			ttl = h.TTL
+		}
+		if h.Type != dnsmessage.TypeA || h.Class != dnsmessage.ClassINET {
+			if err := parser.SkipAnswer(); err != nil {
+				return nil, 0, fmt.Errorf("failed to parse dns response for %s: %w", host, err)
+			}
+			continue
+		}
+		a, err := parser.AResource()
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to parse dns response for %s: %w", host, err)
+		}
+		ips = append(ips, net.IPv4(a.A[0], a.A[1], a.A[2], a.A[3]))
+	}
+	if len(ips) == 0 {
+		return nil, 0, fmt.Errorf("no A record found for %s", host)
+	}
+	return ips, time.Duration(ttl) * time.Second, nil
+}
+
+func dnsName(host string) string {
+	if strings.HasSuffix(host, ".") {
+		return host
+	}
+	return host + "."
+}
@@ -0,0 +1,594 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+// Package gc finds Azure resources created by the controller manager for gateways that no longer exist, e.g. when
+// gateway configurations were force-deleted by removing their finalizers while the manager was down, and deletes
+// them on request. Writes are conditional on the etag read, so that they fail rather than overwrite changes the
+// running controller manager makes to the same VMSSes or load balancer meanwhile.
+package gc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+	network "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/azmanager"
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
+)
+
+const (
+	KindPublicIPPrefix = "PublicIPPrefix"
+	KindLBRule         = "LoadBalancingRule"
+	KindLBProbe        = "LoadBalancerProbe"
+	KindVMSSIPConfig   = "VMSSIPConfiguration"
+)
+
+var (
+	uidPattern = `[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`
+	// managed public ip prefixes and vmss ipConfigs are named after the UID of the gateway VM configuration, with a
+	// suffix for ipv6 and additional prefixes
+	managedPrefixNameRegex = regexp.MustCompile(`^` + consts.ManagedResourcePrefix + `(` + uidPattern + `)(` + consts.ManagedIPv6ResourceSuffix + `|-\d+)?$`)
+	// lb rules and probes are named after the UID of the gateway LB configuration
+	uidRegex = regexp.MustCompile(`^` + uidPattern + `$`)
+)
+
+// Orphan is an Azure resource owned by the controller manager whose gateway configuration no longer exists
+type Orphan struct {
+	Kind string
+	Name string
+	// SubscriptionID of the resource when it is in the gateway subscription of a StaticGatewayConfiguration, empty in
+	// the cluster subscription
+	SubscriptionID string
+	// ResourceGroup of the resource, or of the VMSS of an ipConfig, empty for rules and probes of the gateway load
+	// balancer of the cluster subscription
+	ResourceGroup string
+	// VMSS is the name of the VMSS an ipConfig belongs to
+	VMSS string
+	// Owner is the UID of the deleted gateway configuration
+	Owner string
+	// Skipped is the reason the orphan is not deleted, empty if it can be
+	Skipped string
+}
+
+// Report is the list of orphans found
+type Report []Orphan
+
+// Deletable returns the orphans that can be deleted
+func (r Report) Deletable() Report {
+	var deletable Report
+	for _, orphan := range r {
+		if orphan.Skipped == "" {
+			deletable = append(deletable, orphan)
+		}
+	}
+	return deletable
+}
+
+// Print writes one line per orphan and a summary to w
+func (r Report) Print(w io.Writer) {
+	for _, orphan := range r {
+		name := orphan.Name
+		if orphan.VMSS != "" {
+			name = orphan.VMSS + "/" + name
+		}
+		if orphan.ResourceGroup != "" {
+			name = orphan.ResourceGroup + "/" + name
+		}
+		if orphan.SubscriptionID != "" {
+			name = orphan.SubscriptionID + "/" + name
+		}
+		line := fmt.Sprintf("%s %s (owner %s)", orphan.Kind, name, orphan.Owner)
+		if orphan.Skipped != "" {
+			line += ", skipped: " + orphan.Skipped
+		}
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintf(w, "found %d orphaned resources, %d can be deleted\n", len(r), len(r.Deletable()))
+}
+
+// Collector finds and deletes orphans with the azure manager of the controller
+type Collector struct {
+	*azmanager.AzureManager
+	// Client reads gateway configurations of the cluster
+	Client client.Client
+	// VMSSResourceGroups are scanned for gateway VMSSes in addition to the resource group of the cloud config and
+	// those of existing gateways, e.g. resource groups of VMSSes only used by deleted gateways
+	VMSSResourceGroups []string
+}
+
+// Find lists managed public ip prefixes in the resource group of the cloud config, ipConfigs of VMSSes and their
+// instances in the resource groups scanned, and rules and probes of the gateway load balancer, and returns those
+// whose gateway configuration does not exist. The same resources are listed in the gateway subscriptions of existing
+// gateways, where managed prefixes and the gateway load balancer are in the resource group of the gateway VMSSes.
+// Azure resources are listed before gateway configurations, so that resources of gateways created meanwhile are not
+// reported.
+func (c *Collector) Find(ctx context.Context) (Report, error) {
+	// resource groups of VMSSes are read from existing gateways, before Azure resources are listed
+	scopes, err := c.getScopes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range scopes {
+		if err := s.list(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	vmConfigs := &egressgatewayv1alpha1.GatewayVMConfigurationList{}
+	if err := c.Client.List(ctx, vmConfigs); err != nil {
+		return nil, fmt.Errorf("failed to list GatewayVMConfigurations: %w", err)
+	}
+	vmConfigUIDs := sets.New[string]()
+	for _, vmConfig := range vmConfigs.Items {
+		vmConfigUIDs.Insert(string(vmConfig.GetUID()))
+	}
+	lbConfigs := &egressgatewayv1alpha1.GatewayLBConfigurationList{}
+	if err := c.Client.List(ctx, lbConfigs); err != nil {
+		return nil, fmt.Errorf("failed to list GatewayLBConfigurations: %w", err)
+	}
+	lbConfigUIDs := sets.New[string]()
+	for _, lbConfig := range lbConfigs.Items {
+		lbConfigUIDs.Insert(string(lbConfig.GetUID()))
+	}
+
+	var report Report
+	for _, s := range scopes {
+		report = append(report, s.findOrphans(vmConfigUIDs, lbConfigUIDs)...)
+	}
+	return report, nil
+}
+
+// Delete deletes deletable orphans of the report. VMSSes, their instances and the gateway load balancer are read
+// again, so that only orphaned ipConfigs, rules and probes are removed from their latest version, and are updated
+// with If-Match on the etag read, so that changes made meanwhile by the controller manager are not overwritten.
+// IpConfigs are deleted first, releasing the prefixes they use.
+func (c *Collector) Delete(ctx context.Context, report Report) error {
+	var errs []error
+	vmssOrphans := make(map[vmssKey]sets.Set[string])
+	lbOrphans := make(map[lbKey]sets.Set[string])
+	var prefixOrphans Report
+	for _, orphan := range report.Deletable() {
+		switch orphan.Kind {
+		case KindPublicIPPrefix:
+			prefixOrphans = append(prefixOrphans, orphan)
+		case KindVMSSIPConfig:
+			key := vmssKey{subscriptionID: orphan.SubscriptionID, resourceGroup: orphan.ResourceGroup, name: orphan.VMSS}
+			if vmssOrphans[key] == nil {
+				vmssOrphans[key] = sets.New[string]()
+			}
+			vmssOrphans[key].Insert(orphan.Name)
+		case KindLBRule, KindLBProbe:
+			key := lbKey{subscriptionID: orphan.SubscriptionID, resourceGroup: orphan.ResourceGroup}
+			if lbOrphans[key] == nil {
+				lbOrphans[key] = sets.New[string]()
+			}
+			lbOrphans[key].Insert(orphan.Kind + "/" + orphan.Name)
+		}
+	}
+	for key, ipConfigs := range vmssOrphans {
+		if err := c.deleteVMSSIPConfigs(ctx, key, ipConfigs); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, orphan := range prefixOrphans {
+		az, err := c.ForSubscription(orphan.SubscriptionID, orphan.ResourceGroup)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := az.DeletePublicIPPrefix(ctx, orphan.ResourceGroup, orphan.Name); err != nil && !errors.As(err, new(*azureclients.ErrNotFound)) {
+			errs = append(errs, fmt.Errorf("failed to delete public ip prefix %s: %w", orphan.Name, err))
+		}
+	}
+	for key, orphans := range lbOrphans {
+		if err := c.deleteLBRules(ctx, key, orphans); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deleteLBRules removes the orphaned rules and probes from the gateway load balancer of key, which is the one of the
+// AzureManager whose default resource group is the resource group of the load balancer in a gateway subscription
+func (c *Collector) deleteLBRules(ctx context.Context, key lbKey, orphans sets.Set[string]) error {
+	az, err := c.ForSubscription(key.subscriptionID, key.resourceGroup)
+	if err != nil {
+		return err
+	}
+	lb, err := getGatewayLB(ctx, az)
+	if err != nil || lb == nil || lb.Properties == nil {
+		return err
+	}
+	rules := slices.DeleteFunc(slices.Clone(lb.Properties.LoadBalancingRules), func(rule *network.LoadBalancingRule) bool {
+		return orphans.Has(KindLBRule + "/" + to.Val(rule.Name))
+	})
+	probes := slices.DeleteFunc(slices.Clone(lb.Properties.Probes), func(probe *network.Probe) bool {
+		return orphans.Has(KindLBProbe + "/" + to.Val(probe.Name))
+	})
+	if len(rules) == len(lb.Properties.LoadBalancingRules) && len(probes) == len(lb.Properties.Probes) {
+		return nil
+	}
+	lb.Properties.LoadBalancingRules = rules
+	lb.Properties.Probes = probes
+	if _, err := az.CreateOrUpdateLB(withIfMatch(ctx, lb.Etag), *lb); err != nil {
+		return fmt.Errorf("failed to delete rules and probes of load balancer %s: %w", to.Val(lb.Name), err)
+	}
+	return nil
+}
+
+// deleteVMSSIPConfigs removes the orphaned ipConfigs from the VMSS model and from each of its instances
+func (c *Collector) deleteVMSSIPConfigs(ctx context.Context, key vmssKey, ipConfigs sets.Set[string]) error {
+	az, err := c.ForSubscription(key.subscriptionID, key.resourceGroup)
+	if err != nil {
+		return err
+	}
+	vmss, err := az.GetVMSS(ctx, key.resourceGroup, key.name)
+	if err != nil {
+		if errors.As(err, new(*azureclients.ErrNotFound)) {
+			return nil
+		}
+		return fmt.Errorf("failed to get vmss %s/%s: %w", key.resourceGroup, key.name, err)
+	}
+	if vmss.Properties != nil && vmss.Properties.VirtualMachineProfile != nil && vmss.Properties.VirtualMachineProfile.NetworkProfile != nil &&
+		removeIPConfigs(vmss.Properties.VirtualMachineProfile.NetworkProfile.NetworkInterfaceConfigurations, ipConfigs) {
+		newVMSS := compute.VirtualMachineScaleSet{
+			Location: vmss.Location,
+			Properties: &compute.VirtualMachineScaleSetProperties{
+				VirtualMachineProfile: &compute.VirtualMachineScaleSetVMProfile{
+					NetworkProfile: vmss.Properties.VirtualMachineProfile.NetworkProfile,
+				},
+			},
+		}
+		if _, err := az.CreateOrUpdateVMSS(withIfMatch(ctx, vmss.Etag), key.resourceGroup, key.name, newVMSS); err != nil {
+			return fmt.Errorf("failed to delete ipConfigs of vmss %s/%s: %w", key.resourceGroup, key.name, err)
+		}
+	}
+
+	instances, err := az.ListVMSSInstances(ctx, key.resourceGroup, key.name)
+	if err != nil {
+		return fmt.Errorf("failed to list instances of vmss %s/%s: %w", key.resourceGroup, key.name, err)
+	}
+	var errs []error
+	for _, instance := range instances {
+		if instance.Properties == nil || instance.Properties.NetworkProfileConfiguration == nil {
+			continue
+		}
+		interfaces := instance.Properties.NetworkProfileConfiguration.NetworkInterfaceConfigurations
+		if !removeIPConfigs(interfaces, ipConfigs) {
+			continue
+		}
+		newVM := compute.VirtualMachineScaleSetVM{
+			Properties: &compute.VirtualMachineScaleSetVMProperties{
+				NetworkProfileConfiguration: &compute.VirtualMachineScaleSetVMNetworkProfileConfiguration{
+					NetworkInterfaceConfigurations: interfaces,
+				},
+			},
+		}
+		if _, err := az.UpdateVMSSInstance(withIfMatch(ctx, instance.Etag), key.resourceGroup, key.name, to.Val(instance.InstanceID), newVM); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete ipConfigs of vmss %s/%s instance %s: %w", key.resourceGroup, key.name, to.Val(instance.InstanceID), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// scope is the AzureManager of the cluster subscription or of a gateway subscription, with the resource groups of
+// its subscription scanned for gateway VMSSes and the Azure resources listed there
+type scope struct {
+	az *azmanager.AzureManager
+	// subscriptionID is empty for the cluster subscription
+	subscriptionID     string
+	vmssResourceGroups []string
+
+	prefixes      []*network.PublicIPPrefix
+	vmssIPConfigs map[vmssKey][]string
+	lb            *network.LoadBalancer
+}
+
+// getScopes returns the cluster subscription scope, with the resource group of the cloud config, those of VMSSes
+// referenced by existing gateways in the cluster subscription, and VMSSResourceGroups, followed by a scope per
+// gateway subscription and resource group of the managed prefixes of existing gateways, with the resource groups of
+// their VMSSes. Each resource group of a subscription is scanned once.
+func (c *Collector) getScopes(ctx context.Context) ([]*scope, error) {
+	gwConfigs := &egressgatewayv1alpha1.StaticGatewayConfigurationList{}
+	if err := c.Client.List(ctx, gwConfigs); err != nil {
+		return nil, fmt.Errorf("failed to list StaticGatewayConfigurations: %w", err)
+	}
+	clusterScope := &scope{az: c.AzureManager}
+	scopes := []*scope{clusterScope}
+	// resource group names are case-insensitive
+	seen := sets.New[string]()
+	addResourceGroup := func(s *scope, resourceGroup string) {
+		key := strings.ToLower(s.subscriptionID + "/" + resourceGroup)
+		if resourceGroup != "" && !seen.Has(key) {
+			seen.Insert(key)
+			s.vmssResourceGroups = append(s.vmssResourceGroups, resourceGroup)
+		}
+	}
+	addResourceGroup(clusterScope, c.ResourceGroup)
+	for _, gwConfig := range gwConfigs.Items {
+		refs := gwConfig.Spec.GatewayVmssProfile.VmssReferences()
+		s := clusterScope
+		if subscriptionID := gwConfig.Spec.GatewayVmssProfile.SubscriptionId; subscriptionID != "" && !strings.EqualFold(subscriptionID, c.SubscriptionID()) {
+			// the controller manager creates managed prefixes and the gateway load balancer in the resource group of
+			// the first VMSS
+			var resourceGroup string
+			if len(refs) > 0 {
+				resourceGroup = refs[0].VmssResourceGroup
+			}
+			az, err := c.ForSubscription(subscriptionID, resourceGroup)
+			if err != nil {
+				return nil, err
+			}
+			s = getScope(scopes, az)
+			if s == nil {
+				s = &scope{az: az, subscriptionID: az.SubscriptionID()}
+				scopes = append(scopes, s)
+			}
+		}
+		for _, ref := range refs {
+			addResourceGroup(s, ref.VmssResourceGroup)
+		}
+	}
+	for _, resourceGroup := range c.VMSSResourceGroups {
+		addResourceGroup(clusterScope, resourceGroup)
+	}
+	return scopes, nil
+}
+
+// getScope returns the scope of az in scopes, nil if there is none
+func getScope(scopes []*scope, az *azmanager.AzureManager) *scope {
+	for _, s := range scopes {
+		if s.az == az {
+			return s
+		}
+	}
+	return nil
+}
+
+// list lists managed public ip prefixes in the resource group of the scope manager, ipConfigs of VMSSes in the
+// resource groups scanned and the gateway load balancer
+func (s *scope) list(ctx context.Context) error {
+	var err error
+	if s.prefixes, err = s.az.ListPublicIPPrefixes(ctx, ""); err != nil {
+		return fmt.Errorf("failed to list public ip prefixes of resource group %s: %w", s.az.ResourceGroup, err)
+	}
+	if s.vmssIPConfigs, err = s.listVMSSIPConfigs(ctx); err != nil {
+		return err
+	}
+	s.lb, err = getGatewayLB(ctx, s.az)
+	return err
+}
+
+// findOrphans returns the listed resources of deleted gateway configurations
+func (s *scope) findOrphans(vmConfigUIDs, lbConfigUIDs sets.Set[string]) Report {
+	report := findOrphanedPrefixes(s.az.ResourceGroup, s.prefixes, vmConfigUIDs)
+	report = append(report, findOrphanedVMSSIPConfigs(s.vmssIPConfigs, vmConfigUIDs)...)
+	var lbReport Report
+	if s.lb != nil {
+		lbReport = findOrphanedLBRules(s.lb, lbConfigUIDs)
+	}
+	if s.subscriptionID != "" {
+		// the load balancer of a gateway subscription is found again with the resource group
+		for i := range lbReport {
+			lbReport[i].ResourceGroup = s.az.LoadBalancerResourceGroup
+		}
+	}
+	report = append(report, lbReport...)
+	for i := range report {
+		report[i].SubscriptionID = s.subscriptionID
+	}
+	return report
+}
+
+type vmssKey struct {
+	// subscriptionID is empty for the cluster subscription
+	subscriptionID string
+	resourceGroup  string
+	name           string
+}
+
+// lbKey is the gateway load balancer of the cluster subscription when empty, or the one in resourceGroup of a gateway
+// subscription
+type lbKey struct {
+	subscriptionID string
+	resourceGroup  string
+}
+
+// listVMSSIPConfigs returns names of the ipConfigs of each VMSS in the resource groups scanned, merged from the VMSS
+// model and its instances, as an ipConfig may be left on instances after it is removed from the model
+func (s *scope) listVMSSIPConfigs(ctx context.Context) (map[vmssKey][]string, error) {
+	ipConfigs := make(map[vmssKey][]string)
+	for _, resourceGroup := range s.vmssResourceGroups {
+		vmssList, err := s.az.ListVMSS(ctx, resourceGroup)
+		if err != nil {
+			if errors.As(err, new(*azureclients.ErrNotFound)) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to list vmsses of resource group %s: %w", resourceGroup, err)
+		}
+		for _, vmss := range vmssList {
+			key := vmssKey{subscriptionID: s.subscriptionID, resourceGroup: resourceGroup, name: to.Val(vmss.Name)}
+			if vmss.Properties != nil && vmss.Properties.VirtualMachineProfile != nil && vmss.Properties.VirtualMachineProfile.NetworkProfile != nil {
+				ipConfigs[key] = appendIPConfigNames(ipConfigs[key], vmss.Properties.VirtualMachineProfile.NetworkProfile.NetworkInterfaceConfigurations)
+			}
+			instances, err := s.az.ListVMSSInstances(ctx, resourceGroup, key.name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list instances of vmss %s/%s: %w", resourceGroup, key.name, err)
+			}
+			for _, instance := range instances {
+				if instance.Properties != nil && instance.Properties.NetworkProfileConfiguration != nil {
+					ipConfigs[key] = appendIPConfigNames(ipConfigs[key], instance.Properties.NetworkProfileConfiguration.NetworkInterfaceConfigurations)
+				}
+			}
+		}
+	}
+	return ipConfigs, nil
+}
+
+// appendIPConfigNames appends names of the ipConfigs of interfaces not in names yet
+func appendIPConfigNames(names []string, interfaces []*compute.VirtualMachineScaleSetNetworkConfiguration) []string {
+	for _, nic := range interfaces {
+		if nic == nil || nic.Properties == nil {
+			continue
+		}
+		for _, ipConfig := range nic.Properties.IPConfigurations {
+			if name := to.Val(ipConfig.Name); name != "" && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// removeIPConfigs removes the named ipConfigs from interfaces, returns whether any was removed
+func removeIPConfigs(interfaces []*compute.VirtualMachineScaleSetNetworkConfiguration, names sets.Set[string]) bool {
+	removed := false
+	for _, nic := range interfaces {
+		if nic == nil || nic.Properties == nil {
+			continue
+		}
+		ipConfigs := slices.DeleteFunc(nic.Properties.IPConfigurations, func(ipConfig *compute.VirtualMachineScaleSetIPConfiguration) bool {
+			return names.Has(to.Val(ipConfig.Name))
+		})
+		removed = removed || len(ipConfigs) != len(nic.Properties.IPConfigurations)
+		nic.Properties.IPConfigurations = ipConfigs
+	}
+	return removed
+}
+
+// withIfMatch makes the Azure write with ctx fail instead of overwriting a resource changed since etag was read
+func withIfMatch(ctx context.Context, etag *string) context.Context {
+	if to.Val(etag) == "" {
+		return ctx
+	}
+	return policy.WithHTTPHeader(ctx, http.Header{"If-Match": []string{to.Val(etag)}})
+}
+
+func getGatewayLB(ctx context.Context, az *azmanager.AzureManager) (*network.LoadBalancer, error) {
+	lb, err := az.GetLB(ctx)
+	if err != nil {
+		if errors.As(err, new(*azureclients.ErrNotFound)) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get load balancer %s: %w", az.LoadBalancerName(), err)
+	}
+	return lb, nil
+}
+
+// findOrphanedPrefixes returns managed public ip prefixes of deleted gateway VM configurations in resourceGroup.
+// Prefixes still used by a NAT gateway or an ip configuration other than the orphaned ipConfigs of the same gateway
+// cannot be deleted, nor are reusable prefixes left for a gateway recreated with the same name.
+func findOrphanedPrefixes(resourceGroup string, prefixes []*network.PublicIPPrefix, vmConfigUIDs sets.Set[string]) Report {
+	var report Report
+	for _, prefix := range prefixes {
+		name := to.Val(prefix.Name)
+		if !strings.HasPrefix(name, consts.ManagedResourcePrefix) {
+			continue
+		}
+		owner := getTagValue(prefix.Tags, consts.PublicIPPrefixOwnerTagKey)
+		if matches := managedPrefixNameRegex.FindStringSubmatch(name); matches != nil && owner == "" {
+			owner = matches[1]
+		}
+		if owner == "" || vmConfigUIDs.Has(owner) {
+			continue
+		}
+		orphan := Orphan{Kind: KindPublicIPPrefix, Name: name, ResourceGroup: resourceGroup, Owner: owner}
+		if gateway := getTagValue(prefix.Tags, consts.PublicIPPrefixGatewayTagKey); gateway != "" {
+			orphan.Skipped = fmt.Sprintf("kept for reuse by gateway %s", gateway)
+		} else if prefix.Properties != nil && (prefix.Properties.NatGateway != nil || !usedByOwnerIPConfigsOnly(prefix.Properties.PublicIPAddresses, owner)) {
+			orphan.Skipped = "still in use"
+		}
+		report = append(report, orphan)
+	}
+	return report
+}
+
+// usedByOwnerIPConfigsOnly returns whether all public ip addresses are those of vmss ipConfigs named after owner,
+// which are deleted along with the prefix
+func usedByOwnerIPConfigsOnly(addresses []*network.ReferencedPublicIPAddress, owner string) bool {
+	for _, address := range addresses {
+		// vmss public ip addresses are subresources of the instance ipConfig
+		_, ipConfig, found := strings.Cut(strings.ToLower(to.Val(address.ID)), "/ipconfigurations/")
+		ipConfig, _, _ = strings.Cut(ipConfig, "/")
+		matches := managedPrefixNameRegex.FindStringSubmatch(ipConfig)
+		if !found || matches == nil || matches[1] != owner {
+			return false
+		}
+	}
+	return true
+}
+
+// findOrphanedVMSSIPConfigs returns ipConfigs of deleted gateway VM configurations, other ipConfigs are ignored
+func findOrphanedVMSSIPConfigs(vmssIPConfigs map[vmssKey][]string, vmConfigUIDs sets.Set[string]) Report {
+	var report Report
+	for key, ipConfigs := range vmssIPConfigs {
+		for _, name := range ipConfigs {
+			matches := managedPrefixNameRegex.FindStringSubmatch(name)
+			if matches == nil || vmConfigUIDs.Has(matches[1]) {
+				continue
+			}
+			report = append(report, Orphan{Kind: KindVMSSIPConfig, Name: name, ResourceGroup: key.resourceGroup, VMSS: key.name, Owner: matches[1]})
+		}
+	}
+	// map iteration order is random, keep the report stable
+	slices.SortFunc(report, func(a, b Orphan) int {
+		return strings.Compare(a.ResourceGroup+"/"+a.VMSS+"/"+a.Name, b.ResourceGroup+"/"+b.VMSS+"/"+b.Name)
+	})
+	return report
+}
+
+// findOrphanedLBRules returns rules and probes of deleted gateway LB configurations. Both are named after the LB
+// configuration UID, other rules and probes of an existing load balancer are ignored.
+func findOrphanedLBRules(lb *network.LoadBalancer, lbConfigUIDs sets.Set[string]) Report {
+	if lb.Properties == nil {
+		return nil
+	}
+	var report Report
+	for _, rule := range lb.Properties.LoadBalancingRules {
+		name := to.Val(rule.Name)
+		if !uidRegex.MatchString(name) || lbConfigUIDs.Has(name) ||
+			rule.Properties == nil || rule.Properties.Probe == nil || !strings.HasSuffix(to.Val(rule.Properties.Probe.ID), "/"+name) {
+			continue
+		}
+		report = append(report, Orphan{Kind: KindLBRule, Name: name, Owner: name})
+	}
+	for _, probe := range lb.Properties.Probes {
+		name := to.Val(probe.Name)
+		if !uidRegex.MatchString(name) || lbConfigUIDs.Has(name) {
+			continue
+		}
+		// probes of gateways are only referenced by the rule of the same name, which may be deleted already
+		if slices.ContainsFunc(lb.Properties.LoadBalancingRules, func(rule *network.LoadBalancingRule) bool {
+			return to.Val(rule.Name) != name && rule.Properties != nil && rule.Properties.Probe != nil &&
+				strings.HasSuffix(to.Val(rule.Properties.Probe.ID), "/"+name)
+		}) {
+			continue
+		}
+		report = append(report, Orphan{Kind: KindLBProbe, Name: name, Owner: name})
+	}
+	return report
+}
+
+// getTagValue returns value of the tag, Azure tag names are case-insensitive
+func getTagValue(tags map[string]*string, key string) string {
+	for k, v := range tags {
+		if strings.EqualFold(k, key) {
+			return to.Val(v)
+		}
+	}
+	return ""
+}
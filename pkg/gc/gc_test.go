@@ -0,0 +1,369 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package gc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	azruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+	network "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/interfaceclient/mock_interfaceclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/loadbalancerclient/mock_loadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/mock_azclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/publicipaddressclient/mock_publicipaddressclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/publicipprefixclient/mock_publicipprefixclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/subnetclient/mock_subnetclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetclient/mock_virtualmachinescalesetclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetvmclient/mock_virtualmachinescalesetvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualnetworkclient/mock_virtualnetworkclient"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/azmanager"
+	"github.com/Azure/kube-egress-gateway/pkg/config"
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
+)
+
+const (
+	activeUID  = "11111111-1111-1111-1111-111111111111"
+	deletedUID = "22222222-2222-2222-2222-222222222222"
+	probeIDFmt = "/subscriptions/testSub/resourceGroups/lbRG/providers/Microsoft.Network/loadBalancers/testLB/probes/"
+	pipIDFmt   = "/subscriptions/testSub/resourceGroups/testRG/providers/Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/0/networkInterfaces/nic/ipConfigurations/%s/publicIPAddresses/pip"
+)
+
+func TestFind(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	c := getTestCollector(ctrl)
+	mockPrefixClient := c.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+	mockPrefixClient.EXPECT().List(gomock.Any(), "testRG").Return([]*network.PublicIPPrefix{
+		{Name: to.Ptr("egressgateway-" + activeUID)},
+		{Name: to.Ptr("egressgateway-" + deletedUID)},
+		{Name: to.Ptr("egressgateway-" + deletedUID + "-ipv6"), Properties: &network.PublicIPPrefixPropertiesFormat{
+			PublicIPAddresses: []*network.ReferencedPublicIPAddress{{ID: to.Ptr("ip")}},
+		}},
+		{Name: to.Ptr("egressgateway-" + deletedUID + "-1"), Properties: &network.PublicIPPrefixPropertiesFormat{
+			PublicIPAddresses: []*network.ReferencedPublicIPAddress{{ID: to.Ptr(fmt.Sprintf(pipIDFmt, "egressgateway-"+deletedUID+"-1"))}},
+		}},
+		{Name: to.Ptr("egressgateway-0123456789abcdef0123456789abcdef"), Tags: map[string]*string{
+			consts.PublicIPPrefixGatewayTagKey: to.Ptr("ns/gw"),
+			consts.PublicIPPrefixOwnerTagKey:   to.Ptr(deletedUID),
+		}},
+		{Name: to.Ptr("user-prefix")},
+	}, nil)
+	mockVMSSClient := c.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+	mockVMSSClient.EXPECT().List(gomock.Any(), "testRG").Return([]*compute.VirtualMachineScaleSet{
+		getTestVMSS("vmss", "primary", "egressgateway-"+activeUID, "egressgateway-"+deletedUID),
+	}, nil)
+	mockVMSSClient.EXPECT().List(gomock.Any(), "gwRG").Return(nil, nil)
+	mockVMSSClient.EXPECT().List(gomock.Any(), "extraRG").Return([]*compute.VirtualMachineScaleSet{getTestVMSS("vmss2", "primary")}, nil)
+	mockVMSSVMClient := c.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface)
+	// the ipConfig removed from the vmss model is still left on its instance
+	mockVMSSVMClient.EXPECT().List(gomock.Any(), "testRG", "vmss").Return([]*compute.VirtualMachineScaleSetVM{
+		getTestVMSSVM("0", "primary", "egressgateway-"+deletedUID, "egressgateway-"+deletedUID+"-1"),
+	}, nil)
+	mockVMSSVMClient.EXPECT().List(gomock.Any(), "extraRG", "vmss2").Return(nil, nil)
+	mockLBClient := c.LoadBalancerClient.(*mock_loadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().Get(gomock.Any(), "lbRG", "testLB", nil).Return(getTestLB(), nil)
+
+	report, err := c.Find(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, Report{
+		{Kind: KindPublicIPPrefix, Name: "egressgateway-" + deletedUID, ResourceGroup: "testRG", Owner: deletedUID},
+		{Kind: KindPublicIPPrefix, Name: "egressgateway-" + deletedUID + "-ipv6", ResourceGroup: "testRG", Owner: deletedUID, Skipped: "still in use"},
+		{Kind: KindPublicIPPrefix, Name: "egressgateway-" + deletedUID + "-1", ResourceGroup: "testRG", Owner: deletedUID},
+		{Kind: KindPublicIPPrefix, Name: "egressgateway-0123456789abcdef0123456789abcdef", ResourceGroup: "testRG", Owner: deletedUID, Skipped: "kept for reuse by gateway ns/gw"},
+		{Kind: KindVMSSIPConfig, Name: "egressgateway-" + deletedUID, ResourceGroup: "testRG", VMSS: "vmss", Owner: deletedUID},
+		{Kind: KindVMSSIPConfig, Name: "egressgateway-" + deletedUID + "-1", ResourceGroup: "testRG", VMSS: "vmss", Owner: deletedUID},
+		{Kind: KindLBRule, Name: deletedUID, Owner: deletedUID},
+		{Kind: KindLBProbe, Name: deletedUID, Owner: deletedUID},
+	}, report)
+}
+
+func TestDelete(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	c := getTestCollector(ctrl)
+	report := Report{
+		{Kind: KindPublicIPPrefix, Name: "egressgateway-" + deletedUID, ResourceGroup: "testRG", Owner: deletedUID},
+		{Kind: KindPublicIPPrefix, Name: "egressgateway-" + deletedUID + "-ipv6", ResourceGroup: "testRG", Owner: deletedUID, Skipped: "still in use"},
+		{Kind: KindVMSSIPConfig, Name: "egressgateway-" + deletedUID, ResourceGroup: "testRG", VMSS: "vmss", Owner: deletedUID},
+		{Kind: KindVMSSIPConfig, Name: "egressgateway-" + deletedUID + "-1", ResourceGroup: "testRG", VMSS: "vmss", Owner: deletedUID},
+		{Kind: KindLBRule, Name: deletedUID, Owner: deletedUID},
+		{Kind: KindLBProbe, Name: deletedUID, Owner: deletedUID},
+	}
+	// ipConfigs are deleted before the prefixes they use
+	mockVMSSClient := c.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+	mockVMSSClient.EXPECT().Get(gomock.Any(), "testRG", "vmss", gomock.Any()).Return(getTestVMSS("vmss", "primary", "egressgateway-"+activeUID, "egressgateway-"+deletedUID), nil)
+	updateVMSS := mockVMSSClient.EXPECT().CreateOrUpdate(gomock.Any(), "testRG", "vmss", gomock.Any()).DoAndReturn(
+		func(ctx context.Context, _, _ string, vmss compute.VirtualMachineScaleSet) (*compute.VirtualMachineScaleSet, error) {
+			assert.Equal(t, "vmss-etag", getIfMatch(ctx))
+			assert.Equal(t, []string{"primary", "egressgateway-" + activeUID}, getIPConfigNames(vmss.Properties.VirtualMachineProfile.NetworkProfile.NetworkInterfaceConfigurations))
+			return &vmss, nil
+		})
+	mockVMSSVMClient := c.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface)
+	mockVMSSVMClient.EXPECT().List(gomock.Any(), "testRG", "vmss").Return([]*compute.VirtualMachineScaleSetVM{
+		getTestVMSSVM("0", "primary", "egressgateway-"+deletedUID, "egressgateway-"+deletedUID+"-1"),
+		getTestVMSSVM("1", "primary"),
+	}, nil).After(updateVMSS)
+	updateVM := mockVMSSVMClient.EXPECT().Update(gomock.Any(), "testRG", "vmss", "0", gomock.Any()).DoAndReturn(
+		func(ctx context.Context, _, _, _ string, vm compute.VirtualMachineScaleSetVM) (*compute.VirtualMachineScaleSetVM, error) {
+			assert.Equal(t, "vm-etag", getIfMatch(ctx))
+			assert.Equal(t, []string{"primary"}, getIPConfigNames(vm.Properties.NetworkProfileConfiguration.NetworkInterfaceConfigurations))
+			return &vm, nil
+		})
+	mockPrefixClient := c.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface)
+	mockPrefixClient.EXPECT().Delete(gomock.Any(), "testRG", "egressgateway-"+deletedUID).Return(nil).After(updateVM)
+	mockLBClient := c.LoadBalancerClient.(*mock_loadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().Get(gomock.Any(), "lbRG", "testLB", nil).Return(getTestLB(), nil)
+	mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "lbRG", "testLB", gomock.Any()).DoAndReturn(
+		func(ctx context.Context, _, _ string, lb network.LoadBalancer) (*network.LoadBalancer, error) {
+			// the load balancer is only updated if unchanged since read
+			assert.Equal(t, "lb-etag", getIfMatch(ctx))
+			var rules, probes []string
+			for _, rule := range lb.Properties.LoadBalancingRules {
+				rules = append(rules, to.Val(rule.Name))
+			}
+			for _, probe := range lb.Properties.Probes {
+				probes = append(probes, to.Val(probe.Name))
+			}
+			assert.Equal(t, []string{activeUID, "user-rule"}, rules)
+			assert.Equal(t, []string{activeUID, "user-probe"}, probes)
+			return &lb, nil
+		})
+	assert.Nil(t, c.Delete(context.Background(), report))
+}
+
+func TestFindInGatewaySubscription(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	c := getTestCollector(ctrl)
+	sub := addGatewaySubscription(t, c)
+	c.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface).EXPECT().List(gomock.Any(), "testRG").Return(nil, nil)
+	mockVMSSClient := c.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+	for _, resourceGroup := range []string{"testRG", "gwRG", "extraRG"} {
+		mockVMSSClient.EXPECT().List(gomock.Any(), resourceGroup).Return(nil, nil)
+	}
+	c.LoadBalancerClient.(*mock_loadbalancerclient.MockInterface).EXPECT().Get(gomock.Any(), "lbRG", "testLB", nil).Return(&network.LoadBalancer{}, nil)
+
+	// managed prefixes and the gateway load balancer are in the resource group of the gateway VMSS
+	sub.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface).EXPECT().List(gomock.Any(), "gwSubRG").Return([]*network.PublicIPPrefix{
+		{Name: to.Ptr("egressgateway-" + activeUID)},
+		{Name: to.Ptr("egressgateway-" + deletedUID)},
+	}, nil)
+	sub.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface).EXPECT().List(gomock.Any(), "gwSubRG").Return([]*compute.VirtualMachineScaleSet{
+		getTestVMSS("subVMSS", "primary", "egressgateway-"+activeUID, "egressgateway-"+deletedUID),
+	}, nil)
+	sub.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface).EXPECT().List(gomock.Any(), "gwSubRG", "subVMSS").Return(nil, nil)
+	sub.LoadBalancerClient.(*mock_loadbalancerclient.MockInterface).EXPECT().Get(gomock.Any(), "gwSubRG", "testLB", nil).Return(getTestLB(), nil)
+
+	report, err := c.Find(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, Report{
+		{Kind: KindPublicIPPrefix, Name: "egressgateway-" + deletedUID, SubscriptionID: "gwSub", ResourceGroup: "gwSubRG", Owner: deletedUID},
+		{Kind: KindVMSSIPConfig, Name: "egressgateway-" + deletedUID, SubscriptionID: "gwSub", ResourceGroup: "gwSubRG", VMSS: "subVMSS", Owner: deletedUID},
+		{Kind: KindLBRule, Name: deletedUID, SubscriptionID: "gwSub", ResourceGroup: "gwSubRG", Owner: deletedUID},
+		{Kind: KindLBProbe, Name: deletedUID, SubscriptionID: "gwSub", ResourceGroup: "gwSubRG", Owner: deletedUID},
+	}, report)
+}
+
+func TestDeleteInGatewaySubscription(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	c := getTestCollector(ctrl)
+	sub := addGatewaySubscription(t, c)
+	report := Report{
+		{Kind: KindPublicIPPrefix, Name: "egressgateway-" + deletedUID, SubscriptionID: "gwSub", ResourceGroup: "gwSubRG", Owner: deletedUID},
+		{Kind: KindVMSSIPConfig, Name: "egressgateway-" + deletedUID, SubscriptionID: "gwSub", ResourceGroup: "gwSubRG", VMSS: "subVMSS", Owner: deletedUID},
+		{Kind: KindLBRule, Name: deletedUID, SubscriptionID: "gwSub", ResourceGroup: "gwSubRG", Owner: deletedUID},
+		{Kind: KindLBProbe, Name: deletedUID, SubscriptionID: "gwSub", ResourceGroup: "gwSubRG", Owner: deletedUID},
+	}
+	// the orphans are deleted with the clients of the gateway subscription, none of the cluster subscription is called
+	mockVMSSClient := sub.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+	mockVMSSClient.EXPECT().Get(gomock.Any(), "gwSubRG", "subVMSS", gomock.Any()).Return(getTestVMSS("subVMSS", "primary", "egressgateway-"+deletedUID), nil)
+	updateVMSS := mockVMSSClient.EXPECT().CreateOrUpdate(gomock.Any(), "gwSubRG", "subVMSS", gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, _ string, vmss compute.VirtualMachineScaleSet) (*compute.VirtualMachineScaleSet, error) {
+			assert.Equal(t, []string{"primary"}, getIPConfigNames(vmss.Properties.VirtualMachineProfile.NetworkProfile.NetworkInterfaceConfigurations))
+			return &vmss, nil
+		})
+	sub.VmssVMClient.(*mock_virtualmachinescalesetvmclient.MockInterface).EXPECT().List(gomock.Any(), "gwSubRG", "subVMSS").Return(nil, nil).After(updateVMSS)
+	sub.PublicIPPrefixClient.(*mock_publicipprefixclient.MockInterface).EXPECT().Delete(gomock.Any(), "gwSubRG", "egressgateway-"+deletedUID).Return(nil).After(updateVMSS)
+	mockLBClient := sub.LoadBalancerClient.(*mock_loadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().Get(gomock.Any(), "gwSubRG", "testLB", nil).Return(getTestLB(), nil)
+	mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "gwSubRG", "testLB", gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, _ string, lb network.LoadBalancer) (*network.LoadBalancer, error) {
+			assert.Len(t, lb.Properties.LoadBalancingRules, 2)
+			assert.Len(t, lb.Properties.Probes, 2)
+			return &lb, nil
+		})
+	assert.Nil(t, c.Delete(context.Background(), report))
+}
+
+func TestPrint(t *testing.T) {
+	buf := &bytes.Buffer{}
+	Report{
+		{Kind: KindLBRule, Name: deletedUID, Owner: deletedUID},
+		{Kind: KindPublicIPPrefix, Name: "egressgateway-" + deletedUID, ResourceGroup: "testRG", Owner: deletedUID, Skipped: "still in use"},
+		{Kind: KindVMSSIPConfig, Name: "egressgateway-" + deletedUID, ResourceGroup: "testRG", VMSS: "vmss", Owner: deletedUID},
+		{Kind: KindLBProbe, Name: deletedUID, SubscriptionID: "gwSub", ResourceGroup: "gwSubRG", Owner: deletedUID},
+	}.Print(buf)
+	assert.Equal(t, "LoadBalancingRule "+deletedUID+" (owner "+deletedUID+")\n"+
+		"PublicIPPrefix testRG/egressgateway-"+deletedUID+" (owner "+deletedUID+"), skipped: still in use\n"+
+		"VMSSIPConfiguration testRG/vmss/egressgateway-"+deletedUID+" (owner "+deletedUID+")\n"+
+		"LoadBalancerProbe gwSub/gwSubRG/"+deletedUID+" (owner "+deletedUID+")\n"+
+		"found 4 orphaned resources, 3 can be deleted\n", buf.String())
+}
+
+func getTestLB() *network.LoadBalancer {
+	rule := func(name, probe string) *network.LoadBalancingRule {
+		return &network.LoadBalancingRule{
+			Name: to.Ptr(name),
+			Properties: &network.LoadBalancingRulePropertiesFormat{
+				Probe: &network.SubResource{ID: to.Ptr(probeIDFmt + probe)},
+			},
+		}
+	}
+	return &network.LoadBalancer{
+		Name: to.Ptr("testLB"),
+		Etag: to.Ptr("lb-etag"),
+		Properties: &network.LoadBalancerPropertiesFormat{
+			LoadBalancingRules: []*network.LoadBalancingRule{rule(activeUID, activeUID), rule(deletedUID, deletedUID), rule("user-rule", "user-probe")},
+			Probes:             []*network.Probe{{Name: to.Ptr(activeUID)}, {Name: to.Ptr(deletedUID)}, {Name: to.Ptr("user-probe")}},
+		},
+	}
+}
+
+func getTestVMSS(name string, ipConfigs ...string) *compute.VirtualMachineScaleSet {
+	return &compute.VirtualMachineScaleSet{
+		Name: to.Ptr(name),
+		Etag: to.Ptr("vmss-etag"),
+		Properties: &compute.VirtualMachineScaleSetProperties{
+			VirtualMachineProfile: &compute.VirtualMachineScaleSetVMProfile{
+				NetworkProfile: &compute.VirtualMachineScaleSetNetworkProfile{
+					NetworkInterfaceConfigurations: getTestInterfaces(ipConfigs...),
+				},
+			},
+		},
+	}
+}
+
+func getTestVMSSVM(instanceID string, ipConfigs ...string) *compute.VirtualMachineScaleSetVM {
+	return &compute.VirtualMachineScaleSetVM{
+		InstanceID: to.Ptr(instanceID),
+		Etag:       to.Ptr("vm-etag"),
+		Properties: &compute.VirtualMachineScaleSetVMProperties{
+			NetworkProfileConfiguration: &compute.VirtualMachineScaleSetVMNetworkProfileConfiguration{
+				NetworkInterfaceConfigurations: getTestInterfaces(ipConfigs...),
+			},
+		},
+	}
+}
+
+func getTestInterfaces(ipConfigs ...string) []*compute.VirtualMachineScaleSetNetworkConfiguration {
+	nic := &compute.VirtualMachineScaleSetNetworkConfiguration{
+		Name:       to.Ptr("nic"),
+		Properties: &compute.VirtualMachineScaleSetNetworkConfigurationProperties{},
+	}
+	for _, name := range ipConfigs {
+		nic.Properties.IPConfigurations = append(nic.Properties.IPConfigurations, &compute.VirtualMachineScaleSetIPConfiguration{Name: to.Ptr(name)})
+	}
+	return []*compute.VirtualMachineScaleSetNetworkConfiguration{nic}
+}
+
+func getIPConfigNames(interfaces []*compute.VirtualMachineScaleSetNetworkConfiguration) []string {
+	return appendIPConfigNames(nil, interfaces)
+}
+
+// getIfMatch returns the If-Match header Azure requests sent with ctx carry
+func getIfMatch(ctx context.Context) string {
+	var ifMatch string
+	pipeline := azruntime.NewPipeline("test", "v1", azruntime.PipelineOptions{}, &policy.ClientOptions{
+		Transport: transportFunc(func(req *http.Request) (*http.Response, error) {
+			ifMatch = req.Header.Get("If-Match")
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+		}),
+	})
+	req, _ := azruntime.NewRequest(ctx, http.MethodPut, "https://management.azure.com/test")
+	_, _ = pipeline.Do(req)
+	return ifMatch
+}
+
+type transportFunc func(*http.Request) (*http.Response, error)
+
+func (f transportFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func getTestCollector(ctrl *gomock.Controller) *Collector {
+	conf := &config.CloudConfig{
+		ARMClientConfig: azclient.ARMClientConfig{
+			Cloud: "AzureTest",
+		},
+		Location:                  "location",
+		SubscriptionID:            "testSub",
+		ResourceGroup:             "testRG",
+		LoadBalancerName:          "testLB",
+		LoadBalancerResourceGroup: "lbRG",
+	}
+	az, _ := azmanager.CreateAzureManager(conf, getMockFactory(ctrl))
+	az.NewSubscriptionClients = func(subscriptionID string) (*azmanager.SubscriptionClients, error) {
+		return &azmanager.SubscriptionClients{Factory: getMockFactory(ctrl)}, nil
+	}
+
+	scheme := runtime.NewScheme()
+	_ = egressgatewayv1alpha1.AddToScheme(scheme)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&egressgatewayv1alpha1.GatewayVMConfiguration{ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "ns", UID: types.UID(activeUID)}},
+		&egressgatewayv1alpha1.GatewayLBConfiguration{ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "ns", UID: types.UID(activeUID)}},
+		&egressgatewayv1alpha1.StaticGatewayConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "ns"},
+			Spec: egressgatewayv1alpha1.StaticGatewayConfigurationSpec{
+				GatewayVmssProfile: egressgatewayv1alpha1.GatewayVmssProfile{VmssResourceGroup: "gwRG", VmssName: "gwVMSS"},
+			},
+		},
+	).Build()
+	// resource groups are scanned once
+	return &Collector{AzureManager: az, Client: cl, VMSSResourceGroups: []string{"extraRG", "GWRG", "testrg"}}
+}
+
+func getMockFactory(ctrl *gomock.Controller) azclient.ClientFactory {
+	factory := mock_azclient.NewMockClientFactory(ctrl)
+	factory.EXPECT().GetLoadBalancerClient().Return(mock_loadbalancerclient.NewMockInterface(ctrl))
+	factory.EXPECT().GetVirtualMachineScaleSetClient().Return(mock_virtualmachinescalesetclient.NewMockInterface(ctrl))
+	factory.EXPECT().GetVirtualMachineScaleSetVMClient().Return(mock_virtualmachinescalesetvmclient.NewMockInterface(ctrl))
+	factory.EXPECT().GetPublicIPPrefixClient().Return(mock_publicipprefixclient.NewMockInterface(ctrl))
+	factory.EXPECT().GetPublicIPAddressClient().Return(mock_publicipaddressclient.NewMockInterface(ctrl))
+	factory.EXPECT().GetInterfaceClient().Return(mock_interfaceclient.NewMockInterface(ctrl))
+	factory.EXPECT().GetSubnetClient().Return(mock_subnetclient.NewMockInterface(ctrl))
+	factory.EXPECT().GetVirtualNetworkClient().Return(mock_virtualnetworkclient.NewMockInterface(ctrl))
+	return factory
+}
+
+// addGatewaySubscription adds a gateway whose VMSS is in gwSubRG of another subscription, and returns the manager
+// the collector uses there
+func addGatewaySubscription(t *testing.T, c *Collector) *azmanager.AzureManager {
+	gwConfig := &egressgatewayv1alpha1.StaticGatewayConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "subgw", Namespace: "ns"},
+		Spec: egressgatewayv1alpha1.StaticGatewayConfigurationSpec{
+			GatewayVmssProfile: egressgatewayv1alpha1.GatewayVmssProfile{SubscriptionId: "gwSub", VmssResourceGroup: "gwSubRG", VmssName: "subVMSS"},
+		},
+	}
+	assert.Nil(t, c.Client.Create(context.Background(), gwConfig))
+	sub, err := c.ForSubscription("gwSub", "gwSubRG")
+	assert.Nil(t, err)
+	return sub
+}
@@ -20,6 +20,8 @@ import (
 type LBProbeServer struct {
 	lock           sync.RWMutex
 	activeGateways map[string]bool
+	draining       bool
+	quarantined    bool
 	listenPort     int
 }
 
@@ -80,6 +82,22 @@ func (svr *LBProbeServer) RemoveGateway(gatewayUID string) error {
 	return nil
 }
 
+// SetDraining makes all gateways report unhealthy so that lb stops sending new traffic to this node
+func (svr *LBProbeServer) SetDraining(draining bool) {
+	svr.lock.Lock()
+	defer svr.lock.Unlock()
+
+	svr.draining = draining
+}
+
+// SetQuarantined makes all gateways report unhealthy while this node is quarantined, independent of draining
+func (svr *LBProbeServer) SetQuarantined(quarantined bool) {
+	svr.lock.Lock()
+	defer svr.lock.Unlock()
+
+	svr.quarantined = quarantined
+}
+
 func (svr *LBProbeServer) GetGateways() []string {
 	var res []string
 	svr.lock.RLock()
@@ -102,9 +120,10 @@ func (svr *LBProbeServer) serveHTTP(resp http.ResponseWriter, req *http.Request)
 
 	svr.lock.RLock()
 	_, ok := svr.activeGateways[gatewayUID]
+	unavailable := svr.draining || svr.quarantined
 	svr.lock.RUnlock()
 
-	if !ok {
+	if !ok || unavailable {
 		resp.WriteHeader(http.StatusServiceUnavailable)
 	} else {
 		resp.WriteHeader(http.StatusOK)
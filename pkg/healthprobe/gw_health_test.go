@@ -55,6 +55,22 @@ func TestGatewayHealthServer(t *testing.T) {
 	assert.Equal(t, 1, len(svr.GetGateways()), "active gateway map should have 1 element")
 	testHandler(svr, "/gw/abc", http.StatusServiceUnavailable, t)
 	testHandler(svr, "/gw/ghi", http.StatusOK, t)
+
+	// Drain node
+	svr.SetDraining(true)
+	assert.Equal(t, 1, len(svr.GetGateways()), "draining should not remove active gateways")
+	testHandler(svr, "/gw/ghi", http.StatusServiceUnavailable, t)
+	svr.SetDraining(false)
+	testHandler(svr, "/gw/ghi", http.StatusOK, t)
+
+	// Quarantine node
+	svr.SetQuarantined(true)
+	testHandler(svr, "/gw/ghi", http.StatusServiceUnavailable, t)
+	svr.SetDraining(true)
+	svr.SetDraining(false)
+	testHandler(svr, "/gw/ghi", http.StatusServiceUnavailable, t)
+	svr.SetQuarantined(false)
+	testHandler(svr, "/gw/ghi", http.StatusOK, t)
 }
 
 func testHandler(svr *LBProbeServer, requestPath string, status int, t *testing.T) {
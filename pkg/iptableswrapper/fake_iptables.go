@@ -21,17 +21,22 @@ type FakeIPTables struct {
 
 // NewFake returns a no-op iptables.Interface
 func NewFake() *FakeIPTables {
-	return &FakeIPTables{
-		fake:           iptest.NewFake(),
-		builtinTargets: sets.New[string]("ACCEPT", "DROP", "RETURN", "REJECT", "DNAT", "SNAT", "MASQUERADE", "MARK", "CONNMARK"),
-	}
+	return newFake(iptest.NewFake())
 }
 
 // NewIPv6Fake returns a no-op iptables.Interface with IsIPv6() == true
 func NewIPv6Fake() *FakeIPTables {
+	return newFake(iptest.NewIPv6Fake())
+}
+
+func newFake(fake *iptest.FakeIPTables) *FakeIPTables {
+	// the original package creates mangle table without builtin chains
+	for _, chain := range []iptables.Chain{iptables.ChainPrerouting, iptables.ChainInput, iptables.ChainForward, iptables.ChainOutput, iptables.ChainPostrouting} {
+		_, _ = fake.EnsureChain(iptables.TableMangle, chain)
+	}
 	return &FakeIPTables{
-		fake:           iptest.NewIPv6Fake(),
-		builtinTargets: sets.New[string]("ACCEPT", "DROP", "RETURN", "REJECT", "DNAT", "SNAT", "MASQUERADE", "MARK", "CONNMARK"),
+		fake:           fake,
+		builtinTargets: sets.New[string]("ACCEPT", "DROP", "RETURN", "REJECT", "DNAT", "SNAT", "MASQUERADE", "MARK", "CONNMARK", "TCPMSS", "DSCP", "LOG"),
 	}
 }
 
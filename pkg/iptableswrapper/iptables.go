@@ -15,11 +15,15 @@ type IpTables interface {
 	Delete(table, chain string, rulespec ...string) error
 	// List lists rules in specified table/chain
 	List(table, chain string) ([]string, error)
+	// StructuredStats lists rules in specified table/chain with their packet and byte counters
+	StructuredStats(table, chain string) ([]iptables.Stat, error)
 }
 
 type Interface interface {
 	// New creates a new IpTables instance
 	New() (IpTables, error)
+	// NewWithProtocol creates a new IpTables instance of the given protocol
+	NewWithProtocol(proto iptables.Protocol) (IpTables, error)
 }
 
 type ipTable struct{}
@@ -31,3 +35,7 @@ func NewIPTables() Interface {
 func (*ipTable) New() (IpTables, error) {
 	return iptables.New()
 }
+
+func (*ipTable) NewWithProtocol(proto iptables.Protocol) (IpTables, error) {
+	return iptables.NewWithProtocol(proto)
+}
@@ -11,6 +11,7 @@ package mockiptableswrapper
 import (
 	reflect "reflect"
 
+	iptables "github.com/coreos/go-iptables/iptables"
 	gomock "go.uber.org/mock/gomock"
 
 	iptableswrapper "github.com/Azure/kube-egress-gateway/pkg/iptableswrapper"
@@ -131,6 +132,21 @@ func (mr *MockIpTablesMockRecorder) List(table, chain interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockIpTables)(nil).List), table, chain)
 }
 
+// StructuredStats mocks base method.
+func (m *MockIpTables) StructuredStats(table, chain string) ([]iptables.Stat, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StructuredStats", table, chain)
+	ret0, _ := ret[0].([]iptables.Stat)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// StructuredStats indicates an expected call of StructuredStats.
+func (mr *MockIpTablesMockRecorder) StructuredStats(table, chain interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StructuredStats", reflect.TypeOf((*MockIpTables)(nil).StructuredStats), table, chain)
+}
+
 // MockInterface is a mock of Interface interface.
 type MockInterface struct {
 	ctrl     *gomock.Controller
@@ -168,3 +184,18 @@ func (mr *MockInterfaceMockRecorder) New() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "New", reflect.TypeOf((*MockInterface)(nil).New))
 }
+
+// NewWithProtocol mocks base method.
+func (m *MockInterface) NewWithProtocol(proto iptables.Protocol) (iptableswrapper.IpTables, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewWithProtocol", proto)
+	ret0, _ := ret[0].(iptableswrapper.IpTables)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NewWithProtocol indicates an expected call of NewWithProtocol.
+func (mr *MockInterfaceMockRecorder) NewWithProtocol(proto interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewWithProtocol", reflect.TypeOf((*MockInterface)(nil).NewWithProtocol), proto)
+}
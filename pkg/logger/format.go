@@ -0,0 +1,42 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package logger
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	ctrlzap "sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// SetLogFormat configures opts to encode logs in the given format, json logs use the same keys in all components
+func SetLogFormat(opts *ctrlzap.Options, format string) error {
+	switch format {
+	case LogFormatText:
+		return nil
+	case LogFormatJSON:
+		opts.NewEncoder = func(encoderOpts ...ctrlzap.EncoderConfigOption) zapcore.Encoder {
+			encoderConfig := zap.NewProductionEncoderConfig()
+			encoderConfig.TimeKey = "ts"
+			encoderConfig.LevelKey = "level"
+			encoderConfig.NameKey = "logger"
+			encoderConfig.CallerKey = "caller"
+			encoderConfig.MessageKey = "msg"
+			encoderConfig.StacktraceKey = "stacktrace"
+			encoderConfig.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+			for _, opt := range encoderOpts {
+				opt(&encoderConfig)
+			}
+			return zapcore.NewJSONEncoder(encoderConfig)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported log format %q, should be %s or %s", format, LogFormatText, LogFormatJSON)
+	}
+}
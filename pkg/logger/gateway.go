@@ -0,0 +1,32 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package logger
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// keys of gateway values in logs of manager and daemon, reconcile ID is logged as "reconcileID" by controller-runtime
+	GatewayNamespaceKey = "gatewayNamespace"
+	GatewayNameKey      = "gatewayName"
+	CorrelationIDKey    = "correlationID"
+)
+
+// CorrelationID identifies a change of a StaticGatewayConfiguration, manager and daemon log the same ID when
+// reconciling the same generation of the gateway
+func CorrelationID(gwConfig metav1.Object) string {
+	return fmt.Sprintf("%s-%d", gwConfig.GetUID(), gwConfig.GetGeneration())
+}
+
+// WithGateway returns a copy of ctx whose logger logs namespace, name and correlation ID of the gateway
+func WithGateway(ctx context.Context, gwConfig metav1.Object) context.Context {
+	return log.IntoContext(ctx, log.FromContext(ctx).WithValues(
+		GatewayNamespaceKey, gwConfig.GetNamespace(),
+		GatewayNameKey, gwConfig.GetName(),
+		CorrelationIDKey, CorrelationID(gwConfig)))
+}
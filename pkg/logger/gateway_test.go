@@ -0,0 +1,54 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	ctrlzap "sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestSetLogFormat(t *testing.T) {
+	opts := ctrlzap.Options{}
+	if err := SetLogFormat(&opts, LogFormatText); err != nil || opts.NewEncoder != nil {
+		t.Fatalf("text format should keep default encoder, got err %v", err)
+	}
+	if err := SetLogFormat(&opts, "yaml"); err == nil {
+		t.Fatalf("expected error for unsupported format")
+	}
+	if err := SetLogFormat(&opts, LogFormatJSON); err != nil || opts.NewEncoder == nil {
+		t.Fatalf("json format should set encoder, got err %v", err)
+	}
+}
+
+func TestWithGateway(t *testing.T) {
+	buf := &bytes.Buffer{}
+	opts := ctrlzap.Options{DestWriter: buf}
+	if err := SetLogFormat(&opts, LogFormatJSON); err != nil {
+		t.Fatalf("failed to set json format: %v", err)
+	}
+	gwConfig := &metav1.ObjectMeta{Namespace: "testns", Name: "test", UID: "uid", Generation: 2}
+	ctx := WithGateway(log.IntoContext(context.Background(), ctrlzap.New(ctrlzap.UseFlagOptions(&opts))), gwConfig)
+	log.FromContext(ctx).Info("reconciling")
+
+	entry := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log is not json: %v, %s", err, buf.String())
+	}
+	expected := map[string]string{
+		"msg":               "reconciling",
+		GatewayNamespaceKey: "testns",
+		GatewayNameKey:      "test",
+		CorrelationIDKey:    "uid-2",
+	}
+	for k, v := range expected {
+		if entry[k] != v {
+			t.Errorf("expected %s to be %q, got %v", k, v, entry[k])
+		}
+	}
+}
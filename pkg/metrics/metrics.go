@@ -3,9 +3,13 @@
 package metrics
 
 import (
+	"errors"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients"
 )
 
 var (
@@ -25,6 +29,67 @@ var (
 		},
 		[]string{"namespace", "operation", "subscription_id", "resource_group"},
 	)
+
+	// ControllerReconcileErrorCount is labeled with a bounded error category rather than the failing resource,
+	// so that it can be used in alerts regardless of the number of gateways
+	ControllerReconcileErrorCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "controller_reconcile_error_count",
+			Help: "Number of static egress gateway controller reconciliation errors by error category",
+		},
+		[]string{"namespace", "operation", "category"},
+	)
+
+	AzureRequestThrottledCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azure_request_throttled_count",
+			Help: "Number of azure requests throttled by azure resource manager",
+		},
+		[]string{"method", "resource_type"},
+	)
+
+	// AzureRequestCount and AzureRequestLatency count each azure client call once including its retries, labeled
+	// by resource type rather than resource name to keep cardinality bounded
+	AzureRequestCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azure_request_count",
+			Help: "Number of azure resource manager requests",
+		},
+		[]string{"method", "resource_type", "result"},
+	)
+
+	AzureRequestLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "azure_request_latency",
+			Help:    "Latency of azure resource manager requests including retries",
+			Buckets: []float64{0.05, 0.1, 0.2, 0.5, 1, 2, 5, 10, 20, 30, 60, 120, 300}, // seconds
+		},
+		[]string{"method", "resource_type", "result"},
+	)
+
+	// AzureCircuitBreakerTransitionCount and AzureCircuitBreakerState are labeled by AzureManager operation, e.g.
+	// CreateOrUpdateVMSS, and the resource group whose calls of the operation are short-circuited while its circuit
+	// breaker is open
+	AzureCircuitBreakerTransitionCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azure_circuit_breaker_transition_count",
+			Help: "Number of state transitions of azure operation circuit breakers by new state",
+		},
+		[]string{"operation", "subscription_id", "resource_group", "state"},
+	)
+
+	AzureCircuitBreakerState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "azure_circuit_breaker_state",
+			Help: "State of azure operation circuit breakers, 1 for the current state of the operation in the resource group and 0 for others",
+		},
+		[]string{"operation", "subscription_id", "resource_group", "state"},
+	)
+)
+
+const (
+	AzureRequestResultSucceeded = "succeeded"
+	AzureRequestResultFailed    = "failed"
 )
 
 type MetricsContext struct {
@@ -47,7 +112,42 @@ func (mc *MetricsContext) ObserveControllerReconcileMetrics(succeeded bool) {
 	mc.observe(latency)
 }
 
+// ObserveControllerReconcileError counts err, if not nil, by its category
+func (mc *MetricsContext) ObserveControllerReconcileError(err error) {
+	if err == nil {
+		return
+	}
+	ControllerReconcileErrorCount.WithLabelValues(mc.labels[0], mc.labels[1], ErrorCategory(err)).Inc()
+}
+
 func (mc *MetricsContext) observe(latency float64) {
 	// trim the last "resource" label
 	ControllerReconcileLatency.WithLabelValues(mc.labels[:4]...).Observe(latency)
 }
+
+const (
+	ErrorCategoryThrottled = "throttled"
+	ErrorCategoryNotFound  = "not_found"
+	ErrorCategoryConflict  = "conflict"
+	ErrorCategoryOther     = "other"
+)
+
+// ErrorCategory classifies errors returned by Azure or kubernetes apiserver
+func ErrorCategory(err error) string {
+	err = azureclients.ConvertError(err)
+	switch {
+	case errors.As(err, new(*azureclients.ErrThrottled)):
+		return ErrorCategoryThrottled
+	case errors.As(err, new(*azureclients.ErrNotFound)):
+		return ErrorCategoryNotFound
+	case errors.As(err, new(*azureclients.ErrConflict)):
+		return ErrorCategoryConflict
+	case apierrors.IsTooManyRequests(err):
+		return ErrorCategoryThrottled
+	case apierrors.IsNotFound(err):
+		return ErrorCategoryNotFound
+	case apierrors.IsConflict(err):
+		return ErrorCategoryConflict
+	}
+	return ErrorCategoryOther
+}
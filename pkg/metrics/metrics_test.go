@@ -3,12 +3,17 @@
 package metrics
 
 import (
+	"fmt"
+	"net/http"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 func TestNewMetricsContext(t *testing.T) {
@@ -121,3 +126,76 @@ func TestObserve(t *testing.T) {
 	assert.Equal(t, 1, testutil.CollectAndCount(ControllerReconcileLatency))
 	assert.Nil(t, testutil.CollectAndCompare(ControllerReconcileLatency, strings.NewReader(LatencyMeta+LatencyData)))
 }
+
+func TestErrorCategory(t *testing.T) {
+	gr := schema.GroupResource{Group: "egressgateway.kubernetes.azure.com", Resource: "staticgatewayconfigurations"}
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{
+			name:     "azure throttling",
+			err:      fmt.Errorf("failed to get vmss: %w", &azcore.ResponseError{StatusCode: http.StatusTooManyRequests}),
+			expected: ErrorCategoryThrottled,
+		},
+		{
+			name:     "azure not found",
+			err:      &azcore.ResponseError{StatusCode: http.StatusNotFound},
+			expected: ErrorCategoryNotFound,
+		},
+		{
+			name:     "azure precondition failed",
+			err:      &azcore.ResponseError{StatusCode: http.StatusPreconditionFailed},
+			expected: ErrorCategoryConflict,
+		},
+		{
+			name:     "azure internal error",
+			err:      &azcore.ResponseError{StatusCode: http.StatusInternalServerError},
+			expected: ErrorCategoryOther,
+		},
+		{
+			name:     "kubernetes conflict",
+			err:      fmt.Errorf("failed to update: %w", apierrors.NewConflict(gr, "test", fmt.Errorf("modified"))),
+			expected: ErrorCategoryConflict,
+		},
+		{
+			name:     "kubernetes not found",
+			err:      apierrors.NewNotFound(gr, "test"),
+			expected: ErrorCategoryNotFound,
+		},
+		{
+			name:     "kubernetes throttling",
+			err:      apierrors.NewTooManyRequests("slow down", 1),
+			expected: ErrorCategoryThrottled,
+		},
+		{
+			name:     "other error",
+			err:      fmt.Errorf("vmss has empty network profile"),
+			expected: ErrorCategoryOther,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, ErrorCategory(test.err))
+		})
+	}
+}
+
+func TestObserveControllerReconcileError(t *testing.T) {
+	defer ControllerReconcileErrorCount.Reset()
+	mc := NewMetricsContext("testns", "operation", "subID", "rg", "ns/name")
+	mc.ObserveControllerReconcileError(nil)
+	assert.Equal(t, 0, testutil.CollectAndCount(ControllerReconcileErrorCount))
+
+	mc.ObserveControllerReconcileError(&azcore.ResponseError{StatusCode: http.StatusTooManyRequests})
+	mc.ObserveControllerReconcileError(fmt.Errorf("failed"))
+	mc.ObserveControllerReconcileError(fmt.Errorf("failed again"))
+	expected := `
+		# HELP controller_reconcile_error_count Number of static egress gateway controller reconciliation errors by error category
+		# TYPE controller_reconcile_error_count counter
+		controller_reconcile_error_count{category="other",namespace="testns",operation="operation"} 2
+		controller_reconcile_error_count{category="throttled",namespace="testns",operation="operation"} 1
+`
+	assert.Nil(t, testutil.CollectAndCompare(ControllerReconcileErrorCount, strings.NewReader(expected)))
+}
@@ -91,6 +91,49 @@ func (mr *MockInterfaceMockRecorder) AddrReplace(link, addr interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddrReplace", reflect.TypeOf((*MockInterface)(nil).AddrReplace), link, addr)
 }
 
+// FilterAdd mocks base method.
+func (m *MockInterface) FilterAdd(filter netlink.Filter) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FilterAdd", filter)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FilterAdd indicates an expected call of FilterAdd.
+func (mr *MockInterfaceMockRecorder) FilterAdd(filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FilterAdd", reflect.TypeOf((*MockInterface)(nil).FilterAdd), filter)
+}
+
+// FilterDel mocks base method.
+func (m *MockInterface) FilterDel(filter netlink.Filter) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FilterDel", filter)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FilterDel indicates an expected call of FilterDel.
+func (mr *MockInterfaceMockRecorder) FilterDel(filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FilterDel", reflect.TypeOf((*MockInterface)(nil).FilterDel), filter)
+}
+
+// FilterList mocks base method.
+func (m *MockInterface) FilterList(link netlink.Link, parent uint32) ([]netlink.Filter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FilterList", link, parent)
+	ret0, _ := ret[0].([]netlink.Filter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FilterList indicates an expected call of FilterList.
+func (mr *MockInterfaceMockRecorder) FilterList(link, parent interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FilterList", reflect.TypeOf((*MockInterface)(nil).FilterList), link, parent)
+}
+
 // LinkAdd mocks base method.
 func (m *MockInterface) LinkAdd(link netlink.Link) error {
 	m.ctrl.T.Helper()
@@ -177,6 +220,20 @@ func (mr *MockInterfaceMockRecorder) LinkSetDown(link interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LinkSetDown", reflect.TypeOf((*MockInterface)(nil).LinkSetDown), link)
 }
 
+// LinkSetMTU mocks base method.
+func (m *MockInterface) LinkSetMTU(link netlink.Link, mtu int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LinkSetMTU", link, mtu)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LinkSetMTU indicates an expected call of LinkSetMTU.
+func (mr *MockInterfaceMockRecorder) LinkSetMTU(link, mtu interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LinkSetMTU", reflect.TypeOf((*MockInterface)(nil).LinkSetMTU), link, mtu)
+}
+
 // LinkSetName mocks base method.
 func (m *MockInterface) LinkSetName(link netlink.Link, name string) error {
 	m.ctrl.T.Helper()
@@ -219,6 +276,35 @@ func (mr *MockInterfaceMockRecorder) LinkSetUp(link interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LinkSetUp", reflect.TypeOf((*MockInterface)(nil).LinkSetUp), link)
 }
 
+// QdiscAdd mocks base method.
+func (m *MockInterface) QdiscAdd(qdisc netlink.Qdisc) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QdiscAdd", qdisc)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// QdiscAdd indicates an expected call of QdiscAdd.
+func (mr *MockInterfaceMockRecorder) QdiscAdd(qdisc interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QdiscAdd", reflect.TypeOf((*MockInterface)(nil).QdiscAdd), qdisc)
+}
+
+// QdiscList mocks base method.
+func (m *MockInterface) QdiscList(link netlink.Link) ([]netlink.Qdisc, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QdiscList", link)
+	ret0, _ := ret[0].([]netlink.Qdisc)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QdiscList indicates an expected call of QdiscList.
+func (mr *MockInterfaceMockRecorder) QdiscList(link interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QdiscList", reflect.TypeOf((*MockInterface)(nil).QdiscList), link)
+}
+
 // RouteDel mocks base method.
 func (m *MockInterface) RouteDel(route *netlink.Route) error {
 	m.ctrl.T.Helper()
@@ -275,3 +361,32 @@ func (mr *MockInterfaceMockRecorder) RuleAdd(rule interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RuleAdd", reflect.TypeOf((*MockInterface)(nil).RuleAdd), rule)
 }
+
+// RuleDel mocks base method.
+func (m *MockInterface) RuleDel(rule *netlink.Rule) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RuleDel", rule)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RuleDel indicates an expected call of RuleDel.
+func (mr *MockInterfaceMockRecorder) RuleDel(rule interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RuleDel", reflect.TypeOf((*MockInterface)(nil).RuleDel), rule)
+}
+
+// RuleList mocks base method.
+func (m *MockInterface) RuleList(family int) ([]netlink.Rule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RuleList", family)
+	ret0, _ := ret[0].([]netlink.Rule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RuleList indicates an expected call of RuleList.
+func (mr *MockInterfaceMockRecorder) RuleList(family interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RuleList", reflect.TypeOf((*MockInterface)(nil).RuleList), family)
+}
@@ -2,7 +2,11 @@
 // Licensed under the MIT license.
 package netlinkwrapper
 
-import "github.com/vishvananda/netlink"
+import (
+	"slices"
+
+	"github.com/vishvananda/netlink"
+)
 
 type Interface interface {
 	// LinkByName finds a link by name
@@ -23,6 +27,8 @@ type Interface interface {
 	LinkSetName(link netlink.Link, name string) error
 	// LinkSetAlias sets the alias of the link device
 	LinkSetAlias(link netlink.Link, name string) error
+	// LinkSetMTU sets the mtu of the link device
+	LinkSetMTU(link netlink.Link, mtu int) error
 	// AddrList gets a list of IP addresses in the system
 	AddrList(link netlink.Link, family int) ([]netlink.Addr, error)
 	// AddrAdd adds an IP address to a link device
@@ -39,6 +45,20 @@ type Interface interface {
 	RouteList(link netlink.Link, family int) ([]netlink.Route, error)
 	// RuleAdd adds a rule
 	RuleAdd(rule *netlink.Rule) error
+	// RuleDel deletes a rule
+	RuleDel(rule *netlink.Rule) error
+	// RuleList gets a list of rules in the system
+	RuleList(family int) ([]netlink.Rule, error)
+	// QdiscList gets a list of qdiscs in the system
+	QdiscList(link netlink.Link) ([]netlink.Qdisc, error)
+	// QdiscAdd adds a qdisc
+	QdiscAdd(qdisc netlink.Qdisc) error
+	// FilterList gets a list of filters in the system
+	FilterList(link netlink.Link, parent uint32) ([]netlink.Filter, error)
+	// FilterAdd adds a filter
+	FilterAdd(filter netlink.Filter) error
+	// FilterDel deletes a filter
+	FilterDel(filter netlink.Filter) error
 }
 
 type nl struct{}
@@ -83,6 +103,10 @@ func (*nl) LinkSetAlias(link netlink.Link, name string) error {
 	return netlink.LinkSetAlias(link, name)
 }
 
+func (*nl) LinkSetMTU(link netlink.Link, mtu int) error {
+	return netlink.LinkSetMTU(link, mtu)
+}
+
 func (*nl) AddrList(link netlink.Link, family int) ([]netlink.Addr, error) {
 	return netlink.AddrList(link, family)
 }
@@ -114,3 +138,39 @@ func (*nl) RouteList(link netlink.Link, family int) ([]netlink.Route, error) {
 func (*nl) RuleAdd(rule *netlink.Rule) error {
 	return netlink.RuleAdd(rule)
 }
+
+func (*nl) RuleDel(rule *netlink.Rule) error {
+	return netlink.RuleDel(rule)
+}
+
+func (*nl) RuleList(family int) ([]netlink.Rule, error) {
+	return netlink.RuleList(family)
+}
+
+func (*nl) QdiscList(link netlink.Link) ([]netlink.Qdisc, error) {
+	return netlink.QdiscList(link)
+}
+
+func (*nl) QdiscAdd(qdisc netlink.Qdisc) error {
+	return netlink.QdiscAdd(qdisc)
+}
+
+func (*nl) FilterList(link netlink.Link, parent uint32) ([]netlink.Filter, error) {
+	return netlink.FilterList(link, parent)
+}
+
+func (*nl) FilterAdd(filter netlink.Filter) error {
+	return netlink.FilterAdd(filter)
+}
+
+func (*nl) FilterDel(filter netlink.Filter) error {
+	return netlink.FilterDel(filter)
+}
+
+// SortRulesByPriority sorts rules in the order the kernel evaluates them, i.e. ascending priority,
+// rules of the same priority keep their order
+func SortRulesByPriority(rules []netlink.Rule) {
+	slices.SortStableFunc(rules, func(a, b netlink.Rule) int {
+		return a.Priority - b.Priority
+	})
+}
@@ -0,0 +1,46 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package netlinkwrapper
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestSortRulesByPriority(t *testing.T) {
+	newRule := func(priority, table int, src string) netlink.Rule {
+		rule := netlink.NewRule()
+		rule.Priority = priority
+		rule.Table = table
+		if src != "" {
+			_, rule.Src, _ = net.ParseCIDR(src)
+		}
+		return *rule
+	}
+	// as listed by the kernel with a gateway rule added after rules of main and default tables
+	rules := []netlink.Rule{
+		newRule(0, unix.RT_TABLE_LOCAL, ""),
+		newRule(32766, unix.RT_TABLE_MAIN, ""),
+		newRule(32767, unix.RT_TABLE_DEFAULT, ""),
+		newRule(100, 1000, "10.0.0.6/32"),
+		newRule(100, 1000, "10.0.0.7/32"),
+		newRule(50, 200, ""),
+	}
+	SortRulesByPriority(rules)
+
+	var tables []int
+	var sources []string
+	for _, rule := range rules {
+		tables = append(tables, rule.Table)
+		if rule.Src != nil {
+			sources = append(sources, rule.Src.String())
+		}
+	}
+	assert.Equal(t, []int{unix.RT_TABLE_LOCAL, 200, 1000, 1000, unix.RT_TABLE_MAIN, unix.RT_TABLE_DEFAULT}, tables,
+		"gateway rules should be evaluated before main table but after rules with lower priority")
+	assert.Equal(t, []string{"10.0.0.6/32", "10.0.0.7/32"}, sources, "rules of the same priority should keep their order")
+}
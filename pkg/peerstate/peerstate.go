@@ -0,0 +1,25 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package peerstate
+
+import "time"
+
+// Path is the path on gateway daemon metrics server serving wireguard peers of a StaticGatewayConfiguration,
+// which is identified by "namespace" and "name" query parameters
+const Path = "/gateway/peers"
+
+// Peer is the state of a pod wireguard peer on a gateway node
+type Peer struct {
+	// PodEndpoint is the namespace/name of the PodEndpoint owning the peer, empty if the peer is not reported in GatewayStatus yet
+	PodEndpoint string `json:"podEndpoint,omitempty"`
+	// PublicKey is the wireguard public key of the pod
+	PublicKey string `json:"publicKey"`
+	// Endpoint is the address the latest packets from the pod were received from
+	Endpoint string `json:"endpoint,omitempty"`
+	// AllowedIPs are the pod IPs routed through the peer
+	AllowedIPs []string `json:"allowedIPs,omitempty"`
+	// LastHandshakeTime is zero if there is no handshake with the pod yet
+	LastHandshakeTime time.Time `json:"lastHandshakeTime"`
+	ReceiveBytes      int64     `json:"receiveBytes"`
+	TransmitBytes     int64     `json:"transmitBytes"`
+}
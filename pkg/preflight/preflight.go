@@ -0,0 +1,263 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+// Package preflight checks that Azure resources and permissions a gateway vmss profile relies on are in place,
+// before a StaticGatewayConfiguration is created with it.
+package preflight
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+
+	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+	network "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/azmanager"
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients/permissionclient"
+	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
+)
+
+const (
+	// Azure reserves the first four and the last address of every subnet
+	subnetReservedAddresses = 5
+
+	publicIPPrefixWriteAction = "Microsoft.Network/publicIPPrefixes/write"
+	loadBalancerWriteAction   = "Microsoft.Network/loadBalancers/write"
+	vmssWriteAction           = "Microsoft.Compute/virtualMachineScaleSets/write"
+	virtualNetworkReadAction  = "Microsoft.Network/virtualNetworks/read"
+)
+
+// Result is the outcome of a single check
+type Result struct {
+	Name    string
+	Passed  bool
+	Message string
+}
+
+// Report is the list of check results
+type Report []Result
+
+// Passed returns true if all checks passed
+func (r Report) Passed() bool {
+	for _, result := range r {
+		if !result.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// Print writes one line per check and a summary to w
+func (r Report) Print(w io.Writer) {
+	failed := 0
+	for _, result := range r {
+		status := "PASS"
+		if !result.Passed {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(w, "[%s] %s: %s\n", status, result.Name, result.Message)
+	}
+	if failed == 0 {
+		fmt.Fprintf(w, "all %d checks passed\n", len(r))
+	} else {
+		fmt.Fprintf(w, "%d of %d checks failed\n", failed, len(r))
+	}
+}
+
+// Checker runs the checks with the azure manager of the controller
+type Checker struct {
+	*azmanager.AzureManager
+
+	report Report
+	// permissions listed per scope
+	permissions map[string][]permissionclient.Permission
+}
+
+// Run checks that each vmss of the profile exists, has the network configuration the gateway ipConfigs are added
+// to, and a subnet with free addresses, and that the manager identity can create public ip prefixes, modify the
+// gateway load balancer and vmsses, and read the cluster virtual network whose address space gateways sNAT to their
+// private IPs. When the profile is in another subscription than the cluster, vmsses, public ip prefixes and the
+// gateway load balancer are checked in the resource group of the first vmss of that subscription, where the
+// controller manager creates them.
+func (c *Checker) Run(ctx context.Context, profile egressgatewayv1alpha1.GatewayVmssProfile) Report {
+	c.report = nil
+	c.permissions = make(map[string][]permissionclient.Permission)
+
+	vmssRefs := profile.VmssReferences()
+	if len(vmssRefs) == 0 {
+		c.fail("gateway vmss profile", "vmssName or vmsses must be provided")
+		return c.report
+	}
+	az, err := c.ForSubscription(profile.SubscriptionId, vmssRefs[0].VmssResourceGroup)
+	if err != nil {
+		c.fail("gateway subscription", err.Error())
+		return c.report
+	}
+	for _, ref := range vmssRefs {
+		c.checkVMSS(ctx, az, ref)
+	}
+	c.checkPermission(ctx, "public ip prefix permission", c.resourceGroupScope(az, az.ResourceGroup), publicIPPrefixWriteAction, func() ([]permissionclient.Permission, error) {
+		return az.ListPermissions(ctx, az.ResourceGroup)
+	})
+	c.checkPermission(ctx, "load balancer permission", c.resourceGroupScope(az, az.LoadBalancerResourceGroup), loadBalancerWriteAction, func() ([]permissionclient.Permission, error) {
+		return az.ListPermissions(ctx, az.LoadBalancerResourceGroup)
+	})
+	c.checkPermission(ctx, "virtual network permission", c.resourceGroupScope(c.AzureManager, c.VnetResourceGroup), virtualNetworkReadAction, func() ([]permissionclient.Permission, error) {
+		return c.ListPermissions(ctx, c.VnetResourceGroup)
+	})
+	for _, ref := range vmssRefs {
+		// roles of the gateway vmss can be assigned on the vmss only
+		rg := vmssResourceGroup(az, ref)
+		c.checkPermission(ctx, fmt.Sprintf("vmss %s permission", ref.VmssName), c.vmssScope(az, rg, ref.VmssName), vmssWriteAction, func() ([]permissionclient.Permission, error) {
+			return az.ListVMSSPermissions(ctx, rg, ref.VmssName)
+		})
+	}
+	return c.report
+}
+
+func (c *Checker) checkVMSS(ctx context.Context, az *azmanager.AzureManager, ref egressgatewayv1alpha1.VmssReference) {
+	vmss, err := az.GetVMSS(ctx, ref.VmssResourceGroup, ref.VmssName)
+	if err != nil {
+		c.fail(fmt.Sprintf("vmss %s", ref.VmssName), fmt.Sprintf("failed to get vmss in %s: %v", c.resourceGroupScope(az, vmssResourceGroup(az, ref)), err))
+		return
+	}
+	c.pass(fmt.Sprintf("vmss %s", ref.VmssName), fmt.Sprintf("found vmss in %s", c.resourceGroupScope(az, vmssResourceGroup(az, ref))))
+
+	name := fmt.Sprintf("vmss %s network configuration", ref.VmssName)
+	if err := azmanager.CheckVMSSGatewayReady(vmss); err != nil {
+		c.fail(name, err.Error())
+		return
+	}
+	c.pass(name, "primary network interface has a primary ip configuration in a subnet")
+
+	c.checkSubnet(ctx, az, ref.VmssName, vmss)
+}
+
+func (c *Checker) checkSubnet(ctx context.Context, az *azmanager.AzureManager, vmssName string, vmss *compute.VirtualMachineScaleSet) {
+	name := fmt.Sprintf("vmss %s subnet address space", vmssName)
+	subnetID := primarySubnetID(vmss)
+	subnet, err := az.GetSubnetByID(ctx, subnetID)
+	if err != nil {
+		c.fail(name, fmt.Sprintf("failed to get subnet %s: %v", subnetID, err))
+		return
+	}
+	free, err := freeAddresses(subnet)
+	if err != nil {
+		c.fail(name, fmt.Sprintf("failed to compute free addresses of subnet %s: %v", subnetID, err))
+		return
+	}
+	// every gateway adds one ipConfig to each vmss instance
+	required := int64(1)
+	if vmss.SKU != nil && to.Val(vmss.SKU.Capacity) > required {
+		required = to.Val(vmss.SKU.Capacity)
+	}
+	if free < required {
+		c.fail(name, fmt.Sprintf("subnet %s has %d free addresses, each gateway needs one for every vmss instance (%d)", to.Val(subnet.Name), free, required))
+		return
+	}
+	c.pass(name, fmt.Sprintf("subnet %s has %d free addresses", to.Val(subnet.Name), free))
+}
+
+// checkPermission checks that action is allowed on scope, permissions of a scope are listed once with list
+func (c *Checker) checkPermission(ctx context.Context, name, scope, action string, list func() ([]permissionclient.Permission, error)) {
+	permissions, ok := c.permissions[strings.ToLower(scope)]
+	if !ok {
+		var err error
+		permissions, err = list()
+		if err != nil {
+			c.fail(name, fmt.Sprintf("failed to list permissions on %s: %v", scope, err))
+			return
+		}
+		c.permissions[strings.ToLower(scope)] = permissions
+	}
+	if !permissionclient.IsAllowed(permissions, action) {
+		c.fail(name, fmt.Sprintf("%s is not allowed on %s", action, scope))
+		return
+	}
+	c.pass(name, fmt.Sprintf("%s is allowed on %s", action, scope))
+}
+
+// resourceGroupScope names resourceGroup of the subscription of az in check results, permissions are listed once per
+// scope
+func (c *Checker) resourceGroupScope(az *azmanager.AzureManager, resourceGroup string) string {
+	if az == c.AzureManager {
+		return "resource group " + resourceGroup
+	}
+	return fmt.Sprintf("resource group %s of subscription %s", resourceGroup, az.SubscriptionID())
+}
+
+// vmssScope names the vmss of the subscription of az in check results
+func (c *Checker) vmssScope(az *azmanager.AzureManager, resourceGroup, vmssName string) string {
+	if az == c.AzureManager {
+		return fmt.Sprintf("vmss %s/%s", resourceGroup, vmssName)
+	}
+	return fmt.Sprintf("vmss %s/%s of subscription %s", resourceGroup, vmssName, az.SubscriptionID())
+}
+
+func (c *Checker) pass(name, message string) {
+	c.report = append(c.report, Result{Name: name, Passed: true, Message: message})
+}
+
+func (c *Checker) fail(name, message string) {
+	c.report = append(c.report, Result{Name: name, Message: message})
+}
+
+func vmssResourceGroup(az *azmanager.AzureManager, ref egressgatewayv1alpha1.VmssReference) string {
+	if ref.VmssResourceGroup == "" {
+		return az.ResourceGroup
+	}
+	return ref.VmssResourceGroup
+}
+
+// primarySubnetID returns the subnet of the primary ipConfig of the primary network interface, the vmss must have
+// passed CheckVMSSGatewayReady
+func primarySubnetID(vmss *compute.VirtualMachineScaleSet) string {
+	for _, nic := range vmss.Properties.VirtualMachineProfile.NetworkProfile.NetworkInterfaceConfigurations {
+		if nic.Properties == nil || !to.Val(nic.Properties.Primary) {
+			continue
+		}
+		for _, ipConfig := range nic.Properties.IPConfigurations {
+			if ipConfig.Properties != nil && to.Val(ipConfig.Properties.Primary) && ipConfig.Properties.Subnet != nil {
+				return to.Val(ipConfig.Properties.Subnet.ID)
+			}
+		}
+	}
+	return ""
+}
+
+// freeAddresses returns the number of unused addresses in the ipv4 address space of the subnet
+func freeAddresses(subnet *network.Subnet) (int64, error) {
+	if subnet.Properties == nil {
+		return 0, fmt.Errorf("subnet has no properties")
+	}
+	prefixes := append([]*string{subnet.Properties.AddressPrefix}, subnet.Properties.AddressPrefixes...)
+	seen := make(map[string]bool)
+	var total int64
+	for _, prefix := range prefixes {
+		if to.Val(prefix) == "" || seen[to.Val(prefix)] {
+			continue
+		}
+		seen[to.Val(prefix)] = true
+		p, err := netip.ParsePrefix(to.Val(prefix))
+		if err != nil {
+			return 0, err
+		}
+		if !p.Addr().Is4() {
+			continue
+		}
+		total += int64(1)<<(32-p.Bits()) - subnetReservedAddresses
+	}
+	if total <= 0 {
+		return 0, fmt.Errorf("subnet has no ipv4 address prefix")
+	}
+	free := total - int64(len(subnet.Properties.IPConfigurations))
+	if free < 0 {
+		free = 0
+	}
+	return free, nil
+}
@@ -0,0 +1,295 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package preflight
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+	network "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/interfaceclient/mock_interfaceclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/loadbalancerclient/mock_loadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/mock_azclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/publicipaddressclient/mock_publicipaddressclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/publicipprefixclient/mock_publicipprefixclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/subnetclient/mock_subnetclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetclient/mock_virtualmachinescalesetclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetvmclient/mock_virtualmachinescalesetvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualnetworkclient/mock_virtualnetworkclient"
+
+	egressgatewayv1alpha1 "github.com/Azure/kube-egress-gateway/api/v1alpha1"
+	"github.com/Azure/kube-egress-gateway/pkg/azmanager"
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients/permissionclient"
+	"github.com/Azure/kube-egress-gateway/pkg/azureclients/permissionclient/mockpermissionclient"
+	"github.com/Azure/kube-egress-gateway/pkg/config"
+	"github.com/Azure/kube-egress-gateway/pkg/utils/to"
+)
+
+const testSubnetID = "/subscriptions/testSub/resourceGroups/vnetRG/providers/Microsoft.Network/virtualNetworks/vnet/subnets/subnet"
+
+func TestRun(t *testing.T) {
+	allowAll := []permissionclient.Permission{{Actions: []string{"*"}}}
+	tests := []struct {
+		desc        string
+		vmss        *compute.VirtualMachineScaleSet
+		vmssErr     error
+		subnet      *network.Subnet
+		permissions []permissionclient.Permission
+		expected    map[string]bool
+	}{
+		{
+			desc:        "all checks should pass",
+			vmss:        getTestVMSS(true, 3),
+			subnet:      getTestSubnet("10.0.0.0/24", 10),
+			permissions: allowAll,
+			expected: map[string]bool{
+				"vmss gw":                       true,
+				"vmss gw network configuration": true,
+				"vmss gw subnet address space":  true,
+				"public ip prefix permission":   true,
+				"load balancer permission":      true,
+				"virtual network permission":    true,
+				"vmss gw permission":            true,
+			},
+		},
+		{
+			desc:        "missing vmss should fail",
+			vmssErr:     fmt.Errorf("vmss not found"),
+			permissions: allowAll,
+			expected: map[string]bool{
+				"vmss gw":                     false,
+				"public ip prefix permission": true,
+				"load balancer permission":    true,
+				"virtual network permission":  true,
+				"vmss gw permission":          true,
+			},
+		},
+		{
+			desc:        "vmss without primary ipConfig should fail",
+			vmss:        getTestVMSS(false, 3),
+			permissions: allowAll,
+			expected: map[string]bool{
+				"vmss gw":                       true,
+				"vmss gw network configuration": false,
+				"public ip prefix permission":   true,
+				"load balancer permission":      true,
+				"virtual network permission":    true,
+				"vmss gw permission":            true,
+			},
+		},
+		{
+			desc:        "full subnet and missing permissions should fail",
+			vmss:        getTestVMSS(true, 3),
+			subnet:      getTestSubnet("10.0.0.0/29", 2),
+			permissions: []permissionclient.Permission{{Actions: []string{"Microsoft.Network/*"}, NotActions: []string{"Microsoft.Network/loadBalancers/write"}}},
+			expected: map[string]bool{
+				"vmss gw":                       true,
+				"vmss gw network configuration": true,
+				"vmss gw subnet address space":  false,
+				"public ip prefix permission":   true,
+				"load balancer permission":      false,
+				"virtual network permission":    true,
+				"vmss gw permission":            false,
+			},
+		},
+	}
+	for i, test := range tests {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		az := getMockAzureManager(ctrl)
+		mockVmssClient := az.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface)
+		mockVmssClient.EXPECT().Get(gomock.Any(), "testRG", "gw", gomock.Any()).Return(test.vmss, test.vmssErr)
+		if test.subnet != nil {
+			mockSubnetClient := az.SubnetClient.(*mock_subnetclient.MockInterface)
+			mockSubnetClient.EXPECT().Get(gomock.Any(), "vnetRG", "vnet", "subnet", gomock.Any()).Return(test.subnet, nil)
+		}
+		mockPermissionClient := mockpermissionclient.NewMockInterface(ctrl)
+		az.PermissionClient = mockPermissionClient
+		// permissions are listed once per resource group
+		mockPermissionClient.EXPECT().ListForResourceGroup(gomock.Any(), "testRG").Return(test.permissions, nil)
+		mockPermissionClient.EXPECT().ListForResourceGroup(gomock.Any(), "lbRG").Return(test.permissions, nil)
+		mockPermissionClient.EXPECT().ListForResourceGroup(gomock.Any(), "vnetRG").Return(test.permissions, nil)
+		mockPermissionClient.EXPECT().ListForResource(gomock.Any(), "/subscriptions/testSub/resourceGroups/testRG/providers/Microsoft.Compute/virtualMachineScaleSets/gw").Return(test.permissions, nil)
+
+		report := (&Checker{AzureManager: az}).Run(context.Background(), egressgatewayv1alpha1.GatewayVmssProfile{VmssName: "gw"})
+		results := make(map[string]bool)
+		passed := true
+		for _, result := range report {
+			results[result.Name] = result.Passed
+			passed = passed && result.Passed
+		}
+		assert.Equal(t, test.expected, results, "TestCase[%d]: %s", i, test.desc)
+		assert.Equal(t, passed, report.Passed(), "TestCase[%d]: %s", i, test.desc)
+	}
+}
+
+func TestRunInGatewaySubscription(t *testing.T) {
+	allowAll := []permissionclient.Permission{{Actions: []string{"*"}}}
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := getMockAzureManager(ctrl)
+	clusterPermissionClient := mockpermissionclient.NewMockInterface(ctrl)
+	az.PermissionClient = clusterPermissionClient
+	subPermissionClient := mockpermissionclient.NewMockInterface(ctrl)
+	az.NewSubscriptionClients = func(subscriptionID string) (*azmanager.SubscriptionClients, error) {
+		return &azmanager.SubscriptionClients{Factory: getMockFactory(ctrl), PermissionClient: subPermissionClient}, nil
+	}
+	sub, err := az.ForSubscription("gwSub", "gwSubRG")
+	assert.Nil(t, err)
+
+	// the vmss, public ip prefixes and the gateway load balancer are checked in the gateway subscription
+	sub.VmssClient.(*mock_virtualmachinescalesetclient.MockInterface).EXPECT().Get(gomock.Any(), "gwSubRG", "gw", gomock.Any()).Return(getTestVMSS(true, 3), nil)
+	sub.SubnetClient.(*mock_subnetclient.MockInterface).EXPECT().Get(gomock.Any(), "vnetRG", "vnet", "subnet", gomock.Any()).Return(getTestSubnet("10.0.0.0/24", 10), nil)
+	subPermissionClient.EXPECT().ListForResourceGroup(gomock.Any(), "gwSubRG").Return(allowAll, nil)
+	subPermissionClient.EXPECT().ListForResource(gomock.Any(), "/subscriptions/gwSub/resourceGroups/gwSubRG/providers/Microsoft.Compute/virtualMachineScaleSets/gw").Return(allowAll, nil)
+	// gateways sNAT the address space of the cluster virtual network
+	clusterPermissionClient.EXPECT().ListForResourceGroup(gomock.Any(), "vnetRG").Return(allowAll, nil)
+
+	report := (&Checker{AzureManager: az}).Run(context.Background(), egressgatewayv1alpha1.GatewayVmssProfile{SubscriptionId: "gwSub", VmssResourceGroup: "gwSubRG", VmssName: "gw"})
+	assert.True(t, report.Passed())
+	assert.Len(t, report, 7)
+	assert.Contains(t, report, Result{Name: "vmss gw", Passed: true, Message: "found vmss in resource group gwSubRG of subscription gwSub"})
+	assert.Contains(t, report, Result{Name: "load balancer permission", Passed: true,
+		Message: "Microsoft.Network/loadBalancers/write is allowed on resource group gwSubRG of subscription gwSub"})
+	assert.Contains(t, report, Result{Name: "virtual network permission", Passed: true,
+		Message: "Microsoft.Network/virtualNetworks/read is allowed on resource group vnetRG"})
+}
+
+func TestRunInUnsupportedGatewaySubscription(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	report := (&Checker{AzureManager: getMockAzureManager(ctrl)}).Run(context.Background(), egressgatewayv1alpha1.GatewayVmssProfile{SubscriptionId: "gwSub", VmssName: "gw"})
+	assert.Equal(t, Report{{Name: "gateway subscription",
+		Message: "azure clients of subscription(gwSub) are not supported, gateways must be in the cluster subscription(testSub)"}}, report)
+}
+
+func TestRunWithoutVmss(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	report := (&Checker{AzureManager: getMockAzureManager(ctrl)}).Run(context.Background(), egressgatewayv1alpha1.GatewayVmssProfile{})
+	assert.False(t, report.Passed())
+	assert.Len(t, report, 1)
+}
+
+func TestFreeAddresses(t *testing.T) {
+	tests := []struct {
+		desc     string
+		subnet   *network.Subnet
+		expected int64
+		hasErr   bool
+	}{
+		{
+			desc:     "reserved addresses and ipConfigs are excluded",
+			subnet:   getTestSubnet("10.0.0.0/24", 10),
+			expected: 241,
+		},
+		{
+			desc:     "address prefixes are summed",
+			subnet:   &network.Subnet{Properties: &network.SubnetPropertiesFormat{AddressPrefixes: []*string{to.Ptr("10.0.0.0/28"), to.Ptr("10.0.1.0/28"), to.Ptr("fd00::/64")}}},
+			expected: 22,
+		},
+		{
+			desc:   "ipv6 only subnet is an error",
+			subnet: &network.Subnet{Properties: &network.SubnetPropertiesFormat{AddressPrefix: to.Ptr("fd00::/64")}},
+			hasErr: true,
+		},
+		{
+			desc:   "invalid prefix is an error",
+			subnet: &network.Subnet{Properties: &network.SubnetPropertiesFormat{AddressPrefix: to.Ptr("10.0.0.0")}},
+			hasErr: true,
+		},
+	}
+	for i, test := range tests {
+		free, err := freeAddresses(test.subnet)
+		assert.Equal(t, test.hasErr, err != nil, "TestCase[%d]: %s", i, test.desc)
+		assert.Equal(t, test.expected, free, "TestCase[%d]: %s", i, test.desc)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	buf := &bytes.Buffer{}
+	Report{
+		{Name: "vmss gw", Passed: true, Message: "found vmss"},
+		{Name: "load balancer permission", Message: "not allowed"},
+	}.Print(buf)
+	assert.Equal(t, "[PASS] vmss gw: found vmss\n[FAIL] load balancer permission: not allowed\n1 of 2 checks failed\n", buf.String())
+}
+
+func getTestVMSS(primaryIPConfig bool, capacity int64) *compute.VirtualMachineScaleSet {
+	return &compute.VirtualMachineScaleSet{
+		Name: to.Ptr("gw"),
+		SKU:  &compute.SKU{Capacity: to.Ptr(capacity)},
+		Properties: &compute.VirtualMachineScaleSetProperties{
+			VirtualMachineProfile: &compute.VirtualMachineScaleSetVMProfile{
+				NetworkProfile: &compute.VirtualMachineScaleSetNetworkProfile{
+					NetworkInterfaceConfigurations: []*compute.VirtualMachineScaleSetNetworkConfiguration{
+						{
+							Name: to.Ptr("nic"),
+							Properties: &compute.VirtualMachineScaleSetNetworkConfigurationProperties{
+								Primary: to.Ptr(true),
+								IPConfigurations: []*compute.VirtualMachineScaleSetIPConfiguration{
+									{
+										Name: to.Ptr("ipConfig"),
+										Properties: &compute.VirtualMachineScaleSetIPConfigurationProperties{
+											Primary: to.Ptr(primaryIPConfig),
+											Subnet:  &compute.APIEntityReference{ID: to.Ptr(testSubnetID)},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func getTestSubnet(prefix string, ipConfigs int) *network.Subnet {
+	subnet := &network.Subnet{
+		Name:       to.Ptr("subnet"),
+		Properties: &network.SubnetPropertiesFormat{AddressPrefix: to.Ptr(prefix)},
+	}
+	for i := 0; i < ipConfigs; i++ {
+		subnet.Properties.IPConfigurations = append(subnet.Properties.IPConfigurations, &network.IPConfiguration{})
+	}
+	return subnet
+}
+
+func getMockAzureManager(ctrl *gomock.Controller) *azmanager.AzureManager {
+	conf := &config.CloudConfig{
+		ARMClientConfig: azclient.ARMClientConfig{
+			Cloud: "AzureTest",
+		},
+		Location:                  "location",
+		SubscriptionID:            "testSub",
+		ResourceGroup:             "testRG",
+		LoadBalancerName:          "testLB",
+		LoadBalancerResourceGroup: "lbRG",
+		VnetName:                  "vnet",
+		VnetResourceGroup:         "vnetRG",
+		SubnetName:                "subnet",
+	}
+	az, _ := azmanager.CreateAzureManager(conf, getMockFactory(ctrl))
+	return az
+}
+
+func getMockFactory(ctrl *gomock.Controller) azclient.ClientFactory {
+	factory := mock_azclient.NewMockClientFactory(ctrl)
+	factory.EXPECT().GetLoadBalancerClient().Return(mock_loadbalancerclient.NewMockInterface(ctrl))
+	factory.EXPECT().GetVirtualMachineScaleSetClient().Return(mock_virtualmachinescalesetclient.NewMockInterface(ctrl))
+	factory.EXPECT().GetVirtualMachineScaleSetVMClient().Return(mock_virtualmachinescalesetvmclient.NewMockInterface(ctrl))
+	factory.EXPECT().GetPublicIPPrefixClient().Return(mock_publicipprefixclient.NewMockInterface(ctrl))
+	factory.EXPECT().GetPublicIPAddressClient().Return(mock_publicipaddressclient.NewMockInterface(ctrl))
+	factory.EXPECT().GetInterfaceClient().Return(mock_interfaceclient.NewMockInterface(ctrl))
+	factory.EXPECT().GetSubnetClient().Return(mock_subnetclient.NewMockInterface(ctrl))
+	factory.EXPECT().GetVirtualNetworkClient().Return(mock_virtualnetworkclient.NewMockInterface(ctrl))
+	return factory
+}
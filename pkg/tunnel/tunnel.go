@@ -0,0 +1,54 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package tunnel
+
+import (
+	"fmt"
+	"net"
+)
+
+// ParseCIDR parses the tunnel CIDR, the IPv6 link local subnet addressing the gateway side of pod tunnels. Pod routes
+// point to its first address on gateway wireguard interfaces, and gateway namespaces use its second address on host
+// veth links as IPv6 default gateway. It must be link local as the addresses are only meaningful on their own links.
+func ParseCIDR(cidr string) (*net.IPNet, error) {
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse tunnel cidr %s: %w", cidr, err)
+	}
+	if ip.To4() != nil || !ip.IsLinkLocalUnicast() {
+		return nil, fmt.Errorf("tunnel cidr %s should be an IPv6 link local subnet within fe80::/10", cidr)
+	}
+	if ones, bits := ipNet.Mask.Size(); bits-ones < 2 {
+		return nil, fmt.Errorf("tunnel cidr %s should have room for 2 addresses", cidr)
+	}
+	return ipNet, nil
+}
+
+// OverlappingCIDRs returns the cidrs overlapping tunnelCidr, e.g. cluster pod CIDRs. Pods may then be assigned the
+// gateway address, in which case their traffic does not leave them.
+func OverlappingCIDRs(tunnelCidr *net.IPNet, cidrs []*net.IPNet) []*net.IPNet {
+	var overlapping []*net.IPNet
+	for _, cidr := range cidrs {
+		if cidr.Contains(tunnelCidr.IP) || tunnelCidr.Contains(cidr.IP) {
+			overlapping = append(overlapping, cidr)
+		}
+	}
+	return overlapping
+}
+
+// GatewayIP returns the address of gateway wireguard interfaces in tunnelCidr, the next hop of pod routes
+func GatewayIP(tunnelCidr *net.IPNet) *net.IPNet {
+	return nthIP(tunnelCidr, 1)
+}
+
+// HostVethIP returns the address of host veth links in tunnelCidr, the IPv6 default gateway in gateway namespaces
+func HostVethIP(tunnelCidr *net.IPNet) *net.IPNet {
+	return nthIP(tunnelCidr, 2)
+}
+
+func nthIP(ipNet *net.IPNet, n byte) *net.IPNet {
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, ipNet.IP.To16())
+	ip[net.IPv6len-1] += n
+	return &net.IPNet{IP: ip, Mask: ipNet.Mask}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package tunnel
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/kube-egress-gateway/pkg/consts"
+)
+
+func TestParseCIDR(t *testing.T) {
+	tests := map[string]struct {
+		cidr       string
+		gatewayIP  string
+		hostVethIP string
+		err        string
+	}{
+		"default": {
+			cidr:       consts.DefaultTunnelCidr,
+			gatewayIP:  "fe80::1/64",
+			hostVethIP: "fe80::2/64",
+		},
+		"moved subnet": {
+			cidr:       "fe80:0:0:ffff::/64",
+			gatewayIP:  "fe80:0:0:ffff::1/64",
+			hostVethIP: "fe80:0:0:ffff::2/64",
+		},
+		"host bits are masked": {
+			cidr:       "fe80::a8/126",
+			gatewayIP:  "fe80::a9/126",
+			hostVethIP: "fe80::aa/126",
+		},
+		"invalid": {
+			cidr: "fe80::",
+			err:  "failed to parse tunnel cidr fe80::: invalid CIDR address: fe80::",
+		},
+		"ipv4": {
+			cidr: "169.254.0.0/16",
+			err:  "tunnel cidr 169.254.0.0/16 should be an IPv6 link local subnet within fe80::/10",
+		},
+		"not link local": {
+			cidr: "fd00::/64",
+			err:  "tunnel cidr fd00::/64 should be an IPv6 link local subnet within fe80::/10",
+		},
+		"too small": {
+			cidr: "fe80::/127",
+			err:  "tunnel cidr fe80::/127 should have room for 2 addresses",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tunnelCidr, err := ParseCIDR(test.cidr)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, test.gatewayIP, GatewayIP(tunnelCidr).String())
+			assert.Equal(t, test.hostVethIP, HostVethIP(tunnelCidr).String())
+		})
+	}
+}
+
+func TestOverlappingCIDRs(t *testing.T) {
+	tests := map[string]struct {
+		cidrs       []string
+		overlapping []string
+	}{
+		"no pod cidrs": {},
+		"disjoint": {
+			cidrs: []string{"10.244.0.0/16", "fd00:10:244::/56", "fe80:0:0:ffff::/64"},
+		},
+		"pod cidr within tunnel cidr": {
+			cidrs:       []string{"10.244.0.0/16", "fe80::/112"},
+			overlapping: []string{"fe80::/112"},
+		},
+		"tunnel cidr within pod cidr": {
+			cidrs:       []string{"fe80::/10"},
+			overlapping: []string{"fe80::/10"},
+		},
+	}
+	tunnelCidr, _ := ParseCIDR(consts.DefaultTunnelCidr)
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var cidrs []*net.IPNet
+			for _, cidr := range test.cidrs {
+				_, ipNet, err := net.ParseCIDR(cidr)
+				assert.Nil(t, err)
+				cidrs = append(cidrs, ipNet)
+			}
+			var overlapping []string
+			for _, cidr := range OverlappingCIDRs(tunnelCidr, cidrs) {
+				overlapping = append(overlapping, cidr.String())
+			}
+			assert.Equal(t, test.overlapping, overlapping)
+		})
+	}
+}